@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils"
+)
+
+// RequireAdminRole - middleware для опасных операций (удаление данных)
+// Пропускает только супер-админа и сотрудников с ролью admin: Authorization: Bearer <token>
+func RequireAdminRole(redisUtil *utils.RedisClient) gin.HandlerFunc {
+	return requireSession(redisUtil, isAdminSession, "Доступ запрещен. Требуется роль администратора")
+}
+
+// RequireManagerRole - middleware для утверждений, которые делает менеджер (например, заказ поставщику выше порога)
+// Пропускает администраторов (как RequireAdminRole) и сотрудников в должности Manager (Staff.RoleName в сессии KDS)
+func RequireManagerRole(redisUtil *utils.RedisClient) gin.HandlerFunc {
+	return requireSession(redisUtil, func(session *wsTicket) bool {
+		return isAdminSession(session) || strings.EqualFold(session.Position, models.StaffPositionManager)
+	}, "Доступ запрещен. Требуется должность менеджера или роль администратора")
+}
+
+// isAdminSession - сессия супер-админа или пользователя с ролью admin
+func isAdminSession(session *wsTicket) bool {
+	return session.UserRole == superAdminUserRole || session.UserRole == string(models.RoleAdmin)
+}
+
+// requireSession проверяет токен Authorization: Bearer <token> и пропускает сессии, для которых allowed возвращает true
+func requireSession(redisUtil *utils.RedisClient, allowed func(session *wsTicket) bool, forbidden string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if redisUtil == nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Redis not available"})
+			return
+		}
+
+		token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Требуется авторизация"})
+			return
+		}
+
+		session, err := resolveSessionToken(redisUtil, token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   "Недействительный токен",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		if !allowed(session) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": forbidden})
+			return
+		}
+
+		c.Set("user_id", session.UserID)
+		c.Set("user_role", session.UserRole)
+		c.Next()
+	}
+}
+
+// RequireAdminRoleWhen - RequireAdminRole только для запросов, где when возвращает true
+// (например, принудительное удаление ?force=true); остальные запросы проходят без проверки
+func RequireAdminRoleWhen(redisUtil *utils.RedisClient, when func(c *gin.Context) bool) gin.HandlerFunc {
+	requireAdmin := RequireAdminRole(redisUtil)
+	return func(c *gin.Context) {
+		if !when(c) {
+			c.Next()
+			return
+		}
+		requireAdmin(c)
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"zephyrvpn/server/internal/services"
+	"zephyrvpn/server/internal/utils/timefmt"
 )
 
 type AdminController struct {
@@ -40,7 +41,7 @@ func (ac *AdminController) UpdateMenu(c *gin.Context) {
 	lastUpdate := ac.menuService.GetLastUpdate()
 	c.JSON(http.StatusOK, gin.H{
 		"message":    "Menu updated successfully (broadcasted to all servers via Redis)",
-		"last_update": lastUpdate.Format("2006-01-02 15:04:05"),
+		"last_update": timefmt.Format(lastUpdate),
 		"method":     "redis_pubsub",
 	})
 }
@@ -50,7 +51,7 @@ func (ac *AdminController) UpdateMenu(c *gin.Context) {
 func (ac *AdminController) GetMenuStatus(c *gin.Context) {
 	lastUpdate := ac.menuService.GetLastUpdate()
 	c.JSON(http.StatusOK, gin.H{
-		"last_update": lastUpdate.Format("2006-01-02 15:04:05"),
+		"last_update": timefmt.Format(lastUpdate),
 		"pizzas_count": len(GetAvailablePizzas()),
 		"sets_count":   len(GetAvailableSets()),
 		"extras_count": len(GetAvailableExtras()),
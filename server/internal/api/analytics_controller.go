@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"zephyrvpn/server/internal/services"
+	"zephyrvpn/server/internal/utils/timefmt"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,6 +15,8 @@ import (
 type AnalyticsController struct {
 	revenueService      *services.RevenueService
 	revenuePlanService   *services.RevenuePlanService
+	forecastService      *services.DemandForecastService
+	stockService         *services.StockService
 }
 
 // NewAnalyticsController создает новый контроллер аналитики
@@ -27,6 +30,16 @@ func NewAnalyticsController(
 	}
 }
 
+// SetDemandForecastService подключает сервис прогноза спроса (для отчета о точности прогнозов)
+func (ac *AnalyticsController) SetDemandForecastService(forecastService *services.DemandForecastService) {
+	ac.forecastService = forecastService
+}
+
+// SetStockService подключает сервис остатков (для отчета о марже меню)
+func (ac *AnalyticsController) SetStockService(stockService *services.StockService) {
+	ac.stockService = stockService
+}
+
 // RunForecast запускает прогнозирование выручки и сохраняет результат в БД
 // POST /api/v1/analytics/run-forecast
 // Body: {"start_date": "2006-01-02", "end_date": "2006-01-09"} - период прогноза
@@ -63,11 +76,11 @@ func (ac *AnalyticsController) RunForecast(c *gin.Context) {
 	endDate := now
 
 	if req.StartDate != "" {
-		parsedDate, err := time.Parse("2006-01-02", req.StartDate)
+		parsedDate, err := timefmt.Parse(req.StartDate)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error":   "invalid start_date format",
-				"details": "start_date must be in format YYYY-MM-DD",
+				"details": "start_date must be " + timefmt.Accepted,
 			})
 			return
 		}
@@ -75,11 +88,11 @@ func (ac *AnalyticsController) RunForecast(c *gin.Context) {
 	}
 
 	if req.EndDate != "" {
-		parsedDate, err := time.Parse("2006-01-02", req.EndDate)
+		parsedDate, err := timefmt.Parse(req.EndDate)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error":   "invalid end_date format",
-				"details": "end_date must be in format YYYY-MM-DD",
+				"details": "end_date must be " + timefmt.Accepted,
 			})
 			return
 		}
@@ -100,12 +113,12 @@ func (ac *AnalyticsController) RunForecast(c *gin.Context) {
 	daysInPeriod := daysDiff + 1
 
 	log.Printf("📊 RunForecast: запуск прогнозирования для периода %s - %s (%d дней)",
-		startDate.Format("2006-01-02"), endDate.Format("2006-01-02"), daysInPeriod)
+		timefmt.FormatDate(startDate), timefmt.FormatDate(endDate), daysInPeriod)
 
 	// Запускаем прогнозирование с указанным периодом
 	forecast, err := ac.revenueService.GetRevenueForecastForPeriod(
-		startDate.Format("2006-01-02"),
-		endDate.Format("2006-01-02"),
+		timefmt.FormatDate(startDate),
+		timefmt.FormatDate(endDate),
 	)
 	if err == nil && forecast != nil {
 		log.Printf("✅ RunForecast: прогноз получен методом '%s', результат: %.2f₽ (уверенность: %.1f%%)",
@@ -135,14 +148,14 @@ func (ac *AnalyticsController) RunForecast(c *gin.Context) {
 	}
 
 	log.Printf("✅ RunForecast: прогноз успешно создан и сохранен для периода %s - %s (уверенность: %.1f%%)",
-		startDate.Format("2006-01-02"), endDate.Format("2006-01-02"), forecast.Confidence)
+		timefmt.FormatDate(startDate), timefmt.FormatDate(endDate), forecast.Confidence)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "Прогноз успешно создан и сохранен",
 		"forecast": forecast,
-		"start_date": startDate.Format("2006-01-02"),
-		"end_date":   endDate.Format("2006-01-02"),
+		"start_date": timefmt.FormatDate(startDate),
+		"end_date":   timefmt.FormatDate(endDate),
 		"days":       daysInPeriod,
 	})
 }
@@ -161,11 +174,11 @@ func (ac *AnalyticsController) GetLatestPlan(c *gin.Context) {
 	var planDate *time.Time
 
 	if dateStr != "" {
-		parsedDate, err := time.Parse("2006-01-02", dateStr)
+		parsedDate, err := timefmt.Parse(dateStr)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error":   "invalid date format",
-				"details": "date must be in format YYYY-MM-DD",
+				"details": "date must be " + timefmt.Accepted,
 			})
 			return
 		}
@@ -196,3 +209,162 @@ func (ac *AnalyticsController) GetLatestPlan(c *gin.Context) {
 	})
 }
 
+
+// GetForecastAccuracy сравнивает прогнозы спроса с фактическим расходом и возвращает MAPE/bias по товарам
+// GET /api/v1/analytics/forecast-accuracy?from=2006-01-02&to=2006-01-31&branch_id=uuid (branch_id опционально)
+// По умолчанию - последние 30 дней
+func (ac *AnalyticsController) GetForecastAccuracy(c *gin.Context) {
+	if ac.forecastService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Demand forecast service not available",
+		})
+		return
+	}
+
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, 0, -30)
+
+	if fromStr := c.Query("from"); fromStr != "" {
+		parsed, err := timefmt.Parse(fromStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid from format",
+				"details": "from must be " + timefmt.Accepted,
+			})
+			return
+		}
+		from = parsed
+	}
+	if toStr := c.Query("to"); toStr != "" {
+		parsed, err := timefmt.Parse(toStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid to format",
+				"details": "to must be " + timefmt.Accepted,
+			})
+			return
+		}
+		to = parsed
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "to must not be before from",
+		})
+		return
+	}
+
+	accuracy, err := ac.forecastService.GetForecastAccuracy(from, to, c.Query("branch_id"))
+	if err != nil {
+		log.Printf("❌ GetForecastAccuracy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка расчета точности прогноза",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":  timefmt.FormatDate(from),
+		"to":    timefmt.FormatDate(to),
+		"items": accuracy,
+		"count": len(accuracy),
+	})
+}
+
+// GetPlanVsActual возвращает план выручки против факта по дням (из ежедневной сверки в момент закрытия)
+// GET /api/v1/analytics/plan-vs-actual?from=2006-01-02&to=2006-01-31&branch_id=...
+// По умолчанию - последние 30 дней; variance = actual - planned
+func (ac *AnalyticsController) GetPlanVsActual(c *gin.Context) {
+	if ac.revenuePlanService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Revenue plan service not available",
+		})
+		return
+	}
+
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, 0, -30)
+
+	if fromStr := c.Query("from"); fromStr != "" {
+		parsed, err := timefmt.Parse(fromStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid from format",
+				"details": "from must be " + timefmt.Accepted,
+			})
+			return
+		}
+		from = parsed
+	}
+	if toStr := c.Query("to"); toStr != "" {
+		parsed, err := timefmt.Parse(toStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid to format",
+				"details": "to must be " + timefmt.Accepted,
+			})
+			return
+		}
+		to = parsed
+	}
+	if to.Before(from) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "to must not be before from",
+		})
+		return
+	}
+
+	series, err := ac.revenuePlanService.GetPlanVsActual(from, to, c.Query("branch_id"))
+	if err != nil {
+		log.Printf("❌ GetPlanVsActual: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка получения плана и факта выручки",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":  timefmt.FormatDate(from),
+		"to":    timefmt.FormatDate(to),
+		"items": series,
+		"count": len(series),
+	})
+}
+
+// GetMenuMargins возвращает себестоимость, цену продажи и маржу всех активных позиций меню
+// GET /api/v1/analytics/menu-margins
+// Позиции с маржой ниже MENU_MARGIN_THRESHOLD_PERCENT помечены low_margin
+func (ac *AnalyticsController) GetMenuMargins(c *gin.Context) {
+	if ac.stockService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Stock service not available",
+		})
+		return
+	}
+
+	rows, err := ac.stockService.GetMenuMarginReport()
+	if err != nil {
+		log.Printf("❌ GetMenuMargins: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка расчета маржи меню",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	lowMargin := 0
+	for _, row := range rows {
+		if row.LowMargin {
+			lowMargin++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":            rows,
+		"count":            len(rows),
+		"low_margin_count": lowMargin,
+	})
+}
@@ -1,18 +1,23 @@
 package api
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils"
 	"gorm.io/gorm"
 )
 
 // AuthController управляет API endpoints для авторизации
 type AuthController struct {
-	db *gorm.DB
+	db        *gorm.DB
+	redisUtil *utils.RedisClient
 }
 
 // NewAuthController создает новый контроллер авторизации
@@ -20,6 +25,11 @@ func NewAuthController(db *gorm.DB) *AuthController {
 	return &AuthController{db: db}
 }
 
+// SetRedisClient подключает Redis для хранения выданных токенов (нужны для выдачи WS-тикетов)
+func (ac *AuthController) SetRedisClient(redisUtil *utils.RedisClient) {
+	ac.redisUtil = redisUtil
+}
+
 // SuperAdminLoginRequest представляет запрос на вход супер-админа
 type SuperAdminLoginRequest struct {
 	Username      string `json:"username" binding:"required"`
@@ -94,6 +104,11 @@ func (ac *AuthController) SuperAdminLogin(c *gin.Context) {
 
 	// Генерируем токен (упрощенная версия, в продакшене использовать JWT)
 	token := generateSimpleToken(admin.ID)
+	if ac.redisUtil != nil {
+		if err := ac.redisUtil.Set(superAdminTokenKey(token), admin.ID, 24*time.Hour); err != nil {
+			log.Printf("⚠️ SuperAdminLogin: ошибка сохранения токена в Redis: %v", err)
+		}
+	}
 
 	// Устанавливаем ИП для админа, если еще не установлен
 	if admin.LegalEntityID == nil {
@@ -117,6 +132,9 @@ func (ac *AuthController) SuperAdminLogin(c *gin.Context) {
 // generateSimpleToken генерирует простой токен (в продакшене использовать JWT)
 func generateSimpleToken(adminID string) string {
 	// Упрощенная версия - в продакшене использовать JWT с подписью
-	return "super_admin_token_" + adminID + "_" + time.Now().Format("20060102150405")
+	// Случайный суффикс делает токен неугадываемым (по нему выдаются WS-тикеты)
+	suffix := make([]byte, 16)
+	rand.Read(suffix)
+	return "super_admin_token_" + adminID + "_" + time.Now().Format("20060102150405") + "_" + hex.EncodeToString(suffix)
 }
 
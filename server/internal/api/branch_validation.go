@@ -0,0 +1,48 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"zephyrvpn/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// resolveBranchID проверяет branch_id запроса по списку активных филиалов и подставляет филиал по умолчанию
+// Неизвестный филиал - 400 со списком допустимых (valid_branches); required - пустой branch_id без филиала по умолчанию тоже 400.
+// Без branchService (нет БД) branch_id возвращается как есть. При ошибке отвечает клиенту сам и возвращает false
+func resolveBranchID(c *gin.Context, branchService *services.BranchService, branchID string, required bool) (string, bool) {
+	if branchService == nil {
+		if required && branchID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "branch_id обязателен"})
+			return "", false
+		}
+		return branchID, true
+	}
+
+	resolved, err := branchService.ResolveBranchID(branchID)
+	if err != nil {
+		if !errors.Is(err, services.ErrUnknownBranch) {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Ошибка проверки филиала",
+				"details": err.Error(),
+			})
+			return "", false
+		}
+		response := gin.H{
+			"error":   "Неизвестный филиал",
+			"details": err.Error(),
+		}
+		if branches, listErr := branchService.ActiveBranches(); listErr == nil {
+			response["valid_branches"] = branches
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return "", false
+	}
+	if required && resolved == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "branch_id обязателен (филиал по умолчанию не задан)"})
+		return "", false
+	}
+	return resolved, true
+}
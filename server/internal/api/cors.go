@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsAnyOrigin - явное разрешение любого origin (только для локальной разработки)
+const corsAnyOrigin = "*"
+
+// CORSMiddleware разрешает кросс-доменные запросы только с origin из allow-list
+// Origin запроса возвращается в Access-Control-Allow-Origin только при совпадении (без учета регистра и "/" в конце),
+// "*" в списке разрешает любой origin. Preflight (OPTIONS) всегда завершается 204 -
+// для чужого origin браузер сам отклонит запрос, не увидев Access-Control-Allow-Origin
+func CORSMiddleware(allowedOrigins []string) gin.HandlerFunc {
+	allowAny := false
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		origin = normalizeOrigin(origin)
+		if origin == "" {
+			continue
+		}
+		if origin == corsAnyOrigin {
+			allowAny = true
+			continue
+		}
+		allowed[origin] = true
+	}
+
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+		// Ответ зависит от Origin - кэши (CDN, браузер) не должны отдавать его другому origin
+		header.Add("Vary", "Origin")
+
+		if allowAny {
+			header.Set("Access-Control-Allow-Origin", corsAnyOrigin)
+		} else if origin := c.GetHeader("Origin"); origin != "" && allowed[normalizeOrigin(origin)] {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		header.Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		header.Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, X-Order-Channel")
+		header.Set("Access-Control-Expose-Headers", "X-Request-ID, Retry-After")
+
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// normalizeOrigin приводит origin к виду для сравнения: scheme://host[:port] в нижнем регистре
+func normalizeOrigin(origin string) string {
+	return strings.ToLower(strings.TrimRight(strings.TrimSpace(origin), "/"))
+}
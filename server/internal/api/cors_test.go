@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func corsRequest(allowedOrigins []string, method, origin string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(CORSMiddleware(allowedOrigins))
+	router.GET("/items", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := httptest.NewRequest(method, "/items", nil)
+	if origin != "" {
+		request.Header.Set("Origin", origin)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestCORSMiddlewareAllowList(t *testing.T) {
+	allowed := []string{"https://erp.example.com/", " https://Admin.Example.com "}
+	cases := []struct {
+		origin string
+		want   string // Ожидаемый Access-Control-Allow-Origin (пусто - заголовка нет)
+	}{
+		{"https://erp.example.com", "https://erp.example.com"},
+		// Сравнение без учета регистра и "/" в конце, в ответ возвращается origin запроса как есть
+		{"https://admin.example.com", "https://admin.example.com"},
+		{"https://ERP.example.com/", "https://ERP.example.com/"},
+		{"https://evil.example.com", ""},
+		{"http://erp.example.com", ""},
+		{"", ""},
+	}
+	for _, tc := range cases {
+		recorder := corsRequest(allowed, http.MethodGet, tc.origin)
+		if recorder.Code != http.StatusOK {
+			t.Errorf("Origin %q: код %d, want 200", tc.origin, recorder.Code)
+		}
+		header := recorder.Header()
+		if got := header.Get("Access-Control-Allow-Origin"); got != tc.want {
+			t.Errorf("Origin %q: Access-Control-Allow-Origin = %q, want %q", tc.origin, got, tc.want)
+		}
+		if got := header.Values("Vary"); len(got) != 1 || got[0] != "Origin" {
+			t.Errorf("Origin %q: Vary = %v, want [Origin]", tc.origin, got)
+		}
+	}
+}
+
+func TestCORSMiddlewareWildcardIsOptIn(t *testing.T) {
+	// Пустой список - кросс-доменные запросы не разрешены
+	if got := corsRequest(nil, http.MethodGet, "https://erp.example.com").Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("без списка Access-Control-Allow-Origin = %q, want пусто", got)
+	}
+	// "*" разрешает любой origin только если указан явно
+	if got := corsRequest([]string{"*"}, http.MethodGet, "https://any.example.com").Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("со \"*\" Access-Control-Allow-Origin = %q, want *", got)
+	}
+}
+
+func TestCORSMiddlewarePreflight(t *testing.T) {
+	allowed := []string{"https://erp.example.com"}
+	for _, origin := range []string{"https://erp.example.com", "https://evil.example.com"} {
+		recorder := corsRequest(allowed, http.MethodOptions, origin)
+		if recorder.Code != http.StatusNoContent {
+			t.Errorf("OPTIONS с Origin %q: код %d, want 204", origin, recorder.Code)
+		}
+		if recorder.Header().Get("Access-Control-Allow-Methods") == "" {
+			t.Errorf("OPTIONS с Origin %q: нет Access-Control-Allow-Methods", origin)
+		}
+	}
+	if got := corsRequest(allowed, http.MethodOptions, "https://evil.example.com").Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("preflight чужого origin: Access-Control-Allow-Origin = %q, want пусто", got)
+	}
+}
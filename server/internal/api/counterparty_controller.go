@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"strconv"
 
 	"zephyrvpn/server/internal/models"
 	"zephyrvpn/server/internal/services"
@@ -12,7 +13,8 @@ import (
 
 // CounterpartyController управляет API endpoints для контрагентов
 type CounterpartyController struct {
-	service *services.CounterpartyService
+	service       *services.CounterpartyService
+	branchService *services.BranchService // Проверка branch_id счета и филиал по умолчанию (может быть nil)
 }
 
 // NewCounterpartyController создает новый контроллер контрагентов
@@ -22,10 +24,42 @@ func NewCounterpartyController(service *services.CounterpartyService) *Counterpa
 	}
 }
 
-// GetCounterparties получает список всех контрагентов
-// GET /api/v1/finance/counterparties
+// SetBranchService включает проверку branch_id счетов по списку филиалов
+func (cc *CounterpartyController) SetBranchService(branchService *services.BranchService) {
+	cc.branchService = branchService
+}
+
+// GetCounterparties получает страницу активных контрагентов
+// GET /api/v1/finance/counterparties?search=ромашка&has_debt=true&limit=100&offset=0
+// search - часть названия или ИНН, has_debt - только с ненулевым балансом (false - только без долга)
+// total - количество контрагентов по фильтрам, next_offset - смещение следующей страницы
 func (cc *CounterpartyController) GetCounterparties(c *gin.Context) {
-	counterparties, err := cc.service.GetAllCounterparties()
+	filter := services.CounterpartyFilter{
+		Search: c.Query("search"),
+	}
+	if value := c.Query("has_debt"); value != "" {
+		hasDebt, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Неверный has_debt, допустимо: true, false",
+			})
+			return
+		}
+		filter.HasDebt = &hasDebt
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(services.DefaultCounterpartyPageLimit)))
+	if err != nil || limit <= 0 || limit > services.MaxCounterpartyPageLimit {
+		limit = services.DefaultCounterpartyPageLimit
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	filter.Limit = limit
+	filter.Offset = offset
+
+	counterparties, total, err := cc.service.GetCounterparties(filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Ошибка получения контрагентов",
@@ -34,9 +68,19 @@ func (cc *CounterpartyController) GetCounterparties(c *gin.Context) {
 		return
 	}
 
+	// next_offset - смещение следующей страницы (null, если это последняя)
+	var nextOffset *int
+	if next := offset + len(counterparties); len(counterparties) > 0 && int64(next) < total {
+		nextOffset = &next
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"counterparties": counterparties,
 		"count":          len(counterparties),
+		"total":          total,
+		"offset":         offset,
+		"limit":          limit,
+		"next_offset":    nextOffset,
 	})
 }
 
@@ -228,6 +272,12 @@ func (cc *CounterpartyController) CreateInvoice(c *gin.Context) {
 		return
 	}
 
+	branchID, ok := resolveBranchID(c, cc.branchService, req.BranchID, true)
+	if !ok {
+		return
+	}
+	req.BranchID = branchID
+
 	// Генерируем ID если не указан
 	if req.ID == "" {
 		req.ID = uuid.New().String()
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zephyrvpn/server/internal/services"
+	"zephyrvpn/server/internal/utils/timefmt"
+)
+
+// CurrencyController управляет API endpoints для курсов валют
+type CurrencyController struct {
+	currencyService *services.CurrencyService
+}
+
+// NewCurrencyController создает новый контроллер курсов валют
+func NewCurrencyController(currencyService *services.CurrencyService) *CurrencyController {
+	return &CurrencyController{
+		currencyService: currencyService,
+	}
+}
+
+// GetExchangeRates возвращает действующие курсы валют к рублю на дату
+// GET /api/v1/finance/exchange-rates?date=2026-01-15
+func (cc *CurrencyController) GetExchangeRates(c *gin.Context) {
+	date := time.Now()
+	if dateStr := c.Query("date"); dateStr != "" {
+		parsed, err := timefmt.Parse(dateStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Неверный формат даты, ожидается " + timefmt.Accepted,
+				"details": err.Error(),
+			})
+			return
+		}
+		date = parsed
+	}
+
+	rates, err := cc.currencyService.GetExchangeRates(date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка получения курсов валют",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"base_currency": "RUB",
+		"date":          timefmt.FormatDate(date),
+		"rates":         rates,
+		"count":         len(rates),
+	})
+}
+
+// SetExchangeRate задает курс валюты на дату (ручная таблица курсов)
+// POST /api/v1/finance/exchange-rates
+func (cc *CurrencyController) SetExchangeRate(c *gin.Context) {
+	var req struct {
+		Currency string  `json:"currency" binding:"required"`
+		Rate     float64 `json:"rate" binding:"required"`
+		Date     string  `json:"date"` // YYYY-MM-DD, по умолчанию сегодня
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверные данные",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	date := time.Now()
+	if req.Date != "" {
+		parsed, err := timefmt.Parse(req.Date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Неверный формат даты, ожидается " + timefmt.Accepted,
+				"details": err.Error(),
+			})
+			return
+		}
+		date = parsed
+	}
+
+	rate, err := cc.currencyService.SetExchangeRate(req.Currency, req.Rate, date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Ошибка сохранения курса",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Курс сохранен",
+		"data":    rate,
+	})
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/proto"
+	"zephyrvpn/server/internal/pb"
+	"zephyrvpn/server/internal/utils"
+	"zephyrvpn/server/internal/utils/rediskeys"
+)
+
+// batchProcessedRouter - маршрут пакетной обработки заказов
+func batchProcessedRouter(redisUtil *utils.RedisClient) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	ec := NewERPController(redisUtil, "", "", nil, 0, 0, 23, 59)
+	router := gin.New()
+	router.POST("/orders/batch-processed", ec.MarkOrdersProcessedBatch)
+	return router
+}
+
+func TestMarkOrdersProcessedBatchValidatesRequest(t *testing.T) {
+	router := batchProcessedRouter(newUnreachableRedis(t))
+
+	tooMany := make([]string, maxBatchProcessedOrders+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("%q", fmt.Sprintf("order-%d", i))
+	}
+	for _, body := range []string{
+		`{}`,
+		`{"order_ids": []}`,
+		`not json`,
+		`{"order_ids": [` + strings.Join(tooMany, ",") + `]}`,
+	} {
+		code, payload := degradedResponse(t, router, http.MethodPost, "/orders/batch-processed", body)
+		if code != http.StatusBadRequest {
+			t.Errorf("тело %.40q: код %d (%v), want 400", body, code, payload["error"])
+		}
+	}
+}
+
+func TestMarkOrdersProcessedBatch(t *testing.T) {
+	redisUtil := newTestRedis(t)
+	router := batchProcessedRouter(redisUtil)
+
+	saveOrder := func(id, status, slotID string) {
+		t.Helper()
+		data, err := proto.Marshal(&pb.PizzaOrder{Id: id, Status: status, TargetSlotId: slotID, CreatedAt: time.Now().UnixNano()})
+		if err != nil {
+			t.Fatalf("proto.Marshal: %v", err)
+		}
+		if err := redisUtil.SetBytes(rediskeys.OrderKey(id), data, time.Hour); err != nil {
+			t.Fatalf("SetBytes: %v", err)
+		}
+		if err := redisUtil.SAdd(rediskeys.OrdersActiveKey, id); err != nil {
+			t.Fatalf("SAdd: %v", err)
+		}
+	}
+	saveOrder("order-cooking", "cooking", "slot:1")
+	saveOrder("order-accepted", "accepted", "slot:1")
+	saveOrder("order-completed", "completed", "slot:1")
+	saveOrder("order-other-slot", "cooking", "slot:2")
+
+	// Заказы слота + явный ID; дубли и пустые ID пропускаются, несуществующий заказ - ошибка по позиции
+	body := `{"slot_id": "slot:1", "order_ids": ["order-cooking", "", "missing"]}`
+	code, payload := degradedResponse(t, router, http.MethodPost, "/orders/batch-processed", body)
+	if code != http.StatusOK {
+		t.Fatalf("код %d (%v), want 200", code, payload)
+	}
+	if payload["processed"] != float64(2) || payload["failed"] != float64(2) {
+		t.Errorf("processed %v, failed %v; want 2 и 2 (completed и missing)", payload["processed"], payload["failed"])
+	}
+
+	results := make(map[string]bool)
+	for _, raw := range payload["results"].([]interface{}) {
+		result := raw.(map[string]interface{})
+		results[result["order_id"].(string)] = result["success"].(bool)
+	}
+	want := map[string]bool{"order-cooking": true, "order-accepted": true, "order-completed": false, "missing": false}
+	if len(results) != len(want) {
+		t.Errorf("результаты %v, want %v", results, want)
+	}
+	for orderID, success := range want {
+		if results[orderID] != success {
+			t.Errorf("заказ %s: success %v, want %v", orderID, results[orderID], success)
+		}
+	}
+
+	active, err := redisUtil.SMembers(rediskeys.OrdersActiveKey)
+	if err != nil {
+		t.Fatalf("SMembers: %v", err)
+	}
+	activeSet := make(map[string]bool)
+	for _, id := range active {
+		activeSet[id] = true
+	}
+	if activeSet["order-cooking"] || activeSet["order-accepted"] || !activeSet["order-completed"] || !activeSet["order-other-slot"] {
+		t.Errorf("активные заказы после обработки: %v, want только order-completed и order-other-slot", active)
+	}
+	if exists, _ := redisUtil.Exists(rediskeys.OrderKey("order-cooking")); exists {
+		t.Error("обработанный заказ не удален из Redis")
+	}
+	archived, err := redisUtil.LRange(rediskeys.OrdersArchiveKey, 0, -1)
+	if err != nil || len(archived) != 2 {
+		t.Errorf("архив %v (%v), want 2 заказа", archived, err)
+	}
+}
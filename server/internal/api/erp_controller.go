@@ -4,15 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"github.com/segmentio/kafka-go"
 	"gorm.io/gorm"
 	"google.golang.org/protobuf/proto"
@@ -20,19 +23,26 @@ import (
 	"zephyrvpn/server/internal/pb"
 	"zephyrvpn/server/internal/services"
 	"zephyrvpn/server/internal/utils"
+	"zephyrvpn/server/internal/utils/rediskeys"
+	"zephyrvpn/server/internal/utils/timefmt"
 )
 
 type ERPController struct {
 	redisUtil          *utils.RedisClient
 	kafkaBrokers       string
+	kafkaTopic         string // Топик заказов (для диагностики Kafka в ERP)
 	slotService        *services.SlotService
 	revenueService     *services.RevenueService
 	dailyPlanService   *services.DailyPlanService
 	kitchenLoadService *services.KitchenLoadService
 	stationAssignService *services.StationAssignmentService
+	orderService       *services.OrderService // PostgreSQL история заказов (может быть nil)
+	stockService       *services.StockService // Списания по заказу для трассировки и резерв ингредиентов (может быть nil)
+	shiftSummaryService *services.ShiftSummaryService
+	kafkaLagWatchdog   *KafkaLagWatchdog // Отставание обработки заказов из Kafka (может быть nil)
 }
 
-func NewERPController(redisUtil *utils.RedisClient, kafkaBrokers string, db interface{}, openHour, openMin, closeHour, closeMin int) *ERPController {
+func NewERPController(redisUtil *utils.RedisClient, kafkaBrokers, kafkaTopic string, db interface{}, openHour, openMin, closeHour, closeMin int) *ERPController {
 	// Преобразуем db в *gorm.DB если возможно
 	var gormDB *gorm.DB
 	if db != nil {
@@ -40,33 +50,63 @@ func NewERPController(redisUtil *utils.RedisClient, kafkaBrokers string, db inte
 			gormDB = gdb
 		}
 	}
-	slotService := services.NewSlotService(redisUtil, gormDB, openHour, openMin, closeHour, closeMin)
+	slotService := services.NewSlotService(redisUtil, gormDB, openHour, openMin, closeHour, closeMin, services.RealClock{})
 	revenueService := services.NewRevenueService(redisUtil, gormDB)
 	dailyPlanService := services.NewDailyPlanService(redisUtil)
+	dailyPlanService.SetDB(gormDB)
 	kitchenLoadService := services.NewKitchenLoadService(slotService)
 	stationAssignService := services.NewStationAssignmentService(gormDB, redisUtil)
+	if kafkaTopic == "" {
+		kafkaTopic = DefaultKafkaOrdersTopic
+	}
 	return &ERPController{
 		redisUtil:           redisUtil,
 		kafkaBrokers:        kafkaBrokers,
+		kafkaTopic:          kafkaTopic,
 		slotService:         slotService,
 		revenueService:      revenueService,
 		dailyPlanService:    dailyPlanService,
 		kitchenLoadService:  kitchenLoadService,
 		stationAssignService: stationAssignService,
+		shiftSummaryService: services.NewShiftSummaryService(gormDB),
 	}
 }
 
+// SetOrderService подключает сервис истории заказов (PostgreSQL)
+func (ec *ERPController) SetOrderService(orderService *services.OrderService) {
+	ec.orderService = orderService
+}
+
+// SetKafkaLagWatchdog подключает watchdog отставания consumer group (для GET /erp/kafka-lag)
+func (ec *ERPController) SetKafkaLagWatchdog(watchdog *KafkaLagWatchdog) {
+	ec.kafkaLagWatchdog = watchdog
+}
+
+// SlotService возвращает сервис слотов ERP (для фоновых задач, например архивации слотов)
+func (ec *ERPController) SlotService() *services.SlotService {
+	return ec.slotService
+}
+
 // GetOrders получает все АКТИВНЫЕ заказы для ERP системы (те, что висят на планшете)
 // Поддерживает фильтрацию по роли: ?role=kitchen|courier|admin
+//
+// @Summary      Активные заказы
+// @Description  Заказы, у которых наступило VisibleAt. Состав полей зависит от роли
+// @Tags         erp
+// @Produce      json
+// @Param        role        query     string  false  "Роль"  Enums(kitchen, courier, admin)
+// @Param        station_id  query     string  false  "ID станции кухни (заполняет can_work)"
+// @Success      200         {object}  OrdersResponse
+// @Router       /erp/orders [get]
 func (ec *ERPController) GetOrders(c *gin.Context) {
 	orders := make([]models.PizzaOrder, 0)
 	
 	if ec.redisUtil == nil {
-		// Если Redis недоступен, возвращаем пустой список
-		c.JSON(http.StatusOK, gin.H{
-			"system": "ЕРПИ ТЕСТ",
-			"orders": orders,
-			"count":  0,
+		// Если Redis недоступен, возвращаем пустой список (планшет продолжает работать)
+		respondDegraded(c, gin.H{
+			"system":  "ЕРПИ ТЕСТ",
+			"orders":  orders,
+			"count":   0,
 			"message": "Redis not available, returning empty list",
 		})
 		return
@@ -85,7 +125,7 @@ func (ec *ERPController) GetOrders(c *gin.Context) {
 	ec.checkAndActivatePendingOrders()
 
 	// Получаем список ID АКТИВНЫХ заказов (из множества)
-	orderIDs, err := ec.redisUtil.SMembers("erp:orders:active")
+	orderIDs, err := ec.redisUtil.SMembers(rediskeys.OrdersActiveKey)
 	if err != nil {
 		log.Printf("❌ GetOrders: ошибка получения активных заказов из Redis: %v", err)
 		// Если ошибка, возвращаем пустой список
@@ -126,12 +166,13 @@ func (ec *ERPController) GetOrders(c *gin.Context) {
 		}
 		
 		// Если заказ в active, но имеет статус "pending", обновляем на "accepted"
-		if order.Status == "pending" {
-			order.Status = "accepted"
+		if order.Status == string(models.OrderStatusPending) {
+			order.Status = string(models.OrderStatusAccepted)
 			// Сохраняем обновленный заказ обратно в Redis
 			orderJSON, _ := json.Marshal(order)
-			orderKey := fmt.Sprintf("erp:order:%s", orderID)
-			ec.redisUtil.SetBytes(orderKey, orderJSON, 24*time.Hour)
+			orderKey := rediskeys.OrderKey(orderID)
+			ec.redisUtil.SetBytes(orderKey, orderJSON, rediskeys.OrderTTL())
+			recordOrderStatus(ec.redisUtil, orderID, order.Status, "kds_activation")
 		}
 		
 		// Фильтруем заказы по станции (если указан station_id)
@@ -151,7 +192,7 @@ func (ec *ERPController) GetOrders(c *gin.Context) {
 		}
 		
 		// Фильтруем данные в зависимости от роли
-		filteredOrder := ec.filterOrderByRole(*order, role)
+		filteredOrder := filterOrderByRole(*order, role)
 		orders = append(orders, filteredOrder)
 	}
 	
@@ -170,7 +211,8 @@ func (ec *ERPController) GetOrders(c *gin.Context) {
 }
 
 // filterOrderByRole фильтрует данные заказа в зависимости от роли
-func (ec *ERPController) filterOrderByRole(order models.PizzaOrder, role string) models.PizzaOrder {
+// Используется и в HTTP ответах, и при рассылке по WebSocket (роль соединения из WS-тикета)
+func filterOrderByRole(order models.PizzaOrder, role string) models.PizzaOrder {
 	filtered := order
 	
 	switch role {
@@ -186,10 +228,13 @@ func (ec *ERPController) filterOrderByRole(order models.PizzaOrder, role string)
 		filtered.DiscountPercent = 0
 		filtered.FinalPrice = 0
 		filtered.Notes = ""
+		filtered.Items = withoutItemDiscounts(order.Items)
 		
 	case "courier": // Курьеры - информация для доставки
 		// Оставляем: delivery_address, customer_phone, call_before_minutes, payment_method, is_pickup
 		// Убираем: exclude_ingredients (детали готовки), discount, final_price
+		// Копируем позиции, чтобы не менять исходный заказ (он может рассылаться другим ролям)
+		filtered.Items = withoutItemDiscounts(order.Items)
 		for i := range filtered.Items {
 			filtered.Items[i].ExcludeIngredients = nil
 		}
@@ -212,11 +257,73 @@ func (ec *ERPController) filterOrderByRole(order models.PizzaOrder, role string)
 		filtered.DiscountPercent = 0
 		filtered.FinalPrice = 0
 		filtered.Notes = ""
+		filtered.Items = withoutItemDiscounts(order.Items)
 	}
 	
 	return filtered
 }
 
+// withoutItemDiscounts копирует позиции без скидок на них (скидки видят только админы)
+// Копия нужна, чтобы не менять исходный заказ (он может рассылаться другим ролям)
+func withoutItemDiscounts(items []models.PizzaItem) []models.PizzaItem {
+	result := append([]models.PizzaItem(nil), items...)
+	for i := range result {
+		result[i].DiscountAmount = 0
+		result[i].DiscountPercent = 0
+	}
+	return result
+}
+
+// GetStationQueue возвращает очередь станции: только ее позиции по всем активным заказам,
+// по сроку слота, затем по приоритету (начатые раньше ожидающих)
+// GET /api/v1/erp/stations/:id/queue
+func (ec *ERPController) GetStationQueue(c *gin.Context) {
+	if ec.redisUtil == nil || ec.stationAssignService == nil {
+		respondRedisUnavailable(c)
+		return
+	}
+	stationID := c.Param("id")
+
+	orderIDs, err := ec.redisUtil.SMembers(rediskeys.OrdersActiveKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get active orders",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// Как и в GetOrders: заказы, время показа которых еще не наступило, на планшет не попадают
+	now := time.Now().UTC()
+	orders := make([]*models.PizzaOrder, 0, len(orderIDs))
+	for _, orderID := range orderIDs {
+		order, err := ec.getOrderFromRedis(orderID)
+		if err != nil || (!order.VisibleAt.IsZero() && now.Before(order.VisibleAt)) {
+			continue
+		}
+		orders = append(orders, order)
+	}
+
+	queue, err := ec.stationAssignService.GetStationQueue(stationID, orders)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			statusCode = http.StatusNotFound
+		}
+		c.JSON(statusCode, gin.H{
+			"error":   "Failed to get station queue",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"station_id": stationID,
+		"items":      queue,
+		"count":      len(queue),
+	})
+}
+
 // GetOrder получает конкретный заказ по ID
 func (ec *ERPController) GetOrder(c *gin.Context) {
 	orderID := c.Param("id")
@@ -230,7 +337,7 @@ func (ec *ERPController) GetOrder(c *gin.Context) {
 	}
 	
 	if ec.redisUtil == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Redis not available"})
+		respondRedisUnavailable(c)
 		return
 	}
 
@@ -252,7 +359,7 @@ func (ec *ERPController) GetStats(c *gin.Context) {
 	if ec.redisUtil != nil {
 		totalVal, _ := ec.redisUtil.Get("orders:total")
 		todayVal, _ := ec.redisUtil.Get("orders:today:" + time.Now().Format("2006-01-02"))
-		pendingVal, _ := ec.redisUtil.Get("erp:orders:pending")
+		pendingVal, _ := ec.redisUtil.Get(rediskeys.OrdersPendingKey)
 		
 		if totalVal != "" {
 			total = totalVal
@@ -269,19 +376,20 @@ func (ec *ERPController) GetStats(c *gin.Context) {
 		processed = int(processedCount)
 		
 		// Обновляем счетчик для совместимости (опционально)
-		ec.redisUtil.Set("erp:orders:processed", fmt.Sprintf("%d", processed), 0)
+		ec.redisUtil.Set(rediskeys.OrdersProcessedKey, fmt.Sprintf("%d", processed), 0)
 	}
 
-	// Получаем выручку за сегодня
+	// Получаем выручку за сегодня (бизнес-день филиала, если передан ?branch_id=)
+	branchID := c.Query("branch_id")
 	var revenue *services.RevenueStats
 	if ec.revenueService != nil {
-		revenue, _ = ec.revenueService.GetRevenueForToday()
+		revenue, _ = ec.revenueService.GetRevenueForBranchToday(branchID)
 	}
 
-	// Получаем план на сегодня
-	var dailyPlan float64 = 500000.0
+	// Получаем план на сегодня (без явного плана на дату - план по умолчанию для дня недели)
+	var dailyPlan float64
 	if ec.dailyPlanService != nil {
-		dailyPlan, _ = ec.dailyPlanService.GetDailyPlanForToday()
+		dailyPlan, _ = ec.dailyPlanService.GetDailyPlanForBranchToday(branchID)
 	}
 
 	response := gin.H{
@@ -290,7 +398,7 @@ func (ec *ERPController) GetStats(c *gin.Context) {
 		"pending_orders":   pending,
 		"processed_orders": fmt.Sprintf("%d", processed),
 		"system":           "ЕРПИ ТЕСТ",
-		"timestamp":        time.Now().Format(time.RFC3339),
+		"timestamp":        timefmt.Format(time.Now()),
 	}
 
 	// Добавляем выручку если есть
@@ -302,6 +410,7 @@ func (ec *ERPController) GetStats(c *gin.Context) {
 			"online":           revenue.Online,
 			"discounts":         revenue.Discounts,
 			"completed_orders": revenue.CompletedOrders,
+			"by_channel":       revenue.ByChannel,
 			"change":           revenue.Change,
 		}
 	}
@@ -309,6 +418,11 @@ func (ec *ERPController) GetStats(c *gin.Context) {
 	// Добавляем план на день
 	response["daily_plan"] = dailyPlan
 
+	// Без Redis счетчики заказов нулевые - клиент показывает их как недоступные
+	if ec.redisUtil == nil {
+		respondDegraded(c, response)
+		return
+	}
 	c.JSON(http.StatusOK, response)
 }
 
@@ -316,7 +430,7 @@ func (ec *ERPController) GetStats(c *gin.Context) {
 // Поддерживает фильтрацию по роли: ?role=kitchen|courier|admin
 func (ec *ERPController) GetOrdersBatch(c *gin.Context) {
 	if ec.redisUtil == nil {
-		c.JSON(http.StatusOK, gin.H{
+		respondDegraded(c, gin.H{
 			"orders": []models.PizzaOrder{},
 			"count":  0,
 			"processed": 0,
@@ -335,7 +449,7 @@ func (ec *ERPController) GetOrdersBatch(c *gin.Context) {
 	ec.checkAndActivatePendingOrders()
 
 	// Получаем все АКТИВНЫЕ заказы (те, что висят на планшете)
-	activeOrderIDs, err := ec.redisUtil.SMembers("erp:orders:active")
+	activeOrderIDs, err := ec.redisUtil.SMembers(rediskeys.OrdersActiveKey)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"orders": []models.PizzaOrder{},
@@ -382,16 +496,17 @@ func (ec *ERPController) GetOrdersBatch(c *gin.Context) {
 		}
 		
 		// Если заказ в active, но имеет статус "pending", обновляем на "accepted"
-		if order.Status == "pending" {
-			order.Status = "accepted"
+		if order.Status == string(models.OrderStatusPending) {
+			order.Status = string(models.OrderStatusAccepted)
 			// Сохраняем обновленный заказ обратно в Redis
 			orderJSON, _ := json.Marshal(order)
-			orderKey := fmt.Sprintf("erp:order:%s", orderID)
-			ec.redisUtil.SetBytes(orderKey, orderJSON, 24*time.Hour)
+			orderKey := rediskeys.OrderKey(orderID)
+			ec.redisUtil.SetBytes(orderKey, orderJSON, rediskeys.OrderTTL())
+			recordOrderStatus(ec.redisUtil, orderID, order.Status, "kds_activation")
 		}
 		
 		// Фильтруем данные по роли
-		filteredOrder := ec.filterOrderByRole(*order, role)
+		filteredOrder := filterOrderByRole(*order, role)
 		orders = append(orders, filteredOrder)
 	}
 	
@@ -422,10 +537,10 @@ func (ec *ERPController) GetPendingOrders(c *gin.Context) {
 	
 	if ec.redisUtil == nil {
 		log.Printf("⚠️ GetPendingOrders: Redis недоступен")
-		c.JSON(http.StatusOK, gin.H{
-			"system": "ЕРПИ ТЕСТ",
-			"orders": orders,
-			"count":  0,
+		respondDegraded(c, gin.H{
+			"system":  "ЕРПИ ТЕСТ",
+			"orders":  orders,
+			"count":   0,
 			"message": "Redis not available, returning empty list",
 		})
 		return
@@ -439,7 +554,7 @@ func (ec *ERPController) GetPendingOrders(c *gin.Context) {
 	log.Printf("📋 GetPendingOrders: role=%s", role)
 
 	// Получаем список ID ОТЛОЖЕННЫХ заказов (из множества pending_slots)
-	pendingOrderIDs, err := ec.redisUtil.SMembers("erp:orders:pending_slots")
+	pendingOrderIDs, err := ec.redisUtil.SMembers(rediskeys.OrdersPendingSlotsKey)
 	if err != nil {
 		log.Printf("❌ GetPendingOrders: ошибка получения отложенных заказов из Redis: %v", err)
 		c.JSON(http.StatusOK, gin.H{
@@ -470,14 +585,14 @@ func (ec *ERPController) GetPendingOrders(c *gin.Context) {
 		// (это и есть их особенность - они отложенные)
 		
 		// Фильтруем данные в зависимости от роли
-		filteredOrder := ec.filterOrderByRole(*order, role)
+		filteredOrder := filterOrderByRole(*order, role)
 		orders = append(orders, filteredOrder)
 	}
 	
 	// Очищаем "мертвые" заказы из pending_slots (заказы, которых уже нет в Redis)
 	if len(deadOrderIDs) > 0 {
 		for _, deadID := range deadOrderIDs {
-			ec.redisUtil.SRem("erp:orders:pending_slots", deadID)
+			ec.redisUtil.SRem(rediskeys.OrdersPendingSlotsKey, deadID)
 		}
 		log.Printf("🧹 GetPendingOrders: удалено %d несуществующих заказов из pending_slots", len(deadOrderIDs))
 	}
@@ -499,50 +614,610 @@ func (ec *ERPController) GetPendingOrders(c *gin.Context) {
 // Удаляет заказ из активных и переносит в архив
 func (ec *ERPController) MarkOrderReady(c *gin.Context) {
 	if ec.redisUtil == nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Redis not available"})
+		respondRedisUnavailable(c)
+		return
+	}
+
+	orderID := c.Param("id")
+	
+	// 1. Проверяем существование заказа в Redis
+	order, err := ec.getOrderFromRedis(orderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	
+	// 2. На KDS повар жмет "Готово" прямо из accepted - проводим заказ через cooking
+	if order.Status == string(models.OrderStatusAccepted) {
+		order.Status = string(models.OrderStatusCooking)
+	}
+	if err := ec.transitionOrderStatus(order, models.OrderStatusReady); err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Недопустимая смена статуса заказа",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"order_id": orderID,
+		"message": "Заказ готов! Удален с планшета и перенесен в архив",
+	})
+}
+
+// UpdateOrderStatus меняет статус заказа с проверкой State Machine
+// PUT /api/v1/erp/orders/:id/status
+// Body: {"status": "cooking"}
+func (ec *ERPController) UpdateOrderStatus(c *gin.Context) {
+	if ec.redisUtil == nil {
+		respondRedisUnavailable(c)
+		return
+	}
+
+	orderID := c.Param("id")
+
+	var req struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	newStatus, ok := models.ParseOrderStatus(req.Status)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid status. Must be: pending, accepted, cooking, ready, completed, or cancelled",
+		})
+		return
+	}
+
+	order, err := ec.getOrderFromRedis(orderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	previousStatus := order.Status
+	if err := ec.transitionOrderStatus(order, newStatus); err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Недопустимая смена статуса заказа",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":         true,
+		"order_id":        orderID,
+		"previous_status": previousStatus,
+		"status":          order.Status,
+	})
+}
+
+// EditOrderItems заменяет позиции заказа (кассир добавил пиццу сразу после оформления)
+// PUT /api/v1/erp/orders/:id/items
+// Body: {"items": [{"pizza_name": "Маргарита", "quantity": 2, "extras": ["Сырный бортик"]}]}
+// Цены пересчитываются по меню, разница суммы атомарно применяется к загрузке слота.
+// Редактирование запрещено, как только заказ начали готовить (cooking и далее)
+func (ec *ERPController) EditOrderItems(c *gin.Context) {
+	if ec.redisUtil == nil {
+		respondRedisUnavailable(c)
+		return
+	}
+
+	orderID := c.Param("id")
+
+	var req struct {
+		Items []models.PizzaItem `json:"items" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+	if len(req.Items) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Заказ должен содержать хотя бы одну позицию"})
+		return
+	}
+	for _, item := range req.Items {
+		if _, exists := models.GetPizza(item.PizzaName); !exists {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Пицца '%s' не найдена в меню", item.PizzaName),
+			})
+			return
+		}
+		if item.Quantity <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Некорректное количество для '%s': %d", item.PizzaName, item.Quantity),
+			})
+			return
+		}
+		if item.DiscountAmount < 0 || item.DiscountPercent < 0 || item.DiscountPercent > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Некорректная скидка на позицию '%s'", item.PizzaName),
+			})
+			return
+		}
+	}
+
+	order, err := ec.getOrderFromRedis(orderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	currentStatus, ok := models.ParseOrderStatus(order.Status)
+	if !ok {
+		currentStatus = models.OrderStatusPending
+	}
+	if currentStatus != models.OrderStatusPending && currentStatus != models.OrderStatusAccepted {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Заказ нельзя изменить: кухня уже начала его готовить",
+			"status": order.Status,
+		})
+		return
+	}
+
+	// Пересчитываем цены: доставка сохраняется, процентная скидка пересчитывается от новой суммы товаров
+	items, itemsPrice := priceOrderItems(req.Items)
+	deliveryFee := order.FinalPrice - order.TotalPrice + order.ItemDiscountTotal() + order.DiscountAmount
+	if deliveryFee < 0 {
+		deliveryFee = 0
+	}
+	discountAmount := order.DiscountAmount
+	if order.DiscountPercent > 0 {
+		discountAmount = 0 // Пересчитается от новой суммы позиций
+	}
+	// Фиксированная скидка на заказ может оказаться больше новой суммы (ORDER_DISCOUNT_POLICY)
+	price, err := models.ValidateOrderPrice(items, deliveryFee, discountAmount, order.DiscountPercent)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректная скидка", "details": err.Error()})
+		return
+	}
+	discountAmount = price.OrderDiscount
+	finalPrice := price.FinalPrice
+	previousFinalPrice := order.FinalPrice
+
+	// Загрузка слота считается по итоговой сумме заказа (как в AssignSlot)
+	slotLoad := 0
+	if order.TargetSlotID != "" && ec.slotService != nil {
+		_, slotLoad, err = ec.slotService.AdjustSlotLoad(order.ID, finalPrice)
+		if errors.Is(err, services.ErrSlotOverflow) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Новая сумма заказа не помещается в слот",
+				"details": err.Error(),
+				"slot_id": order.TargetSlotID,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Ошибка пересчета загрузки слота",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+
+	order.Items = items
+	order.TotalPrice = itemsPrice
+	order.DiscountAmount = discountAmount
+	order.FinalPrice = finalPrice
+
+	orderJSON, _ := json.Marshal(order)
+	if err := ec.redisUtil.SetBytes(rediskeys.OrderKey(order.ID), orderJSON, rediskeys.OrderTTL()); err != nil {
+		// Возвращаем загрузку слота к прежней сумме заказа
+		if order.TargetSlotID != "" && ec.slotService != nil {
+			if _, _, rollbackErr := ec.slotService.AdjustSlotLoad(order.ID, previousFinalPrice); rollbackErr != nil {
+				log.Printf("⚠️ EditOrderItems: не удалось вернуть загрузку слота для заказа %s: %v", order.ID, rollbackErr)
+			}
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка сохранения заказа",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// Состав изменился - перераспределяем заказ по станциям
+	if ec.stationAssignService != nil {
+		if err := ec.stationAssignService.AssignOrderToStations(order); err != nil {
+			log.Printf("⚠️ EditOrderItems: ошибка распределения заказа %s по станциям: %v", order.ID, err)
+		}
+	}
+
+	BroadcastERPUpdateWithRequestID("order_edited", map[string]interface{}{
+		"order_id":    order.ID,
+		"items":       order.Items,
+		"total_price": order.TotalPrice,
+		"final_price": order.FinalPrice,
+		"slot_id":     order.TargetSlotID,
+		"slot_load":   slotLoad,
+	}, GetRequestID(c))
+
+	log.Printf("✏️ Заказ %s изменен: %d₽ -> %d₽ (слот %s, загрузка %d₽)", order.ID, previousFinalPrice, finalPrice, order.TargetSlotID, slotLoad)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"order":          order,
+		"previous_total": previousFinalPrice,
+		"slot_load":      slotLoad,
+	})
+}
+
+// CancelOrder отменяет заказ и откатывает все его последствия
+// POST /api/v1/erp/orders/:id/cancel
+// Возвращает на склад ингредиенты, списанные под заказ (компенсирующие движения sale_reversal),
+// освобождает место в слоте, убирает заказ из активных/отложенных и помечает его cancelled в архиве
+// (PostgreSQL) - в выручку отмененный заказ не попадает
+func (ec *ERPController) CancelOrder(c *gin.Context) {
+	if ec.redisUtil == nil {
+		respondRedisUnavailable(c)
+		return
+	}
+
+	orderID := c.Param("id")
+	order, err := ec.getOrderFromRedis(orderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	result, err := ec.orderCancellation().CancelOrder(order, c.GetString("user_id"))
+	if redisUnavailable(c, err) {
+		return
+	}
+	if errors.Is(err, services.ErrOrderNotCancellable) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Недопустимая смена статуса заказа",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка отмены заказа",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	recordOrderStatus(ec.redisUtil, order.ID, order.Status, "erp")
+	BroadcastERPUpdateWithRequestID("order_cancelled", map[string]interface{}{
+		"order_id": order.ID,
+		"slot_id":  result.SlotID,
+		"message":  "Заказ отменен",
+	}, GetRequestID(c))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"cancellation": result,
+	})
+}
+
+// orderCancellation собирает сервис отмены заказов из подключенных к контроллеру сервисов
+func (ec *ERPController) orderCancellation() *services.OrderCancellationService {
+	return services.NewOrderCancellationService(ec.redisUtil, ec.slotService, ec.stockService, ec.orderService)
+}
+
+// PurgeArchivedOrders разово удаляет заархивированные заказы из PostgreSQL
+// POST /api/v1/erp/orders/purge?before=2024-01-01&dry_run=true
+// before - RFC3339 или YYYY-MM-DD; dry_run=true только возвращает количество заказов к удалению
+// Доступ только для администратора (RequireAdminRole)
+func (ec *ERPController) PurgeArchivedOrders(c *gin.Context) {
+	if ec.orderService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "PostgreSQL not available"})
+		return
+	}
+
+	beforeStr := c.Query("before")
+	if beforeStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Параметр before обязателен (RFC3339 или YYYY-MM-DD)"})
+		return
+	}
+	before, err := timefmt.Parse(beforeStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверный формат before (RFC3339 или YYYY-MM-DD)",
+			"details": err.Error(),
+		})
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+
+	count, err := ec.orderService.PurgeArchivedOrders(before, dryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка удаления заархивированных заказов",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if dryRun {
+		c.JSON(http.StatusOK, gin.H{
+			"dry_run":     true,
+			"before":      before,
+			"would_purge": count,
+		})
+		return
+	}
+
+	log.Printf("🧹 PurgeArchivedOrders: удалено %d заархивированных заказов до %s (user=%s)", count, before.Format(time.RFC3339), c.GetString("user_id"))
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run": false,
+		"before":  before,
+		"purged":  count,
+	})
+}
+
+// RebuildState пересобирает состояние заказов в Redis из PostgreSQL без рестарта сервера
+// POST /api/v1/erp/rebuild-state
+// Повторяет BootstrapState: активные заказы, наборы active/pending_slots, счетчик pending и загрузку их слотов.
+// Доступ только для администратора (RequireAdminRole); параллельный запуск - 409
+func (ec *ERPController) RebuildState(c *gin.Context) {
+	if ec.orderService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "PostgreSQL not available"})
+		return
+	}
+
+	result, err := ec.orderService.RebuildState(ec.slotService)
+	if redisUnavailable(c, err) {
+		return
+	}
+	if errors.Is(err, services.ErrStateRebuildInProgress) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Пересборка состояния уже выполняется",
+			"details": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка пересборки состояния заказов",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	log.Printf("🔄 RebuildState: восстановлено %d заказов (user=%s)", result.OrdersRestored, c.GetString("user_id"))
+	BroadcastERPUpdateWithRequestID("state_rebuilt", map[string]interface{}{
+		"orders_restored": result.OrdersRestored,
+	}, GetRequestID(c))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  result,
+	})
+}
+
+// transitionOrderStatus - единая точка изменения статуса заказа в ERP
+// Проверяет переход по таблице models.CanTransition, сохраняет заказ и выполняет побочные эффекты статуса
+func (ec *ERPController) transitionOrderStatus(order *models.PizzaOrder, newStatus models.OrderStatus) error {
+	if !order.CanTransitionTo(newStatus) {
+		return fmt.Errorf("переход заказа %s из статуса '%s' в '%s' запрещен", order.ID, order.Status, newStatus)
+	}
+
+	order.Status = string(newStatus)
+	orderKey := rediskeys.OrderKey(order.ID)
+	recordOrderStatus(ec.redisUtil, order.ID, order.Status, "erp")
+
+	switch newStatus {
+	case models.OrderStatusReady, models.OrderStatusCompleted:
+		// Заказ приготовлен: резерв ингредиентов списывается со склада
+		ec.commitOrderReservation(order.ID)
+
+		// Убираем заказ с планшета и переносим в архив
+		ec.redisUtil.SRem(rediskeys.OrdersActiveKey, order.ID)
+		ec.redisUtil.RPush(rediskeys.OrdersArchiveKey, order.ID)
+		ec.redisUtil.Increment(rediskeys.OrdersProcessedKey)
+		ec.redisUtil.Decrement(rediskeys.OrdersPendingKey)
+		
+		// Удаляем заказ из Redis после обработки (источник истины - Kafka)
+		ec.redisUtil.Delete(orderKey)
+		ec.redisUtil.Delete(rediskeys.LegacyOrderKey(order.ID))
+		
+		BroadcastERPUpdate("order_processed", map[string]interface{}{
+			"order_id": order.ID,
+			"status":   order.Status,
+			"message":  "Заказ обработан",
+		})
+	case models.OrderStatusCancelled:
+		// Убираем заказ из активных и отложенных, освобождаем место в слоте и снимаем резерв ингредиентов
+		// (списания со склада возвращает только POST /orders/:id/cancel)
+		ec.orderCancellation().ReleaseOrder(order.ID)
+
+		BroadcastERPUpdate("order_cancelled", map[string]interface{}{
+			"order_id": order.ID,
+			"message":  "Заказ отменен",
+		})
+	default:
+		orderJSON, _ := json.Marshal(order)
+		ec.redisUtil.SetBytes(orderKey, orderJSON, rediskeys.OrderTTL())
+		
+		BroadcastERPUpdate("order_status_changed", map[string]interface{}{
+			"order_id": order.ID,
+			"status":   order.Status,
+		})
+	}
+
+	log.Printf("🔁 Заказ %s: статус -> %s", order.ID, order.Status)
+	return nil
+}
+
+// commitOrderReservation списывает со склада резерв ингредиентов приготовленного заказа (см. StockService.ReserveOrder)
+// Заказ без резерва (нет филиала или рецептов, резерв уже списан) пропускается. Ошибка списания статус не откатывает:
+// заказ уже приготовлен, резерв остается действующим и виден на складе
+func (ec *ERPController) commitOrderReservation(orderID string) {
+	if ec.stockService == nil {
+		return
+	}
+	err := ec.stockService.CommitReservation(orderID, "erp")
+	if err != nil && !errors.Is(err, services.ErrReservationNotFound) {
+		log.Printf("⚠️ Резерв заказа %s не списан со склада: %v", orderID, err)
+	}
+}
+
+// MarkOrderProcessed - оставляем для обратной совместимости, но теперь это алиас для MarkOrderReady
+func (ec *ERPController) MarkOrderProcessed(c *gin.Context) {
+	ec.MarkOrderReady(c)
+}
+
+// maxBatchProcessedOrders - ограничение на количество заказов в одном пакетном запросе
+const maxBatchProcessedOrders = 500
+
+// BatchOrderResult - результат обработки одного заказа в пакетном запросе
+type BatchOrderResult struct {
+	OrderID string `json:"order_id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// MarkOrdersProcessedBatch отмечает готовыми сразу несколько заказов (закрытие смены/слота)
+// POST /api/v1/erp/orders/batch-processed
+// Body: {"order_ids": ["..."]} или {"slot_id": "slot:..."} - все активные заказы слота
+// Архивация выполняется одной транзакцией Redis (MULTI/EXEC), в WebSocket уходит одно событие orders_processed_batch
+func (ec *ERPController) MarkOrdersProcessedBatch(c *gin.Context) {
+	if ec.redisUtil == nil {
+		respondRedisUnavailable(c)
+		return
+	}
+
+	var req struct {
+		OrderIDs []string `json:"order_ids"`
+		SlotID   string   `json:"slot_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request body",
+			"details": err.Error(),
+		})
+		return
+	}
+	if len(req.OrderIDs) == 0 && req.SlotID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Нужно указать order_ids или slot_id"})
+		return
+	}
+
+	orderIDs := req.OrderIDs
+	if req.SlotID != "" {
+		slotOrderIDs, err := ec.getActiveOrderIDsBySlot(req.SlotID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Ошибка получения заказов слота",
+				"details": err.Error(),
+			})
+			return
+		}
+		orderIDs = append(orderIDs, slotOrderIDs...)
+	}
+	if len(orderIDs) > maxBatchProcessedOrders {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Слишком много заказов в одном запросе (максимум %d)", maxBatchProcessedOrders),
+		})
 		return
 	}
 
-	orderID := c.Param("id")
-	
-	// 1. Проверяем существование заказа в Redis
-	_, err := ec.getOrderFromRedis(orderID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
-		return
+	// 1. Проверяем каждый заказ: существует ли и можно ли перевести в ready
+	results := make([]BatchOrderResult, 0, len(orderIDs))
+	processed := make([]*models.PizzaOrder, 0, len(orderIDs))
+	seen := make(map[string]bool, len(orderIDs))
+	for _, orderID := range orderIDs {
+		if orderID == "" || seen[orderID] {
+			continue
+		}
+		seen[orderID] = true
+
+		order, err := ec.getOrderFromRedis(orderID)
+		if err != nil {
+			results = append(results, BatchOrderResult{OrderID: orderID, Error: "Order not found"})
+			continue
+		}
+		// Как и в MarkOrderReady: accepted проводим через cooking
+		if order.Status == string(models.OrderStatusAccepted) {
+			order.Status = string(models.OrderStatusCooking)
+		}
+		if !order.CanTransitionTo(models.OrderStatusReady) {
+			results = append(results, BatchOrderResult{
+				OrderID: orderID,
+				Error:   fmt.Sprintf("переход из статуса '%s' в '%s' запрещен", order.Status, models.OrderStatusReady),
+			})
+			continue
+		}
+		order.Status = string(models.OrderStatusReady)
+		processed = append(processed, order)
+		results = append(results, BatchOrderResult{OrderID: orderID, Success: true})
+	}
+
+	// 2. Архивируем все подходящие заказы одной транзакцией
+	if len(processed) > 0 {
+		ctx := ec.redisUtil.Context()
+		_, err := ec.redisUtil.GetClient().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, order := range processed {
+				pipe.SRem(ctx, rediskeys.OrdersActiveKey, order.ID)
+				pipe.RPush(ctx, rediskeys.OrdersArchiveKey, order.ID)
+				pipe.Del(ctx, rediskeys.OrderKey(order.ID), rediskeys.LegacyOrderKey(order.ID))
+			}
+			pipe.IncrBy(ctx, rediskeys.OrdersProcessedKey, int64(len(processed)))
+			pipe.DecrBy(ctx, rediskeys.OrdersPendingKey, int64(len(processed)))
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Ошибка архивации заказов",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		processedIDs := make([]string, 0, len(processed))
+		for _, order := range processed {
+			processedIDs = append(processedIDs, order.ID)
+			recordOrderStatus(ec.redisUtil, order.ID, order.Status, "erp")
+			ec.commitOrderReservation(order.ID)
+		}
+		BroadcastERPUpdateWithRequestID("orders_processed_batch", map[string]interface{}{
+			"order_ids": processedIDs,
+			"count":     len(processedIDs),
+			"slot_id":   req.SlotID,
+			"message":   "Заказы обработаны",
+		}, GetRequestID(c))
 	}
-	
-	// 2. Удаляем заказ из АКТИВНЫХ (убираем с планшета)
-	ec.redisUtil.SRem("erp:orders:active", orderID)
-	
-	// 3. Добавляем заказ в АРХИВ (для истории) - только ID для статистики
-	ec.redisUtil.RPush("erp:orders:archive", orderID)
-	
-	// 4. Обновляем счетчики
-	ec.redisUtil.Increment("erp:orders:processed")
-	ec.redisUtil.Decrement("erp:orders:pending")
-	
-	// 5. Удаляем заказ из Redis после обработки (источник истины - Kafka)
-	orderKey := fmt.Sprintf("erp:order:%s", orderID)
-	ec.redisUtil.Delete(orderKey)
-	ec.redisUtil.Delete(fmt.Sprintf("order:%s", orderID))
-	
-	// 6. Отправляем обновление через WebSocket всем ERP клиентам
-	BroadcastERPUpdate("order_processed", map[string]interface{}{
-		"order_id": orderID,
-		"message": "Заказ обработан",
-	})
+
+	log.Printf("📦 MarkOrdersProcessedBatch: обработано %d из %d заказов (slot_id=%s)", len(processed), len(results), req.SlotID)
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"order_id": orderID,
-		"message": "Заказ готов! Удален с планшета и перенесен в архив",
+		"success":   true,
+		"processed": len(processed),
+		"failed":    len(results) - len(processed),
+		"results":   results,
 	})
 }
 
-// MarkOrderProcessed - оставляем для обратной совместимости, но теперь это алиас для MarkOrderReady
-func (ec *ERPController) MarkOrderProcessed(c *gin.Context) {
-	ec.MarkOrderReady(c)
+// getActiveOrderIDsBySlot возвращает активные заказы, привязанные к слоту
+func (ec *ERPController) getActiveOrderIDsBySlot(slotID string) ([]string, error) {
+	activeOrderIDs, err := ec.redisUtil.SMembers(rediskeys.OrdersActiveKey)
+	if err != nil {
+		return nil, err
+	}
+	orderIDs := make([]string, 0)
+	for _, orderID := range activeOrderIDs {
+		order, err := ec.getOrderFromRedis(orderID)
+		if err != nil {
+			continue
+		}
+		if order.TargetSlotID == slotID {
+			orderIDs = append(orderIDs, orderID)
+		}
+	}
+	return orderIDs, nil
 }
 
 // checkAndActivatePendingOrders проверяет ожидающие заказы и добавляет их в активные, когда наступает VisibleAt
@@ -552,13 +1227,13 @@ func (ec *ERPController) checkAndActivatePendingOrders() {
 	}
 
 	// Получаем список ожидающих заказов
-	pendingOrderIDs, err := ec.redisUtil.SMembers("erp:orders:pending_slots")
+	pendingOrderIDs, err := ec.redisUtil.SMembers(rediskeys.OrdersPendingSlotsKey)
 	if err != nil {
 		return
 	}
 
 	// Получаем количество активных заказов для статистики
-	activeCount, _ := ec.redisUtil.SCard("erp:orders:active")
+	activeCount, _ := ec.redisUtil.SCard(rediskeys.OrdersActiveKey)
 	
 	now := time.Now().UTC()
 	activatedCount := 0
@@ -570,51 +1245,39 @@ func (ec *ERPController) checkAndActivatePendingOrders() {
 	}
 
 	for _, orderID := range pendingOrderIDs {
-		// Получаем VisibleAt из Redis (приоритет) или вычисляем из времени начала слота
-		visibleAtKey := fmt.Sprintf("order:visible_at:%s", orderID)
+		// VisibleAt сохраняется при создании заказа (AssignSlot учитывает prep_lead_minutes филиала)
+		visibleAtKey := rediskeys.OrderVisibleAtKey(orderID)
 		visibleAtStr, err := ec.redisUtil.Get(visibleAtKey)
 		
 		var visibleAt time.Time
 		if err == nil && visibleAtStr != "" {
-			// Используем сохраненное VisibleAt
 			visibleAt, err = time.Parse(time.RFC3339, visibleAtStr)
 			if err != nil {
 				continue
 			}
-		} else {
-			// Fallback: вычисляем из времени начала слота (для старых заказов)
-			slotStartKey := fmt.Sprintf("order:slot:start:%s", orderID)
-			slotStartStr, err := ec.redisUtil.Get(slotStartKey)
-			if err != nil || slotStartStr == "" {
-				continue
-			}
-			
-			slotStartTime, err := time.Parse(time.RFC3339, slotStartStr)
-			if err != nil {
-				continue
-			}
-			
-			// Для старых заказов используем фиксированные 15 минут
-			visibleAt = slotStartTime.Add(-15 * time.Minute)
+		} else if order, err := ec.getOrderFromRedis(orderID); err == nil {
+			// Ключ order:visible_at истек - берем VisibleAt из самого заказа
+			// Нулевой VisibleAt означает, что заказ активируется сразу
+			visibleAt = order.VisibleAt
 		}
 
 		// Если время показа наступило, добавляем заказ в активные
 		if !now.Before(visibleAt) {
 			// Проверяем, существует ли заказ в Redis перед активацией
-			orderKey := fmt.Sprintf("erp:order:%s", orderID)
+			orderKey := rediskeys.OrderKey(orderID)
 			exists, _ := ec.redisUtil.Exists(orderKey)
 			if !exists {
 				// Заказ не существует в Redis - удаляем из pending_slots
-				ec.redisUtil.SRem("erp:orders:pending_slots", orderID)
+				ec.redisUtil.SRem(rediskeys.OrdersPendingSlotsKey, orderID)
 				log.Printf("🧹 checkAndActivatePendingOrders: удален несуществующий заказ %s из pending_slots", orderID)
 				continue
 			}
 			
 			// Проверяем, не активирован ли уже заказ (защита от повторной активации при параллельных запросах)
-			isActive, _ := ec.redisUtil.SIsMember("erp:orders:active", orderID)
+			isActive, _ := ec.redisUtil.SIsMember(rediskeys.OrdersActiveKey, orderID)
 			if isActive {
 				// Заказ уже активирован другим запросом, просто удаляем из pending
-				ec.redisUtil.SRem("erp:orders:pending_slots", orderID)
+				ec.redisUtil.SRem(rediskeys.OrdersPendingSlotsKey, orderID)
 				continue
 			}
 			
@@ -622,23 +1285,24 @@ func (ec *ERPController) checkAndActivatePendingOrders() {
 			order, err := ec.getOrderFromRedis(orderID)
 			if err == nil {
 				// Обновляем статус заказа на "accepted" (принят)
-				if order.Status == "pending" {
-					order.Status = "accepted"
+				if order.Status == string(models.OrderStatusPending) {
+					order.Status = string(models.OrderStatusAccepted)
 					// Сохраняем обновленный заказ обратно в Redis
 					orderJSON, _ := json.Marshal(order)
-					orderKey := fmt.Sprintf("erp:order:%s", orderID)
-					ec.redisUtil.SetBytes(orderKey, orderJSON, 24*time.Hour)
+					orderKey := rediskeys.OrderKey(orderID)
+					ec.redisUtil.SetBytes(orderKey, orderJSON, rediskeys.OrderTTL())
+					recordOrderStatus(ec.redisUtil, orderID, order.Status, "kds_activation")
 					log.Printf("✅ Заказ %s: статус обновлен с 'pending' на 'accepted'", orderID)
 				}
 			}
 			
 			// Добавляем в активные
-			ec.redisUtil.SAdd("erp:orders:active", orderID)
+			ec.redisUtil.SAdd(rediskeys.OrdersActiveKey, orderID)
 			// Уменьшаем счетчик ожидающих (не увеличиваем!)
-			ec.redisUtil.Decrement("erp:orders:pending")
+			ec.redisUtil.Decrement(rediskeys.OrdersPendingKey)
 			
 			// Удаляем из ожидающих
-			ec.redisUtil.SRem("erp:orders:pending_slots", orderID)
+			ec.redisUtil.SRem(rediskeys.OrdersPendingSlotsKey, orderID)
 			
 			activatedCount++
 			
@@ -658,7 +1322,7 @@ func (ec *ERPController) checkAndActivatePendingOrders() {
 
 // getOrderFromRedis читает заказ из Redis с поддержкой Protobuf и JSON
 func (ec *ERPController) getOrderFromRedis(orderID string) (*models.PizzaOrder, error) {
-	orderKey := "erp:order:" + orderID
+	orderKey := rediskeys.OrderKey(orderID)
 	orderBytes, err := ec.redisUtil.GetBytes(orderKey)
 	if err != nil {
 		return nil, err
@@ -678,6 +1342,8 @@ func (ec *ERPController) getOrderFromRedis(orderID string) (*models.PizzaOrder,
 			DeliveryAddress:   pbOrder.DeliveryAddress,
 			IsPickup:          pbOrder.IsPickup,
 			PickupLocationID:  pbOrder.PickupLocationId,
+			Channel:           pbOrder.Channel,
+			PrepSeconds:       int(pbOrder.PrepSeconds),
 			TotalPrice:        int(pbOrder.TotalPrice),
 			CreatedAt:         time.Unix(0, pbOrder.CreatedAt),
 			Status:            pbOrder.Status,
@@ -716,6 +1382,8 @@ func (ec *ERPController) getOrderFromRedis(orderID string) (*models.PizzaOrder,
 				Price:       int(pbItem.Price),
 				PizzaPrice:  pizzaPrice,
 				ExtrasPrice: extrasPrice,
+				DiscountAmount:  int(pbItem.DiscountAmount),
+				DiscountPercent: int(pbItem.DiscountPercent),
 			})
 		}
 		
@@ -729,7 +1397,7 @@ func (ec *ERPController) getOrderFromRedis(orderID string) (*models.PizzaOrder,
 		// Если есть TargetSlotID, но нет времени начала слота, получаем его из Redis или SlotService
 		if order.TargetSlotID != "" && order.TargetSlotStartTime.IsZero() {
 			// Сначала пробуем получить из Redis (быстрее)
-			slotStartKey := fmt.Sprintf("order:slot:start:%s", orderID)
+			slotStartKey := rediskeys.OrderSlotStartKey(orderID)
 			if slotStartStr, err := ec.redisUtil.Get(slotStartKey); err == nil && slotStartStr != "" {
 				if slotStartTime, err := time.Parse(time.RFC3339, slotStartStr); err == nil {
 					order.TargetSlotStartTime = slotStartTime
@@ -743,16 +1411,13 @@ func (ec *ERPController) getOrderFromRedis(orderID string) (*models.PizzaOrder,
 			}
 		}
 		
-		// Если нет VisibleAt, получаем его из Redis или вычисляем
+		// Если нет VisibleAt, получаем его из Redis (сохраняется при создании заказа)
 		if order.VisibleAt.IsZero() {
-			visibleAtKey := fmt.Sprintf("order:visible_at:%s", orderID)
+			visibleAtKey := rediskeys.OrderVisibleAtKey(orderID)
 			if visibleAtStr, err := ec.redisUtil.Get(visibleAtKey); err == nil && visibleAtStr != "" {
 				if visibleAt, err := time.Parse(time.RFC3339, visibleAtStr); err == nil {
 					order.VisibleAt = visibleAt
 				}
-			} else if !order.TargetSlotStartTime.IsZero() {
-				// Fallback: вычисляем из времени начала слота (для старых заказов)
-				order.VisibleAt = order.TargetSlotStartTime.Add(-15 * time.Minute)
 			}
 		}
 		
@@ -760,6 +1425,7 @@ func (ec *ERPController) getOrderFromRedis(orderID string) (*models.PizzaOrder,
 		if order.FinalPrice == 0 {
 			order.FinalPrice = order.TotalPrice
 		}
+		order.RefreshDueAt()
 		
 		return order, nil
 	}
@@ -797,7 +1463,7 @@ func (ec *ERPController) getOrderFromRedis(orderID string) (*models.PizzaOrder,
 	// Если есть TargetSlotID, но нет времени начала слота, получаем его из Redis или SlotService
 	if order.TargetSlotID != "" && order.TargetSlotStartTime.IsZero() {
 		// Сначала пробуем получить из Redis (быстрее)
-		slotStartKey := fmt.Sprintf("order:slot:start:%s", orderID)
+		slotStartKey := rediskeys.OrderSlotStartKey(orderID)
 		if slotStartStr, err := ec.redisUtil.Get(slotStartKey); err == nil && slotStartStr != "" {
 			if slotStartTime, err := time.Parse(time.RFC3339, slotStartStr); err == nil {
 				order.TargetSlotStartTime = slotStartTime
@@ -811,18 +1477,16 @@ func (ec *ERPController) getOrderFromRedis(orderID string) (*models.PizzaOrder,
 		}
 	}
 	
-	// Если нет VisibleAt, получаем его из Redis или вычисляем
+	// Если нет VisibleAt, получаем его из Redis (сохраняется при создании заказа)
 	if order.VisibleAt.IsZero() {
-		visibleAtKey := fmt.Sprintf("order:visible_at:%s", orderID)
+		visibleAtKey := rediskeys.OrderVisibleAtKey(orderID)
 		if visibleAtStr, err := ec.redisUtil.Get(visibleAtKey); err == nil && visibleAtStr != "" {
 			if visibleAt, err := time.Parse(time.RFC3339, visibleAtStr); err == nil {
 				order.VisibleAt = visibleAt
 			}
-		} else if !order.TargetSlotStartTime.IsZero() {
-			// Fallback: вычисляем из времени начала слота (для старых заказов)
-			order.VisibleAt = order.TargetSlotStartTime.Add(-15 * time.Minute)
 		}
 	}
+	order.RefreshDueAt()
 	
 	return &order, nil
 }
@@ -851,7 +1515,7 @@ func (ec *ERPController) GetKafkaOrdersCount(c *gin.Context) {
 	defer conn.Close()
 
 	// Получаем метаданные топика для подсчета сообщений
-	partitions, err := conn.ReadPartitions("pizza-orders")
+	partitions, err := conn.ReadPartitions(ec.kafkaTopic)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("Failed to read partitions: %v", err),
@@ -863,7 +1527,7 @@ func (ec *ERPController) GetKafkaOrdersCount(c *gin.Context) {
 	var totalKafkaOrders int64
 	for _, p := range partitions {
 		// Используем DialLeader вместо DialPartition
-		partitionConn, err := kafka.DialLeader(context.Background(), "tcp", brokerAddr, "pizza-orders", p.ID)
+		partitionConn, err := kafka.DialLeader(context.Background(), "tcp", brokerAddr, ec.kafkaTopic, p.ID)
 		if err != nil {
 			log.Printf("⚠️ Ошибка подключения к партиции %d: %v", p.ID, err)
 			continue
@@ -883,10 +1547,46 @@ func (ec *ERPController) GetKafkaOrdersCount(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"topic":        "pizza-orders",
+		"topic":        ec.kafkaTopic,
 		"total_orders": totalKafkaOrders,
 		"partitions":   len(partitions),
-		"timestamp":    time.Now().Format(time.RFC3339),
+		"timestamp":    timefmt.Format(time.Now()),
+	})
+}
+
+// GetKafkaLag возвращает текущее отставание consumer group от топика заказов по партициям
+// GET /api/v1/erp/kafka-lag
+// Отставание считается заново при каждом запросе; если брокер недоступен - отдается последний результат watchdog
+func (ec *ERPController) GetKafkaLag(c *gin.Context) {
+	if ec.kafkaLagWatchdog == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Kafka not configured",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), kafkaLagCheckTimeout)
+	defer cancel()
+	report, err := ec.kafkaLagWatchdog.Check(ctx)
+	if err != nil {
+		if last := ec.kafkaLagWatchdog.LastReport(); last != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"report":  last,
+				"stale":   true,
+				"details": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "Не удалось получить отставание Kafka",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"report": report,
+		"stale":  false,
 	})
 }
 
@@ -917,7 +1617,7 @@ func (ec *ERPController) GetKafkaOrdersSample(c *gin.Context) {
 	defer conn.Close()
 
 	// Используем DialLeader вместо DialPartition (более надежный способ)
-	partitionConn, err := kafka.DialLeader(context.Background(), "tcp", brokerAddr, "pizza-orders", 0)
+	partitionConn, err := kafka.DialLeader(context.Background(), "tcp", brokerAddr, ec.kafkaTopic, 0)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": fmt.Sprintf("Failed to connect to partition: %v", err),
@@ -945,7 +1645,7 @@ func (ec *ERPController) GetKafkaOrdersSample(c *gin.Context) {
 
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:   brokers,
-		Topic:     "pizza-orders",
+		Topic:     ec.kafkaTopic,
 		Partition: 0,
 		MinBytes:  1,
 		MaxBytes:  10e6,
@@ -972,7 +1672,7 @@ func (ec *ERPController) GetKafkaOrdersSample(c *gin.Context) {
 				"display_id":  pbOrder.DisplayId,
 				"customer_id": pbOrder.CustomerId,
 				"status":      pbOrder.Status,
-				"created_at":  time.Unix(0, pbOrder.CreatedAt).Format(time.RFC3339),
+				"created_at":  timefmt.Format(time.Unix(0, pbOrder.CreatedAt)),
 				"size_bytes":  len(msg.Value),
 			}
 			
@@ -995,7 +1695,7 @@ func (ec *ERPController) GetKafkaOrdersSample(c *gin.Context) {
 		"orders":      orders,
 		"count":       len(orders),
 		"total_in_kafka": lastOffset,
-		"topic":       "pizza-orders",
+		"topic":       ec.kafkaTopic,
 		"format":      "protobuf",
 	})
 }
@@ -1011,6 +1711,9 @@ func (ec *ERPController) GetSlots(c *gin.Context) {
 
 	slots, err := ec.slotService.GetAllSlots()
 	if err != nil {
+		if redisUnavailable(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
@@ -1102,8 +1805,8 @@ func (ec *ERPController) GetSlots(c *gin.Context) {
 		
 		slotResponses[i] = SlotResponse{
 			SlotID:        slot.SlotID,
-			StartTime:     slot.StartTime.Format(time.RFC3339),
-			EndTime:       slot.EndTime.Format(time.RFC3339),
+			StartTime:     timefmt.Format(slot.StartTime),
+			EndTime:       timefmt.Format(slot.EndTime),
 			CurrentLoad:   slot.CurrentLoad,
 			MaxCapacity:   slot.MaxCapacity,
 			OrdersCount:   slot.OrdersCount,
@@ -1167,7 +1870,81 @@ func (ec *ERPController) GetSlots(c *gin.Context) {
 	})
 }
 
+// GetSlotAnalytics возвращает загрузку слотов (load/capacity) и число отказов из-за заполненности за день
+// GET /api/v1/erp/slots/analytics?date=2024-01-15&branch_id=xxx (date - UTC, по умолчанию сегодня)
+func (ec *ERPController) GetSlotAnalytics(c *gin.Context) {
+	if ec.slotService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "SlotService not available",
+		})
+		return
+	}
+
+	date := time.Now().UTC()
+	if dateStr := c.Query("date"); dateStr != "" {
+		parsed, err := timefmt.Parse(dateStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Неверный формат даты (ожидается " + timefmt.Accepted + ")",
+				"details": err.Error(),
+			})
+			return
+		}
+		date = parsed
+	}
+
+	analytics, err := ec.slotService.GetSlotAnalytics(date, c.Query("branch_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка расчета аналитики слотов",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, analytics)
+}
+
+// GetShiftSummary возвращает итоги смены кухни: выполненные заказы, среднее время, самый загруженный слот,
+// позиции по станциям и израсходованное сырье со стоимостью
+// GET /api/v1/erp/shift-summary?branch_id=xxx&date=2006-01-02 (date по умолчанию - сегодня в часовом поясе филиала)
+func (ec *ERPController) GetShiftSummary(c *gin.Context) {
+	branchID := c.Query("branch_id")
+	if branchID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "branch_id обязателен",
+		})
+		return
+	}
+	date := c.Query("date")
+	if _, err := timefmt.Parse(date); date != "" && err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверный формат даты (ожидается " + timefmt.Accepted + ")",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	summary, err := ec.shiftSummaryService.GetShiftSummary(branchID, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка формирования итогов смены",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
 // GetSlotConfig получает текущую конфигурацию слотов (максимальная емкость)
+//
+// @Summary      Конфигурация слотов
+// @Tags         slots
+// @Produce      json
+// @Success      200  {object}  SlotConfigResponse
+// @Failure      503  {object}  ErrorResponse
+// @Router       /erp/slots/config [get]
 func (ec *ERPController) GetSlotConfig(c *gin.Context) {
 	if ec.slotService == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
@@ -1184,20 +1961,38 @@ func (ec *ERPController) GetSlotConfig(c *gin.Context) {
 	slotInfo, err := ec.slotService.GetSlotInfo(slotID)
 	if err != nil {
 			// Если слот не существует, используем дефолтное значение из SlotService
-		c.JSON(http.StatusOK, gin.H{
+		defaults := gin.H{
 				"max_capacity": 10000, // Дефолт (устанавливается через UpdateSlotConfig)
+			"overbooking_percent": ec.slotService.GetOverbookingPercent(),
 			"slot_duration_minutes": 15,
-		})
+		}
+		if errors.Is(err, services.ErrRedisUnavailable) {
+			respondDegraded(c, defaults)
+			return
+		}
+		c.JSON(http.StatusOK, defaults)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"max_capacity": slotInfo.MaxCapacity,
+		"effective_capacity": slotInfo.EffectiveCapacity,
+		"overbooking_percent": slotInfo.OverbookingPercent,
 		"slot_duration_minutes": 15,
 	})
 }
 
-// UpdateSlotConfig обновляет максимальную емкость слотов
+// UpdateSlotConfig обновляет максимальную емкость слотов и процент овербукинга
+//
+// @Summary      Изменить емкость слотов
+// @Tags         slots
+// @Accept       json
+// @Produce      json
+// @Param        request  body      UpdateSlotConfigRequest  true  "Новая емкость"
+// @Success      200      {object}  UpdateSlotConfigResponse
+// @Failure      400      {object}  ErrorResponse
+// @Failure      503      {object}  ErrorResponse
+// @Router       /erp/slots/config [put]
 func (ec *ERPController) UpdateSlotConfig(c *gin.Context) {
 	if ec.slotService == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
@@ -1206,9 +2001,7 @@ func (ec *ERPController) UpdateSlotConfig(c *gin.Context) {
 		return
 	}
 
-	var req struct {
-		MaxCapacity int `json:"max_capacity" binding:"required"`
-	}
+	var req UpdateSlotConfigRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -1218,24 +2011,40 @@ func (ec *ERPController) UpdateSlotConfig(c *gin.Context) {
 		return
 	}
 
-	if req.MaxCapacity <= 0 {
+	// max_capacity можно не передавать, если меняется только овербукинг
+	if req.MaxCapacity < 0 || (req.MaxCapacity == 0 && req.OverbookingPercent == nil) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "max_capacity must be greater than 0",
 		})
 		return
 	}
+	if req.OverbookingPercent != nil && (*req.OverbookingPercent < 0 || *req.OverbookingPercent > 100) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "overbooking_percent must be between 0 and 100",
+		})
+		return
+	}
 
-	ec.slotService.SetMaxCapacity(req.MaxCapacity)
+	if req.MaxCapacity > 0 {
+		ec.slotService.SetMaxCapacity(req.MaxCapacity)
+	}
+	if req.OverbookingPercent != nil {
+		ec.slotService.SetOverbookingPercent(*req.OverbookingPercent)
+	}
+	maxCapacity := ec.slotService.GetMaxCapacity()
+	overbookingPercent := ec.slotService.GetOverbookingPercent()
 
 	// Отправляем обновление через WebSocket
 	BroadcastERPUpdate("slot_config_updated", map[string]interface{}{
-		"max_capacity": req.MaxCapacity,
+		"max_capacity": maxCapacity,
+		"overbooking_percent": overbookingPercent,
 		"message": "Конфигурация слотов обновлена",
 	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"max_capacity": req.MaxCapacity,
+		"max_capacity": maxCapacity,
+		"overbooking_percent": overbookingPercent,
 		"message": "Slot capacity updated successfully",
 	})
 }
@@ -1265,6 +2074,9 @@ func (ec *ERPController) ToggleSlot(c *gin.Context) {
 	
 	err := ec.slotService.SetSlotDisabled(slotID, req.Disabled)
 	if err != nil {
+		if redisUnavailable(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
@@ -1472,6 +2284,9 @@ func (ec *ERPController) UpdateSlotDisabled(c *gin.Context) {
 	// Используем = вместо :=, так как err уже объявлена выше
 	err = ec.slotService.SetSlotDisabled(slotID, disabledValue)
 	if err != nil {
+		if redisUnavailable(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
@@ -1517,7 +2332,11 @@ func (ec *ERPController) UpdateSlotCapacity(c *gin.Context) {
 	}
 	
 	// Сохраняем лимит слота в Redis
-	key := fmt.Sprintf("slot:%s:max_capacity", slotID)
+	if ec.redisUtil == nil {
+		respondRedisUnavailable(c)
+		return
+	}
+	key := rediskeys.SlotMaxCapacityKey(slotID)
 	
 	if err := ec.redisUtil.Set(key, fmt.Sprintf("%d", req.MaxCapacity), 0); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -1541,8 +2360,123 @@ func (ec *ERPController) UpdateSlotCapacity(c *gin.Context) {
 	})
 }
 
+// RescheduleSlot переносит заказы слота на более поздние слоты, когда кухня не успевает
+// POST /api/v1/erp/slots/:slot_id/reschedule
+// Body: {"offset_minutes": 15, "branch_id": "..."} - каждый заказ бронирует место в слоте не раньше начала исходного + offset
+// Переносятся только заказы, которые кухня еще не начала готовить (pending/accepted).
+// Заказы, для которых не нашлось места, остаются в исходном слоте и возвращаются в failed
+func (ec *ERPController) RescheduleSlot(c *gin.Context) {
+	slotID := c.Param("slot_id")
+
+	var req struct {
+		OffsetMinutes int    `json:"offset_minutes" binding:"required"`
+		BranchID      string `json:"branch_id"` // Филиал для расчета времени показа заказа (prep_lead_minutes)
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid request",
+			"details": err.Error(),
+		})
+		return
+	}
+	if req.OffsetMinutes <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "offset_minutes must be greater than 0",
+		})
+		return
+	}
+
+	if ec.slotService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "SlotService not available",
+		})
+		return
+	}
+	if ec.redisUtil == nil {
+		respondRedisUnavailable(c)
+		return
+	}
+
+	orderIDs, err := ec.slotService.GetSlotOrderIDs(slotID)
+	if err != nil {
+		if redisUnavailable(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка загрузки заказов слота",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// Раньше созданные заказы первыми занимают ближайшие слоты
+	orders := make([]*models.PizzaOrder, 0, len(orderIDs))
+	skipped := make([]gin.H, 0)
+	for _, orderID := range orderIDs {
+		order, err := ec.getOrderFromRedis(orderID)
+		if err != nil {
+			skipped = append(skipped, gin.H{"order_id": orderID, "reason": "заказ не найден"})
+			continue
+		}
+		status, ok := models.ParseOrderStatus(order.Status)
+		if ok && status != models.OrderStatusPending && status != models.OrderStatusAccepted {
+			skipped = append(skipped, gin.H{"order_id": orderID, "reason": "кухня уже готовит заказ", "status": order.Status})
+			continue
+		}
+		orders = append(orders, order)
+	}
+	sort.SliceStable(orders, func(i, j int) bool {
+		return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+	})
+
+	offset := time.Duration(req.OffsetMinutes) * time.Minute
+	moved := make([]*services.SlotMove, 0, len(orders))
+	failed := make([]gin.H, 0)
+	for _, order := range orders {
+		move, err := ec.slotService.MoveOrderToLaterSlot(order.ID, offset, req.BranchID)
+		if err != nil {
+			log.Printf("⚠️ RescheduleSlot: заказ %s не перенесен из слота %s: %v", order.ID, slotID, err)
+			failed = append(failed, gin.H{"order_id": order.ID, "reason": err.Error()})
+			continue
+		}
+
+		order.TargetSlotID = move.ToSlotID
+		order.TargetSlotStartTime = move.SlotStart
+		order.VisibleAt = move.VisibleAt
+		order.RefreshDueAt()
+		orderJSON, _ := json.Marshal(order)
+		if err := ec.redisUtil.SetBytes(rediskeys.OrderKey(order.ID), orderJSON, rediskeys.OrderTTL()); err != nil {
+			log.Printf("⚠️ RescheduleSlot: заказ %s перенесен в слот %s, но не сохранен: %v", order.ID, move.ToSlotID, err)
+		}
+		ec.redisUtil.Set(rediskeys.OrderSlotStartKey(order.ID), move.SlotStart.Format(time.RFC3339), rediskeys.OrderTTL())
+		ec.redisUtil.Set(rediskeys.OrderVisibleAtKey(order.ID), move.VisibleAt.Format(time.RFC3339), rediskeys.OrderTTL())
+
+		moved = append(moved, move)
+	}
+
+	BroadcastERPUpdateWithRequestID("slot_rescheduled", map[string]interface{}{
+		"slot_id":        slotID,
+		"offset_minutes": req.OffsetMinutes,
+		"moved":          moved,
+		"failed":         failed,
+	}, GetRequestID(c))
+
+	log.Printf("⏩ Слот %s перенесен на %d мин: перенесено %d, не поместилось %d, пропущено %d",
+		slotID, req.OffsetMinutes, len(moved), len(failed), len(skipped))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":        len(failed) == 0,
+		"slot_id":        slotID,
+		"offset_minutes": req.OffsetMinutes,
+		"moved":          moved,
+		"failed":         failed,
+		"skipped":        skipped,
+	})
+}
+
 // GetRevenue получает выручку за указанную дату или за сегодня
-// GET /api/v1/erp/revenue?date=2006-01-02 (опционально)
+// GET /api/v1/erp/revenue?date=2006-01-02&branch_id=... (оба опционально)
+// branch_id задает часовой пояс, в котором считаются границы дня
 func (ec *ERPController) GetRevenue(c *gin.Context) {
 	if ec.revenueService == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
@@ -1552,8 +2486,11 @@ func (ec *ERPController) GetRevenue(c *gin.Context) {
 	}
 
 	date := c.DefaultQuery("date", "")
-	revenue, err := ec.revenueService.GetRevenueForDate(date)
+	revenue, err := ec.revenueService.GetRevenueForBranchDate(c.Query("branch_id"), date)
 	if err != nil {
+		if redisUnavailable(c, err) {
+			return
+		}
 		log.Printf("❌ GetRevenue: ошибка получения выручки: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Ошибка получения выручки",
@@ -1566,7 +2503,7 @@ func (ec *ERPController) GetRevenue(c *gin.Context) {
 }
 
 // GetDailyPlan получает план на день
-// GET /api/v1/erp/daily-plan?date=2006-01-02 (опционально)
+// GET /api/v1/erp/daily-plan?date=2006-01-02&branch_id=... (оба опционально, branch_id - часовой пояс "сегодня")
 func (ec *ERPController) GetDailyPlan(c *gin.Context) {
 	if ec.dailyPlanService == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
@@ -1576,7 +2513,7 @@ func (ec *ERPController) GetDailyPlan(c *gin.Context) {
 	}
 
 	date := c.DefaultQuery("date", "")
-	plan, err := ec.dailyPlanService.GetDailyPlan(date)
+	plan, err := ec.dailyPlanService.GetDailyPlanForBranch(c.Query("branch_id"), date)
 	if err != nil {
 		log.Printf("❌ GetDailyPlan: ошибка получения плана: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -1594,7 +2531,7 @@ func (ec *ERPController) GetDailyPlan(c *gin.Context) {
 
 // SetDailyPlan устанавливает план на день
 // PUT /api/v1/erp/daily-plan
-// Body: {"date": "2006-01-02", "plan": 500000.0}
+// Body: {"date": "2006-01-02", "plan": 500000.0, "branch_id": "..."} (branch_id - часовой пояс "сегодня")
 func (ec *ERPController) SetDailyPlan(c *gin.Context) {
 	if ec.dailyPlanService == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
@@ -1604,8 +2541,9 @@ func (ec *ERPController) SetDailyPlan(c *gin.Context) {
 	}
 
 	var req struct {
-		Date string  `json:"date"` // Опционально, по умолчанию сегодня
-		Plan float64 `json:"plan" binding:"required"`
+		Date     string  `json:"date"` // Опционально, по умолчанию сегодня
+		Plan     float64 `json:"plan" binding:"required"`
+		BranchID string  `json:"branch_id"` // Опционально, часовой пояс филиала для "сегодня"
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -1623,8 +2561,11 @@ func (ec *ERPController) SetDailyPlan(c *gin.Context) {
 		return
 	}
 
-	err := ec.dailyPlanService.SetDailyPlan(req.Date, req.Plan)
+	err := ec.dailyPlanService.SetDailyPlanForBranch(req.BranchID, req.Date, req.Plan)
 	if err != nil {
+		if redisUnavailable(c, err) {
+			return
+		}
 		log.Printf("❌ SetDailyPlan: ошибка установки плана: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Ошибка установки плана",
@@ -1641,6 +2582,76 @@ func (ec *ERPController) SetDailyPlan(c *gin.Context) {
 	})
 }
 
+// GetWeekdayPlans возвращает планы по умолчанию для дней недели
+// GET /api/v1/erp/weekday-plans
+// weekday: 0 - воскресенье ... 6 - суббота; используется, если на дату нет явного плана
+func (ec *ERPController) GetWeekdayPlans(c *gin.Context) {
+	if ec.dailyPlanService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Daily plan service not available",
+		})
+		return
+	}
+
+	plans, err := ec.dailyPlanService.GetWeekdayPlans()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка получения планов по дням недели",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"plans": plans,
+	})
+}
+
+// SetWeekdayPlans устанавливает планы по умолчанию для дней недели
+// PUT /api/v1/erp/weekday-plans
+// Body: {"plans": [{"weekday": 5, "plan": 700000.0}, {"weekday": 1, "plan": 350000.0}]} (не переданные дни не меняются)
+func (ec *ERPController) SetWeekdayPlans(c *gin.Context) {
+	if ec.dailyPlanService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Daily plan service not available",
+		})
+		return
+	}
+
+	var req struct {
+		Plans []models.WeekdayPlan `json:"plans" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid request",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := ec.dailyPlanService.SetWeekdayPlans(req.Plans); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Ошибка установки планов по дням недели",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	plans, err := ec.dailyPlanService.GetWeekdayPlans()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка получения планов по дням недели",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"plans":   plans,
+	})
+}
+
 // GetKitchenLoad получает загрузку кухни
 // GET /api/v1/erp/kitchen-load?window=next (window: current, next, shift)
 func (ec *ERPController) GetKitchenLoad(c *gin.Context) {
@@ -1667,6 +2678,9 @@ func (ec *ERPController) GetKitchenLoad(c *gin.Context) {
 
 	loadStats, err := ec.kitchenLoadService.GetKitchenLoad(window)
 	if err != nil {
+		if redisUnavailable(c, err) {
+			return
+		}
 		log.Printf("❌ GetKitchenLoad: ошибка получения загрузки кухни: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Ошибка получения загрузки кухни",
@@ -1690,6 +2704,9 @@ func (ec *ERPController) GetRevenueForecast(c *gin.Context) {
 
 	forecast, err := ec.revenueService.GetRevenueForecast()
 	if err != nil {
+		if redisUnavailable(c, err) {
+			return
+		}
 		log.Printf("❌ GetRevenueForecast: ошибка получения прогноза: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Ошибка получения прогноза выручки",
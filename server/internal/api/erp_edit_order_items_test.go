@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils"
+	"zephyrvpn/server/internal/utils/rediskeys"
+)
+
+// useTestMenu подменяет меню на время теста: Маргарита 500₽, Пепперони 600₽, Сырный бортик 100₽
+func useTestMenu(t *testing.T) {
+	t.Helper()
+	pizzas, extras := models.GetAllPizzas(), models.GetAllExtras()
+	models.SetPizzas(map[string]models.Pizza{
+		"Маргарита": {Name: "Маргарита", Price: 500},
+		"Пепперони": {Name: "Пепперони", Price: 600},
+	})
+	models.SetExtras(map[string]models.Extra{"Сырный бортик": {Name: "Сырный бортик", Price: 100}})
+	t.Cleanup(func() {
+		models.SetPizzas(pizzas)
+		models.SetExtras(extras)
+	})
+}
+
+// editItemsRouter - маршрут редактирования позиций заказа
+func editItemsRouter(redisUtil *utils.RedisClient) (*gin.Engine, *ERPController) {
+	gin.SetMode(gin.TestMode)
+	ec := NewERPController(redisUtil, "", "", nil, 0, 0, 23, 59)
+	router := gin.New()
+	router.PUT("/orders/:id/items", ec.EditOrderItems)
+	return router, ec
+}
+
+func TestEditOrderItemsValidatesRequest(t *testing.T) {
+	useTestMenu(t)
+	router, _ := editItemsRouter(newUnreachableRedis(t))
+
+	for _, body := range []string{
+		`{}`,
+		`{"items": []}`,
+		`{"items": [{"pizza_name": "Гавайская", "quantity": 1}]}`,
+		`{"items": [{"pizza_name": "Маргарита", "quantity": 0}]}`,
+	} {
+		code, payload := degradedResponse(t, router, http.MethodPut, "/orders/order-1/items", body)
+		if code != http.StatusBadRequest {
+			t.Errorf("тело %s: код %d (%v), want 400", body, code, payload["error"])
+		}
+	}
+}
+
+func TestEditOrderItems(t *testing.T) {
+	useTestMenu(t)
+	redisUtil := newTestRedis(t)
+	router, ec := editItemsRouter(redisUtil)
+	client, ctx := redisUtil.GetClient(), redisUtil.Context()
+
+	// Заказ в слоте: 2 Маргариты (1000₽) + доставка 200₽ - скидка 10% (100₽) = 1100₽
+	const slotID = "1893456000"
+	saveOrder := func(order models.PizzaOrder) {
+		t.Helper()
+		data, err := json.Marshal(order)
+		if err != nil {
+			t.Fatalf("json.Marshal: %v", err)
+		}
+		if err := redisUtil.SetBytes(rediskeys.OrderKey(order.ID), data, time.Hour); err != nil {
+			t.Fatalf("SetBytes: %v", err)
+		}
+	}
+	saveOrder(models.PizzaOrder{
+		ID:              "order-accepted",
+		Status:          string(models.OrderStatusAccepted),
+		Items:           []models.PizzaItem{{PizzaName: "Маргарита", Quantity: 2, Price: 500}},
+		TotalPrice:      1000,
+		DiscountPercent: 10,
+		DiscountAmount:  100,
+		FinalPrice:      1100,
+		TargetSlotID:    slotID,
+	})
+	// В слоте еще один заказ на 300₽
+	if err := client.HSet(ctx, rediskeys.OrderSlotKey("order-accepted"), "slot_id", slotID, "price", 1100).Err(); err != nil {
+		t.Fatalf("HSet: %v", err)
+	}
+	if err := client.Set(ctx, rediskeys.SlotKey(slotID), 1400, time.Hour).Err(); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	ec.SlotService().SetMaxCapacity(2000)
+
+	storedOrder := func(orderID string) *models.PizzaOrder {
+		t.Helper()
+		order, err := ec.getOrderFromRedis(orderID)
+		if err != nil {
+			t.Fatalf("getOrderFromRedis(%s): %v", orderID, err)
+		}
+		return order
+	}
+	slotLoad := func() int {
+		t.Helper()
+		load, err := client.Get(ctx, rediskeys.SlotKey(slotID)).Int()
+		if err != nil {
+			t.Fatalf("не удалось прочитать загрузку слота: %v", err)
+		}
+		return load
+	}
+
+	// 2 Пепперони с бортиком (1400₽) + доставка 200₽ - 10% (140₽) = 1460₽
+	body := `{"items": [{"pizza_name": "Пепперони", "quantity": 2, "extras": ["Сырный бортик"]}]}`
+	code, payload := degradedResponse(t, router, http.MethodPut, "/orders/order-accepted/items", body)
+	if code != http.StatusOK {
+		t.Fatalf("код %d (%v), want 200", code, payload)
+	}
+	if payload["previous_total"] != float64(1100) || payload["slot_load"] != float64(1760) {
+		t.Errorf("previous_total %v, slot_load %v; want 1100, 1760", payload["previous_total"], payload["slot_load"])
+	}
+	order := storedOrder("order-accepted")
+	if order.TotalPrice != 1400 || order.DiscountAmount != 140 || order.FinalPrice != 1460 || order.Items[0].Price != 700 {
+		t.Errorf("заказ после изменения: товары %d₽, скидка %d₽, итог %d₽, цена позиции %d₽; want 1400, 140, 1460, 700",
+			order.TotalPrice, order.DiscountAmount, order.FinalPrice, order.Items[0].Price)
+	}
+	if load := slotLoad(); load != 1760 {
+		t.Errorf("загрузка слота %d₽, want 1760₽", load)
+	}
+
+	// 3 Пепперони с бортиком: 2100 + 200 - 210 = 2090₽, слот переполнится - заказ и загрузка не меняются
+	body = `{"items": [{"pizza_name": "Пепперони", "quantity": 3, "extras": ["Сырный бортик"]}]}`
+	if code, payload := degradedResponse(t, router, http.MethodPut, "/orders/order-accepted/items", body); code != http.StatusConflict {
+		t.Fatalf("переполнение слота: код %d (%v), want 409", code, payload)
+	}
+	if order := storedOrder("order-accepted"); order.FinalPrice != 1460 || slotLoad() != 1760 {
+		t.Errorf("после отказа: итог %d₽, загрузка %d₽; want 1460, 1760", order.FinalPrice, slotLoad())
+	}
+
+	// Заказ уже готовится - изменение запрещено
+	saveOrder(models.PizzaOrder{
+		ID:         "order-cooking",
+		Status:     string(models.OrderStatusCooking),
+		Items:      []models.PizzaItem{{PizzaName: "Маргарита", Quantity: 1, Price: 500}},
+		TotalPrice: 500,
+		FinalPrice: 500,
+	})
+	body = `{"items": [{"pizza_name": "Маргарита", "quantity": 2}]}`
+	if code, payload := degradedResponse(t, router, http.MethodPut, "/orders/order-cooking/items", body); code != http.StatusConflict {
+		t.Errorf("заказ в готовке: код %d (%v), want 409", code, payload)
+	}
+	if order := storedOrder("order-cooking"); order.FinalPrice != 500 {
+		t.Errorf("заказ в готовке изменен: итог %d₽, want 500", order.FinalPrice)
+	}
+
+	if code, _ := degradedResponse(t, router, http.MethodPut, "/orders/order-missing/items", body); code != http.StatusNotFound {
+		t.Errorf("несуществующий заказ: код %d, want 404", code)
+	}
+}
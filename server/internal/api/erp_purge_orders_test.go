@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/services"
+	"zephyrvpn/server/internal/utils"
+)
+
+// purgeRouter - маршрут удаления архива заказов, как в main.go
+func purgeRouter(redisUtil *utils.RedisClient, orderService *services.OrderService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	ec := NewERPController(redisUtil, "", "", nil, 0, 0, 23, 59)
+	if orderService != nil {
+		ec.SetOrderService(orderService)
+	}
+	router := gin.New()
+	router.POST("/orders/purge", RequireAdminRole(redisUtil), ec.PurgeArchivedOrders)
+	return router
+}
+
+func TestPurgeArchivedOrdersValidatesBefore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ec := NewERPController(nil, "", "", nil, 0, 0, 23, 59)
+	router := gin.New()
+	router.POST("/orders/purge", ec.PurgeArchivedOrders)
+
+	// Без PostgreSQL удалять нечего
+	if code := serve(router, http.MethodPost, "/orders/purge?before=2024-01-01").Code; code != http.StatusServiceUnavailable {
+		t.Errorf("без сервиса заказов = %d, want 503", code)
+	}
+
+	// Сервис без подключения к БД: корректная дата доходит до сервиса и падает там (500)
+	ec.SetOrderService(services.NewOrderService(nil, nil))
+	cases := []struct {
+		url  string
+		want int
+	}{
+		{"/orders/purge", http.StatusBadRequest},
+		{"/orders/purge?before=yesterday", http.StatusBadRequest},
+		{"/orders/purge?before=01.01.2024", http.StatusBadRequest},
+		{"/orders/purge?before=2024-01-01", http.StatusInternalServerError},
+		{"/orders/purge?before=2024-01-01T00:00:00Z&dry_run=true", http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		if code := serve(router, http.MethodPost, tc.url).Code; code != tc.want {
+			t.Errorf("POST %s = %d, want %d", tc.url, code, tc.want)
+		}
+	}
+}
+
+func TestPurgeArchivedOrdersRequiresAdmin(t *testing.T) {
+	redisUtil := newTestRedis(t)
+	// Сервис заказов не подключен: прошедший проверку запрос получает 503 от обработчика
+	router := purgeRouter(redisUtil, nil)
+
+	sessions := map[string]models.UserRole{"token-admin": models.RoleAdmin, "token-courier": models.RoleCourier}
+	for token, role := range sessions {
+		staffID := "staff-" + token
+		if err := redisUtil.Set("erp:kds:token:"+token, staffID, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if err := redisUtil.Set("erp:staff:"+staffID+":session", map[string]string{"role": string(role)}, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := redisUtil.Set(superAdminTokenKey("token-super"), "admin-1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		token string
+		want  int
+	}{
+		{"", http.StatusUnauthorized},
+		{"token-unknown", http.StatusUnauthorized},
+		{"token-courier", http.StatusForbidden},
+		{"token-admin", http.StatusServiceUnavailable},
+		{"token-super", http.StatusServiceUnavailable},
+	}
+	for _, tc := range cases {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/orders/purge?before=2024-01-01&dry_run=true", nil)
+		if tc.token != "" {
+			request.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		router.ServeHTTP(recorder, request)
+		if recorder.Code != tc.want {
+			t.Errorf("токен %q: код %d, want %d", tc.token, recorder.Code, tc.want)
+		}
+	}
+}
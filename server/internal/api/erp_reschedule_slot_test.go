@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRescheduleSlotValidatesRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ec := NewERPController(nil, "", "", nil, 0, 0, 23, 59)
+	router := gin.New()
+	router.POST("/slots/:slot_id/reschedule", ec.RescheduleSlot)
+
+	cases := []struct {
+		body string
+		want int
+	}{
+		{`{}`, http.StatusBadRequest},
+		{`{"offset_minutes": -15}`, http.StatusBadRequest},
+		{`{"offset_minutes": "15"}`, http.StatusBadRequest},
+		{`{"offset_minutes": 15}`, http.StatusServiceUnavailable}, // Без Redis
+	}
+	for _, tc := range cases {
+		code, payload := degradedResponse(t, router, http.MethodPost, "/slots/slot:1900000000/reschedule", tc.body)
+		if code != tc.want {
+			t.Errorf("тело %s: код %d, want %d (%v)", tc.body, code, tc.want, payload)
+		}
+		if code == http.StatusServiceUnavailable && payload["degraded"] != true {
+			t.Errorf("тело %s: ответ без Redis %v, want degraded: true", tc.body, payload)
+		}
+	}
+}
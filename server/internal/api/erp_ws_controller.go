@@ -7,9 +7,11 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"zephyrvpn/server/internal/models"
 )
 
 // ServeERPWS обрабатывает WebSocket подключения от ERP системы
+// Подключение только по WS-тикету: маршрут оборачивается в WSTicketController.RequireTicket
 func ServeERPWS(c *gin.Context) {
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -18,7 +20,7 @@ func ServeERPWS(c *gin.Context) {
 	}
 
 	// Добавляем клиента в ERP хаб
-	ERPHub.AddClient(conn)
+	ERPHub.AddClient(conn, wsRoleFromContext(c))
 	log.Printf("🖥️ ERP клиент подключен. Всего ERP подключений: %d", ERPHub.GetClientsCount())
 
 	// Обрабатываем отключение клиента
@@ -41,18 +43,81 @@ func ServeERPWS(c *gin.Context) {
 
 // BroadcastERPUpdate отправляет обновление заказов всем подключенным ERP клиентам
 func BroadcastERPUpdate(messageType string, data interface{}) {
-	update := map[string]interface{}{
-		"type": messageType,
-		"data": data,
-		"timestamp": time.Now().Unix(),
+	BroadcastERPUpdateWithRequestID(messageType, data, "")
+}
+
+// BroadcastERPUpdateWithRequestID отправляет обновление с ID запроса, который его вызвал
+// request_id позволяет связать событие на планшете с HTTP запросом и сообщением Kafka в логах
+func BroadcastERPUpdateWithRequestID(messageType string, data interface{}, requestID string) {
+	timestamp := time.Now().Unix()
+	marshal := func(payload interface{}) []byte {
+		update := map[string]interface{}{
+			"type": messageType,
+			"data": payload,
+			"timestamp": timestamp,
+		}
+		if requestID != "" {
+			update["request_id"] = requestID
+		}
+		jsonData, err := json.Marshal(update)
+		if err != nil {
+			log.Printf("⚠️ Ошибка маршалинга ERP обновления: %v", err)
+			return nil
+		}
+		return jsonData
 	}
 	
-	jsonData, err := json.Marshal(update)
-	if err != nil {
-		log.Printf("⚠️ Ошибка маршалинга ERP обновления: %v", err)
+	// Данные с заказами фильтруем по роли каждого соединения (как в GetOrders)
+	if containsOrder(data) {
+		ERPHub.BroadcastByRole(func(role string) []byte {
+			return marshal(filterBroadcastData(data, role))
+		})
 		return
 	}
 	
-	ERPHub.BroadcastMessage(jsonData)
+	if jsonData := marshal(data); jsonData != nil {
+		ERPHub.BroadcastMessage(jsonData)
+	}
+}
+
+// containsOrder проверяет, есть ли в данных события заказ (сам заказ или поле map)
+func containsOrder(data interface{}) bool {
+	switch v := data.(type) {
+	case models.PizzaOrder, *models.PizzaOrder, []models.PizzaOrder:
+		return true
+	case map[string]interface{}:
+		for _, value := range v {
+			if containsOrder(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// filterBroadcastData убирает из заказов в данных события поля, недоступные роли
+func filterBroadcastData(data interface{}, role string) interface{} {
+	switch v := data.(type) {
+	case models.PizzaOrder:
+		return filterOrderByRole(v, role)
+	case *models.PizzaOrder:
+		if v == nil {
+			return v
+		}
+		return filterOrderByRole(*v, role)
+	case []models.PizzaOrder:
+		filtered := make([]models.PizzaOrder, len(v))
+		for i, order := range v {
+			filtered[i] = filterOrderByRole(order, role)
+		}
+		return filtered
+	case map[string]interface{}:
+		filtered := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			filtered[key] = filterBroadcastData(value, role)
+		}
+		return filtered
+	}
+	return data
 }
 
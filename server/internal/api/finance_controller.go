@@ -1,13 +1,19 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"zephyrvpn/server/internal/models"
 	"zephyrvpn/server/internal/services"
+	"zephyrvpn/server/internal/utils/timefmt"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // FinanceController управляет API endpoints для финансовых транзакций
@@ -23,13 +29,17 @@ func NewFinanceController(service *services.FinanceService) *FinanceController {
 }
 
 // GetTransactions получает список финансовых транзакций
-// GET /api/v1/finance/transactions?branch_id=xxx&source=bank|cash&entity_ids=...
+// GET /api/v1/finance/transactions?branch_id=xxx&source=bank|cash&entity_ids=...&from=2026-01-01&to=2026-01-31
 func (fc *FinanceController) GetTransactions(c *gin.Context) {
 	branchID := c.Query("branch_id")
 	source := c.Query("source")
 	entityIDs := c.Query("entity_ids")
+	from, to, ok := transactionPeriod(c, false)
+	if !ok {
+		return
+	}
 
-	transactions, err := fc.service.GetTransactions(branchID, source, entityIDs)
+	transactions, err := fc.service.GetTransactions(branchID, source, entityIDs, from, to)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Ошибка получения транзакций",
@@ -44,6 +54,72 @@ func (fc *FinanceController) GetTransactions(c *gin.Context) {
 	})
 }
 
+// ExportTransactions выгружает транзакции за период файлом: format=1c - для загрузки в 1С, format=csv - обычный CSV
+// GET /api/v1/finance/transactions/export?from=2026-01-01&to=2026-01-31&format=1c&branch_id=xxx&source=bank|cash
+// Дата to включается целиком
+func (fc *FinanceController) ExportTransactions(c *gin.Context) {
+	from, to, ok := transactionPeriod(c, true)
+	if !ok {
+		return
+	}
+	format := c.DefaultQuery("format", services.ExportFormat1C)
+
+	export, err := fc.service.ExportTransactions(c.Query("branch_id"), c.Query("source"), from, to, format)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidExportFormat) || errors.Is(err, services.ErrInvalidExportPeriod) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"error":   "Ошибка выгрузки транзакций",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("transactions_%s_%s_%s.%s", format, c.Query("from"), c.Query("to"), export.Extension)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("X-Export-Rows", strconv.Itoa(export.Rows))
+	c.Data(http.StatusOK, export.ContentType, export.Data)
+}
+
+// transactionPeriod разбирает from/to запроса: дата to без времени включается целиком (см. timefmt.RangeEnd)
+// required - оба параметра обязательны. При ошибке отвечает клиенту сам и возвращает false
+func transactionPeriod(c *gin.Context, required bool) (time.Time, time.Time, bool) {
+	var from, to time.Time
+	fromStr, toStr := c.Query("from"), c.Query("to")
+	if required && (fromStr == "" || toStr == "") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Параметры from и to обязательны (" + timefmt.Accepted + ")",
+		})
+		return from, to, false
+	}
+
+	if fromStr != "" {
+		parsed, err := timefmt.ParseInLocation(fromStr, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Неверный формат даты from, ожидается " + timefmt.Accepted,
+				"details": err.Error(),
+			})
+			return from, to, false
+		}
+		from = parsed
+	}
+	if toStr != "" {
+		parsed, err := timefmt.RangeEnd(toStr, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Неверный формат даты to, ожидается " + timefmt.Accepted,
+				"details": err.Error(),
+			})
+			return from, to, false
+		}
+		to = parsed
+	}
+	return from, to, true
+}
+
 // GetTransaction получает транзакцию по ID
 // GET /api/v1/finance/transactions/:id
 func (fc *FinanceController) GetTransaction(c *gin.Context) {
@@ -113,3 +189,151 @@ func (fc *FinanceController) GetCounterpartiesWithBalances(c *gin.Context) {
 	})
 }
 
+
+// GetCashFlow возвращает движение денег по дням: приход (выручка), расход и остаток нарастающим итогом
+// GET /api/v1/finance/cashflow?branch_id=xxx&from=2026-01-01&to=2026-01-31&cash_only=true
+// По умолчанию - последние 30 дней, все потоки (наличные и безнал)
+func (fc *FinanceController) GetCashFlow(c *gin.Context) {
+	branchID := c.Query("branch_id")
+	cashOnly := c.Query("cash_only") == "true"
+
+	to := time.Now()
+	if toStr := c.Query("to"); toStr != "" {
+		parsed, err := timefmt.ParseInLocation(toStr, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Неверный формат даты to, ожидается " + timefmt.Accepted,
+				"details": err.Error(),
+			})
+			return
+		}
+		to = parsed
+	}
+
+	from := to.AddDate(0, 0, -29)
+	if fromStr := c.Query("from"); fromStr != "" {
+		parsed, err := timefmt.ParseInLocation(fromStr, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Неверный формат даты from, ожидается " + timefmt.Accepted,
+				"details": err.Error(),
+			})
+			return
+		}
+		from = parsed
+	}
+
+	days, err := fc.service.GetCashFlow(branchID, from, to, cashOnly)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Ошибка построения отчета о движении денег",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var totalIn, totalOut float64
+	for _, day := range days {
+		totalIn += day.TotalIn
+		totalOut += day.TotalOut
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"days":      days,
+		"count":     len(days),
+		"cash_only": cashOnly,
+		"from":      timefmt.FormatDate(from),
+		"to":        timefmt.FormatDate(to),
+		"total_in":  totalIn,
+		"total_out": totalOut,
+		"net":       totalIn - totalOut,
+	})
+}
+
+// GetBankOperations возвращает банковские операции (безналичные расходы по накладным и т.п.)
+// GET /api/v1/finance/bank-operations?status=pending|paid|cancelled&branch_id=xxx
+func (fc *FinanceController) GetBankOperations(c *gin.Context) {
+	operations, err := fc.service.GetBankOperations(c.Query("status"), c.Query("branch_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Ошибка получения банковских операций",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var totalAmount float64
+	for _, operation := range operations {
+		totalAmount += operation.Amount
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"operations":   operations,
+		"count":        len(operations),
+		"total_amount": totalAmount,
+	})
+}
+
+// ConfirmBankOperation отмечает ожидающую банковскую операцию оплаченной (по выписке банка)
+// и уменьшает официальный долг контрагента на сумму операции
+// POST /api/v1/finance/bank-operations/:id/confirm
+// Body: {"paid_at": "2026-01-31", "performed_by": "..."} - paid_at по умолчанию сегодня
+func (fc *FinanceController) ConfirmBankOperation(c *gin.Context) {
+	id := c.Param("id")
+
+	var request struct {
+		PaidAt      string `json:"paid_at"`
+		PerformedBy string `json:"performed_by"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Неверные параметры запроса",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+	if request.PerformedBy == "" {
+		request.PerformedBy = "system"
+	}
+
+	paidAt := time.Now()
+	if request.PaidAt != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", request.PaidAt, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Неверный формат даты paid_at, ожидается YYYY-MM-DD",
+				"details": err.Error(),
+			})
+			return
+		}
+		paidAt = parsed
+	}
+
+	operation, err := fc.service.ConfirmBankOperation(id, paidAt, request.PerformedBy)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Банковская операция не найдена",
+			})
+		case errors.Is(err, services.ErrBankOperationNotPending):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Операция не ожидает оплаты",
+				"details": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Ошибка подтверждения банковской операции",
+				"details": err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Банковская операция отмечена оплаченной",
+		"operation": operation,
+	})
+}
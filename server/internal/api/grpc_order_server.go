@@ -11,12 +11,17 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"gorm.io/gorm"
 	"google.golang.org/protobuf/proto"
 	"zephyrvpn/server/internal/models"
 	"zephyrvpn/server/internal/pb" // Наш сгенерированный код
 	"zephyrvpn/server/internal/services"
 	"zephyrvpn/server/internal/utils"
+	"zephyrvpn/server/internal/utils/rediskeys"
 )
 
 type OrderGRPCServer struct {
@@ -28,7 +33,7 @@ type OrderGRPCServer struct {
 	kafkaSentCount int64 // Счетчик отправленных сообщений
 }
 
-func NewOrderGRPCServer(redisUtil *utils.RedisClient, kafkaBrokers string, db interface{}, openHour, openMin, closeHour, closeMin int, username, password, caCert string, orderService *services.OrderService) *OrderGRPCServer {
+func NewOrderGRPCServer(redisUtil *utils.RedisClient, kafkaBrokers, kafkaTopic string, db interface{}, openHour, openMin, closeHour, closeMin int, username, password, caCert string, orderService *services.OrderService) *OrderGRPCServer {
 	var kafkaWriter *kafka.Writer
 	if kafkaBrokers != "" {
 		// Создаем dialer с SASL/PLAIN и TLS если нужно
@@ -36,9 +41,12 @@ func NewOrderGRPCServer(redisUtil *utils.RedisClient, kafkaBrokers string, db in
 		
 		// Создаем Kafka writer для отправки Protobuf сообщений
 		brokers := ParseKafkaBrokers(kafkaBrokers)
+		if kafkaTopic == "" {
+			kafkaTopic = DefaultKafkaOrdersTopic
+		}
 		kafkaWriter = &kafka.Writer{
 			Addr:     kafka.TCP(brokers...),
-			Topic:    "pizza-orders", // Топик для заказов (бинарный Protobuf)
+			Topic:    kafkaTopic, // Топик для заказов (бинарный Protobuf)
 			Balancer: &kafka.LeastBytes{}, // Балансировка по наименьшему количеству байт
 			Async:    true, // Асинхронная отправка для максимальной скорости
 			Transport: &kafka.Transport{
@@ -47,7 +55,7 @@ func NewOrderGRPCServer(redisUtil *utils.RedisClient, kafkaBrokers string, db in
 				Dial: dialer.DialFunc,
 			},
 		}
-		log.Printf("✅ Kafka producer подключен к %s", kafkaBrokers)
+		log.Printf("✅ Kafka producer подключен к %s (topic=%s)", kafkaBrokers, kafkaTopic)
 	} else {
 		log.Println("⚠️ Kafka producer НЕ создан: KAFKA_BROKERS не установлен")
 	}
@@ -59,7 +67,7 @@ func NewOrderGRPCServer(redisUtil *utils.RedisClient, kafkaBrokers string, db in
 			gormDB = gdb
 		}
 	}
-	slotService := services.NewSlotService(redisUtil, gormDB, openHour, openMin, closeHour, closeMin)
+	slotService := services.NewSlotService(redisUtil, gormDB, openHour, openMin, closeHour, closeMin, services.RealClock{})
 	
 	return &OrderGRPCServer{
 		redisUtil:   redisUtil,
@@ -78,6 +86,10 @@ func (s *OrderGRPCServer) Close() error {
 }
 
 func (s *OrderGRPCServer) CreateOrder(ctx context.Context, req *pb.PizzaOrderRequest) (*pb.OrderResponse, error) {
+	// ID запроса из metadata клиента - передается дальше в заголовке Kafka сообщения
+	requestID := requestIDFromGRPC(ctx)
+	grpc.SetHeader(ctx, metadata.Pairs(utils.RequestIDHeader, requestID))
+
 	// 1. Конвертируем gRPC запрос в Protobuf заказ (БЕЗ JSON Marshal - это ключевая оптимизация!)
 	fullID := uuid.New().String()
 	// Извлекаем только цифры из UUID и берем последние 4
@@ -202,18 +214,24 @@ func (s *OrderGRPCServer) CreateOrder(ctx context.Context, req *pb.PizzaOrderReq
 	
 	// Итоговая цена: товары + доставка - скидка (для gRPC доставка = 0)
 	finalPrice := totalPriceInt32 - discountAmount
+	if err := models.CheckFinalPrice(int(finalPrice)); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 
 	// 🎯 Capacity-Based Slot Scheduling: назначаем слот ПЕРЕД созданием заказа
 	// Считаем общее количество элементов (пицц) в заказе
 	itemsCount := 0
+	prepSeconds := 0 // Оценка времени приготовления для KDS (как models.EstimatePrepSeconds)
 	for _, item := range pbItems {
 		itemsCount += int(item.Quantity)
+		prepSeconds += models.PizzaPrepSeconds(item.PizzaName) * int(item.Quantity)
 	}
 	
-	slotID, slotStartTime, visibleAt, err := s.slotService.AssignSlot(fullID, int(finalPrice), itemsCount)
+	// В gRPC запросе нет branch_id - используется время подготовки по умолчанию
+	slotID, slotStartTime, visibleAt, err := s.slotService.AssignSlot(fullID, int(finalPrice), itemsCount, "")
 	if err != nil {
 		// Если не удалось назначить слот, возвращаем ошибку
-		log.Printf("❌ OrderGRPCServer: не удалось назначить слот для заказа %s: %v", fullID, err)
+		log.Printf("❌ [req=%s] OrderGRPCServer: не удалось назначить слот для заказа %s: %v", requestID, fullID, err)
 		return nil, fmt.Errorf("не удалось назначить временной слот для заказа: %w", err)
 	}
 
@@ -239,6 +257,8 @@ func (s *OrderGRPCServer) CreateOrder(ctx context.Context, req *pb.PizzaOrderReq
 		DeliveryAddress:  req.DeliveryAddress,
 		IsPickup:         req.IsPickup,
 		PickupLocationId: req.PickupLocationId,
+		Channel:          orderChannelFromGRPC(ctx),
+		PrepSeconds:      int32(prepSeconds),
 	}
 
 	// 2. Сериализуем в Protobuf (быстрее JSON в 2-3 раза!)
@@ -254,14 +274,16 @@ func (s *OrderGRPCServer) CreateOrder(ctx context.Context, req *pb.PizzaOrderReq
 	
 	// Накидываем команды в пачку (они еще не ушли в сеть!)
 	// Используем SetBytes для бинарных данных Protobuf
-	pipe.Set(redisCtx, fmt.Sprintf("erp:order:%s", fullID), orderBytes, 24*time.Hour)
+	pipe.Set(redisCtx, rediskeys.OrderKey(fullID), orderBytes, rediskeys.OrderTTL())
 	// Сохраняем время начала слота отдельно (для фильтрации заказов по времени)
 	if !slotStartTime.IsZero() {
-		pipe.Set(redisCtx, fmt.Sprintf("order:slot:start:%s", fullID), slotStartTime.Format(time.RFC3339), 24*time.Hour)
+		pipe.Set(redisCtx, rediskeys.OrderSlotStartKey(fullID), slotStartTime.Format(time.RFC3339), rediskeys.OrderTTL())
 	}
+	pipe.RPush(redisCtx, orderStatusHistoryKey(fullID), orderStatusEntry("pending", "grpc"))
+	pipe.Expire(redisCtx, orderStatusHistoryKey(fullID), orderStatusHistoryTTL)
 	pipe.LPush(redisCtx, "kitchen:orders:queue", fullID)
 	pipe.Incr(redisCtx, "orders:total")
-	pipe.Incr(redisCtx, "erp:orders:pending")
+	pipe.Incr(redisCtx, rediskeys.OrdersPendingKey)
 	
 	// Отправляем ВСЁ ОДНИМ выстрелом (экономия сетевых вызовов!)
 	_, err = pipe.Exec(redisCtx)
@@ -273,14 +295,14 @@ func (s *OrderGRPCServer) CreateOrder(ctx context.Context, req *pb.PizzaOrderReq
 	// Сохраняем заказ в отдельный список ожидающих заказов
 	if !visibleAt.IsZero() {
 		// Сохраняем время начала слота и время показа для проверки
-		s.redisUtil.Set(fmt.Sprintf("order:slot:start:%s", fullID), slotStartTime.Format(time.RFC3339), 24*time.Hour)
-		s.redisUtil.Set(fmt.Sprintf("order:visible_at:%s", fullID), visibleAt.Format(time.RFC3339), 24*time.Hour)
+		s.redisUtil.Set(rediskeys.OrderSlotStartKey(fullID), slotStartTime.Format(time.RFC3339), rediskeys.OrderTTL())
+		s.redisUtil.Set(rediskeys.OrderVisibleAtKey(fullID), visibleAt.Format(time.RFC3339), rediskeys.OrderTTL())
 		
 		// Добавляем в список ожидающих заказов (не в активные!)
-		s.redisUtil.SAdd("erp:orders:pending_slots", fullID)
+		s.redisUtil.SAdd(rediskeys.OrdersPendingSlotsKey, fullID)
 		
-		log.Printf("📅 Заказ %s назначен на слот %s (время начала: %s UTC, будет показан: %s UTC)", 
-			fullID, slotID, slotStartTime.Format("15:04:05"), visibleAt.Format("15:04:05"))
+		log.Printf("📅 [req=%s] Заказ %s назначен на слот %s (время начала: %s UTC, будет показан: %s UTC)", 
+			requestID, fullID, slotID, slotStartTime.Format("15:04:05"), visibleAt.Format("15:04:05"))
 	}
 
 	// 4. Сохраняем заказ в PostgreSQL (асинхронно, не блокируем ответ!)
@@ -298,12 +320,15 @@ func (s *OrderGRPCServer) CreateOrder(ctx context.Context, req *pb.PizzaOrderReq
 				PaymentMethod:     "", // Можно добавить в protobuf
 				IsPickup:          pbOrder.IsPickup,
 				PickupLocationID:  pbOrder.PickupLocationId,
+				Channel:           pbOrder.Channel,
 				TotalPrice:        int(pbOrder.TotalPrice),
 				Status:            pbOrder.Status,
 				CreatedAt:         now,
 				TargetSlotID:       pbOrder.TargetSlotId,
 				VisibleAt:         visibleAt,
+				PrepSeconds:       int(pbOrder.PrepSeconds),
 			}
+			order.RefreshDueAt()
 			
 			// Конвертируем pbItems в PizzaItem
 			for _, pbItem := range pbOrder.Items {
@@ -313,6 +338,8 @@ func (s *OrderGRPCServer) CreateOrder(ctx context.Context, req *pb.PizzaOrderReq
 					Price:       int(pbItem.Price),
 					Ingredients: pbItem.Ingredients,
 					Extras:      pbItem.Extras,
+					DiscountAmount:  int(pbItem.DiscountAmount),
+					DiscountPercent: int(pbItem.DiscountPercent),
 				}
 				// Конвертируем ingredient_amounts
 				if pbItem.IngredientAmounts != nil {
@@ -342,21 +369,22 @@ func (s *OrderGRPCServer) CreateOrder(ctx context.Context, req *pb.PizzaOrderReq
 			
 			// Отправляем бинарные Protobuf данные в Kafka
 			err := s.kafkaWriter.WriteMessages(bgCtx, kafka.Message{
-				Key:   []byte(fullID), // Ключ = ID заказа
-				Value: orderBytes,     // Бинарный Protobuf (БЕЗ JSON!)
+				Key:     []byte(fullID),                    // Ключ = ID заказа
+				Value:   orderBytes,                        // Бинарный Protobuf (БЕЗ JSON!)
+				Headers: kafkaRequestIDHeaders(requestID), // X-Request-ID для трассировки в consumer
 			})
 			if err != nil {
 				// Игнорируем ошибку "Unknown Topic Or Partition" - топик создастся автоматически
 				errStr := err.Error()
 				if !strings.Contains(errStr, "Unknown Topic Or Partition") && 
 				   !strings.Contains(errStr, "context canceled") {
-					log.Printf("⚠️ Kafka error при отправке заказа %s: %v", fullID, err)
+					log.Printf("⚠️ [req=%s] Kafka error при отправке заказа %s: %v", requestID, fullID, err)
 				}
 			} else {
 				// Логируем успешную отправку (только первые 10 для проверки)
 				atomic.AddInt64(&s.kafkaSentCount, 1)
 				if atomic.LoadInt64(&s.kafkaSentCount) <= 10 {
-					log.Printf("✅ Kafka: отправлен заказ %s (%d байт Protobuf)", fullID, len(orderBytes))
+					log.Printf("✅ [req=%s] Kafka: отправлен заказ %s (%d байт Protobuf)", requestID, fullID, len(orderBytes))
 				}
 			}
 		}()
@@ -369,3 +397,13 @@ func (s *OrderGRPCServer) CreateOrder(ctx context.Context, req *pb.PizzaOrderReq
 		Status:    "accepted_via_grpc",
 	}, nil
 }
+
+// orderChannelFromGRPC берет канал заказа из metadata x-order-channel (клиент gRPC сам сообщает, откуда заказ)
+func orderChannelFromGRPC(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(models.OrderChannelHeader); len(values) > 0 {
+			return models.NormalizeOrderChannel(values[0], models.OrderChannelUnknown)
+		}
+	}
+	return models.OrderChannelUnknown
+}
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Порог отставания и период проверки по умолчанию (KAFKA_LAG_ALERT_THRESHOLD, KAFKA_LAG_CHECK_INTERVAL_SECONDS)
+const (
+	DefaultKafkaLagAlertThreshold = 100
+	DefaultKafkaLagCheckInterval  = 30 * time.Second
+)
+
+// kafkaLagCheckTimeout - сколько ждем ответа брокера при одной проверке
+const kafkaLagCheckTimeout = 10 * time.Second
+
+// KafkaOffsetReader читает смещения топика заказов: high-water mark партиций и закоммиченные offset группы
+type KafkaOffsetReader interface {
+	// HighWaterMarks возвращает offset следующего сообщения в каждой партиции топика
+	HighWaterMarks(ctx context.Context, topic string) (map[int]int64, error)
+	// CommittedOffsets возвращает закоммиченные offset группы по партициям (-1 - группа еще ничего не коммитила)
+	CommittedOffsets(ctx context.Context, groupID, topic string, partitions []int) (map[int]int64, error)
+}
+
+// KafkaPartitionLag - отставание consumer group в одной партиции
+type KafkaPartitionLag struct {
+	Partition     int   `json:"partition"`
+	HighWaterMark int64 `json:"high_water_mark"`
+	Committed     int64 `json:"committed"` // -1 - offset еще не коммитился
+	Lag           int64 `json:"lag"`
+}
+
+// KafkaLagReport - результат проверки отставания обработки заказов
+type KafkaLagReport struct {
+	Topic      string              `json:"topic"`
+	GroupID    string              `json:"group_id"`
+	TotalLag   int64               `json:"total_lag"`
+	Threshold  int64               `json:"threshold"`
+	Alert      bool                `json:"alert"` // Отставание больше порога
+	Partitions []KafkaPartitionLag `json:"partitions"`
+	CheckedAt  time.Time           `json:"checked_at"`
+}
+
+// KafkaLagWatchdog периодически сравнивает high-water mark топика заказов с закоммиченными offset
+// consumer group KafkaWSConsumer и поднимает тревогу, когда заказы доходят до KDS с опозданием
+type KafkaLagWatchdog struct {
+	reader    KafkaOffsetReader
+	topic     string
+	groupID   string
+	threshold int64
+	interval  time.Duration
+	alert     func(report KafkaLagReport) // Тревога (по умолчанию - лог и событие kafka_lag_alert в ERP WebSocket)
+	recovered func(report KafkaLagReport) // Отставание вернулось в норму
+
+	mu       sync.Mutex
+	last     *KafkaLagReport
+	alerting bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewKafkaLagWatchdog создает watchdog отставания. Пустые topic и groupID - значения по умолчанию,
+// threshold <= 0 и interval <= 0 - DefaultKafkaLagAlertThreshold и DefaultKafkaLagCheckInterval
+func NewKafkaLagWatchdog(reader KafkaOffsetReader, topic, groupID string, threshold int64, interval time.Duration) *KafkaLagWatchdog {
+	if topic == "" {
+		topic = DefaultKafkaOrdersTopic
+	}
+	if groupID == "" {
+		groupID = DefaultKafkaConsumerGroup
+	}
+	if threshold <= 0 {
+		threshold = DefaultKafkaLagAlertThreshold
+	}
+	if interval <= 0 {
+		interval = DefaultKafkaLagCheckInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &KafkaLagWatchdog{
+		reader:    reader,
+		topic:     topic,
+		groupID:   groupID,
+		threshold: threshold,
+		interval:  interval,
+		alert:     broadcastKafkaLagAlert,
+		recovered: broadcastKafkaLagRecovered,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Check один раз считает отставание группы и запоминает результат
+// Тревога отправляется при переходе через порог (и отбой - при возврате ниже), а не на каждой проверке
+func (w *KafkaLagWatchdog) Check(ctx context.Context) (*KafkaLagReport, error) {
+	highWaterMarks, err := w.reader.HighWaterMarks(ctx, w.topic)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения high-water mark топика %s: %w", w.topic, err)
+	}
+	partitions := make([]int, 0, len(highWaterMarks))
+	for partition := range highWaterMarks {
+		partitions = append(partitions, partition)
+	}
+	sort.Ints(partitions)
+
+	committed, err := w.reader.CommittedOffsets(ctx, w.groupID, w.topic, partitions)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения offset группы %s: %w", w.groupID, err)
+	}
+
+	report := KafkaLagReport{
+		Topic:      w.topic,
+		GroupID:    w.groupID,
+		Threshold:  w.threshold,
+		Partitions: make([]KafkaPartitionLag, 0, len(partitions)),
+		CheckedAt:  time.Now().UTC(),
+	}
+	for _, partition := range partitions {
+		committedOffset, ok := committed[partition]
+		if !ok {
+			committedOffset = -1
+		}
+		lag := partitionLag(partition, highWaterMarks[partition], committedOffset)
+		report.Partitions = append(report.Partitions, lag)
+		report.TotalLag += lag.Lag
+	}
+	report.Alert = report.TotalLag > w.threshold
+
+	w.mu.Lock()
+	wasAlerting := w.alerting
+	w.alerting = report.Alert
+	w.last = &report
+	w.mu.Unlock()
+
+	if report.Alert && !wasAlerting && w.alert != nil {
+		w.alert(report)
+	} else if !report.Alert && wasAlerting && w.recovered != nil {
+		w.recovered(report)
+	}
+	return &report, nil
+}
+
+// partitionLag считает отставание партиции. Партиция без закоммиченного offset не считается отстающей:
+// consumer после bootstrap начинает с LastOffset и еще не успел ничего закоммитить
+func partitionLag(partition int, highWaterMark, committed int64) KafkaPartitionLag {
+	lag := KafkaPartitionLag{Partition: partition, HighWaterMark: highWaterMark, Committed: committed}
+	if committed >= 0 && highWaterMark > committed {
+		lag.Lag = highWaterMark - committed
+	}
+	return lag
+}
+
+// LastReport возвращает результат последней проверки (nil - проверок еще не было)
+func (w *KafkaLagWatchdog) LastReport() *KafkaLagReport {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.last == nil {
+		return nil
+	}
+	report := *w.last
+	return &report
+}
+
+// Start запускает периодическую проверку отставания
+func (w *KafkaLagWatchdog) Start() {
+	log.Printf("⏱️ Kafka lag watchdog запущен: topic=%s, groupID=%s, порог=%d, период=%s", w.topic, w.groupID, w.threshold, w.interval)
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.ctx.Done():
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(w.ctx, kafkaLagCheckTimeout)
+				if _, err := w.Check(ctx); err != nil {
+					log.Printf("⚠️ Kafka lag watchdog: %v", err)
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// Stop останавливает периодическую проверку
+func (w *KafkaLagWatchdog) Stop() {
+	w.cancel()
+}
+
+// broadcastKafkaLagAlert - тревога по умолчанию: лог и событие для планшетов ERP
+func broadcastKafkaLagAlert(report KafkaLagReport) {
+	log.Printf("🚨 Kafka lag: группа %s отстает на %d сообщений в топике %s (порог %d) - заказы приходят на KDS с задержкой",
+		report.GroupID, report.TotalLag, report.Topic, report.Threshold)
+	BroadcastERPUpdate("kafka_lag_alert", report)
+}
+
+// broadcastKafkaLagRecovered - отбой тревоги по умолчанию
+func broadcastKafkaLagRecovered(report KafkaLagReport) {
+	log.Printf("✅ Kafka lag: группа %s догнала топик %s (отставание %d, порог %d)",
+		report.GroupID, report.Topic, report.TotalLag, report.Threshold)
+	BroadcastERPUpdate("kafka_lag_recovered", report)
+}
+
+// kafkaClientOffsetReader читает смещения через kafka.Client (SASL/TLS - как у consumer)
+type kafkaClientOffsetReader struct {
+	client *kafka.Client
+}
+
+// NewKafkaOffsetReader создает KafkaOffsetReader для брокеров brokers с теми же учетными данными, что и consumer
+func NewKafkaOffsetReader(brokers, username, password, caCert string) KafkaOffsetReader {
+	dialer := CreateKafkaDialer(username, password, caCert)
+	return &kafkaClientOffsetReader{
+		client: &kafka.Client{
+			Addr:    kafka.TCP(ParseKafkaBrokers(brokers)...),
+			Timeout: kafkaLagCheckTimeout,
+			Transport: &kafka.Transport{
+				SASL: dialer.SASLMechanism,
+				TLS:  dialer.TLS,
+			},
+		},
+	}
+}
+
+// HighWaterMarks читает LastOffset всех партиций топика
+func (r *kafkaClientOffsetReader) HighWaterMarks(ctx context.Context, topic string) (map[int]int64, error) {
+	metadata, err := r.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, err
+	}
+	var requests []kafka.OffsetRequest
+	for _, t := range metadata.Topics {
+		if t.Name != topic {
+			continue
+		}
+		if t.Error != nil {
+			return nil, t.Error
+		}
+		for _, partition := range t.Partitions {
+			requests = append(requests, kafka.LastOffsetOf(partition.ID))
+		}
+	}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("топик %s не найден", topic)
+	}
+
+	offsets, err := r.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: map[string][]kafka.OffsetRequest{topic: requests}})
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int]int64, len(requests))
+	for _, partition := range offsets.Topics[topic] {
+		if partition.Error != nil {
+			return nil, fmt.Errorf("партиция %d: %w", partition.Partition, partition.Error)
+		}
+		result[partition.Partition] = partition.LastOffset
+	}
+	return result, nil
+}
+
+// CommittedOffsets читает закоммиченные offset группы (OffsetFetch)
+func (r *kafkaClientOffsetReader) CommittedOffsets(ctx context.Context, groupID, topic string, partitions []int) (map[int]int64, error) {
+	response, err := r.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: groupID,
+		Topics:  map[string][]int{topic: partitions},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+	result := make(map[int]int64, len(partitions))
+	for _, partition := range response.Topics[topic] {
+		if partition.Error != nil {
+			return nil, fmt.Errorf("партиция %d: %w", partition.Partition, partition.Error)
+		}
+		result[partition.Partition] = partition.CommittedOffset
+	}
+	return result, nil
+}
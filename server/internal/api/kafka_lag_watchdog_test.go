@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"testing"
+)
+
+// fakeOffsetReader - смещения топика без брокера
+type fakeOffsetReader struct {
+	highWaterMarks map[int]int64
+	committed      map[int]int64
+}
+
+func (r *fakeOffsetReader) HighWaterMarks(ctx context.Context, topic string) (map[int]int64, error) {
+	return r.highWaterMarks, nil
+}
+
+func (r *fakeOffsetReader) CommittedOffsets(ctx context.Context, groupID, topic string, partitions []int) (map[int]int64, error) {
+	return r.committed, nil
+}
+
+func TestKafkaLagWatchdogAlertsAboveThreshold(t *testing.T) {
+	reader := &fakeOffsetReader{
+		highWaterMarks: map[int]int64{0: 500, 1: 300, 2: 40},
+		committed:      map[int]int64{0: 480, 1: 290, 2: -1}, // партиция 2 еще не коммитилась
+	}
+	watchdog := NewKafkaLagWatchdog(reader, "", "", 50, 0)
+	var alerts, recoveries []KafkaLagReport
+	watchdog.alert = func(report KafkaLagReport) { alerts = append(alerts, report) }
+	watchdog.recovered = func(report KafkaLagReport) { recoveries = append(recoveries, report) }
+
+	report, err := watchdog.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if report.TotalLag != 30 || report.Alert || len(alerts) != 0 {
+		t.Fatalf("отставание %d (alert=%v, тревог %d), want 30 без тревоги", report.TotalLag, report.Alert, len(alerts))
+	}
+	if len(report.Partitions) != 3 || report.Partitions[2].Lag != 0 || report.Partitions[2].Committed != -1 {
+		t.Errorf("партиции = %+v, want 3 и нулевое отставание у партиции без commit", report.Partitions)
+	}
+
+	// Всплеск: consumer не успевает
+	reader.highWaterMarks = map[int]int64{0: 600, 1: 350, 2: 40}
+	report, err = watchdog.Check(context.Background())
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if report.TotalLag != 180 || !report.Alert {
+		t.Fatalf("отставание %d (alert=%v), want 180 и тревогу", report.TotalLag, report.Alert)
+	}
+	if len(alerts) != 1 || alerts[0].TotalLag != 180 {
+		t.Fatalf("тревоги = %+v, want одну с отставанием 180", alerts)
+	}
+
+	// Повторная проверка выше порога не дублирует тревогу
+	if _, err := watchdog.Check(context.Background()); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if len(alerts) != 1 {
+		t.Errorf("тревог %d, want 1 (без повтора)", len(alerts))
+	}
+
+	// Consumer догнал топик
+	reader.committed = map[int]int64{0: 600, 1: 350, 2: 40}
+	if _, err := watchdog.Check(context.Background()); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if len(recoveries) != 1 || recoveries[0].TotalLag != 0 {
+		t.Errorf("отбой = %+v, want один с нулевым отставанием", recoveries)
+	}
+	if last := watchdog.LastReport(); last == nil || last.Alert {
+		t.Errorf("LastReport = %+v, want последний результат без тревоги", last)
+	}
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"zephyrvpn/server/internal/models"
+)
+
+// DefaultKafkaConsumerWorkers - число воркеров KafkaWSConsumer по умолчанию (KAFKA_CONSUMER_WORKERS)
+const DefaultKafkaConsumerWorkers = 4
+
+// kafkaWorkerQueueSize - сколько сообщений может ждать в очереди одного воркера
+const kafkaWorkerQueueSize = 64
+
+// kafkaOrderReader - часть kafka.Reader, нужная воркерам consumer (в тестах подменяется)
+type kafkaOrderReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// kafkaOrderJob - сообщение, распарсенное диспетчером и переданное воркеру
+type kafkaOrderJob struct {
+	msg   kafka.Message
+	order models.PizzaOrder
+	ok    bool // false - сообщение не удалось распарсить: обработчик не вызывается, offset коммитится
+}
+
+// kafkaWorkerIndex выбирает воркер по ключу: все сообщения одного заказа попадают в один воркер
+// и обрабатываются по порядку
+func kafkaWorkerIndex(key string, workers int) int {
+	if workers <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(workers))
+}
+
+// kafkaOrderKey - ключ маршрутизации сообщения: ID заказа, иначе ключ Kafka, иначе партиция
+func kafkaOrderKey(msg kafka.Message, order models.PizzaOrder) string {
+	if order.ID != "" {
+		return order.ID
+	}
+	if len(msg.Key) > 0 {
+		return string(msg.Key)
+	}
+	return "partition:" + strconv.Itoa(msg.Partition)
+}
+
+// runKafkaOrderWorkers читает сообщения reader и обрабатывает их в workers горутинах до отмены ctx
+// Сообщения одного заказа обрабатываются последовательно в одном воркере (см. kafkaWorkerIndex).
+// Offset коммитится только после обработки всех предыдущих сообщений партиции (см. kafkaOffsetTracker),
+// поэтому после падения заказ может прийти повторно, но не потеряется
+func runKafkaOrderWorkers(ctx context.Context, reader kafkaOrderReader, workers int,
+	decode func(kafka.Message) (models.PizzaOrder, bool),
+	handle func(kafka.Message, models.PizzaOrder)) {
+	if workers <= 0 {
+		workers = 1
+	}
+	tracker := newKafkaOffsetTracker(func(msg kafka.Message) error {
+		return reader.CommitMessages(ctx, msg)
+	})
+
+	queues := make([]chan kafkaOrderJob, workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan kafkaOrderJob, kafkaWorkerQueueSize)
+		wg.Add(1)
+		go func(jobs <-chan kafkaOrderJob) {
+			defer wg.Done()
+			for job := range jobs {
+				if job.ok {
+					handle(job.msg, job.order)
+				}
+				if err := tracker.done(job.msg); err != nil {
+					log.Printf("⚠️ Kafka Consumer: ошибка commit offset для сообщения offset=%d: %v", job.msg.Offset, err)
+				}
+			}
+		}(queues[i])
+	}
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+	}()
+
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("⚠️ Kafka WS Consumer ошибка чтения: %v", err)
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
+		order, ok := decode(msg)
+		tracker.track(msg)
+		select {
+		case queues[kafkaWorkerIndex(kafkaOrderKey(msg, order), workers)] <- kafkaOrderJob{msg: msg, order: order, ok: ok}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// kafkaOffsetTracker коммитит offset партиции, только когда обработаны все сообщения до него
+// Воркеры заканчивают сообщения не по порядку: offset 7 может быть готов раньше 5
+type kafkaOffsetTracker struct {
+	mu         sync.Mutex
+	commit     func(kafka.Message) error
+	partitions map[string]*partitionOffsets
+}
+
+// partitionOffsets - сообщения партиции в порядке чтения и отметки об их обработке
+type partitionOffsets struct {
+	pending []int64        // Offset в порядке чтения, еще не закоммиченные
+	done    map[int64]bool // false - в обработке, true - обработан
+}
+
+func newKafkaOffsetTracker(commit func(kafka.Message) error) *kafkaOffsetTracker {
+	return &kafkaOffsetTracker{
+		commit:     commit,
+		partitions: make(map[string]*partitionOffsets),
+	}
+}
+
+func partitionTrackerKey(msg kafka.Message) string {
+	return msg.Topic + "/" + strconv.Itoa(msg.Partition)
+}
+
+// track регистрирует прочитанное сообщение до передачи воркеру
+// Offset не больше уже прочитанного - партицию перечитывают после rebalance: старые отметки сбрасываются
+func (t *kafkaOffsetTracker) track(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := partitionTrackerKey(msg)
+	p, ok := t.partitions[key]
+	if !ok || (len(p.pending) > 0 && msg.Offset <= p.pending[len(p.pending)-1]) {
+		p = &partitionOffsets{done: make(map[int64]bool)}
+		t.partitions[key] = p
+	}
+	p.pending = append(p.pending, msg.Offset)
+	p.done[msg.Offset] = false
+}
+
+// done отмечает сообщение обработанным и коммитит самый дальний offset, до которого обработано все
+// Commit выполняется под блокировкой, чтобы offset партиции не откатывался назад
+func (t *kafkaOffsetTracker) done(msg kafka.Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.partitions[partitionTrackerKey(msg)]
+	if !ok {
+		return nil
+	}
+	if _, tracked := p.done[msg.Offset]; !tracked {
+		return nil // Отметка сброшена rebalance - сообщение придет снова
+	}
+	p.done[msg.Offset] = true
+
+	committed := int64(-1)
+	for len(p.pending) > 0 && p.done[p.pending[0]] {
+		committed = p.pending[0]
+		delete(p.done, committed)
+		p.pending = p.pending[1:]
+	}
+	if committed < 0 {
+		return nil
+	}
+	return t.commit(kafka.Message{Topic: msg.Topic, Partition: msg.Partition, Offset: committed})
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"zephyrvpn/server/internal/models"
+)
+
+// fakeKafkaReader отдает заранее подготовленные сообщения и запоминает закоммиченные offset
+type fakeKafkaReader struct {
+	messages chan kafka.Message
+
+	mu        sync.Mutex
+	committed map[int]int64 // Партиция -> последний закоммиченный offset
+	regressed bool          // Offset партиции коммитился меньше уже закоммиченного
+}
+
+func newFakeKafkaReader(messages []kafka.Message) *fakeKafkaReader {
+	ch := make(chan kafka.Message, len(messages))
+	for _, msg := range messages {
+		ch <- msg
+	}
+	return &fakeKafkaReader{messages: ch, committed: make(map[int]int64)}
+}
+
+func (r *fakeKafkaReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case msg := <-r.messages:
+		return msg, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (r *fakeKafkaReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, msg := range msgs {
+		if prev, ok := r.committed[msg.Partition]; ok && msg.Offset < prev {
+			r.regressed = true
+		}
+		r.committed[msg.Partition] = msg.Offset
+	}
+	return nil
+}
+
+func TestKafkaOrderWorkersProcessBurstExactlyOnce(t *testing.T) {
+	const (
+		partitions      = 3
+		orders          = 300
+		updatesPerOrder = 3
+	)
+	// Как у продюсера: ключ - ID заказа, все сообщения заказа в одной партиции и идут по порядку
+	var messages []kafka.Message
+	nextOffset := make([]int64, partitions)
+	for update := 0; update < updatesPerOrder; update++ {
+		for i := 0; i < orders; i++ {
+			orderID := fmt.Sprintf("order-%03d", i)
+			partition := i % partitions
+			messages = append(messages, kafka.Message{
+				Topic:     "pizza-orders",
+				Partition: partition,
+				Offset:    nextOffset[partition],
+				Key:       []byte(orderID),
+				Value:     []byte(fmt.Sprintf("%s|%d", orderID, update)),
+			})
+			nextOffset[partition]++
+		}
+	}
+	// Нераспарсенное сообщение тоже должно быть закоммичено, иначе партиция встанет
+	messages = append(messages, kafka.Message{Topic: "pizza-orders", Partition: 0, Offset: nextOffset[0], Value: []byte("garbage")})
+	nextOffset[0]++
+
+	decode := func(msg kafka.Message) (models.PizzaOrder, bool) {
+		var number, update int
+		if _, err := fmt.Sscanf(string(msg.Value), "order-%03d|%d", &number, &update); err != nil {
+			return models.PizzaOrder{}, false
+		}
+		return models.PizzaOrder{ID: fmt.Sprintf("order-%03d", number), Status: fmt.Sprint(update)}, true
+	}
+
+	var mu sync.Mutex
+	seen := make(map[string][]string) // Заказ -> обновления в порядке обработки
+	handled := 0
+	allHandled := make(chan struct{})
+	handle := func(msg kafka.Message, order models.PizzaOrder) {
+		// Разное время обработки перемешивает завершение сообщений между воркерами
+		time.Sleep(time.Duration(rand.Intn(300)) * time.Microsecond)
+		mu.Lock()
+		defer mu.Unlock()
+		seen[order.ID] = append(seen[order.ID], order.Status)
+		handled++
+		if handled == orders*updatesPerOrder {
+			close(allHandled)
+		}
+	}
+
+	reader := newFakeKafkaReader(messages)
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	go func() {
+		runKafkaOrderWorkers(ctx, reader, 8, decode, handle)
+		close(finished)
+	}()
+
+	select {
+	case <-allHandled:
+	case <-time.After(10 * time.Second):
+		t.Fatal("не все сообщения обработаны за 10 секунд")
+	}
+	// Commit последнего сообщения идет после возврата из handle - ждем его
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		reader.mu.Lock()
+		complete := true
+		for partition := 0; partition < partitions; partition++ {
+			if offset, ok := reader.committed[partition]; !ok || offset != nextOffset[partition]-1 {
+				complete = false
+			}
+		}
+		reader.mu.Unlock()
+		if complete {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("закоммичены offset %v, want последние offset партиций %v", reader.committed, nextOffset)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-finished
+
+	if len(seen) != orders {
+		t.Fatalf("обработано заказов %d, want %d", len(seen), orders)
+	}
+	want := fmt.Sprint([]string{"0", "1", "2"})
+	for orderID, updates := range seen {
+		if got := fmt.Sprint(updates); got != want {
+			t.Errorf("заказ %s: обновления %s, want %s (каждое ровно один раз и по порядку)", orderID, got, want)
+		}
+	}
+	if reader.regressed {
+		t.Error("offset партиции коммитился назад")
+	}
+}
+
+func TestKafkaOffsetTrackerCommitsContiguousPrefix(t *testing.T) {
+	var commits []int64
+	tracker := newKafkaOffsetTracker(func(msg kafka.Message) error {
+		commits = append(commits, msg.Offset)
+		return nil
+	})
+	msg := func(offset int64) kafka.Message {
+		return kafka.Message{Topic: "pizza-orders", Partition: 1, Offset: offset}
+	}
+	for offset := int64(10); offset <= 13; offset++ {
+		tracker.track(msg(offset))
+	}
+
+	// 12 и 11 готовы раньше 10 - коммитить нечего, иначе падение потеряет 10
+	tracker.done(msg(12))
+	tracker.done(msg(11))
+	if len(commits) != 0 {
+		t.Fatalf("commit до обработки offset 10: %v", commits)
+	}
+	tracker.done(msg(10))
+	tracker.done(msg(13))
+	if fmt.Sprint(commits) != "[12 13]" {
+		t.Errorf("commits %v, want [12 13]", commits)
+	}
+
+	// После rebalance партицию перечитывают с закоммиченного offset: старые отметки не мешают
+	tracker.track(msg(20))
+	tracker.track(msg(14))
+	tracker.done(msg(20)) // Сброшено rebalance - не коммитится
+	tracker.done(msg(14))
+	if fmt.Sprint(commits) != "[12 13 14]" {
+		t.Errorf("commits после rebalance %v, want [12 13 14]", commits)
+	}
+}
+
+func TestKafkaWorkerIndexIsStablePerOrder(t *testing.T) {
+	for _, orderID := range []string{"a", "order-1", "4f9c2d1e-0000-4000-8000-000000000000"} {
+		first := kafkaWorkerIndex(orderID, 8)
+		if first < 0 || first >= 8 {
+			t.Fatalf("воркер %d вне диапазона 0..7", first)
+		}
+		for i := 0; i < 10; i++ {
+			if got := kafkaWorkerIndex(orderID, 8); got != first {
+				t.Fatalf("заказ %s: воркер %d, затем %d", orderID, first, got)
+			}
+		}
+	}
+	if got := kafkaWorkerIndex("order-1", 1); got != 0 {
+		t.Errorf("один воркер: индекс %d, want 0", got)
+	}
+}
@@ -0,0 +1,41 @@
+package api
+
+import "testing"
+
+// Брокер не запускается: проверяем только, что consumer и producer настроены на заданные топик и группу
+func TestKafkaUsesConfiguredTopicAndGroup(t *testing.T) {
+	const topic = "staging-pizza-orders"
+	const group = "staging-order-service"
+
+	consumer := NewKafkaWSConsumer("127.0.0.1:1", topic, group, nil, "", "", "", true, nil)
+	defer consumer.Stop()
+
+	config := consumer.reader.Config()
+	if config.Topic != topic {
+		t.Errorf("consumer topic = %q, want %q", config.Topic, topic)
+	}
+	if config.GroupID != group {
+		t.Errorf("consumer group = %q, want %q", config.GroupID, group)
+	}
+	if key := consumer.processedKey(); key != "kafka:processed:"+group+":"+topic {
+		t.Errorf("processedKey = %q, want ключ с группой и топиком", key)
+	}
+
+	server := NewOrderGRPCServer(nil, "127.0.0.1:1", topic, nil, 0, 0, 23, 59, "", "", "", nil)
+	defer server.Close()
+
+	if server.kafkaWriter == nil || server.kafkaWriter.Topic != topic {
+		t.Fatalf("producer пишет не в топик %q: %+v", topic, server.kafkaWriter)
+	}
+}
+
+func TestKafkaDefaultsTopicAndGroup(t *testing.T) {
+	consumer := NewKafkaWSConsumer("127.0.0.1:1", "", "", nil, "", "", "", true, nil)
+	defer consumer.Stop()
+
+	config := consumer.reader.Config()
+	if config.Topic != DefaultKafkaOrdersTopic || config.GroupID != DefaultKafkaConsumerGroup {
+		t.Errorf("по умолчанию topic=%q group=%q, want %q и %q",
+			config.Topic, config.GroupID, DefaultKafkaOrdersTopic, DefaultKafkaConsumerGroup)
+	}
+}
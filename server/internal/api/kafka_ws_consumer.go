@@ -5,15 +5,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
 	"sync/atomic"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	"github.com/segmentio/kafka-go"
 	"google.golang.org/protobuf/proto"
 	"zephyrvpn/server/internal/models"
 	"zephyrvpn/server/internal/pb"
 	"zephyrvpn/server/internal/services"
 	"zephyrvpn/server/internal/utils"
+	"zephyrvpn/server/internal/utils/rediskeys"
+)
+
+// processedOrdersTTL - сколько помним обработанные заказы (kafka:processed:{group}:{topic})
+// Совпадает с окном архива заказов ERP (erp:order:* хранится 7 дней) и retention топика по умолчанию
+const processedOrdersTTL = 7 * 24 * time.Hour
+
+// Топик заказов и consumer group по умолчанию (KAFKA_ORDERS_TOPIC, KAFKA_CONSUMER_GROUP)
+// Разные окружения на одном кластере Kafka задают свои значения, чтобы не читать чужие заказы
+const (
+	DefaultKafkaOrdersTopic   = "pizza-orders"
+	DefaultKafkaConsumerGroup = "order-service-stable-group"
 )
 
 // KafkaWSConsumer читает заказы из Kafka и отправляет их в WebSocket
@@ -26,16 +40,23 @@ type KafkaWSConsumer struct {
 	cancel      context.CancelFunc
 	redisUtil   *utils.RedisClient
 	orderService *services.OrderService // Для сохранения в PostgreSQL
+	workers     int   // Сколько сообщений обрабатывается параллельно (KAFKA_CONSUMER_WORKERS)
 	processed   int64 // Счетчик обработанных заказов
 	lastLog     int64 // Время последнего лога
 }
 
 // NewKafkaWSConsumer создает новый Kafka Consumer для WebSocket
 // После BootstrapState из PostgreSQL, consumer должен начинать с latest offset
-// чтобы не обрабатывать старые заказы повторно
-func NewKafkaWSConsumer(brokers string, topic string, redisUtil *utils.RedisClient, username, password, caCert string, startFromLatest bool, orderService *services.OrderService) *KafkaWSConsumer {
+// чтобы не обрабатывать старые заказы повторно. Пустые topic и groupID - значения по умолчанию
+func NewKafkaWSConsumer(brokers string, topic, groupID string, redisUtil *utils.RedisClient, username, password, caCert string, startFromLatest bool, orderService *services.OrderService) *KafkaWSConsumer {
 	brokerList := ParseKafkaBrokers(brokers)
 	ctx, cancel := context.WithCancel(context.Background())
+	if topic == "" {
+		topic = DefaultKafkaOrdersTopic
+	}
+	if groupID == "" {
+		groupID = DefaultKafkaConsumerGroup
+	}
 	
 	// Создаем dialer с SASL/PLAIN и TLS если нужно
 	dialer := CreateKafkaDialer(username, password, caCert)
@@ -53,7 +74,7 @@ func NewKafkaWSConsumer(brokers string, topic string, redisUtil *utils.RedisClie
 	reader := kafka.NewReader(kafka.ReaderConfig{
 		Brokers:     brokerList,
 		Topic:       topic,
-		GroupID:     "order-service-stable-group", // Стабильный group.id для управления offset
+		GroupID:     groupID, // Стабильный group.id для управления offset
 		StartOffset: startOffset,
 		
 		// Настройки производительности для батчинга
@@ -68,241 +89,284 @@ func NewKafkaWSConsumer(brokers string, topic string, redisUtil *utils.RedisClie
 		HeartbeatInterval: 20 * time.Second,   // Интервал heartbeat (должен быть < SessionTimeout/3)
 		RebalanceTimeout:  30 * time.Second,   // Время на rebalance при добавлении/удалении consumer
 		
-		// КРИТИЧНО: Автоматический commit offset каждые 5 секунд
-		// Это гарантирует, что обработанные сообщения не будут повторно обработаны
+		// Offset коммитит runKafkaOrderWorkers после обработки (FetchMessage не коммитит сам),
+		// накопленные commit отправляются в Kafka раз в 5 секунд
 		CommitInterval: 5 * time.Second,
 	})
 	
 	return &KafkaWSConsumer{
 		brokers:      brokerList,
 		topic:        topic,
-		groupID:      "order-service-stable-group",
+		groupID:      groupID,
 		reader:       reader,
 		ctx:          ctx,
 		cancel:       cancel,
 		redisUtil:    redisUtil,
 		orderService: orderService,
+		workers:      DefaultKafkaConsumerWorkers,
 		lastLog:      time.Now().Unix(),
 	}
 }
 
+// SetWorkerCount задает число воркеров обработки сообщений (вызывать до Start; меньше 1 - один воркер)
+// Больше воркеров, чем партиций топика, имеет смысл: сообщения распределяются по ID заказа, а не по партиции
+func (kc *KafkaWSConsumer) SetWorkerCount(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	kc.workers = workers
+}
+
 // Start запускает чтение из Kafka и отправку в WebSocket
+// Сообщения обрабатывают kc.workers воркеров; сообщения одного заказа - всегда один воркер по порядку
 func (kc *KafkaWSConsumer) Start() {
-	log.Printf("📡 Kafka WS Consumer запущен: topic=%s, groupID=%s, startOffset=FirstOffset", kc.topic, kc.groupID)
+	log.Printf("📡 Kafka WS Consumer запущен: topic=%s, groupID=%s, воркеров=%d", kc.topic, kc.groupID, kc.workers)
 	
-	go func() {
-		for {
-			select {
-			case <-kc.ctx.Done():
-				log.Println("🛑 Kafka WS Consumer остановлен")
-				return
-			default:
-				// Читаем сообщение из Kafka
-				msg, err := kc.reader.ReadMessage(kc.ctx)
-				if err != nil {
-					if err == context.Canceled {
-						return
-					}
-					log.Printf("⚠️ Kafka WS Consumer ошибка чтения: %v", err)
-					time.Sleep(1 * time.Second)
-					continue
+	go runKafkaOrderWorkers(kc.ctx, kc.reader, kc.workers, decodeKafkaOrder, kc.handleOrder)
+}
+
+// decodeKafkaOrder разбирает сообщение заказа: Protobuf, при ошибке - JSON
+// false - сообщение не удалось распарсить ни одним способом
+func decodeKafkaOrder(msg kafka.Message) (models.PizzaOrder, bool) {
+	// Пробуем распарсить Protobuf
+	pbOrder := &pb.PizzaOrder{}
+	var order models.PizzaOrder
+	
+	if err := proto.Unmarshal(msg.Value, pbOrder); err == nil {
+		// Успешно распарсили Protobuf - конвертируем в models.PizzaOrder
+		order = models.PizzaOrder{
+			ID:               pbOrder.Id,
+			DisplayID:        pbOrder.DisplayId,
+			CustomerID:       int(pbOrder.CustomerId),
+			CustomerFirstName: pbOrder.CustomerFirstName,
+			CustomerLastName:  pbOrder.CustomerLastName,
+			CustomerPhone:     pbOrder.CustomerPhone,
+			DeliveryAddress:   pbOrder.DeliveryAddress,
+			IsPickup:          pbOrder.IsPickup,
+			PickupLocationID:  pbOrder.PickupLocationId,
+			Channel:           pbOrder.Channel,
+			PrepSeconds:       int(pbOrder.PrepSeconds),
+			TotalPrice:        int(pbOrder.TotalPrice),
+			CreatedAt:         time.Unix(0, pbOrder.CreatedAt),
+			Status:            pbOrder.Status,
+			IsSet:             pbOrder.IsSet,
+			SetName:           pbOrder.SetName,
+			TargetSlotID:      pbOrder.TargetSlotId,
+		}
+		
+		// Получаем VisibleAt из protobuf, если есть
+		if pbOrder.VisibleAt != "" {
+			if visibleAt, err := time.Parse(time.RFC3339, pbOrder.VisibleAt); err == nil {
+				order.VisibleAt = visibleAt
+			}
+		}
+		order.RefreshDueAt()
+		// Конвертируем Items если есть
+		for _, pbItem := range pbOrder.Items {
+			item := models.PizzaItem{
+				PizzaName:   pbItem.PizzaName,
+				Ingredients: pbItem.Ingredients,
+				Extras:      pbItem.Extras,
+				Quantity:    int(pbItem.Quantity),
+				Price:       int(pbItem.Price),
+				DiscountAmount:  int(pbItem.DiscountAmount),
+				DiscountPercent: int(pbItem.DiscountPercent),
+			}
+			// Конвертируем дозировки из protobuf (map[string]int32 -> map[string]int)
+			if pbItem.IngredientAmounts != nil && len(pbItem.IngredientAmounts) > 0 {
+				item.IngredientAmounts = make(map[string]int)
+				for k, v := range pbItem.IngredientAmounts {
+					item.IngredientAmounts[k] = int(v)
 				}
-				
-				log.Printf("📨 Kafka WS Consumer: получено сообщение offset=%d, partition=%d, size=%d bytes", 
-					msg.Offset, msg.Partition, len(msg.Value))
-				
-				// Пробуем распарсить Protobuf
-				pbOrder := &pb.PizzaOrder{}
-				var order models.PizzaOrder
-				
-				if err := proto.Unmarshal(msg.Value, pbOrder); err == nil {
-					// Успешно распарсили Protobuf - конвертируем в models.PizzaOrder
-					order = models.PizzaOrder{
-						ID:               pbOrder.Id,
-						DisplayID:        pbOrder.DisplayId,
-						CustomerID:       int(pbOrder.CustomerId),
-						CustomerFirstName: pbOrder.CustomerFirstName,
-						CustomerLastName:  pbOrder.CustomerLastName,
-						CustomerPhone:     pbOrder.CustomerPhone,
-						DeliveryAddress:   pbOrder.DeliveryAddress,
-						IsPickup:          pbOrder.IsPickup,
-						PickupLocationID:  pbOrder.PickupLocationId,
-						TotalPrice:        int(pbOrder.TotalPrice),
-						CreatedAt:         time.Unix(0, pbOrder.CreatedAt),
-						Status:            pbOrder.Status,
-						IsSet:             pbOrder.IsSet,
-						SetName:           pbOrder.SetName,
-						TargetSlotID:      pbOrder.TargetSlotId,
-					}
-					
-					// Получаем VisibleAt из protobuf, если есть
-					if pbOrder.VisibleAt != "" {
-						if visibleAt, err := time.Parse(time.RFC3339, pbOrder.VisibleAt); err == nil {
-							order.VisibleAt = visibleAt
-						}
-					}
-					// Конвертируем Items если есть
-					for _, pbItem := range pbOrder.Items {
-						item := models.PizzaItem{
-							PizzaName:   pbItem.PizzaName,
-							Ingredients: pbItem.Ingredients,
-							Extras:      pbItem.Extras,
-							Quantity:    int(pbItem.Quantity),
-							Price:       int(pbItem.Price),
-						}
-						// Конвертируем дозировки из protobuf (map[string]int32 -> map[string]int)
-						if pbItem.IngredientAmounts != nil && len(pbItem.IngredientAmounts) > 0 {
-							item.IngredientAmounts = make(map[string]int)
-							for k, v := range pbItem.IngredientAmounts {
-								item.IngredientAmounts[k] = int(v)
-							}
-						} else {
-							// Если дозировок нет в protobuf, берем из модели пиццы
-							if pizza, exists := models.GetPizza(pbItem.PizzaName); exists && pizza.IngredientAmounts != nil {
-								item.IngredientAmounts = pizza.IngredientAmounts
-							}
-						}
-						order.Items = append(order.Items, item)
-					}
-				} else {
-					// Fallback на JSON
-					if err := json.Unmarshal(msg.Value, &order); err != nil {
-						// Не логируем каждую ошибку парсинга, чтобы не спамить
-						continue
-					}
+			} else {
+				// Если дозировок нет в protobuf, берем из модели пиццы
+				if pizza, exists := models.GetPizza(pbItem.PizzaName); exists && pizza.IngredientAmounts != nil {
+					item.IngredientAmounts = pizza.IngredientAmounts
 				}
-				
-				// 1. Сохраняем заказ в Redis (для быстрого доступа)
-				if kc.redisUtil != nil {
-					orderJSON, _ := json.Marshal(order)
-					orderKey := fmt.Sprintf("erp:order:%s", order.ID)
-					err := kc.redisUtil.SetBytes(orderKey, orderJSON, 24*time.Hour)
-					if err != nil {
-						log.Printf("⚠️ Ошибка сохранения заказа %s в Redis: %v", order.ID, err)
-					}
-					
-					// 2. Проверяем VisibleAt перед добавлением в активные
-					// Если VisibleAt не заполнен в Kafka сообщении, проверяем Redis (заказ мог быть создан ранее)
-					if order.VisibleAt.IsZero() {
-						// Пробуем получить VisibleAt из Redis
-						visibleAtKey := fmt.Sprintf("order:visible_at:%s", order.ID)
-						if visibleAtStr, err := kc.redisUtil.Get(visibleAtKey); err == nil && visibleAtStr != "" {
-							if visibleAt, err := time.Parse(time.RFC3339, visibleAtStr); err == nil {
-								order.VisibleAt = visibleAt
-							}
-						}
-						
-						// Если все еще нет VisibleAt, но есть TargetSlotID, пробуем получить время начала слота
-						if order.VisibleAt.IsZero() && order.TargetSlotID != "" {
-							slotStartKey := fmt.Sprintf("order:slot:start:%s", order.ID)
-							if slotStartStr, err := kc.redisUtil.Get(slotStartKey); err == nil && slotStartStr != "" {
-								if slotStartTime, err := time.Parse(time.RFC3339, slotStartStr); err == nil {
-									// Вычисляем VisibleAt как время начала слота минус 15 минут
-									order.VisibleAt = slotStartTime.Add(-15 * time.Minute)
-									// Сохраняем вычисленное VisibleAt
-									kc.redisUtil.Set(visibleAtKey, order.VisibleAt.Format(time.RFC3339), 24*time.Hour)
-								}
-							}
-						}
-					}
-					
-					// НЕ добавляем заказ в активные сразу - он появится только когда наступит VisibleAt
-					if !order.VisibleAt.IsZero() {
-						// Сохраняем время показа для проверки (если еще не сохранено)
-						visibleAtKey := fmt.Sprintf("order:visible_at:%s", order.ID)
-						kc.redisUtil.Set(visibleAtKey, order.VisibleAt.Format(time.RFC3339), 24*time.Hour)
-						
-						// Если есть TargetSlotStartTime, сохраняем его тоже
-						if !order.TargetSlotStartTime.IsZero() {
-							kc.redisUtil.Set(fmt.Sprintf("order:slot:start:%s", order.ID), order.TargetSlotStartTime.Format(time.RFC3339), 24*time.Hour)
-						}
-						
-						// Проверяем, не находится ли заказ уже в active (защита от дублирования)
-						isActive, _ := kc.redisUtil.SIsMember("erp:orders:active", order.ID)
-						if isActive {
-							// Заказ уже в active - удаляем его оттуда и добавляем в pending
-							kc.redisUtil.SRem("erp:orders:active", order.ID)
-							log.Printf("🔄 Заказ %s перемещен из active в pending_slots (будет показан: %s UTC)", 
-								order.ID, order.VisibleAt.Format("15:04:05"))
-						}
-						
-						// Добавляем в список ожидающих заказов (не в активные!)
-						err = kc.redisUtil.SAdd("erp:orders:pending_slots", order.ID)
-						if err != nil {
-							log.Printf("⚠️ Ошибка добавления заказа %s в pending_slots: %v", order.ID, err)
-						} else {
-							log.Printf("📅 Заказ %s добавлен в erp:orders:pending_slots (будет показан: %s UTC)", 
-								order.ID, order.VisibleAt.Format("15:04:05"))
-						}
-					} else {
-						// Если нет VisibleAt, добавляем сразу в активные (старая логика для обратной совместимости)
-						// Но сначала проверяем, не находится ли заказ уже в pending_slots
-						isPending, _ := kc.redisUtil.SIsMember("erp:orders:pending_slots", order.ID)
-						if isPending {
-							// Заказ уже в pending - не добавляем в active
-							log.Printf("ℹ️ Заказ %s уже в pending_slots, пропускаем добавление в active", order.ID)
-						} else {
-							err = kc.redisUtil.SAdd("erp:orders:active", order.ID)
-							if err != nil {
-								log.Printf("⚠️ Ошибка добавления заказа %s в активные: %v", order.ID, err)
-							} else {
-								log.Printf("✅ Заказ %s добавлен в erp:orders:active", order.ID)
-							}
-						}
-					}
-					
-					// 3. Сохраняем заказ в PostgreSQL (асинхронно, не блокируем обработку)
-					if kc.orderService != nil {
-						go func(orderToSave models.PizzaOrder) {
-							if err := kc.orderService.SaveOrder(orderToSave); err != nil {
-								log.Printf("⚠️ Kafka Consumer: ошибка сохранения заказа %s в PostgreSQL: %v", orderToSave.ID, err)
-							} else {
-								log.Printf("✅ Kafka Consumer: заказ %s сохранен в PostgreSQL", orderToSave.ID)
-							}
-						}(order)
-					}
-					
-					// 4. Инкремент счетчиков для статистики
-					kc.redisUtil.Increment("erp:orders:total")
-					kc.redisUtil.Increment("erp:orders:pending")
-					
-					// НЕ добавляем в очередь воркеров - обработка только вручную через ERP
-					
-					// 5. КРИТИЧНО: Commit offset только после успешной обработки
-					// Это гарантирует at-least-once delivery и предотвращает повторную обработку
-					// Commit делаем после сохранения в Redis/PostgreSQL, но до отправки в WebSocket
-					// (WebSocket может быть недоступен, но заказ уже сохранен)
-					if err := kc.reader.CommitMessages(kc.ctx, msg); err != nil {
-						log.Printf("⚠️ Kafka Consumer: ошибка commit offset для сообщения offset=%d: %v", msg.Offset, err)
-						// Продолжаем работу, так как CommitInterval также делает автоматический commit
-					}
+			}
+			order.Items = append(order.Items, item)
+		}
+	} else {
+		// Fallback на JSON
+		if err := json.Unmarshal(msg.Value, &order); err != nil {
+			// Не логируем каждую ошибку парсинга, чтобы не спамить
+			return order, false
+		}
+	}
+	return order, true
+}
+
+// handleOrder сохраняет заказ в Redis и PostgreSQL и рассылает его в WebSocket
+// Вызывается из воркера runKafkaOrderWorkers; сообщения одного заказа не обрабатываются параллельно
+func (kc *KafkaWSConsumer) handleOrder(msg kafka.Message, order models.PizzaOrder) {
+	// ID исходного запроса (X-Request-ID из заголовков сообщения) для сквозных логов
+	requestID := requestIDFromKafkaMessage(msg)
+	log.Printf("📨 [req=%s] Kafka WS Consumer: получено сообщение offset=%d, partition=%d, size=%d bytes", 
+		requestID, msg.Offset, msg.Partition, len(msg.Value))
+	
+	// Идемпотентность: после рестарта (BootstrapState + повторное чтение незакоммиченных offset)
+	// то же сообщение может прийти второй раз - повторно заказ не обрабатываем
+	if kc.redisUtil != nil && order.ID != "" && kc.isOrderProcessed(order.ID) {
+		log.Printf("ℹ️ [req=%s] Kafka WS Consumer: заказ %s уже обработан (offset=%d), пропускаем", requestID, order.ID, msg.Offset)
+		return
+	}
+	
+	// 0. Защита от отката статуса: повторно доставленное или устаревшее сообщение
+	// не должно возвращать заказ, например, из ready обратно в pending
+	if kc.redisUtil != nil {
+		if currentStatus := kc.currentOrderStatus(order.ID); currentStatus != "" && currentStatus != order.Status {
+			current, currentOk := models.ParseOrderStatus(currentStatus)
+			incoming, incomingOk := models.ParseOrderStatus(order.Status)
+			if currentOk && (!incomingOk || !models.CanTransition(current, incoming)) {
+				log.Printf("⚠️ [req=%s] Kafka WS Consumer: переход заказа %s '%s' -> '%s' запрещен, сохраняем текущий статус",
+					requestID, order.ID, currentStatus, order.Status)
+				order.Status = currentStatus
+			}
+		}
+	}
+	
+	// 1. Сохраняем заказ в Redis (для быстрого доступа)
+	if kc.redisUtil != nil {
+		orderJSON, _ := json.Marshal(order)
+		orderKey := rediskeys.OrderKey(order.ID)
+		err := kc.redisUtil.SetBytes(orderKey, orderJSON, rediskeys.OrderTTL())
+		if err != nil {
+			log.Printf("⚠️ [req=%s] Ошибка сохранения заказа %s в Redis: %v", requestID, order.ID, err)
+		}
+		
+		// 2. Проверяем VisibleAt перед добавлением в активные
+		// Если VisibleAt не заполнен в Kafka сообщении, проверяем Redis (заказ мог быть создан ранее)
+		if order.VisibleAt.IsZero() {
+			// Пробуем получить VisibleAt из Redis
+			visibleAtKey := rediskeys.OrderVisibleAtKey(order.ID)
+			if visibleAtStr, err := kc.redisUtil.Get(visibleAtKey); err == nil && visibleAtStr != "" {
+				if visibleAt, err := time.Parse(time.RFC3339, visibleAtStr); err == nil {
+					order.VisibleAt = visibleAt
 				}
-				
-				// 4. Отправляем заказ в WebSocket (после commit offset)
-				// Отправляем на планшеты поваров
-				orderJSON, err := json.Marshal(order)
+			}
+		}
+		
+		// НЕ добавляем заказ в активные сразу - он появится только когда наступит VisibleAt
+		if !order.VisibleAt.IsZero() {
+			// Сохраняем время показа для проверки (если еще не сохранено)
+			visibleAtKey := rediskeys.OrderVisibleAtKey(order.ID)
+			kc.redisUtil.Set(visibleAtKey, order.VisibleAt.Format(time.RFC3339), rediskeys.OrderTTL())
+			
+			// Если есть TargetSlotStartTime, сохраняем его тоже
+			if !order.TargetSlotStartTime.IsZero() {
+				kc.redisUtil.Set(rediskeys.OrderSlotStartKey(order.ID), order.TargetSlotStartTime.Format(time.RFC3339), rediskeys.OrderTTL())
+			}
+			
+			// Проверяем, не находится ли заказ уже в active (защита от дублирования)
+			isActive, _ := kc.redisUtil.SIsMember(rediskeys.OrdersActiveKey, order.ID)
+			if isActive {
+				// Заказ уже в active - удаляем его оттуда и добавляем в pending
+				kc.redisUtil.SRem(rediskeys.OrdersActiveKey, order.ID)
+				log.Printf("🔄 Заказ %s перемещен из active в pending_slots (будет показан: %s UTC)", 
+					order.ID, order.VisibleAt.Format("15:04:05"))
+			}
+			
+			// Добавляем в список ожидающих заказов (не в активные!)
+			err = kc.redisUtil.SAdd(rediskeys.OrdersPendingSlotsKey, order.ID)
+			if err != nil {
+				log.Printf("⚠️ Ошибка добавления заказа %s в pending_slots: %v", order.ID, err)
+			} else {
+				log.Printf("📅 [req=%s] Заказ %s добавлен в erp:orders:pending_slots (будет показан: %s UTC)", 
+					requestID, order.ID, order.VisibleAt.Format("15:04:05"))
+			}
+		} else {
+			// Если нет VisibleAt, добавляем сразу в активные (старая логика для обратной совместимости)
+			// Но сначала проверяем, не находится ли заказ уже в pending_slots
+			isPending, _ := kc.redisUtil.SIsMember(rediskeys.OrdersPendingSlotsKey, order.ID)
+			if isPending {
+				// Заказ уже в pending - не добавляем в active
+				log.Printf("ℹ️ Заказ %s уже в pending_slots, пропускаем добавление в active", order.ID)
+			} else {
+				err = kc.redisUtil.SAdd(rediskeys.OrdersActiveKey, order.ID)
 				if err != nil {
-					continue
-				}
-				GlobalHub.BroadcastMessage(orderJSON)
-				
-				// Отправляем в ERP систему для real-time обновлений
-				BroadcastERPUpdate("new_order", map[string]interface{}{
-					"order_id": order.ID,
-					"display_id": order.DisplayID,
-					"message": "Новый заказ получен",
-				})
-				
-				// Логируем только раз в 5 секунд для прогресса
-				processed := atomic.AddInt64(&kc.processed, 1)
-				now := time.Now().Unix()
-				if now-kc.lastLog >= 5 {
-					atomic.StoreInt64(&kc.lastLog, now)
-					log.Printf("📊 Kafka WS Consumer: обработано %d заказов", processed)
+					log.Printf("⚠️ Ошибка добавления заказа %s в активные: %v", order.ID, err)
+				} else {
+					log.Printf("✅ [req=%s] Заказ %s добавлен в erp:orders:active", requestID, order.ID)
 				}
 			}
 		}
-	}()
+		
+		// 3. Сохраняем заказ в PostgreSQL (асинхронно, не блокируем обработку)
+		if kc.orderService != nil {
+			go func(orderToSave models.PizzaOrder) {
+				if err := kc.orderService.SaveOrder(orderToSave); err != nil {
+					log.Printf("⚠️ [req=%s] Kafka Consumer: ошибка сохранения заказа %s в PostgreSQL: %v", requestID, orderToSave.ID, err)
+				} else {
+					log.Printf("✅ [req=%s] Kafka Consumer: заказ %s сохранен в PostgreSQL", requestID, orderToSave.ID)
+				}
+			}(order)
+		}
+		
+		// 4. Инкремент счетчиков для статистики
+		kc.redisUtil.Increment(rediskeys.OrdersTotalKey)
+		kc.redisUtil.Increment(rediskeys.OrdersPendingKey)
+		
+		// НЕ добавляем в очередь воркеров - обработка только вручную через ERP
+		
+		// Запоминаем заказ как обработанный до commit offset
+		// (offset коммитит runKafkaOrderWorkers после возврата из handleOrder)
+		kc.markOrderProcessed(order.ID)
+	}
+	
+	// 5. Отправляем заказ в WebSocket
+	// Отправляем на планшеты поваров (поля заказа фильтруются по роли соединения)
+	BroadcastOrder(order)
+	
+	// Отправляем в ERP систему для real-time обновлений
+	BroadcastERPUpdateWithRequestID("new_order", map[string]interface{}{
+		"order_id": order.ID,
+		"display_id": order.DisplayID,
+		"message": "Новый заказ получен",
+	}, requestID)
+	
+	// Логируем только раз в 5 секунд для прогресса
+	processed := atomic.AddInt64(&kc.processed, 1)
+	now := time.Now().Unix()
+	if now-atomic.LoadInt64(&kc.lastLog) >= 5 {
+		atomic.StoreInt64(&kc.lastLog, now)
+		log.Printf("📊 Kafka WS Consumer: обработано %d заказов", processed)
+	}
+}
+
+// processedKey - ключ множества обработанных заказов топика для consumer group
+// Sorted set (score = время обработки), чтобы удалять записи старше processedOrdersTTL.
+// Группа входит в ключ: окружения с общим Redis не должны пропускать заказы друг друга как обработанные
+func (kc *KafkaWSConsumer) processedKey() string {
+	return fmt.Sprintf("kafka:processed:%s:%s", kc.groupID, kc.topic)
+}
+
+// isOrderProcessed проверяет, обрабатывался ли заказ этим consumer
+func (kc *KafkaWSConsumer) isOrderProcessed(orderID string) bool {
+	client := kc.redisUtil.GetClient()
+	if client == nil {
+		return false
+	}
+	_, err := client.ZScore(kc.redisUtil.Context(), kc.processedKey(), orderID).Result()
+	return err == nil
+}
+
+// markOrderProcessed отмечает заказ как обработанный и удаляет записи старше окна архива
+func (kc *KafkaWSConsumer) markOrderProcessed(orderID string) {
+	client := kc.redisUtil.GetClient()
+	if client == nil || orderID == "" {
+		return
+	}
+	ctx := kc.redisUtil.Context()
+	key := kc.processedKey()
+	now := time.Now()
+
+	pipe := client.Pipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Unix()), Member: orderID})
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.Add(-processedOrdersTTL).Unix(), 10))
+	pipe.Expire(ctx, key, processedOrdersTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ Kafka Consumer: ошибка сохранения обработанного заказа %s: %v", orderID, err)
+	}
 }
 
 // Stop останавливает Kafka Consumer
@@ -314,3 +378,23 @@ func (kc *KafkaWSConsumer) Stop() {
 	log.Println("🛑 Kafka WS Consumer остановлен")
 }
 
+// currentOrderStatus возвращает текущий статус заказа из Redis (Protobuf или JSON)
+// Пустая строка - заказа в Redis нет или его не удалось распарсить
+func (kc *KafkaWSConsumer) currentOrderStatus(orderID string) string {
+	orderBytes, err := kc.redisUtil.GetBytes(rediskeys.OrderKey(orderID))
+	if err != nil || len(orderBytes) == 0 {
+		return ""
+	}
+
+	var existing models.PizzaOrder
+	if err := json.Unmarshal(orderBytes, &existing); err == nil {
+		return existing.Status
+	}
+
+	pbOrder := &pb.PizzaOrder{}
+	if err := proto.Unmarshal(orderBytes, pbOrder); err == nil {
+		return pbOrder.Status
+	}
+
+	return ""
+}
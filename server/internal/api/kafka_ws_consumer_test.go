@@ -0,0 +1,47 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestKafkaProcessedOrders(t *testing.T) {
+	redisUtil := newTestRedis(t)
+	kc := &KafkaWSConsumer{redisUtil: redisUtil, topic: "pizza-orders"}
+
+	if kc.isOrderProcessed("order-1") {
+		t.Fatal("новый заказ считается обработанным")
+	}
+	kc.markOrderProcessed("order-1")
+	if !kc.isOrderProcessed("order-1") {
+		t.Error("заказ после markOrderProcessed не считается обработанным")
+	}
+
+	// Отметки другого топика не пересекаются
+	other := &KafkaWSConsumer{redisUtil: redisUtil, topic: "other-orders"}
+	if other.isOrderProcessed("order-1") {
+		t.Error("заказ считается обработанным в другом топике")
+	}
+
+	// Записи старше окна удаляются при следующей отметке
+	client := redisUtil.GetClient()
+	ctx := redisUtil.Context()
+	stale := time.Now().Add(-processedOrdersTTL - time.Hour)
+	if err := client.ZAdd(ctx, kc.processedKey(), redis.Z{Score: float64(stale.Unix()), Member: "order-old"}).Err(); err != nil {
+		t.Fatalf("ZAdd: %v", err)
+	}
+	kc.markOrderProcessed("order-2")
+	if kc.isOrderProcessed("order-old") {
+		t.Error("заказ старше processedOrdersTTL не удален из множества")
+	}
+	if !kc.isOrderProcessed("order-1") || !kc.isOrderProcessed("order-2") {
+		t.Error("свежие отметки удалены вместе со старыми")
+	}
+
+	ttl, err := client.TTL(ctx, kc.processedKey()).Result()
+	if err != nil || ttl <= 0 || ttl > processedOrdersTTL {
+		t.Errorf("TTL множества = %v (%v), want (0, %s]", ttl, err, processedOrdersTTL)
+	}
+}
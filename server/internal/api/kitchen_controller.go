@@ -100,11 +100,9 @@ func (kc *KitchenController) StartWorkers(c *gin.Context) {
 		return
 	}
 
-	// Останавливаем всех перед запуском новых
-	kc.workerPool.StopAll()
-	
-	// Запускаем новое количество
-	kc.workerPool.SetWorkerCount(req.Count)
+	// Останавливаем всех и запускаем новое количество одной операцией,
+	// чтобы параллельный запрос из другой вкладки не вклинился между ними
+	kc.workerPool.RestartWorkers(req.Count)
 	
 	c.JSON(http.StatusOK, gin.H{
 		"message": "workers started",
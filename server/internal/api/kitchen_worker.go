@@ -2,8 +2,8 @@ package api
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,6 +13,7 @@ import (
 	"zephyrvpn/server/internal/models"
 	"zephyrvpn/server/internal/pb"
 	"zephyrvpn/server/internal/utils"
+	"zephyrvpn/server/internal/utils/rediskeys"
 )
 
 // KitchenWorkerPool управляет воркерами-поварами
@@ -34,6 +35,25 @@ type Worker struct {
 	CurrentOrder *models.PizzaOrder
 	CookedCount int64
 	stopChan   chan struct{}
+	done       chan struct{} // Закрывается, когда горутина воркера завершилась
+	orderMu    sync.Mutex    // Защищает CurrentOrder (пишет воркер, читает GetStats)
+}
+
+// setCurrentOrder обновляет текущий заказ воркера
+func (w *Worker) setCurrentOrder(order *models.PizzaOrder) {
+	w.orderMu.Lock()
+	w.CurrentOrder = order
+	w.orderMu.Unlock()
+}
+
+// currentOrderID возвращает ID текущего заказа воркера ("" если повар свободен)
+func (w *Worker) currentOrderID() string {
+	w.orderMu.Lock()
+	defer w.orderMu.Unlock()
+	if w.CurrentOrder == nil {
+		return ""
+	}
+	return w.CurrentOrder.ID
 }
 
 // NewKitchenWorkerPool создает новый пул воркеров
@@ -41,7 +61,7 @@ func NewKitchenWorkerPool(redisUtil *utils.RedisClient) *KitchenWorkerPool {
 	return &KitchenWorkerPool{
 		redisUtil: redisUtil,
 		workers:   make(map[int]*Worker),
-		queueName: "erp:orders:list",
+		queueName: rediskeys.OrdersQueueKey,
 		stopChan:  make(chan struct{}),
 	}
 }
@@ -60,6 +80,7 @@ func (kwp *KitchenWorkerPool) startWorkerUnlocked() int {
 		ID:       id,
 		IsActive: true,
 		stopChan: make(chan struct{}),
+		done:     make(chan struct{}),
 	}
 	kwp.workers[id] = worker
 
@@ -71,18 +92,25 @@ func (kwp *KitchenWorkerPool) startWorkerUnlocked() int {
 	return id
 }
 
-// StopWorker останавливает воркера по ID (публичный метод с блокировкой)
+// StopWorker останавливает воркера по ID и дожидается завершения его горутины (публичный метод с блокировкой)
 func (kwp *KitchenWorkerPool) StopWorker(workerID int) bool {
 	kwp.mu.Lock()
-	defer kwp.mu.Unlock()
-	return kwp.stopWorkerUnlocked(workerID)
+	done, stopped := kwp.stopWorkerUnlocked(workerID)
+	kwp.mu.Unlock()
+
+	if stopped {
+		// Ждем вне мьютекса: воркер может дописывать статус заказа или ждать BRPOP до 2 секунд
+		<-done
+	}
+	return stopped
 }
 
 // stopWorkerUnlocked внутренний метод без блокировки мьютекса
-func (kwp *KitchenWorkerPool) stopWorkerUnlocked(workerID int) bool {
+// Убирает воркера из пула и сигнализирует ему остановиться; возвращает канал завершения горутины
+func (kwp *KitchenWorkerPool) stopWorkerUnlocked(workerID int) (<-chan struct{}, bool) {
 	worker, exists := kwp.workers[workerID]
 	if !exists || !worker.IsActive {
-		return false
+		return nil, false
 	}
 
 	close(worker.stopChan)
@@ -90,14 +118,22 @@ func (kwp *KitchenWorkerPool) stopWorkerUnlocked(workerID int) bool {
 	delete(kwp.workers, workerID)
 	atomic.AddInt64(&kwp.activeCount, -1)
 	log.Printf("👨‍🍳 Повар #%d закончил работу", workerID)
-	return true
+	return worker.done, true
+}
+
+// waitWorkers дожидается завершения горутин остановленных воркеров (вызывается без мьютекса)
+func waitWorkers(done []<-chan struct{}) {
+	for _, ch := range done {
+		<-ch
+	}
 }
 
 // workerLoop основной цикл воркера - блокирующее получение заказов через BRPOP
 // Остановка реализована через select и канал stopChan
 // BRPOP с таймаутом 2 секунды - воркер периодически "просыпается" и проверяет stopChan
 func (kwp *KitchenWorkerPool) workerLoop(worker *Worker) {
-	
+	defer close(worker.done)
+
 	for {
 		// Проверяем stopChan перед ожиданием заказа
 		select {
@@ -123,6 +159,10 @@ func (kwp *KitchenWorkerPool) workerLoop(worker *Worker) {
 		// Ждем либо результат BRPOP, либо сигнал остановки
 		select {
 		case <-worker.stopChan:
+			// Дожидаемся BRPOP, чтобы не оставлять горутину и не потерять уже снятый из очереди заказ
+			if result := <-resultChan; result.err == nil && result.orderID != "" {
+				kwp.redisUtil.LPush(kwp.queueName, result.orderID)
+			}
 			return
 		case result := <-resultChan:
 			if result.err != nil {
@@ -135,13 +175,16 @@ func (kwp *KitchenWorkerPool) workerLoop(worker *Worker) {
 				// Реальная ошибка Redis - логируем и продолжаем
 				log.Printf("⚠️ Повар #%d: ошибка BRPop из очереди %s: %v", worker.ID, kwp.queueName, result.err)
 				// Небольшая задержка перед повтором, чтобы не спамить логи
+				if !kwp.sleepWithStopCheck(time.Second, worker.stopChan) {
+					return
+				}
 				continue
 			}
 
 			orderID := result.orderID
 
 			// Получаем заказ из Redis (поддержка Protobuf и JSON)
-			orderKey := fmt.Sprintf("erp:order:%s", orderID)
+			orderKey := rediskeys.OrderKey(orderID)
 			orderBytes, err := kwp.redisUtil.GetBytes(orderKey)
 			if err != nil {
 				log.Printf("❌ Повар #%d: не удалось получить заказ %s: %v", worker.ID, orderID, err)
@@ -163,6 +206,8 @@ func (kwp *KitchenWorkerPool) workerLoop(worker *Worker) {
 					DeliveryAddress:   pbOrder.DeliveryAddress,
 					IsPickup:          pbOrder.IsPickup,
 					PickupLocationID:  pbOrder.PickupLocationId,
+					Channel:           pbOrder.Channel,
+					PrepSeconds:       int(pbOrder.PrepSeconds),
 					TotalPrice:        int(pbOrder.TotalPrice),
 					CreatedAt:         time.Unix(0, pbOrder.CreatedAt),
 					Status:            pbOrder.Status,
@@ -177,6 +222,8 @@ func (kwp *KitchenWorkerPool) workerLoop(worker *Worker) {
 						Extras:      pbItem.Extras,
 						Quantity:    int(pbItem.Quantity),
 						Price:       int(pbItem.Price),
+						DiscountAmount:  int(pbItem.DiscountAmount),
+						DiscountPercent: int(pbItem.DiscountPercent),
 					}
 					// Конвертируем дозировки из protobuf (map[string]int32 -> map[string]int)
 					if pbItem.IngredientAmounts != nil && len(pbItem.IngredientAmounts) > 0 {
@@ -210,14 +257,20 @@ func (kwp *KitchenWorkerPool) workerLoop(worker *Worker) {
 			default:
 			}
 
-			// Обновляем статус заказа
-			worker.CurrentOrder = &order
-			order.Status = "preparing"
+			// Обновляем статус заказа (pending -> accepted -> cooking через State Machine)
+			if order.Status == string(models.OrderStatusPending) || order.Status == "" {
+				order.Status = string(models.OrderStatusAccepted)
+			}
+			if !order.CanTransitionTo(models.OrderStatusCooking) {
+				log.Printf("⚠️ Повар #%d: заказ %s в статусе '%s' нельзя взять в готовку, пропускаем", worker.ID, orderID, order.Status)
+				continue
+			}
+			worker.setCurrentOrder(&order)
+			order.Status = string(models.OrderStatusCooking)
 			kwp.updateOrderStatus(&order)
 			
 			// Отправляем заказ на планшеты поваров через WebSocket
-			orderJSON, _ := json.Marshal(order)
-			GlobalHub.BroadcastMessage(orderJSON)
+			BroadcastOrder(order)
 
 
 			// "Готовим" пиццу (симуляция времени готовки)
@@ -226,23 +279,21 @@ func (kwp *KitchenWorkerPool) workerLoop(worker *Worker) {
 			if !kwp.sleepWithStopCheck(cookingTime, worker.stopChan) {
 				// Получен сигнал остановки во время готовки
 				log.Printf("🛑 Повар #%d получил сигнал остановки во время готовки заказа %s", worker.ID, orderID)
-				order.Status = "pending" // Возвращаем в pending
+				order.Status = string(models.OrderStatusAccepted) // Возвращаем в очередь (cooking -> accepted)
 				kwp.updateOrderStatus(&order)
 				// Возвращаем заказ в очередь
 				kwp.redisUtil.LPush(kwp.queueName, orderID)
-				worker.CurrentOrder = nil
+				worker.setCurrentOrder(nil)
 				return
 			}
 
 			// Заказ готов
-			order.Status = "ready"
+			order.Status = string(models.OrderStatusReady)
 			kwp.updateOrderStatus(&order)
 			atomic.AddInt64(&worker.CookedCount, 1)
 			atomic.AddInt64(&kwp.totalCooked, 1)
 
-			worker.CurrentOrder = nil
-
-
+			worker.setCurrentOrder(nil)
 		}
 	}
 }
@@ -294,30 +345,54 @@ func (kwp *KitchenWorkerPool) updateOrderStatus(order *models.PizzaOrder) {
 		return
 	}
 	
+	recordOrderStatus(kwp.redisUtil, order.ID, order.Status, "kitchen_worker")
+
 	// 1. Сохраняем в ОБА ключа (для надежности и для ERP)
 	orderJSON, _ := json.Marshal(order)
-	kwp.redisUtil.Set(fmt.Sprintf("order:%s", order.ID), string(orderJSON), 24*time.Hour)
-	kwp.redisUtil.Set(fmt.Sprintf("erp:order:%s", order.ID), string(orderJSON), 24*time.Hour)
+	kwp.redisUtil.Set(rediskeys.LegacyOrderKey(order.ID), string(orderJSON), rediskeys.OrderTTL())
+	kwp.redisUtil.Set(rediskeys.OrderKey(order.ID), string(orderJSON), rediskeys.OrderTTL())
 
 	// 2. Если статус стал "ready", отмечаем в статистике ERP и удаляем из Redis
-	if order.Status == "ready" {
+	if order.Status == string(models.OrderStatusReady) {
 		kwp.redisUtil.SAdd("erp:processed:set", order.ID)
-		kwp.redisUtil.Decrement("erp:orders:pending")
-		kwp.redisUtil.Increment("erp:orders:processed")
+		kwp.redisUtil.Decrement(rediskeys.OrdersPendingKey)
+		kwp.redisUtil.Increment(rediskeys.OrdersProcessedKey)
 		
 		// Удаляем заказ из Redis после обработки (источник истины - Kafka)
-		kwp.redisUtil.Delete(fmt.Sprintf("erp:order:%s", order.ID))
-		kwp.redisUtil.Delete(fmt.Sprintf("order:%s", order.ID))
-		kwp.redisUtil.SRem("erp:orders:active", order.ID)
+		kwp.redisUtil.Delete(rediskeys.OrderKey(order.ID))
+		kwp.redisUtil.Delete(rediskeys.LegacyOrderKey(order.ID))
+		kwp.redisUtil.SRem(rediskeys.OrdersActiveKey, order.ID)
 	}
 }
 
 // SetWorkerCount устанавливает количество активных воркеров
+// Лишние воркеры останавливаются (начиная с последних запущенных), метод дожидается их завершения
 func (kwp *KitchenWorkerPool) SetWorkerCount(count int) {
 	kwp.mu.Lock()
-	defer kwp.mu.Unlock()
+	done := kwp.setWorkerCountUnlocked(count)
+	kwp.mu.Unlock()
+
+	waitWorkers(done)
+}
+
+// RestartWorkers останавливает всех воркеров и запускает count новых одной операцией
+func (kwp *KitchenWorkerPool) RestartWorkers(count int) {
+	kwp.mu.Lock()
+	done := kwp.setWorkerCountUnlocked(0)
+	kwp.setWorkerCountUnlocked(count)
+	kwp.mu.Unlock()
 
+	waitWorkers(done)
+}
+
+// setWorkerCountUnlocked приводит число воркеров к count (вызывается под mu)
+// Возвращает каналы завершения остановленных воркеров
+func (kwp *KitchenWorkerPool) setWorkerCountUnlocked(count int) []<-chan struct{} {
+	if count < 0 {
+		count = 0
+	}
 	currentCount := len(kwp.workers)
+	done := make([]<-chan struct{}, 0)
 
 	if count > currentCount {
 		// Добавляем воркеров (используем внутренний метод без блокировки)
@@ -325,17 +400,19 @@ func (kwp *KitchenWorkerPool) SetWorkerCount(count int) {
 			kwp.startWorkerUnlocked()
 		}
 	} else if count < currentCount {
-		// Удаляем воркеров (останавливаем последних, используем внутренний метод)
-		stopped := 0
+		// Удаляем воркеров: останавливаем последних запущенных
+		ids := make([]int, 0, currentCount)
 		for id := range kwp.workers {
-			if stopped >= currentCount-count {
-				break
-			}
-			if kwp.stopWorkerUnlocked(id) {
-				stopped++
+			ids = append(ids, id)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+		for _, id := range ids[:currentCount-count] {
+			if ch, ok := kwp.stopWorkerUnlocked(id); ok {
+				done = append(done, ch)
 			}
 		}
 	}
+	return done
 }
 
 // GetStats возвращает статистику воркеров
@@ -345,10 +422,7 @@ func (kwp *KitchenWorkerPool) GetStats() map[string]interface{} {
 
 	workersInfo := make([]map[string]interface{}, 0)
 	for _, worker := range kwp.workers {
-		var currentOrderID string
-		if worker.CurrentOrder != nil {
-			currentOrderID = worker.CurrentOrder.ID
-		}
+		currentOrderID := worker.currentOrderID()
 		workersInfo = append(workersInfo, map[string]interface{}{
 			"id":           worker.ID,
 			"is_active":    worker.IsActive,
@@ -370,13 +444,12 @@ func (kwp *KitchenWorkerPool) GetStats() map[string]interface{} {
 	}
 }
 
-// StopAll останавливает всех воркеров
+// StopAll останавливает всех воркеров и дожидается завершения их горутин
 func (kwp *KitchenWorkerPool) StopAll() {
 	kwp.mu.Lock()
-	defer kwp.mu.Unlock()
+	done := kwp.setWorkerCountUnlocked(0)
+	kwp.mu.Unlock()
 
-	for id := range kwp.workers {
-		kwp.stopWorkerUnlocked(id)
-	}
+	waitWorkers(done)
 }
 
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"zephyrvpn/server/internal/utils"
+)
+
+// newUnreachableRedis - клиент Redis на закрытом порту: BRPOP сразу возвращает ошибку соединения
+func newUnreachableRedis(t *testing.T) *utils.RedisClient {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return utils.NewRedisClient(client)
+}
+
+func TestKitchenWorkerPoolConcurrentAddRemove(t *testing.T) {
+	// Запускается с -race: изменения пула параллельно с GetStats
+	pool := NewKitchenWorkerPool(newUnreachableRedis(t))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			pool.StopWorker(pool.StartWorker())
+		}()
+		go func(count int) {
+			defer wg.Done()
+			pool.SetWorkerCount(count)
+		}(i % 4)
+		go func() {
+			defer wg.Done()
+			pool.StartWorker()
+		}()
+		go func() {
+			defer wg.Done()
+			pool.GetStats()
+		}()
+	}
+	wg.Wait()
+
+	pool.SetWorkerCount(3)
+	stats := pool.GetStats()
+	if got := stats["active_workers"].(int64); got != 3 {
+		t.Errorf("active_workers = %d, want 3", got)
+	}
+	if got := len(stats["workers"].([]map[string]interface{})); got != 3 {
+		t.Errorf("воркеров в статистике %d, want 3", got)
+	}
+
+	pool.RestartWorkers(2)
+	if got := pool.GetStats()["active_workers"].(int64); got != 2 {
+		t.Errorf("после RestartWorkers(2) active_workers = %d, want 2", got)
+	}
+
+	if got := kitchenWorkerGoroutines(); got < 2 {
+		t.Errorf("горутин пула при 2 воркерах: %d, want >= 2", got)
+	}
+
+	pool.StopAll()
+	if got := pool.GetStats()["active_workers"].(int64); got != 0 {
+		t.Errorf("после StopAll active_workers = %d, want 0", got)
+	}
+
+	// StopAll дожидается воркеров и их BRPOP: горутины пула не остаются висеть
+	// (фоновые горутины переподключения go-redis к пулу не относятся и не считаются)
+	if got := kitchenWorkerGoroutines(); got != 0 {
+		t.Errorf("после StopAll осталось горутин пула: %d", got)
+	}
+}
+
+// kitchenWorkerGoroutines считает горутины, в стеке которых есть методы KitchenWorkerPool
+func kitchenWorkerGoroutines() int {
+	buf := make([]byte, 1<<20)
+	stacks := strings.Split(string(buf[:runtime.Stack(buf, true)]), "\n\n")
+	count := 0
+	for _, stack := range stacks {
+		if strings.Contains(stack, "(*KitchenWorkerPool).") && !strings.Contains(stack, "kitchenWorkerGoroutines") {
+			count++
+		}
+	}
+	return count
+}
+
+func TestKitchenWorkerPoolStopUnknownWorker(t *testing.T) {
+	pool := NewKitchenWorkerPool(newUnreachableRedis(t))
+	if pool.StopWorker(42) {
+		t.Error("StopWorker несуществующего воркера вернул true")
+	}
+	id := pool.StartWorker()
+	if !pool.StopWorker(id) {
+		t.Fatal("StopWorker запущенного воркера вернул false")
+	}
+	if pool.StopWorker(id) {
+		t.Error("повторный StopWorker вернул true")
+	}
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errBranchIDRequired       = errors.New("branch_id обязателен для проверки остатков")
+	errMenuServiceUnavailable = errors.New("сервис меню недоступен (нет подключения к БД)")
+)
+
+// MenuController отдает меню витрины (пиццы, допы, наборы) и его доступность по остаткам
+type MenuController struct {
+	menuService *services.MenuService // Может быть nil (без БД меню статическое, доступность недоступна)
+}
+
+// NewMenuController создает контроллер меню
+func NewMenuController(menuService *services.MenuService) *MenuController {
+	return &MenuController{menuService: menuService}
+}
+
+// GetMenu возвращает меню (с branch_id - с настройками филиала); с check_stock=true добавляет доступность позиций по остаткам филиала
+// GET /api/v1/menu?check_stock=true&branch_id=xxx
+func (mc *MenuController) GetMenu(c *gin.Context) {
+	menu, ok := mc.branchMenu(c)
+	if !ok {
+		return
+	}
+	response := gin.H{
+		"pizzas": menu.Pizzas,
+		"extras": menu.Extras,
+		"sets":   menu.Sets,
+	}
+
+	if c.Query("check_stock") == "true" {
+		availability, status, err := mc.availability(c.Query("branch_id"))
+		if err != nil {
+			c.JSON(status, gin.H{
+				"error":   "Ошибка проверки доступности меню",
+				"details": err.Error(),
+			})
+			return
+		}
+		response["availability"] = availability
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetMenuAvailability возвращает доступность пицц и наборов по остаткам филиала
+// и ингредиент, который ограничивает выпуск (результат кэшируется на 30 секунд)
+// GET /api/v1/menu/availability?branch_id=xxx
+func (mc *MenuController) GetMenuAvailability(c *gin.Context) {
+	availability, status, err := mc.availability(c.Query("branch_id"))
+	if err != nil {
+		c.JSON(status, gin.H{
+			"error":   "Ошибка проверки доступности меню",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, availability)
+}
+
+// availability считает доступность меню и HTTP статус ошибки
+func (mc *MenuController) availability(branchID string) (*services.MenuAvailability, int, error) {
+	if branchID == "" {
+		return nil, http.StatusBadRequest, errBranchIDRequired
+	}
+	if mc.menuService == nil {
+		return nil, http.StatusServiceUnavailable, errMenuServiceUnavailable
+	}
+	availability, err := mc.menuService.GetMenuAvailability(branchID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return availability, http.StatusOK, nil
+}
+
+// GetPizzas возвращает пиццы меню (с branch_id - без скрытых в филиале и с ценами филиала)
+// GET /api/v1/menu/pizzas?branch_id=xxx
+func (mc *MenuController) GetPizzas(c *gin.Context) {
+	if menu, ok := mc.branchMenu(c); ok {
+		c.JSON(http.StatusOK, gin.H{"pizzas": menu.Pizzas})
+	}
+}
+
+// GetExtras возвращает допы меню (с branch_id - с настройками филиала)
+// GET /api/v1/menu/extras?branch_id=xxx
+func (mc *MenuController) GetExtras(c *gin.Context) {
+	if menu, ok := mc.branchMenu(c); ok {
+		c.JSON(http.StatusOK, gin.H{"extras": menu.Extras})
+	}
+}
+
+// GetSets возвращает наборы меню (с branch_id - с настройками филиала)
+// GET /api/v1/menu/sets?branch_id=xxx
+func (mc *MenuController) GetSets(c *gin.Context) {
+	if menu, ok := mc.branchMenu(c); ok {
+		c.JSON(http.StatusOK, gin.H{"sets": menu.Sets})
+	}
+}
+
+// branchMenu возвращает меню для ?branch_id= (без параметра или без БД - общее меню)
+// При ошибке сам отвечает клиенту и возвращает false
+func (mc *MenuController) branchMenu(c *gin.Context) (*services.BranchMenu, bool) {
+	branchID := c.Query("branch_id")
+	if branchID == "" || mc.menuService == nil {
+		return services.GlobalMenu(), true
+	}
+	menu, err := mc.menuService.GetBranchMenu(branchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка загрузки меню филиала",
+			"details": err.Error(),
+		})
+		return nil, false
+	}
+	return menu, true
+}
+
+// GetMenuOverrides возвращает настройки меню филиала (скрытые позиции и цены)
+// GET /api/v1/menu/overrides?branch_id=xxx
+func (mc *MenuController) GetMenuOverrides(c *gin.Context) {
+	branchID := c.Query("branch_id")
+	if branchID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "branch_id обязателен"})
+		return
+	}
+	if mc.menuService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": errMenuServiceUnavailable.Error()})
+		return
+	}
+	overrides, err := mc.menuService.GetBranchMenuOverrides(branchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка загрузки меню филиала",
+			"details": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"overrides": overrides})
+}
+
+// SetMenuOverrideRequest - настройка позиции меню в филиале
+type SetMenuOverrideRequest struct {
+	BranchID      string `json:"branch_id" binding:"required"`
+	ItemName      string `json:"item_name" binding:"required"`
+	Available     *bool  `json:"available"`      // По умолчанию true
+	PriceOverride *int   `json:"price_override"` // nil - общая цена
+}
+
+// SetMenuOverride скрывает позицию в филиале или задает ей цену филиала
+// PUT /api/v1/menu/overrides
+func (mc *MenuController) SetMenuOverride(c *gin.Context) {
+	var req SetMenuOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверный формат запроса",
+			"details": err.Error(),
+		})
+		return
+	}
+	if mc.menuService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": errMenuServiceUnavailable.Error()})
+		return
+	}
+
+	override := models.BranchMenuOverride{
+		BranchID:      req.BranchID,
+		ItemName:      req.ItemName,
+		Available:     req.Available == nil || *req.Available,
+		PriceOverride: req.PriceOverride,
+	}
+	if err := mc.menuService.SetBranchMenuOverride(&override); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidMenuOverride) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"error":   "Ошибка сохранения меню филиала",
+			"details": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, override)
+}
+
+// DeleteMenuOverride удаляет настройку: позиция снова доступна в филиале по общей цене
+// DELETE /api/v1/menu/overrides/:id
+func (mc *MenuController) DeleteMenuOverride(c *gin.Context) {
+	if mc.menuService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": errMenuServiceUnavailable.Error()})
+		return
+	}
+	if err := mc.menuService.DeleteBranchMenuOverride(c.Param("id")); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"error":   "Ошибка удаления настройки меню филиала",
+			"details": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Настройка меню филиала удалена"})
+}
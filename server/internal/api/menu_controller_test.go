@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// menuRouter - маршруты меню без сервиса меню (без БД доступность по остаткам не считается)
+func menuRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	mc := NewMenuController(nil)
+	router := gin.New()
+	router.GET("/menu", mc.GetMenu)
+	router.GET("/menu/availability", mc.GetMenuAvailability)
+	return router
+}
+
+func TestMenuAvailabilityRequiresBranchAndService(t *testing.T) {
+	useTestMenu(t)
+	router := menuRouter()
+
+	cases := []struct {
+		url  string
+		want int
+	}{
+		{"/menu", http.StatusOK},
+		{"/menu?check_stock=true", http.StatusBadRequest},
+		{"/menu?check_stock=true&branch_id=branch-1", http.StatusServiceUnavailable},
+		{"/menu/availability", http.StatusBadRequest},
+		{"/menu/availability?branch_id=branch-1", http.StatusServiceUnavailable},
+	}
+	for _, tc := range cases {
+		code, payload := degradedResponse(t, router, http.MethodGet, tc.url, "")
+		if code != tc.want {
+			t.Errorf("GET %s: статус %d, want %d (%v)", tc.url, code, tc.want, payload)
+		}
+	}
+
+	_, payload := degradedResponse(t, router, http.MethodGet, "/menu", "")
+	if _, ok := payload["availability"]; ok {
+		t.Error("меню без check_stock не должно содержать доступность")
+	}
+	if pizzas, _ := payload["pizzas"].(map[string]interface{}); len(pizzas) != 2 || pizzas["Маргарита"] == nil {
+		t.Errorf("пиццы меню %v, want 2 тестовые", payload["pizzas"])
+	}
+}
@@ -2,13 +2,18 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"mime/multipart"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 	"zephyrvpn/server/internal/models"
 	"zephyrvpn/server/internal/services"
 )
@@ -101,8 +106,62 @@ func (nc *NomenclatureController) SuggestSKU(c *gin.Context) {
 	})
 }
 
+// SuggestSKUBatch предлагает SKU сразу для всех строк импорта без SKU
+// POST /api/v1/inventory/nomenclature/suggest-sku-batch
+// Body: {"branch_id": "xxx", "items": [{"name": "Томат", "category": "Овощи"}, ...]}
+// SKU в ответе уникальны и между собой, и относительно существующих товаров
+func (nc *NomenclatureController) SuggestSKUBatch(c *gin.Context) {
+	if nc.pluService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "PLU сервис недоступен",
+		})
+		return
+	}
+
+	var req struct {
+		BranchID string                          `json:"branch_id"`
+		Items    []services.SKUSuggestionRequest `json:"items" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверный формат запроса",
+			"details": err.Error(),
+		})
+		return
+	}
+	if len(req.Items) > services.MaxSKUSuggestionBatch {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error": fmt.Sprintf("Слишком много строк, максимум %d", services.MaxSKUSuggestionBatch),
+		})
+		return
+	}
+
+	suggestions, err := nc.pluService.SuggestSKUBatch(req.Items, req.BranchID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Ошибка генерации SKU",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  suggestions,
+		"count": len(suggestions),
+	})
+}
+
 // GetNomenclatureItems получает список всех товаров номенклатуры
-// GET /api/v1/inventory/nomenclature
+// GET /api/v1/inventory/nomenclature?include_deleted=true
+//
+// @Summary      Список номенклатуры
+// @Tags         nomenclature
+// @Produce      json
+// @Param        include_deleted  query  bool  false  "Включать удаленные товары"  default(false)
+// @Success      200  {object}  NomenclatureItemsResponse
+// @Failure      500  {object}  ErrorResponse
+// @Failure      503  {object}  ErrorResponse
+// @Router       /inventory/nomenclature [get]
 func (nc *NomenclatureController) GetNomenclatureItems(c *gin.Context) {
 	if nc.service == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
@@ -112,7 +171,8 @@ func (nc *NomenclatureController) GetNomenclatureItems(c *gin.Context) {
 		return
 	}
 
-	items, err := nc.service.GetAllItems()
+	includeDeleted := c.Query("include_deleted") == "true"
+	items, err := nc.service.GetAllItems(includeDeleted)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Ошибка получения товаров",
@@ -129,6 +189,14 @@ func (nc *NomenclatureController) GetNomenclatureItems(c *gin.Context) {
 
 // GetNomenclatureItem получает товар по ID
 // GET /api/v1/inventory/nomenclature/:id
+//
+// @Summary      Товар номенклатуры
+// @Tags         nomenclature
+// @Produce      json
+// @Param        id   path      string  true  "ID товара"
+// @Success      200  {object}  models.NomenclatureItem
+// @Failure      404  {object}  ErrorResponse
+// @Router       /inventory/nomenclature/{id} [get]
 func (nc *NomenclatureController) GetNomenclatureItem(c *gin.Context) {
 	if nc.service == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
@@ -149,8 +217,90 @@ func (nc *NomenclatureController) GetNomenclatureItem(c *gin.Context) {
 	c.JSON(http.StatusOK, item)
 }
 
+// GetPriceHistory возвращает историю закупочных цен товара
+// GET /api/v1/inventory/nomenclature/:id/price-history?counterparty_id=&limit=
+func (nc *NomenclatureController) GetPriceHistory(c *gin.Context) {
+	if nc.service == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Сервис номенклатуры недоступен",
+		})
+		return
+	}
+
+	limit := 100
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "limit должен быть положительным числом",
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	history, err := nc.service.GetPriceHistory(c.Param("id"), c.Query("counterparty_id"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка загрузки истории цен",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"history": history,
+		"count":   len(history),
+	})
+}
+
+// BulkUpdatePrices меняет закупочную цену всех активных товаров категории на процент или фиксированную сумму
+// POST /api/v1/inventory/nomenclature/bulk-price-update
+// Body: {"category_id": "...", "percent": 10} или {"category_id": "...", "delta": 15.5}, опционально counterparty_id, branch_id, "dry_run": true
+func (nc *NomenclatureController) BulkUpdatePrices(c *gin.Context) {
+	if nc.service == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Сервис номенклатуры недоступен",
+		})
+		return
+	}
+
+	var req services.BulkPriceUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверные данные",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	changes, err := nc.service.BulkUpdateCategoryPrices(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Ошибка массового обновления цен",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run": req.DryRun,
+		"changes": changes,
+		"count":   len(changes),
+	})
+}
+
 // CreateNomenclatureItem создает новый товар
 // POST /api/v1/inventory/nomenclature
+//
+// @Summary      Создать товар номенклатуры
+// @Tags         nomenclature
+// @Accept       json
+// @Produce      json
+// @Param        request  body      models.NomenclatureItem  true  "Товар (sku и name обязательны)"
+// @Success      201      {object}  models.NomenclatureItem
+// @Failure      400      {object}  ErrorResponse
+// @Router       /inventory/nomenclature [post]
 func (nc *NomenclatureController) CreateNomenclatureItem(c *gin.Context) {
 	if nc.service == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
@@ -233,7 +383,9 @@ func (nc *NomenclatureController) UpdateNomenclatureItem(c *gin.Context) {
 }
 
 // DeleteNomenclatureItem удаляет товар
-// DELETE /api/v1/inventory/nomenclature/:id
+// DELETE /api/v1/inventory/nomenclature/:id?force=true
+// Товар из активных рецептов или с остатками на складе не удаляется: 409 со списком рецептов и партий.
+// force=true удаляет его все равно - только для администратора (проверяет RequireAdminRoleWhen в маршруте)
 func (nc *NomenclatureController) DeleteNomenclatureItem(c *gin.Context) {
 	if nc.service == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
@@ -243,16 +395,64 @@ func (nc *NomenclatureController) DeleteNomenclatureItem(c *gin.Context) {
 	}
 
 	id := c.Param("id")
-	if err := nc.service.DeleteItem(id); err != nil {
+	force := c.Query("force") == "true" && c.GetString("user_role") != ""
+	usage, err := nc.service.DeleteItemChecked(id, force)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Товар не найден",
+			})
+		case errors.Is(err, services.ErrNomenclatureInUse):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Товар используется в рецептах или есть на складе",
+				"details": err.Error(),
+				"usage":   usage,
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Ошибка удаления товара",
+				"details": err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Товар удален",
+		"forced":  usage.InUse(),
+		"usage":   usage,
+	})
+}
+
+// GetNomenclatureUsage показывает, где используется товар: активные рецепты и партии с остатком
+// GET /api/v1/inventory/nomenclature/:id/usage
+func (nc *NomenclatureController) GetNomenclatureUsage(c *gin.Context) {
+	if nc.service == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Сервис номенклатуры недоступен",
+		})
+		return
+	}
+
+	usage, err := nc.service.GetItemUsage(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Товар не найден",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Ошибка удаления товара",
+			"error":   "Ошибка поиска использования товара",
 			"details": err.Error(),
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Товар удален",
+		"usage":  usage,
+		"in_use": usage.InUse(),
 	})
 }
 
@@ -297,6 +497,58 @@ func (nc *NomenclatureController) ValidateNomenclatureImport(c *gin.Context) {
 	})
 }
 
+// ValidateNomenclatureImportReport валидирует данные импорта и возвращает XLSX с ошибками по строкам
+// POST /api/v1/inventory/nomenclature/validate-import-report
+// Тело запроса - как у validate-import. В ответе файл: исходные колонки + "Статус", "Ошибки", "Предупреждения";
+// проблемные строки подсвечены. Количество ошибок и предупреждений - в заголовках X-Import-Errors / X-Import-Warnings
+func (nc *NomenclatureController) ValidateNomenclatureImportReport(c *gin.Context) {
+	if nc.service == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Сервис номенклатуры недоступен",
+		})
+		return
+	}
+
+	var req struct {
+		Items                []map[string]interface{} `json:"items" binding:"required"`
+		FieldMapping         map[string]string        `json:"field_mapping" binding:"required"`
+		AutoCreateCategories bool                     `json:"auto_create_categories"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверные данные",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	report, validation, err := nc.service.BuildImportValidationReport(req.Items, req.FieldMapping, req.AutoCreateCategories)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка формирования отчета",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	errorCount, warningCount := 0, 0
+	for _, result := range validation {
+		switch result.Status {
+		case "error":
+			errorCount++
+		case "warning":
+			warningCount++
+		}
+	}
+
+	filename := fmt.Sprintf("import_validation_%s.xlsx", time.Now().Format("20060102_150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("X-Import-Errors", strconv.Itoa(errorCount))
+	c.Header("X-Import-Warnings", strconv.Itoa(warningCount))
+	c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", report)
+}
+
 // ImportNomenclature выполняет массовый импорт товаров
 // POST /api/v1/inventory/nomenclature/import
 func (nc *NomenclatureController) ImportNomenclature(c *gin.Context) {
@@ -334,7 +586,7 @@ func (nc *NomenclatureController) ImportNomenclature(c *gin.Context) {
 }
 
 // GetNomenclatureCategories получает список всех категорий
-// GET /api/v1/inventory/nomenclature/categories
+// GET /api/v1/inventory/nomenclature/categories?include_deleted=true
 func (nc *NomenclatureController) GetNomenclatureCategories(c *gin.Context) {
 	if nc.service == nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
@@ -344,7 +596,8 @@ func (nc *NomenclatureController) GetNomenclatureCategories(c *gin.Context) {
 		return
 	}
 
-	categories, err := nc.service.GetAllCategories()
+	includeDeleted := c.Query("include_deleted") == "true"
+	categories, err := nc.service.GetAllCategories(includeDeleted)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Ошибка получения категорий",
@@ -474,28 +727,22 @@ func (nc *NomenclatureController) UploadNomenclatureFile(c *gin.Context) {
 	}
 
 	// Получаем файл из формы
-	file, header, err := c.Request.FormFile("file")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Файл не найден в запросе",
-			"details": err.Error(),
-		})
+	file, header, ok := nc.uploadedFile(c)
+	if !ok {
 		return
 	}
 	defer file.Close()
 
-	// Определяем заголовки
-	headerRowIndex, columnNames, sampleRows, err := nc.service.DetectFileHeaders(file, header.Filename)
+	// Определяем заголовки (sheet - лист или именованный диапазон XLSX, по умолчанию определяется автоматически)
+	detected, err := nc.service.DetectFileHeaders(file, header.Filename, c.PostForm("sheet"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Ошибка определения заголовков",
-			"details": err.Error(),
-		})
+		respondUploadError(c, "Ошибка определения заголовков", err)
 		return
 	}
 
 	// Автоматически определяем маппинг полей
 	autoMapping := make(map[string]string)
+	columnNames := detected.Columns
 	for _, columnName := range columnNames {
 		columnLower := strings.ToLower(columnName)
 		
@@ -552,11 +799,14 @@ func (nc *NomenclatureController) UploadNomenclatureFile(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"header_row_index": headerRowIndex,
+		"header_row_index": detected.HeaderRowIndex,
 		"columns":          columnNames,
-		"sample_rows":      sampleRows,
+		"sample_rows":      detected.SampleRows,
 		"auto_mapping":     autoMapping,
 		"count":            len(columnNames),
+		"sheet":            detected.Sheet,
+		"sheets":           detected.Sheets,
+		"named_ranges":     detected.NamedRanges,
 	})
 }
 
@@ -571,12 +821,8 @@ func (nc *NomenclatureController) ParseNomenclatureFile(c *gin.Context) {
 	}
 
 	// Получаем файл из формы
-	file, header, err := c.Request.FormFile("file")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Файл не найден в запросе",
-			"details": err.Error(),
-		})
+	file, header, ok := nc.uploadedFile(c)
+	if !ok {
 		return
 	}
 	defer file.Close()
@@ -586,6 +832,7 @@ func (nc *NomenclatureController) ParseNomenclatureFile(c *gin.Context) {
 		ColumnMapping map[string]string `json:"column_mapping" binding:"required"`
 		Columns       []string           `json:"columns"` // Список колонок из первого этапа
 		HeaderRowIndex int               `json:"header_row_index"` // Индекс строки заголовков
+		Sheet          string            `json:"sheet"` // Лист или именованный диапазон XLSX из первого этапа
 	}
 
 	if err := c.ShouldBindJSON(&requestData); err != nil {
@@ -593,6 +840,7 @@ func (nc *NomenclatureController) ParseNomenclatureFile(c *gin.Context) {
 		mappingStr := c.PostForm("column_mapping")
 		columnsStr := c.PostForm("columns")
 		headerRowStr := c.PostForm("header_row_index")
+		requestData.Sheet = c.PostForm("sheet")
 		if mappingStr == "" {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "Не указан маппинг колонок",
@@ -622,12 +870,9 @@ func (nc *NomenclatureController) ParseNomenclatureFile(c *gin.Context) {
 	}
 
 	// Парсим файл с маппингом и известными колонками
-	rows, err := nc.service.ParseFileWithMapping(file, header.Filename, requestData.ColumnMapping, requestData.Columns, requestData.HeaderRowIndex)
+	rows, err := nc.service.ParseFileWithMapping(file, header.Filename, requestData.ColumnMapping, requestData.Columns, requestData.HeaderRowIndex, requestData.Sheet)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Ошибка парсинга файла",
-			"details": err.Error(),
-		})
+		respondUploadError(c, "Ошибка парсинга файла", err)
 		return
 	}
 
@@ -637,3 +882,107 @@ func (nc *NomenclatureController) ParseNomenclatureFile(c *gin.Context) {
 	})
 }
 
+
+// uploadFormOverheadBytes - запас на остальные поля формы и заголовки multipart сверх размера файла
+const uploadFormOverheadBytes = 1 << 20
+
+// uploadedFile достает файл импорта из формы, ограничивая тело запроса: файл больше MaxUploadSize
+// не читается целиком ни в память, ни на диск. При ошибке ответ уже отправлен (413 или 400)
+func (nc *NomenclatureController) uploadedFile(c *gin.Context) (multipart.File, *multipart.FileHeader, bool) {
+	maxBytes := nc.service.MaxUploadSize()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+uploadFormOverheadBytes)
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondUploadError(c, "Ошибка загрузки файла", fmt.Errorf("%w: больше %d МБ", services.ErrUploadTooLarge, maxBytes>>20))
+			return nil, nil, false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Файл не найден в запросе",
+			"details": err.Error(),
+		})
+		return nil, nil, false
+	}
+	if header.Size > maxBytes {
+		file.Close()
+		respondUploadError(c, "Ошибка загрузки файла", fmt.Errorf("%w: больше %d МБ", services.ErrUploadTooLarge, maxBytes>>20))
+		return nil, nil, false
+	}
+	return file, header, true
+}
+
+// respondUploadError отдает ошибку разбора файла импорта: 413 - файл слишком большой,
+// 415 - содержимое не CSV/XLSX, иначе 400
+func respondUploadError(c *gin.Context, message string, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, services.ErrUploadTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrUnsupportedUploadContent):
+		status = http.StatusUnsupportedMediaType
+	}
+	c.JSON(status, gin.H{
+		"error":   message,
+		"details": err.Error(),
+	})
+}
+
+// RestoreNomenclatureItem восстанавливает удаленный товар
+// POST /api/v1/inventory/nomenclature/:id/restore
+func (nc *NomenclatureController) RestoreNomenclatureItem(c *gin.Context) {
+	if nc.service == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Сервис номенклатуры недоступен",
+		})
+		return
+	}
+
+	item, err := nc.service.RestoreItem(c.Param("id"))
+	if err != nil {
+		respondRestoreError(c, "Товар не найден", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// RestoreNomenclatureCategory восстанавливает удаленную категорию
+// POST /api/v1/inventory/nomenclature/categories/:id/restore
+func (nc *NomenclatureController) RestoreNomenclatureCategory(c *gin.Context) {
+	if nc.service == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Сервис номенклатуры недоступен",
+		})
+		return
+	}
+
+	category, err := nc.service.RestoreCategory(c.Param("id"))
+	if err != nil {
+		respondRestoreError(c, "Категория не найдена", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// respondRestoreError отдает ошибку восстановления: 404 - записи нет, 409 - конфликт с живой записью
+func respondRestoreError(c *gin.Context, notFoundMessage string, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": notFoundMessage,
+		})
+	case errors.Is(err, services.ErrRestoreConflict):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Невозможно восстановить: конфликт с существующей записью",
+			"details": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка восстановления",
+			"details": err.Error(),
+		})
+	}
+}
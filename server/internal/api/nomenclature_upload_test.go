@@ -0,0 +1,59 @@
+package api
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"zephyrvpn/server/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadRequest собирает multipart-запрос с полем file
+func uploadRequest(t *testing.T, filename string, content []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	part.Write(content)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload-file", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func TestUploadNomenclatureFileRejectsOversizedAndMislabeledFiles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	service := services.NewNomenclatureService(nil)
+	service.SetMaxUploadSize(1 << 10)
+	controller := NewNomenclatureController(service, nil)
+	router := gin.New()
+	router.POST("/upload-file", controller.UploadNomenclatureFile)
+
+	cases := []struct {
+		name     string
+		filename string
+		content  []byte
+		want     int
+	}{
+		{"больше лимита", "price.csv", []byte(strings.Repeat("Мука;100\n", 200)), http.StatusRequestEntityTooLarge},
+		{"тело больше лимита с запасом на форму", "price.csv", bytes.Repeat([]byte("a"), 3<<20), http.StatusRequestEntityTooLarge},
+		{"бинарный файл с расширением .csv", "price.csv", []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff"), http.StatusUnsupportedMediaType},
+		{"обычный CSV", "price.csv", []byte("Наименование;Цена\nМука;100\n"), http.StatusOK},
+	}
+	for _, tc := range cases {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, uploadRequest(t, tc.filename, tc.content))
+		if recorder.Code != tc.want {
+			t.Errorf("%s: статус %d, want %d (%s)", tc.name, recorder.Code, tc.want, recorder.Body.String())
+		}
+	}
+}
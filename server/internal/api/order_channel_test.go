@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Канал из тела важнее заголовка X-Order-Channel, без обоих - сайт
+func TestOrderChannel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		body, header, want string
+	}{
+		{"telegram", "walk_in", models.OrderChannelTelegram},
+		{"", "Walk-In", models.OrderChannelWalkIn},
+		{"  ", "telegram", models.OrderChannelTelegram},
+		{"", "", models.OrderChannelWebsite},
+	}
+	for _, tc := range cases {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/orders", nil)
+		if tc.header != "" {
+			c.Request.Header.Set(models.OrderChannelHeader, tc.header)
+		}
+		if got := orderChannel(c, tc.body); got != tc.want {
+			t.Errorf("orderChannel(тело %q, заголовок %q) = %q, want %q", tc.body, tc.header, got, tc.want)
+		}
+	}
+}
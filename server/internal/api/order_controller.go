@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -15,6 +16,7 @@ import (
 	"zephyrvpn/server/internal/models"
 	"zephyrvpn/server/internal/services"
 	"zephyrvpn/server/internal/utils"
+	"zephyrvpn/server/internal/utils/rediskeys"
 )
 
 type OrderController struct {
@@ -22,6 +24,7 @@ type OrderController struct {
 	slotService          *services.SlotService
 	stockService         *services.StockService
 	stationAssignService *services.StationAssignmentService
+	branchService        *services.BranchService // Проверка branch_id и филиал по умолчанию (может быть nil)
 }
 
 func NewOrderController(redisUtil *utils.RedisClient, stockService *services.StockService, db interface{}, openHour, openMin, closeHour, closeMin int) *OrderController {
@@ -32,7 +35,7 @@ func NewOrderController(redisUtil *utils.RedisClient, stockService *services.Sto
 			gormDB = gdb
 		}
 	}
-	slotService := services.NewSlotService(redisUtil, gormDB, openHour, openMin, closeHour, closeMin)
+	slotService := services.NewSlotService(redisUtil, gormDB, openHour, openMin, closeHour, closeMin, services.RealClock{})
 	stationAssignService := services.NewStationAssignmentService(gormDB, redisUtil)
 	return &OrderController{
 		redisUtil:            redisUtil,
@@ -42,6 +45,11 @@ func NewOrderController(redisUtil *utils.RedisClient, stockService *services.Sto
 	}
 }
 
+// SetBranchService включает проверку branch_id заказа по списку филиалов
+func (oc *OrderController) SetBranchService(branchService *services.BranchService) {
+	oc.branchService = branchService
+}
+
 type CreateOrderRequest struct {
 	CustomerID        int                `json:"customer_id,omitempty"`
 	CustomerFirstName string             `json:"customer_first_name,omitempty"`
@@ -50,7 +58,8 @@ type CreateOrderRequest struct {
 	DeliveryAddress   string             `json:"delivery_address,omitempty"`
 	IsPickup          bool               `json:"is_pickup"`
 	PickupLocationID  string             `json:"pickup_location_id,omitempty"`
-	BranchID          string             `json:"branch_id,omitempty"` // ID филиала для проверки остатков
+	Channel           string             `json:"channel,omitempty"` // website, telegram, walk_in (иначе заголовок X-Order-Channel)
+	BranchID          string             `json:"branch_id,omitempty"` // ID филиала для проверки остатков (пусто - филиал по умолчанию)
 	Items             []models.PizzaItem `json:"items" binding:"required"`
 	IsSet             bool               `json:"is_set"`
 	SetName           string             `json:"set_name,omitempty"`
@@ -59,7 +68,24 @@ type CreateOrderRequest struct {
 	DiscountPercent   int                `json:"discount_percent,omitempty"` // Процент скидки
 }
 
+// CreateOrder создает заказ клиента и назначает его на слот
+// POST /api/v1/order, POST /api/v1/erp/orders
+//
+// @Summary      Создать заказ
+// @Description  Проверяет меню и остатки филиала, назначает заказ на слот, резервирует ингредиенты и отправляет заказ в ERP
+// @Tags         orders
+// @Accept       json
+// @Produce      json
+// @Param        request  body      CreateOrderRequest  true  "Заказ"
+// @Success      200      {object}  CreateOrderResponse
+// @Failure      400      {object}  ErrorResponse
+// @Failure      429      {object}  ErrorResponse
+// @Failure      500      {object}  ErrorResponse
+// @Failure      503      {object}  ErrorResponse
+// @Router       /order [post]
+// @Router       /erp/orders [post]
 func (oc *OrderController) CreateOrder(c *gin.Context) {
+	requestID := GetRequestID(c)
 	var req CreateOrderRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid data", "details": err.Error()})
@@ -76,78 +102,8 @@ func (oc *OrderController) CreateOrder(c *gin.Context) {
 		}
 	}
 
-	// Проверка остатков перед созданием заказа
-	if oc.stockService != nil && req.BranchID != "" {
-		if err := oc.checkInventoryAvailability(req.Items, req.BranchID); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "Недостаточно ингредиентов для выполнения заказа",
-				"details": err.Error(),
-			})
-			return
-		}
-	}
-
 	// Вычисляем общую стоимость товаров (без доставки и скидок)
-	itemsPrice := 0
-	items := make([]models.PizzaItem, len(req.Items))
-	for i, item := range req.Items {
-		pizza, _ := models.GetPizza(item.PizzaName)
-		// Цена пиццы без допов
-		pizzaPrice := pizza.Price
-		
-		// Цена допов за единицу
-		extrasPrice := 0
-		if len(item.Extras) > 0 {
-			log.Printf("   🔍 Обработка допов для '%s': %v", item.PizzaName, item.Extras)
-			allExtras := models.GetAllExtras()
-			log.Printf("   📋 Доступные допы в меню (%d шт): %v", len(allExtras), func() []string {
-				names := make([]string, 0, len(allExtras))
-				for name := range allExtras {
-					names = append(names, name)
-				}
-				return names
-			}())
-		}
-		for _, extraName := range item.Extras {
-			extra, exists := models.GetExtra(extraName)
-			if exists {
-				extrasPrice += extra.Price
-				log.Printf("   ✅ Доп '%s' найден, цена: %d руб", extraName, extra.Price)
-			} else {
-				log.Printf("   ❌ Доп '%s' НЕ найден в меню!", extraName)
-			}
-		}
-		if extrasPrice > 0 {
-			log.Printf("   💰 Итого допы: %d руб", extrasPrice)
-		}
-		
-		// Общая цена за единицу (пицца + допы)
-		pricePerUnit := pizzaPrice + extrasPrice
-		
-		// Общая цена за все количество
-		itemPrice := pricePerUnit * item.Quantity
-		itemsPrice += itemPrice
-		
-		// Копируем item (включая поля SetName и IsSetItem)
-		items[i] = item
-		// Устанавливаем цены
-		items[i].Price = pricePerUnit       // Общая цена за единицу
-		items[i].PizzaPrice = pizzaPrice    // Цена пиццы без допов
-		items[i].ExtrasPrice = extrasPrice  // Цена допов
-		
-		// Берем дозировки ингредиентов из модели пиццы
-		if pizza, exists := models.GetPizza(item.PizzaName); exists {
-			if pizza.IngredientAmounts != nil {
-				items[i].IngredientAmounts = pizza.IngredientAmounts
-			} else {
-				// Fallback: если дозировки нет в модели, используем стандартные
-				items[i].IngredientAmounts = generateIngredientAmounts(item.Ingredients)
-			}
-		} else {
-			// Fallback: если пицца не найдена, используем стандартные дозировки
-			items[i].IngredientAmounts = generateIngredientAmounts(item.Ingredients)
-		}
-	}
+	items, itemsPrice := priceOrderItems(req.Items)
 	
 	// Рассчитываем цену доставки (только если не самовывоз)
 	// TODO: В будущем будет расчет на основе суммы заказа и геолокации клиента
@@ -158,16 +114,36 @@ func (oc *OrderController) CreateOrder(c *gin.Context) {
 	}
 	// Если delivery_fee не передан, доставка бесплатная (0)
 	
-	// Рассчитываем скидку
-	discountAmount := req.DiscountAmount
-	if req.DiscountPercent > 0 && discountAmount == 0 {
-		// Если передан процент скидки, рассчитываем сумму скидки от суммы товаров
-		discountAmount = (itemsPrice * req.DiscountPercent) / 100
+	// Рассчитываем скидки: сначала на позиции, затем на заказ (процент - от суммы после скидок на позиции)
+	// Процент вне 0..100 и скидка больше суммы (при ORDER_DISCOUNT_POLICY=reject) - 400
+	price, err := models.ValidateOrderPrice(items, deliveryFee, req.DiscountAmount, req.DiscountPercent)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректная скидка", "details": err.Error()})
+		return
 	}
-	
-	// Итоговая цена: товары + доставка - скидка
+	discountAmount := price.OrderDiscount
+
+	// Филиал заказа: неизвестный branch_id - 400 со списком филиалов, без branch_id - филиал по умолчанию
+	branchID, ok := resolveBranchID(c, oc.branchService, req.BranchID, false)
+	if !ok {
+		return
+	}
+	req.BranchID = branchID
+
+	// Проверка остатков перед созданием заказа
+	if oc.stockService != nil && req.BranchID != "" {
+		if err := oc.checkInventoryAvailability(req.Items, req.BranchID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Недостаточно ингредиентов для выполнения заказа",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+
+	// Итоговая цена: товары + доставка - скидки на позиции - скидка на заказ
 	totalPrice := itemsPrice + deliveryFee
-	finalPrice := totalPrice - discountAmount
+	finalPrice := price.FinalPrice
 
 	// Генерируем полный ID
 	fullID := uuid.New().String()
@@ -193,11 +169,14 @@ func (oc *OrderController) CreateOrder(c *gin.Context) {
 		log.Printf("   [%d] %s x%d = %d руб (допы: %v)", i+1, item.PizzaName, item.Quantity, 
 			item.Price, item.Extras)
 	}
-	log.Printf("💰 Расчет цены: товары=%d руб, доставка=%d руб, скидка=%d руб, итого=%d руб (финальная=%d руб)", 
-		itemsPrice, deliveryFee, discountAmount, totalPrice, finalPrice)
+	log.Printf("💰 Расчет цены: товары=%d руб, доставка=%d руб, скидки на позиции=%d руб, скидка=%d руб, итого=%d руб (финальная=%d руб)", 
+		itemsPrice, deliveryFee, price.ItemDiscounts, discountAmount, totalPrice, finalPrice)
 	
 	// Передаем итоговую сумму заказа (с доставкой) и количество элементов для расчета времени подготовки
-	slotID, slotStartTime, visibleAt, err := oc.slotService.AssignSlot(fullID, finalPrice, itemsCount)
+	slotID, slotStartTime, visibleAt, err := oc.slotService.AssignSlot(fullID, finalPrice, itemsCount, req.BranchID)
+	if redisUnavailable(c, err) {
+		return
+	}
 	if err != nil {
 		// Если не удалось назначить слот, возвращаем ошибку
 		c.JSON(http.StatusServiceUnavailable, gin.H{
@@ -207,6 +186,26 @@ func (oc *OrderController) CreateOrder(c *gin.Context) {
 		return
 	}
 
+	// Заказ занял место в слоте - откладываем под него ингредиенты (списываются, когда заказ готов).
+	// Не удалось зарезервировать - слот освобождается, заказ не создается
+	if err := oc.reserveOrderIngredients(fullID, items, req.BranchID); err != nil {
+		if releaseErr := oc.slotService.ReleaseSlot(fullID); releaseErr != nil {
+			log.Printf("⚠️ [req=%s] CreateOrder: ошибка освобождения слота %s после неудачного резерва: %v", requestID, slotID, releaseErr)
+		}
+		if errors.Is(err, services.ErrInsufficientStock) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Недостаточно ингредиентов для выполнения заказа",
+				"details": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Не удалось зарезервировать ингредиенты заказа",
+			"details": err.Error(),
+		})
+		return
+	}
+
 	// Создаем заказ с назначенным слотом
 	order := models.PizzaOrder{
 		ID:                 fullID,
@@ -218,19 +217,22 @@ func (oc *OrderController) CreateOrder(c *gin.Context) {
 		DeliveryAddress:    req.DeliveryAddress,
 		IsPickup:           req.IsPickup,
 		PickupLocationID:   req.PickupLocationID,
+		Channel:            orderChannel(c, req.Channel),
 		Items:              items,
 		IsSet:              req.IsSet,
 		SetName:            req.SetName,
 		TotalPrice:         itemsPrice, // Цена товаров без доставки
 		DiscountAmount:    discountAmount,
 		DiscountPercent:    req.DiscountPercent,
-		FinalPrice:         finalPrice, // Итоговая цена: товары + доставка - скидка
+		FinalPrice:         finalPrice, // Итоговая цена: товары + доставка - скидки
 		CreatedAt:          time.Now(),
 		Status:             "pending",
 		TargetSlotID:       slotID,        // 🎯 Сохраняем ID слота в заказе
 		TargetSlotStartTime: slotStartTime, // 🎯 Сохраняем время начала слота (UTC)
 		VisibleAt:          visibleAt,     // 🎯 Сохраняем время показа заказа на планшете (UTC)
+		PrepSeconds:        models.EstimatePrepSeconds(items), // Оценка времени приготовления для KDS
 	}
+	order.RefreshDueAt()
 
 	// Сохраняем в Redis и отправляем в ERP в фоне (используем указатель для эффективности)
 	go func(o *models.PizzaOrder) {
@@ -238,18 +240,18 @@ func (oc *OrderController) CreateOrder(c *gin.Context) {
 		// Распределяем заказ по станциям
 		if oc.stationAssignService != nil {
 			if err := oc.stationAssignService.AssignOrderToStations(o); err != nil {
-				log.Printf("⚠️ CreateOrder: ошибка распределения заказа по станциям: %v", err)
+				log.Printf("⚠️ [req=%s] CreateOrder: ошибка распределения заказа по станциям: %v", requestID, err)
 			}
 		}
-		oc.sendToERP(o)
+		oc.sendToERP(o, requestID)
 	}(&order)
 	
-	log.Printf("🎯 Slot assigned: заказ %s назначен на слот %s (время: %s)", 
-		fullID, slotID, slotStartTime.Format("15:04"))
+	log.Printf("🎯 [req=%s] Slot assigned: заказ %s назначен на слот %s (время: %s)", 
+		requestID, fullID, slotID, slotStartTime.Format("15:04"))
 	
 	// Логируем итоговую информацию о заказе
-	log.Printf("✅ Заказ создан: ID=%s, товары=%d руб, доставка=%d руб, скидка=%d руб, итого=%d руб", 
-		order.ID, order.TotalPrice, deliveryFee, order.DiscountAmount, order.FinalPrice)
+	log.Printf("✅ [req=%s] Заказ создан: ID=%s, товары=%d руб, доставка=%d руб, скидка=%d руб, итого=%d руб", 
+		requestID, order.ID, order.TotalPrice, deliveryFee, order.DiscountAmount, order.FinalPrice)
 
 	c.JSON(http.StatusOK, gin.H{
 		"order_id":     order.ID,
@@ -259,10 +261,77 @@ func (oc *OrderController) CreateOrder(c *gin.Context) {
 		"delivery_fee": deliveryFee,       // Цена доставки (в рублях, сейчас 0 - бесплатно)
 		"items_count":  itemsCount,        // Количество единиц товара
 		"items_price":  itemsPrice,        // Цена всех товаров (для отладки)
+		"prep_seconds": order.PrepSeconds, // Оценка времени приготовления (секунды)
 		"status":       "accepted",
 	})
 }
 
+// priceOrderItems рассчитывает цены позиций по текущему меню (пицца + допы) и дозировки ингредиентов
+// Возвращает позиции с ценами и общую стоимость товаров (без доставки и скидок)
+func priceOrderItems(reqItems []models.PizzaItem) ([]models.PizzaItem, int) {
+	itemsPrice := 0
+	items := make([]models.PizzaItem, len(reqItems))
+	for i, item := range reqItems {
+		pizza, _ := models.GetPizza(item.PizzaName)
+		// Цена пиццы без допов
+		pizzaPrice := pizza.Price
+		
+		// Цена допов за единицу
+		extrasPrice := 0
+		if len(item.Extras) > 0 {
+			log.Printf("   🔍 Обработка допов для '%s': %v", item.PizzaName, item.Extras)
+			allExtras := models.GetAllExtras()
+			log.Printf("   📋 Доступные допы в меню (%d шт): %v", len(allExtras), func() []string {
+				names := make([]string, 0, len(allExtras))
+				for name := range allExtras {
+					names = append(names, name)
+				}
+				return names
+			}())
+		}
+		for _, extraName := range item.Extras {
+			extra, exists := models.GetExtra(extraName)
+			if exists {
+				extrasPrice += extra.Price
+				log.Printf("   ✅ Доп '%s' найден, цена: %d руб", extraName, extra.Price)
+			} else {
+				log.Printf("   ❌ Доп '%s' НЕ найден в меню!", extraName)
+			}
+		}
+		if extrasPrice > 0 {
+			log.Printf("   💰 Итого допы: %d руб", extrasPrice)
+		}
+		
+		// Общая цена за единицу (пицца + допы)
+		pricePerUnit := pizzaPrice + extrasPrice
+		
+		// Общая цена за все количество
+		itemPrice := pricePerUnit * item.Quantity
+		itemsPrice += itemPrice
+		
+		// Копируем item (включая поля SetName и IsSetItem)
+		items[i] = item
+		// Устанавливаем цены
+		items[i].Price = pricePerUnit       // Общая цена за единицу
+		items[i].PizzaPrice = pizzaPrice    // Цена пиццы без допов
+		items[i].ExtrasPrice = extrasPrice  // Цена допов
+		
+		// Берем дозировки ингредиентов из модели пиццы
+		if pizza, exists := models.GetPizza(item.PizzaName); exists {
+			if pizza.IngredientAmounts != nil {
+				items[i].IngredientAmounts = pizza.IngredientAmounts
+			} else {
+				// Fallback: если дозировки нет в модели, используем стандартные
+				items[i].IngredientAmounts = generateIngredientAmounts(item.Ingredients)
+			}
+		} else {
+			// Fallback: если пицца не найдена, используем стандартные дозировки
+			items[i].IngredientAmounts = generateIngredientAmounts(item.Ingredients)
+		}
+	}
+	return items, itemsPrice
+}
+
 func (oc *OrderController) saveOrder(order *models.PizzaOrder) {
 	if oc.redisUtil == nil {
 		return
@@ -272,14 +341,14 @@ func (oc *OrderController) saveOrder(order *models.PizzaOrder) {
 	pipe := oc.redisUtil.Pipeline()
 
 	orderJSON, _ := json.Marshal(order)
-	orderKey := fmt.Sprintf("order:%s", order.ID)
+	orderKey := rediskeys.LegacyOrderKey(order.ID)
 	todayKey := "orders:today:" + time.Now().Format("2006-01-02")
 	
 	ctx := oc.redisUtil.Context()
 	
 	// Накидываем команды в пачку (они еще не ушли в сеть!)
-	pipe.Set(ctx, orderKey, string(orderJSON), 24*time.Hour)
-	pipe.Set(ctx, fmt.Sprintf("orders:list:%s", order.ID), order.ID, 24*time.Hour)
+	pipe.Set(ctx, orderKey, string(orderJSON), rediskeys.OrderTTL())
+	pipe.Set(ctx, rediskeys.OrderListKey(order.ID), order.ID, rediskeys.OrderTTL())
 	pipe.Incr(ctx, "orders:total")
 	pipe.Incr(ctx, todayKey)
 	pipe.LPush(ctx, "kitchen:orders:queue", order.ID)
@@ -291,7 +360,8 @@ func (oc *OrderController) saveOrder(order *models.PizzaOrder) {
 	}
 }
 
-func (oc *OrderController) sendToERP(order *models.PizzaOrder) {
+// sendToERP сохраняет заказ для ERP и уведомляет планшеты (requestID - ID HTTP запроса, создавшего заказ)
+func (oc *OrderController) sendToERP(order *models.PizzaOrder, requestID string) {
 	if oc.redisUtil == nil {
 		return
 	}
@@ -300,32 +370,33 @@ func (oc *OrderController) sendToERP(order *models.PizzaOrder) {
 	orderJSON, _ := json.Marshal(order)
 	
 	// Сохраняем заказ с ключом для быстрого доступа
-	oc.redisUtil.Set(fmt.Sprintf("erp:order:%s", order.ID), string(orderJSON), 7*24*time.Hour)
+	oc.redisUtil.Set(rediskeys.OrderKey(order.ID), string(orderJSON), 7*24*time.Hour)
+	recordOrderStatus(oc.redisUtil, order.ID, order.Status, "order_api")
 	
 	// НЕ добавляем заказ в активные сразу - он появится только когда наступит VisibleAt
 	// Сохраняем заказ в отдельный список ожидающих заказов
 	if !order.VisibleAt.IsZero() {
 		// Сохраняем время начала слота и время показа для проверки
-		oc.redisUtil.Set(fmt.Sprintf("order:slot:start:%s", order.ID), order.TargetSlotStartTime.Format(time.RFC3339), 24*time.Hour)
-		oc.redisUtil.Set(fmt.Sprintf("order:visible_at:%s", order.ID), order.VisibleAt.Format(time.RFC3339), 24*time.Hour)
+		oc.redisUtil.Set(rediskeys.OrderSlotStartKey(order.ID), order.TargetSlotStartTime.Format(time.RFC3339), rediskeys.OrderTTL())
+		oc.redisUtil.Set(rediskeys.OrderVisibleAtKey(order.ID), order.VisibleAt.Format(time.RFC3339), rediskeys.OrderTTL())
 		
 		// Добавляем в список ожидающих заказов (не в активные!)
-		oc.redisUtil.SAdd("erp:orders:pending_slots", order.ID)
+		oc.redisUtil.SAdd(rediskeys.OrdersPendingSlotsKey, order.ID)
 		
-		log.Printf("📅 Заказ %s назначен на слот %s (время начала: %s UTC, будет показан: %s UTC)", 
-			order.ID, order.TargetSlotID, order.TargetSlotStartTime.Format("15:04:05"), order.VisibleAt.Format("15:04:05"))
+		log.Printf("📅 [req=%s] Заказ %s назначен на слот %s (время начала: %s UTC, будет показан: %s UTC)", 
+			requestID, order.ID, order.TargetSlotID, order.TargetSlotStartTime.Format("15:04:05"), order.VisibleAt.Format("15:04:05"))
 	} else {
 		// Если нет VisibleAt, добавляем сразу в активные (старая логика для обратной совместимости)
-		oc.redisUtil.SAdd("erp:orders:active", order.ID)
-		oc.redisUtil.Increment("erp:orders:pending")
+		oc.redisUtil.SAdd(rediskeys.OrdersActiveKey, order.ID)
+		oc.redisUtil.Increment(rediskeys.OrdersPendingKey)
 	}
 	
 	// Отправляем обновление в ERP через WebSocket
-	BroadcastERPUpdate("new_order", map[string]interface{}{
+	BroadcastERPUpdateWithRequestID("new_order", map[string]interface{}{
 		"order_id": order.ID,
 		"display_id": order.DisplayID,
 		"message": "Новый заказ создан",
-	})
+	}, requestID)
 	
 	// НЕ добавляем в очередь воркеров - обработка только вручную через ERP
 }
@@ -431,6 +502,29 @@ func (oc *OrderController) checkInventoryAvailability(items []models.PizzaItem,
 	return nil
 }
 
+// reserveOrderIngredients резервирует ингредиенты пицц заказа в филиале (одинаковые пиццы суммируются)
+// Без StockService или филиала резерв не ведется, как и проверка остатков
+func (oc *OrderController) reserveOrderIngredients(orderID string, items []models.PizzaItem, branchID string) error {
+	if oc.stockService == nil || branchID == "" {
+		return nil
+	}
+
+	portions := make(map[string]float64)
+	for _, item := range items {
+		recipeID, err := oc.getRecipeIDByPizzaName(item.PizzaName)
+		if err != nil {
+			return fmt.Errorf("пицца '%s': %w", item.PizzaName, err)
+		}
+		portions[recipeID] += float64(item.Quantity)
+	}
+	if len(portions) == 0 {
+		return nil
+	}
+
+	_, err := oc.stockService.ReserveOrder(orderID, portions, branchID)
+	return err
+}
+
 // getRecipeIDByPizzaName находит Recipe ID по названию пиццы
 // Best Practice: Поиск через NomenclatureItem (IsSaleable=true) -> Recipe (MenuItemID)
 // Это гарантирует связь между меню и рецептом через единую номенклатуру
@@ -469,3 +563,11 @@ func (oc *OrderController) getRecipeIDByPizzaName(pizzaName string) (string, err
 
 	return recipe.ID, nil
 }
+
+// orderChannel определяет канал заказа: поле channel в теле, затем заголовок X-Order-Channel, по умолчанию - сайт
+func orderChannel(c *gin.Context, channel string) string {
+	if strings.TrimSpace(channel) == "" {
+		channel = c.GetHeader(models.OrderChannelHeader)
+	}
+	return models.NormalizeOrderChannel(channel, models.OrderChannelWebsite)
+}
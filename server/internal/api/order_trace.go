@@ -0,0 +1,177 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/services"
+	"zephyrvpn/server/internal/utils"
+	"zephyrvpn/server/internal/utils/rediskeys"
+)
+
+// orderStatusHistoryTTL - сколько хранится история статусов заказа (для разбора жалоб)
+const orderStatusHistoryTTL = 14 * 24 * time.Hour
+
+// OrderStatusChange - запись в истории статусов заказа
+type OrderStatusChange struct {
+	Status string    `json:"status"`
+	At     time.Time `json:"at"`
+	Source string    `json:"source"` // Кто изменил статус: order_api, grpc, erp, kds_activation, kitchen_worker
+}
+
+// recordOrderStatus добавляет смену статуса в историю заказа order:status_history:{id}
+// Ошибки только логируются: история не должна ломать обработку заказа
+func recordOrderStatus(redisUtil *utils.RedisClient, orderID, status, source string) {
+	if redisUtil == nil || orderID == "" {
+		return
+	}
+	key := orderStatusHistoryKey(orderID)
+	if err := redisUtil.RPush(key, orderStatusEntry(status, source)); err != nil {
+		log.Printf("⚠️ Не удалось записать историю статусов заказа %s: %v", orderID, err)
+		return
+	}
+	redisUtil.Expire(key, orderStatusHistoryTTL)
+}
+
+// orderStatusHistoryKey возвращает ключ истории статусов заказа
+func orderStatusHistoryKey(orderID string) string {
+	return fmt.Sprintf("order:status_history:%s", orderID)
+}
+
+// orderStatusEntry сериализует запись истории статусов (для записи через pipeline)
+func orderStatusEntry(status, source string) string {
+	entry, _ := json.Marshal(OrderStatusChange{Status: status, At: time.Now().UTC(), Source: source})
+	return string(entry)
+}
+
+// getOrderStatusHistory возвращает историю статусов заказа в порядке изменений
+func getOrderStatusHistory(redisUtil *utils.RedisClient, orderID string) []OrderStatusChange {
+	history := make([]OrderStatusChange, 0)
+	if redisUtil == nil {
+		return history
+	}
+	entries, err := redisUtil.LRange(orderStatusHistoryKey(orderID), 0, -1)
+	if err != nil {
+		return history
+	}
+	for _, raw := range entries {
+		var change OrderStatusChange
+		if err := json.Unmarshal([]byte(raw), &change); err == nil {
+			history = append(history, change)
+		}
+	}
+	return history
+}
+
+// SetStockService подключает сервис остатков (списания по заказу в трассировке, резерв ингредиентов заказа)
+func (ec *ERPController) SetStockService(stockService *services.StockService) {
+	ec.stockService = stockService
+}
+
+// GetOrderTrace собирает всю информацию о заказе для поддержки: заказ, слот, историю статусов и списания
+// GET /api/v1/erp/orders/:id/trace
+func (ec *ERPController) GetOrderTrace(c *gin.Context) {
+	orderID := c.Param("id")
+	if ec.redisUtil == nil && ec.orderService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Хранилища заказов недоступны", "degraded": true})
+		return
+	}
+
+	// 1. Заказ: сначала Redis (активные), затем архив в PostgreSQL
+	var order *models.PizzaOrder
+	source := ""
+	var record *services.OrderRecord
+	if ec.redisUtil != nil {
+		if redisOrder, err := ec.getOrderFromRedis(orderID); err == nil {
+			order = redisOrder
+			source = "redis"
+		}
+	}
+	if ec.orderService != nil {
+		archived, err := ec.orderService.GetOrderRecord(orderID)
+		if err != nil {
+			log.Printf("⚠️ GetOrderTrace: ошибка загрузки заказа %s из PostgreSQL: %v", orderID, err)
+		} else if archived != nil {
+			record = archived
+			if order == nil {
+				order = &archived.Order
+				source = "postgres"
+			}
+		}
+	}
+	if order == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	// 2. Слот: назначение order:slot и время показа на планшете
+	slot := gin.H{
+		"slot_id":    order.TargetSlotID,
+		"slot_start": nullableTime(order.TargetSlotStartTime),
+		"visible_at": nullableTime(order.VisibleAt),
+	}
+	if ec.redisUtil != nil {
+		if client := ec.redisUtil.GetClient(); client != nil {
+			assignment, err := client.HGetAll(ec.redisUtil.Context(), rediskeys.OrderSlotKey(orderID)).Result()
+			if err == nil && len(assignment) > 0 {
+				slot["slot_id"] = assignment["slot_id"]
+				slot["slot_price"] = assignment["price"]
+			}
+		}
+		if visibleAt, err := ec.redisUtil.Get(rediskeys.OrderVisibleAtKey(orderID)); err == nil && visibleAt != "" {
+			slot["visible_at"] = visibleAt
+		}
+	}
+
+	// 3. История статусов; для старых заказов без истории восстанавливаем ее по отметкам времени из PostgreSQL
+	history := getOrderStatusHistory(ec.redisUtil, orderID)
+	if len(history) == 0 {
+		history = append(history, OrderStatusChange{Status: string(models.OrderStatusPending), At: order.CreatedAt, Source: "created_at"})
+		if record != nil && record.CompletedAt != nil {
+			history = append(history, OrderStatusChange{Status: string(models.OrderStatusCompleted), At: *record.CompletedAt, Source: "completed_at"})
+		}
+		if record != nil && record.CancelledAt != nil {
+			history = append(history, OrderStatusChange{Status: string(models.OrderStatusCancelled), At: *record.CancelledAt, Source: "cancelled_at"})
+		}
+	}
+
+	// 4. Списания со склада, привязанные к заказу (source_reference_id = ID заказа)
+	movements := make([]models.StockMovement, 0)
+	if ec.stockService != nil {
+		linked, err := ec.stockService.GetMovementsBySourceReference(orderID)
+		if err != nil {
+			log.Printf("⚠️ GetOrderTrace: ошибка загрузки движений по заказу %s: %v", orderID, err)
+		} else {
+			movements = linked
+		}
+	}
+
+	response := gin.H{
+		"order_id":        orderID,
+		"order":           order,
+		"order_source":    source,
+		"slot":            slot,
+		"status_history":  history,
+		"stock_movements": movements,
+		"movements_count": len(movements),
+	}
+	// Без Redis нет истории статусов и слота - отдаем архив с пометкой
+	if ec.redisUtil == nil {
+		respondDegraded(c, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// nullableTime возвращает nil для нулевого времени (чтобы в JSON не было 0001-01-01)
+func nullableTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/services"
+	"zephyrvpn/server/internal/utils/rediskeys"
+)
+
+// traceRouter - маршрут трассировки заказа
+func traceRouter(ec *ERPController) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/orders/:id/trace", ec.GetOrderTrace)
+	return router
+}
+
+func TestGetOrderTraceWithoutStorage(t *testing.T) {
+	router := traceRouter(NewERPController(nil, "", "", nil, 0, 0, 23, 59))
+	if code, _ := degradedResponse(t, router, http.MethodGet, "/orders/order-1/trace", ""); code != http.StatusServiceUnavailable {
+		t.Errorf("без Redis и PostgreSQL: код %d, want 503", code)
+	}
+
+	router = traceRouter(NewERPController(newUnreachableRedis(t), "", "", nil, 0, 0, 23, 59))
+	if code, _ := degradedResponse(t, router, http.MethodGet, "/orders/order-1/trace", ""); code != http.StatusNotFound {
+		t.Errorf("заказ не найден: код %d, want 404", code)
+	}
+}
+
+// Заказ списал сыр со склада: трассировка содержит заказ, слот, историю статусов и связанные движения
+func TestGetOrderTrace(t *testing.T) {
+	redisUtil := newTestRedis(t)
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL не задан: интеграционный тест PostgreSQL пропущен")
+	}
+	db, err := gorm.Open(postgres.Open(databaseURL), &gorm.Config{})
+	if err != nil {
+		t.Skipf("PostgreSQL из TEST_DATABASE_URL недоступен: %v", err)
+	}
+	if err := db.AutoMigrate(&models.NomenclatureItem{}, &models.Recipe{}, &models.RecipeIngredient{},
+		&models.StockBatch{}, &models.StockMovement{}); err != nil {
+		t.Fatalf("не удалось создать тестовые таблицы: %v", err)
+	}
+
+	branchID := uuid.New().String()
+	cheese := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: "Моцарелла", BaseUnit: "g", IsActive: true}
+	if err := db.Create(&cheese).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	recipe := models.Recipe{Name: "Маргарита " + uuid.New().String()[:8], IsActive: true, PortionSize: 1, PhotoURLs: "[]",
+		Ingredients: []models.RecipeIngredient{{NomenclatureID: &cheese.ID, Quantity: 120, Unit: "g"}}}
+	if err := db.Create(&recipe).Error; err != nil {
+		t.Fatalf("не удалось создать рецепт: %v", err)
+	}
+	batch := models.StockBatch{NomenclatureID: cheese.ID, BranchID: branchID, Quantity: 1000, RemainingQuantity: 1000,
+		Unit: "g", Source: "adjustment"}
+	if err := db.Create(&batch).Error; err != nil {
+		t.Fatalf("не удалось создать партию: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Where("recipe_id = ?", recipe.ID).Delete(&models.RecipeIngredient{})
+		db.Unscoped().Where("id = ?", recipe.ID).Delete(&models.Recipe{})
+		db.Unscoped().Where("id = ?", cheese.ID).Delete(&models.NomenclatureItem{})
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	// Заказ в Redis, назначен в слот, прошел два статуса и списал 2 порции сыра
+	orderID := uuid.New().String()
+	stockService := services.NewStockService(db)
+	if err := stockService.ProcessSaleDepletion(recipe.ID, 2, branchID, "test", orderID); err != nil {
+		t.Fatalf("ProcessSaleDepletion: %v", err)
+	}
+	order := models.PizzaOrder{
+		ID:           orderID,
+		Status:       string(models.OrderStatusCooking),
+		Items:        []models.PizzaItem{{PizzaName: "Маргарита", Quantity: 2, Price: 500}},
+		TotalPrice:   1000,
+		FinalPrice:   1000,
+		TargetSlotID: "1893456000",
+		CreatedAt:    time.Now().UTC(),
+	}
+	data, err := json.Marshal(order)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	if err := redisUtil.SetBytes(rediskeys.OrderKey(orderID), data, time.Hour); err != nil {
+		t.Fatalf("SetBytes: %v", err)
+	}
+	client, ctx := redisUtil.GetClient(), redisUtil.Context()
+	if err := client.HSet(ctx, rediskeys.OrderSlotKey(orderID), "slot_id", "1893456000", "price", 1000).Err(); err != nil {
+		t.Fatalf("HSet: %v", err)
+	}
+	if err := client.Set(ctx, rediskeys.OrderVisibleAtKey(orderID), "2030-01-01T11:45:00Z", time.Hour).Err(); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	recordOrderStatus(redisUtil, orderID, string(models.OrderStatusPending), "order_api")
+	recordOrderStatus(redisUtil, orderID, string(models.OrderStatusCooking), "kitchen_worker")
+
+	ec := NewERPController(redisUtil, "", "", nil, 0, 0, 23, 59)
+	ec.SetStockService(stockService)
+	code, payload := degradedResponse(t, traceRouter(ec), http.MethodGet, "/orders/"+orderID+"/trace", "")
+	if code != http.StatusOK {
+		t.Fatalf("код %d (%v), want 200", code, payload)
+	}
+
+	if payload["order_source"] != "redis" {
+		t.Errorf("источник заказа %v, want redis", payload["order_source"])
+	}
+	slot, _ := payload["slot"].(map[string]interface{})
+	if slot["slot_id"] != "1893456000" || slot["slot_price"] != "1000" || slot["visible_at"] != "2030-01-01T11:45:00Z" {
+		t.Errorf("слот %v, want 1893456000 за 1000₽, показан в 11:45", slot)
+	}
+	history, _ := payload["status_history"].([]interface{})
+	if len(history) != 2 {
+		t.Fatalf("история статусов %v, want 2 записи", history)
+	}
+	if last := history[1].(map[string]interface{}); last["status"] != "cooking" || last["source"] != "kitchen_worker" {
+		t.Errorf("последний статус %v, want cooking от kitchen_worker", last)
+	}
+
+	movements, _ := payload["stock_movements"].([]interface{})
+	if len(movements) != 1 || payload["movements_count"] != float64(1) {
+		t.Fatalf("движения %v, want одно списание", movements)
+	}
+	movement := movements[0].(map[string]interface{})
+	if movement["source_reference_id"] != orderID || movement["stock_batch_id"] != batch.ID ||
+		movement["movement_type"] != "sale" || movement["quantity"] != float64(-240) {
+		t.Errorf("движение %v, want списание 240 г из партии %s по заказу %s", movement, batch.ID, orderID)
+	}
+}
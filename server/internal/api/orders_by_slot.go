@@ -0,0 +1,130 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/services"
+	"zephyrvpn/server/internal/utils/rediskeys"
+)
+
+// SlotOrders - заказы одного слота на доске диспетчера
+type SlotOrders struct {
+	Slot              *services.SlotInfo  `json:"slot"`               // Загрузка, емкость, начало и конец слота
+	RemainingCapacity int                 `json:"remaining_capacity"` // Сколько еще можно принять в слот (по емкости с овербукингом), не меньше 0
+	Orders            []models.PizzaOrder `json:"orders"`             // По времени создания
+}
+
+// GetOrdersBySlot возвращает активные и отложенные заказы, сгруппированные по целевому слоту (доска диспетчера)
+// Слоты идут по времени начала; заказы без слота - отдельным списком unassigned
+// GET /api/v1/erp/orders/by-slot?role=admin
+func (ec *ERPController) GetOrdersBySlot(c *gin.Context) {
+	if ec.redisUtil == nil || ec.slotService == nil {
+		respondRedisUnavailable(c)
+		return
+	}
+
+	// Диспетчеру по умолчанию нужна полная информация (адрес, сумма)
+	role := c.Query("role")
+	if role == "" {
+		role = "admin"
+	}
+
+	orders := make([]models.PizzaOrder, 0)
+	seen := make(map[string]bool)
+	for _, setKey := range []string{rediskeys.OrdersActiveKey, rediskeys.OrdersPendingSlotsKey} {
+		orderIDs, err := ec.redisUtil.SMembers(setKey)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Ошибка получения заказов из Redis",
+				"details": err.Error(),
+			})
+			return
+		}
+		for _, orderID := range orderIDs {
+			if seen[orderID] {
+				continue
+			}
+			seen[orderID] = true
+			order, err := ec.getOrderFromRedis(orderID)
+			if err != nil {
+				continue // Заказ уже истек в Redis
+			}
+			orders = append(orders, filterOrderByRole(*order, role))
+		}
+	}
+
+	slots, unassigned, err := groupOrdersBySlot(orders, ec.slotInfoForDispatch)
+	if redisUnavailable(c, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("❌ GetOrdersBySlot: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка получения загрузки слотов",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"slots":       slots,
+		"unassigned":  unassigned,
+		"slots_count": len(slots),
+		"count":       len(orders),
+		"role":        role,
+	})
+}
+
+// slotInfoForDispatch - загрузка слота с учетом pending + active заказов (границы слота - из его ID)
+func (ec *ERPController) slotInfoForDispatch(slotID string) (*services.SlotInfo, error) {
+	start, end, ok := ec.slotService.SlotBounds(slotID)
+	if !ok {
+		return nil, fmt.Errorf("некорректный ID слота: %s", slotID)
+	}
+	return ec.slotService.GetSlotInfoWithOrders(slotID, start, end)
+}
+
+// groupOrdersBySlot раскладывает заказы по TargetSlotID и подставляет слоту его SlotInfo (один запрос на слот)
+// Слоты сортируются по времени начала, заказы внутри слота - по времени создания
+func groupOrdersBySlot(orders []models.PizzaOrder, slotInfo func(slotID string) (*services.SlotInfo, error)) ([]SlotOrders, []models.PizzaOrder, error) {
+	bySlot := make(map[string][]models.PizzaOrder)
+	unassigned := make([]models.PizzaOrder, 0)
+	for _, order := range orders {
+		if order.TargetSlotID == "" {
+			unassigned = append(unassigned, order)
+			continue
+		}
+		bySlot[order.TargetSlotID] = append(bySlot[order.TargetSlotID], order)
+	}
+
+	slots := make([]SlotOrders, 0, len(bySlot))
+	for slotID, slotOrders := range bySlot {
+		info, err := slotInfo(slotID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("слот %s: %w", slotID, err)
+		}
+		remaining := info.EffectiveCapacity - info.CurrentLoad
+		if remaining < 0 {
+			remaining = 0
+		}
+		sort.SliceStable(slotOrders, func(i, j int) bool {
+			return slotOrders[i].CreatedAt.Before(slotOrders[j].CreatedAt)
+		})
+		slots = append(slots, SlotOrders{Slot: info, RemainingCapacity: remaining, Orders: slotOrders})
+	}
+	sort.Slice(slots, func(i, j int) bool {
+		if !slots[i].Slot.StartTime.Equal(slots[j].Slot.StartTime) {
+			return slots[i].Slot.StartTime.Before(slots[j].Slot.StartTime)
+		}
+		return slots[i].Slot.SlotID < slots[j].Slot.SlotID
+	})
+	sort.SliceStable(unassigned, func(i, j int) bool {
+		return unassigned[i].CreatedAt.Before(unassigned[j].CreatedAt)
+	})
+	return slots, unassigned, nil
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/services"
+)
+
+func TestGroupOrdersBySlot(t *testing.T) {
+	base := time.Date(2030, 1, 15, 12, 0, 0, 0, time.UTC)
+	early := base.Add(15 * time.Minute)
+	late := base.Add(45 * time.Minute)
+	earlyID := fmt.Sprintf("slot:%d", early.Unix())
+	lateID := fmt.Sprintf("slot:%d", late.Unix())
+
+	orders := []models.PizzaOrder{
+		{ID: "late-1", TargetSlotID: lateID, FinalPrice: 900, CreatedAt: base.Add(2 * time.Minute)},
+		{ID: "early-2", TargetSlotID: earlyID, FinalPrice: 700, CreatedAt: base.Add(3 * time.Minute)},
+		{ID: "no-slot", CreatedAt: base},
+		{ID: "early-1", TargetSlotID: earlyID, FinalPrice: 500, CreatedAt: base.Add(time.Minute)},
+	}
+	// Загрузка из Redis: в позднем слоте есть и чужие (уже готовые) заказы, ранний переполнен овербукингом
+	infos := map[string]*services.SlotInfo{
+		earlyID: {SlotID: earlyID, StartTime: early, EndTime: early.Add(15 * time.Minute), CurrentLoad: 11500, MaxCapacity: 10000, EffectiveCapacity: 11000},
+		lateID:  {SlotID: lateID, StartTime: late, EndTime: late.Add(15 * time.Minute), CurrentLoad: 2900, MaxCapacity: 10000, EffectiveCapacity: 10000},
+	}
+	calls := make(map[string]int)
+	slotInfo := func(slotID string) (*services.SlotInfo, error) {
+		calls[slotID]++
+		return infos[slotID], nil
+	}
+
+	slots, unassigned, err := groupOrdersBySlot(orders, slotInfo)
+	if err != nil {
+		t.Fatalf("groupOrdersBySlot: %v", err)
+	}
+	if len(slots) != 2 {
+		t.Fatalf("слотов %d, want 2", len(slots))
+	}
+
+	if slots[0].Slot.SlotID != earlyID || slots[1].Slot.SlotID != lateID {
+		t.Fatalf("порядок слотов %s, %s; want %s, %s", slots[0].Slot.SlotID, slots[1].Slot.SlotID, earlyID, lateID)
+	}
+	if got := orderIDs(slots[0].Orders); !reflect.DeepEqual(got, []string{"early-1", "early-2"}) {
+		t.Errorf("заказы раннего слота %v, want [early-1 early-2]", got)
+	}
+	if got := orderIDs(slots[1].Orders); !reflect.DeepEqual(got, []string{"late-1"}) {
+		t.Errorf("заказы позднего слота %v, want [late-1]", got)
+	}
+	if slots[0].Slot.CurrentLoad != 11500 || slots[0].RemainingCapacity != 0 {
+		t.Errorf("ранний слот: загрузка %d, остаток %d; want 11500 и 0", slots[0].Slot.CurrentLoad, slots[0].RemainingCapacity)
+	}
+	if slots[1].Slot.CurrentLoad != 2900 || slots[1].RemainingCapacity != 7100 {
+		t.Errorf("поздний слот: загрузка %d, остаток %d; want 2900 и 7100", slots[1].Slot.CurrentLoad, slots[1].RemainingCapacity)
+	}
+	if got := orderIDs(unassigned); !reflect.DeepEqual(got, []string{"no-slot"}) {
+		t.Errorf("заказы без слота %v, want [no-slot]", got)
+	}
+	for slotID, n := range calls {
+		if n != 1 {
+			t.Errorf("SlotInfo слота %s запрошен %d раз, want 1", slotID, n)
+		}
+	}
+}
+
+// orderIDs - ID заказов в порядке списка
+func orderIDs(orders []models.PizzaOrder) []string {
+	ids := make([]string, 0, len(orders))
+	for _, order := range orders {
+		ids = append(ids, order.ID)
+	}
+	return ids
+}
@@ -68,6 +68,53 @@ func (c *ProcurementPlanningController) GetMonthlyPlan(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, plan)
 }
 
+// AutoFillPlan заполняет план на месяц рекомендуемыми количествами из прогноза спроса
+// POST /api/v1/procurement/auto-fill-plan?branch_id=xxx&month=2026-02 (или &year=2026&month=2)
+func (c *ProcurementPlanningController) AutoFillPlan(ctx *gin.Context) {
+	branchID := ctx.Query("branch_id")
+	if branchID == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "branch_id обязателен"})
+		return
+	}
+	
+	monthStr := ctx.Query("month")
+	if monthStr == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "month обязателен (YYYY-MM)"})
+		return
+	}
+	
+	var year, month int
+	if parsed, err := time.Parse("2006-01", monthStr); err == nil {
+		year = parsed.Year()
+		month = int(parsed.Month())
+	} else {
+		month, err = strconv.Atoi(monthStr)
+		if err != nil || month < 1 || month > 12 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "неверный месяц (YYYY-MM или 1-12)"})
+			return
+		}
+		year = time.Now().Year()
+		if yearStr := ctx.Query("year"); yearStr != "" {
+			year, err = strconv.Atoi(yearStr)
+			if err != nil || year < 2020 || year > 2100 {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": "неверный год"})
+				return
+			}
+		}
+	}
+	
+	result, err := c.planningService.AutoFillMonthlyPlan(branchID, year, month)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка автозаполнения плана",
+			"details": err.Error(),
+		})
+		return
+	}
+	
+	ctx.JSON(http.StatusOK, result)
+}
+
 // UpdatePlanCell обновляет ячейку в плане
 // PUT /api/v1/procurement/plan-cell
 func (c *ProcurementPlanningController) UpdatePlanCell(ctx *gin.Context) {
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -8,6 +9,7 @@ import (
 	"zephyrvpn/server/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // PurchaseOrderController управляет заказами на закупку
@@ -151,6 +153,13 @@ func (c *PurchaseOrderController) SendPurchaseOrder(ctx *gin.Context) {
 	}
 
 	if err := c.orderService.SendPurchaseOrder(orderID, req.ApprovedBy); err != nil {
+		if errors.Is(err, services.ErrPurchaseOrderApprovalRequired) {
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error":   "Заказ требует утверждения",
+				"details": err.Error(),
+			})
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Ошибка отправки заказа",
 			"details": err.Error(),
@@ -163,6 +172,30 @@ func (c *PurchaseOrderController) SendPurchaseOrder(ctx *gin.Context) {
 	})
 }
 
+// ApprovePurchaseOrder утверждает заказ выше порога суммы (только менеджер/админ)
+// POST /api/v1/purchase-orders/:id/approve
+// Доступ - RequireManagerRole: сотрудник в должности Manager или роль admin/super_admin
+func (c *PurchaseOrderController) ApprovePurchaseOrder(ctx *gin.Context) {
+	orderID := ctx.Param("id")
+
+	order, err := c.orderService.ApprovePurchaseOrder(orderID, ctx.GetString("user_id"))
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, services.ErrPurchaseOrderNotPendingApproval) {
+			statusCode = http.StatusConflict
+		} else if errors.Is(err, gorm.ErrRecordNotFound) {
+			statusCode = http.StatusNotFound
+		}
+		ctx.JSON(statusCode, gin.H{
+			"error":   "Ошибка утверждения заказа",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, order)
+}
+
 // ReceivePurchaseOrder получает заказ (создает накладную)
 // POST /api/v1/purchase-orders/:id/receive
 func (c *PurchaseOrderController) ReceivePurchaseOrder(ctx *gin.Context) {
@@ -193,6 +226,38 @@ func (c *PurchaseOrderController) ReceivePurchaseOrder(ctx *gin.Context) {
 	})
 }
 
+// ReceivePurchaseOrderPartial принимает очередную поставку по заказу и сразу оприходует ее на склад
+// POST /api/v1/purchase-orders/:id/receive-partial
+func (c *PurchaseOrderController) ReceivePurchaseOrderPartial(ctx *gin.Context) {
+	orderID := ctx.Param("id")
+
+	var req struct {
+		ReceivedItems []services.ReceivedItem `json:"received_items" binding:"required"`
+		PerformedBy   string                   `json:"performed_by"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверные данные",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	order, err := c.orderService.ReceivePurchaseOrderPartial(orderID, req.ReceivedItems, req.PerformedBy)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка приемки поставки",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "Поставка принята и оприходована",
+		"data":    order,
+	})
+}
+
 // CancelPurchaseOrder отменяет заказ
 // POST /api/v1/purchase-orders/:id/cancel
 func (c *PurchaseOrderController) CancelPurchaseOrder(ctx *gin.Context) {
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"zephyrvpn/server/internal/utils"
+)
+
+// RateLimitRule описывает лимит запросов для группы маршрутов (token bucket)
+type RateLimitRule struct {
+	Scope         string  // Имя правила, входит в ключ Redis (read, create_order, ...)
+	RatePerSecond float64 // Скорость пополнения корзины (токенов в секунду)
+	Burst         int     // Емкость корзины (максимальный всплеск запросов)
+	ReadOnly      bool    // Применять только к GET/HEAD запросам
+}
+
+// tokenBucketScript атомарно пополняет корзину и списывает один токен
+// Время берется из Redis (TIME), чтобы несколько инстансов сервера считали одинаково
+// Возвращает {1, 0} если запрос разрешен, {0, retry_after_ms} если лимит исчерпан
+const tokenBucketScript = `
+	local key = KEYS[1]
+	local rate = tonumber(ARGV[1])
+	local burst = tonumber(ARGV[2])
+
+	local t = redis.call('TIME')
+	local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+	local bucket = redis.call('HMGET', key, 'tokens', 'ts')
+	local tokens = tonumber(bucket[1])
+	local ts = tonumber(bucket[2])
+	if tokens == nil or ts == nil then
+		tokens = burst
+		ts = now
+	end
+
+	-- Пополняем корзину за прошедшее время
+	local elapsed = math.max(0, now - ts)
+	tokens = math.min(burst, tokens + elapsed * rate / 1000)
+
+	local allowed = 0
+	local retry_after = 0
+	if tokens >= 1 then
+		tokens = tokens - 1
+		allowed = 1
+	else
+		retry_after = math.ceil((1 - tokens) * 1000 / rate)
+	end
+
+	redis.call('HSET', key, 'tokens', tostring(tokens), 'ts', now)
+	-- Ключ живет, пока корзина не наполнится полностью
+	redis.call('PEXPIRE', key, math.ceil(burst * 1000 / rate) + 1000)
+
+	return {allowed, retry_after}
+`
+
+// RateLimitMiddleware ограничивает частоту запросов по IP клиента и эндпоинту
+// Состояние корзины хранится в Redis, поэтому лимит общий для всех инстансов сервера
+// При превышении возвращает 429 с заголовком Retry-After (в секундах)
+// Если Redis недоступен или правило отключено (RatePerSecond <= 0), запросы пропускаются
+func RateLimitMiddleware(redisUtil *utils.RedisClient, rule RateLimitRule) gin.HandlerFunc {
+	if redisUtil == nil || redisUtil.GetClient() == nil || rule.RatePerSecond <= 0 || rule.Burst <= 0 {
+		log.Printf("⚠️ Rate limit '%s' отключен (Redis недоступен или лимит не задан)", rule.Scope)
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	log.Printf("✅ Rate limit '%s': %.2f req/s, burst %d", rule.Scope, rule.RatePerSecond, rule.Burst)
+	client := redisUtil.GetClient()
+
+	return func(c *gin.Context) {
+		if rule.ReadOnly && c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+
+		// FullPath - шаблон маршрута (/api/v1/erp/orders/:id), чтобы не плодить ключи на каждый ID
+		endpoint := c.FullPath()
+		if endpoint == "" {
+			endpoint = c.Request.URL.Path
+		}
+		key := fmt.Sprintf("ratelimit:%s:%s:%s:%s", rule.Scope, c.ClientIP(), c.Request.Method, endpoint)
+
+		result, err := client.Eval(redisUtil.Context(), tokenBucketScript, []string{key}, rule.RatePerSecond, rule.Burst).Result()
+		if err != nil {
+			// Не блокируем запросы из-за сбоя Redis
+			log.Printf("⚠️ RateLimit: ошибка Redis для %s: %v", key, err)
+			c.Next()
+			return
+		}
+
+		values, ok := result.([]interface{})
+		if !ok || len(values) < 2 {
+			c.Next()
+			return
+		}
+
+		allowed, _ := values[0].(int64)
+		if allowed == 1 {
+			c.Next()
+			return
+		}
+
+		retryAfterMs, _ := values[1].(int64)
+		retryAfter := int(math.Ceil(float64(retryAfterMs) / 1000))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Слишком много запросов, попробуйте позже",
+			"retry_after": retryAfter,
+		})
+	}
+}
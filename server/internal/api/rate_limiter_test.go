@@ -0,0 +1,98 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"zephyrvpn/server/internal/utils"
+)
+
+// newRateLimitedRouter - маршруты GET и POST /items/:id за RateLimitMiddleware
+func newRateLimitedRouter(redisUtil *utils.RedisClient, rule RateLimitRule) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RateLimitMiddleware(redisUtil, rule))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/items/:id", ok)
+	router.POST("/items/:id", ok)
+	return router
+}
+
+func serve(router *gin.Engine, method, url string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(method, url, nil))
+	return recorder
+}
+
+func TestRateLimitMiddlewarePassThroughWhenDisabled(t *testing.T) {
+	// Redis недоступен на этом адресе: ошибка Eval не должна блокировать запросы
+	unreachable := utils.NewRedisClient(redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}))
+	t.Cleanup(func() { unreachable.GetClient().Close() })
+
+	cases := []struct {
+		name      string
+		redisUtil *utils.RedisClient
+		rule      RateLimitRule
+	}{
+		{"без Redis", nil, RateLimitRule{Scope: "test", RatePerSecond: 1, Burst: 1}},
+		{"нулевая скорость", unreachable, RateLimitRule{Scope: "test", RatePerSecond: 0, Burst: 1}},
+		{"нулевой burst", unreachable, RateLimitRule{Scope: "test", RatePerSecond: 1, Burst: 0}},
+		{"ошибка Redis", unreachable, RateLimitRule{Scope: "test", RatePerSecond: 1, Burst: 1}},
+	}
+	for _, tc := range cases {
+		router := newRateLimitedRouter(tc.redisUtil, tc.rule)
+		for i := 0; i < 5; i++ {
+			if code := serve(router, http.MethodGet, "/items/1").Code; code != http.StatusOK {
+				t.Fatalf("%s: запрос #%d = %d, want 200", tc.name, i+1, code)
+			}
+		}
+	}
+}
+
+func TestRateLimitMiddlewareRejectsWhenBucketExhausted(t *testing.T) {
+	redisUtil := newTestRedis(t)
+	// Пополнение - 1 токен за 10 секунд, чтобы корзина не успела наполниться за время теста
+	router := newRateLimitedRouter(redisUtil, RateLimitRule{Scope: "test", RatePerSecond: 0.1, Burst: 3})
+
+	for i := 0; i < 3; i++ {
+		if code := serve(router, http.MethodGet, "/items/1").Code; code != http.StatusOK {
+			t.Fatalf("запрос #%d в пределах burst = %d, want 200", i+1, code)
+		}
+	}
+
+	recorder := serve(router, http.MethodGet, "/items/1")
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("запрос сверх burst = %d, want 429", recorder.Code)
+	}
+	retryAfter, err := strconv.Atoi(recorder.Header().Get("Retry-After"))
+	if err != nil || retryAfter < 1 || retryAfter > 10 {
+		t.Errorf("Retry-After = %q, want 1..10 секунд", recorder.Header().Get("Retry-After"))
+	}
+
+	// Ключ - шаблон маршрута: другой ID того же эндпоинта делит корзину, другой метод - нет
+	if code := serve(router, http.MethodGet, "/items/2").Code; code != http.StatusTooManyRequests {
+		t.Errorf("GET /items/2 = %d, want 429 (общая корзина маршрута)", code)
+	}
+	if code := serve(router, http.MethodPost, "/items/1").Code; code != http.StatusOK {
+		t.Errorf("POST /items/1 = %d, want 200 (отдельная корзина метода)", code)
+	}
+}
+
+func TestRateLimitMiddlewareReadOnlySkipsWrites(t *testing.T) {
+	redisUtil := newTestRedis(t)
+	router := newRateLimitedRouter(redisUtil, RateLimitRule{Scope: "read", RatePerSecond: 0.1, Burst: 1, ReadOnly: true})
+
+	for i := 0; i < 3; i++ {
+		if code := serve(router, http.MethodPost, "/items/1").Code; code != http.StatusOK {
+			t.Fatalf("POST #%d под правилом чтения = %d, want 200", i+1, code)
+		}
+	}
+	serve(router, http.MethodGet, "/items/1")
+	if code := serve(router, http.MethodGet, "/items/1").Code; code != http.StatusTooManyRequests {
+		t.Errorf("второй GET = %d, want 429", code)
+	}
+}
@@ -1,8 +1,10 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"strings"
 
@@ -10,11 +12,13 @@ import (
 	"zephyrvpn/server/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // RecipeController управляет API endpoints для рецептов
 type RecipeController struct {
 	recipeService *services.RecipeService
+	stockService  *services.StockService // Для расчета выпуска из остатков (может быть nil)
 }
 
 // NewRecipeController создает новый контроллер рецептов
@@ -24,12 +28,18 @@ func NewRecipeController(recipeService *services.RecipeService) *RecipeControlle
 	}
 }
 
+// SetStockService подключает сервис остатков
+func (rc *RecipeController) SetStockService(stockService *services.StockService) {
+	rc.stockService = stockService
+}
+
 // GetRecipes возвращает список всех рецептов
 // GET /api/v1/recipes?include_inactive=false
 func (rc *RecipeController) GetRecipes(c *gin.Context) {
 	includeInactive := c.DefaultQuery("include_inactive", "false") == "true"
+	includeDeleted := c.DefaultQuery("include_deleted", "false") == "true"
 
-	recipes, err := rc.recipeService.GetRecipes(includeInactive)
+	recipes, err := rc.recipeService.GetRecipes(includeInactive, includeDeleted)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Ошибка получения рецептов",
@@ -59,6 +69,9 @@ func (rc *RecipeController) GetRecipes(c *gin.Context) {
 		recipeMap["created_at"] = recipe.CreatedAt
 		recipeMap["updated_at"] = recipe.UpdatedAt
 		recipeMap["ingredients"] = recipe.Ingredients
+		if recipe.DeletedAt.Valid {
+			recipeMap["deleted_at"] = recipe.DeletedAt.Time
+		}
 		recipesWithStationIDs[i] = recipeMap
 	}
 
@@ -68,6 +81,70 @@ func (rc *RecipeController) GetRecipes(c *gin.Context) {
 	})
 }
 
+// GetRecipeAllergens возвращает аллергены рецепта с учетом вложенных полуфабрикатов
+// GET /api/v1/recipes/:id/allergens
+func (rc *RecipeController) GetRecipeAllergens(c *gin.Context) {
+	recipeID := c.Param("id")
+	if recipeID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "ID рецепта не указан",
+		})
+		return
+	}
+
+	allergens, err := rc.recipeService.GetRecipeAllergens(recipeID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Ошибка получения аллергенов рецепта",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recipe_id": recipeID,
+		"allergens": allergens,
+		"count":     len(allergens),
+	})
+}
+
+// GetMaxProducible возвращает, сколько порций рецепта можно приготовить из остатков филиала
+// GET /api/v1/recipes/:id/max-producible?branch_id=
+func (rc *RecipeController) GetMaxProducible(c *gin.Context) {
+	if rc.stockService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Сервис остатков недоступен",
+		})
+		return
+	}
+
+	recipeID := c.Param("id")
+	branchID := c.Query("branch_id")
+	if recipeID == "" || branchID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "ID рецепта и branch_id обязательны",
+		})
+		return
+	}
+
+	maxQuantity, bottleneck, err := rc.stockService.GetMaxProducible(recipeID, branchID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Ошибка расчета выпуска",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recipe_id":    recipeID,
+		"branch_id":    branchID,
+		"max_quantity": maxQuantity,
+		"max_portions": int(math.Floor(maxQuantity + 1e-9)), // Целых порций
+		"bottleneck":   bottleneck,
+	})
+}
+
 // GetRecipe возвращает рецепт по ID
 // GET /api/v1/recipes/:id
 func (rc *RecipeController) GetRecipe(c *gin.Context) {
@@ -187,6 +264,10 @@ func (rc *RecipeController) CreateRecipe(c *gin.Context) {
 			statusCode = http.StatusBadRequest
 			errorMsg = "Ошибка валидации данных"
 		}
+		if errors.Is(err, services.ErrInvalidIngredientUnit) {
+			statusCode = http.StatusBadRequest
+			errorMsg = "Недопустимая единица измерения ингредиента"
+		}
 		
 		c.JSON(statusCode, gin.H{
 			"error":   errorMsg,
@@ -286,6 +367,13 @@ func (rc *RecipeController) UnifiedCreateMenuItem(c *gin.Context) {
 	
 	if err != nil {
 		log.Printf("❌ UnifiedCreateMenuItem: ошибка создания: %v", err)
+		if errors.Is(err, services.ErrInvalidIngredientUnit) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Недопустимая единица измерения ингредиента",
+				"details": err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Ошибка создания Menu Item",
 			"details": err.Error(),
@@ -352,6 +440,13 @@ func (rc *RecipeController) UpdateRecipe(c *gin.Context) {
 	}
 
 	if err := rc.recipeService.UpdateRecipe(recipeID, &recipe); err != nil {
+		if errors.Is(err, services.ErrInvalidIngredientUnit) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Недопустимая единица измерения ингредиента",
+				"details": err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Ошибка обновления рецепта",
 			"details": err.Error(),
@@ -416,6 +511,79 @@ func (rc *RecipeController) DeleteRecipe(c *gin.Context) {
 	})
 }
 
+// RestoreRecipe восстанавливает удаленный рецепт
+// POST /api/v1/recipes/:id/restore
+func (rc *RecipeController) RestoreRecipe(c *gin.Context) {
+	recipeID := c.Param("id")
+	if recipeID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "ID рецепта не указан",
+		})
+		return
+	}
+
+	recipe, err := rc.recipeService.RestoreRecipe(recipeID)
+	if err != nil {
+		respondRestoreError(c, "Рецепт не найден", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Рецепт успешно восстановлен",
+		"recipe":  recipe,
+	})
+}
+
+// CloneRecipe создает копию рецепта с ингредиентами под новым именем (черновик, is_active = false)
+// Полуфабрикаты в копии ссылаются на существующие рецепты и не дублируются
+// POST /api/v1/recipes/:id/clone
+func (rc *RecipeController) CloneRecipe(c *gin.Context) {
+	recipeID := c.Param("id")
+	if recipeID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "ID рецепта не указан",
+		})
+		return
+	}
+
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверные параметры запроса",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	recipe, err := rc.recipeService.CloneRecipe(recipeID, req.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Рецепт не найден",
+			})
+		case errors.Is(err, services.ErrRecipeNameConflict):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Рецепт с таким именем уже существует",
+				"details": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Ошибка копирования рецепта",
+				"details": err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Копия рецепта создана как черновик",
+		"recipe":  recipe,
+	})
+}
+
 // GetFolderContent возвращает содержимое папки
 // GET /api/v1/recipes/folder?parent_id=xxx
 func (rc *RecipeController) GetFolderContent(c *gin.Context) {
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"zephyrvpn/server/internal/services"
+)
+
+// respondRedisUnavailable - единый ответ, когда Redis не подключен: 503 и degraded: true
+// Клиенты определяют деградированный режим по флагу degraded, а не по тексту ошибки
+func respondRedisUnavailable(c *gin.Context) {
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error":    services.ErrRedisUnavailable.Error(),
+		"degraded": true,
+	})
+}
+
+// respondDegraded - ответ чтения без Redis там, где пустой список - ожидаемый UX: 200, payload и degraded: true
+func respondDegraded(c *gin.Context, payload gin.H) {
+	payload["degraded"] = true
+	c.JSON(http.StatusOK, payload)
+}
+
+// redisUnavailable отвечает respondRedisUnavailable, если сервис вернул services.ErrRedisUnavailable
+func redisUnavailable(c *gin.Context, err error) bool {
+	if !errors.Is(err, services.ErrRedisUnavailable) {
+		return false
+	}
+	respondRedisUnavailable(c)
+	return true
+}
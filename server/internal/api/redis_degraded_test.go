@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/services"
+)
+
+// degradedResponse - код и тело ответа обработчика без Redis
+func degradedResponse(t *testing.T, router *gin.Engine, method, url, body string) (int, map[string]interface{}) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, url, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, request)
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("%s %s: тело не JSON: %v (%s)", method, url, err, recorder.Body.String())
+	}
+	return recorder.Code, payload
+}
+
+func TestERPControllerWithoutRedisRespondsDegraded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ec := NewERPController(nil, "", "", nil, 0, 0, 23, 59)
+	router := gin.New()
+	router.GET("/orders", ec.GetOrders)
+	router.GET("/orders/pending", ec.GetPendingOrders)
+	router.GET("/orders/batch", ec.GetOrdersBatch)
+	router.GET("/orders/by-slot", ec.GetOrdersBySlot)
+	router.GET("/orders/:id", ec.GetOrder)
+	router.POST("/orders/:id/cancel", ec.CancelOrder)
+	router.POST("/orders/:id/ready", ec.MarkOrderReady)
+	router.PUT("/slots/:slot_id/toggle", ec.ToggleSlot)
+
+	// Чтения, где пустой список - ожидаемый UX: 200 с прежним payload и флагом degraded
+	for _, url := range []string{"/orders", "/orders/pending", "/orders/batch"} {
+		code, payload := degradedResponse(t, router, http.MethodGet, url, "")
+		if code != http.StatusOK || payload["degraded"] != true {
+			t.Errorf("GET %s = %d, degraded %v; want 200 и true", url, code, payload["degraded"])
+		}
+		if orders, ok := payload["orders"].([]interface{}); !ok || len(orders) != 0 {
+			t.Errorf("GET %s: orders = %v, want пустой список", url, payload["orders"])
+		}
+	}
+
+	// Остальные - один и тот же 503 независимо от обработчика
+	cases := []struct {
+		method, url, body string
+	}{
+		{http.MethodGet, "/orders/by-slot", ""},
+		{http.MethodGet, "/orders/42", ""},
+		{http.MethodPost, "/orders/42/cancel", `{"reason":"test"}`},
+		{http.MethodPost, "/orders/42/ready", ""},
+		{http.MethodPut, "/slots/slot:1700000000/toggle", `{"disabled":true}`},
+	}
+	for _, tc := range cases {
+		code, payload := degradedResponse(t, router, tc.method, tc.url, tc.body)
+		if code != http.StatusServiceUnavailable {
+			t.Errorf("%s %s = %d, want 503", tc.method, tc.url, code)
+		}
+		if payload["degraded"] != true || payload["error"] != services.ErrRedisUnavailable.Error() {
+			t.Errorf("%s %s: тело %v, want error %q и degraded: true", tc.method, tc.url, payload, services.ErrRedisUnavailable.Error())
+		}
+	}
+}
+
+func TestCreateOrderWithoutRedisRespondsDegraded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	previous := models.GetAllPizzas()
+	models.SetPizzas(map[string]models.Pizza{"Маргарита": {Name: "Маргарита", Price: 500}})
+	t.Cleanup(func() { models.SetPizzas(previous) })
+
+	oc := NewOrderController(nil, nil, nil, 0, 0, 23, 59)
+	router := gin.New()
+	router.POST("/orders", oc.CreateOrder)
+
+	// Без Redis слот не назначить - заказ не создается, ответ тот же, что у ERP
+	code, payload := degradedResponse(t, router, http.MethodPost, "/orders", `{"items":[{"pizza_name":"Маргарита","quantity":1}]}`)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("POST /orders = %d, want 503", code)
+	}
+	if payload["degraded"] != true || payload["error"] != services.ErrRedisUnavailable.Error() {
+		t.Errorf("POST /orders: тело %v, want error %q и degraded: true", payload, services.ErrRedisUnavailable.Error())
+	}
+}
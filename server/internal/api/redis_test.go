@@ -0,0 +1,13 @@
+package api
+
+import (
+	"testing"
+
+	"zephyrvpn/server/internal/utils"
+	"zephyrvpn/server/internal/utils/redistest"
+)
+
+// newTestRedis - тестовый Redis из TEST_REDIS_URL (см. redistest.New); без TEST_REDIS_URL тест пропускается
+func newTestRedis(t *testing.T) *utils.RedisClient {
+	return redistest.New(t)
+}
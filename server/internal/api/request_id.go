@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/grpc/metadata"
+	"zephyrvpn/server/internal/utils"
+)
+
+// requestIDContextKey - ключ ID запроса в gin.Context
+const requestIDContextKey = "request_id"
+
+// maxRequestIDLength - входящий X-Request-ID длиннее этого значения игнорируется (защита логов)
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware читает X-Request-ID из запроса или генерирует новый
+// ID сохраняется в gin.Context и в context запроса, возвращается клиенту в заголовке ответа
+// и дальше передается в Kafka (заголовок сообщения) и в WebSocket обновления ERP
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(utils.RequestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = utils.NewRequestID()
+		}
+
+		c.Set(requestIDContextKey, requestID)
+		c.Request = c.Request.WithContext(utils.WithRequestID(c.Request.Context(), requestID))
+		c.Header(utils.RequestIDHeader, requestID)
+
+		c.Next()
+	}
+}
+
+// GetRequestID возвращает ID текущего запроса (пустая строка, если middleware не подключен)
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(requestIDContextKey)
+}
+
+// requestIDFromGRPC берет ID запроса из gRPC metadata (x-request-id) или генерирует новый
+func requestIDFromGRPC(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(utils.RequestIDHeader); len(values) > 0 && values[0] != "" && len(values[0]) <= maxRequestIDLength {
+			return values[0]
+		}
+	}
+	return utils.NewRequestID()
+}
+
+// kafkaRequestIDHeaders формирует заголовки Kafka сообщения с ID запроса
+func kafkaRequestIDHeaders(requestID string) []kafka.Header {
+	if requestID == "" {
+		return nil
+	}
+	return []kafka.Header{{Key: utils.RequestIDHeader, Value: []byte(requestID)}}
+}
+
+// requestIDFromKafkaMessage достает ID запроса из заголовков Kafka сообщения
+func requestIDFromKafkaMessage(msg kafka.Message) string {
+	for _, header := range msg.Headers {
+		if strings.EqualFold(header.Key, utils.RequestIDHeader) {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/grpc/metadata"
+	"zephyrvpn/server/internal/utils"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestIDMiddleware())
+	router.GET("/order", func(c *gin.Context) {
+		// ID доступен и в gin.Context, и в context запроса (дальше он уходит в Kafka и WebSocket)
+		if GetRequestID(c) != utils.RequestIDFromContext(c.Request.Context()) {
+			t.Errorf("ID в gin.Context %q и в context запроса %q различаются", GetRequestID(c), utils.RequestIDFromContext(c.Request.Context()))
+		}
+		c.String(http.StatusOK, GetRequestID(c))
+	})
+
+	cases := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"входящий ID сохраняется", "req-123", true},
+		{"без заголовка генерируется", "", false},
+		{"слишком длинный заменяется", strings.Repeat("x", maxRequestIDLength+1), false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/order", nil)
+			if tc.incoming != "" {
+				request.Header.Set(utils.RequestIDHeader, tc.incoming)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			got := recorder.Header().Get(utils.RequestIDHeader)
+			if got == "" || got != recorder.Body.String() {
+				t.Fatalf("X-Request-ID ответа %q, ID в обработчике %q", got, recorder.Body.String())
+			}
+			if tc.keep && got != tc.incoming {
+				t.Errorf("X-Request-ID = %q, want входящий %q", got, tc.incoming)
+			}
+			if !tc.keep && got == tc.incoming {
+				t.Errorf("входящий X-Request-ID %q не заменен", tc.incoming)
+			}
+		})
+	}
+}
+
+func TestKafkaRequestIDRoundTrip(t *testing.T) {
+	msg := kafka.Message{Headers: kafkaRequestIDHeaders("req-42")}
+	if got := requestIDFromKafkaMessage(msg); got != "req-42" {
+		t.Errorf("ID из заголовков Kafka = %q, want req-42", got)
+	}
+
+	// Регистр ключа заголовка не важен (другие продюсеры пишут x-request-id)
+	msg = kafka.Message{Headers: []kafka.Header{{Key: "x-request-id", Value: []byte("req-7")}}}
+	if got := requestIDFromKafkaMessage(msg); got != "req-7" {
+		t.Errorf("ID из заголовка x-request-id = %q, want req-7", got)
+	}
+
+	if headers := kafkaRequestIDHeaders(""); headers != nil {
+		t.Errorf("пустой ID дал заголовки %v, want nil", headers)
+	}
+	if got := requestIDFromKafkaMessage(kafka.Message{}); got != "" {
+		t.Errorf("ID сообщения без заголовков = %q, want пусто", got)
+	}
+}
+
+func TestRequestIDFromGRPC(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "req-grpc"))
+	if got := requestIDFromGRPC(ctx); got != "req-grpc" {
+		t.Errorf("ID из gRPC metadata = %q, want req-grpc", got)
+	}
+
+	for _, ctx := range []context.Context{
+		context.Background(),
+		metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", strings.Repeat("x", maxRequestIDLength+1))),
+	} {
+		if got := requestIDFromGRPC(ctx); got == "" || len(got) > maxRequestIDLength {
+			t.Errorf("сгенерированный ID = %q, want новый UUID", got)
+		}
+	}
+}
@@ -494,3 +494,32 @@ func (sc *StationsController) UpdateOrderItemStatus(c *gin.Context) {
 }
 
 
+
+// GetStationLoad возвращает загрузку станций: позиции в очереди/в работе и среднее время выполнения
+// GET /api/v1/erp/stations/load?branch_id=xxx
+func (sc *StationsController) GetStationLoad(c *gin.Context) {
+	if sc.db == nil || sc.redisUtil == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Database or Redis not available",
+		})
+		return
+	}
+
+	branchID := c.Query("branch_id")
+	stationAssignService := services.NewStationAssignmentService(sc.db, sc.redisUtil)
+
+	loads, err := stationAssignService.GetStationLoad(branchID)
+	if err != nil {
+		log.Printf("❌ GetStationLoad: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get station load",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"stations": loads,
+		"count":    len(loads),
+	})
+}
@@ -1,19 +1,24 @@
 package api
 
 import (
+	"errors"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
 
 	"zephyrvpn/server/internal/models"
 	"zephyrvpn/server/internal/services"
+	"zephyrvpn/server/internal/utils/timefmt"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // StockController управляет API endpoints для остатков
 type StockController struct {
-	stockService *services.StockService
+	stockService  *services.StockService
+	branchService *services.BranchService // Проверка branch_id и филиал по умолчанию (может быть nil)
 }
 
 // NewStockController создает новый контроллер остатков
@@ -23,14 +28,44 @@ func NewStockController(stockService *services.StockService) *StockController {
 	}
 }
 
+// SetBranchService включает проверку branch_id складских операций по списку филиалов
+func (sc *StockController) SetBranchService(branchService *services.BranchService) {
+	sc.branchService = branchService
+}
+
 // GetStockItems возвращает остатки товаров
-// GET /api/v1/inventory/stock?branch_id=xxx&include_expired=true
+// GET /api/v1/inventory/stock?branch_id=xxx&include_expired=true&nomenclature_id=yyy
+// Разбивка по партиям (batches) заполняется только для одного товара (nomenclature_id), в общем списке она пустая
+//
+// @Summary      Остатки товаров
+// @Description  Остатки по номенклатуре; с nomenclature_id - остатки одного товара с разбивкой по партиям (FEFO)
+// @Tags         stock
+// @Produce      json
+// @Param        branch_id        query     string  false  "ID филиала или all"  default(all)
+// @Param        include_expired  query     bool    false  "Включать просроченные партии"  default(false)
+// @Param        nomenclature_id  query     string  false  "ID товара: вернуть его остатки с партиями"
+// @Param        precision        query     string  false  "full - без округления количеств и стоимости"
+// @Success      200              {object}  StockItemsResponse
+// @Failure      500              {object}  ErrorResponse
+// @Router       /inventory/stock [get]
 func (sc *StockController) GetStockItems(c *gin.Context) {
 	branchID := c.DefaultQuery("branch_id", "all")
+	if branchID != "all" {
+		var ok bool
+		if branchID, ok = resolveBranchID(c, sc.branchService, branchID, true); !ok {
+			return
+		}
+	}
 	includeExpiredStr := c.DefaultQuery("include_expired", "false")
 	includeExpired, _ := strconv.ParseBool(includeExpiredStr)
 	
-	items, err := sc.stockService.GetStockItems(branchID, includeExpired)
+	var items []map[string]interface{}
+	var err error
+	if nomenclatureID := c.Query("nomenclature_id"); nomenclatureID != "" {
+		items, err = sc.stockService.GetStockItemBatches(nomenclatureID, branchID, includeExpired)
+	} else {
+		items, err = sc.stockService.GetStockItems(branchID, includeExpired)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Ошибка получения остатков",
@@ -38,6 +73,10 @@ func (sc *StockController) GetStockItems(c *gin.Context) {
 		})
 		return
 	}
+	// precision=full - сырые значения без округления (для отладки)
+	if c.Query("precision") != "full" {
+		sc.stockService.RoundStockItems(items)
+	}
 	
 	c.JSON(http.StatusOK, gin.H{
 		"items": items,
@@ -45,6 +84,35 @@ func (sc *StockController) GetStockItems(c *gin.Context) {
 	})
 }
 
+// GetStockByZone возвращает текущие остатки филиала, сгруппированные по зонам хранения, с итогами по зонам
+// GET /api/v1/inventory/stock/by-zone?branch_id=xxx
+func (sc *StockController) GetStockByZone(c *gin.Context) {
+	branchID := c.Query("branch_id")
+	if branchID == "" || branchID == "all" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "branch_id обязателен",
+		})
+		return
+	}
+
+	zones, err := sc.stockService.GetStockByZone(branchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка получения остатков по зонам хранения",
+			"details": err.Error(),
+		})
+		return
+	}
+	if c.Query("precision") != "full" {
+		sc.stockService.RoundStockZones(zones)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"branch_id": branchID,
+		"zones":     zones,
+	})
+}
+
 // GetAtRiskInventory возвращает товары с риском истечения срока годности
 // GET /api/v1/inventory/stock/at-risk?branch_id=xxx
 func (sc *StockController) GetAtRiskInventory(c *gin.Context) {
@@ -65,6 +133,33 @@ func (sc *StockController) GetAtRiskInventory(c *gin.Context) {
 	})
 }
 
+// GetMarkdownSuggestions возвращает план скидок на рискованные партии, которые не успеем продать по полной цене
+// GET /api/v1/inventory/stock/markdown-suggestions?branch_id=xxx
+func (sc *StockController) GetMarkdownSuggestions(c *gin.Context) {
+	branchID := c.Query("branch_id")
+	if branchID == "" || branchID == "all" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "branch_id обязателен",
+		})
+		return
+	}
+
+	suggestions, err := sc.stockService.GetMarkdownSuggestions(branchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка расчета скидок",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"branch_id":   branchID,
+		"suggestions": suggestions,
+		"count":       len(suggestions),
+	})
+}
+
 // GetExpiryAlerts возвращает активные уведомления о сроке годности
 // GET /api/v1/inventory/stock/expiry-alerts?branch_id=xxx&alert_type=warning|critical
 func (sc *StockController) GetExpiryAlerts(c *gin.Context) {
@@ -86,13 +181,91 @@ func (sc *StockController) GetExpiryAlerts(c *gin.Context) {
 	})
 }
 
+// expiryAlertResolveRequest - тело запроса закрытия уведомлений о сроке годности
+type expiryAlertResolveRequest struct {
+	AlertIDs      []string `json:"alert_ids"`
+	Reason        string   `json:"reason" binding:"required"` // consumed | written_off | ignored
+	WriteOffBatch bool     `json:"write_off_batch"`           // Для written_off: списать остаток партии
+}
+
+// ResolveExpiryAlert закрывает одно уведомление о сроке годности
+// POST /api/v1/inventory/stock/expiry-alerts/:id/resolve
+// Body: {"reason": "written_off", "write_off_batch": true}
+func (sc *StockController) ResolveExpiryAlert(c *gin.Context) {
+	var req expiryAlertResolveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверные данные",
+			"details": err.Error(),
+		})
+		return
+	}
+	req.AlertIDs = []string{c.Param("id")}
+	sc.resolveExpiryAlerts(c, req)
+}
+
+// ResolveExpiryAlerts закрывает несколько уведомлений о сроке годности
+// POST /api/v1/inventory/stock/expiry-alerts/resolve
+// Body: {"alert_ids": ["..."], "reason": "consumed"}
+func (sc *StockController) ResolveExpiryAlerts(c *gin.Context) {
+	var req expiryAlertResolveRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.AlertIDs) == 0 {
+		details := "alert_ids обязателен"
+		if err != nil {
+			details = err.Error()
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверные данные",
+			"details": details,
+		})
+		return
+	}
+	sc.resolveExpiryAlerts(c, req)
+}
+
+// resolveExpiryAlerts - общая часть ResolveExpiryAlert и ResolveExpiryAlerts
+func (sc *StockController) resolveExpiryAlerts(c *gin.Context, req expiryAlertResolveRequest) {
+	performedBy := c.GetString("user_id")
+	if performedBy == "" {
+		performedBy = "system"
+	}
+
+	alerts, err := sc.stockService.ResolveExpiryAlerts(services.ExpiryAlertResolution{
+		AlertIDs:      req.AlertIDs,
+		Reason:        req.Reason,
+		WriteOffBatch: req.WriteOffBatch,
+		PerformedBy:   performedBy,
+	})
+	if err != nil {
+		statusCode := http.StatusBadRequest
+		if errors.Is(err, services.ErrExpiryAlertResolved) {
+			statusCode = http.StatusConflict
+		}
+		c.JSON(statusCode, gin.H{
+			"error":   "Ошибка закрытия уведомлений",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"alerts":   alerts,
+		"resolved": len(alerts),
+	})
+}
+
 // ProcessSaleDepletion обрабатывает списание ингредиентов при продаже
 // POST /api/v1/inventory/stock/process-sale
+// is_set = true - продан набор set_name: списываются рецепты всех его пицц одной транзакцией
+// При нехватке любого ингредиента возвращает 409 и ничего не списывает
 func (sc *StockController) ProcessSaleDepletion(c *gin.Context) {
 	var request struct {
-		RecipeID    string  `json:"recipe_id" binding:"required"`
+		RecipeID    string  `json:"recipe_id"` // Обязателен, если is_set = false
+		IsSet       bool    `json:"is_set"`    // Продан набор: списываются рецепты всех пицц набора
+		SetName     string  `json:"set_name"`  // Обязателен, если is_set = true
 		Quantity    float64 `json:"quantity" binding:"required"`
-		BranchID    string  `json:"branch_id" binding:"required"`
+		BranchID    string  `json:"branch_id"` // Пусто - филиал по умолчанию
 		PerformedBy string  `json:"performed_by" binding:"required"`
 		SaleID      string  `json:"sale_id" binding:"required"`
 	}
@@ -104,15 +277,55 @@ func (sc *StockController) ProcessSaleDepletion(c *gin.Context) {
 		})
 		return
 	}
+
+	branchID, ok := resolveBranchID(c, sc.branchService, request.BranchID, true)
+	if !ok {
+		return
+	}
+	request.BranchID = branchID
+
+	if request.IsSet && request.SetName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "set_name обязателен для набора",
+		})
+		return
+	}
+	if !request.IsSet && request.RecipeID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "recipe_id обязателен",
+		})
+		return
+	}
 	
-	if err := sc.stockService.ProcessSaleDepletion(
-		request.RecipeID,
-		request.Quantity,
-		request.BranchID,
-		request.PerformedBy,
-		request.SaleID,
-	); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+	var err error
+	if request.IsSet {
+		err = sc.stockService.ProcessSetDepletion(
+			request.SetName,
+			request.Quantity,
+			request.BranchID,
+			request.PerformedBy,
+			request.SaleID,
+		)
+	} else {
+		err = sc.stockService.ProcessSaleDepletion(
+			request.RecipeID,
+			request.Quantity,
+			request.BranchID,
+			request.PerformedBy,
+			request.SaleID,
+		)
+	}
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrInsufficientStock):
+			statusCode = http.StatusConflict
+		case errors.Is(err, services.ErrSetNotFound):
+			statusCode = http.StatusNotFound
+		case errors.Is(err, services.ErrSetRecipeMissing):
+			statusCode = http.StatusUnprocessableEntity
+		}
+		c.JSON(statusCode, gin.H{
 			"error":   "Ошибка обработки списания",
 			"details": err.Error(),
 		})
@@ -130,7 +343,7 @@ func (sc *StockController) CommitProduction(c *gin.Context) {
 	var request struct {
 		RecipeID          string  `json:"recipe_id" binding:"required"`
 		Quantity          float64 `json:"quantity" binding:"required"` // Количество в граммах
-		BranchID          string  `json:"branch_id" binding:"required"`
+		BranchID          string  `json:"branch_id"` // Пусто - филиал по умолчанию
 		PerformedBy      string  `json:"performed_by" binding:"required"`
 		ProductionOrderID string  `json:"production_order_id" binding:"required"`
 	}
@@ -143,6 +356,12 @@ func (sc *StockController) CommitProduction(c *gin.Context) {
 		return
 	}
 
+	branchID, ok := resolveBranchID(c, sc.branchService, request.BranchID, true)
+	if !ok {
+		return
+	}
+	request.BranchID = branchID
+
 	if err := sc.stockService.CommitProduction(
 		request.RecipeID,
 		request.Quantity,
@@ -163,7 +382,9 @@ func (sc *StockController) CommitProduction(c *gin.Context) {
 }
 
 // GetRecipePrimeCost возвращает себестоимость рецепта
-// GET /api/v1/inventory/recipes/:id/prime-cost
+// GET /api/v1/inventory/stock/recipes/:id/prime-cost?source=last_price|stock&branch_id=xxx
+// source=last_price (по умолчанию) - сырье по цене последней закупки;
+// source=stock - по средневзвешенной цене текущих остатков филиала (branch_id обязателен)
 func (sc *StockController) GetRecipePrimeCost(c *gin.Context) {
 	recipeID := c.Param("id")
 	if recipeID == "" {
@@ -173,7 +394,42 @@ func (sc *StockController) GetRecipePrimeCost(c *gin.Context) {
 		return
 	}
 
-	cost, err := sc.stockService.CalculatePrimeCost(recipeID, nil)
+	source := c.DefaultQuery("source", "last_price")
+	switch source {
+	case "last_price":
+	case "stock":
+		branchID := c.Query("branch_id")
+		if branchID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Для source=stock нужен branch_id",
+			})
+			return
+		}
+		result, err := sc.stockService.CalculatePrimeCostFromStock(recipeID, branchID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Ошибка расчета себестоимости",
+				"details": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"recipe_id":           recipeID,
+			"prime_cost":          result.PrimeCost,
+			"currency":            "RUB",
+			"source":              source,
+			"branch_id":           branchID,
+			"last_price_fallback": result.LastPriceFallback,
+		})
+		return
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Неверный source, допустимо: last_price, stock",
+		})
+		return
+	}
+
+	cost, err := sc.stockService.CalculatePrimeCost(recipeID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Ошибка расчета себестоимости",
@@ -183,9 +439,47 @@ func (sc *StockController) GetRecipePrimeCost(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"recipe_id": recipeID,
+		"recipe_id":  recipeID,
 		"prime_cost": cost,
 		"currency":   "RUB",
+		"source":     source,
+	})
+}
+
+// GetRecipePrimeCostBreakdown возвращает себестоимость рецепта по ингредиентам: количество, цена, стоимость и доля
+// Полуфабрикаты раскрываются рекурсивно (components)
+// GET /api/v1/inventory/stock/recipes/:id/prime-cost-breakdown
+func (sc *StockController) GetRecipePrimeCostBreakdown(c *gin.Context) {
+	recipeID := c.Param("id")
+	if recipeID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "ID рецепта не указан",
+		})
+		return
+	}
+
+	lines, err := sc.stockService.GetPrimeCostBreakdown(recipeID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"error":   "Ошибка расчета себестоимости",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	var primeCost float64
+	for _, line := range lines {
+		primeCost += line.LineCost
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"recipe_id":  recipeID,
+		"prime_cost": primeCost,
+		"currency":   "RUB",
+		"lines":      lines,
 	})
 }
 
@@ -205,6 +499,22 @@ func (sc *StockController) CheckExpiryAlerts(c *gin.Context) {
 	})
 }
 
+// RecomputeExpiry синхронно пересчитывает is_expired по всем филиалам и создает недостающие уведомления
+// Ручное восстановление, если периодическая проверка не работала (сервер был остановлен ночью)
+// POST /api/v1/inventory/stock/recompute-expiry
+func (sc *StockController) RecomputeExpiry(c *gin.Context) {
+	summary, err := sc.stockService.RecomputeExpiry()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка пересчета сроков годности",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
 // ProcessInboundInvoice обрабатывает входящую накладную
 // POST /api/v1/inventory/stock/process-inbound-invoice
 func (sc *StockController) ProcessInboundInvoice(c *gin.Context) {
@@ -225,8 +535,18 @@ func (sc *StockController) ProcessInboundInvoice(c *gin.Context) {
 		})
 		return
 	}
+
+	// Филиал каждой строки: неизвестный branch_id - 400, пустой - филиал по умолчанию
+	for _, item := range request.Items {
+		rawBranchID, _ := item["branch_id"].(string)
+		branchID, ok := resolveBranchID(c, sc.branchService, rawBranchID, true)
+		if !ok {
+			return
+		}
+		item["branch_id"] = branchID
+	}
 	
-	if err := sc.stockService.ProcessInboundInvoice(
+	result, err := sc.stockService.ProcessInboundInvoice(
 		request.InvoiceID,
 		request.Items,
 		request.PerformedBy,
@@ -234,7 +554,8 @@ func (sc *StockController) ProcessInboundInvoice(c *gin.Context) {
 		request.TotalAmount,
 		request.IsPaidCash,
 		request.InvoiceDate,
-	); err != nil {
+	)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Ошибка обработки накладной",
 			"details": err.Error(),
@@ -242,29 +563,46 @@ func (sc *StockController) ProcessInboundInvoice(c *gin.Context) {
 		return
 	}
 	
+	message := "Накладная успешно обработана"
+	if result.AlreadyProcessed {
+		message = "Накладная уже была проведена, повторное оприходование не выполнялось"
+	}
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Накладная успешно обработана",
-		"invoice_id": request.InvoiceID,
-		"items_count": len(request.Items),
+		"message":           message,
+		"invoice_id":        result.InvoiceID,
+		"invoice_number":    result.Number,
+		"items_count":       len(request.Items),
+		"batches_created":   result.BatchesCreated,
+		"already_processed": result.AlreadyProcessed,
 	})
 }
 
 // GetStockMovements возвращает список движений склада с фильтрацией
-// GET /api/v1/inventory/stock/movements?branch_id=xxx&movement_type=sale&date_from=2024-01-01&date_to=2024-12-31&search=мука&limit=1000
+// GET /api/v1/inventory/stock/movements?branch_id=xxx&movement_type=sale&date_from=2024-01-01&date_to=2024-12-31&search=мука&nomenclature_id=xxx&performed_by=ivan&limit=1000&offset=0
+// total - количество движений по фильтрам, next_offset - смещение следующей страницы
 func (sc *StockController) GetStockMovements(c *gin.Context) {
-	branchID := c.DefaultQuery("branch_id", "all")
-	movementType := c.DefaultQuery("movement_type", "")
-	dateFrom := c.DefaultQuery("date_from", "")
-	dateTo := c.DefaultQuery("date_to", "")
-	searchQuery := c.DefaultQuery("search", "")
-	
-	limitStr := c.DefaultQuery("limit", "1000")
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil || limit <= 0 {
+	filter := services.StockMovementFilter{
+		BranchID:       c.DefaultQuery("branch_id", "all"),
+		MovementType:   c.DefaultQuery("movement_type", ""),
+		NomenclatureID: c.Query("nomenclature_id"),
+		PerformedBy:    c.Query("performed_by"),
+		DateFrom:       c.DefaultQuery("date_from", ""),
+		DateTo:         c.DefaultQuery("date_to", ""),
+		Search:         c.DefaultQuery("search", ""),
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "1000"))
+	if err != nil || limit <= 0 || limit > 10000 {
 		limit = 1000
 	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	filter.Limit = limit
+	filter.Offset = offset
 
-	movements, err := sc.stockService.GetStockMovements(branchID, movementType, dateFrom, dateTo, searchQuery, limit)
+	movements, total, err := sc.stockService.GetStockMovements(filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Ошибка получения движений",
@@ -273,9 +611,225 @@ func (sc *StockController) GetStockMovements(c *gin.Context) {
 		return
 	}
 
+	// next_offset - смещение следующей страницы (null, если это последняя)
+	var nextOffset *int
+	if next := offset + len(movements); len(movements) > 0 && int64(next) < total {
+		nextOffset = &next
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"movements": movements,
-		"count":     len(movements),
+		"movements":   movements,
+		"count":       len(movements),
+		"total":       total,
+		"offset":      offset,
+		"limit":       limit,
+		"next_offset": nextOffset,
+	})
+}
+
+// CorrectBatchCost исправляет цену партии (вместо автоматического ×1000 при чтении остатков)
+// PUT /api/v1/inventory/stock/batches/:id/cost
+// Body: {"cost_per_unit": 1234.0, "reason": "цена введена за грамм"}
+// Доступ только для администратора (RequireAdminRole), изменение пишется в журнал движений
+func (sc *StockController) CorrectBatchCost(c *gin.Context) {
+	batchID := c.Param("id")
+
+	var req struct {
+		CostPerUnit *float64 `json:"cost_per_unit" binding:"required"`
+		Reason      string   `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверные данные",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	performedBy := c.GetString("user_id")
+	if performedBy == "" {
+		performedBy = "admin"
+	}
+
+	batch, err := sc.stockService.CorrectBatchCost(batchID, *req.CostPerUnit, performedBy, req.Reason)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Ошибка исправления цены партии",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"batch":   batch,
+	})
+}
+
+// GetAgingReport возвращает остатки по возрасту партий на складе (0-7, 8-30, 31-90, 90+ дней)
+// GET /api/v1/inventory/stock/aging?branch_id=xxx
+func (sc *StockController) GetAgingReport(c *gin.Context) {
+	branchID := c.DefaultQuery("branch_id", "all")
+
+	buckets, err := sc.stockService.GetAgingReport(branchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка построения отчета по возрасту остатков",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	totals := make(map[string]float64)
+	for _, bucket := range buckets {
+		totals[bucket.Bucket] += bucket.Value
+	}
+	for label, value := range totals {
+		totals[label] = math.Round(value*100) / 100
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"buckets":         buckets,
+		"count":           len(buckets),
+		"value_by_bucket": totals,
+	})
+}
+
+// GetSuspectedCostErrors возвращает партии с подозрительно низкой ценой (возможно, введена цена за грамм)
+// GET /api/v1/inventory/stock/batches/suspected-cost-errors?branch_id=xxx
+// Ничего не меняет: по списку цены исправляются через PUT /batches/:id/cost
+func (sc *StockController) GetSuspectedCostErrors(c *gin.Context) {
+	branchID := c.DefaultQuery("branch_id", "all")
+
+	suspects, err := sc.stockService.FindSuspectedCostErrors(branchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка поиска подозрительных цен",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"batches": suspects,
+		"count":   len(suspects),
+	})
+}
+
+// GetOrphanedBatches возвращает партии с остатком, номенклатура которых удалена
+// GET /api/v1/inventory/stock/orphaned-batches?branch_id=xxx
+// Такие партии не попадают в GET /inventory/stock, их списывают или перепривязывают через /reconcile
+func (sc *StockController) GetOrphanedBatches(c *gin.Context) {
+	branchID := c.DefaultQuery("branch_id", "all")
+
+	batches, err := sc.stockService.GetOrphanedBatches(branchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка поиска осиротевших партий",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"batches": batches,
+		"count":   len(batches),
+	})
+}
+
+// ReconcileOrphanedBatches списывает или перепривязывает партии удаленной номенклатуры
+// POST /api/v1/inventory/stock/orphaned-batches/reconcile
+// Body: {"batch_ids": ["..."], "action": "write_off"} или {"batch_ids": ["..."], "action": "relink", "target_nomenclature_id": "..."}
+// Доступ только для администратора (RequireAdminRole), изменения пишутся в журнал движений
+func (sc *StockController) ReconcileOrphanedBatches(c *gin.Context) {
+	var req struct {
+		BatchIDs             []string `json:"batch_ids" binding:"required"`
+		Action               string   `json:"action" binding:"required"`
+		TargetNomenclatureID string   `json:"target_nomenclature_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверные данные",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	performedBy := c.GetString("user_id")
+	if performedBy == "" {
+		performedBy = "admin"
+	}
+
+	processed, err := sc.stockService.ReconcileOrphanedBatches(req.BatchIDs, req.Action, req.TargetNomenclatureID, performedBy)
+	if err != nil {
+		statusCode := http.StatusBadRequest
+		if errors.Is(err, services.ErrBatchNotOrphaned) {
+			statusCode = http.StatusConflict
+		}
+		c.JSON(statusCode, gin.H{
+			"error":   "Ошибка сверки осиротевших партий",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"action":    req.Action,
+		"processed": processed,
+	})
+}
+
+// GetValuationHistory возвращает стоимость склада по дням из ежедневных снимков
+// GET /api/v1/inventory/stock/valuation-history?branch_id=xxx&from=2024-03-01&to=2024-03-31
+// По умолчанию - последние 30 дней
+func (sc *StockController) GetValuationHistory(c *gin.Context) {
+	branchID := c.DefaultQuery("branch_id", "all")
+
+	to := time.Now().UTC()
+	if toStr := c.Query("to"); toStr != "" {
+		parsed, err := timefmt.Parse(toStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Неверный формат даты to (ожидается " + timefmt.Accepted + ")",
+				"details": err.Error(),
+			})
+			return
+		}
+		to = parsed
+	}
+	from := to.AddDate(0, 0, -30)
+	if fromStr := c.Query("from"); fromStr != "" {
+		parsed, err := timefmt.Parse(fromStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Неверный формат даты from (ожидается " + timefmt.Accepted + ")",
+				"details": err.Error(),
+			})
+			return
+		}
+		from = parsed
+	}
+	if from.After(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Дата from должна быть не позже to"})
+		return
+	}
+
+	history, err := sc.stockService.GetValuationHistory(branchID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка получения истории оценки склада",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"branch_id": branchID,
+		"from":      timefmt.FormatDate(from),
+		"to":        timefmt.FormatDate(to),
+		"history":   history,
+		"count":     len(history),
 	})
 }
 
@@ -285,7 +839,7 @@ func (sc *StockController) CreateInvoice(c *gin.Context) {
 	var request struct {
 		Number        string  `json:"number" binding:"required"`
 		CounterpartyID *string `json:"counterparty_id"`
-		BranchID      string  `json:"branch_id" binding:"required"`
+		BranchID      string  `json:"branch_id"` // Пусто - филиал по умолчанию
 		TotalAmount   float64 `json:"total_amount" binding:"required"`
 		InvoiceDate   string  `json:"invoice_date"` // Формат: 2006-01-02
 		IsPaidCash    bool    `json:"is_paid_cash"`
@@ -302,6 +856,12 @@ func (sc *StockController) CreateInvoice(c *gin.Context) {
 		})
 		return
 	}
+
+	branchID, ok := resolveBranchID(c, sc.branchService, request.BranchID, true)
+	if !ok {
+		return
+	}
+	request.BranchID = branchID
 	
 	invoice, err := sc.stockService.CreateInvoice(
 		request.Number,
@@ -437,7 +997,7 @@ func (sc *StockController) mapInvoiceToResponse(invoice models.Invoice) InvoiceR
 		// Форматируем expiry_date
 		var expiryDateStr *string
 		if batch.ExpiryAt != nil {
-			formatted := batch.ExpiryAt.Format("2006-01-02")
+			formatted := timefmt.FormatDate(*batch.ExpiryAt)
 			expiryDateStr = &formatted
 		}
 		
@@ -471,12 +1031,12 @@ func (sc *StockController) mapInvoiceToResponse(invoice models.Invoice) InvoiceR
 		Branch:         invoice.Branch,
 		TotalAmount:    finalTotalAmount,
 		Status:         string(invoice.Status),
-		InvoiceDate:    invoice.InvoiceDate.Format("2006-01-02"),
+		InvoiceDate:    timefmt.FormatDate(invoice.InvoiceDate),
 		IsPaidCash:     invoice.IsPaidCash,
 		PerformedBy:    invoice.PerformedBy,
 		Notes:          invoice.Notes,
-		CreatedAt:      invoice.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:      invoice.UpdatedAt.Format(time.RFC3339),
+		CreatedAt:      timefmt.Format(invoice.CreatedAt),
+		UpdatedAt:      timefmt.Format(invoice.UpdatedAt),
 		Items:          items,
 	}
 }
@@ -570,8 +1130,62 @@ func (sc *StockController) DeleteInvoice(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Накладная успешно удалена"})
 }
 
+// VoidInvoice аннулирует проведенную накладную с откатом оприходования
+// POST /api/v1/inventory/stock/invoices/:id/void
+// Body: {"performed_by": "...", "reason": "..."}
+// 409 - часть товара из накладной уже израсходована (в ответе список партий)
+func (sc *StockController) VoidInvoice(c *gin.Context) {
+	invoiceID := c.Param("id")
+	if invoiceID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID накладной не указан"})
+		return
+	}
+
+	var request struct {
+		PerformedBy string `json:"performed_by"`
+		Reason      string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверные параметры запроса",
+			"details": err.Error(),
+		})
+		return
+	}
+	if request.PerformedBy == "" {
+		request.PerformedBy = "system"
+	}
+
+	invoice, err := sc.stockService.VoidInvoice(invoiceID, request.PerformedBy, request.Reason)
+	if err != nil {
+		var conflict *services.InvoiceVoidConflictError
+		if errors.As(err, &conflict) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Накладную нельзя аннулировать: товар из нее уже израсходован",
+				"details": err.Error(),
+				"batches": conflict.Batches,
+			})
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Накладная не найдена",
+				"details": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Ошибка аннулирования накладной",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, invoice)
+}
+
 // GetBatchesHistory возвращает историю всех батчей для конкретной номенклатуры
-// GET /api/v1/inventory/stock/batches-history?nomenclature_id=xxx&branch_id=xxx
+// GET /api/v1/inventory/stock/batches-history?nomenclature_id=xxx&branch_id=xxx&precision=full
 func (sc *StockController) GetBatchesHistory(c *gin.Context) {
 	nomenclatureID := c.Query("nomenclature_id")
 	if nomenclatureID == "" {
@@ -591,6 +1205,10 @@ func (sc *StockController) GetBatchesHistory(c *gin.Context) {
 		})
 		return
 	}
+	// precision=full - сырые значения без округления (для отладки)
+	if c.Query("precision") != "full" {
+		sc.stockService.RoundBatchesHistory(batches)
+	}
 	
 	c.JSON(http.StatusOK, gin.H{
 		"batches": batches,
@@ -599,3 +1217,103 @@ func (sc *StockController) GetBatchesHistory(c *gin.Context) {
 }
 
 
+
+// MergeBatches объединяет одинаковые партии (тот же день срока годности и цена)
+// POST /api/v1/inventory/stock/merge-batches
+func (sc *StockController) MergeBatches(c *gin.Context) {
+	var request struct {
+		NomenclatureID string `json:"nomenclature_id" binding:"required"`
+		BranchID       string `json:"branch_id"` // Пусто - филиал по умолчанию
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверные параметры запроса",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	branchID, ok := resolveBranchID(c, sc.branchService, request.BranchID, true)
+	if !ok {
+		return
+	}
+	request.BranchID = branchID
+
+	mergedCount, err := sc.stockService.MergeBatches(request.NomenclatureID, request.BranchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка объединения партий",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Партии успешно объединены",
+		"nomenclature_id": request.NomenclatureID,
+		"branch_id":       request.BranchID,
+		"merged_count":    mergedCount,
+	})
+}
+
+// GetIngredientSubstitutions возвращает замены сырья
+// GET /api/v1/inventory/stock/substitutions?original_nomenclature_id=xxx (фильтр опционально)
+func (sc *StockController) GetIngredientSubstitutions(c *gin.Context) {
+	substitutions, err := sc.stockService.GetIngredientSubstitutions(c.Query("original_nomenclature_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка получения замен сырья",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"substitutions": substitutions,
+		"count":         len(substitutions),
+	})
+}
+
+// CreateIngredientSubstitution создает замену сырья
+// POST /api/v1/inventory/stock/substitutions
+// Body: {"original_nomenclature_id": "...", "substitute_nomenclature_id": "...", "conversion_ratio": 1.2, "priority": 0}
+// Замена используется при списании только для рецептов с allow_substitutions = true
+func (sc *StockController) CreateIngredientSubstitution(c *gin.Context) {
+	substitution := models.IngredientSubstitution{IsApproved: true}
+	if err := c.ShouldBindJSON(&substitution); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверный формат данных",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := sc.stockService.CreateIngredientSubstitution(&substitution); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Ошибка создания замены сырья",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, substitution)
+}
+
+// DeleteIngredientSubstitution удаляет замену сырья
+// DELETE /api/v1/inventory/stock/substitutions/:id
+func (sc *StockController) DeleteIngredientSubstitution(c *gin.Context) {
+	if err := sc.stockService.DeleteIngredientSubstitution(c.Param("id")); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"error":   "Ошибка удаления замены сырья",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Замена сырья удалена"})
+}
@@ -0,0 +1,49 @@
+// Package swagger отдает OpenAPI спецификацию REST API и Swagger UI
+//
+// swagger.json генерируется командой make swagger (swag v2) из аннотаций контроллеров
+// (@Summary, @Param, @Router ...) и встраивается в бинарник: после изменения аннотаций
+// или моделей запросов перегенерируйте его, вручную не редактируйте
+package swagger
+
+import (
+	_ "embed"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Spec - спецификация OpenAPI 3
+//
+//go:embed swagger.json
+var Spec []byte
+
+// indexHTML - Swagger UI (статика с CDN), читает спецификацию из doc.json рядом
+const indexHTML = `<!DOCTYPE html>
+<html lang="ru">
+<head>
+  <meta charset="utf-8" />
+  <title>ERP Server API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css" />
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "doc.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>`
+
+// Handler обслуживает маршрут вида /swagger/*any:
+// /swagger/doc.json - спецификация, /swagger/ и /swagger/index.html - Swagger UI
+func Handler(c *gin.Context) {
+	switch strings.TrimPrefix(c.Param("any"), "/") {
+	case "doc.json":
+		c.Data(http.StatusOK, "application/json; charset=utf-8", Spec)
+	case "", "index.html":
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(indexHTML))
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+	}
+}
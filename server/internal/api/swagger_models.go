@@ -0,0 +1,104 @@
+package api
+
+import (
+	"time"
+
+	"zephyrvpn/server/internal/models"
+)
+
+// Типы ответов для OpenAPI документации (swag берет схемы из именованных структур)
+// Контроллеры отдают те же поля через gin.H
+
+// ErrorResponse - стандартный ответ с ошибкой
+type ErrorResponse struct {
+	Error   string `json:"error" example:"Неверные данные"`
+	Details string `json:"details,omitempty"`
+}
+
+// CreateOrderResponse - ответ на создание заказа
+type CreateOrderResponse struct {
+	OrderID     string `json:"order_id"`
+	DisplayID   string `json:"display_id"`
+	TotalPrice  int    `json:"total_price"`  // Цена товаров без доставки (в рублях)
+	FinalPrice  int    `json:"final_price"`  // Итоговая цена: товары + доставка - скидка (в рублях)
+	DeliveryFee int    `json:"delivery_fee"` // Цена доставки (в рублях)
+	ItemsCount  int    `json:"items_count"`  // Количество единиц товара
+	ItemsPrice  int    `json:"items_price"`  // Цена всех товаров
+	Status      string `json:"status" example:"accepted"`
+}
+
+// OrdersResponse - список активных заказов для ERP
+type OrdersResponse struct {
+	System string              `json:"system"`
+	Orders []models.PizzaOrder `json:"orders"`
+	Count  int                 `json:"count"`
+	Role   string              `json:"role" example:"kitchen"`
+}
+
+// SlotConfigResponse - текущая конфигурация слотов
+type SlotConfigResponse struct {
+	MaxCapacity         int `json:"max_capacity" example:"10000"`
+	OverbookingPercent  int `json:"overbooking_percent" example:"10"`
+	SlotDurationMinutes int `json:"slot_duration_minutes" example:"15"`
+}
+
+// UpdateSlotConfigRequest - запрос на изменение емкости слотов
+type UpdateSlotConfigRequest struct {
+	MaxCapacity        int  `json:"max_capacity" example:"5000"`
+	OverbookingPercent *int `json:"overbooking_percent,omitempty" example:"10"` // Превышение емкости в процентах (0-100)
+}
+
+// UpdateSlotConfigResponse - ответ на изменение емкости слотов
+type UpdateSlotConfigResponse struct {
+	Success            bool   `json:"success"`
+	MaxCapacity        int    `json:"max_capacity"`
+	OverbookingPercent int    `json:"overbooking_percent"`
+	Message            string `json:"message"`
+}
+
+// StockBatchInfo - партия товара в ответе GetStockItems
+type StockBatchInfo struct {
+	ID               string    `json:"id"`
+	Quantity         float64   `json:"quantity"`
+	ExpiryAt         time.Time `json:"expiry_at"`
+	DaysUntilExpiry  int       `json:"days_until_expiry"`
+	HoursUntilExpiry int       `json:"hours_until_expiry"`
+	IsExpired        bool      `json:"is_expired"`
+	IsAtRisk         bool      `json:"is_at_risk"`
+	CostPerUnit      float64   `json:"cost_per_unit"` // Цена за InboundUnit
+	InvoiceID        string    `json:"invoice_id,omitempty"`
+	InvoiceNumber    string    `json:"invoice_number,omitempty"`
+}
+
+// StockItemInfo - остаток товара на филиале
+type StockItemInfo struct {
+	ID            string           `json:"id"`
+	ProductID     string           `json:"product_id"`
+	ProductName   string           `json:"product_name"`
+	Category      string           `json:"category"`
+	CategoryColor string           `json:"category_color"`
+	CategoryID    *string          `json:"category_id"`
+	Unit          string           `json:"unit"`      // Единица отображения (кг/л/шт)
+	BaseUnit      string           `json:"base_unit"` // Базовая единица склада (г/мл/шт)
+	InboundUnit   string           `json:"inbound_unit"`
+	BranchID      string           `json:"branch_id"`
+	BranchName    string           `json:"branch_name"`
+	CurrentStock  float64          `json:"current_stock"` // В BaseUnit
+	MinStock      float64          `json:"min_stock"`
+	CostPerUnit   float64          `json:"cost_per_unit"` // Цена за InboundUnit
+	CostValue     float64          `json:"cost_value"`
+	Status        string           `json:"status" example:"in_stock"` // in_stock, low_stock, out_of_stock
+	Batches       []StockBatchInfo `json:"batches"` // Заполняется только при запросе одного товара (nomenclature_id)
+}
+
+// StockItemsResponse - список остатков
+type StockItemsResponse struct {
+	Items []StockItemInfo `json:"items"`
+	Count int             `json:"count"`
+}
+
+// NomenclatureItemsResponse - список товаров номенклатуры
+type NomenclatureItemsResponse struct {
+	Items []models.NomenclatureItem `json:"items"`
+	Count int                       `json:"count"`
+}
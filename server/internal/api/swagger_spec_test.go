@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"zephyrvpn/server/internal/api/swagger"
+)
+
+// openAPISpec - часть спецификации, которую проверяют тесты
+type openAPISpec struct {
+	OpenAPI string `json:"openapi"`
+	Paths   map[string]map[string]struct {
+		RequestBody struct {
+			Required bool `json:"required"`
+			Content  map[string]struct {
+				Schema struct {
+					Ref string `json:"$ref"`
+				} `json:"schema"`
+			} `json:"content"`
+		} `json:"requestBody"`
+	} `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+			Required   []string                   `json:"required"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadOpenAPISpec(t *testing.T) openAPISpec {
+	t.Helper()
+	var spec openAPISpec
+	if err := json.Unmarshal(swagger.Spec, &spec); err != nil {
+		t.Fatalf("встроенная спецификация не разбирается: %v", err)
+	}
+	return spec
+}
+
+// jsonFieldNames возвращает имена JSON-полей структуры (без опций тега)
+func jsonFieldNames(v interface{}) []string {
+	typ := reflect.TypeOf(v)
+	names := make([]string, 0, typ.NumField())
+	for i := 0; i < typ.NumField(); i++ {
+		name := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestSwaggerSpecCreateOrder(t *testing.T) {
+	spec := loadOpenAPISpec(t)
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("openapi = %q, want 3.x", spec.OpenAPI)
+	}
+
+	// CreateOrder доступен по двум маршрутам с одной схемой тела
+	for _, path := range []string{"/order", "/erp/orders"} {
+		post, ok := spec.Paths[path]["post"]
+		if !ok {
+			t.Errorf("нет POST %s", path)
+			continue
+		}
+		if !post.RequestBody.Required {
+			t.Errorf("POST %s: тело запроса не обязательно", path)
+		}
+		if ref := post.RequestBody.Content["application/json"].Schema.Ref; ref != "#/components/schemas/api.CreateOrderRequest" {
+			t.Errorf("POST %s: схема тела %q, want api.CreateOrderRequest", path, ref)
+		}
+	}
+
+	// Схема совпадает с CreateOrderRequest: новое поле запроса должно попасть в спецификацию
+	schema, ok := spec.Components.Schemas["api.CreateOrderRequest"]
+	if !ok {
+		t.Fatal("нет схемы api.CreateOrderRequest")
+	}
+	properties := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		properties = append(properties, name)
+	}
+	sort.Strings(properties)
+	if want := jsonFieldNames(CreateOrderRequest{}); !reflect.DeepEqual(properties, want) {
+		t.Errorf("поля api.CreateOrderRequest = %v, want %v", properties, want)
+	}
+	if !reflect.DeepEqual(schema.Required, []string{"items"}) {
+		t.Errorf("required = %v, want [items]", schema.Required)
+	}
+}
+
+func TestSwaggerSpecRefsResolve(t *testing.T) {
+	// Каждая ссылка #/components/schemas/... указывает на существующую схему
+	spec := loadOpenAPISpec(t)
+	const prefix = "#/components/schemas/"
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := node["$ref"].(string); ok {
+				if _, exists := spec.Components.Schemas[strings.TrimPrefix(ref, prefix)]; !strings.HasPrefix(ref, prefix) || !exists {
+					t.Errorf("ссылка %q не найдена в components.schemas", ref)
+				}
+			}
+			for _, child := range node {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range node {
+				walk(child)
+			}
+		}
+	}
+	var raw interface{}
+	if err := json.Unmarshal(swagger.Spec, &raw); err != nil {
+		t.Fatal(err)
+	}
+	walk(raw)
+}
@@ -1,15 +1,18 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 
 	"zephyrvpn/server/internal/models"
 	"zephyrvpn/server/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // TechnologistController управляет API endpoints для Technologist Workspace
@@ -103,6 +106,45 @@ func (tc *TechnologistController) GetRecipeVersions(c *gin.Context) {
 	})
 }
 
+// DiffRecipeVersions возвращает разницу между двумя версиями рецепта
+// GET /api/v1/technologist/recipes/:id/diff?from=1&to=2
+func (tc *TechnologistController) DiffRecipeVersions(c *gin.Context) {
+	recipeID := c.Param("id")
+	if recipeID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "ID рецепта не указан",
+		})
+		return
+	}
+
+	fromVersion, errFrom := strconv.Atoi(c.Query("from"))
+	toVersion, errTo := strconv.Atoi(c.Query("to"))
+	if errFrom != nil || errTo != nil || fromVersion < 1 || toVersion < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Параметры from и to должны быть номерами версий",
+		})
+		return
+	}
+
+	diff, err := tc.technologistService.DiffRecipeVersions(recipeID, fromVersion, toVersion)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "Версия рецепта не найдена",
+				"details": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка сравнения версий",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
 // GetRecipeUsageTree возвращает дерево использования рецепта
 // GET /api/v1/technologist/recipes/:id/usage-tree
 func (tc *TechnologistController) GetRecipeUsageTree(c *gin.Context) {
@@ -321,6 +363,13 @@ func (tc *TechnologistController) UnifiedCreateMenuItem(c *gin.Context) {
 	)
 
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidIngredientUnit) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Недопустимая единица измерения ингредиента",
+				"details": err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Ошибка создания Menu Item",
 			"details": err.Error(),
@@ -785,3 +834,44 @@ func (tc *TechnologistController) UpdatePizzaExtra(c *gin.Context) {
 	c.JSON(http.StatusOK, pizzaExtra)
 }
 
+// SetPizzaPrepTime задает время приготовления пиццы (для оценки срока готовности заказа)
+// PUT /api/v1/technologist/pizzas/:pizza_name/prep-time
+func (tc *TechnologistController) SetPizzaPrepTime(c *gin.Context) {
+	pizzaName := c.Param("pizza_name")
+	if pizzaName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Название пиццы не указано",
+		})
+		return
+	}
+
+	var request struct {
+		PrepSeconds *int `json:"prep_seconds" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil || *request.PrepSeconds < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "prep_seconds обязателен и должен быть >= 0",
+		})
+		return
+	}
+
+	if err := tc.recipeService.SetPizzaPrepTime(pizzaName, *request.PrepSeconds); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Пицца не найдена",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка обновления времени приготовления",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pizza_name":   pizzaName,
+		"prep_seconds": *request.PrepSeconds,
+	})
+}
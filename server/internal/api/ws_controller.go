@@ -1,11 +1,13 @@
 package api
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"zephyrvpn/server/internal/models"
 )
 
 var upgrader = websocket.Upgrader{
@@ -19,6 +21,7 @@ var upgrader = websocket.Upgrader{
 }
 
 // ServeWS обрабатывает WebSocket подключения от планшетов поваров
+// Подключение только по WS-тикету: маршрут оборачивается в WSTicketController.RequireTicket
 func ServeWS(c *gin.Context) {
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -26,8 +29,8 @@ func ServeWS(c *gin.Context) {
 		return
 	}
 
-	// Добавляем клиента в хаб
-	GlobalHub.AddClient(conn)
+	// Добавляем клиента в хаб (роль из WS-тикета, проверенного RequireTicket)
+	GlobalHub.AddClient(conn, wsRoleFromContext(c))
 	log.Printf("📱 Планшет повара подключен. Всего подключений: %d", GlobalHub.GetClientsCount())
 
 	// Обрабатываем отключение клиента
@@ -48,3 +51,15 @@ func ServeWS(c *gin.Context) {
 	}
 }
 
+
+// BroadcastOrder отправляет заказ на планшеты поваров
+// Каждое соединение получает заказ, отфильтрованный по своей роли (телефон клиента видят только курьеры и админы)
+func BroadcastOrder(order models.PizzaOrder) {
+	GlobalHub.BroadcastByRole(func(role string) []byte {
+		orderJSON, err := json.Marshal(filterOrderByRole(order, role))
+		if err != nil {
+			return nil
+		}
+		return orderJSON
+	})
+}
@@ -6,32 +6,53 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// hubMessage - сообщение для рассылки
+// Если задан byRole, payload строится отдельно для каждой роли (фильтрация чувствительных полей заказа)
+type hubMessage struct {
+	payload []byte
+	byRole  func(role string) []byte
+}
+
 // Hub управляет WebSocket соединениями для планшетов поваров
+// Каждое соединение помечено ролью из WS-тикета (kitchen, courier, admin)
 type Hub struct {
-	clients   map[*websocket.Conn]bool
-	broadcast chan []byte
+	clients   map[*websocket.Conn]string
+	broadcast chan hubMessage
 	mutex     sync.RWMutex
 }
 
 // GlobalHub - глобальный хаб для всех WebSocket соединений (планшеты поваров)
 var GlobalHub = &Hub{
-	clients:   make(map[*websocket.Conn]bool),
-	broadcast: make(chan []byte, 256), // Буферизованный канал для производительности
+	clients:   make(map[*websocket.Conn]string),
+	broadcast: make(chan hubMessage, 256), // Буферизованный канал для производительности
 }
 
 // ERPHub - хаб для ERP системы (отдельный от планшетов поваров)
 var ERPHub = &Hub{
-	clients:   make(map[*websocket.Conn]bool),
-	broadcast: make(chan []byte, 256),
+	clients:   make(map[*websocket.Conn]string),
+	broadcast: make(chan hubMessage, 256),
 }
 
 // Run запускает хаб для обработки сообщений
 func (h *Hub) Run() {
 	for {
 		msg := <-h.broadcast
+		// Payload для каждой роли строим один раз на сообщение
+		payloads := make(map[string][]byte)
 		h.mutex.RLock()
-		for client := range h.clients {
-			err := client.WriteMessage(websocket.TextMessage, msg)
+		for client, role := range h.clients {
+			payload := msg.payload
+			if msg.byRole != nil {
+				var ok bool
+				if payload, ok = payloads[role]; !ok {
+					payload = msg.byRole(role)
+					payloads[role] = payload
+				}
+			}
+			if payload == nil {
+				continue
+			}
+			err := client.WriteMessage(websocket.TextMessage, payload)
 			if err != nil {
 				// Удаляем клиента при ошибке записи
 				h.mutex.RUnlock()
@@ -43,10 +64,10 @@ func (h *Hub) Run() {
 	}
 }
 
-// AddClient добавляет нового клиента (планшет повара)
-func (h *Hub) AddClient(conn *websocket.Conn) {
+// AddClient добавляет нового клиента (планшет повара) с ролью из WS-тикета
+func (h *Hub) AddClient(conn *websocket.Conn, role string) {
 	h.mutex.Lock()
-	h.clients[conn] = true
+	h.clients[conn] = role
 	h.mutex.Unlock()
 }
 
@@ -60,10 +81,20 @@ func (h *Hub) RemoveClient(conn *websocket.Conn) {
 	h.mutex.Unlock()
 }
 
-// BroadcastMessage отправляет сообщение всем подключенным клиентам
+// BroadcastMessage отправляет одно и то же сообщение всем подключенным клиентам
 func (h *Hub) BroadcastMessage(message []byte) {
+	h.enqueue(hubMessage{payload: message})
+}
+
+// BroadcastByRole отправляет каждому клиенту сообщение, построенное для его роли
+func (h *Hub) BroadcastByRole(build func(role string) []byte) {
+	h.enqueue(hubMessage{byRole: build})
+}
+
+// enqueue ставит сообщение в очередь рассылки
+func (h *Hub) enqueue(msg hubMessage) {
 	select {
-	case h.broadcast <- message:
+	case h.broadcast <- msg:
 	default:
 		// Если канал переполнен, пропускаем сообщение (не блокируем)
 	}
@@ -75,4 +106,3 @@ func (h *Hub) GetClientsCount() int {
 	defer h.mutex.RUnlock()
 	return len(h.clients)
 }
-
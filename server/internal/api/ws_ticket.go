@@ -0,0 +1,199 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils"
+)
+
+// wsTicketTTL - время жизни WS-тикета: клиент получает его и сразу открывает соединение
+const wsTicketTTL = 30 * time.Second
+
+// Роли WebSocket соединений (совпадают с ролями filterOrderByRole)
+const (
+	wsRoleKitchen = "kitchen"
+	wsRoleCourier = "courier"
+	wsRoleAdmin   = "admin"
+)
+
+// wsTicket - данные тикета в Redis (ws:ticket:{ticket})
+type wsTicket struct {
+	Role     string `json:"role"`
+	UserID   string `json:"user_id"`
+	BranchID string `json:"branch_id,omitempty"`
+	UserRole string `json:"user_role,omitempty"` // Исходная роль пользователя (super_admin для супер-админа)
+	Position string `json:"position,omitempty"`  // Должность сотрудника из сессии KDS (Staff.RoleName)
+}
+
+// superAdminUserRole - роль в wsTicket.UserRole для токена супер-админа
+const superAdminUserRole = "super_admin"
+
+// WSTicketController выдает одноразовые тикеты для подключения к WebSocket
+// Браузер не может передать заголовок Authorization при upgrade, поэтому тикет передается в ?ticket=
+type WSTicketController struct {
+	redisUtil *utils.RedisClient
+}
+
+// NewWSTicketController создает новый контроллер WS-тикетов
+func NewWSTicketController(redisUtil *utils.RedisClient) *WSTicketController {
+	return &WSTicketController{redisUtil: redisUtil}
+}
+
+// IssueTicket выдает короткоживущий тикет на подключение к WebSocket
+// POST /api/v1/ws-ticket
+// Авторизация: Authorization: Bearer <token> (сессия KDS после PIN или токен супер-админа)
+// или body {"session_token": "..."}
+func (wc *WSTicketController) IssueTicket(c *gin.Context) {
+	if wc.redisUtil == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Redis not available"})
+		return
+	}
+
+	token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	if token == "" {
+		var req struct {
+			SessionToken string `json:"session_token"`
+		}
+		c.ShouldBindJSON(&req) // Необязательное тело
+		token = req.SessionToken
+	}
+	if token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Требуется авторизация"})
+		return
+	}
+
+	ticketData, err := resolveSessionToken(wc.redisUtil, token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Недействительный токен",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ticketBytes := make([]byte, 32)
+	if _, err := rand.Read(ticketBytes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка генерации тикета"})
+		return
+	}
+	ticket := hex.EncodeToString(ticketBytes)
+
+	ticketJSON, _ := json.Marshal(ticketData)
+	if err := wc.redisUtil.Set(wsTicketKey(ticket), string(ticketJSON), wsTicketTTL); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Ошибка сохранения тикета",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ticket":     ticket,
+		"role":       ticketData.Role,
+		"expires_in": int(wsTicketTTL.Seconds()),
+	})
+}
+
+// RequireTicket проверяет тикет (?ticket=) перед WebSocket upgrade
+// Тикет одноразовый: удаляется при первом использовании. Роль кладется в контекст для хаба
+func (wc *WSTicketController) RequireTicket() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if wc.redisUtil == nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Redis not available"})
+			return
+		}
+
+		ticket := c.Query("ticket")
+		if ticket == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Требуется WS-тикет (POST /api/v1/ws-ticket)"})
+			return
+		}
+
+		ticketJSON, err := wc.redisUtil.GetClient().GetDel(wc.redisUtil.Context(), wsTicketKey(ticket)).Result()
+		if err != nil {
+			log.Printf("⚠️ WebSocket: отклонено подключение с недействительным тикетом (ip=%s)", c.ClientIP())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Недействительный или использованный WS-тикет"})
+			return
+		}
+
+		var ticketData wsTicket
+		if err := json.Unmarshal([]byte(ticketJSON), &ticketData); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Недействительный WS-тикет"})
+			return
+		}
+
+		c.Set("ws_role", ticketData.Role)
+		c.Set("ws_user_id", ticketData.UserID)
+		c.Next()
+	}
+}
+
+// resolveSessionToken определяет пользователя и роль по токену сессии
+func resolveSessionToken(redisUtil *utils.RedisClient, token string) (*wsTicket, error) {
+	// Токен супер-админа (сохраняется при входе в AuthController)
+	if adminID, err := redisUtil.Get(superAdminTokenKey(token)); err == nil && adminID != "" {
+		return &wsTicket{Role: wsRoleAdmin, UserID: adminID, UserRole: superAdminUserRole}, nil
+	}
+
+	// Сессия KDS после авторизации по PIN
+	staffID, err := redisUtil.Get(fmt.Sprintf("erp:kds:token:%s", token))
+	if err != nil || staffID == "" {
+		return nil, fmt.Errorf("сессия не найдена или истекла")
+	}
+
+	var session struct {
+		Role     string `json:"role"`
+		RoleName string `json:"role_name"`
+		BranchID string `json:"branch_id"`
+	}
+	if err := redisUtil.GetJSON(fmt.Sprintf("erp:staff:%s:session", staffID), &session); err != nil {
+		return nil, fmt.Errorf("сессия сотрудника не найдена")
+	}
+
+	return &wsTicket{
+		Role:     wsRoleFromUserRole(models.UserRole(session.Role)),
+		UserID:   staffID,
+		BranchID: session.BranchID,
+		UserRole: session.Role,
+		Position: session.RoleName,
+	}, nil
+}
+
+// wsRoleFromUserRole сопоставляет роль пользователя с ролью WebSocket соединения
+func wsRoleFromUserRole(role models.UserRole) string {
+	switch role {
+	case models.RoleAdmin, models.RoleTechnologist:
+		return wsRoleAdmin
+	case models.RoleCourier:
+		return wsRoleCourier
+	default:
+		return wsRoleKitchen
+	}
+}
+
+// wsTicketKey возвращает ключ Redis для WS-тикета
+func wsTicketKey(ticket string) string {
+	return fmt.Sprintf("ws:ticket:%s", ticket)
+}
+
+// superAdminTokenKey возвращает ключ Redis для токена супер-админа
+func superAdminTokenKey(token string) string {
+	return fmt.Sprintf("auth:super_admin:token:%s", token)
+}
+
+// wsRoleFromContext возвращает роль соединения, установленную RequireTicket (по умолчанию - кухня)
+func wsRoleFromContext(c *gin.Context) string {
+	if role := c.GetString("ws_role"); role != "" {
+		return role
+	}
+	return wsRoleKitchen
+}
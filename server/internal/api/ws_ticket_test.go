@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils"
+)
+
+// newTicketRouter - POST /ws-ticket и защищенный тикетом GET /ws, который возвращает роль из контекста
+func newTicketRouter(redisUtil *utils.RedisClient) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	controller := NewWSTicketController(redisUtil)
+	router := gin.New()
+	router.POST("/ws-ticket", controller.IssueTicket)
+	router.GET("/ws", controller.RequireTicket(), func(c *gin.Context) {
+		c.String(http.StatusOK, wsRoleFromContext(c))
+	})
+	return router
+}
+
+func TestRequireTicketRejectsConnectionWithoutTicket(t *testing.T) {
+	// Без Redis тикет проверить нельзя - 503, а не пропуск
+	if code := serve(newTicketRouter(nil), http.MethodGet, "/ws").Code; code != http.StatusServiceUnavailable {
+		t.Errorf("без Redis = %d, want 503", code)
+	}
+
+	// Пустой тикет отклоняется до обращения к Redis, неизвестный - по ошибке чтения
+	unreachable := utils.NewRedisClient(redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}))
+	t.Cleanup(func() { unreachable.GetClient().Close() })
+	router := newTicketRouter(unreachable)
+	for _, url := range []string{"/ws", "/ws?ticket=", "/ws?ticket=forged"} {
+		if code := serve(router, http.MethodGet, url).Code; code != http.StatusUnauthorized {
+			t.Errorf("GET %s = %d, want 401", url, code)
+		}
+	}
+}
+
+func TestWSTicketIsSingleUse(t *testing.T) {
+	redisUtil := newTestRedis(t)
+	router := newTicketRouter(redisUtil)
+
+	// Сессия курьера после входа по PIN
+	if err := redisUtil.Set("erp:kds:token:session-1", "staff-1", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := redisUtil.Set("erp:staff:staff-1:session", map[string]string{"role": string(models.RoleCourier)}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/ws-ticket", strings.NewReader(`{}`))
+	request.Header.Set("Authorization", "Bearer session-1")
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("выдача тикета = %d: %s", recorder.Code, recorder.Body.String())
+	}
+	var issued struct {
+		Ticket string `json:"ticket"`
+		Role   string `json:"role"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &issued); err != nil || issued.Ticket == "" {
+		t.Fatalf("ответ выдачи тикета %s: %v", recorder.Body.String(), err)
+	}
+
+	first := serve(router, http.MethodGet, "/ws?ticket="+issued.Ticket)
+	if first.Code != http.StatusOK || first.Body.String() != wsRoleCourier {
+		t.Fatalf("подключение по тикету = %d %q, want 200 %q", first.Code, first.Body.String(), wsRoleCourier)
+	}
+	if code := serve(router, http.MethodGet, "/ws?ticket="+issued.Ticket).Code; code != http.StatusUnauthorized {
+		t.Errorf("повторное использование тикета = %d, want 401", code)
+	}
+}
+
+func TestWSRoleFromUserRole(t *testing.T) {
+	cases := map[models.UserRole]string{
+		models.RoleAdmin:        wsRoleAdmin,
+		models.RoleTechnologist: wsRoleAdmin,
+		models.RoleCourier:      wsRoleCourier,
+		models.UserRole("cook"): wsRoleKitchen,
+		models.UserRole(""):     wsRoleKitchen,
+	}
+	for role, want := range cases {
+		if got := wsRoleFromUserRole(role); got != want {
+			t.Errorf("wsRoleFromUserRole(%q) = %q, want %q", role, got, want)
+		}
+	}
+}
@@ -12,11 +12,25 @@ type Config struct {
 	RedisURL       string
 	RedisSentinelAddrs []string // Адреса Sentinel (через запятую)
 	RedisMasterName    string   // Имя мастера в Sentinel
+	// Пул соединений Redis
+	RedisPoolSize         int // Максимум соединений в пуле
+	RedisMinIdleConns     int // Сколько соединений держать открытыми всегда
+	RedisMaxRetries       int // Повторы команды при сетевой ошибке
+	RedisDialTimeoutMs    int // Таймаут установки соединения
+	RedisReadTimeoutMs    int // Таймаут чтения ответа
+	RedisWriteTimeoutMs   int // Таймаут записи команды
+	RedisPoolTimeoutMs    int // Ожидание свободного соединения при исчерпанном пуле (0 = ReadTimeout + 1с)
 	KafkaBrokers   string
 	KafkaUsername  string
 	KafkaPassword  string
 	KafkaCACert    string
+	KafkaOrdersTopic   string // Топик заказов (свой для каждого окружения на общем кластере)
+	KafkaConsumerGroup string // Consumer group WS consumer
+	KafkaConsumerWorkers int // Воркеров WS consumer: сообщения обрабатываются параллельно, один заказ - всегда один воркер
+	KafkaLagAlertThreshold       int // Отставание группы (сообщений), после которого поднимается тревога
+	KafkaLagCheckIntervalSeconds int // Период проверки отставания
 	JWTSecret      string
+	CORSAllowedOrigins []string // Origin фронтенда, которым разрешены кросс-доменные запросы ("*" - любой, только для разработки)
 	ServerPort     string
 	Environment    string
 	OpenVPNPath    string
@@ -30,6 +44,46 @@ type Config struct {
 	WeatherLatitude   float64 // Широта для получения прогноза погоды
 	WeatherLongitude  float64 // Долгота для получения прогноза погоды
 	WeatherTimezone   string // Часовой пояс для прогноза погоды
+	// Rate limiting (token bucket в Redis, по IP клиента и эндпоинту; 0 = отключено)
+	RateLimitReadRPS          float64 // Скорость для GET запросов (запросов в секунду)
+	RateLimitReadBurst        int     // Допустимый всплеск GET запросов
+	RateLimitCreateOrderRPS   float64 // Скорость для создания заказов (запросов в секунду)
+	RateLimitCreateOrderBurst int     // Допустимый всплеск создания заказов
+	// Импорт номенклатуры
+	ImportDuplicateNameThreshold float64 // Порог сходства названий (0..1) для предупреждения о возможном дубликате
+	ImportMaxUploadMB            int     // Максимальный размер файла импорта номенклатуры, МБ
+	// Филиалы
+	DefaultBranchID string // Филиал для заказов, накладных и складских операций без branch_id (пусто - не подставлять)
+	// Хранение заказов
+	ArchiveRetentionDays int // Сколько дней хранить заархивированные заказы в PostgreSQL (0 = хранить бессрочно)
+	// Склад
+	LowStockAlertWindowMinutes int // Не повторять уведомление о низком остатке товара чаще, чем раз в N минут
+	PriceAlertThresholdPercent float64 // Уведомлять, если закупочная цена выше скользящего среднего больше чем на N% (0 = отключено)
+	RecipeMaxDepth             int     // Максимальная вложенность полуфабрикатов при расчете себестоимости и списании
+	StockQuantityDecimals      int     // Знаков после запятой в отображаемых весовых/объемных остатках (штучные - целые)
+	MarkdownMaxPercent         float64 // Максимальная предлагаемая скидка на товар с истекающим сроком, %
+	MarkdownCurveExponent      float64 // Агрессивность кривой скидок (< 1 - скидка растет быстрее, > 1 - медленнее)
+	MarkdownStepPercent        float64 // Шаг округления предлагаемой скидки, %
+	// Закупки
+	PurchaseOrderApprovalThreshold float64 // Заказы на закупку дороже N₽ требуют утверждения менеджера перед отправкой (0 = отключено)
+	// Финансы
+	FinanceVATRate float64 // Ставка НДС (%), выделяемая из сумм при выгрузке транзакций в 1С (0 = без НДС)
+	// Внешние уведомления о критических алертах (пусто = канал отключен)
+	NotifyWebhookURL          string // URL исходящего webhook (POST JSON)
+	NotifyTelegramBotToken    string // Токен Telegram бота
+	NotifyTelegramChatID      string // Чат менеджеров для Telegram бота
+	NotifyDedupWindowMinutes  int    // Не повторять одно и то же уведомление чаще, чем раз в N минут
+	// Аналитика
+	MenuMarginThresholdPercent float64 // Маржа позиции меню (% от цены), ниже которой она помечается в отчете
+	// TTL ключей Redis
+	RedisOrderTTLHours         int // Заказ и его служебные ключи (erp:order:*, order:visible_at:*)
+	RedisSlotHistoryTTLMinutes int // Загрузка слота и связь заказ -> слот (история прошедших слотов)
+	RedisSlotMetaTTLHours      int // Отключение слота и кэш параметров слота
+	SlotArchiveIntervalMinutes int // Период переноса закончившихся слотов в slot_history (меньше RedisSlotHistoryTTLMinutes)
+	// Кухня
+	PrepDefaultSeconds int // Время приготовления пиццы, если в рецепте не задано prep_seconds
+	// Заказы
+	OrderDiscountPolicy string // Скидка больше суммы заказа: clamp - уменьшить до суммы, reject - отклонить заказ
 }
 
 func Load() *Config {
@@ -99,6 +153,14 @@ func Load() *Config {
 		}
 	}
 
+	// CORS: список origin через запятую
+	var corsAllowedOrigins []string
+	for _, origin := range strings.Split(getEnv("CORS_ALLOWED_ORIGINS", ""), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			corsAllowedOrigins = append(corsAllowedOrigins, origin)
+		}
+	}
+
 	masterName := getEnv("REDIS_MASTER_NAME", "")
 	if masterName == "" {
 		masterName = "mymaster" // Дефолтное значение
@@ -109,11 +171,24 @@ func Load() *Config {
 		RedisURL:           redisURL,
 		RedisSentinelAddrs: sentinelAddrs,
 		RedisMasterName:    masterName,
+		RedisPoolSize:       getEnvInt("REDIS_POOL_SIZE", 1000),
+		RedisMinIdleConns:   getEnvInt("REDIS_MIN_IDLE_CONNS", 50),
+		RedisMaxRetries:     getEnvInt("REDIS_MAX_RETRIES", 3),
+		RedisDialTimeoutMs:  getEnvInt("REDIS_DIAL_TIMEOUT_MS", 5000),
+		RedisReadTimeoutMs:  getEnvInt("REDIS_READ_TIMEOUT_MS", 3000),
+		RedisWriteTimeoutMs: getEnvInt("REDIS_WRITE_TIMEOUT_MS", 3000),
+		RedisPoolTimeoutMs:  getEnvInt("REDIS_POOL_TIMEOUT_MS", 0),
 		KafkaBrokers:       getEnv("KAFKA_BROKERS", ""),
 		KafkaUsername:      getEnv("KAFKA_USERNAME", ""),
 		KafkaPassword:      getEnv("KAFKA_PASSWORD", ""),
 		KafkaCACert:        getEnv("KAFKA_CA_CERT", ""),
+		KafkaOrdersTopic:   getEnv("KAFKA_ORDERS_TOPIC", "pizza-orders"),
+		KafkaConsumerGroup: getEnv("KAFKA_CONSUMER_GROUP", "order-service-stable-group"),
+		KafkaConsumerWorkers: getEnvInt("KAFKA_CONSUMER_WORKERS", 4),
+		KafkaLagAlertThreshold:       getEnvInt("KAFKA_LAG_ALERT_THRESHOLD", 100),       // 100 необработанных заказов
+		KafkaLagCheckIntervalSeconds: getEnvInt("KAFKA_LAG_CHECK_INTERVAL_SECONDS", 30),
 		JWTSecret:          getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+		CORSAllowedOrigins: corsAllowedOrigins,
 		ServerPort:         getEnv("PORT", "8080"),
 		Environment:        getEnv("ENV", "development"),
 		OpenVPNPath:        getEnv("OPENVPN_PATH", "/usr/sbin/openvpn"),
@@ -126,6 +201,34 @@ func Load() *Config {
 		WeatherLatitude:    getEnvFloat("WEATHER_LATITUDE", 0), // Широта (0 = использовать координаты по умолчанию)
 		WeatherLongitude:   getEnvFloat("WEATHER_LONGITUDE", 0), // Долгота (0 = использовать координаты по умолчанию)
 		WeatherTimezone:    getEnv("WEATHER_TIMEZONE", ""), // Часовой пояс (пусто = использовать по умолчанию)
+		RateLimitReadRPS:          getEnvFloat("RATE_LIMIT_READ_RPS", 20),          // 20 GET/сек на IP и эндпоинт
+		RateLimitReadBurst:        getEnvInt("RATE_LIMIT_READ_BURST", 60),
+		RateLimitCreateOrderRPS:   getEnvFloat("RATE_LIMIT_CREATE_ORDER_RPS", 1),   // 1 заказ/сек на IP
+		RateLimitCreateOrderBurst: getEnvInt("RATE_LIMIT_CREATE_ORDER_BURST", 5),
+		ImportDuplicateNameThreshold: getEnvFloat("IMPORT_DUPLICATE_NAME_THRESHOLD", 0.85), // 85% сходства названий
+		ImportMaxUploadMB:            getEnvInt("IMPORT_MAX_UPLOAD_MB", 20),                // 20 МБ на файл
+		DefaultBranchID:              getEnv("DEFAULT_BRANCH_ID", ""),                       // Без филиала по умолчанию branch_id обязателен для склада
+		ArchiveRetentionDays:         getEnvInt("ARCHIVE_RETENTION_DAYS", 0),               // 0 = не удалять архив
+		LowStockAlertWindowMinutes:   getEnvInt("LOW_STOCK_ALERT_WINDOW_MINUTES", 60),      // 1 уведомление в час на товар
+		PriceAlertThresholdPercent:   getEnvFloat("PRICE_ALERT_THRESHOLD_PERCENT", 20),     // +20% к среднему последних закупок
+		RecipeMaxDepth:               getEnvInt("RECIPE_MAX_DEPTH", 20),                    // 20 уровней полуфабрикатов
+		StockQuantityDecimals:        getEnvInt("STOCK_QUANTITY_DECIMALS", 2),              // 12.3456 кг -> 12.35 кг
+		MarkdownMaxPercent:           getEnvFloat("MARKDOWN_MAX_PERCENT", 50),              // Не больше 50% скидки
+		MarkdownCurveExponent:        getEnvFloat("MARKDOWN_CURVE_EXPONENT", 1),            // Линейно от доли непроданного
+		MarkdownStepPercent:          getEnvFloat("MARKDOWN_STEP_PERCENT", 5),              // 5, 10, 15...
+		PurchaseOrderApprovalThreshold: getEnvFloat("PURCHASE_ORDER_APPROVAL_THRESHOLD", 0), // 0 = заказы отправляются без утверждения
+		FinanceVATRate:               getEnvFloat("FINANCE_VAT_RATE", 20),                  // НДС 20%, суммы транзакций включают налог
+		NotifyWebhookURL:             getEnv("NOTIFY_WEBHOOK_URL", ""),
+		NotifyTelegramBotToken:       getEnv("NOTIFY_TELEGRAM_BOT_TOKEN", ""),
+		NotifyTelegramChatID:         getEnv("NOTIFY_TELEGRAM_CHAT_ID", ""),
+		NotifyDedupWindowMinutes:     getEnvInt("NOTIFY_DEDUP_WINDOW_MINUTES", 60),         // 1 уведомление в час на алерт
+		MenuMarginThresholdPercent:   getEnvFloat("MENU_MARGIN_THRESHOLD_PERCENT", 30),     // Маржа ниже 30% - подсветить
+		PrepDefaultSeconds:           getEnvInt("PREP_DEFAULT_SECONDS", 600),               // 10 минут на пиццу
+		OrderDiscountPolicy:          getEnv("ORDER_DISCOUNT_POLICY", "clamp"),             // Как раньше: скидка не больше суммы
+		RedisOrderTTLHours:           getEnvInt("REDIS_ORDER_TTL_HOURS", 24),               // Сутки
+		RedisSlotHistoryTTLMinutes:   getEnvInt("REDIS_SLOT_HISTORY_TTL_MINUTES", 120),     // 2 часа истории слотов в Redis
+		RedisSlotMetaTTLHours:        getEnvInt("REDIS_SLOT_META_TTL_HOURS", 24),           // Сутки
+		SlotArchiveIntervalMinutes:   getEnvInt("SLOT_ARCHIVE_INTERVAL_MINUTES", 5),        // Перенос слотов в slot_history каждые 5 минут
 	}
 }
 
@@ -10,28 +10,92 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// RedisPoolConfig - настройки пула соединений Redis (REDIS_POOL_SIZE, REDIS_MIN_IDLE_CONNS, REDIS_*_TIMEOUT_MS)
+type RedisPoolConfig struct {
+	PoolSize     int           // Максимум соединений в пуле
+	MinIdleConns int           // Сколько соединений держать открытыми всегда
+	MaxRetries   int           // Повторы команды при сетевой ошибке
+	DialTimeout  time.Duration // Таймаут установки соединения
+	ReadTimeout  time.Duration // Таймаут чтения ответа
+	WriteTimeout time.Duration // Таймаут записи команды
+	PoolTimeout  time.Duration // Сколько ждать свободное соединение, когда пул исчерпан (0 = ReadTimeout + 1с)
+}
+
+// DefaultRedisPoolConfig - прежние зашитые настройки пула
+func DefaultRedisPoolConfig() RedisPoolConfig {
+	return RedisPoolConfig{
+		PoolSize:     1000, // Дефолт go-redis всего 10 на ядро
+		MinIdleConns: 50,
+		MaxRetries:   3,
+		DialTimeout:  5 * time.Second,
+		ReadTimeout:  3 * time.Second,
+		WriteTimeout: 3 * time.Second,
+	}
+}
+
+// withDefaults подставляет значения по умолчанию вместо незаданных (нулевых) полей
+func (c RedisPoolConfig) withDefaults() RedisPoolConfig {
+	defaults := DefaultRedisPoolConfig()
+	if c.PoolSize <= 0 {
+		c.PoolSize = defaults.PoolSize
+	}
+	if c.MinIdleConns < 0 {
+		c.MinIdleConns = 0
+	}
+	if c.MaxRetries <= 0 {
+		c.MaxRetries = defaults.MaxRetries
+	}
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = defaults.DialTimeout
+	}
+	if c.ReadTimeout <= 0 {
+		c.ReadTimeout = defaults.ReadTimeout
+	}
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = defaults.WriteTimeout
+	}
+	if c.PoolTimeout < 0 {
+		c.PoolTimeout = 0
+	}
+	return c
+}
+
+// newRedisClient создает клиент для прямого подключения с настройками пула (без проверки соединения)
+func newRedisClient(redisURL string, pool RedisPoolConfig) (*redis.Client, error) {
+	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+	}
+
+	// Используем распарсенные опции и переопределяем настройки пула
+	pool = pool.withDefaults()
+	opt.PoolSize = pool.PoolSize
+	opt.MinIdleConns = pool.MinIdleConns
+	opt.MaxRetries = pool.MaxRetries
+	opt.DialTimeout = pool.DialTimeout
+	opt.ReadTimeout = pool.ReadTimeout
+	opt.WriteTimeout = pool.WriteTimeout
+	opt.PoolTimeout = pool.PoolTimeout
+
+	return redis.NewClient(opt), nil
+}
+
 // ConnectRedis подключается к Redis (с поддержкой Sentinel)
 // Если указаны sentinelAddrs и masterName, используется Sentinel
 // Иначе используется прямое подключение через redisURL
-func ConnectRedis(redisURL string, sentinelAddrs []string, masterName string) (*redis.Client, error) {
+// pool - настройки пула соединений (PoolSize, MaxRetries и таймауты <= 0 - значения DefaultRedisPoolConfig)
+func ConnectRedis(redisURL string, sentinelAddrs []string, masterName string, pool RedisPoolConfig) (*redis.Client, error) {
 	// Если указаны адреса Sentinel, используем их
 	if len(sentinelAddrs) > 0 && masterName != "" {
-		return ConnectRedisWithSentinel(sentinelAddrs, masterName, "")
+		return ConnectRedisWithSentinel(sentinelAddrs, masterName, "", pool)
 	}
 
 	// Иначе используем прямое подключение (fallback или для разработки)
-	opt, err := redis.ParseURL(redisURL)
+	client, err := newRedisClient(redisURL, pool)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+		return nil, err
 	}
 
-	// Используем распарсенные опции и переопределяем настройки пула
-	opt.PoolSize = 1000      // Увеличиваем до 1000 (дефолт всего 10 на ядро)
-	opt.MinIdleConns = 50    // Держим 50 соединений всегда готовыми
-	opt.MaxRetries = 3       // Если не достучался — попробуй еще раз
-
-	client := redis.NewClient(opt)
-
 	// Проверяем подключение
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -40,12 +104,13 @@ func ConnectRedis(redisURL string, sentinelAddrs []string, masterName string) (*
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
-	log.Println("✅ Redis connected successfully (direct connection)")
+	opt := client.Options()
+	log.Printf("✅ Redis connected successfully (direct connection, pool size %d, min idle %d)", opt.PoolSize, opt.MinIdleConns)
 	return client, nil
 }
 
 // ConnectRedisWithSentinel подключается к Redis через Sentinel
-func ConnectRedisWithSentinel(sentinelAddrs []string, masterName, password string) (*redis.Client, error) {
+func ConnectRedisWithSentinel(sentinelAddrs []string, masterName, password string, pool RedisPoolConfig) (*redis.Client, error) {
 	// Парсим адреса Sentinel (может быть строка через запятую или массив)
 	var addrs []string
 	if len(sentinelAddrs) == 1 && strings.Contains(sentinelAddrs[0], ",") {
@@ -63,17 +128,19 @@ func ConnectRedisWithSentinel(sentinelAddrs []string, masterName, password strin
 		return nil, fmt.Errorf("no Sentinel addresses provided")
 	}
 
+	pool = pool.withDefaults()
 	opt := &redis.FailoverOptions{
 		MasterName:    masterName,
 		SentinelAddrs: addrs,
 		Password:      password,
-		PoolSize:      1000,
-		MinIdleConns:  50,
-		MaxRetries:    3,
+		PoolSize:      pool.PoolSize,
+		MinIdleConns:  pool.MinIdleConns,
+		MaxRetries:    pool.MaxRetries,
+		PoolTimeout:   pool.PoolTimeout,
 		// Настройки для автоматического переподключения
-		DialTimeout:  5 * time.Second,
-		ReadTimeout:  3 * time.Second,
-		WriteTimeout: 3 * time.Second,
+		DialTimeout:  pool.DialTimeout,
+		ReadTimeout:  pool.ReadTimeout,
+		WriteTimeout: pool.WriteTimeout,
 	}
 
 	client := redis.NewFailoverClient(opt)
@@ -90,6 +157,42 @@ func ConnectRedisWithSentinel(sentinelAddrs []string, masterName, password strin
 	return client, nil
 }
 
+// RedisPoolStatus - настройки и счетчики пула соединений Redis (GET /api/v1/health/redis-pool)
+type RedisPoolStatus struct {
+	PoolSize      int    `json:"pool_size"`
+	MinIdleConns  int    `json:"min_idle_conns"`
+	PoolTimeoutMs int64  `json:"pool_timeout_ms"`
+	Hits          uint32 `json:"hits"`        // Свободное соединение нашлось в пуле
+	Misses        uint32 `json:"misses"`      // Свободного соединения не было - открыто новое
+	Timeouts      uint32 `json:"timeouts"`    // Не дождались свободного соединения за PoolTimeout
+	TotalConns    uint32 `json:"total_conns"` // Всего соединений в пуле
+	IdleConns     uint32 `json:"idle_conns"`  // Из них свободных
+	StaleConns    uint32 `json:"stale_conns"` // Закрыто устаревших соединений
+	InUseConns    uint32 `json:"in_use_conns"`
+}
+
+// GetRedisPoolStatus возвращает настройки пула клиента и его текущую статистику (PoolStats)
+// Растущие timeouts или in_use_conns около pool_size - пул мал или соединения не возвращаются (утечка)
+func GetRedisPoolStatus(client *redis.Client) RedisPoolStatus {
+	opt := client.Options()
+	stats := client.PoolStats()
+	status := RedisPoolStatus{
+		PoolSize:      opt.PoolSize,
+		MinIdleConns:  opt.MinIdleConns,
+		PoolTimeoutMs: opt.PoolTimeout.Milliseconds(),
+		Hits:          stats.Hits,
+		Misses:        stats.Misses,
+		Timeouts:      stats.Timeouts,
+		TotalConns:    stats.TotalConns,
+		IdleConns:     stats.IdleConns,
+		StaleConns:    stats.StaleConns,
+	}
+	if stats.TotalConns > stats.IdleConns {
+		status.InUseConns = stats.TotalConns - stats.IdleConns
+	}
+	return status
+}
+
 // CloseRedis закрывает подключение к Redis
 func CloseRedis(client *redis.Client) error {
 	if client != nil {
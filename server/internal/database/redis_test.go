@@ -0,0 +1,63 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+// Клиент создается без подключения: проверяем только, что настройки пула попали в опции клиента
+func TestNewRedisClientAppliesPoolConfig(t *testing.T) {
+	client, err := newRedisClient("redis://localhost:6379/0", RedisPoolConfig{
+		PoolSize:     42,
+		MinIdleConns: 7,
+		MaxRetries:   5,
+		DialTimeout:  2 * time.Second,
+		ReadTimeout:  1500 * time.Millisecond,
+		WriteTimeout: 1200 * time.Millisecond,
+		PoolTimeout:  4 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("newRedisClient: %v", err)
+	}
+	defer client.Close()
+
+	opt := client.Options()
+	if opt.PoolSize != 42 {
+		t.Errorf("PoolSize = %d, want 42", opt.PoolSize)
+	}
+	if opt.MinIdleConns != 7 {
+		t.Errorf("MinIdleConns = %d, want 7", opt.MinIdleConns)
+	}
+	if opt.MaxRetries != 5 {
+		t.Errorf("MaxRetries = %d, want 5", opt.MaxRetries)
+	}
+	if opt.DialTimeout != 2*time.Second || opt.ReadTimeout != 1500*time.Millisecond || opt.WriteTimeout != 1200*time.Millisecond {
+		t.Errorf("таймауты = %v/%v/%v, want 2s/1.5s/1.2s", opt.DialTimeout, opt.ReadTimeout, opt.WriteTimeout)
+	}
+	if opt.PoolTimeout != 4*time.Second {
+		t.Errorf("PoolTimeout = %v, want 4s", opt.PoolTimeout)
+	}
+
+	status := GetRedisPoolStatus(client)
+	if status.PoolSize != 42 || status.PoolTimeoutMs != 4000 {
+		t.Errorf("GetRedisPoolStatus: pool_size=%d pool_timeout_ms=%d, want 42 и 4000", status.PoolSize, status.PoolTimeoutMs)
+	}
+}
+
+// Незаданные настройки пула - прежние значения по умолчанию
+func TestNewRedisClientDefaultsPoolConfig(t *testing.T) {
+	client, err := newRedisClient("redis://localhost:6379/0", RedisPoolConfig{})
+	if err != nil {
+		t.Fatalf("newRedisClient: %v", err)
+	}
+	defer client.Close()
+
+	defaults := DefaultRedisPoolConfig()
+	opt := client.Options()
+	if opt.PoolSize != defaults.PoolSize {
+		t.Errorf("PoolSize = %d, want %d", opt.PoolSize, defaults.PoolSize)
+	}
+	if opt.ReadTimeout != defaults.ReadTimeout {
+		t.Errorf("ReadTimeout = %v, want %v", opt.ReadTimeout, defaults.ReadTimeout)
+	}
+}
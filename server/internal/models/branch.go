@@ -9,21 +9,24 @@ import (
 
 // Branch представляет филиал/точку продаж
 type Branch struct {
-	ID            string         `json:"id" gorm:"type:uuid;primaryKey"`
-	Name          string         `json:"name" gorm:"type:varchar(255);not null"`
-	Address       string         `json:"address" gorm:"type:text"`
-	Phone         string         `json:"phone" gorm:"type:varchar(50)"`
-	Email         string         `json:"email" gorm:"type:varchar(255)"`
-	LegalEntityID *string        `json:"legal_entity_id" gorm:"type:uuid;index;not null"` // Связь с ИП (один ко многим)
-	SuperAdminID  *string        `json:"super_admin_id" gorm:"type:uuid;index"`              // Связь с аккаунтом (опционально)
-	IsActive      bool           `json:"is_active" gorm:"default:true"`
-	CreatedAt     time.Time      `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt     time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
-	DeletedAt     gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+	ID              string         `json:"id" gorm:"type:uuid;primaryKey"`
+	Name            string         `json:"name" gorm:"type:varchar(255);not null"`
+	Address         string         `json:"address" gorm:"type:text"`
+	Phone           string         `json:"phone" gorm:"type:varchar(50)"`
+	Email           string         `json:"email" gorm:"type:varchar(255)"`
+	LegalEntityID   *string        `json:"legal_entity_id" gorm:"type:uuid;index;not null"` // Связь с ИП (один ко многим)
+	SuperAdminID    *string        `json:"super_admin_id" gorm:"type:uuid;index"`           // Связь с аккаунтом (опционально)
+	IsActive        bool           `json:"is_active" gorm:"default:true"`
+	PrepLeadMinutes int            `json:"prep_lead_minutes" gorm:"default:30"` // За сколько минут до начала слота заказ появляется на планшете повара
+	MinMinutesBeforeSlotEnd int    `json:"min_minutes_before_slot_end" gorm:"default:8"` // Минимум минут до конца текущего слота, чтобы кухня успела приготовить заказ в нем
+	Timezone        string         `json:"timezone" gorm:"type:varchar(64);default:'UTC'"` // IANA часовой пояс (Asia/Yekaterinburg) - границы бизнес-дня для выручки и плана
+	CreatedAt       time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt       time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt       gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
 
 	// Связи
 	LegalEntity *LegalEntity `json:"legal_entity,omitempty" gorm:"foreignKey:LegalEntityID;references:ID"`
-	SuperAdmin  *SuperAdmin   `json:"super_admin,omitempty" gorm:"foreignKey:SuperAdminID;references:ID"`
+	SuperAdmin  *SuperAdmin  `json:"super_admin,omitempty" gorm:"foreignKey:SuperAdminID;references:ID"`
 }
 
 // TableName указывает имя таблицы
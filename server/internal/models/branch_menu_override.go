@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BranchMenuOverride - изменение общего меню для одного филиала: позиция скрыта и/или продается по другой цене
+// ItemName - название пиццы, допа или набора, как в меню. Без записи позиция доступна по общей цене
+type BranchMenuOverride struct {
+	ID            string    `json:"id" gorm:"type:uuid;primaryKey"`
+	BranchID      string    `json:"branch_id" gorm:"type:varchar(36);not null;uniqueIndex:idx_branch_menu_overrides_branch_item"`
+	ItemName      string    `json:"item_name" gorm:"type:varchar(255);not null;uniqueIndex:idx_branch_menu_overrides_branch_item"`
+	Available     bool      `json:"available" gorm:"not null"` // false - позиция скрыта в меню филиала (без default: иначе GORM не вставит false)
+	PriceOverride *int      `json:"price_override"`            // Цена в рублях для филиала (NULL - общая цена)
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TableName указывает имя таблицы
+func (BranchMenuOverride) TableName() string {
+	return "branch_menu_overrides"
+}
+
+// BeforeCreate генерирует UUID
+func (o *BranchMenuOverride) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == "" {
+		o.ID = uuid.New().String()
+	}
+	return nil
+}
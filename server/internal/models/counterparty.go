@@ -41,6 +41,7 @@ type Counterparty struct {
 	HybridMode      bool               `json:"hybrid_mode" gorm:"default:false"` // Режим гибридного учета
 	CreditLimit     float64            `json:"credit_limit" gorm:"type:decimal(15,2);default:0"` // Кредитный лимит
 	PaymentTerms    string             `json:"payment_terms" gorm:"type:varchar(255)"` // Условия оплаты
+	Currency        string             `json:"currency" gorm:"type:varchar(3);default:'RUB'"` // Валюта расчетов (ISO 4217), в ней выставляются накладные
 	
 	// Контактная информация
 	ContactPerson   string             `json:"contact_person" gorm:"type:varchar(255)"`
@@ -70,6 +71,9 @@ func (c *Counterparty) BeforeCreate(tx *gorm.DB) error {
 	if c.Status == "" {
 		c.Status = CounterpartyStatusActive
 	}
+	if c.Currency == "" {
+		c.Currency = BaseCurrency
+	}
 	return nil
 }
 
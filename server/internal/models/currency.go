@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BaseCurrency - валюта учета системы (остатки, балансы контрагентов, отчеты)
+const BaseCurrency = "RUB"
+
+// ExchangeRate представляет курс валюты к рублю на дату
+type ExchangeRate struct {
+	ID        string    `json:"id" gorm:"type:uuid;primaryKey"`
+	Currency  string    `json:"currency" gorm:"type:varchar(3);not null;uniqueIndex:idx_exchange_rate_currency_date"` // ISO 4217 (EUR, USD, CNY)
+	Date      time.Time `json:"date" gorm:"type:date;not null;uniqueIndex:idx_exchange_rate_currency_date"`
+	Rate      float64   `json:"rate" gorm:"type:decimal(15,6);not null"` // Сколько рублей стоит 1 единица валюты
+	Source    string    `json:"source" gorm:"type:varchar(20);default:'manual'"` // 'manual', 'cbr'
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TableName указывает имя таблицы
+func (ExchangeRate) TableName() string {
+	return "exchange_rates"
+}
+
+// BeforeCreate генерирует UUID
+func (er *ExchangeRate) BeforeCreate(tx *gorm.DB) error {
+	if er.ID == "" {
+		er.ID = uuid.New().String()
+	}
+	if er.Source == "" {
+		er.Source = "manual"
+	}
+	return nil
+}
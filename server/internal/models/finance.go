@@ -42,11 +42,15 @@ type FinanceTransaction struct {
 	Date            time.Time         `json:"date" gorm:"not null;index"`
 	Type            TransactionType   `json:"type" gorm:"type:varchar(50);not null;index"`
 	Category        string            `json:"category" gorm:"type:varchar(100)"` // Категория расхода/дохода
-	Amount          float64           `json:"amount" gorm:"type:decimal(15,2);not null"`
+	Amount          float64           `json:"amount" gorm:"type:decimal(15,2);not null"` // Сумма в рублях
+	Currency        string            `json:"currency" gorm:"type:varchar(3);default:'RUB'"` // Исходная валюта операции (ISO 4217)
+	OriginalAmount  float64           `json:"original_amount" gorm:"type:decimal(15,2);default:0"` // Сумма в исходной валюте
+	ExchangeRate    float64           `json:"exchange_rate" gorm:"type:decimal(15,6);default:1"` // Курс к рублю на дату операции
 	Description     string            `json:"description" gorm:"type:text"`
 	BranchID        string            `json:"branch_id" gorm:"type:uuid;index"`
 	Source          TransactionSource  `json:"source" gorm:"type:varchar(20);not null;index"` // 'bank', 'cash', 'hybrid'
 	Status          TransactionStatus `json:"status" gorm:"type:varchar(20);default:'Completed';index"`
+	PaidAt          *time.Time        `json:"paid_at,omitempty" gorm:"index"` // Дата оплаты по выписке банка (для подтвержденных банковских операций)
 	
 	// Связи
 	CounterpartyID  *string           `json:"counterparty_id" gorm:"type:uuid;index"` // Контрагент (для накладных)
@@ -83,6 +87,15 @@ func (ft *FinanceTransaction) BeforeCreate(tx *gorm.DB) error {
 	if ft.Status == "" {
 		ft.Status = TransactionStatusCompleted
 	}
+	if ft.Currency == "" {
+		ft.Currency = BaseCurrency
+	}
+	if ft.ExchangeRate == 0 {
+		ft.ExchangeRate = 1
+	}
+	if ft.OriginalAmount == 0 {
+		ft.OriginalAmount = ft.Amount
+	}
 	return nil
 }
 
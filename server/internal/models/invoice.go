@@ -14,6 +14,7 @@ const (
 	InvoiceStatusDraft     InvoiceStatus = "draft"     // Черновик
 	InvoiceStatusCompleted InvoiceStatus = "completed"  // Завершена
 	InvoiceStatusCancelled InvoiceStatus = "cancelled" // Отменена
+	InvoiceStatusVoided    InvoiceStatus = "voided"    // Аннулирована после проведения (оприходование откатано)
 )
 
 // Invoice представляет входящую накладную (Source of Truth)
@@ -22,7 +23,10 @@ type Invoice struct {
 	Number        string        `json:"number" gorm:"type:varchar(100);not null;index"` // Внешний номер накладной
 	CounterpartyID *string      `json:"counterparty_id" gorm:"type:uuid;index"` // Контрагент (поставщик)
 	Counterparty  *Counterparty `gorm:"foreignKey:CounterpartyID" json:"counterparty,omitempty"`
-	TotalAmount   float64       `json:"total_amount" gorm:"type:decimal(15,2);not null"` // Общая сумма накладной
+	TotalAmount   float64       `json:"total_amount" gorm:"type:decimal(15,2);not null"` // Общая сумма накладной в рублях
+	Currency      string        `json:"currency" gorm:"type:varchar(3);default:'RUB'"` // Валюта накладной (ISO 4217)
+	OriginalTotalAmount float64 `json:"original_total_amount" gorm:"type:decimal(15,2);default:0"` // Сумма в валюте накладной
+	ExchangeRate  float64       `json:"exchange_rate" gorm:"type:decimal(15,6);default:1"` // Курс к рублю на дату накладной
 	Status        InvoiceStatus `json:"status" gorm:"type:varchar(20);default:'draft';index"` // Статус накладной
 	BranchID      string        `json:"branch_id" gorm:"type:uuid;not null;index"` // Филиал
 	Branch        *Branch       `gorm:"foreignKey:BranchID" json:"branch,omitempty"`
@@ -56,6 +60,15 @@ func (i *Invoice) BeforeCreate(tx *gorm.DB) error {
 	if i.InvoiceDate.IsZero() {
 		i.InvoiceDate = time.Now()
 	}
+	if i.Currency == "" {
+		i.Currency = BaseCurrency
+	}
+	if i.ExchangeRate == 0 {
+		i.ExchangeRate = 1
+	}
+	if i.OriginalTotalAmount == 0 {
+		i.OriginalTotalAmount = i.TotalAmount
+	}
 	return nil
 }
 
@@ -74,3 +87,7 @@ func (i *Invoice) IsCancelled() bool {
 	return i.Status == InvoiceStatusCancelled
 }
 
+// IsVoided проверяет, аннулирована ли проведенная накладная
+func (i *Invoice) IsVoided() bool {
+	return i.Status == InvoiceStatusVoided
+}
@@ -15,6 +15,7 @@ type PizzaRecipe struct {
 	Price             int    `gorm:"not null"` // в рублях
 	Ingredients       string `gorm:"type:text"` // JSON массив ингредиентов
 	IngredientAmounts string `gorm:"type:text"` // JSON map ингредиент -> граммы
+	PrepSeconds       int    `gorm:"default:0"` // Время приготовления одной пиццы в секундах (0 - PREP_DEFAULT_SECONDS)
 	IsActive          bool   `gorm:"default:true"`
 	CreatedAt         int64  `gorm:"autoCreateTime"`
 	UpdatedAt         int64  `gorm:"autoUpdateTime"`
@@ -386,6 +387,76 @@ func AutoMigrate(db *gorm.DB) error {
 	}
 	log.Println("✅ RevenuePlan table migrated successfully")
 
+	// Мигрируем ExchangeRate (курсы валют для мультивалютных накладных)
+	if err := db.AutoMigrate(&ExchangeRate{}); err != nil {
+		log.Printf("❌ AutoMigrate для ExchangeRate failed: %v", err)
+		return err
+	}
+	log.Println("✅ ExchangeRate table migrated successfully")
+
+	// Мигрируем StockSnapshot (ежедневная оценка склада для исторических отчетов)
+	if err := db.AutoMigrate(&StockSnapshot{}); err != nil {
+		log.Printf("❌ AutoMigrate для StockSnapshot failed: %v", err)
+		return err
+	}
+	log.Println("✅ StockSnapshot table migrated successfully")
+
+	// Мигрируем PriceHistory (история закупочных цен по поставщикам)
+	if err := db.AutoMigrate(&PriceHistory{}); err != nil {
+		log.Printf("❌ AutoMigrate для PriceHistory failed: %v", err)
+		return err
+	}
+	log.Println("✅ PriceHistory table migrated successfully")
+
+	// Мигрируем IngredientSubstitution (замены сырья при нехватке на складе)
+	if err := db.AutoMigrate(&IngredientSubstitution{}); err != nil {
+		log.Printf("❌ AutoMigrate для IngredientSubstitution failed: %v", err)
+		return err
+	}
+	log.Println("✅ IngredientSubstitution table migrated successfully")
+
+	// Мигрируем SlotOutcome (журнал бронирования слотов для аналитики загрузки)
+	if err := db.AutoMigrate(&SlotOutcome{}); err != nil {
+		log.Printf("❌ AutoMigrate для SlotOutcome failed: %v", err)
+		return err
+	}
+	log.Println("✅ SlotOutcome table migrated successfully")
+
+	// Мигрируем WeekdayPlan (план выручки по умолчанию для дня недели)
+	if err := db.AutoMigrate(&WeekdayPlan{}); err != nil {
+		log.Printf("❌ AutoMigrate для WeekdayPlan failed: %v", err)
+		return err
+	}
+	log.Println("✅ WeekdayPlan table migrated successfully")
+
+	// Мигрируем BranchMenuOverride (скрытые позиции и цены меню филиала)
+	if err := db.AutoMigrate(&BranchMenuOverride{}); err != nil {
+		log.Printf("❌ AutoMigrate для BranchMenuOverride failed: %v", err)
+		return err
+	}
+	log.Println("✅ BranchMenuOverride table migrated successfully")
+
+	// Мигрируем SlotHistory (архив итогов прошедших слотов)
+	if err := db.AutoMigrate(&SlotHistory{}); err != nil {
+		log.Printf("❌ AutoMigrate для SlotHistory failed: %v", err)
+		return err
+	}
+	log.Println("✅ SlotHistory table migrated successfully")
+
+	// Мигрируем StockReservation (резерв ингредиентов под заказ)
+	if err := db.AutoMigrate(&StockReservation{}); err != nil {
+		log.Printf("❌ AutoMigrate для StockReservation failed: %v", err)
+		return err
+	}
+	log.Println("✅ StockReservation table migrated successfully")
+
+	// Мигрируем RevenuePlanActual (план выручки против факта по дням)
+	if err := db.AutoMigrate(&RevenuePlanActual{}); err != nil {
+		log.Printf("❌ AutoMigrate для RevenuePlanActual failed: %v", err)
+		return err
+	}
+	log.Println("✅ RevenuePlanActual table migrated successfully")
+
 	// Инициализируем дефолтные данные
 	if err := InitDefaultData(db); err != nil {
 		log.Printf("⚠️ Ошибка инициализации дефолтных данных: %v", err)
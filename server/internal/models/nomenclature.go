@@ -1,6 +1,11 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,9 +24,12 @@ type NomenclatureItem struct {
 	InboundUnit      string         `json:"inbound_unit" gorm:"type:varchar(20);not null;default:'kg'"` // kg, l, pcs, box - единица закупки/поступления
 	ProductionUnit   string         `json:"production_unit" gorm:"type:varchar(20);not null;default:'g'"` // g, ml, pcs - единица использования в производстве
 	ConversionFactor float64        `json:"conversion_factor" gorm:"type:decimal(10,2);default:1.0"`
+	PriceEntryUnit   string         `json:"price_entry_unit" gorm:"type:varchar(20);not null;default:'inbound'"` // inbound, base - за какую единицу указывается цена в накладной
 	UnitWeight       float64        `json:"unit_weight" gorm:"type:decimal(10,4);default:0"` // Вес одной единицы товара в граммах (для pcs, box и т.д.)
 	MinStockLevel    float64        `json:"min_stock_level" gorm:"type:decimal(10,2);default:0"`
-	StorageZone      string         `json:"storage_zone" gorm:"type:varchar(50);default:'dry_storage'"` // fridge, dry_storage, bar, freezer
+	StorageZone      string         `json:"storage_zone" gorm:"type:varchar(50);default:'dry_storage'"` // См. StorageZones: freezer, fridge, dry_storage, bar
+	ShelfLifeDays    int            `json:"shelf_life_days" gorm:"default:0"` // Срок годности в днях от даты поступления (0 - не ограничен)
+	Allergens        AllergenList   `json:"allergens" gorm:"type:jsonb;default:'[]'"` // Аллергены (глютен, молоко, яйца...) - обязательная маркировка
 	LastPrice        float64        `json:"last_price" gorm:"type:decimal(10,2);default:0"`
 	IsActive         bool           `json:"is_active" gorm:"default:true"`
 	IsSaleable       bool           `json:"is_saleable" gorm:"default:false"` // Флаг: товар для продажи (отображается в меню "Make Order")
@@ -31,6 +39,43 @@ type NomenclatureItem struct {
 	DeletedAt        gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
 }
 
+// Единица, за которую поставщик указывает цену в накладной (NomenclatureItem.PriceEntryUnit)
+const (
+	PriceEntryUnitInbound = "inbound" // Цена за InboundUnit (за 1 кг/л/шт) - сохраняется в партии как есть
+	PriceEntryUnitBase    = "base"    // Цена за BaseUnit (за 1 г/мл) - при оприходовании умножается на коэффициент конвертации
+)
+
+// ValidPriceEntryUnit проверяет значение price_entry_unit
+func ValidPriceEntryUnit(unit string) bool {
+	return unit == PriceEntryUnitInbound || unit == PriceEntryUnitBase
+}
+
+// Зоны хранения (NomenclatureItem.StorageZone) - по ним кладовщик собирает товар
+const (
+	StorageZoneDry     = "dry_storage" // Сухой склад (значение по умолчанию)
+	StorageZoneFridge  = "fridge"      // Холодильник
+	StorageZoneFreezer = "freezer"     // Морозильник
+	StorageZoneBar     = "bar"         // Бар
+)
+
+// StorageZones - допустимые зоны хранения в порядке показа
+var StorageZones = []string{StorageZoneFreezer, StorageZoneFridge, StorageZoneDry, StorageZoneBar}
+
+// ValidStorageZone проверяет значение storage_zone
+func ValidStorageZone(zone string) bool {
+	for _, valid := range StorageZones {
+		if zone == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeStorageZone приводит зону к виду из StorageZones ("Fridge " -> "fridge")
+func NormalizeStorageZone(zone string) string {
+	return strings.ToLower(strings.TrimSpace(zone))
+}
+
 // TableName указывает имя таблицы в БД
 func (NomenclatureItem) TableName() string {
 	return "nomenclature_items"
@@ -44,6 +89,57 @@ func (n *NomenclatureItem) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// AllergenList - список аллергенов товара (JSONB массив строк в БД)
+type AllergenList []string
+
+// Value реализует driver.Valuer для сохранения в БД
+func (a AllergenList) Value() (driver.Value, error) {
+	if a == nil {
+		return "[]", nil
+	}
+	bytes, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+// Scan реализует sql.Scanner для чтения из БД
+func (a *AllergenList) Scan(value interface{}) error {
+	if value == nil {
+		*a = AllergenList{}
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New("failed to unmarshal AllergenList value")
+	}
+
+	return json.Unmarshal(bytes, a)
+}
+
+// NormalizeAllergens приводит аллергены к нижнему регистру, убирает пустые и повторы, сортирует
+func NormalizeAllergens(allergens []string) AllergenList {
+	seen := make(map[string]bool, len(allergens))
+	result := make(AllergenList, 0, len(allergens))
+	for _, allergen := range allergens {
+		allergen = strings.ToLower(strings.TrimSpace(allergen))
+		if allergen == "" || seen[allergen] {
+			continue
+		}
+		seen[allergen] = true
+		result = append(result, allergen)
+	}
+	sort.Strings(result)
+	return result
+}
+
 // NomenclatureCategory представляет категорию товаров
 type NomenclatureCategory struct {
 	ID                string         `json:"id" gorm:"type:uuid;primaryKey"`
@@ -56,11 +152,33 @@ type NomenclatureCategory struct {
 	NotifyLowStock    bool           `json:"notify_low_stock" gorm:"default:false"`
 	LowStockThreshold float64        `json:"low_stock_threshold" gorm:"type:decimal(10,2);default:0"`
 	ParentID          *string        `json:"parent_id" gorm:"type:uuid;index"`
+	DepletionStrategy string         `json:"depletion_strategy" gorm:"type:varchar(10);default:'fefo'"` // fefo, fifo, lifo - порядок списания партий
+	QuarantineHours   int            `json:"quarantine_hours" gorm:"default:0"`                       // За сколько часов до истечения срока годности партия перестает списываться
 	CreatedAt         time.Time      `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt         time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
 	DeletedAt         gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
 }
 
+// Стратегии списания партий со склада
+const (
+	DepletionStrategyFEFO = "fefo" // First Expired, First Out - сначала партии с ближайшим сроком годности
+	DepletionStrategyFIFO = "fifo" // First In, First Out - сначала самые старые поступления (сухие товары без срока)
+	DepletionStrategyLIFO = "lifo" // Last In, First Out - сначала самые свежие поступления
+)
+
+// NormalizeDepletionStrategy приводит стратегию списания к нижнему регистру (пустая - FEFO)
+// Возвращает false для неизвестной стратегии
+func NormalizeDepletionStrategy(strategy string) (string, bool) {
+	strategy = strings.ToLower(strings.TrimSpace(strategy))
+	switch strategy {
+	case "":
+		return DepletionStrategyFEFO, true
+	case DepletionStrategyFEFO, DepletionStrategyFIFO, DepletionStrategyLIFO:
+		return strategy, true
+	}
+	return "", false
+}
+
 // TableName указывает имя таблицы в БД
 func (NomenclatureCategory) TableName() string {
 	return "nomenclature_categories"
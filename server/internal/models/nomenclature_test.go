@@ -0,0 +1,66 @@
+package models
+
+import "testing"
+
+func TestNormalizeDepletionStrategy(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"", DepletionStrategyFEFO, true},
+		{"fefo", DepletionStrategyFEFO, true},
+		{" FIFO ", DepletionStrategyFIFO, true},
+		{"Lifo", DepletionStrategyLIFO, true},
+		{"random", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := NormalizeDepletionStrategy(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("NormalizeDepletionStrategy(%q) = %q, %v, want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNormalizeAllergens(t *testing.T) {
+	got := NormalizeAllergens([]string{" Молоко", "глютен", "", "МОЛОКО", "  ", "яйца"})
+	want := AllergenList{"глютен", "молоко", "яйца"}
+	if len(got) != len(want) {
+		t.Fatalf("NormalizeAllergens = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("NormalizeAllergens = %v, want %v", got, want)
+		}
+	}
+	// Пустой список сохраняется как [] (не null), чтобы отличаться от непереданного поля
+	if got := NormalizeAllergens(nil); got == nil || len(got) != 0 {
+		t.Errorf("NormalizeAllergens(nil) = %#v, want пустой список", got)
+	}
+}
+
+func TestAllergenListValueAndScan(t *testing.T) {
+	if value, err := AllergenList(nil).Value(); err != nil || value != "[]" {
+		t.Errorf("nil.Value() = %v, %v; want \"[]\"", value, err)
+	}
+	value, err := AllergenList{"глютен", "молоко"}.Value()
+	if err != nil {
+		t.Fatalf("Value: %v", err)
+	}
+
+	// Драйвер может вернуть jsonb и строкой, и байтами
+	for _, raw := range []interface{}{value, []byte(value.(string))} {
+		var scanned AllergenList
+		if err := scanned.Scan(raw); err != nil || len(scanned) != 2 || scanned[0] != "глютен" || scanned[1] != "молоко" {
+			t.Errorf("Scan(%T) = %v, %v; want [глютен молоко]", raw, scanned, err)
+		}
+	}
+
+	var scanned AllergenList
+	if err := scanned.Scan(nil); err != nil || scanned == nil || len(scanned) != 0 {
+		t.Errorf("Scan(nil) = %#v, %v; want пустой список", scanned, err)
+	}
+	if err := scanned.Scan(42); err == nil {
+		t.Error("Scan(int) прошел без ошибки")
+	}
+}
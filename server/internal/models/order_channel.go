@@ -0,0 +1,28 @@
+package models
+
+import "strings"
+
+// Каналы, через которые поступают заказы (для аналитики выручки по каналам)
+const (
+	OrderChannelWebsite  = "website"  // Сайт (магазин)
+	OrderChannelTelegram = "telegram" // Telegram бот
+	OrderChannelWalkIn   = "walk_in"  // Гость в зале / на кассе
+	OrderChannelUnknown  = "unknown"  // Заказы, созданные до появления канала
+)
+
+// OrderChannelHeader - заголовок HTTP запроса (и ключ gRPC metadata в нижнем регистре) с каналом заказа
+const OrderChannelHeader = "X-Order-Channel"
+
+// maxOrderChannelLength - ограничение длины канала (колонка orders.channel VARCHAR(50))
+const maxOrderChannelLength = 50
+
+// NormalizeOrderChannel приводит канал к нижнему регистру snake_case ("Walk-In" -> "walk_in")
+// Неизвестные каналы допускаются (новые интеграции), пустой или слишком длинный канал - fallback
+func NormalizeOrderChannel(channel, fallback string) string {
+	channel = strings.ToLower(strings.TrimSpace(channel))
+	channel = strings.NewReplacer("-", "_", " ", "_").Replace(channel)
+	if channel == "" || len(channel) > maxOrderChannelLength {
+		return fallback
+	}
+	return channel
+}
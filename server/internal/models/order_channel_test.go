@@ -0,0 +1,25 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeOrderChannel(t *testing.T) {
+	cases := []struct {
+		channel, fallback, want string
+	}{
+		{"telegram", OrderChannelWebsite, OrderChannelTelegram},
+		{" Walk-In ", OrderChannelWebsite, OrderChannelWalkIn},
+		{"walk in", OrderChannelWebsite, OrderChannelWalkIn},
+		{"Delivery Club", OrderChannelWebsite, "delivery_club"}, // Новые интеграции допускаются
+		{"", OrderChannelWebsite, OrderChannelWebsite},
+		{"   ", "", ""},
+		{strings.Repeat("x", 51), OrderChannelWebsite, OrderChannelWebsite},
+	}
+	for _, tc := range cases {
+		if got := NormalizeOrderChannel(tc.channel, tc.fallback); got != tc.want {
+			t.Errorf("NormalizeOrderChannel(%q, %q) = %q, want %q", tc.channel, tc.fallback, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Политика для скидки больше суммы заказа или позиции (ORDER_DISCOUNT_POLICY)
+const (
+	DiscountPolicyClamp  = "clamp"  // Скидка уменьшается до суммы: позиция или заказ становятся бесплатными
+	DiscountPolicyReject = "reject" // Заказ отклоняется с ErrDiscountExceedsTotal
+)
+
+// Ошибки проверки скидок заказа
+var (
+	ErrInvalidDiscount      = errors.New("некорректная скидка")
+	ErrDiscountExceedsTotal = errors.New("скидка больше суммы заказа")
+)
+
+var (
+	discountPolicyMu sync.RWMutex
+	discountPolicy   = DiscountPolicyClamp
+)
+
+// SetDiscountPolicy задает политику для слишком больших скидок (вызывается один раз при старте)
+// Неизвестное значение - DiscountPolicyClamp
+func SetDiscountPolicy(policy string) {
+	policy = strings.ToLower(strings.TrimSpace(policy))
+	if policy != DiscountPolicyReject {
+		policy = DiscountPolicyClamp
+	}
+	discountPolicyMu.Lock()
+	discountPolicy = policy
+	discountPolicyMu.Unlock()
+}
+
+// GetDiscountPolicy возвращает текущую политику для слишком больших скидок
+func GetDiscountPolicy() string {
+	discountPolicyMu.RLock()
+	defer discountPolicyMu.RUnlock()
+	return discountPolicy
+}
+
+// OrderPrice - расчет итоговой цены заказа (все суммы в рублях)
+type OrderPrice struct {
+	ItemsPrice    int `json:"items_price"`    // Сумма позиций без скидок (PizzaOrder.TotalPrice)
+	ItemDiscounts int `json:"item_discounts"` // Сумма скидок на позиции
+	OrderDiscount int `json:"order_discount"` // Скидка на заказ (PizzaOrder.DiscountAmount)
+	DeliveryFee   int `json:"delivery_fee"`
+	FinalPrice    int `json:"final_price"`
+}
+
+// LineTotal возвращает стоимость позиции без скидки (цена за единицу * количество)
+func (item PizzaItem) LineTotal() int {
+	return item.Price * item.Quantity
+}
+
+// LineDiscount возвращает скидку на позицию в рублях
+// Сумма скидки имеет приоритет над процентом; скидка не превышает стоимость позиции
+func (item PizzaItem) LineDiscount() int {
+	total := item.LineTotal()
+	discount := item.DiscountAmount
+	if discount == 0 && item.DiscountPercent > 0 {
+		discount = total * item.DiscountPercent / 100
+	}
+	if discount < 0 {
+		return 0
+	}
+	if discount > total {
+		return total
+	}
+	return discount
+}
+
+// ItemDiscountTotal возвращает сумму скидок на позиции заказа
+func (o PizzaOrder) ItemDiscountTotal() int {
+	total := 0
+	for _, item := range o.Items {
+		total += item.LineDiscount()
+	}
+	return total
+}
+
+// CalculateOrderPrice считает итоговую цену заказа
+// Скидки на позиции применяются первыми; скидка на заказ (сумма или процент) считается
+// от суммы позиций уже после их скидок, поэтому одна и та же скидка не применяется дважды
+func CalculateOrderPrice(items []PizzaItem, deliveryFee, discountAmount, discountPercent int) OrderPrice {
+	price := OrderPrice{DeliveryFee: deliveryFee}
+	for _, item := range items {
+		price.ItemsPrice += item.LineTotal()
+		price.ItemDiscounts += item.LineDiscount()
+	}
+
+	subtotal := price.ItemsPrice - price.ItemDiscounts
+	price.OrderDiscount = discountAmount
+	if discountPercent > 0 && discountAmount == 0 {
+		price.OrderDiscount = subtotal * discountPercent / 100
+	}
+	if price.OrderDiscount > subtotal {
+		price.OrderDiscount = subtotal
+	}
+	if price.OrderDiscount < 0 {
+		price.OrderDiscount = 0
+	}
+
+	price.FinalPrice = subtotal - price.OrderDiscount + deliveryFee
+	return price
+}
+
+// ValidateOrderPrice проверяет скидки заказа и считает цену (как CalculateOrderPrice)
+// Отрицательная сумма скидки или процент вне 0..100 (на позицию или на заказ) - всегда ErrInvalidDiscount.
+// Сумма скидки больше стоимости позиции или суммы позиций после их скидок: при DiscountPolicyReject -
+// ErrDiscountExceedsTotal, при DiscountPolicyClamp скидка уменьшается. Итоговая цена меньше 0 не принимается никогда
+func ValidateOrderPrice(items []PizzaItem, deliveryFee, discountAmount, discountPercent int) (OrderPrice, error) {
+	reject := GetDiscountPolicy() == DiscountPolicyReject
+	for _, item := range items {
+		if err := validateDiscount(item.DiscountAmount, item.DiscountPercent); err != nil {
+			return OrderPrice{}, fmt.Errorf("%w на позицию '%s': %v", ErrInvalidDiscount, item.PizzaName, err)
+		}
+		if reject && item.DiscountAmount > item.LineTotal() {
+			return OrderPrice{}, fmt.Errorf("%w: скидка на позицию '%s' %d руб больше ее стоимости %d руб",
+				ErrDiscountExceedsTotal, item.PizzaName, item.DiscountAmount, item.LineTotal())
+		}
+	}
+	if err := validateDiscount(discountAmount, discountPercent); err != nil {
+		return OrderPrice{}, fmt.Errorf("%w на заказ: %v", ErrInvalidDiscount, err)
+	}
+
+	price := CalculateOrderPrice(items, deliveryFee, discountAmount, discountPercent)
+	if subtotal := price.ItemsPrice - price.ItemDiscounts; reject && discountAmount > subtotal {
+		return OrderPrice{}, fmt.Errorf("%w: скидка на заказ %d руб, сумма позиций %d руб", ErrDiscountExceedsTotal, discountAmount, subtotal)
+	}
+	if err := CheckFinalPrice(price.FinalPrice); err != nil {
+		return OrderPrice{}, err
+	}
+	return price, nil
+}
+
+// CheckFinalPrice не пропускает отрицательную итоговую цену: она попала бы в выручку со знаком минус
+func CheckFinalPrice(finalPrice int) error {
+	if finalPrice < 0 {
+		return fmt.Errorf("%w: итоговая цена %d руб", ErrDiscountExceedsTotal, finalPrice)
+	}
+	return nil
+}
+
+// validateDiscount проверяет границы одной скидки: сумма не отрицательная, процент от 0 до 100
+func validateDiscount(amount, percent int) error {
+	if amount < 0 {
+		return fmt.Errorf("сумма скидки %d руб меньше 0", amount)
+	}
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("процент скидки %d вне диапазона 0-100", percent)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateOrderPriceRejectsPercentOver100(t *testing.T) {
+	t.Cleanup(func() { SetDiscountPolicy(DiscountPolicyClamp) })
+	items := []PizzaItem{{PizzaName: "Маргарита", Price: 500, Quantity: 2}}
+
+	// Процент вне 0..100 отклоняется при любой политике
+	for _, policy := range []string{DiscountPolicyClamp, DiscountPolicyReject} {
+		SetDiscountPolicy(policy)
+		if _, err := ValidateOrderPrice(items, 0, 0, 150); !errors.Is(err, ErrInvalidDiscount) {
+			t.Errorf("%s: скидка 150%% на заказ err = %v, want ErrInvalidDiscount", policy, err)
+		}
+		overItem := []PizzaItem{{PizzaName: "Маргарита", Price: 500, Quantity: 2, DiscountPercent: 101}}
+		if _, err := ValidateOrderPrice(overItem, 0, 0, 0); !errors.Is(err, ErrInvalidDiscount) {
+			t.Errorf("%s: скидка 101%% на позицию err = %v, want ErrInvalidDiscount", policy, err)
+		}
+		if _, err := ValidateOrderPrice(items, 0, -100, 0); !errors.Is(err, ErrInvalidDiscount) {
+			t.Errorf("%s: отрицательная скидка err = %v, want ErrInvalidDiscount", policy, err)
+		}
+	}
+
+	// 100% - граница допустимого: заказ бесплатный, доставка остается
+	price, err := ValidateOrderPrice(items, 200, 0, 100)
+	if err != nil {
+		t.Fatalf("скидка 100%%: %v", err)
+	}
+	if price.FinalPrice != 200 {
+		t.Errorf("итог при скидке 100%% = %d, want 200 (только доставка)", price.FinalPrice)
+	}
+}
+
+func TestValidateOrderPriceFixedDiscountOverTotal(t *testing.T) {
+	t.Cleanup(func() { SetDiscountPolicy(DiscountPolicyClamp) })
+	items := []PizzaItem{
+		{PizzaName: "Маргарита", Price: 500, Quantity: 2, DiscountAmount: 100},
+		{PizzaName: "Пепперони", Price: 700, Quantity: 1},
+	}
+
+	// clamp: скидка на заказ уменьшается до суммы позиций после их скидок (1600), итог не уходит в минус
+	SetDiscountPolicy(DiscountPolicyClamp)
+	price, err := ValidateOrderPrice(items, 150, 5000, 0)
+	if err != nil {
+		t.Fatalf("clamp: %v", err)
+	}
+	if price.OrderDiscount != 1600 || price.FinalPrice != 150 {
+		t.Errorf("clamp: скидка %d, итог %d, want 1600 и 150", price.OrderDiscount, price.FinalPrice)
+	}
+
+	// reject: та же скидка - ошибка
+	SetDiscountPolicy(DiscountPolicyReject)
+	if _, err := ValidateOrderPrice(items, 150, 5000, 0); !errors.Is(err, ErrDiscountExceedsTotal) {
+		t.Errorf("reject: скидка больше суммы err = %v, want ErrDiscountExceedsTotal", err)
+	}
+	overItem := []PizzaItem{{PizzaName: "Маргарита", Price: 500, Quantity: 1, DiscountAmount: 600}}
+	if _, err := ValidateOrderPrice(overItem, 0, 0, 0); !errors.Is(err, ErrDiscountExceedsTotal) {
+		t.Errorf("reject: скидка на позицию больше ее стоимости err = %v, want ErrDiscountExceedsTotal", err)
+	}
+	// Скидка ровно на сумму допустима
+	if price, err := ValidateOrderPrice(items, 0, 1600, 0); err != nil || price.FinalPrice != 0 {
+		t.Errorf("reject: скидка на всю сумму = (%d, %v), want (0, nil)", price.FinalPrice, err)
+	}
+}
+
+func TestCheckFinalPriceRejectsNegative(t *testing.T) {
+	if err := CheckFinalPrice(-1); !errors.Is(err, ErrDiscountExceedsTotal) {
+		t.Errorf("CheckFinalPrice(-1) = %v, want ErrDiscountExceedsTotal", err)
+	}
+	if err := CheckFinalPrice(0); err != nil {
+		t.Errorf("CheckFinalPrice(0) = %v, want nil", err)
+	}
+}
+
+func TestSetDiscountPolicyFallsBackToClamp(t *testing.T) {
+	t.Cleanup(func() { SetDiscountPolicy(DiscountPolicyClamp) })
+	SetDiscountPolicy(" REJECT ")
+	if got := GetDiscountPolicy(); got != DiscountPolicyReject {
+		t.Errorf("политика %q, want %q", got, DiscountPolicyReject)
+	}
+	SetDiscountPolicy("drop")
+	if got := GetDiscountPolicy(); got != DiscountPolicyClamp {
+		t.Errorf("неизвестная политика -> %q, want %q", got, DiscountPolicyClamp)
+	}
+}
+
+func TestCalculateOrderPriceMixesItemAndOrderDiscounts(t *testing.T) {
+	cases := []struct {
+		name            string
+		items           []PizzaItem
+		deliveryFee     int
+		discountAmount  int
+		discountPercent int
+		want            OrderPrice
+	}{
+		{
+			// Процент на заказ считается от суммы после скидок позиций: 10% от 1600, а не от 1700
+			name: "процент на позицию и процент на заказ",
+			items: []PizzaItem{
+				{PizzaName: "Маргарита", Price: 500, Quantity: 2, DiscountPercent: 10},
+				{PizzaName: "Пепперони", Price: 700, Quantity: 1},
+			},
+			deliveryFee: 200, discountPercent: 10,
+			want: OrderPrice{ItemsPrice: 1700, ItemDiscounts: 100, OrderDiscount: 160, DeliveryFee: 200, FinalPrice: 1640},
+		},
+		{
+			name: "сумма на позицию и процент на заказ",
+			items: []PizzaItem{
+				{PizzaName: "Маргарита", Price: 500, Quantity: 2, DiscountAmount: 150},
+				{PizzaName: "Пепперони", Price: 700, Quantity: 1},
+			},
+			discountPercent: 20,
+			want:            OrderPrice{ItemsPrice: 1700, ItemDiscounts: 150, OrderDiscount: 310, FinalPrice: 1240},
+		},
+		{
+			// 15% от 999 = 149.85, копейки отбрасываются
+			name:        "процент на позицию и сумма на заказ",
+			items:       []PizzaItem{{PizzaName: "Четыре сыра", Price: 333, Quantity: 3, DiscountPercent: 15}},
+			deliveryFee: 150, discountAmount: 100,
+			want: OrderPrice{ItemsPrice: 999, ItemDiscounts: 149, OrderDiscount: 100, DeliveryFee: 150, FinalPrice: 900},
+		},
+		{
+			// Сумма скидки имеет приоритет над процентом и на позиции, и на заказе
+			name:           "сумма важнее процента",
+			items:          []PizzaItem{{PizzaName: "Маргарита", Price: 500, Quantity: 2, DiscountAmount: 50, DiscountPercent: 50}},
+			discountAmount: 100, discountPercent: 50,
+			want: OrderPrice{ItemsPrice: 1000, ItemDiscounts: 50, OrderDiscount: 100, FinalPrice: 850},
+		},
+		{
+			name:        "без скидок",
+			items:       []PizzaItem{{PizzaName: "Пепперони", Price: 700, Quantity: 2}},
+			deliveryFee: 100,
+			want:        OrderPrice{ItemsPrice: 1400, DeliveryFee: 100, FinalPrice: 1500},
+		},
+	}
+	for _, tc := range cases {
+		got := CalculateOrderPrice(tc.items, tc.deliveryFee, tc.discountAmount, tc.discountPercent)
+		if got != tc.want {
+			t.Errorf("%s: %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
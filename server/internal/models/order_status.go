@@ -0,0 +1,72 @@
+package models
+
+import "strings"
+
+// OrderStatus представляет статус заказа клиента (State Machine)
+// Все изменения статуса заказа должны проходить через CanTransition
+type OrderStatus string
+
+const (
+	OrderStatusPending   OrderStatus = "pending"   // Создан, ждет наступления VisibleAt
+	OrderStatusAccepted  OrderStatus = "accepted"  // Показан на планшете, принят кухней
+	OrderStatusCooking   OrderStatus = "cooking"   // Готовится
+	OrderStatusReady     OrderStatus = "ready"     // Готов, ждет выдачи/курьера
+	OrderStatusCompleted OrderStatus = "completed" // Выдан клиенту
+	OrderStatusCancelled OrderStatus = "cancelled" // Отменен
+)
+
+// orderStatusTransitions - таблица разрешенных переходов
+// pending -> accepted -> cooking -> ready -> completed, отмена возможна из любого незавершенного статуса
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:  {OrderStatusAccepted, OrderStatusCancelled},
+	OrderStatusAccepted: {OrderStatusCooking, OrderStatusCancelled},
+	// cooking -> accepted: повар прервал готовку, заказ возвращается в очередь
+	OrderStatusCooking: {OrderStatusReady, OrderStatusAccepted, OrderStatusCancelled},
+	OrderStatusReady:   {OrderStatusCompleted, OrderStatusCancelled},
+	// completed и cancelled - финальные статусы
+}
+
+// ParseOrderStatus приводит строку к OrderStatus
+// Поддерживает устаревшие значения: "preparing" -> cooking, "delivered" -> completed
+func ParseOrderStatus(status string) (OrderStatus, bool) {
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case "pending":
+		return OrderStatusPending, true
+	case "accepted":
+		return OrderStatusAccepted, true
+	case "cooking", "preparing":
+		return OrderStatusCooking, true
+	case "ready":
+		return OrderStatusReady, true
+	case "completed", "delivered":
+		return OrderStatusCompleted, true
+	case "cancelled", "canceled":
+		return OrderStatusCancelled, true
+	}
+	return "", false
+}
+
+// CanTransition проверяет, разрешен ли переход заказа из статуса from в статус to
+func CanTransition(from, to OrderStatus) bool {
+	for _, allowed := range orderStatusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFinal проверяет, является ли статус финальным (из него нет переходов)
+func (s OrderStatus) IsFinal() bool {
+	return len(orderStatusTransitions[s]) == 0
+}
+
+// CanTransitionTo проверяет, разрешен ли переход заказа в новый статус
+// Пустой или неизвестный текущий статус считается pending (старые заказы без статуса)
+func (o *PizzaOrder) CanTransitionTo(newStatus OrderStatus) bool {
+	current, ok := ParseOrderStatus(o.Status)
+	if !ok {
+		current = OrderStatusPending
+	}
+	return CanTransition(current, newStatus)
+}
@@ -0,0 +1,105 @@
+package models
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	allowed := map[OrderStatus]map[OrderStatus]bool{
+		OrderStatusPending:  {OrderStatusAccepted: true, OrderStatusCancelled: true},
+		OrderStatusAccepted: {OrderStatusCooking: true, OrderStatusCancelled: true},
+		OrderStatusCooking:  {OrderStatusReady: true, OrderStatusAccepted: true, OrderStatusCancelled: true},
+		OrderStatusReady:    {OrderStatusCompleted: true, OrderStatusCancelled: true},
+	}
+	all := []OrderStatus{
+		OrderStatusPending, OrderStatusAccepted, OrderStatusCooking,
+		OrderStatusReady, OrderStatusCompleted, OrderStatusCancelled,
+	}
+
+	// Полный перебор пар: разрешены ровно ребра таблицы переходов
+	for _, from := range all {
+		for _, to := range all {
+			want := allowed[from][to]
+			if got := CanTransition(from, to); got != want {
+				t.Errorf("CanTransition(%s, %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestCanTransitionIllegalReverts(t *testing.T) {
+	tests := []struct {
+		from, to OrderStatus
+	}{
+		{OrderStatusReady, OrderStatusPending},
+		{OrderStatusReady, OrderStatusCooking},
+		{OrderStatusCooking, OrderStatusPending},
+		{OrderStatusAccepted, OrderStatusPending},
+		{OrderStatusCompleted, OrderStatusPending},
+		{OrderStatusCompleted, OrderStatusReady},
+		{OrderStatusCompleted, OrderStatusCancelled},
+		{OrderStatusCancelled, OrderStatusPending},
+	}
+	for _, tt := range tests {
+		if CanTransition(tt.from, tt.to) {
+			t.Errorf("CanTransition(%s, %s) = true, want false", tt.from, tt.to)
+		}
+	}
+
+	for _, s := range []OrderStatus{OrderStatusCompleted, OrderStatusCancelled} {
+		if !s.IsFinal() {
+			t.Errorf("%s.IsFinal() = false, want true", s)
+		}
+	}
+	if OrderStatusReady.IsFinal() {
+		t.Error("ready.IsFinal() = true, want false")
+	}
+}
+
+func TestParseOrderStatus(t *testing.T) {
+	tests := []struct {
+		in   string
+		want OrderStatus
+		ok   bool
+	}{
+		{"pending", OrderStatusPending, true},
+		{"accepted", OrderStatusAccepted, true},
+		{"cooking", OrderStatusCooking, true},
+		{"ready", OrderStatusReady, true},
+		{"completed", OrderStatusCompleted, true},
+		{"cancelled", OrderStatusCancelled, true},
+		// Устаревшие значения
+		{"preparing", OrderStatusCooking, true},
+		{"delivered", OrderStatusCompleted, true},
+		{"canceled", OrderStatusCancelled, true},
+		{" Ready ", OrderStatusReady, true},
+		{"", "", false},
+		{"lost", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseOrderStatus(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseOrderStatus(%q) = %q, %v, want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPizzaOrderCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		status string
+		to     OrderStatus
+		want   bool
+	}{
+		// Устаревший статус приводится к новому перед проверкой
+		{"preparing", OrderStatusReady, true},
+		{"delivered", OrderStatusCancelled, false},
+		{"canceled", OrderStatusAccepted, false},
+		// Пустой статус считается pending
+		{"", OrderStatusAccepted, true},
+		{"", OrderStatusReady, false},
+	}
+	for _, tt := range tests {
+		o := &PizzaOrder{Status: tt.status}
+		if got := o.CanTransitionTo(tt.to); got != tt.want {
+			t.Errorf("PizzaOrder{Status: %q}.CanTransitionTo(%s) = %v, want %v", tt.status, tt.to, got, tt.want)
+		}
+	}
+}
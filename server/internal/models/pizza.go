@@ -38,6 +38,7 @@ type Pizza struct {
 	Ingredients       []string        `json:"ingredients"` // Старые ингредиенты из PizzaRecipe (для обратной совместимости)
 	IngredientAmounts map[string]int  `json:"ingredient_amounts"` // Дозировка ингредиентов в граммах
 	IngredientNames   []string        `json:"ingredient_names,omitempty"` // Названия ингредиентов из номенклатуры (только неопциональные)
+	PrepSeconds       int             `json:"prep_seconds,omitempty"` // Время приготовления одной пиццы (0 - значение по умолчанию)
 }
 
 type Extra struct {
@@ -58,6 +59,8 @@ type PizzaItem struct {
 	ExtrasPrice int      `json:"extras_price,omitempty"` // Цена допов (за единицу)
 	SetName     string   `json:"set_name,omitempty"` // Название набора, если это элемент набора
 	IsSetItem   bool     `json:"is_set_item,omitempty"` // Флаг что это элемент набора
+	DiscountAmount  int  `json:"discount_amount,omitempty"`  // Скидка на позицию в рублях (на все количество)
+	DiscountPercent int  `json:"discount_percent,omitempty"` // Процент скидки на позицию (если не задана сумма)
 }
 
 type PizzaOrder struct {
@@ -69,9 +72,10 @@ type PizzaOrder struct {
 	SetName     string      `json:"set_name,omitempty"` // Название набора если is_set=true
 	TotalPrice  int         `json:"total_price"`
 	CreatedAt   time.Time   `json:"created_at"`
-	Status      string      `json:"status"` // "pending", "preparing", "ready", "delivered"
+	Status      string      `json:"status"` // См. OrderStatus: "pending", "accepted", "cooking", "ready", "completed", "cancelled"
 	
 	// Информация для курьеров
+
 	CustomerFirstName string `json:"customer_first_name,omitempty"` // Имя клиента
 	CustomerLastName  string `json:"customer_last_name,omitempty"`  // Фамилия клиента
 	DeliveryAddress    string `json:"delivery_address,omitempty"`    // Адрес доставки
@@ -80,19 +84,25 @@ type PizzaOrder struct {
 	PaymentMethod      string `json:"payment_method,omitempty"`      // CASH, CARD_ONLINE, CRYPTO
 	IsPickup           bool   `json:"is_pickup"`                     // Самовывоз
 	PickupLocationID   string `json:"pickup_location_id,omitempty"`  // ID филиала для самовывоза
+	Channel            string `json:"channel,omitempty"`             // Канал заказа (см. OrderChannel*): website, telegram, walk_in
 	
 	// Информация для админов
-	DiscountAmount    int    `json:"discount_amount,omitempty"`    // Сумма скидки
-	DiscountPercent   int    `json:"discount_percent,omitempty"`   // Процент скидки
-	FinalPrice        int    `json:"final_price,omitempty"`        // Итоговая цена со скидкой
+
+	DiscountAmount    int    `json:"discount_amount,omitempty"`    // Сумма скидки на заказ (скидки на позиции хранятся в Items)
+	DiscountPercent   int    `json:"discount_percent,omitempty"`   // Процент скидки на заказ (от суммы позиций после их скидок)
+	FinalPrice        int    `json:"final_price,omitempty"`        // Итоговая цена со скидками на позиции и на заказ
 	Notes             string `json:"notes,omitempty"`               // Дополнительные заметки
 	
 	// Capacity-Based Slot Scheduling
+
 	TargetSlotID      string    `json:"target_slot_id,omitempty"`     // ID временного слота
 	TargetSlotStartTime time.Time `json:"target_slot_start_time,omitempty"` // Время начала слота (UTC, RFC3339)
 	VisibleAt         time.Time `json:"visible_at,omitempty"`         // Время, когда заказ должен появиться на планшете (UTC, RFC3339)
+	PrepSeconds       int       `json:"prep_seconds,omitempty"`       // Оценка времени приготовления: сумма prep_seconds позиций (см. EstimatePrepSeconds)
+	DueAt             time.Time `json:"due_at,omitempty"`             // Когда заказ должен быть готов: VisibleAt + PrepSeconds (см. RefreshDueAt)
 	
 	// Станции кухни
+
 	CanWork           bool      `json:"can_work,omitempty"`           // Виртуальное поле: может ли станция работать с этим заказом
 }
 
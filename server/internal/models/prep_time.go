@@ -0,0 +1,57 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultPrepSeconds - время приготовления пиццы, если у нее не задано prep_seconds и не настроен PREP_DEFAULT_SECONDS
+const DefaultPrepSeconds = 600
+
+var (
+	prepMu             sync.RWMutex
+	defaultPrepSeconds = DefaultPrepSeconds
+)
+
+// SetDefaultPrepSeconds задает время приготовления по умолчанию (вызывается один раз при старте); <= 0 - DefaultPrepSeconds
+func SetDefaultPrepSeconds(seconds int) {
+	if seconds <= 0 {
+		seconds = DefaultPrepSeconds
+	}
+	prepMu.Lock()
+	defaultPrepSeconds = seconds
+	prepMu.Unlock()
+}
+
+// PizzaPrepSeconds возвращает время приготовления одной пиццы из меню (или значение по умолчанию)
+func PizzaPrepSeconds(pizzaName string) int {
+	if pizza, ok := GetPizza(pizzaName); ok && pizza.PrepSeconds > 0 {
+		return pizza.PrepSeconds
+	}
+	prepMu.RLock()
+	defer prepMu.RUnlock()
+	return defaultPrepSeconds
+}
+
+// EstimatePrepSeconds суммирует время приготовления позиций заказа с учетом количества
+func EstimatePrepSeconds(items []PizzaItem) int {
+	total := 0
+	for _, item := range items {
+		total += PizzaPrepSeconds(item.PizzaName) * item.Quantity
+	}
+	return total
+}
+
+// RefreshDueAt пересчитывает DueAt: заказ должен быть готов через PrepSeconds после появления на планшете
+// (VisibleAt, а если его нет - начало слота). Без оценки или без слота DueAt обнуляется
+func (o *PizzaOrder) RefreshDueAt() {
+	start := o.VisibleAt
+	if start.IsZero() {
+		start = o.TargetSlotStartTime
+	}
+	if o.PrepSeconds <= 0 || start.IsZero() {
+		o.DueAt = time.Time{}
+		return
+	}
+	o.DueAt = start.Add(time.Duration(o.PrepSeconds) * time.Second)
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimatePrepSecondsSumsItems(t *testing.T) {
+	previous := GetAllPizzas()
+	t.Cleanup(func() {
+		SetPizzas(previous)
+		SetDefaultPrepSeconds(DefaultPrepSeconds)
+	})
+
+	SetDefaultPrepSeconds(480)
+	SetPizzas(map[string]Pizza{
+		"Маргарита":   {Name: "Маргарита", PrepSeconds: 300},
+		"Пепперони":   {Name: "Пепперони", PrepSeconds: 420},
+		"Четыре сыра": {Name: "Четыре сыра"}, // время не задано - берется значение по умолчанию
+	})
+
+	items := []PizzaItem{
+		{PizzaName: "Маргарита", Quantity: 1},
+		{PizzaName: "Пепперони", Quantity: 2},
+		{PizzaName: "Четыре сыра", Quantity: 1},
+	}
+
+	want := 300 + 2*420 + 480
+	if got := EstimatePrepSeconds(items); got != want {
+		t.Fatalf("EstimatePrepSeconds = %d, want %d", got, want)
+	}
+
+	visibleAt := time.Date(2030, 1, 18, 12, 0, 0, 0, time.UTC)
+	order := PizzaOrder{
+		Items:               items,
+		PrepSeconds:         want,
+		VisibleAt:           visibleAt,
+		TargetSlotStartTime: visibleAt.Add(30 * time.Minute),
+	}
+	order.RefreshDueAt()
+	if wantDue := visibleAt.Add(time.Duration(want) * time.Second); !order.DueAt.Equal(wantDue) {
+		t.Errorf("DueAt = %s, want %s", order.DueAt, wantDue)
+	}
+}
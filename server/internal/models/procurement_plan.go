@@ -99,6 +99,9 @@ type ProcurementPlanItem struct {
 	SuggestedSupplier    *Counterparty  `gorm:"foreignKey:SuggestedSupplierID" json:"suggested_supplier,omitempty"`
 	SuggestedPricePerUnit float64       `json:"suggested_price_per_unit" gorm:"type:decimal(10,2);default:0"`
 	
+	// Автозаполнение из прогноза (false = количество введено менеджером вручную)
+	IsAutoFilled         bool           `json:"is_auto_filled" gorm:"default:false"`
+	
 	// Метаданные
 	Notes                string         `json:"notes" gorm:"type:text"`
 	CreatedAt            time.Time      `json:"created_at" gorm:"autoCreateTime"`
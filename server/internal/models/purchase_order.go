@@ -1,6 +1,8 @@
 package models
 
 import (
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,6 +14,7 @@ type PurchaseOrderStatus string
 
 const (
 	PurchaseOrderStatusDraft            PurchaseOrderStatus = "draft"             // Черновик
+	PurchaseOrderStatusPendingApproval  PurchaseOrderStatus = "pending_approval"  // Сумма выше порога - ждет утверждения менеджером
 	PurchaseOrderStatusOrdered          PurchaseOrderStatus = "ordered"           // Отправлен поставщику
 	PurchaseOrderStatusPartiallyReceived PurchaseOrderStatus = "partially_received" // Частично получен
 	PurchaseOrderStatusReceived         PurchaseOrderStatus = "received"          // Получен полностью
@@ -46,6 +49,7 @@ type PurchaseOrder struct {
 	// Ответственные лица
 	CreatedBy            string             `json:"created_by" gorm:"type:varchar(255);not null"` // Username менеджера
 	ApprovedBy           *string            `json:"approved_by" gorm:"type:varchar(255)"` // Username утвердившего
+	ApprovedAt           *time.Time         `json:"approved_at"`                          // Время утверждения (для заказов выше порога)
 	ReceivedBy           *string            `json:"received_by" gorm:"type:varchar(255)"` // Username складского работника
 	
 	// Связь с накладной (создается автоматически при получении)
@@ -95,6 +99,11 @@ func (po *PurchaseOrder) IsDraft() bool {
 	return po.Status == PurchaseOrderStatusDraft
 }
 
+// IsPendingApproval проверяет, ждет ли заказ утверждения
+func (po *PurchaseOrder) IsPendingApproval() bool {
+	return po.Status == PurchaseOrderStatusPendingApproval
+}
+
 // IsOrdered проверяет, отправлен ли заказ поставщику
 func (po *PurchaseOrder) IsOrdered() bool {
 	return po.Status == PurchaseOrderStatusOrdered
@@ -146,6 +155,13 @@ type PurchaseOrderItem struct {
 	OrderedQuantity    float64        `json:"ordered_quantity" gorm:"type:decimal(10,2);not null"` // Заказанное количество
 	Unit               string         `json:"unit" gorm:"type:varchar(20);not null;default:'kg'"` // Единица измерения
 	
+	// Округление до упаковок поставщика (заполняется при создании заказа, если в каталоге задан PackSize)
+	RequestedQuantity  float64        `json:"requested_quantity" gorm:"type:decimal(10,2);default:0"` // Запрошенное количество до округления
+	PackCount          int            `json:"pack_count" gorm:"default:0"`                            // Количество упаковок
+	PackSize           float64        `json:"pack_size" gorm:"type:decimal(10,3);default:0"`          // Размер упаковки
+	PackUnit           string         `json:"pack_unit" gorm:"type:varchar(20)"`                      // Единица размера упаковки
+	PackRounding       string         `json:"pack_rounding,omitempty" gorm:"-"`                        // "запрошено 18 kg → 1 упак. (25 kg)"
+	
 	// Цена закупки (фиксируется на момент создания заказа)
 	PurchasePricePerUnit float64      `json:"purchase_price_per_unit" gorm:"type:decimal(10,2);not null"` // Цена за единицу на момент заказа
 	TotalPrice          float64        `json:"total_price" gorm:"type:decimal(15,2);not null"` // Общая стоимость позиции
@@ -187,6 +203,22 @@ func (poi *PurchaseOrderItem) BeforeUpdate(tx *gorm.DB) error {
 	return nil
 }
 
+// AfterFind заполняет описание округления до упаковок для ответа API
+func (poi *PurchaseOrderItem) AfterFind(tx *gorm.DB) error {
+	poi.PackRounding = poi.DescribePackRounding()
+	return nil
+}
+
+// DescribePackRounding возвращает описание округления: "запрошено 18 kg → 1 упак. (25 kg)"
+func (poi *PurchaseOrderItem) DescribePackRounding() string {
+	if poi.PackCount == 0 || poi.PackSize <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("запрошено %s %s → %d упак. (%s %s)",
+		strconv.FormatFloat(poi.RequestedQuantity, 'f', -1, 64), poi.Unit,
+		poi.PackCount, strconv.FormatFloat(poi.PackSize, 'f', -1, 64), poi.PackUnit)
+}
+
 // IsFullyReceived проверяет, получена ли позиция полностью
 func (poi *PurchaseOrderItem) IsFullyReceived() bool {
 	return poi.ReceivedQuantity >= poi.OrderedQuantity
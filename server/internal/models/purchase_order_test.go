@@ -0,0 +1,21 @@
+package models
+
+import "testing"
+
+func TestDescribePackRounding(t *testing.T) {
+	tests := []struct {
+		item PurchaseOrderItem
+		want string
+	}{
+		{PurchaseOrderItem{RequestedQuantity: 18, OrderedQuantity: 25, Unit: "kg", PackCount: 1, PackSize: 25, PackUnit: "kg"}, "запрошено 18 kg → 1 упак. (25 kg)"},
+		{PurchaseOrderItem{RequestedQuantity: 2500, OrderedQuantity: 3000, Unit: "g", PackCount: 2, PackSize: 1.5, PackUnit: "kg"}, "запрошено 2500 g → 2 упак. (1.5 kg)"},
+		// Позиция без упаковок поставщика
+		{PurchaseOrderItem{OrderedQuantity: 18, Unit: "kg"}, ""},
+		{PurchaseOrderItem{OrderedQuantity: 18, Unit: "kg", PackCount: 1}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.item.DescribePackRounding(); got != tt.want {
+			t.Errorf("DescribePackRounding(%+v) = %q, want %q", tt.item, got, tt.want)
+		}
+	}
+}
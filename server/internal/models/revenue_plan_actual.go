@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// RevenuePlanActual - итог дня: план выручки против фактической (для графика точности плана за месяц)
+// Пишется раз в день в момент закрытия (см. RevenuePlanService.StartPlanActualReconciler), повторный расчет дня перезаписывает строку
+type RevenuePlanActual struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	PlanDate        time.Time `gorm:"type:date;not null;uniqueIndex:idx_revenue_plan_actuals_date_branch,priority:1" json:"plan_date"`
+	BranchID        string    `gorm:"type:varchar(36);not null;default:'';uniqueIndex:idx_revenue_plan_actuals_date_branch,priority:2" json:"branch_id"` // Пустой - сеть целиком
+	Planned         float64   `gorm:"type:decimal(15,2);not null" json:"planned"`                                                                        // План (прогноз) на день, руб
+	Actual          float64   `gorm:"type:decimal(15,2);not null" json:"actual"`                                                                         // Фактическая выручка за день, руб
+	Variance        float64   `gorm:"type:decimal(15,2);not null" json:"variance"`                                                                       // Actual - Planned (минус - недобор)
+	VariancePercent *float64  `gorm:"type:decimal(9,2)" json:"variance_percent,omitempty"`                                                               // Variance / Planned * 100; nil при нулевом плане
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// TableName возвращает имя таблицы
+func (RevenuePlanActual) TableName() string {
+	return "revenue_plan_actuals"
+}
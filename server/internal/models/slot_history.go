@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SlotHistory - итог прошедшего слота: загрузка, заказы и емкость на момент окончания
+// Redis хранит счетчики слота только REDIS_SLOT_HISTORY_TTL_MINUTES, архив остается навсегда (см. SlotService.ArchiveEndedSlots)
+type SlotHistory struct {
+	ID                string    `json:"id" gorm:"type:uuid;primaryKey"`
+	SlotID            string    `json:"slot_id" gorm:"type:varchar(50);not null;uniqueIndex"`
+	StartTime         time.Time `json:"start_time" gorm:"not null;index"` // Начало слота (UTC)
+	EndTime           time.Time `json:"end_time" gorm:"not null"`
+	Load              int       `json:"load"`               // Итоговая загрузка слота в рублях
+	OrdersCount       int       `json:"orders_count"`       // Заказов в слоте на момент окончания (без освобожденных)
+	Capacity          int       `json:"capacity"`           // Номинальная емкость слота в рублях
+	EffectiveCapacity int       `json:"effective_capacity"` // Емкость с учетом овербукинга
+	Disabled          bool      `json:"disabled"`           // Слот был отключен
+	ArchivedAt        time.Time `json:"archived_at" gorm:"autoCreateTime"`
+}
+
+// TableName указывает имя таблицы
+func (SlotHistory) TableName() string {
+	return "slot_history"
+}
+
+// BeforeCreate генерирует UUID
+func (h *SlotHistory) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == "" {
+		h.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Исходы бронирования слота (SlotOutcome.Outcome)
+const (
+	SlotOutcomeAssigned = "assigned" // Заказ назначен на слот
+	SlotOutcomeOverflow = "overflow" // Слот был полон, заказ ушел в следующий слот
+	SlotOutcomeRejected = "rejected" // Свободных слотов на сегодня не нашлось - заказ не принят
+	SlotOutcomeReleased = "released" // Заказ отменен, место в слоте освобождено
+)
+
+// SlotOutcome - запись журнала бронирования слотов (для аналитики загрузки и отказов)
+// Redis хранит загрузку слота только несколько часов, журнал в PostgreSQL остается для подбора емкости
+type SlotOutcome struct {
+	ID         string     `json:"id" gorm:"type:uuid;primaryKey"`
+	SlotID     string     `json:"slot_id" gorm:"type:varchar(50);index"` // Пусто для rejected
+	SlotStart  *time.Time `json:"slot_start" gorm:"index"`               // Начало слота (UTC), NULL для rejected
+	BranchID   string     `json:"branch_id" gorm:"type:varchar(36);index"`
+	OrderID    string     `json:"order_id" gorm:"type:varchar(36);index"`
+	Outcome    string     `json:"outcome" gorm:"type:varchar(20);not null"`
+	OrderPrice int        `json:"order_price"` // Сумма заказа в рублях
+	Load       int        `json:"load"`        // Загрузка слота после назначения (assigned) или на момент отказа (overflow)
+	Capacity   int        `json:"capacity"`    // Номинальная емкость слота в рублях
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+// TableName указывает имя таблицы
+func (SlotOutcome) TableName() string {
+	return "slot_outcomes"
+}
+
+// BeforeCreate генерирует UUID
+func (so *SlotOutcome) BeforeCreate(tx *gorm.DB) error {
+	if so.ID == "" {
+		so.ID = uuid.New().String()
+	}
+	return nil
+}
@@ -16,6 +16,10 @@ const (
 	StatusBlacklisted StaffStatus = "Blacklisted" // В черном списке (уволен, не может вернуться)
 )
 
+// StaffPositionManager - должность менеджера (Staff.RoleName, см. InitDefaultRoles)
+// Менеджер не отдельная роль User: это сотрудник, которому доступны утверждения (RequireManagerRole)
+const StaffPositionManager = "Manager"
+
 // Staff представляет профиль СОТРУДНИКА компании
 // Содержит только рабочую информацию: должность, филиал, производительность, зарплата
 //
@@ -62,6 +62,7 @@ type Recipe struct {
 	Unit           string         `json:"unit" gorm:"type:varchar(20);default:'pcs'"` // Единица измерения порции
 	IsSemiFinished bool           `json:"is_semi_finished" gorm:"default:false"` // Флаг полуфабриката
 	IsActive       bool           `json:"is_active" gorm:"default:true"`
+	AllowSubstitutions bool       `json:"allow_substitutions" gorm:"default:false"` // Разрешить замену закончившегося сырья одобренными заменителями при списании
 	// Recipe Book fields (Frontend Knowledge Base)
 	InstructionText string        `json:"instruction_text" gorm:"type:text"` // Пошаговая инструкция в Markdown
 	VideoURL        string        `json:"video_url" gorm:"type:text"` // Ссылка на видео в S3
@@ -181,7 +182,7 @@ type StockMovement struct {
 	Batch             *StockBatch    `gorm:"foreignKey:StockBatchID" json:"batch,omitempty"`
 	NomenclatureID    string         `json:"nomenclature_id" gorm:"type:uuid;not null;index"`
 	Nomenclature      NomenclatureItem `gorm:"foreignKey:NomenclatureID" json:"nomenclature,omitempty"`
-	BranchID          string         `json:"branch_id" gorm:"type:uuid;not null;index"`
+	BranchID          string         `json:"branch_id" gorm:"type:uuid;not null;index;index:idx_stock_movements_branch_created,priority:1"`
 	Quantity          float64        `json:"quantity" gorm:"type:decimal(10,2);not null"` // Положительное = приход, отрицательное = расход
 	Unit              string         `json:"unit" gorm:"type:varchar(20);not null"`
 	MovementType      string         `json:"movement_type" gorm:"type:varchar(50);not null;index"` // 'sale', 'production', 'waste', 'adjustment', 'invoice'
@@ -190,7 +191,7 @@ type StockMovement struct {
 	Invoice           *Invoice      `gorm:"foreignKey:InvoiceID" json:"invoice,omitempty"`
 	PerformedBy       string         `json:"performed_by" gorm:"type:varchar(255)"` // Username или ID пользователя
 	Notes             string         `json:"notes" gorm:"type:text"`
-	CreatedAt         time.Time      `json:"created_at" gorm:"autoCreateTime;index"`
+	CreatedAt         time.Time      `json:"created_at" gorm:"autoCreateTime;index;index:idx_stock_movements_branch_created,priority:2"` // Журнал движений листается по (branch_id, created_at)
 	DeletedAt         gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
 }
 
@@ -218,6 +219,8 @@ type ExpiryAlert struct {
 	IsResolved    bool      `json:"is_resolved" gorm:"default:false;index"` // Решено (товар списан или продан)
 	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime;index"`
 	ResolvedAt    *time.Time `json:"resolved_at"`
+	ResolutionReason string  `json:"resolution_reason,omitempty" gorm:"type:varchar(20)"` // 'consumed', 'written_off', 'ignored'
+	ResolvedBy    string    `json:"resolved_by,omitempty"`
 }
 
 // TableName указывает имя таблицы
@@ -234,3 +237,87 @@ func (ea *ExpiryAlert) BeforeCreate(tx *gorm.DB) error {
 }
 
 
+
+// StockSnapshot представляет оценку остатка товара на филиале на конец дня
+// Снимки позволяют ответить "сколько стоил склад на дату" для бухгалтерии
+type StockSnapshot struct {
+	ID               string    `json:"id" gorm:"type:uuid;primaryKey"`
+	SnapshotDate     time.Time `json:"snapshot_date" gorm:"type:date;not null;uniqueIndex:idx_stock_snapshot_date_branch_item"`
+	BranchID         string    `json:"branch_id" gorm:"type:uuid;not null;uniqueIndex:idx_stock_snapshot_date_branch_item;index"`
+	NomenclatureID   string    `json:"nomenclature_id" gorm:"type:uuid;not null;uniqueIndex:idx_stock_snapshot_date_branch_item"`
+	NomenclatureName string    `json:"nomenclature_name" gorm:"type:varchar(255)"`
+	Quantity         float64   `json:"quantity" gorm:"type:decimal(14,4);default:0"` // В BaseUnit
+	BaseUnit         string    `json:"base_unit" gorm:"type:varchar(20)"`
+	CostValue        float64   `json:"cost_value" gorm:"type:decimal(14,2);default:0"` // Стоимость остатка, как в GetStockItems
+	CreatedAt        time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName указывает имя таблицы
+func (StockSnapshot) TableName() string {
+	return "stock_snapshots"
+}
+
+// BeforeCreate генерирует UUID
+func (ss *StockSnapshot) BeforeCreate(tx *gorm.DB) error {
+	if ss.ID == "" {
+		ss.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// PriceHistory - закупочная цена товара при оприходовании (история вместо перезаписи last_price)
+type PriceHistory struct {
+	ID             string    `json:"id" gorm:"type:uuid;primaryKey"`
+	NomenclatureID string    `json:"nomenclature_id" gorm:"type:uuid;not null;index:idx_price_history_nomenclature_date"`
+	CounterpartyID *string   `json:"counterparty_id" gorm:"type:uuid;index"`
+	InvoiceID      *string   `json:"invoice_id" gorm:"type:uuid;index"`
+	BranchID       string    `json:"branch_id" gorm:"type:uuid"`
+	Price          float64   `json:"price" gorm:"type:decimal(10,2);not null"` // Цена за InboundUnit (кг/л/шт) в рублях, как last_price
+	PriceDate      time.Time `json:"price_date" gorm:"type:date;not null;index:idx_price_history_nomenclature_date"`
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName указывает имя таблицы
+func (PriceHistory) TableName() string {
+	return "price_history"
+}
+
+// BeforeCreate генерирует UUID
+func (ph *PriceHistory) BeforeCreate(tx *gorm.DB) error {
+	if ph.ID == "" {
+		ph.ID = uuid.New().String()
+	}
+	return nil
+}
+
+// IngredientSubstitution - одобренная замена сырья, когда основной товар закончился
+// ConversionRatio - сколько базовых единиц заменителя списывается вместо одной базовой единицы основного товара
+type IngredientSubstitution struct {
+	ID                       string         `json:"id" gorm:"type:uuid;primaryKey"`
+	OriginalNomenclatureID   string         `json:"original_nomenclature_id" gorm:"type:uuid;not null;index"`
+	SubstituteNomenclatureID string         `json:"substitute_nomenclature_id" gorm:"type:uuid;not null;index"`
+	ConversionRatio          float64        `json:"conversion_ratio" gorm:"type:decimal(10,4);not null;default:1"`
+	Priority                 int            `json:"priority" gorm:"default:0"`   // Меньше - раньше используется
+	IsApproved               bool           `json:"is_approved" gorm:"not null"` // Неодобренные замены при списании не используются (без default: иначе GORM не сохранит false)
+	Notes                    string         `json:"notes" gorm:"type:text"`
+	CreatedAt                time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt                time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt                gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+
+	// Relations
+	Original   *NomenclatureItem `json:"original,omitempty" gorm:"foreignKey:OriginalNomenclatureID"`
+	Substitute *NomenclatureItem `json:"substitute,omitempty" gorm:"foreignKey:SubstituteNomenclatureID"`
+}
+
+// TableName указывает имя таблицы
+func (IngredientSubstitution) TableName() string {
+	return "ingredient_substitutions"
+}
+
+// BeforeCreate генерирует UUID
+func (is *IngredientSubstitution) BeforeCreate(tx *gorm.DB) error {
+	if is.ID == "" {
+		is.ID = uuid.New().String()
+	}
+	return nil
+}
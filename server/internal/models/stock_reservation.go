@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Статусы резерва ингредиентов
+const (
+	ReservationStatusReserved  = "reserved"  // Ингредиенты отложены под заказ, со склада не списаны
+	ReservationStatusCommitted = "committed" // Заказ приготовлен: резерв списан со склада
+	ReservationStatusReleased  = "released"  // Заказ отменен: резерв снят
+)
+
+// StockReservation - резерв товара под заказ: уменьшает доступный остаток, но партии не трогает
+// Одна запись на товар рецепта (действующий резерв уникален по заказу, рецепту и товару);
+// списание со склада - при CommitReservation (см. StockService.ReserveIngredients)
+type StockReservation struct {
+	ID             string     `json:"id" gorm:"type:uuid;primaryKey"`
+	OrderID        string     `json:"order_id" gorm:"type:varchar(36);not null;index;uniqueIndex:idx_stock_reservations_active,priority:1,where:status = 'reserved'"`
+	RecipeID       string     `json:"recipe_id" gorm:"type:uuid;not null;uniqueIndex:idx_stock_reservations_active,priority:2"`
+	BranchID       string     `json:"branch_id" gorm:"type:uuid;not null;index:idx_stock_reservations_nomenclature_branch,priority:2"`
+	NomenclatureID string     `json:"nomenclature_id" gorm:"type:uuid;not null;index:idx_stock_reservations_nomenclature_branch,priority:1;uniqueIndex:idx_stock_reservations_active,priority:3"`
+	Quantity       float64    `json:"quantity" gorm:"type:decimal(12,4);not null"` // В базовой единице товара
+	Unit           string     `json:"unit" gorm:"type:varchar(20)"`
+	Status         string     `json:"status" gorm:"type:varchar(20);not null;default:'reserved';index"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"` // Когда резерв списан или снят
+	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// TableName указывает имя таблицы
+func (StockReservation) TableName() string {
+	return "stock_reservations"
+}
+
+// BeforeCreate генерирует UUID
+func (r *StockReservation) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+	if r.Status == "" {
+		r.Status = ReservationStatusReserved
+	}
+	return nil
+}
@@ -27,6 +27,8 @@ type SupplierCatalogItem struct {
 	UoMRule              *UoMConversionRule `gorm:"foreignKey:UoMRuleID" json:"uom_rule,omitempty"` // Правило конвертации
 	Price                float64        `json:"price" gorm:"type:decimal(10,2);default:0"`    // Цена за единицу
 	MinOrderBatch        float64        `json:"min_order_batch" gorm:"type:decimal(10,2);default:0"` // Минимальная партия
+	PackSize             float64        `json:"pack_size" gorm:"type:decimal(10,3);default:0"` // Размер упаковки (25 для мешка 25 кг), 0 - заказ без округления
+	PackUnit             string         `json:"pack_unit" gorm:"type:varchar(20)"`             // Единица размера упаковки (kg, l, pcs)
 	IsActive             bool           `json:"is_active" gorm:"default:true"`                 // Активен ли этот товар у поставщика
 	
 	// Метаданные
@@ -15,6 +15,9 @@ type RecipeVersion struct {
 	ChangedBy   string    `json:"changed_by" gorm:"type:varchar(255);not null"` // ID пользователя или имя
 	ChangeReason string   `json:"change_reason" gorm:"type:text"` // Причина изменения
 	IngredientsJSON string `json:"ingredients_json" gorm:"type:text"` // JSON снимок ингредиентов на момент изменения
+	PortionSize float64   `json:"portion_size" gorm:"type:decimal(10,2)"` // Размер порции на момент изменения
+	Unit        string    `json:"unit" gorm:"type:varchar(20)"` // Единица измерения порции
+	InstructionText string `json:"instruction_text" gorm:"type:text"` // Инструкция на момент изменения
 	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
 	
 	// Relations
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// WeekdayPlan - план выручки по умолчанию для дня недели
+// Используется, если на конкретную дату план не задан (PUT /erp/daily-plan)
+type WeekdayPlan struct {
+	Weekday   int       `gorm:"primaryKey;autoIncrement:false" json:"weekday"` // 0 - воскресенье ... 6 - суббота (как time.Weekday)
+	Plan      float64   `gorm:"type:decimal(15,2);not null;default:0" json:"plan"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName возвращает имя таблицы
+func (WeekdayPlan) TableName() string {
+	return "weekday_plans"
+}
@@ -232,6 +232,8 @@ type PizzaOrder struct {
 	DeliveryAddress   string `protobuf:"bytes,20,opt,name=delivery_address,json=deliveryAddress,proto3" json:"delivery_address,omitempty"`         // Адрес доставки
 	IsPickup          bool   `protobuf:"varint,21,opt,name=is_pickup,json=isPickup,proto3" json:"is_pickup,omitempty"`                             // Самовывоз
 	PickupLocationId  string `protobuf:"bytes,22,opt,name=pickup_location_id,json=pickupLocationId,proto3" json:"pickup_location_id,omitempty"`    // ID филиала для самовывоза
+	Channel           string `protobuf:"bytes,26,opt,name=channel,proto3" json:"channel,omitempty"`                                                // Канал заказа: website, telegram, walk_in, ...
+	PrepSeconds       int32  `protobuf:"varint,27,opt,name=prep_seconds,json=prepSeconds,proto3" json:"prep_seconds,omitempty"`                   // Оценка времени приготовления заказа в секундах
 	unknownFields     protoimpl.UnknownFields
 	sizeCache         protoimpl.SizeCache
 }
@@ -406,6 +408,20 @@ func (x *PizzaOrder) GetPickupLocationId() string {
 	return ""
 }
 
+func (x *PizzaOrder) GetChannel() string {
+	if x != nil {
+		return x.Channel
+	}
+	return ""
+}
+
+func (x *PizzaOrder) GetPrepSeconds() int32 {
+	if x != nil {
+		return x.PrepSeconds
+	}
+	return 0
+}
+
 // Элемент заказа
 type PizzaItem struct {
 	state             protoimpl.MessageState `protogen:"open.v1"`
@@ -415,8 +431,10 @@ type PizzaItem struct {
 	Extras            []string               `protobuf:"bytes,3,rep,name=extras,proto3" json:"extras,omitempty"`
 	Quantity          int32                  `protobuf:"varint,4,opt,name=quantity,proto3" json:"quantity,omitempty"`
 	Price             int32                  `protobuf:"varint,5,opt,name=price,proto3" json:"price,omitempty"`
-	SetName           string                 `protobuf:"bytes,7,opt,name=set_name,json=setName,proto3" json:"set_name,omitempty"`          // Название набора, если это элемент набора
-	IsSetItem         bool                   `protobuf:"varint,8,opt,name=is_set_item,json=isSetItem,proto3" json:"is_set_item,omitempty"` // Флаг что это элемент набора
+	SetName           string                 `protobuf:"bytes,7,opt,name=set_name,json=setName,proto3" json:"set_name,omitempty"`                           // Название набора, если это элемент набора
+	IsSetItem         bool                   `protobuf:"varint,8,opt,name=is_set_item,json=isSetItem,proto3" json:"is_set_item,omitempty"`                  // Флаг что это элемент набора
+	DiscountAmount    int32                  `protobuf:"varint,9,opt,name=discount_amount,json=discountAmount,proto3" json:"discount_amount,omitempty"`     // Скидка на позицию в рублях (на все количество)
+	DiscountPercent   int32                  `protobuf:"varint,10,opt,name=discount_percent,json=discountPercent,proto3" json:"discount_percent,omitempty"` // Процент скидки на позицию (если не задана сумма)
 	unknownFields     protoimpl.UnknownFields
 	sizeCache         protoimpl.SizeCache
 }
@@ -507,6 +525,20 @@ func (x *PizzaItem) GetIsSetItem() bool {
 	return false
 }
 
+func (x *PizzaItem) GetDiscountAmount() int32 {
+	if x != nil {
+		return x.DiscountAmount
+	}
+	return 0
+}
+
+func (x *PizzaItem) GetDiscountPercent() int32 {
+	if x != nil {
+		return x.DiscountPercent
+	}
+	return 0
+}
+
 var File_internal_proto_order_proto protoreflect.FileDescriptor
 
 const file_internal_proto_order_proto_rawDesc = "" +
@@ -531,7 +563,7 @@ const file_internal_proto_order_proto_rawDesc = "" +
 	"\border_id\x18\x01 \x01(\tR\aorderId\x12\x1d\n" +
 	"\n" +
 	"display_id\x18\x02 \x01(\tR\tdisplayId\x12\x16\n" +
-	"\x06status\x18\x03 \x01(\tR\x06status\"\xc3\x05\n" +
+	"\x06status\x18\x03 \x01(\tR\x06status\"\x80\x06\n" +
 	"\n" +
 	"PizzaOrder\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1d\n" +
@@ -559,7 +591,9 @@ const file_internal_proto_order_proto_rawDesc = "" +
 	"\x0ecustomer_phone\x18\x13 \x01(\tR\rcustomerPhone\x12)\n" +
 	"\x10delivery_address\x18\x14 \x01(\tR\x0fdeliveryAddress\x12\x1b\n" +
 	"\tis_pickup\x18\x15 \x01(\bR\bisPickup\x12,\n" +
-	"\x12pickup_location_id\x18\x16 \x01(\tR\x10pickupLocationId\"\xef\x02\n" +
+	"\x12pickup_location_id\x18\x16 \x01(\tR\x10pickupLocationId\x12\x18\n" +
+	"\achannel\x18\x1a \x01(\tR\achannel\x12!\n" +
+	"\fprep_seconds\x18\x1b \x01(\x05R\vprepSeconds\"\xc3\x03\n" +
 	"\tPizzaItem\x12\x1d\n" +
 	"\n" +
 	"pizza_name\x18\x01 \x01(\tR\tpizzaName\x12 \n" +
@@ -569,7 +603,10 @@ const file_internal_proto_order_proto_rawDesc = "" +
 	"\bquantity\x18\x04 \x01(\x05R\bquantity\x12\x14\n" +
 	"\x05price\x18\x05 \x01(\x05R\x05price\x12\x19\n" +
 	"\bset_name\x18\a \x01(\tR\asetName\x12\x1e\n" +
-	"\vis_set_item\x18\b \x01(\bR\tisSetItem\x1aD\n" +
+	"\vis_set_item\x18\b \x01(\bR\tisSetItem\x12'\n" +
+	"\x0fdiscount_amount\x18\t \x01(\x05R\x0ediscountAmount\x12)\n" +
+	"\x10discount_percent\x18\n" +
+	" \x01(\x05R\x0fdiscountPercent\x1aD\n" +
 	"\x16IngredientAmountsEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
 	"\x05value\x18\x02 \x01(\x05R\x05value:\x028\x012M\n" +
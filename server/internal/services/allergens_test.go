@@ -0,0 +1,120 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Аллергены рецепта собираются со всех ингредиентов, включая полуфабрикаты любой вложенности;
+// общий полуфабрикат обходится один раз, повторы сливаются
+func TestGetRecipeAllergens(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.Recipe{}, &models.RecipeIngredient{})
+	service := NewRecipeService(db)
+
+	var itemIDs, recipeIDs []string
+	newItem := func(name string, allergens ...string) *string {
+		item := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: name, BaseUnit: "g", Allergens: allergens, IsActive: true}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("не удалось создать товар: %v", err)
+		}
+		itemIDs = append(itemIDs, item.ID)
+		return &item.ID
+	}
+	newRecipe := func(name string, semiFinished bool, ingredients ...models.RecipeIngredient) *string {
+		recipe := models.Recipe{Name: name + " " + uuid.New().String()[:8], PortionSize: 100, IsSemiFinished: semiFinished, Ingredients: ingredients}
+		if err := db.Create(&recipe).Error; err != nil {
+			t.Fatalf("не удалось создать рецепт: %v", err)
+		}
+		recipeIDs = append(recipeIDs, recipe.ID)
+		return &recipe.ID
+	}
+	t.Cleanup(func() {
+		db.Where("recipe_id IN ?", recipeIDs).Delete(&models.RecipeIngredient{})
+		db.Unscoped().Where("id IN ?", recipeIDs).Delete(&models.Recipe{})
+		db.Unscoped().Where("id IN ?", itemIDs).Delete(&models.NomenclatureItem{})
+	})
+
+	flour := newItem("Мука", "глютен")
+	cheese := newItem("Сыр", "молоко")
+	egg := newItem("Яйцо", "яйца")
+	tomato := newItem("Томаты")
+
+	// Тесто -> Основа (2 уровня полуфабрикатов); соус без аллергенов
+	dough := newRecipe("Тесто", true, models.RecipeIngredient{NomenclatureID: flour, Quantity: 100, Unit: "g"},
+		models.RecipeIngredient{NomenclatureID: egg, Quantity: 20, Unit: "g"})
+	base := newRecipe("Основа", true, models.RecipeIngredient{IngredientRecipeID: dough, Quantity: 100, Unit: "g"})
+	sauce := newRecipe("Соус", true, models.RecipeIngredient{NomenclatureID: tomato, Quantity: 50, Unit: "g"})
+	pizza := newRecipe("Пицца", false,
+		models.RecipeIngredient{IngredientRecipeID: base, Quantity: 200, Unit: "g"},
+		models.RecipeIngredient{IngredientRecipeID: dough, Quantity: 50, Unit: "g"},
+		models.RecipeIngredient{IngredientRecipeID: sauce, Quantity: 50, Unit: "g"},
+		models.RecipeIngredient{NomenclatureID: cheese, Quantity: 100, Unit: "g"},
+	)
+
+	cases := []struct {
+		recipeID *string
+		want     []string
+	}{
+		{pizza, []string{"глютен", "молоко", "яйца"}},
+		{base, []string{"глютен", "яйца"}},
+		{sauce, []string{}},
+	}
+	for _, tc := range cases {
+		got, err := service.GetRecipeAllergens(*tc.recipeID)
+		if err != nil {
+			t.Fatalf("GetRecipeAllergens: %v", err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("GetRecipeAllergens(%s) = %#v, want %#v", *tc.recipeID, got, tc.want)
+		}
+	}
+
+	if _, err := service.GetRecipeAllergens(uuid.New().String()); err == nil {
+		t.Error("аллергены несуществующего рецепта получены без ошибки")
+	}
+}
+
+// Аллергены нормализуются при сохранении; непереданный список не меняется, пустой - очищает
+func TestUpdateItemAllergens(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.UoMConversionRule{})
+	service := NewNomenclatureService(db)
+
+	item := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: "Сырный соус", BaseUnit: "g", IsActive: true,
+		Allergens: models.AllergenList{" Молоко", "молоко", "Глютен"}}
+	if err := service.CreateItem(&item); err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+	})
+
+	stored := func() models.AllergenList {
+		t.Helper()
+		var saved models.NomenclatureItem
+		if err := db.First(&saved, "id = ?", item.ID).Error; err != nil {
+			t.Fatalf("не удалось прочитать товар: %v", err)
+		}
+		return saved.Allergens
+	}
+	if got := stored(); !reflect.DeepEqual(got, models.AllergenList{"глютен", "молоко"}) {
+		t.Errorf("после создания: %v, want [глютен молоко]", got)
+	}
+
+	if err := service.UpdateItem(item.ID, &models.NomenclatureItem{SKU: item.SKU, Name: "Сырный соус 2"}); err != nil {
+		t.Fatalf("UpdateItem без аллергенов: %v", err)
+	}
+	if got := stored(); !reflect.DeepEqual(got, models.AllergenList{"глютен", "молоко"}) {
+		t.Errorf("после обновления без аллергенов: %v, want [глютен молоко]", got)
+	}
+
+	if err := service.UpdateItem(item.ID, &models.NomenclatureItem{SKU: item.SKU, Allergens: models.AllergenList{}}); err != nil {
+		t.Fatalf("UpdateItem с пустым списком: %v", err)
+	}
+	if got := stored(); len(got) != 0 {
+		t.Errorf("после очистки: %v, want пусто", got)
+	}
+}
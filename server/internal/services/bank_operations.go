@@ -0,0 +1,99 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrBankOperationNotPending - операция не является ожидающей оплаты банковской операцией
+var ErrBankOperationNotPending = errors.New("операция не ожидает оплаты")
+
+// bankOperationStatuses - статусы в запросе API (pending, paid, cancelled) -> статусы транзакций
+var bankOperationStatuses = map[string]models.TransactionStatus{
+	"pending":   models.TransactionStatusPending,
+	"paid":      models.TransactionStatusCompleted,
+	"completed": models.TransactionStatusCompleted,
+	"cancelled": models.TransactionStatusCancelled,
+}
+
+// GetBankOperations возвращает банковские операции (source = bank/hybrid)
+// status - pending, paid или cancelled (пусто = все), branchID - опционально
+func (s *FinanceService) GetBankOperations(status, branchID string) ([]models.FinanceTransaction, error) {
+	query := s.db.Preload("Counterparty").
+		Where("source IN ?", []models.TransactionSource{models.TransactionSourceBank, models.TransactionSourceHybrid})
+
+	if status != "" {
+		txStatus, ok := bankOperationStatuses[strings.ToLower(status)]
+		if !ok {
+			return nil, fmt.Errorf("неизвестный статус '%s', допустимо: pending, paid, cancelled", status)
+		}
+		query = query.Where("status = ?", txStatus)
+	}
+	if branchID != "" {
+		query = query.Where("branch_id = ?", branchID)
+	}
+
+	var operations []models.FinanceTransaction
+	if err := query.Order("date ASC, created_at ASC").Find(&operations).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки банковских операций: %w", err)
+	}
+	return operations, nil
+}
+
+// ConfirmBankOperation отмечает ожидающую банковскую операцию оплаченной по выписке банка:
+// статус Pending -> Completed, paid_at = paidAt, официальный долг контрагента уменьшается на сумму операции
+func (s *FinanceService) ConfirmBankOperation(id string, paidAt time.Time, performedBy string) (*models.FinanceTransaction, error) {
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Блокируем строку, чтобы повторное подтверждение не уменьшило долг дважды
+	var operation models.FinanceTransaction
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&operation, "id = ?", id).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if !operation.IsBankOperation() || !operation.IsPending() {
+		tx.Rollback()
+		return nil, fmt.Errorf("%w: источник %s, статус %s", ErrBankOperationNotPending, operation.Source, operation.Status)
+	}
+
+	if err := tx.Model(&operation).Updates(map[string]interface{}{
+		"status":  models.TransactionStatusCompleted,
+		"paid_at": paidAt,
+	}).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("ошибка подтверждения операции: %w", err)
+	}
+
+	// Долг по банковским операциям начислялся при оприходовании накладной
+	if operation.CounterpartyID != nil && *operation.CounterpartyID != "" && operation.Amount > 0 {
+		if err := tx.Model(&models.Counterparty{}).
+			Where("id = ?", *operation.CounterpartyID).
+			Update("balance_official", gorm.Expr("COALESCE(balance_official, 0) - ?", operation.Amount)).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("ошибка обновления баланса контрагента: %w", err)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("ошибка коммита транзакции: %w", err)
+	}
+
+	log.Printf("✅ Банковская операция %s подтверждена (%s): сумма=%.2f, дата оплаты=%s",
+		id, performedBy, operation.Amount, paidAt.Format("2006-01-02"))
+
+	return s.GetTransactionByID(id)
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+)
+
+// Подтверждение ожидающей банковской операции уменьшает официальный долг поставщика на сумму операции
+func TestConfirmBankOperation(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.Counterparty{}, &models.Invoice{},
+		&models.FinanceTransaction{})
+	service := NewFinanceService(db)
+	branchID := newTestBranch(t, db)
+	supplierID := newTestCounterparty(t, db)
+	t.Cleanup(func() {
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.FinanceTransaction{})
+	})
+	if err := db.Model(&models.Counterparty{}).Where("id = ?", supplierID).
+		Updates(map[string]interface{}{"balance_official": 1500, "balance_internal": 300}).Error; err != nil {
+		t.Fatalf("не удалось задать долг поставщика: %v", err)
+	}
+
+	newOperation := func(source models.TransactionSource, status models.TransactionStatus, amount float64) string {
+		t.Helper()
+		operation := models.FinanceTransaction{Date: time.Date(2030, 1, 10, 0, 0, 0, 0, time.UTC), Type: models.TransactionTypeExpense,
+			Amount: amount, BranchID: branchID, Source: source, Status: status, CounterpartyID: &supplierID}
+		if err := db.Create(&operation).Error; err != nil {
+			t.Fatalf("не удалось создать операцию: %v", err)
+		}
+		return operation.ID
+	}
+	pendingID := newOperation(models.TransactionSourceBank, models.TransactionStatusPending, 400)
+	otherPendingID := newOperation(models.TransactionSourceBank, models.TransactionStatusPending, 250)
+	cashID := newOperation(models.TransactionSourceCash, models.TransactionStatusPending, 300)
+	balances := func() (float64, float64) {
+		t.Helper()
+		var supplier models.Counterparty
+		if err := db.First(&supplier, "id = ?", supplierID).Error; err != nil {
+			t.Fatalf("не удалось прочитать поставщика: %v", err)
+		}
+		return supplier.BalanceOfficial, supplier.BalanceInternal
+	}
+
+	pending, err := service.GetBankOperations("pending", branchID)
+	if err != nil {
+		t.Fatalf("GetBankOperations: %v", err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("ожидающих банковских операций %d, want 2 (наличные не входят)", len(pending))
+	}
+
+	paidAt := time.Date(2030, 1, 12, 0, 0, 0, 0, time.UTC)
+	confirmed, err := service.ConfirmBankOperation(pendingID, paidAt, "бухгалтер")
+	if err != nil {
+		t.Fatalf("ConfirmBankOperation: %v", err)
+	}
+	if confirmed.Status != models.TransactionStatusCompleted || confirmed.PaidAt == nil || !confirmed.PaidAt.Equal(paidAt) {
+		t.Errorf("операция после подтверждения: статус %s, оплачена %v; want Completed, %v", confirmed.Status, confirmed.PaidAt, paidAt)
+	}
+	if official, internal := balances(); official != 1100 || internal != 300 {
+		t.Errorf("долг после оплаты %v (наличными %v), want 1100 (300)", official, internal)
+	}
+
+	// Повторное подтверждение и подтверждение наличной операции отклоняются, долг не меняется
+	for _, id := range []string{pendingID, cashID} {
+		if _, err := service.ConfirmBankOperation(id, paidAt, "бухгалтер"); !errors.Is(err, ErrBankOperationNotPending) {
+			t.Errorf("ConfirmBankOperation(%s): %v, want ErrBankOperationNotPending", id, err)
+		}
+	}
+	if official, _ := balances(); official != 1100 {
+		t.Errorf("долг после отклоненных подтверждений %v, want 1100", official)
+	}
+
+	pending, err = service.GetBankOperations("pending", branchID)
+	if err != nil {
+		t.Fatalf("GetBankOperations: %v", err)
+	}
+	if len(pending) != 1 || pending[0].ID != otherPendingID {
+		t.Errorf("ожидающие после оплаты %+v, want только %s", pending, otherPendingID)
+	}
+	paid, err := service.GetBankOperations("paid", branchID)
+	if err != nil || len(paid) != 1 || paid[0].ID != pendingID {
+		t.Errorf("оплаченные %+v (%v), want только %s", paid, err, pendingID)
+	}
+	if _, err := service.GetBankOperations("overdue", branchID); err == nil {
+		t.Error("неизвестный статус: want ошибку")
+	}
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"fmt"
+	"time"
 
 	"zephyrvpn/server/internal/models"
 
@@ -10,12 +11,17 @@ import (
 
 // BranchService управляет логикой филиалов
 type BranchService struct {
-	db *gorm.DB
+	db              *gorm.DB
+	defaultBranchID string                      // Филиал для запросов без branch_id (пусто - без подстановки)
+	cache           branchCache                 // Активные филиалы для проверки branch_id
+	loadBranches    func() ([]BranchRef, error) // Источник списка филиалов (в тестах подменяется)
 }
 
 // NewBranchService создает новый экземпляр BranchService
 func NewBranchService(db *gorm.DB) *BranchService {
-	return &BranchService{db: db}
+	s := &BranchService{db: db}
+	s.loadBranches = s.queryActiveBranches
+	return s
 }
 
 // GetAllBranches возвращает список всех филиалов
@@ -70,9 +76,16 @@ func (s *BranchService) CreateBranch(branch *models.Branch) error {
 		}
 	}
 
+	if branch.Timezone != "" {
+		if _, err := time.LoadLocation(branch.Timezone); err != nil {
+			return fmt.Errorf("неизвестный часовой пояс '%s': %w", branch.Timezone, err)
+		}
+	}
+
 	if err := s.db.Create(branch).Error; err != nil {
 		return fmt.Errorf("ошибка создания филиала: %w", err)
 	}
+	s.invalidateBranchCache()
 
 	return nil
 }
@@ -100,9 +113,16 @@ func (s *BranchService) UpdateBranch(id string, updatedBranch *models.Branch) er
 		}
 	}
 
+	if updatedBranch.Timezone != "" {
+		if _, err := time.LoadLocation(updatedBranch.Timezone); err != nil {
+			return fmt.Errorf("неизвестный часовой пояс '%s': %w", updatedBranch.Timezone, err)
+		}
+	}
+
 	if err := s.db.Model(&branch).Updates(updatedBranch).Error; err != nil {
 		return fmt.Errorf("ошибка обновления филиала: %w", err)
 	}
+	s.invalidateBranchCache()
 
 	return nil
 }
@@ -112,6 +132,7 @@ func (s *BranchService) DeleteBranch(id string) error {
 	if err := s.db.Delete(&models.Branch{}, "id = ?", id).Error; err != nil {
 		return fmt.Errorf("ошибка удаления филиала: %w", err)
 	}
+	s.invalidateBranchCache()
 	return nil
 }
 
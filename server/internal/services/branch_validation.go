@@ -0,0 +1,122 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+)
+
+// ErrUnknownBranch - branch_id не совпадает ни с одним активным филиалом
+var ErrUnknownBranch = errors.New("филиал не найден")
+
+// Список филиалов меняется редко: держим его в памяти, чтобы не ходить в БД на каждый заказ.
+// Изменения через BranchService сбрасывают кэш сразу, остальные (другой инстанс, правка в БД) видны через branchCacheTTL.
+// Неизвестный ID перечитывает список не чаще раза в branchCacheMissRefresh - филиал мог появиться только что
+const (
+	branchCacheTTL         = time.Minute
+	branchCacheMissRefresh = 5 * time.Second
+)
+
+// BranchRef - активный филиал в списке допустимых branch_id
+type BranchRef struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// branchCache - закэшированный набор активных филиалов
+type branchCache struct {
+	mu       sync.Mutex
+	branches []BranchRef
+	ids      map[string]bool
+	loadedAt time.Time
+}
+
+// SetDefaultBranchID задает филиал для запросов без branch_id (DEFAULT_BRANCH_ID, пусто - без подстановки)
+func (s *BranchService) SetDefaultBranchID(branchID string) {
+	s.defaultBranchID = strings.TrimSpace(branchID)
+}
+
+// DefaultBranchID возвращает филиал по умолчанию (пусто - не задан)
+func (s *BranchService) DefaultBranchID() string {
+	return s.defaultBranchID
+}
+
+// ActiveBranches возвращает активные филиалы (из кэша)
+func (s *BranchService) ActiveBranches() ([]BranchRef, error) {
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	if err := s.refreshBranchCache(branchCacheTTL); err != nil {
+		return nil, err
+	}
+	return append([]BranchRef(nil), s.cache.branches...), nil
+}
+
+// ResolveBranchID проверяет, что branchID - активный филиал. Пустой branchID заменяется филиалом по умолчанию;
+// если он не задан, возвращается пустая строка (решение за вызывающим). Неизвестный ID - ErrUnknownBranch
+func (s *BranchService) ResolveBranchID(branchID string) (string, error) {
+	branchID = strings.TrimSpace(branchID)
+	if branchID == "" {
+		if s.defaultBranchID == "" {
+			return "", nil
+		}
+		branchID = s.defaultBranchID
+	}
+
+	s.cache.mu.Lock()
+	defer s.cache.mu.Unlock()
+	if err := s.refreshBranchCache(branchCacheTTL); err != nil {
+		return "", err
+	}
+	if !s.cache.ids[branchID] {
+		if err := s.refreshBranchCache(branchCacheMissRefresh); err != nil {
+			return "", err
+		}
+	}
+	if !s.cache.ids[branchID] {
+		if branchID == s.defaultBranchID {
+			return "", fmt.Errorf("%w: %s (филиал по умолчанию, DEFAULT_BRANCH_ID)", ErrUnknownBranch, branchID)
+		}
+		return "", fmt.Errorf("%w: %s", ErrUnknownBranch, branchID)
+	}
+	return branchID, nil
+}
+
+// refreshBranchCache перечитывает филиалы, если кэш старше maxAge. Вызывается под s.cache.mu
+func (s *BranchService) refreshBranchCache(maxAge time.Duration) error {
+	if s.cache.ids != nil && time.Since(s.cache.loadedAt) < maxAge {
+		return nil
+	}
+	branches, err := s.loadBranches()
+	if err != nil {
+		return err
+	}
+	ids := make(map[string]bool, len(branches))
+	for _, branch := range branches {
+		ids[branch.ID] = true
+	}
+	s.cache.branches = branches
+	s.cache.ids = ids
+	s.cache.loadedAt = time.Now()
+	return nil
+}
+
+// invalidateBranchCache сбрасывает кэш после изменения филиалов
+func (s *BranchService) invalidateBranchCache() {
+	s.cache.mu.Lock()
+	s.cache.ids = nil
+	s.cache.mu.Unlock()
+}
+
+// queryActiveBranches читает активные филиалы из БД
+func (s *BranchService) queryActiveBranches() ([]BranchRef, error) {
+	branches := make([]BranchRef, 0)
+	if err := s.db.Model(&models.Branch{}).Select("id", "name").Where("is_active = ?", true).
+		Order("name").Find(&branches).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки филиалов: %w", err)
+	}
+	return branches, nil
+}
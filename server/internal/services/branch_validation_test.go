@@ -0,0 +1,105 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// newStubBranchService - BranchService со списком филиалов без БД; calls считает обращения к источнику
+func newStubBranchService(branches []BranchRef, calls *int) *BranchService {
+	s := NewBranchService(nil)
+	s.loadBranches = func() ([]BranchRef, error) {
+		*calls++
+		return branches, nil
+	}
+	return s
+}
+
+func TestResolveBranchID(t *testing.T) {
+	branches := []BranchRef{{ID: "branch-a", Name: "Центр"}, {ID: "branch-b", Name: "Север"}}
+
+	t.Run("существующий филиал", func(t *testing.T) {
+		calls := 0
+		service := newStubBranchService(branches, &calls)
+		for i := 0; i < 3; i++ {
+			got, err := service.ResolveBranchID(" branch-b ")
+			if err != nil || got != "branch-b" {
+				t.Fatalf("ResolveBranchID = %q, %v; want branch-b", got, err)
+			}
+		}
+		if calls != 1 {
+			t.Errorf("список филиалов загружен %d раз, want 1 (кэш)", calls)
+		}
+	})
+
+	t.Run("неизвестный филиал", func(t *testing.T) {
+		calls := 0
+		service := newStubBranchService(branches, &calls)
+		if _, err := service.ResolveBranchID("brnach-a"); !errors.Is(err, ErrUnknownBranch) {
+			t.Fatalf("ResolveBranchID(опечатка) err = %v, want ErrUnknownBranch", err)
+		}
+		valid, err := service.ActiveBranches()
+		if err != nil || len(valid) != 2 {
+			t.Fatalf("ActiveBranches = %+v, %v; want 2 филиала для ответа клиенту", valid, err)
+		}
+		if _, err := service.ResolveBranchID("brnach-a"); !errors.Is(err, ErrUnknownBranch) {
+			t.Fatalf("повторный ResolveBranchID err = %v, want ErrUnknownBranch", err)
+		}
+		if calls != 1 {
+			t.Errorf("список филиалов загружен %d раз, want 1 (промах не перечитывает свежий кэш)", calls)
+		}
+	})
+
+	t.Run("филиал по умолчанию", func(t *testing.T) {
+		calls := 0
+		service := newStubBranchService(branches, &calls)
+		if got, err := service.ResolveBranchID(""); err != nil || got != "" {
+			t.Fatalf("без филиала по умолчанию ResolveBranchID(\"\") = %q, %v; want пусто", got, err)
+		}
+
+		service.SetDefaultBranchID("branch-a")
+		if got, err := service.ResolveBranchID(""); err != nil || got != "branch-a" {
+			t.Fatalf("ResolveBranchID(\"\") = %q, %v; want branch-a", got, err)
+		}
+		if got, err := service.ResolveBranchID("branch-b"); err != nil || got != "branch-b" {
+			t.Errorf("явный branch_id = %q, %v; want branch-b, а не филиал по умолчанию", got, err)
+		}
+
+		service.SetDefaultBranchID("closed-branch")
+		if _, err := service.ResolveBranchID(""); !errors.Is(err, ErrUnknownBranch) {
+			t.Errorf("несуществующий филиал по умолчанию err = %v, want ErrUnknownBranch", err)
+		}
+	})
+
+	t.Run("изменение филиалов сбрасывает кэш", func(t *testing.T) {
+		calls := 0
+		service := newStubBranchService(branches, &calls)
+		if _, err := service.ResolveBranchID("branch-a"); err != nil {
+			t.Fatalf("ResolveBranchID: %v", err)
+		}
+		service.invalidateBranchCache()
+		if _, err := service.ResolveBranchID("branch-a"); err != nil {
+			t.Fatalf("ResolveBranchID: %v", err)
+		}
+		if calls != 2 {
+			t.Errorf("список филиалов загружен %d раз, want 2 (после сброса кэша)", calls)
+		}
+	})
+}
+
+func TestResolveBranchIDAgainstDatabase(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{})
+	branchID := newTestBranch(t, db)
+	service := NewBranchService(db)
+
+	if got, err := service.ResolveBranchID(branchID); err != nil || got != branchID {
+		t.Fatalf("ResolveBranchID(филиал из БД) = %q, %v; want %s", got, err, branchID)
+	}
+	if _, err := service.ResolveBranchID(uuid.New().String()); !errors.Is(err, ErrUnknownBranch) {
+		t.Errorf("ResolveBranchID(случайный UUID) err = %v, want ErrUnknownBranch", err)
+	}
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"zephyrvpn/server/internal/models"
+)
+
+// businessDateLayout - формат бизнес-даты (ключи плана на день, параметр date в API выручки)
+const businessDateLayout = "2006-01-02"
+
+// BranchLocation возвращает часовой пояс филиала (branches.timezone)
+// Если филиал не указан, не найден или пояс некорректен - UTC
+// Слоты по-прежнему считаются в UTC, пояс нужен только для границ бизнес-дня в отчетах
+func BranchLocation(db *gorm.DB, branchID string) *time.Location {
+	if db == nil || branchID == "" || branchID == "all" {
+		return time.UTC
+	}
+
+	var branch models.Branch
+	if err := db.Select("id", "timezone").Where("id = ?", branchID).First(&branch).Error; err != nil {
+		return time.UTC
+	}
+	if branch.Timezone == "" {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(branch.Timezone)
+	if err != nil {
+		log.Printf("⚠️ BranchLocation: некорректный часовой пояс '%s' у филиала %s, используем UTC", branch.Timezone, branchID)
+		return time.UTC
+	}
+	return loc
+}
+
+// BusinessDate возвращает бизнес-дату момента t в часовом поясе филиала
+// Заказ в 23:30 по Екатеринбургу (18:30 UTC) относится к этому же дню, а не к следующему
+func BusinessDate(t time.Time, loc *time.Location) string {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format(businessDateLayout)
+}
+
+// BusinessDayBounds возвращает границы бизнес-дня [start, end) в UTC для даты в часовом поясе филиала
+func BusinessDayBounds(date string, loc *time.Location) (time.Time, time.Time, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	day, err := time.ParseInLocation(businessDateLayout, date, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	// AddDate, а не +24h: в день перевода часов сутки короче или длиннее
+	return day.UTC(), day.AddDate(0, 0, 1).UTC(), nil
+}
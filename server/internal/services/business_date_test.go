@@ -0,0 +1,95 @@
+package services
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // Тест не зависит от zoneinfo системы
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%s): %v", name, err)
+	}
+	return loc
+}
+
+func TestBusinessDateUsesBranchTimezone(t *testing.T) {
+	yekaterinburg := mustLoadLocation(t, "Asia/Yekaterinburg") // UTC+5
+
+	cases := []struct {
+		name string
+		at   time.Time
+		loc  *time.Location
+		want string
+	}{
+		// 23:30 по Екатеринбургу = 18:30 UTC: тот же день филиала
+		{"23:30 местного", time.Date(2026, 3, 10, 18, 30, 0, 0, time.UTC), yekaterinburg, "2026-03-10"},
+		// 00:30 по Екатеринбургу = 19:30 UTC предыдущего дня: уже следующий день филиала
+		{"00:30 местного", time.Date(2026, 3, 10, 19, 30, 0, 0, time.UTC), yekaterinburg, "2026-03-11"},
+		{"без пояса - UTC", time.Date(2026, 3, 10, 23, 30, 0, 0, time.UTC), nil, "2026-03-10"},
+	}
+	for _, tc := range cases {
+		if got := BusinessDate(tc.at, tc.loc); got != tc.want {
+			t.Errorf("%s: BusinessDate = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestBusinessDayBounds(t *testing.T) {
+	yekaterinburg := mustLoadLocation(t, "Asia/Yekaterinburg")
+	start, end, err := BusinessDayBounds("2026-03-10", yekaterinburg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 3, 9, 19, 0, 0, 0, time.UTC); !start.Equal(want) {
+		t.Errorf("начало дня = %v, want %v", start, want)
+	}
+	if want := time.Date(2026, 3, 10, 19, 0, 0, 0, time.UTC); !end.Equal(want) {
+		t.Errorf("конец дня = %v, want %v", end, want)
+	}
+
+	// Момент 23:30 местного попадает в границы своего бизнес-дня
+	lateOrder := time.Date(2026, 3, 10, 18, 30, 0, 0, time.UTC)
+	if lateOrder.Before(start) || !lateOrder.Before(end) {
+		t.Errorf("заказ %v вне границ [%v, %v)", lateOrder, start, end)
+	}
+
+	if _, _, err := BusinessDayBounds("10.03.2026", yekaterinburg); err == nil {
+		t.Error("некорректная дата: ожидалась ошибка")
+	}
+}
+
+func TestBusinessDayBoundsAcrossDST(t *testing.T) {
+	// В поясах с переводом часов сутки длятся 23 или 25 часов
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	cases := []struct {
+		date string
+		want time.Duration
+	}{
+		{"2026-03-29", 23 * time.Hour}, // Переход на летнее время
+		{"2026-10-25", 25 * time.Hour}, // Переход на зимнее время
+		{"2026-06-15", 24 * time.Hour},
+	}
+	for _, tc := range cases {
+		start, end, err := BusinessDayBounds(tc.date, berlin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := end.Sub(start); got != tc.want {
+			t.Errorf("%s: длина дня %v, want %v", tc.date, got, tc.want)
+		}
+		if got := BusinessDate(end.Add(-time.Minute), berlin); got != tc.date {
+			t.Errorf("%s: последняя минута дня относится к %s", tc.date, got)
+		}
+	}
+}
+
+func TestBranchLocationFallsBackToUTC(t *testing.T) {
+	for _, branchID := range []string{"", "all", "branch-1"} {
+		if loc := BranchLocation(nil, branchID); loc != time.UTC {
+			t.Errorf("BranchLocation(nil, %q) = %v, want UTC", branchID, loc)
+		}
+	}
+}
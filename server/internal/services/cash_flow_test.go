@@ -0,0 +1,91 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+)
+
+func TestGetCashFlowRejectsInvalidPeriod(t *testing.T) {
+	service := NewFinanceService(nil)
+	from := time.Date(2030, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	if _, err := service.GetCashFlow("", from, from.AddDate(0, 0, -1), false); err == nil {
+		t.Error("период с окончанием раньше начала принят")
+	}
+	if _, err := service.GetCashFlow("", from, from.AddDate(0, 0, maxCashFlowDays), false); err == nil {
+		t.Errorf("период длиннее %d дней принят", maxCashFlowDays)
+	}
+}
+
+func TestIsCashPaymentMethod(t *testing.T) {
+	for method, want := range map[string]bool{"cash": true, " Cash ": true, "card": false, "online": false, "": false} {
+		if got := isCashPaymentMethod(method); got != want {
+			t.Errorf("isCashPaymentMethod(%q) = %v, want %v", method, got, want)
+		}
+	}
+}
+
+// Наличный и безналичный потоки считаются раздельно, дни без движения попадают в отчет,
+// остаток нарастающим итогом непрерывен; переводы, незавершенные транзакции и дни вне периода не учитываются
+func TestGetCashFlowSplitsCashAndBank(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.FinanceTransaction{})
+	if !db.Migrator().HasTable("orders") {
+		t.Skip("таблица orders не создана (migrations/013): тест пропущен")
+	}
+	branchID := newTestBranch(t, db)
+	t.Cleanup(func() {
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.FinanceTransaction{})
+	})
+
+	from := time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC)
+	create := func(day int, transactionType models.TransactionType, source models.TransactionSource, amount float64, status models.TransactionStatus) {
+		transaction := models.FinanceTransaction{
+			Date:     from.AddDate(0, 0, day).Add(12 * time.Hour),
+			Type:     transactionType,
+			Amount:   amount,
+			BranchID: branchID,
+			Source:   source,
+			Status:   status,
+		}
+		if err := db.Create(&transaction).Error; err != nil {
+			t.Fatalf("не удалось создать транзакцию: %v", err)
+		}
+	}
+	create(0, models.TransactionTypeIncome, models.TransactionSourceCash, 1000, models.TransactionStatusCompleted)
+	create(0, models.TransactionTypeExpense, models.TransactionSourceBank, 300, models.TransactionStatusCompleted)
+	create(2, models.TransactionTypeInvoice, models.TransactionSourceCash, 200, models.TransactionStatusCompleted)
+	create(2, models.TransactionTypeIncome, models.TransactionSourceBank, 50, models.TransactionStatusCompleted)
+	create(1, models.TransactionTypeTransfer, models.TransactionSourceCash, 500, models.TransactionStatusCompleted)
+	create(1, models.TransactionTypeExpense, models.TransactionSourceCash, 700, models.TransactionStatusPending)
+	create(3, models.TransactionTypeIncome, models.TransactionSourceCash, 9999, models.TransactionStatusCompleted)
+
+	service := NewFinanceService(db)
+	days, err := service.GetCashFlow(branchID, from, from.AddDate(0, 0, 2), false)
+	if err != nil {
+		t.Fatalf("GetCashFlow: %v", err)
+	}
+	want := []CashFlowDay{
+		{Date: "2030-02-01", CashIn: 1000, BankOut: 300, TotalIn: 1000, TotalOut: 300, Net: 700, Cumulative: 700},
+		{Date: "2030-02-02", Cumulative: 700},
+		{Date: "2030-02-03", BankIn: 50, CashOut: 200, TotalIn: 50, TotalOut: 200, Net: -150, Cumulative: 550},
+	}
+	if len(days) != len(want) {
+		t.Fatalf("дней в отчете %d, want %d: %+v", len(days), len(want), days)
+	}
+	for i := range want {
+		if days[i] != want[i] {
+			t.Errorf("день %d = %+v, want %+v", i, days[i], want[i])
+		}
+	}
+
+	// Только касса: безналичный поток обнуляется
+	cashDays, err := service.GetCashFlow(branchID, from, from.AddDate(0, 0, 2), true)
+	if err != nil {
+		t.Fatalf("GetCashFlow(cashOnly): %v", err)
+	}
+	if cashDays[0].Net != 1000 || cashDays[2].Net != -200 || cashDays[2].Cumulative != 800 {
+		t.Errorf("поток кассы: %+v, want net 1000, ..., -200 (итог 800)", cashDays)
+	}
+}
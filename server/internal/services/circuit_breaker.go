@@ -0,0 +1,98 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen возвращается, когда внешний сервис временно отключен автоматом защиты
+var ErrCircuitOpen = errors.New("внешний сервис временно недоступен (circuit breaker открыт)")
+
+// Состояния автомата защиты
+const (
+	CircuitClosed   = "closed"    // Запросы идут во внешний сервис
+	CircuitOpen     = "open"      // Запросы не отправляются до конца cool-down
+	CircuitHalfOpen = "half_open" // Cool-down истек, пропускаем пробный запрос
+)
+
+// CircuitBreaker - простой автомат защиты внешнего API
+// После failureThreshold ошибок подряд перестает пропускать запросы на время cooldown,
+// затем пропускает один пробный запрос: успех закрывает автомат, ошибка снова открывает
+type CircuitBreaker struct {
+	mu                  sync.Mutex
+	failureThreshold    int
+	cooldown            time.Duration
+	consecutiveFailures int
+	openedAt            time.Time
+	probeInFlight       bool
+	now                 func() time.Time
+}
+
+// NewCircuitBreaker создает автомат защиты
+func NewCircuitBreaker(failureThreshold int, cooldown time.Duration) *CircuitBreaker {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	return &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		now:              time.Now,
+	}
+}
+
+// Allow проверяет, можно ли отправить запрос во внешний сервис
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state() {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		// Пропускаем только один пробный запрос
+		if cb.probeInFlight {
+			return false
+		}
+		cb.probeInFlight = true
+	}
+	return true
+}
+
+// RecordSuccess фиксирует успешный запрос и закрывает автомат
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.consecutiveFailures = 0
+	cb.openedAt = time.Time{}
+	cb.probeInFlight = false
+}
+
+// RecordFailure фиксирует ошибку; после failureThreshold ошибок подряд автомат открывается
+func (cb *CircuitBreaker) RecordFailure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.consecutiveFailures++
+	cb.probeInFlight = false
+	if cb.consecutiveFailures >= cb.failureThreshold {
+		cb.openedAt = cb.now()
+	}
+}
+
+// State возвращает текущее состояние автомата (closed, open, half_open)
+func (cb *CircuitBreaker) State() string {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state()
+}
+
+// state вычисляет состояние (вызывается под mu)
+func (cb *CircuitBreaker) state() string {
+	if cb.openedAt.IsZero() {
+		return CircuitClosed
+	}
+	if cb.now().Sub(cb.openedAt) < cb.cooldown {
+		return CircuitOpen
+	}
+	return CircuitHalfOpen
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock - источник текущего времени для сервисов, чья логика зависит от момента вызова (рабочие часы, границы слотов)
+// В продакшене используется RealClock, в тестах - MockClock с замороженным временем
+type Clock interface {
+	Now() time.Time
+}
+
+// RealClock - системное время
+type RealClock struct{}
+
+// Now возвращает текущее системное время
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+// MockClock - управляемое время для тестов: не идет само, меняется только через Set/Advance
+type MockClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewMockClock создает часы, остановленные на now
+func NewMockClock(now time.Time) *MockClock {
+	return &MockClock{now: now}
+}
+
+// Now возвращает замороженное время
+func (c *MockClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set переводит часы на now
+func (c *MockClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Advance сдвигает часы на d
+func (c *MockClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
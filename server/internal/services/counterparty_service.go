@@ -3,6 +3,7 @@ package services
 import (
 	"fmt"
 	"log"
+	"strings"
 
 	"zephyrvpn/server/internal/models"
 
@@ -28,6 +29,58 @@ func (s *CounterpartyService) GetAllCounterparties() ([]models.Counterparty, err
 	return counterparties, nil
 }
 
+// DefaultCounterpartyPageLimit - размер страницы списка контрагентов, если limit не указан
+const DefaultCounterpartyPageLimit = 100
+
+// MaxCounterpartyPageLimit - максимальный размер страницы списка контрагентов
+const MaxCounterpartyPageLimit = 1000
+
+// CounterpartyFilter - фильтры и пагинация списка активных контрагентов
+type CounterpartyFilter struct {
+	Search  string // Часть названия (в том числе полного юридического) или ИНН, без учета регистра
+	HasDebt *bool  // true - только с ненулевым балансом (официальным или внутренним), false - только без долга, nil - все
+	Limit   int    // 0 = DefaultCounterpartyPageLimit
+	Offset  int
+}
+
+// GetCounterparties возвращает страницу активных контрагентов по фильтру и общее количество по фильтру
+// Сортировка по названию (и id при совпадении) - стабильна между страницами
+func (s *CounterpartyService) GetCounterparties(filter CounterpartyFilter) ([]models.Counterparty, int64, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultCounterpartyPageLimit
+	}
+	if filter.Limit > MaxCounterpartyPageLimit {
+		filter.Limit = MaxCounterpartyPageLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	query := s.db.Model(&models.Counterparty{}).Where("status = ?", models.CounterpartyStatusActive)
+	if search := strings.TrimSpace(filter.Search); search != "" {
+		pattern := "%" + search + "%"
+		query = query.Where("(name ILIKE ? OR full_legal_name ILIKE ? OR inn LIKE ?)", pattern, pattern, pattern)
+	}
+	if filter.HasDebt != nil {
+		if *filter.HasDebt {
+			query = query.Where("(COALESCE(balance_official, 0) <> 0 OR COALESCE(balance_internal, 0) <> 0)")
+		} else {
+			query = query.Where("COALESCE(balance_official, 0) = 0 AND COALESCE(balance_internal, 0) = 0")
+		}
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("ошибка подсчета контрагентов: %w", err)
+	}
+
+	counterparties := make([]models.Counterparty, 0)
+	if err := query.Order("name ASC, id ASC").Limit(filter.Limit).Offset(filter.Offset).Find(&counterparties).Error; err != nil {
+		return nil, 0, fmt.Errorf("ошибка получения контрагентов: %w", err)
+	}
+	return counterparties, total, nil
+}
+
 // GetCounterpartyByID получает контрагента по ID
 func (s *CounterpartyService) GetCounterpartyByID(id string) (*models.Counterparty, error) {
 	var counterparty models.Counterparty
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+)
+
+// Три поставщика с общей частью ИНН: поиск по ней находит всех, has_debt оставляет только тех,
+// у кого ненулевой официальный или внутренний баланс
+func TestGetCounterpartiesSearchByINNAndDebt(t *testing.T) {
+	db := newTestDB(t, &models.Counterparty{})
+	service := NewCounterpartyService(db)
+
+	prefix := fmt.Sprintf("%08d", time.Now().UnixNano()%1e8)
+	counterparties := []models.Counterparty{
+		{Name: "Молочный двор", INN: prefix + "01", BalanceOfficial: 1500},
+		{Name: "Овощебаза", INN: prefix + "02", BalanceInternal: -200},
+		{Name: "Мука и соль", INN: prefix + "03"},
+	}
+	ids := make([]string, 0, len(counterparties))
+	for i := range counterparties {
+		if err := db.Create(&counterparties[i]).Error; err != nil {
+			t.Fatalf("не удалось создать контрагента: %v", err)
+		}
+		ids = append(ids, counterparties[i].ID)
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("id IN ?", ids).Delete(&models.Counterparty{})
+	})
+
+	found, total, err := service.GetCounterparties(CounterpartyFilter{Search: prefix[2:]})
+	if err != nil {
+		t.Fatalf("GetCounterparties: %v", err)
+	}
+	if total != 3 || len(found) != 3 {
+		t.Errorf("поиск по части ИНН: %d из %d, want 3 из 3", len(found), total)
+	}
+
+	hasDebt := true
+	found, total, err = service.GetCounterparties(CounterpartyFilter{Search: prefix, HasDebt: &hasDebt})
+	if err != nil {
+		t.Fatalf("GetCounterparties: %v", err)
+	}
+	if total != 2 || len(found) != 2 {
+		t.Fatalf("с долгом: %d из %d, want 2 из 2", len(found), total)
+	}
+	for _, counterparty := range found {
+		if counterparty.BalanceOfficial == 0 && counterparty.BalanceInternal == 0 {
+			t.Errorf("контрагент %s без баланса попал в has_debt", counterparty.Name)
+		}
+	}
+
+	// Страница из одного элемента, total - по всему фильтру
+	page, total, err := service.GetCounterparties(CounterpartyFilter{Search: prefix, Limit: 1, Offset: 1})
+	if err != nil {
+		t.Fatalf("GetCounterparties: %v", err)
+	}
+	if total != 3 || len(page) != 1 || page[0].Name != "Мука и соль" {
+		t.Errorf("вторая страница = %+v (total %d), want [Мука и соль] из 3", page, total)
+	}
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"zephyrvpn/server/internal/models"
+)
+
+// ExchangeRateSource - источник курсов валют к рублю
+// Сейчас используется ручная таблица exchange_rates, позже можно подключить API ЦБ РФ
+type ExchangeRateSource interface {
+	// GetRate возвращает курс валюты к рублю, действующий на дату
+	GetRate(currency string, date time.Time) (decimal.Decimal, error)
+	// Name возвращает имя источника (пишется в exchange_rates.source)
+	Name() string
+}
+
+// ManualRateSource берет курсы из таблицы exchange_rates
+// Используется последний курс, установленный на дату или раньше
+type ManualRateSource struct {
+	db *gorm.DB
+}
+
+// NewManualRateSource создает источник курсов из ручной таблицы
+func NewManualRateSource(db *gorm.DB) *ManualRateSource {
+	return &ManualRateSource{db: db}
+}
+
+// GetRate возвращает последний известный курс валюты на дату
+func (m *ManualRateSource) GetRate(currency string, date time.Time) (decimal.Decimal, error) {
+	var rate models.ExchangeRate
+	err := m.db.
+		Where("currency = ? AND date <= ?", currency, date.Format("2006-01-02")).
+		Order("date DESC").
+		First(&rate).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return decimal.Zero, fmt.Errorf("курс %s на %s не задан", currency, date.Format("2006-01-02"))
+		}
+		return decimal.Zero, fmt.Errorf("ошибка получения курса %s: %w", currency, err)
+	}
+	return decimal.NewFromFloat(rate.Rate), nil
+}
+
+// Name возвращает имя источника
+func (m *ManualRateSource) Name() string {
+	return "manual"
+}
+
+// CurrencyService конвертирует суммы в рубли по курсу на дату
+type CurrencyService struct {
+	db     *gorm.DB
+	source ExchangeRateSource
+}
+
+// NewCurrencyService создает новый экземпляр CurrencyService (источник курсов - ручная таблица)
+func NewCurrencyService(db *gorm.DB) *CurrencyService {
+	return &CurrencyService{
+		db:     db,
+		source: NewManualRateSource(db),
+	}
+}
+
+// SetRateSource подменяет источник курсов (например, на API ЦБ РФ)
+func (s *CurrencyService) SetRateSource(source ExchangeRateSource) {
+	s.source = source
+}
+
+// NormalizeCurrency приводит код валюты к ISO 4217 (верхний регистр), пустой код - рубли
+func NormalizeCurrency(currency string) string {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return models.BaseCurrency
+	}
+	return currency
+}
+
+// GetRate возвращает курс валюты к рублю на дату (для рубля всегда 1)
+func (s *CurrencyService) GetRate(currency string, date time.Time) (decimal.Decimal, error) {
+	currency = NormalizeCurrency(currency)
+	if currency == models.BaseCurrency {
+		return decimal.NewFromInt(1), nil
+	}
+
+	rate, err := s.source.GetRate(currency, date)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if rate.LessThanOrEqual(decimal.Zero) {
+		return decimal.Zero, fmt.Errorf("некорректный курс %s: %s", currency, rate.String())
+	}
+	return rate, nil
+}
+
+// ConvertToRUB пересчитывает сумму в рубли по курсу на дату
+// Возвращает сумму в рублях и примененный курс
+func (s *CurrencyService) ConvertToRUB(amount decimal.Decimal, currency string, date time.Time) (decimal.Decimal, decimal.Decimal, error) {
+	rate, err := s.GetRate(currency, date)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+	return amount.Mul(rate), rate, nil
+}
+
+// GetExchangeRates возвращает действующие на дату курсы по всем валютам
+func (s *CurrencyService) GetExchangeRates(date time.Time) ([]models.ExchangeRate, error) {
+	var rates []models.ExchangeRate
+	err := s.db.
+		Raw(`SELECT DISTINCT ON (currency) *
+			FROM exchange_rates
+			WHERE date <= ?
+			ORDER BY currency, date DESC`, date.Format("2006-01-02")).
+		Scan(&rates).Error
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения курсов валют: %w", err)
+	}
+	return rates, nil
+}
+
+// SetExchangeRate сохраняет курс валюты на дату в ручную таблицу (повторный вызов обновляет курс)
+func (s *CurrencyService) SetExchangeRate(currency string, rate float64, date time.Time) (*models.ExchangeRate, error) {
+	currency = NormalizeCurrency(currency)
+	if len(currency) != 3 {
+		return nil, fmt.Errorf("код валюты должен быть в формате ISO 4217 (3 буквы), получено: %s", currency)
+	}
+	if currency == models.BaseCurrency {
+		return nil, fmt.Errorf("курс рубля к рублю задавать не нужно")
+	}
+	if rate <= 0 {
+		return nil, fmt.Errorf("курс должен быть > 0")
+	}
+
+	exchangeRate := &models.ExchangeRate{
+		Currency: currency,
+		Date:     time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC),
+		Rate:     rate,
+		Source:   "manual",
+	}
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "currency"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "source", "updated_at"}),
+	}).Create(exchangeRate).Error
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сохранения курса: %w", err)
+	}
+
+	log.Printf("✅ Курс %s на %s: %.4f₽", currency, exchangeRate.Date.Format("2006-01-02"), rate)
+	return exchangeRate, nil
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// fixedRateSource - источник курсов с фиксированными значениями
+type fixedRateSource map[string]decimal.Decimal
+
+func (f fixedRateSource) GetRate(currency string, date time.Time) (decimal.Decimal, error) {
+	rate, ok := f[currency]
+	if !ok {
+		return decimal.Zero, fmt.Errorf("курс %s на %s не задан", currency, date.Format("2006-01-02"))
+	}
+	return rate, nil
+}
+
+func (f fixedRateSource) Name() string {
+	return "fixed"
+}
+
+func TestCurrencyServiceConvertToRUB(t *testing.T) {
+	service := NewCurrencyService(nil)
+	service.SetRateSource(fixedRateSource{
+		"EUR": decimal.RequireFromString("98.5"),
+		"CNY": decimal.Zero,
+	})
+	date := time.Date(2030, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		currency string
+		amount   string
+		want     string
+		wantRate string
+		wantErr  bool
+	}{
+		{currency: "", amount: "120.50", want: "120.5", wantRate: "1"},
+		{currency: "rub", amount: "10", want: "10", wantRate: "1"},
+		{currency: " eur ", amount: "12.34", want: "1215.49", wantRate: "98.5"},
+		{currency: "USD", amount: "1", wantErr: true}, // Курс не задан
+		{currency: "CNY", amount: "1", wantErr: true}, // Нулевой курс
+	}
+	for _, tt := range tests {
+		got, rate, err := service.ConvertToRUB(decimal.RequireFromString(tt.amount), tt.currency, date)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ConvertToRUB(%s %s): ожидалась ошибка, получено %s", tt.amount, tt.currency, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ConvertToRUB(%s %s): %v", tt.amount, tt.currency, err)
+			continue
+		}
+		if !got.Equal(decimal.RequireFromString(tt.want)) || !rate.Equal(decimal.RequireFromString(tt.wantRate)) {
+			t.Errorf("ConvertToRUB(%s %s) = %s по курсу %s, want %s по курсу %s", tt.amount, tt.currency, got, rate, tt.want, tt.wantRate)
+		}
+	}
+}
+
+func TestSetExchangeRateRejectsInvalidInput(t *testing.T) {
+	service := NewCurrencyService(nil)
+	date := time.Date(2030, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		currency string
+		rate     float64
+	}{
+		{"EURO", 98.5}, // Не ISO 4217
+		{"RUB", 1},     // Курс рубля к рублю
+		{"EUR", 0},
+		{"EUR", -1},
+	} {
+		if _, err := service.SetExchangeRate(tc.currency, tc.rate, date); err == nil {
+			t.Errorf("SetExchangeRate(%s, %v): ожидалась ошибка", tc.currency, tc.rate)
+		}
+	}
+}
+
+// Накладная поставщика в евро проводится в рублях по курсу на дату накладной:
+// last_price, долг поставщику и финансовая транзакция - в рублях, исходная сумма и курс сохраняются
+func TestProcessInboundInvoiceConvertsForeignCurrency(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.NomenclatureItem{}, &models.Counterparty{},
+		&models.Invoice{}, &models.StockBatch{}, &models.StockMovement{}, &models.PriceHistory{}, &models.FinanceTransaction{})
+
+	currencyService := NewCurrencyService(db)
+	currencyService.SetRateSource(fixedRateSource{"EUR": decimal.NewFromInt(100)})
+	service := NewStockService(db)
+	service.SetCounterpartyService(NewCounterpartyService(db))
+	service.SetFinanceService(NewFinanceService(db))
+	service.SetCurrencyService(currencyService)
+
+	branchID := newTestBranch(t, db)
+	counterpartyID := newTestCounterparty(t, db)
+	if err := db.Model(&models.Counterparty{}).Where("id = ?", counterpartyID).Update("currency", "EUR").Error; err != nil {
+		t.Fatalf("не удалось задать валюту поставщика: %v", err)
+	}
+	item := models.NomenclatureItem{
+		SKU:              "TEST-" + uuid.New().String()[:8],
+		Name:             "Пармезан",
+		BaseUnit:         "g",
+		InboundUnit:      "kg",
+		ConversionFactor: 1000,
+		IsActive:         true,
+	}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	invoice := models.Invoice{
+		Number:         "TEST-INV-" + uuid.New().String()[:8],
+		CounterpartyID: &counterpartyID,
+		TotalAmount:    50,
+		Status:         models.InvoiceStatusDraft,
+		BranchID:       branchID,
+	}
+	if err := db.Create(&invoice).Error; err != nil {
+		t.Fatalf("не удалось создать черновик накладной: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.FinanceTransaction{})
+		db.Where("nomenclature_id = ?", item.ID).Delete(&models.PriceHistory{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.Invoice{})
+		db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+	})
+
+	// 10 кг по 5 EUR = 50 EUR = 5000 ₽
+	items := []map[string]interface{}{{
+		"nomenclature_id": item.ID,
+		"branch_id":       branchID,
+		"quantity":        10.0,
+		"unit":            "kg",
+		"price_per_unit":  5.0,
+	}}
+	if _, err := service.ProcessInboundInvoiceBatch(invoice.ID, items, "test", counterpartyID, 50, false, "2030-01-18"); err != nil {
+		t.Fatalf("ProcessInboundInvoiceBatch: %v", err)
+	}
+	assertInvoiceState(t, db, invoice.ID, branchID, counterpartyID, item.ID, inboundState{
+		status: models.InvoiceStatusCompleted, batches: 1, movements: 1, priceHistory: 1, transactions: 1,
+		balance: 5000, lastPrice: 500,
+	})
+
+	var posted models.Invoice
+	if err := db.First(&posted, "id = ?", invoice.ID).Error; err != nil {
+		t.Fatalf("накладная не найдена: %v", err)
+	}
+	if posted.Currency != "EUR" || posted.TotalAmount != 5000 || posted.OriginalTotalAmount != 50 || posted.ExchangeRate != 100 {
+		t.Errorf("накладная: %s, сумма %.2f ₽, исходная %.2f, курс %.2f; want EUR, 5000, 50, 100",
+			posted.Currency, posted.TotalAmount, posted.OriginalTotalAmount, posted.ExchangeRate)
+	}
+
+	var transaction models.FinanceTransaction
+	if err := db.First(&transaction, "invoice_id = ?", invoice.ID).Error; err != nil {
+		t.Fatalf("финансовая транзакция не найдена: %v", err)
+	}
+	if transaction.Amount != 5000 || transaction.Currency != "EUR" || transaction.OriginalAmount != 50 {
+		t.Errorf("транзакция: %.2f ₽ (%s %.2f), want 5000 ₽ (EUR 50)", transaction.Amount, transaction.Currency, transaction.OriginalAmount)
+	}
+}
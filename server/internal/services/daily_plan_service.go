@@ -1,16 +1,21 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"zephyrvpn/server/internal/models"
 	"zephyrvpn/server/internal/utils"
 )
 
 // DailyPlanService управляет планом на день
 type DailyPlanService struct {
 	redisUtil *utils.RedisClient
+	db        *gorm.DB // Часовой пояс филиала и планы по дням недели (может быть nil - тогда UTC и план 0)
 }
 
 // NewDailyPlanService создает новый сервис плана на день
@@ -20,47 +25,60 @@ func NewDailyPlanService(redisUtil *utils.RedisClient) *DailyPlanService {
 	}
 }
 
+// SetDB подключает PostgreSQL для часового пояса филиала и планов по дням недели
+func (dps *DailyPlanService) SetDB(db *gorm.DB) {
+	dps.db = db
+}
+
 // GetDailyPlan получает план на день
-// date - дата в формате "2006-01-02", если пустая - сегодня
+// date - дата в формате "2006-01-02", если пустая - сегодня (UTC)
 func (dps *DailyPlanService) GetDailyPlan(date string) (float64, error) {
-	if dps.redisUtil == nil {
-		return 0, fmt.Errorf("Redis not available")
-	}
+	return dps.GetDailyPlanForBranch("", date)
+}
 
-	// Если дата не указана, используем сегодня
+// GetDailyPlanForBranch получает план на день; пустая дата - сегодня в часовом поясе филиала
+// Если на дату план не задан, возвращается план по умолчанию для дня недели (0, если не настроен)
+func (dps *DailyPlanService) GetDailyPlanForBranch(branchID, date string) (float64, error) {
+	// Если дата не указана, используем сегодня (бизнес-день филиала)
 	if date == "" {
-		date = time.Now().Format("2006-01-02")
+		date = BusinessDate(time.Now(), BranchLocation(dps.db, branchID))
 	}
 
-	planKey := fmt.Sprintf("erp:daily_plan:%s", date)
-	planStr, err := dps.redisUtil.Get(planKey)
-	if err != nil || planStr == "" {
-		// Если плана нет, возвращаем значение по умолчанию
-		return 500000.0, nil
+	if dps.redisUtil != nil {
+		planKey := fmt.Sprintf("erp:daily_plan:%s", date)
+		if planStr, err := dps.redisUtil.Get(planKey); err == nil && planStr != "" {
+			var plan float64
+			_, scanErr := fmt.Sscanf(planStr, "%f", &plan)
+			if scanErr == nil {
+				return plan, nil
+			}
+			log.Printf("⚠️ GetDailyPlan: ошибка парсинга плана для %s: %v", date, scanErr)
+		}
 	}
 
-	// Парсим значение плана
-	var plan float64
-	_, err = fmt.Sscanf(planStr, "%f", &plan)
+	day, err := time.Parse("2006-01-02", date)
 	if err != nil {
-		log.Printf("⚠️ GetDailyPlan: ошибка парсинга плана для %s: %v", date, err)
-		return 500000.0, nil
+		return 0, fmt.Errorf("неверный формат даты '%s', ожидается YYYY-MM-DD", date)
 	}
-
-	return plan, nil
+	return dps.GetWeekdayPlan(day.Weekday())
 }
 
 // SetDailyPlan устанавливает план на день
-// date - дата в формате "2006-01-02", если пустая - сегодня
+// date - дата в формате "2006-01-02", если пустая - сегодня (UTC)
 // plan - план в рублях
 func (dps *DailyPlanService) SetDailyPlan(date string, plan float64) error {
+	return dps.SetDailyPlanForBranch("", date, plan)
+}
+
+// SetDailyPlanForBranch устанавливает план на день; пустая дата - сегодня в часовом поясе филиала
+func (dps *DailyPlanService) SetDailyPlanForBranch(branchID, date string, plan float64) error {
 	if dps.redisUtil == nil {
-		return fmt.Errorf("Redis not available")
+		return ErrRedisUnavailable
 	}
 
-	// Если дата не указана, используем сегодня
+	// Если дата не указана, используем сегодня (бизнес-день филиала)
 	if date == "" {
-		date = time.Now().Format("2006-01-02")
+		date = BusinessDate(time.Now(), BranchLocation(dps.db, branchID))
 	}
 
 	planKey := fmt.Sprintf("erp:daily_plan:%s", date)
@@ -81,3 +99,75 @@ func (dps *DailyPlanService) GetDailyPlanForToday() (float64, error) {
 	return dps.GetDailyPlan("")
 }
 
+// GetDailyPlanForBranchToday получает план на текущий бизнес-день филиала
+func (dps *DailyPlanService) GetDailyPlanForBranchToday(branchID string) (float64, error) {
+	return dps.GetDailyPlanForBranch(branchID, "")
+}
+
+
+// GetWeekdayPlan возвращает план по умолчанию для дня недели (0, если не настроен или PostgreSQL недоступен)
+func (dps *DailyPlanService) GetWeekdayPlan(weekday time.Weekday) (float64, error) {
+	if dps.db == nil {
+		return 0, nil
+	}
+
+	var plan models.WeekdayPlan
+	err := dps.db.Where("weekday = ?", int(weekday)).First(&plan).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения плана для дня недели: %w", err)
+	}
+	return plan.Plan, nil
+}
+
+// GetWeekdayPlans возвращает планы по умолчанию для всех 7 дней недели (с воскресенья, ненастроенные - 0)
+func (dps *DailyPlanService) GetWeekdayPlans() ([]models.WeekdayPlan, error) {
+	if dps.db == nil {
+		return nil, fmt.Errorf("PostgreSQL недоступен")
+	}
+
+	var stored []models.WeekdayPlan
+	if err := dps.db.Find(&stored).Error; err != nil {
+		return nil, fmt.Errorf("ошибка получения планов по дням недели: %w", err)
+	}
+
+	plans := make([]models.WeekdayPlan, 7)
+	for i := range plans {
+		plans[i].Weekday = i
+	}
+	for _, plan := range stored {
+		if plan.Weekday >= 0 && plan.Weekday < len(plans) {
+			plans[plan.Weekday] = plan
+		}
+	}
+	return plans, nil
+}
+
+// SetWeekdayPlans сохраняет планы по умолчанию для переданных дней недели (остальные не меняются)
+func (dps *DailyPlanService) SetWeekdayPlans(plans []models.WeekdayPlan) error {
+	if dps.db == nil {
+		return fmt.Errorf("PostgreSQL недоступен")
+	}
+
+	for _, plan := range plans {
+		if plan.Weekday < 0 || plan.Weekday > 6 {
+			return fmt.Errorf("неверный день недели %d, допустимо 0 (воскресенье) - 6 (суббота)", plan.Weekday)
+		}
+		if plan.Plan < 0 {
+			return fmt.Errorf("план для дня недели %d не может быть отрицательным", plan.Weekday)
+		}
+	}
+
+	err := dps.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "weekday"}},
+		DoUpdates: clause.AssignmentColumns([]string{"plan", "updated_at"}),
+	}).Create(&plans).Error
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения планов по дням недели: %w", err)
+	}
+
+	log.Printf("✅ SetWeekdayPlans: обновлено дней недели: %d", len(plans))
+	return nil
+}
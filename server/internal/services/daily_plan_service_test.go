@@ -0,0 +1,79 @@
+package services
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// newTestDailyPlanService создает DailyPlanService без Redis на PostgreSQL из TEST_DATABASE_URL
+// Таблица weekday_plans создается и очищается в транзакции, которая откатывается после теста
+func newTestDailyPlanService(t *testing.T) *DailyPlanService {
+	t.Helper()
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL не задан: интеграционный тест плана на день пропущен")
+	}
+	db, err := gorm.Open(postgres.Open(databaseURL), &gorm.Config{})
+	if err != nil {
+		t.Skipf("PostgreSQL из TEST_DATABASE_URL недоступен: %v", err)
+	}
+	tx := db.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+	if err := tx.AutoMigrate(&models.WeekdayPlan{}); err != nil {
+		t.Fatalf("не удалось создать weekday_plans: %v", err)
+	}
+	if err := tx.Exec("DELETE FROM weekday_plans").Error; err != nil {
+		t.Fatalf("не удалось очистить weekday_plans: %v", err)
+	}
+
+	dps := NewDailyPlanService(nil)
+	dps.SetDB(tx)
+	return dps
+}
+
+func TestDailyPlanFallsBackToWeekdayDefault(t *testing.T) {
+	dps := newTestDailyPlanService(t)
+
+	err := dps.SetWeekdayPlans([]models.WeekdayPlan{
+		{Weekday: int(time.Monday), Plan: 300000},
+		{Weekday: int(time.Friday), Plan: 750000},
+	})
+	if err != nil {
+		t.Fatalf("SetWeekdayPlans: %v", err)
+	}
+
+	// 2030-01-18 - пятница, явного плана на дату нет
+	plan, err := dps.GetDailyPlanForBranch("", "2030-01-18")
+	if err != nil {
+		t.Fatalf("GetDailyPlanForBranch: %v", err)
+	}
+	if plan != 750000 {
+		t.Errorf("план на пятницу = %.2f, want 750000 (план по умолчанию для пятницы)", plan)
+	}
+
+	// 2030-01-19 - суббота, план для дня недели не настроен
+	plan, err = dps.GetDailyPlanForBranch("", "2030-01-19")
+	if err != nil {
+		t.Fatalf("GetDailyPlanForBranch: %v", err)
+	}
+	if plan != 0 {
+		t.Errorf("план на субботу = %.2f, want 0 (план не настроен)", plan)
+	}
+}
+
+func TestSetWeekdayPlansRejectsInvalidWeekday(t *testing.T) {
+	dps := newTestDailyPlanService(t)
+
+	if err := dps.SetWeekdayPlans([]models.WeekdayPlan{{Weekday: 7, Plan: 100}}); err == nil {
+		t.Error("SetWeekdayPlans(weekday=7): ожидалась ошибка")
+	}
+	if err := dps.SetWeekdayPlans([]models.WeekdayPlan{{Weekday: 1, Plan: -1}}); err == nil {
+		t.Error("SetWeekdayPlans(plan=-1): ожидалась ошибка")
+	}
+}
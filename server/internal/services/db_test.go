@@ -0,0 +1,112 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils"
+	"zephyrvpn/server/internal/utils/redistest"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// newTestDB подключается к PostgreSQL из TEST_DATABASE_URL и создает таблицы моделей
+// Сервисы сами открывают транзакции, поэтому тест работает с базой напрямую и убирает свои данные в t.Cleanup -
+// указывайте отдельную тестовую базу. Без TEST_DATABASE_URL тест пропускается
+func newTestDB(t testing.TB, tables ...interface{}) *gorm.DB {
+	t.Helper()
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL не задан: интеграционный тест PostgreSQL пропущен")
+	}
+	db, err := gorm.Open(postgres.Open(databaseURL), &gorm.Config{})
+	if err != nil {
+		t.Skipf("PostgreSQL из TEST_DATABASE_URL недоступен: %v", err)
+	}
+	if len(tables) > 0 {
+		if err := db.AutoMigrate(tables...); err != nil {
+			t.Fatalf("не удалось создать тестовые таблицы: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// newTestRedis - тестовый Redis из TEST_REDIS_URL (см. redistest.New); без TEST_REDIS_URL тест пропускается
+func newTestRedis(t *testing.T) *utils.RedisClient {
+	return redistest.New(t)
+}
+
+// newTestBranch создает филиал (и его юрлицо) для таблиц с внешним ключом на branches
+// Таблицы LegalEntity и Branch должны быть переданы в newTestDB. Удаляется после очистки данных теста
+func newTestBranch(t *testing.T, db *gorm.DB) string {
+	t.Helper()
+	legalEntity := models.LegalEntity{
+		Name: "Тестовое ИП " + uuid.New().String()[:8],
+		INN:  fmt.Sprintf("%012d", time.Now().UnixNano()%1e12),
+	}
+	if err := db.Create(&legalEntity).Error; err != nil {
+		t.Fatalf("не удалось создать юрлицо: %v", err)
+	}
+	branch := models.Branch{Name: "Тестовый филиал", LegalEntityID: &legalEntity.ID}
+	if err := db.Create(&branch).Error; err != nil {
+		t.Fatalf("не удалось создать филиал: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("id = ?", branch.ID).Delete(&models.Branch{})
+		db.Unscoped().Where("id = ?", legalEntity.ID).Delete(&models.LegalEntity{})
+	})
+	return branch.ID
+}
+
+// newTestCounterparty создает поставщика; таблица Counterparty должна быть передана в newTestDB
+func newTestCounterparty(t *testing.T, db *gorm.DB) string {
+	t.Helper()
+	counterparty := models.Counterparty{
+		Name: "Тестовый поставщик",
+		INN:  "TEST-" + uuid.New().String()[:8],
+	}
+	if err := db.Create(&counterparty).Error; err != nil {
+		t.Fatalf("не удалось создать поставщика: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("id = ?", counterparty.ID).Delete(&models.Counterparty{})
+	})
+	return counterparty.ID
+}
+
+// failWrites заставляет PostgreSQL отклонять запись в таблицу: триггер BEFORE event (INSERT, UPDATE, DELETE)
+// поднимает исключение для строк, подходящих под condition (выражение над NEW/OLD, например "NEW.branch_id = '...'").
+// Так проверяется откат транзакции сервиса на середине. Возвращает функцию, снимающую сбой; в t.Cleanup снимается сам
+func failWrites(t *testing.T, db *gorm.DB, table, event, condition string) func() {
+	t.Helper()
+	name := "test_fail_" + uuid.New().String()[:8]
+	statements := []string{
+		fmt.Sprintf(`CREATE FUNCTION %s() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'тестовый сбой записи в %%', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql`, name),
+		fmt.Sprintf("CREATE TRIGGER %s BEFORE %s ON %s FOR EACH ROW WHEN (%s) EXECUTE FUNCTION %s()", name, event, table, condition, name),
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("не удалось создать триггер сбоя на %s: %v", table, err)
+		}
+	}
+	restore := func() {
+		db.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s", name, table))
+		db.Exec(fmt.Sprintf("DROP FUNCTION IF EXISTS %s()", name))
+	}
+	t.Cleanup(restore)
+	return restore
+}
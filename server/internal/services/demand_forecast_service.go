@@ -60,7 +60,13 @@ func (s *DemandForecastService) GetForecast(branchID string, nomenclatureID stri
 		return nil, fmt.Errorf("ошибка расчета прогноза: %w", err)
 	}
 	
-	// 3. Сохраняем прогноз
+	// 3. Сохраняем прогноз (по сохраненным прогнозам считается точность, см. GetForecastAccuracy)
+	// Прогноз строится по истории закупок, поэтому хранится в единице закупки товара
+	unit := "kg"
+	var item models.NomenclatureItem
+	if err := s.db.Select("inbound_unit").Where("id = ?", nomenclatureID).First(&item).Error; err == nil && item.InboundUnit != "" {
+		unit = item.InboundUnit
+	}
 	demandForecast := models.DemandForecast{
 		BranchID:            branchID,
 		NomenclatureID:      nomenclatureID,
@@ -69,7 +75,7 @@ func (s *DemandForecastService) GetForecast(branchID string, nomenclatureID stri
 		ConfidenceScore:     forecast.ConfidenceScore,
 		ForecastMethod:      forecast.Method,
 		PredictedKitchenLoad: forecast.PredictedKitchenLoad,
-		Unit:                "kg", // TODO: Получить из номенклатуры
+		Unit:                unit,
 		ValidUntil:          &time.Time{},
 	}
 	*demandForecast.ValidUntil = date.AddDate(0, 0, 7) // Прогноз актуален 7 дней
@@ -77,10 +83,14 @@ func (s *DemandForecastService) GetForecast(branchID string, nomenclatureID stri
 	// Обновляем или создаем прогноз
 	if err == nil {
 		// Обновляем существующий
-		s.db.Model(&savedForecast).Updates(demandForecast)
+		if err := s.db.Model(&savedForecast).Updates(demandForecast).Error; err != nil {
+			log.Printf("⚠️ Ошибка обновления прогноза %s на %s: %v", nomenclatureID, date.Format("2006-01-02"), err)
+		}
 	} else {
 		// Создаем новый
-		s.db.Create(&demandForecast)
+		if err := s.db.Create(&demandForecast).Error; err != nil {
+			log.Printf("⚠️ Ошибка сохранения прогноза %s на %s: %v", nomenclatureID, date.Format("2006-01-02"), err)
+		}
 	}
 	
 	return forecast, nil
@@ -162,30 +172,50 @@ func (s *DemandForecastService) calculateForecast(branchID string, nomenclatureI
 		return nil, fmt.Errorf("ошибка загрузки истории: %w", err)
 	}
 	
+	return s.forecastFromHistory(history, date), nil
+}
+
+// forecastFromHistory считает прогноз на дату по истории закупок товара (отсортированной по delivery_date DESC)
+// Учитываются только записи того же дня недели за 3 месяца до даты, поэтому можно передать историю за больший период
+func (s *DemandForecastService) forecastFromHistory(history []models.ProcurementHistory, date time.Time) *ForecastResult {
+	dayOfWeek := int(date.Weekday())
+	if dayOfWeek == 0 {
+		dayOfWeek = 7 // Воскресенье
+	}
+	threeMonthsAgo := date.AddDate(0, -3, 0)
+	
+	// 1. Отбираем записи дня недели в окне [date - 3 месяца, date)
+	quantities := make([]float64, 0)
+	for _, h := range history {
+		if h.DayOfWeek == dayOfWeek && !h.DeliveryDate.Before(threeMonthsAgo) && h.DeliveryDate.Before(date) {
+			quantities = append(quantities, h.ReceivedQuantity)
+		}
+	}
+	
 	// 2. Рассчитываем скользящее среднее
 	var forecastedQuantity float64
 	var confidenceScore float64
 	method := "moving_average"
 	
-	if len(history) == 0 {
+	if len(quantities) == 0 {
 		// Нет исторических данных - используем минимальный прогноз
 		forecastedQuantity = 0
 		confidenceScore = 0
 		method = "no_data"
-	} else if len(history) < 3 {
+	} else if len(quantities) < 3 {
 		// Мало данных - простое среднее
 		sum := 0.0
-		for _, h := range history {
-			sum += h.ReceivedQuantity
+		for _, quantity := range quantities {
+			sum += quantity
 		}
-		forecastedQuantity = sum / float64(len(history))
+		forecastedQuantity = sum / float64(len(quantities))
 		confidenceScore = 30.0 // Низкая уверенность
 	} else {
 		// Скользящее среднее за последние 3 месяца
 		sum := 0.0
 		count := 0
-		for i := 0; i < len(history) && i < 12; i++ { // Максимум 12 записей (3 месяца × 4 недели)
-			sum += history[i].ReceivedQuantity
+		for i := 0; i < len(quantities) && i < 12; i++ { // Максимум 12 записей (3 месяца × 4 недели)
+			sum += quantities[i]
 			count++
 		}
 		forecastedQuantity = sum / float64(count)
@@ -209,7 +239,128 @@ func (s *DemandForecastService) calculateForecast(branchID string, nomenclatureI
 		ConfidenceScore:     confidenceScore,
 		PredictedKitchenLoad: predictedKitchenLoad,
 		Method:              method,
-	}, nil
+	}
+}
+
+// forecastKey - ключ прогноза в результате GetForecasts: nomenclature_id|YYYY-MM-DD
+func forecastKey(nomenclatureID string, date time.Time) string {
+	return nomenclatureID + "|" + date.Format("2006-01-02")
+}
+
+// GetForecasts возвращает прогнозы филиала для набора товаров и дат (ключ - forecastKey)
+// Пакетная версия GetForecast для матрицы плана: сохраненные прогнозы и история закупок читаются
+// одним запросом каждый, недостающие прогнозы считаются в памяти и сохраняются пачкой
+func (s *DemandForecastService) GetForecasts(branchID string, items []models.NomenclatureItem, dates []time.Time) (map[string]*ForecastResult, error) {
+	result := make(map[string]*ForecastResult, len(items)*len(dates))
+	if len(items) == 0 || len(dates) == 0 {
+		return result, nil
+	}
+	
+	nomenclatureIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		nomenclatureIDs = append(nomenclatureIDs, item.ID)
+	}
+	minDate, maxDate := dates[0], dates[0]
+	for _, date := range dates {
+		if date.Before(minDate) {
+			minDate = date
+		}
+		if date.After(maxDate) {
+			maxDate = date
+		}
+	}
+	
+	// 1. Сохраненные прогнозы: актуальные используем, устаревшие пересчитываем
+	var saved []models.DemandForecast
+	if err := s.db.Where("branch_id = ? AND nomenclature_id IN ? AND forecast_date >= ? AND forecast_date <= ?",
+		branchID, nomenclatureIDs, minDate, maxDate).Find(&saved).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки прогнозов: %w", err)
+	}
+	now := time.Now()
+	stale := make(map[string]models.DemandForecast)
+	for _, forecast := range saved {
+		key := forecastKey(forecast.NomenclatureID, forecast.ForecastDate)
+		if forecast.ValidUntil == nil || forecast.ValidUntil.After(now) {
+			result[key] = &ForecastResult{
+				ForecastedQuantity:  forecast.ForecastedQuantity,
+				ConfidenceScore:     forecast.ConfidenceScore,
+				PredictedKitchenLoad: forecast.PredictedKitchenLoad,
+				Method:              forecast.ForecastMethod,
+			}
+		} else {
+			stale[key] = forecast
+		}
+	}
+	
+	// 2. История закупок за 3 месяца до самой ранней даты - одним запросом на все товары
+	var history []models.ProcurementHistory
+	if err := s.db.Where("branch_id = ? AND nomenclature_id IN ? AND delivery_date >= ? AND delivery_date < ?",
+		branchID, nomenclatureIDs, minDate.AddDate(0, -3, 0), maxDate).
+		Order("delivery_date DESC").
+		Find(&history).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки истории: %w", err)
+	}
+	historyByItem := make(map[string][]models.ProcurementHistory)
+	for _, h := range history {
+		historyByItem[h.NomenclatureID] = append(historyByItem[h.NomenclatureID], h)
+	}
+	
+	// 3. Недостающие прогнозы считаем в памяти
+	toCreate := make([]models.DemandForecast, 0)
+	toUpdate := make([]models.DemandForecast, 0)
+	for _, item := range items {
+		unit := item.InboundUnit
+		if unit == "" {
+			unit = "kg"
+		}
+		for _, date := range dates {
+			key := forecastKey(item.ID, date)
+			if _, ok := result[key]; ok {
+				continue
+			}
+			forecast := s.forecastFromHistory(historyByItem[item.ID], date)
+			result[key] = forecast
+			
+			validUntil := date.AddDate(0, 0, 7) // Прогноз актуален 7 дней
+			record := models.DemandForecast{
+				BranchID:            branchID,
+				NomenclatureID:      item.ID,
+				ForecastDate:        date,
+				ForecastedQuantity:  forecast.ForecastedQuantity,
+				ConfidenceScore:     forecast.ConfidenceScore,
+				ForecastMethod:      forecast.Method,
+				PredictedKitchenLoad: forecast.PredictedKitchenLoad,
+				Unit:                unit,
+				ValidUntil:          &validUntil,
+			}
+			if old, ok := stale[key]; ok {
+				record.ID = old.ID
+				toUpdate = append(toUpdate, record)
+			} else {
+				toCreate = append(toCreate, record)
+			}
+		}
+	}
+	
+	// 4. Сохраняем прогнозы (по ним считается точность, см. GetForecastAccuracy); ошибка сохранения не мешает ответу
+	if len(toCreate) > 0 || len(toUpdate) > 0 {
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			for i := range toUpdate {
+				if err := tx.Model(&models.DemandForecast{ID: toUpdate[i].ID}).Updates(toUpdate[i]).Error; err != nil {
+					return err
+				}
+			}
+			if len(toCreate) > 0 {
+				return tx.CreateInBatches(toCreate, 500).Error
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("⚠️ Ошибка сохранения прогнозов филиала %s: %v", branchID, err)
+		}
+	}
+	
+	return result, nil
 }
 
 // getSeasonalFactor возвращает сезонный коэффициент для даты
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Стратегия категории определяет, какая партия списывается первой:
+// FEFO - с ближайшим сроком, FIFO - самое старое поступление, LIFO - самое свежее.
+// Списание при продаже и производстве берет партии в том же порядке
+func TestDebitFollowsCategoryDepletionStrategy(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureCategory{}, &models.NomenclatureItem{}, &models.StockBatch{}, &models.StockMovement{})
+	service := NewStockService(db)
+
+	now := time.Now().UTC()
+	lateExpiry := now.AddDate(0, 0, 30)
+	earlyExpiry := now.AddDate(0, 0, 2)
+
+	cases := []struct {
+		strategy string
+		want     string // Какая партия списывается
+	}{
+		{models.DepletionStrategyFEFO, "early-expiry"},
+		{models.DepletionStrategyFIFO, "oldest"},
+		{models.DepletionStrategyLIFO, "newest"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.strategy, func(t *testing.T) {
+			suffix := uuid.New().String()[:8]
+			category := models.NomenclatureCategory{Name: "Категория " + suffix, DepletionStrategy: tc.strategy}
+			if err := db.Create(&category).Error; err != nil {
+				t.Fatalf("не удалось создать категорию: %v", err)
+			}
+			item := models.NomenclatureItem{
+				SKU:        "TEST-" + suffix,
+				Name:       "Рис",
+				BaseUnit:   "g",
+				CategoryID: &category.ID,
+				IsActive:   true,
+			}
+			if err := db.Create(&item).Error; err != nil {
+				t.Fatalf("не удалось создать товар: %v", err)
+			}
+			branchID := uuid.New().String()
+			t.Cleanup(func() {
+				db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+				db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+				db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+				db.Unscoped().Where("id = ?", category.ID).Delete(&models.NomenclatureCategory{})
+			})
+
+			// Поступления по порядку: старое с дальним сроком, затем с ближним сроком, затем свежее без срока
+			batches := map[string]*models.StockBatch{
+				"oldest":       {ExpiryAt: &lateExpiry, CreatedAt: now.Add(-3 * time.Hour)},
+				"early-expiry": {ExpiryAt: &earlyExpiry, CreatedAt: now.Add(-2 * time.Hour)},
+				"newest":       {CreatedAt: now.Add(-time.Hour)},
+			}
+			for _, batch := range batches {
+				batch.NomenclatureID = item.ID
+				batch.BranchID = branchID
+				batch.Quantity = 500
+				batch.RemainingQuantity = 500
+				batch.Unit = "g"
+				batch.Source = "adjustment"
+				if err := db.Create(batch).Error; err != nil {
+					t.Fatalf("не удалось создать партию: %v", err)
+				}
+			}
+
+			// Продажа и производство (processIngredientDepletion*) выбирают партии в том же порядке
+			err := db.Transaction(func(tx *gorm.DB) error {
+				depletable, err := service.depletableBatches(tx, models.RecipeIngredient{NomenclatureID: &item.ID}, branchID)
+				if err != nil {
+					return err
+				}
+				if len(depletable) == 0 || depletable[0].ID != batches[tc.want].ID {
+					t.Errorf("depletableBatches: первой идет не партия %s", tc.want)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("depletableBatches: %v", err)
+			}
+
+			err = db.Transaction(func(tx *gorm.DB) error {
+				return service.debitNomenclatureFromStock(tx, item.ID, 200, branchID, "", "test", item, "тест стратегии")
+			})
+			if err != nil {
+				t.Fatalf("debitNomenclatureFromStock: %v", err)
+			}
+
+			for name, batch := range batches {
+				var current models.StockBatch
+				if err := db.First(&current, "id = ?", batch.ID).Error; err != nil {
+					t.Fatalf("партия %s не найдена: %v", name, err)
+				}
+				want := 500.0
+				if name == tc.want {
+					want = 300
+				}
+				if current.RemainingQuantity != want {
+					t.Errorf("остаток партии %s = %v, want %v", name, current.RemainingQuantity, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Причины закрытия уведомления о сроке годности
+const (
+	ExpiryResolutionConsumed   = "consumed"    // Остаток израсходован в производстве/продаже
+	ExpiryResolutionWrittenOff = "written_off" // Остаток списан как порча
+	ExpiryResolutionIgnored    = "ignored"     // Уведомление закрыто без действий со складом
+)
+
+// ErrExpiryAlertResolved - уведомление уже закрыто
+var ErrExpiryAlertResolved = errors.New("уведомление уже закрыто")
+
+// ExpiryAlertResolution - закрытие уведомлений о сроке годности
+type ExpiryAlertResolution struct {
+	AlertIDs      []string
+	Reason        string // ExpiryResolution*
+	WriteOffBatch bool   // Только для written_off: списать остаток партии с записью в журнал движений
+	PerformedBy   string
+}
+
+// writeOffBatchRemainder списывает весь остаток партии как порчу (waste) и пишет движение в журнал
+// Партия должна быть заблокирована вызывающей транзакцией; пустая партия пропускается
+func writeOffBatchRemainder(tx *gorm.DB, batch models.StockBatch, performedBy, notes string) error {
+	if batch.RemainingQuantity <= 0 {
+		return nil
+	}
+	if err := tx.Model(&batch).Update("remaining_quantity", 0).Error; err != nil {
+		return fmt.Errorf("ошибка списания партии %s: %w", batch.ID, err)
+	}
+	movement := models.StockMovement{
+		StockBatchID:   &batch.ID,
+		NomenclatureID: batch.NomenclatureID,
+		BranchID:       batch.BranchID,
+		Quantity:       -batch.RemainingQuantity,
+		Unit:           batch.Unit,
+		MovementType:   "waste",
+		PerformedBy:    performedBy,
+		Notes:          notes,
+	}
+	if err := tx.Create(&movement).Error; err != nil {
+		return fmt.Errorf("ошибка записи в журнал движений: %w", err)
+	}
+	return nil
+}
+
+// ResolveExpiryAlerts закрывает уведомления о сроке годности в одной транзакции
+// При written_off с WriteOffBatch остаток партии списывается, а остальные открытые уведомления
+// этой партии закрываются вместе с ней. Уже закрытое уведомление - ErrExpiryAlertResolved
+func (s *StockService) ResolveExpiryAlerts(resolution ExpiryAlertResolution) ([]models.ExpiryAlert, error) {
+	if len(resolution.AlertIDs) == 0 {
+		return nil, fmt.Errorf("не указаны уведомления")
+	}
+	switch resolution.Reason {
+	case ExpiryResolutionConsumed, ExpiryResolutionWrittenOff, ExpiryResolutionIgnored:
+	default:
+		return nil, fmt.Errorf("неизвестная причина '%s', допустимо: %s, %s, %s", resolution.Reason,
+			ExpiryResolutionConsumed, ExpiryResolutionWrittenOff, ExpiryResolutionIgnored)
+	}
+	if resolution.WriteOffBatch && resolution.Reason != ExpiryResolutionWrittenOff {
+		return nil, fmt.Errorf("списание партии возможно только с причиной %s", ExpiryResolutionWrittenOff)
+	}
+
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var alerts []models.ExpiryAlert
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", resolution.AlertIDs).Find(&alerts).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("ошибка загрузки уведомлений: %w", err)
+	}
+	if len(alerts) != len(resolution.AlertIDs) {
+		tx.Rollback()
+		return nil, fmt.Errorf("найдено %d из %d уведомлений", len(alerts), len(resolution.AlertIDs))
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"is_resolved":       true,
+		"resolved_at":       now,
+		"resolution_reason": resolution.Reason,
+		"resolved_by":       resolution.PerformedBy,
+	}
+	for i := range alerts {
+		if alerts[i].IsResolved {
+			tx.Rollback()
+			return nil, fmt.Errorf("%w: %s", ErrExpiryAlertResolved, alerts[i].ID)
+		}
+		if err := tx.Model(&alerts[i]).Updates(updates).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("ошибка закрытия уведомления %s: %w", alerts[i].ID, err)
+		}
+		alerts[i].IsResolved = true
+		alerts[i].ResolvedAt = &now
+		alerts[i].ResolutionReason = resolution.Reason
+		alerts[i].ResolvedBy = resolution.PerformedBy
+	}
+
+	if resolution.WriteOffBatch {
+		// Несколько уведомлений (warning и critical) могут относиться к одной партии - списываем ее один раз
+		batchIDs := make([]string, 0, len(alerts))
+		seen := make(map[string]bool, len(alerts))
+		for _, alert := range alerts {
+			if !seen[alert.StockBatchID] {
+				seen[alert.StockBatchID] = true
+				batchIDs = append(batchIDs, alert.StockBatchID)
+			}
+		}
+
+		var batches []models.StockBatch
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", batchIDs).Find(&batches).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("ошибка загрузки партий: %w", err)
+		}
+		for _, batch := range batches {
+			if err := writeOffBatchRemainder(tx, batch, resolution.PerformedBy, "Списание партии по уведомлению о сроке годности"); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+		}
+
+		if err := tx.Model(&models.ExpiryAlert{}).
+			Where("stock_batch_id IN ? AND is_resolved = false", batchIDs).
+			Updates(updates).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("ошибка закрытия уведомлений списанных партий: %w", err)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("ошибка коммита транзакции: %w", err)
+	}
+
+	log.Printf("✅ ResolveExpiryAlerts: закрыто уведомлений: %d (%s, списание партий: %v, by %s)",
+		len(alerts), resolution.Reason, resolution.WriteOffBatch, resolution.PerformedBy)
+	return alerts, nil
+}
+
+// expiryWarningWindow - за сколько до истечения срока годности создается предупреждение
+const expiryWarningWindow = 3 * time.Hour
+
+// ExpiryRecomputeSummary - итог пересчета сроков годности
+type ExpiryRecomputeSummary struct {
+	MarkedExpired         int `json:"marked_expired"`          // Партии, помеченные просроченными
+	WarningAlertsCreated  int `json:"warning_alerts_created"`  // Созданные предупреждения (истекают в ближайшие 3 часа)
+	CriticalAlertsCreated int `json:"critical_alerts_created"` // Созданные критические уведомления (включая пропущенные ранее)
+}
+
+// RecomputeExpiry пересчитывает is_expired по всем филиалам и создает недостающие уведомления
+// Помимо периодической проверки восстанавливает пропуски: просроченная партия с остатком,
+// у которой нет ни одного критического уведомления (проверка не дошла до создания или сервер был остановлен)
+func (s *StockService) RecomputeExpiry() (*ExpiryRecomputeSummary, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("PostgreSQL недоступен")
+	}
+	summary := &ExpiryRecomputeSummary{}
+	now := time.Now()
+
+	// Партии, которые истекают в ближайшие 3 часа
+	var warningBatches []models.StockBatch
+	if err := s.db.Where("expiry_at IS NOT NULL AND expiry_at > ? AND expiry_at <= ?", now, now.Add(expiryWarningWindow)).
+		Where("remaining_quantity > 0 AND is_expired = false").
+		Find(&warningBatches).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки партий с истекающим сроком: %w", err)
+	}
+	for _, batch := range warningBatches {
+		var existing int64
+		if err := s.db.Model(&models.ExpiryAlert{}).
+			Where("stock_batch_id = ? AND alert_type = 'warning' AND is_resolved = false", batch.ID).
+			Count(&existing).Error; err != nil {
+			return nil, fmt.Errorf("ошибка проверки уведомлений партии %s: %w", batch.ID, err)
+		}
+		if existing > 0 {
+			continue
+		}
+		alert := models.ExpiryAlert{StockBatchID: batch.ID, AlertType: "warning", ExpiresAt: *batch.ExpiryAt}
+		if err := s.db.Create(&alert).Error; err != nil {
+			log.Printf("❌ Ошибка создания предупреждения для партии %s: %v", batch.ID, err)
+			continue
+		}
+		summary.WarningAlertsCreated++
+	}
+
+	// Просроченные, но еще не помеченные партии
+	var overdueBatches []models.StockBatch
+	if err := s.db.Where("expiry_at IS NOT NULL AND expiry_at <= ?", now).
+		Where("remaining_quantity > 0 AND is_expired = false").
+		Find(&overdueBatches).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки просроченных партий: %w", err)
+	}
+	for _, batch := range overdueBatches {
+		// Update только флага: Save перезаписал бы остаток, параллельно измененный списанием
+		if err := s.db.Model(&models.StockBatch{}).Where("id = ?", batch.ID).
+			Update("is_expired", true).Error; err != nil {
+			log.Printf("❌ Ошибка обновления просроченной партии %s: %v", batch.ID, err)
+			continue
+		}
+		summary.MarkedExpired++
+	}
+
+	// Просроченные партии с остатком без критического уведомления - только что помеченные и пропущенные ранее
+	var unalertedBatches []models.StockBatch
+	if err := s.db.Where("is_expired = true AND remaining_quantity > 0 AND expiry_at IS NOT NULL").
+		Where("NOT EXISTS (SELECT 1 FROM expiry_alerts a WHERE a.stock_batch_id = stock_batches.id AND a.alert_type = 'critical')").
+		Find(&unalertedBatches).Error; err != nil {
+		return nil, fmt.Errorf("ошибка поиска партий без уведомлений: %w", err)
+	}
+	for _, batch := range unalertedBatches {
+		alert := models.ExpiryAlert{StockBatchID: batch.ID, AlertType: "critical", ExpiresAt: *batch.ExpiryAt}
+		if err := s.db.Create(&alert).Error; err != nil {
+			log.Printf("❌ Ошибка создания критического уведомления для партии %s: %v", batch.ID, err)
+			continue
+		}
+		summary.CriticalAlertsCreated++
+		s.notifyExpiredBatch(batch)
+	}
+
+	if summary.MarkedExpired > 0 || summary.CriticalAlertsCreated > 0 {
+		log.Printf("⏰ RecomputeExpiry: помечено просроченными %d, предупреждений %d, критических уведомлений %d",
+			summary.MarkedExpired, summary.WarningAlertsCreated, summary.CriticalAlertsCreated)
+	}
+	return summary, nil
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// newTestExpiryAlerts создает на отдельном филиале партию с уведомлениями указанных типов
+// Все созданные строки удаляются после теста
+func newTestExpiryAlerts(t *testing.T, alertTypes ...string) (*StockService, string, models.StockBatch, []string) {
+	t.Helper()
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.StockBatch{}, &models.StockMovement{}, &models.ExpiryAlert{})
+
+	item := models.NomenclatureItem{
+		SKU:      "TEST-" + uuid.New().String()[:8],
+		Name:     "Моцарелла",
+		BaseUnit: "kg",
+		IsActive: true,
+	}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+
+	branchID := uuid.New().String()
+	expiresAt := time.Now().Add(-time.Hour)
+	batch := models.StockBatch{
+		NomenclatureID:    item.ID,
+		BranchID:          branchID,
+		Quantity:          5,
+		RemainingQuantity: 2.5,
+		Unit:              "kg",
+		ExpiryAt:          &expiresAt,
+		Source:            "adjustment",
+	}
+	if err := db.Create(&batch).Error; err != nil {
+		t.Fatalf("не удалось создать партию: %v", err)
+	}
+
+	alertIDs := make([]string, 0, len(alertTypes))
+	for _, alertType := range alertTypes {
+		alert := models.ExpiryAlert{StockBatchID: batch.ID, AlertType: alertType, ExpiresAt: expiresAt}
+		if err := db.Create(&alert).Error; err != nil {
+			t.Fatalf("не удалось создать уведомление: %v", err)
+		}
+		alertIDs = append(alertIDs, alert.ID)
+	}
+
+	t.Cleanup(func() {
+		db.Where("stock_batch_id = ?", batch.ID).Delete(&models.ExpiryAlert{})
+		db.Where("stock_batch_id = ?", batch.ID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("id = ?", batch.ID).Delete(&models.StockBatch{})
+		db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+	})
+	return NewStockService(db), branchID, batch, alertIDs
+}
+
+// unresolvedAlertIDs возвращает ID открытых уведомлений филиала
+func unresolvedAlertIDs(t *testing.T, service *StockService, branchID string) map[string]bool {
+	t.Helper()
+	alerts, err := service.GetExpiryAlerts(branchID, "")
+	if err != nil {
+		t.Fatalf("GetExpiryAlerts: %v", err)
+	}
+	ids := make(map[string]bool, len(alerts))
+	for _, alert := range alerts {
+		ids[alert.ID] = true
+	}
+	return ids
+}
+
+func TestResolveExpiryAlertSingle(t *testing.T) {
+	service, branchID, _, alertIDs := newTestExpiryAlerts(t, "warning", "critical")
+
+	resolved, err := service.ResolveExpiryAlerts(ExpiryAlertResolution{
+		AlertIDs:    alertIDs[:1],
+		Reason:      ExpiryResolutionConsumed,
+		PerformedBy: "test",
+	})
+	if err != nil {
+		t.Fatalf("ResolveExpiryAlerts: %v", err)
+	}
+	if len(resolved) != 1 || resolved[0].ResolutionReason != ExpiryResolutionConsumed || resolved[0].ResolvedAt == nil {
+		t.Fatalf("закрыто %+v, want одно уведомление с причиной consumed и временем закрытия", resolved)
+	}
+
+	open := unresolvedAlertIDs(t, service, branchID)
+	if open[alertIDs[0]] {
+		t.Error("закрытое уведомление осталось в списке открытых")
+	}
+	if !open[alertIDs[1]] {
+		t.Error("незатронутое уведомление пропало из списка открытых")
+	}
+
+	// Повторное закрытие - ошибка, а не тихий успех
+	if _, err := service.ResolveExpiryAlerts(ExpiryAlertResolution{AlertIDs: alertIDs[:1], Reason: ExpiryResolutionIgnored}); err == nil {
+		t.Error("повторное закрытие уведомления: ожидалась ошибка")
+	}
+}
+
+func TestResolveExpiryAlertsBulkWithWriteOff(t *testing.T) {
+	service, branchID, batch, alertIDs := newTestExpiryAlerts(t, "warning", "critical")
+
+	resolved, err := service.ResolveExpiryAlerts(ExpiryAlertResolution{
+		AlertIDs:      alertIDs,
+		Reason:        ExpiryResolutionWrittenOff,
+		WriteOffBatch: true,
+		PerformedBy:   "test",
+	})
+	if err != nil {
+		t.Fatalf("ResolveExpiryAlerts: %v", err)
+	}
+	if len(resolved) != len(alertIDs) {
+		t.Fatalf("закрыто %d уведомлений, want %d", len(resolved), len(alertIDs))
+	}
+
+	open := unresolvedAlertIDs(t, service, branchID)
+	for _, id := range alertIDs {
+		if open[id] {
+			t.Errorf("уведомление %s осталось в списке открытых", id)
+		}
+	}
+
+	// Партия списывается один раз, хотя на нее было два уведомления
+	var remaining models.StockBatch
+	if err := service.GetDB().First(&remaining, "id = ?", batch.ID).Error; err != nil {
+		t.Fatalf("партия не найдена: %v", err)
+	}
+	if remaining.RemainingQuantity != 0 {
+		t.Errorf("остаток партии = %.2f, want 0", remaining.RemainingQuantity)
+	}
+	var movements []models.StockMovement
+	if err := service.GetDB().Where("stock_batch_id = ? AND movement_type = 'waste'", batch.ID).Find(&movements).Error; err != nil {
+		t.Fatalf("ошибка загрузки движений: %v", err)
+	}
+	if len(movements) != 1 || movements[0].Quantity != -batch.RemainingQuantity {
+		t.Errorf("движения списания %+v, want одно на -%.2f", movements, batch.RemainingQuantity)
+	}
+}
+
+// Срок партии истек, но периодическая проверка не отработала: is_expired=false и уведомлений нет
+func TestRecomputeExpiryFlagsOverdueBatch(t *testing.T) {
+	service, branchID, batch, _ := newTestExpiryAlerts(t)
+
+	summary, err := service.RecomputeExpiry()
+	if err != nil {
+		t.Fatalf("RecomputeExpiry: %v", err)
+	}
+	// Пересчет идет по всем филиалам тестовой базы, поэтому счетчики - не меньше одного
+	if summary.MarkedExpired < 1 || summary.CriticalAlertsCreated < 1 {
+		t.Errorf("summary = %+v, want marked_expired >= 1 и critical_alerts_created >= 1", *summary)
+	}
+
+	var updated models.StockBatch
+	if err := service.db.First(&updated, "id = ?", batch.ID).Error; err != nil {
+		t.Fatalf("партия не найдена: %v", err)
+	}
+	if !updated.IsExpired {
+		t.Error("партия с истекшим expiry_at не помечена is_expired")
+	}
+
+	alerts, err := service.GetExpiryAlerts(branchID, "critical")
+	if err != nil {
+		t.Fatalf("GetExpiryAlerts: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].StockBatchID != batch.ID {
+		t.Fatalf("критических уведомлений филиала %d, want 1 по партии %s", len(alerts), batch.ID)
+	}
+
+	// Повторный пересчет не дублирует уведомление
+	if _, err := service.RecomputeExpiry(); err != nil {
+		t.Fatalf("повторный RecomputeExpiry: %v", err)
+	}
+	if alerts, _ = service.GetExpiryAlerts(branchID, "critical"); len(alerts) != 1 {
+		t.Errorf("после повторного пересчета критических уведомлений %d, want 1", len(alerts))
+	}
+}
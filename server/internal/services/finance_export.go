@@ -0,0 +1,227 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/shopspring/decimal"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Форматы выгрузки финансовых транзакций
+const (
+	ExportFormat1C  = "1c"  // CSV для загрузки в 1С: Windows-1251, ";", даты ДД.ММ.ГГГГ, десятичная запятая
+	ExportFormatCSV = "csv" // Обычный CSV: UTF-8, ",", даты YYYY-MM-DD, десятичная точка
+)
+
+// DefaultVATRate - ставка НДС по умолчанию (FINANCE_VAT_RATE)
+const DefaultVATRate = 20.0
+
+// Ошибки параметров выгрузки
+var (
+	ErrInvalidExportFormat = errors.New("неизвестный формат выгрузки")
+	ErrInvalidExportPeriod = errors.New("дата окончания периода раньше даты начала")
+)
+
+// oneCColumns - колонки выгрузки в 1С. Порядок совпадает с настройкой загрузки у бухгалтера, менять нельзя
+var oneCColumns = []string{
+	"Дата", "Вид операции", "Контрагент", "ИНН", "Сумма", "Ставка НДС", "Сумма НДС", "Вид оплаты", "Назначение платежа",
+}
+
+// csvColumns - колонки обычного CSV
+var csvColumns = []string{
+	"id", "date", "type", "category", "counterparty", "inn", "amount", "vat", "currency", "source", "status", "description",
+}
+
+// FinanceExport - готовый файл выгрузки
+type FinanceExport struct {
+	Data        []byte
+	ContentType string
+	Extension   string
+	Rows        int
+}
+
+// financeExportRow - транзакция в выгрузке; суммы уже в decimal
+type financeExportRow struct {
+	ID           string
+	Date         time.Time
+	Type         models.TransactionType
+	Category     string
+	Counterparty string
+	INN          string
+	Amount       decimal.Decimal
+	VAT          decimal.Decimal
+	Currency     string
+	Source       models.TransactionSource
+	Status       models.TransactionStatus
+	Description  string
+}
+
+// SetVATRate задает ставку НДС (%) для выгрузки; суммы транзакций считаются включающими налог. < 0 - DefaultVATRate
+func (s *FinanceService) SetVATRate(rate float64) {
+	if rate < 0 {
+		rate = DefaultVATRate
+	}
+	s.vatRate = rate
+}
+
+// ExportTransactions выгружает транзакции за период [from, to) в формате format (ExportFormat1C или ExportFormatCSV)
+// Отмененные транзакции не выгружаются. Строки идут по возрастанию даты
+func (s *FinanceService) ExportTransactions(branchID, source string, from, to time.Time, format string) (*FinanceExport, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format != ExportFormat1C && format != ExportFormatCSV {
+		return nil, fmt.Errorf("%w: '%s', ожидается %s или %s", ErrInvalidExportFormat, format, ExportFormat1C, ExportFormatCSV)
+	}
+	if !to.After(from) {
+		return nil, ErrInvalidExportPeriod
+	}
+
+	transactions, err := s.GetTransactions(branchID, source, "", from, to)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения транзакций: %w", err)
+	}
+	rows := financeExportRows(transactions, decimal.NewFromFloat(s.vatRate))
+
+	if format == ExportFormat1C {
+		data, err := write1CExport(rows, decimal.NewFromFloat(s.vatRate))
+		if err != nil {
+			return nil, err
+		}
+		return &FinanceExport{Data: data, ContentType: "text/csv; charset=windows-1251", Extension: "csv", Rows: len(rows)}, nil
+	}
+	data, err := writeCSVExport(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &FinanceExport{Data: data, ContentType: "text/csv; charset=utf-8", Extension: "csv", Rows: len(rows)}, nil
+}
+
+// financeExportRows переводит транзакции в строки выгрузки: без отмененных, по возрастанию даты,
+// НДС выделяется из суммы по ставке vatRate (сумма * ставка / (100 + ставка), до копеек)
+func financeExportRows(transactions []models.FinanceTransaction, vatRate decimal.Decimal) []financeExportRow {
+	hundred := decimal.NewFromInt(100)
+	rows := make([]financeExportRow, 0, len(transactions))
+	// GetTransactions отдает новые сверху, бухгалтеру удобнее по порядку
+	for i := len(transactions) - 1; i >= 0; i-- {
+		transaction := transactions[i]
+		if transaction.Status == models.TransactionStatusCancelled {
+			continue
+		}
+		amount := decimal.NewFromFloat(transaction.Amount).Round(2)
+		vat := decimal.Zero
+		if vatRate.IsPositive() {
+			vat = amount.Mul(vatRate).Div(hundred.Add(vatRate)).Round(2)
+		}
+		row := financeExportRow{
+			ID:          transaction.ID,
+			Date:        transaction.Date,
+			Type:        transaction.Type,
+			Category:    transaction.Category,
+			Amount:      amount,
+			VAT:         vat,
+			Currency:    transaction.Currency,
+			Source:      transaction.Source,
+			Status:      transaction.Status,
+			Description: transaction.Description,
+		}
+		if transaction.Counterparty != nil {
+			row.Counterparty = transaction.Counterparty.Name
+			if transaction.Counterparty.FullLegalName != "" {
+				row.Counterparty = transaction.Counterparty.FullLegalName
+			}
+			row.INN = transaction.Counterparty.INN
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// write1CExport пишет строки в формате загрузки 1С (колонки oneCColumns)
+// Сумма всегда положительная, направление - в "Вид операции"
+func write1CExport(rows []financeExportRow, vatRate decimal.Decimal) ([]byte, error) {
+	rateLabel := "Без НДС"
+	if vatRate.IsPositive() {
+		rateLabel = vatRate.String() + "%"
+	}
+
+	records := make([][]string, 0, len(rows)+1)
+	records = append(records, oneCColumns)
+	for _, row := range rows {
+		operation := "Списание"
+		if row.Type == models.TransactionTypeIncome {
+			operation = "Поступление"
+		}
+		payment := "Безналичные"
+		if row.Source == models.TransactionSourceCash {
+			payment = "Наличные"
+		}
+		records = append(records, []string{
+			row.Date.Format("02.01.2006"),
+			operation,
+			row.Counterparty,
+			row.INN,
+			format1CAmount(row.Amount.Abs()),
+			rateLabel,
+			format1CAmount(row.VAT.Abs()),
+			payment,
+			row.Description,
+		})
+	}
+
+	data, err := writeCSVRecords(records, ';')
+	if err != nil {
+		return nil, err
+	}
+	// 1С ждет файл в Windows-1251; символы вне кодировки заменяются
+	encoded, err := encoding.ReplaceUnsupported(charmap.Windows1251.NewEncoder()).Bytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка перекодировки выгрузки в Windows-1251: %w", err)
+	}
+	return encoded, nil
+}
+
+// writeCSVExport пишет строки в обычный CSV (колонки csvColumns)
+func writeCSVExport(rows []financeExportRow) ([]byte, error) {
+	records := make([][]string, 0, len(rows)+1)
+	records = append(records, csvColumns)
+	for _, row := range rows {
+		records = append(records, []string{
+			row.ID,
+			row.Date.Format("2006-01-02"),
+			string(row.Type),
+			row.Category,
+			row.Counterparty,
+			row.INN,
+			row.Amount.StringFixed(2),
+			row.VAT.StringFixed(2),
+			row.Currency,
+			string(row.Source),
+			string(row.Status),
+			row.Description,
+		})
+	}
+	return writeCSVRecords(records, ',')
+}
+
+// writeCSVRecords сериализует записи в CSV с разделителем comma
+func writeCSVRecords(records [][]string, comma rune) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Comma = comma
+	if err := writer.WriteAll(records); err != nil {
+		return nil, fmt.Errorf("ошибка формирования CSV: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// format1CAmount - сумма с двумя знаками и десятичной запятой (1234,50)
+func format1CAmount(amount decimal.Decimal) string {
+	return strings.Replace(amount.StringFixed(2), ".", ",", 1)
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/shopspring/decimal"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// readExport разбирает файл выгрузки; для 1С сначала декодирует Windows-1251
+func readExport(t *testing.T, data []byte, comma rune, windows1251 bool) [][]string {
+	t.Helper()
+	if windows1251 {
+		decoded, err := charmap.Windows1251.NewDecoder().Bytes(data)
+		if err != nil {
+			t.Fatalf("выгрузка не в Windows-1251: %v", err)
+		}
+		data = decoded
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = comma
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("выгрузка не читается как CSV: %v", err)
+	}
+	return records
+}
+
+func TestWrite1CExportColumnOrder(t *testing.T) {
+	day := time.Date(2026, 3, 5, 0, 0, 0, 0, time.UTC)
+	transactions := []models.FinanceTransaction{
+		// GetTransactions отдает новые сверху
+		{ID: "t3", Date: day.AddDate(0, 0, 2), Type: models.TransactionTypeIncome, Amount: 100, Source: models.TransactionSourceCash, Description: "Возврат"},
+		{ID: "t2", Date: day.AddDate(0, 0, 1), Type: models.TransactionTypeExpense, Amount: 999, Source: models.TransactionSourceBank, Status: models.TransactionStatusCancelled},
+		{ID: "t1", Date: day, Type: models.TransactionTypeExpense, Amount: 1200.5, Source: models.TransactionSourceBank,
+			Description:  "Оплата по накладной №7",
+			Counterparty: &models.Counterparty{Name: "Молоко", FullLegalName: "ООО \"Молочный; двор\"", INN: "5408123456"}},
+	}
+	rate := decimal.NewFromInt(20)
+
+	data, err := write1CExport(financeExportRows(transactions, rate), rate)
+	if err != nil {
+		t.Fatalf("write1CExport: %v", err)
+	}
+	records := readExport(t, data, ';', true)
+
+	want := [][]string{
+		{"Дата", "Вид операции", "Контрагент", "ИНН", "Сумма", "Ставка НДС", "Сумма НДС", "Вид оплаты", "Назначение платежа"},
+		{"05.03.2026", "Списание", "ООО \"Молочный; двор\"", "5408123456", "1200,50", "20%", "200,08", "Безналичные", "Оплата по накладной №7"},
+		{"07.03.2026", "Поступление", "", "", "100,00", "20%", "16,67", "Наличные", "Возврат"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Fatalf("выгрузка 1С:\n got %q\nwant %q", records, want)
+	}
+}
+
+func TestFinanceExportRowsWithoutVAT(t *testing.T) {
+	transactions := []models.FinanceTransaction{{ID: "t1", Amount: 0.1 + 0.2}}
+	rows := financeExportRows(transactions, decimal.Zero)
+	if len(rows) != 1 {
+		t.Fatalf("строк %d, want 1", len(rows))
+	}
+	if got := rows[0].Amount.StringFixed(2); got != "0.30" {
+		t.Errorf("сумма %s, want 0.30", got)
+	}
+	if !rows[0].VAT.IsZero() {
+		t.Errorf("НДС при ставке 0 = %s, want 0", rows[0].VAT)
+	}
+}
+
+// Выгрузка содержит ровно транзакции периода (граница to не включается), без отмененных
+func TestExportTransactionsMatchesRange(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.Counterparty{}, &models.FinanceTransaction{})
+	branchID := newTestBranch(t, db)
+	counterpartyID := newTestCounterparty(t, db)
+	t.Cleanup(func() {
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.FinanceTransaction{})
+	})
+
+	from := time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2030, 3, 1, 0, 0, 0, 0, time.UTC)
+	create := func(date time.Time, amount float64, status models.TransactionStatus) string {
+		transaction := models.FinanceTransaction{
+			Date:           date,
+			Type:           models.TransactionTypeExpense,
+			Amount:         amount,
+			BranchID:       branchID,
+			Source:         models.TransactionSourceBank,
+			Status:         status,
+			CounterpartyID: &counterpartyID,
+		}
+		if err := db.Create(&transaction).Error; err != nil {
+			t.Fatalf("не удалось создать транзакцию: %v", err)
+		}
+		return transaction.ID
+	}
+	inRange := []string{
+		create(from, 120, models.TransactionStatusCompleted),
+		create(from.AddDate(0, 0, 10), 240.4, models.TransactionStatusPending),
+		create(to.Add(-time.Second), 60, models.TransactionStatusCompleted),
+	}
+	create(from.Add(-time.Second), 1000, models.TransactionStatusCompleted)
+	create(to, 1000, models.TransactionStatusCompleted)
+	create(from.AddDate(0, 0, 5), 1000, models.TransactionStatusCancelled)
+
+	service := NewFinanceService(db)
+	export, err := service.ExportTransactions(branchID, "", from, to, ExportFormatCSV)
+	if err != nil {
+		t.Fatalf("ExportTransactions: %v", err)
+	}
+	records := readExport(t, export.Data, ',', false)
+	if !reflect.DeepEqual(records[0], csvColumns) {
+		t.Fatalf("заголовок %q, want %q", records[0], csvColumns)
+	}
+	var gotIDs []string
+	for _, record := range records[1:] {
+		gotIDs = append(gotIDs, record[0])
+	}
+	if !reflect.DeepEqual(gotIDs, inRange) || export.Rows != len(inRange) {
+		t.Fatalf("выгружены %v (%d строк), want %v", gotIDs, export.Rows, inRange)
+	}
+	if got := records[2][6]; got != "240.40" {
+		t.Errorf("сумма %s, want 240.40", got)
+	}
+
+	oneC, err := service.ExportTransactions(branchID, "", from, to, ExportFormat1C)
+	if err != nil {
+		t.Fatalf("ExportTransactions(1c): %v", err)
+	}
+	if oneC.Rows != len(inRange) {
+		t.Errorf("строк в выгрузке 1С %d, want %d", oneC.Rows, len(inRange))
+	}
+	if _, err := service.ExportTransactions(branchID, "", from, to, "xml"); err == nil {
+		t.Error("неизвестный формат выгрузки принят")
+	}
+}
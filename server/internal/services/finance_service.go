@@ -3,6 +3,7 @@ package services
 import (
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"zephyrvpn/server/internal/models"
@@ -12,12 +13,13 @@ import (
 
 // FinanceService управляет финансовыми транзакциями
 type FinanceService struct {
-	db *gorm.DB
+	db      *gorm.DB
+	vatRate float64 // Ставка НДС (%) для выгрузки в 1С, см. SetVATRate
 }
 
 // NewFinanceService создает новый экземпляр FinanceService
 func NewFinanceService(db *gorm.DB) *FinanceService {
-	return &FinanceService{db: db}
+	return &FinanceService{db: db, vatRate: DefaultVATRate}
 }
 
 // CreateTransaction создает новую финансовую транзакцию
@@ -30,7 +32,8 @@ func (s *FinanceService) CreateTransaction(transaction *models.FinanceTransactio
 
 // GetTransactions получает список транзакций с фильтрацией
 // Preload Counterparty для отображения реальных имен контрагентов
-func (s *FinanceService) GetTransactions(branchID, source, entityIDs string) ([]models.FinanceTransaction, error) {
+// from/to - период по дате операции [from, to); нулевое время - без ограничения
+func (s *FinanceService) GetTransactions(branchID, source, entityIDs string, from, to time.Time) ([]models.FinanceTransaction, error) {
 	var transactions []models.FinanceTransaction
 	query := s.db.Model(&models.FinanceTransaction{}).
 		Preload("Counterparty") // Загружаем данные контрагента для отображения имени
@@ -43,6 +46,13 @@ func (s *FinanceService) GetTransactions(branchID, source, entityIDs string) ([]
 		query = query.Where("source = ?", source)
 	}
 
+	if !from.IsZero() {
+		query = query.Where("date >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("date < ?", to)
+	}
+
 	if entityIDs != "" {
 		// TODO: Парсинг JSON массива entityIDs и фильтрация
 		// Пока оставляем без фильтрации по entity_ids
@@ -174,3 +184,145 @@ func (s *FinanceService) GetCounterpartiesWithBalances() ([]map[string]interface
 	return results, nil
 }
 
+
+// CashFlowDay - движение денег за один день (приход, расход, чистый поток и остаток нарастающим итогом)
+// Cash* - наличные (касса), Bank* - безналичный поток (карты, онлайн-оплаты, расчетный счет)
+type CashFlowDay struct {
+	Date       string  `json:"date"` // YYYY-MM-DD
+	CashIn     float64 `json:"cash_in"`
+	BankIn     float64 `json:"bank_in"`
+	CashOut    float64 `json:"cash_out"`
+	BankOut    float64 `json:"bank_out"`
+	TotalIn    float64 `json:"total_in"`
+	TotalOut   float64 `json:"total_out"`
+	Net        float64 `json:"net"`        // TotalIn - TotalOut
+	Cumulative float64 `json:"cumulative"` // Сумма Net с начала периода
+}
+
+// maxCashFlowDays ограничивает период отчета (год с запасом на високосный)
+const maxCashFlowDays = 366
+
+// GetCashFlow строит отчет о движении денег по дням за период [from, to] включительно
+// Приход: выручка по завершенным заказам (та же выборка, что в RevenueService) + доходные транзакции
+// Расход: завершенные расходные транзакции (expense, invoice, payment); переводы между счетами не учитываются
+// cashOnly=true - только наличный поток (касса)
+// Дни без движения тоже попадают в отчет, чтобы остаток нарастающим итогом был непрерывным
+func (s *FinanceService) GetCashFlow(branchID string, from, to time.Time, cashOnly bool) ([]CashFlowDay, error) {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, to.Location())
+	if to.Before(from) {
+		return nil, fmt.Errorf("дата окончания периода раньше даты начала")
+	}
+	if int(to.Sub(from).Hours()/24)+1 > maxCashFlowDays {
+		return nil, fmt.Errorf("период отчета не может превышать %d дней", maxCashFlowDays)
+	}
+	end := to.AddDate(0, 0, 1) // Верхняя граница не включается
+
+	days := make(map[string]*CashFlowDay)
+	for d := from; d.Before(end); d = d.AddDate(0, 0, 1) {
+		key := d.Format("2006-01-02")
+		days[key] = &CashFlowDay{Date: key}
+	}
+
+	// 1. Выручка по заказам
+	type revenueRow struct {
+		Day           time.Time
+		PaymentMethod string
+		Amount        float64
+	}
+	var revenueRows []revenueRow
+	revenueQuery := s.db.Table("orders").
+		Select(`DATE(created_at) AS day,
+			COALESCE(payment_method, '') AS payment_method,
+			SUM(COALESCE(final_price, total_price - COALESCE(discount_amount, 0))) AS amount`).
+		Where("created_at >= ? AND created_at < ?", from, end).
+		Where("status IN ?", []string{"delivered", "completed", "ready", "archived"})
+	if branchID != "" {
+		revenueQuery = revenueQuery.Where("branch_id = ?", branchID)
+	}
+	if err := revenueQuery.Group("DATE(created_at), COALESCE(payment_method, '')").Scan(&revenueRows).Error; err != nil {
+		return nil, fmt.Errorf("ошибка получения выручки: %w", err)
+	}
+
+	for _, row := range revenueRows {
+		day, ok := days[row.Day.Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		if isCashPaymentMethod(row.PaymentMethod) {
+			day.CashIn += row.Amount
+		} else {
+			day.BankIn += row.Amount
+		}
+	}
+
+	// 2. Финансовые транзакции (только завершенные)
+	type transactionRow struct {
+		Day    time.Time
+		Type   models.TransactionType
+		Source models.TransactionSource
+		Amount float64
+	}
+	var transactionRows []transactionRow
+	transactionQuery := s.db.Model(&models.FinanceTransaction{}).
+		Select("DATE(date) AS day, type, source, SUM(amount) AS amount").
+		Where("date >= ? AND date < ?", from, end).
+		Where("status = ?", models.TransactionStatusCompleted).
+		Where("type IN ?", []models.TransactionType{
+			models.TransactionTypeIncome,
+			models.TransactionTypeExpense,
+			models.TransactionTypeInvoice,
+			models.TransactionTypePayment,
+		})
+	if branchID != "" {
+		transactionQuery = transactionQuery.Where("branch_id = ?", branchID)
+	}
+	if err := transactionQuery.Group("DATE(date), type, source").Scan(&transactionRows).Error; err != nil {
+		return nil, fmt.Errorf("ошибка получения транзакций: %w", err)
+	}
+
+	for _, row := range transactionRows {
+		day, ok := days[row.Day.Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		isCash := row.Source == models.TransactionSourceCash
+		if row.Type == models.TransactionTypeIncome {
+			if isCash {
+				day.CashIn += row.Amount
+			} else {
+				day.BankIn += row.Amount
+			}
+		} else {
+			if isCash {
+				day.CashOut += row.Amount
+			} else {
+				day.BankOut += row.Amount
+			}
+		}
+	}
+
+	// 3. Итоги и остаток нарастающим итогом
+	result := make([]CashFlowDay, 0, len(days))
+	cumulative := 0.0
+	for d := from; d.Before(end); d = d.AddDate(0, 0, 1) {
+		day := days[d.Format("2006-01-02")]
+		if cashOnly {
+			day.BankIn = 0
+			day.BankOut = 0
+		}
+		day.TotalIn = day.CashIn + day.BankIn
+		day.TotalOut = day.CashOut + day.BankOut
+		day.Net = day.TotalIn - day.TotalOut
+		cumulative += day.Net
+		day.Cumulative = cumulative
+		result = append(result, *day)
+	}
+
+	return result, nil
+}
+
+// isCashPaymentMethod проверяет, относится ли способ оплаты заказа к наличным
+func isCashPaymentMethod(paymentMethod string) bool {
+	return strings.EqualFold(strings.TrimSpace(paymentMethod), "cash")
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+)
+
+// consumptionMovementTypes - типы движений, расход по которым считается фактическим спросом
+// (списания 'waste' и корректировки не входят - это не спрос)
+var consumptionMovementTypes = []string{"sale", "production"}
+
+// ForecastAccuracyPoint - прогноз и факт по товару за один день
+type ForecastAccuracyPoint struct {
+	BranchID       string    `json:"branch_id"`
+	NomenclatureID string    `json:"nomenclature_id"`
+	Date           time.Time `json:"date"`
+	Forecast       float64   `json:"forecast"`
+	Actual         float64   `json:"actual"`
+}
+
+// ForecastAccuracy - метрики точности прогноза по товару за период
+type ForecastAccuracy struct {
+	NomenclatureID   string  `json:"nomenclature_id"`
+	NomenclatureName string  `json:"nomenclature_name"`
+	Unit             string  `json:"unit"`
+	Days             int     `json:"days"`      // Дней с прогнозом
+	MAPEDays         int     `json:"mape_days"` // Дней с ненулевым фактом (участвуют в MAPE)
+	TotalForecast    float64 `json:"total_forecast"`
+	TotalActual      float64 `json:"total_actual"`
+	MAPE             float64 `json:"mape"`         // Средняя абсолютная ошибка в %, по дням с ненулевым фактом
+	Bias             float64 `json:"bias"`         // Средняя ошибка (прогноз - факт) в единицах товара; > 0 - перепрогноз
+	BiasPercent      float64 `json:"bias_percent"` // Суммарная ошибка относительно суммарного факта, %
+}
+
+// GetForecastAccuracy сопоставляет сохраненные прогнозы с фактическим расходом (StockMovement)
+// и считает MAPE/bias по каждому товару. branchID - опционально
+// Результат отсортирован по убыванию MAPE: сначала товары, которые модель прогнозирует хуже всего
+func (s *DemandForecastService) GetForecastAccuracy(from, to time.Time, branchID string) ([]ForecastAccuracy, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("дата окончания раньше даты начала")
+	}
+
+	query := s.db.Where("forecast_date >= ? AND forecast_date <= ?", from, to)
+	if branchID != "" {
+		query = query.Where("branch_id = ?", branchID)
+	}
+	var forecasts []models.DemandForecast
+	if err := query.Find(&forecasts).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки прогнозов: %w", err)
+	}
+	if len(forecasts) == 0 {
+		return []ForecastAccuracy{}, nil
+	}
+
+	nomenclatureIDs := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, f := range forecasts {
+		if !seen[f.NomenclatureID] {
+			seen[f.NomenclatureID] = true
+			nomenclatureIDs = append(nomenclatureIDs, f.NomenclatureID)
+		}
+	}
+
+	var items []models.NomenclatureItem
+	if err := s.db.Where("id IN ?", nomenclatureIDs).Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки номенклатуры: %w", err)
+	}
+	itemByID := make(map[string]models.NomenclatureItem, len(items))
+	for _, item := range items {
+		itemByID[item.ID] = item
+	}
+
+	// Фактический расход по дням (в базовых единицах склада)
+	var actuals []struct {
+		BranchID       string
+		NomenclatureID string
+		Day            time.Time
+		Consumed       float64
+	}
+	actualQuery := s.db.Model(&models.StockMovement{}).
+		Select("branch_id, nomenclature_id, DATE(created_at) AS day, SUM(-quantity) AS consumed").
+		Where("nomenclature_id IN ? AND movement_type IN ? AND quantity < 0", nomenclatureIDs, consumptionMovementTypes).
+		Where("created_at >= ? AND created_at < ?", from, to.AddDate(0, 0, 1))
+	if branchID != "" {
+		actualQuery = actualQuery.Where("branch_id = ?", branchID)
+	}
+	if err := actualQuery.Group("branch_id, nomenclature_id, DATE(created_at)").Scan(&actuals).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки фактического расхода: %w", err)
+	}
+	actualByKey := make(map[string]float64, len(actuals))
+	for _, a := range actuals {
+		actualByKey[forecastAccuracyKey(a.BranchID, a.NomenclatureID, a.Day)] = a.Consumed
+	}
+
+	points := make([]ForecastAccuracyPoint, 0, len(forecasts))
+	units := make(map[string]string)
+	for _, f := range forecasts {
+		actual := actualByKey[forecastAccuracyKey(f.BranchID, f.NomenclatureID, f.ForecastDate)]
+		// Движения хранятся в базовых единицах, прогноз - в единицах закупки
+		if item, ok := itemByID[f.NomenclatureID]; ok && f.Unit != item.BaseUnit && item.ConversionFactor > 0 {
+			actual /= item.ConversionFactor
+		}
+		units[f.NomenclatureID] = f.Unit
+		points = append(points, ForecastAccuracyPoint{
+			BranchID:       f.BranchID,
+			NomenclatureID: f.NomenclatureID,
+			Date:           f.ForecastDate,
+			Forecast:       f.ForecastedQuantity,
+			Actual:         actual,
+		})
+	}
+
+	result := computeForecastAccuracy(points)
+	for i := range result {
+		result[i].NomenclatureName = itemByID[result[i].NomenclatureID].Name
+		result[i].Unit = units[result[i].NomenclatureID]
+	}
+	return result, nil
+}
+
+// computeForecastAccuracy агрегирует точки прогноз/факт в метрики по товарам
+func computeForecastAccuracy(points []ForecastAccuracyPoint) []ForecastAccuracy {
+	type accumulator struct {
+		days, mapeDays             int
+		totalForecast, totalActual float64
+		absPercentSum, errorSum    float64
+	}
+	byItem := make(map[string]*accumulator)
+	order := make([]string, 0)
+	for _, p := range points {
+		acc, ok := byItem[p.NomenclatureID]
+		if !ok {
+			acc = &accumulator{}
+			byItem[p.NomenclatureID] = acc
+			order = append(order, p.NomenclatureID)
+		}
+		acc.days++
+		acc.totalForecast += p.Forecast
+		acc.totalActual += p.Actual
+		acc.errorSum += p.Forecast - p.Actual
+		// MAPE не определен при нулевом факте - такие дни учитываются только в bias
+		if p.Actual > 0 {
+			acc.mapeDays++
+			acc.absPercentSum += math.Abs(p.Forecast-p.Actual) / p.Actual
+		}
+	}
+
+	result := make([]ForecastAccuracy, 0, len(order))
+	for _, id := range order {
+		acc := byItem[id]
+		accuracy := ForecastAccuracy{
+			NomenclatureID: id,
+			Days:           acc.days,
+			MAPEDays:       acc.mapeDays,
+			TotalForecast:  roundTo(acc.totalForecast, 2),
+			TotalActual:    roundTo(acc.totalActual, 2),
+			Bias:           roundTo(acc.errorSum/float64(acc.days), 2),
+		}
+		if acc.mapeDays > 0 {
+			accuracy.MAPE = roundTo(acc.absPercentSum/float64(acc.mapeDays)*100, 2)
+		}
+		if acc.totalActual > 0 {
+			accuracy.BiasPercent = roundTo(acc.errorSum/acc.totalActual*100, 2)
+		}
+		result = append(result, accuracy)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].MAPE > result[j].MAPE
+	})
+	return result
+}
+
+// forecastAccuracyKey - ключ сопоставления прогноза и факта: филиал + товар + день
+func forecastAccuracyKey(branchID, nomenclatureID string, day time.Time) string {
+	return branchID + "|" + nomenclatureID + "|" + day.Format("2006-01-02")
+}
+
+// roundTo округляет значение до заданного числа знаков после запятой
+func roundTo(value float64, places int) float64 {
+	pow := math.Pow(10, float64(places))
+	return math.Round(value*pow) / pow
+}
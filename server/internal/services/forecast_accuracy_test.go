@@ -0,0 +1,113 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestComputeForecastAccuracy(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2030, 3, d, 0, 0, 0, 0, time.UTC) }
+	points := []ForecastAccuracyPoint{
+		// Соль: прогноз точный
+		{NomenclatureID: "salt", Date: day(1), Forecast: 2, Actual: 2},
+		{NomenclatureID: "salt", Date: day(2), Forecast: 3, Actual: 3},
+		// Мука: ошибки 25% и 20%, в третий день расхода не было (участвует только в bias)
+		{NomenclatureID: "flour", Date: day(1), Forecast: 10, Actual: 8},
+		{NomenclatureID: "flour", Date: day(2), Forecast: 10, Actual: 12.5},
+		{NomenclatureID: "flour", Date: day(3), Forecast: 5, Actual: 0},
+		// Сыр: расхода не было ни в один день - MAPE не определен
+		{NomenclatureID: "cheese", Date: day(1), Forecast: 1, Actual: 0},
+	}
+
+	result := computeForecastAccuracy(points)
+	if len(result) != 3 {
+		t.Fatalf("товаров %d, want 3", len(result))
+	}
+	// Сначала товары с худшим MAPE
+	if result[0].NomenclatureID != "flour" {
+		t.Errorf("первый товар %s, want flour (наибольший MAPE)", result[0].NomenclatureID)
+	}
+	want := map[string]ForecastAccuracy{
+		"flour":  {NomenclatureID: "flour", Days: 3, MAPEDays: 2, TotalForecast: 25, TotalActual: 20.5, MAPE: 22.5, Bias: 1.5, BiasPercent: 21.95},
+		"salt":   {NomenclatureID: "salt", Days: 2, MAPEDays: 2, TotalForecast: 5, TotalActual: 5},
+		"cheese": {NomenclatureID: "cheese", Days: 1, TotalForecast: 1, Bias: 1},
+	}
+	for _, got := range result {
+		if got != want[got.NomenclatureID] {
+			t.Errorf("метрики %s = %+v, want %+v", got.NomenclatureID, got, want[got.NomenclatureID])
+		}
+	}
+
+	if result := computeForecastAccuracy(nil); len(result) != 0 {
+		t.Errorf("без точек: %+v, want пусто", result)
+	}
+}
+
+// Прогноз муки в кг сопоставляется с расходом в граммах: учитываются только продажи и производство,
+// прогнозы другого филиала и дни вне периода не попадают в метрики
+func TestGetForecastAccuracy(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.NomenclatureItem{}, &models.DemandForecast{},
+		&models.StockMovement{})
+	service := NewDemandForecastService(db)
+	branchID := newTestBranch(t, db)
+	otherBranchID := newTestBranch(t, db)
+
+	flour := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: "Мука", BaseUnit: "g", InboundUnit: "kg",
+		ConversionFactor: 1000, IsActive: true}
+	if err := db.Create(&flour).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Where("nomenclature_id = ?", flour.ID).Delete(&models.StockMovement{})
+		db.Where("nomenclature_id = ?", flour.ID).Delete(&models.DemandForecast{})
+		db.Unscoped().Where("id = ?", flour.ID).Delete(&models.NomenclatureItem{})
+	})
+
+	day := func(d int) time.Time { return time.Date(2030, 3, d, 0, 0, 0, 0, time.UTC) }
+	forecast := func(branch string, date time.Time, quantity float64) {
+		t.Helper()
+		record := models.DemandForecast{BranchID: branch, NomenclatureID: flour.ID, ForecastDate: date,
+			ForecastedQuantity: quantity, Unit: "kg", ForecastMethod: "moving_average"}
+		if err := db.Create(&record).Error; err != nil {
+			t.Fatalf("не удалось сохранить прогноз: %v", err)
+		}
+	}
+	movement := func(branch string, date time.Time, quantity float64, movementType string) {
+		t.Helper()
+		record := models.StockMovement{NomenclatureID: flour.ID, BranchID: branch, Quantity: quantity, Unit: "g",
+			MovementType: movementType, PerformedBy: "test", CreatedAt: date.Add(12 * time.Hour)}
+		if err := db.Create(&record).Error; err != nil {
+			t.Fatalf("не удалось сохранить движение: %v", err)
+		}
+	}
+
+	forecast(branchID, day(1), 10)
+	forecast(branchID, day(2), 10)
+	forecast(branchID, day(3), 5)
+	forecast(branchID, day(4), 100)     // Вне периода
+	forecast(otherBranchID, day(1), 50) // Другой филиал
+	movement(branchID, day(1), -6000, "sale")
+	movement(branchID, day(1), -2000, "production")
+	movement(branchID, day(1), -5000, "waste")   // Списание - не спрос
+	movement(branchID, day(1), 20000, "invoice") // Приход
+	movement(branchID, day(2), -12500, "sale")
+	movement(otherBranchID, day(2), -3000, "sale") // Другой филиал
+
+	if _, err := service.GetForecastAccuracy(day(3), day(1), branchID); err == nil {
+		t.Error("конец периода раньше начала: want ошибку")
+	}
+
+	result, err := service.GetForecastAccuracy(day(1), day(3), branchID)
+	if err != nil {
+		t.Fatalf("GetForecastAccuracy: %v", err)
+	}
+	want := ForecastAccuracy{NomenclatureID: flour.ID, NomenclatureName: "Мука", Unit: "kg", Days: 3, MAPEDays: 2,
+		TotalForecast: 25, TotalActual: 20.5, MAPE: 22.5, Bias: 1.5, BiasPercent: 21.95}
+	if len(result) != 1 || result[0] != want {
+		t.Errorf("GetForecastAccuracy = %+v, want [%+v]", result, want)
+	}
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// importReportFieldOrder - порядок системных полей в отчете (остальные поля маппинга идут следом по алфавиту)
+var importReportFieldOrder = []string{"name", "sku", "category", "unit", "base_unit", "inbound_unit", "price", "storage_zone"}
+
+// importReportSheet - имя листа отчета
+const importReportSheet = "Импорт"
+
+// BuildImportValidationReport проверяет строки импорта через ValidateImport и строит XLSX,
+// в котором к каждой строке добавлены колонки статуса, ошибок и предупреждений
+// Заголовки данных - исходные названия колонок из fieldMapping, поэтому исправленный файл
+// можно загрузить повторно с тем же маппингом. Возвращает файл и результаты валидации
+func (ns *NomenclatureService) BuildImportValidationReport(items []map[string]interface{}, fieldMapping map[string]string, autoCreateCategories bool) ([]byte, []models.ImportValidationResult, error) {
+	validation := ns.ValidateImport(items, fieldMapping, autoCreateCategories)
+	data, err := buildImportReportXLSX(items, fieldMapping, validation)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, validation, nil
+}
+
+// buildImportReportXLSX строит книгу отчета; строки с ошибками подсвечиваются красным, с предупреждениями - желтым
+func buildImportReportXLSX(items []map[string]interface{}, fieldMapping map[string]string, validation []models.ImportValidationResult) ([]byte, error) {
+	fields := importReportFields(items, fieldMapping)
+
+	f := excelize.NewFile()
+	defer f.Close()
+	if err := f.SetSheetName(f.GetSheetName(0), importReportSheet); err != nil {
+		return nil, fmt.Errorf("ошибка создания листа отчета: %w", err)
+	}
+
+	headerStyle, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания стиля: %w", err)
+	}
+	errorStyle, err := f.NewStyle(&excelize.Style{
+		Fill:      excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"F8CBAD"}},
+		Alignment: &excelize.Alignment{WrapText: true, Vertical: "top"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания стиля: %w", err)
+	}
+	warningStyle, err := f.NewStyle(&excelize.Style{
+		Fill:      excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"FFE699"}},
+		Alignment: &excelize.Alignment{WrapText: true, Vertical: "top"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания стиля: %w", err)
+	}
+
+	header := make([]interface{}, 0, len(fields)+4)
+	for _, field := range fields {
+		header = append(header, importReportColumnName(field, fieldMapping))
+	}
+	header = append(header, "Строка", "Статус", "Ошибки", "Предупреждения")
+	if err := f.SetSheetRow(importReportSheet, "A1", &header); err != nil {
+		return nil, fmt.Errorf("ошибка записи заголовков: %w", err)
+	}
+	lastCol, _ := excelize.ColumnNumberToName(len(header))
+	f.SetCellStyle(importReportSheet, "A1", lastCol+"1", headerStyle)
+
+	for i, row := range items {
+		values := make([]interface{}, 0, len(header))
+		for _, field := range fields {
+			values = append(values, row[field])
+		}
+
+		status, errorsText, warningsText := "", "", ""
+		if i < len(validation) {
+			result := validation[i]
+			status = result.Status
+			errorsText = strings.Join(result.Errors, "; ")
+			warningsText = strings.Join(result.Warnings, "; ")
+		}
+		values = append(values, i+1, status, errorsText, warningsText)
+
+		cell, _ := excelize.CoordinatesToCellName(1, i+2)
+		if err := f.SetSheetRow(importReportSheet, cell, &values); err != nil {
+			return nil, fmt.Errorf("ошибка записи строки %d: %w", i+1, err)
+		}
+
+		switch status {
+		case "error":
+			f.SetCellStyle(importReportSheet, cell, fmt.Sprintf("%s%d", lastCol, i+2), errorStyle)
+		case "warning":
+			f.SetCellStyle(importReportSheet, cell, fmt.Sprintf("%s%d", lastCol, i+2), warningStyle)
+		}
+	}
+
+	// Фильтр по заголовкам, чтобы в Excel можно было оставить только проблемные строки
+	f.AutoFilter(importReportSheet, fmt.Sprintf("A1:%s%d", lastCol, len(items)+1), nil)
+	f.SetPanes(importReportSheet, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+	errorsCol, _ := excelize.ColumnNumberToName(len(header) - 1)
+	f.SetColWidth(importReportSheet, errorsCol, lastCol, 60)
+
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		return nil, fmt.Errorf("ошибка сохранения отчета: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// importReportFields возвращает поля для колонок отчета: поля маппинга и поля, встречающиеся в строках
+func importReportFields(items []map[string]interface{}, fieldMapping map[string]string) []string {
+	present := make(map[string]bool)
+	for field, column := range fieldMapping {
+		if column != "" {
+			present[field] = true
+		}
+	}
+	for _, row := range items {
+		for field := range row {
+			present[field] = true
+		}
+	}
+
+	fields := make([]string, 0, len(present))
+	for _, field := range importReportFieldOrder {
+		if present[field] {
+			fields = append(fields, field)
+			delete(present, field)
+		}
+	}
+	rest := make([]string, 0, len(present))
+	for field := range present {
+		rest = append(rest, field)
+	}
+	sort.Strings(rest)
+	return append(fields, rest...)
+}
+
+// importReportColumnName - заголовок колонки: исходное название из файла, если поле было сопоставлено
+func importReportColumnName(field string, fieldMapping map[string]string) string {
+	if column := fieldMapping[field]; column != "" {
+		return column
+	}
+	return field
+}
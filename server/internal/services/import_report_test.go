@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/xuri/excelize/v2"
+)
+
+// importReport - прочитанный отчет: строки листа и цвет заливки первой ячейки каждой строки
+type importReport struct {
+	rows  [][]string
+	fills []string
+}
+
+func readImportReport(t *testing.T, data []byte) importReport {
+	t.Helper()
+	book, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("отчет не открывается как XLSX: %v", err)
+	}
+	defer book.Close()
+	rows, err := book.GetRows(importReportSheet)
+	if err != nil {
+		t.Fatalf("нет листа %s: %v", importReportSheet, err)
+	}
+	report := importReport{rows: rows}
+	for i := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		styleID, err := book.GetCellStyle(importReportSheet, cell)
+		if err != nil {
+			t.Fatalf("GetCellStyle: %v", err)
+		}
+		style, err := book.GetStyle(styleID)
+		if err != nil {
+			t.Fatalf("GetStyle: %v", err)
+		}
+		fill := ""
+		if len(style.Fill.Color) > 0 {
+			fill = style.Fill.Color[0]
+		}
+		report.fills = append(report.fills, fill)
+	}
+	return report
+}
+
+func TestBuildImportReportXLSX(t *testing.T) {
+	items := []map[string]interface{}{
+		{"name": "Мука", "sku": "M-1", "unit": "кг", "price": 45, "comment": "в мешках"},
+		{"name": "", "sku": "", "unit": "кг", "price": 70},
+		{"name": "Сыр", "sku": "C-3", "unit": "бочка", "price": 650},
+	}
+	mapping := map[string]string{"name": "Наименование", "sku": "Артикул", "unit": "Ед.", "price": "Цена", "category": ""}
+	validation := []models.ImportValidationResult{
+		{Row: 1, Status: "success"},
+		{Row: 2, Status: "error", Errors: []string{"Отсутствует название", "Отсутствует SKU"}},
+		{Row: 3, Status: "warning", Warnings: []string{"Неизвестная единица измерения: бочка"}},
+	}
+
+	data, err := buildImportReportXLSX(items, mapping, validation)
+	if err != nil {
+		t.Fatalf("buildImportReportXLSX: %v", err)
+	}
+	report := readImportReport(t, data)
+	want := [][]string{
+		{"Наименование", "Артикул", "Ед.", "Цена", "comment", "Строка", "Статус", "Ошибки", "Предупреждения"},
+		{"Мука", "M-1", "кг", "45", "в мешках", "1", "success"},
+		{"", "", "кг", "70", "", "2", "error", "Отсутствует название; Отсутствует SKU"},
+		{"Сыр", "C-3", "бочка", "650", "", "3", "warning", "", "Неизвестная единица измерения: бочка"},
+	}
+	if !reflect.DeepEqual(report.rows, want) {
+		t.Errorf("строки отчета:\n got %q\nwant %q", report.rows, want)
+	}
+	if wantFills := []string{"", "", "F8CBAD", "FFE699"}; !reflect.DeepEqual(report.fills, wantFills) {
+		t.Errorf("заливка строк %v, want %v", report.fills, wantFills)
+	}
+}
+
+// Файл с заведомо плохими строками проходит ValidateImport, и в отчете помечены именно они
+func TestBuildImportValidationReport(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureCategory{}, &models.NomenclatureItem{})
+	service := NewNomenclatureService(db)
+	existing := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: "Соль " + uuid.New().String()[:8],
+		BaseUnit: "g", IsActive: true}
+	if err := db.Create(&existing).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("id = ?", existing.ID).Delete(&models.NomenclatureItem{})
+	})
+
+	book := excelize.NewFile()
+	defer book.Close()
+	rows := [][]interface{}{
+		{"Артикул", "Наименование", "Ед."},
+		{"NEW-" + uuid.New().String()[:8], "Импорт " + uuid.New().String(), "кг"},
+		{"", "Без артикула", "кг"},
+		{existing.SKU, "Другое название " + uuid.New().String(), "г"},
+		{"NEW-" + uuid.New().String()[:8], "Без единицы " + uuid.New().String(), ""},
+	}
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := book.SetSheetRow("Sheet1", cell, &row); err != nil {
+			t.Fatalf("SetSheetRow: %v", err)
+		}
+	}
+	var file bytes.Buffer
+	if err := book.Write(&file); err != nil {
+		t.Fatalf("не удалось записать файл: %v", err)
+	}
+
+	mapping := map[string]string{"sku": "Артикул", "name": "Наименование", "unit": "Ед."}
+	items, err := service.ParseFileWithMapping(bytes.NewReader(file.Bytes()), "import.xlsx", mapping, nil, -1, "")
+	if err != nil {
+		t.Fatalf("ParseFileWithMapping: %v", err)
+	}
+	data, validation, err := service.BuildImportValidationReport(items, mapping, false)
+	if err != nil {
+		t.Fatalf("BuildImportValidationReport: %v", err)
+	}
+	if len(validation) != 4 {
+		t.Fatalf("результатов валидации %d, want 4", len(validation))
+	}
+
+	report := readImportReport(t, data)
+	if len(report.rows) != 5 {
+		t.Fatalf("строк в отчете %d, want 5 (заголовок и 4 строки)", len(report.rows))
+	}
+	status := func(row []string) string { return row[4] }
+	wantStatuses := []string{"success", "error", "warning", "error"}
+	wantFills := []string{"", "F8CBAD", "FFE699", "F8CBAD"}
+	for i, want := range wantStatuses {
+		row := report.rows[i+1]
+		if len(row) < 5 || status(row) != want || report.fills[i+1] != wantFills[i] {
+			t.Errorf("строка %d: %q с заливкой %q, want статус %s с заливкой %q", i+1, row, report.fills[i+1], want, wantFills[i])
+		}
+	}
+	if row := report.rows[2]; len(row) < 6 || row[5] != "Отсутствует SKU" {
+		t.Errorf("ошибки строки без артикула: %q", row)
+	}
+	if row := report.rows[3]; len(row) < 7 || row[6] != "Дубликат SKU: товар с таким SKU уже существует" {
+		t.Errorf("предупреждения строки с существующим SKU: %q", row)
+	}
+	if row := report.rows[4]; len(row) < 6 || row[5] != "Отсутствует единица измерения" {
+		t.Errorf("ошибки строки без единицы: %q", row)
+	}
+}
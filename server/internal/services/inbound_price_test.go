@@ -0,0 +1,119 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// receiveCheapItem оприходует 10 кг товара по цене priceEntered и возвращает сохраненную партию
+// и строку остатков (GetStockItems) этого товара
+func receiveCheapItem(t *testing.T, priceEntryUnit string, priceEntered float64) (models.StockBatch, map[string]interface{}) {
+	t.Helper()
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.NomenclatureItem{}, &models.Counterparty{},
+		&models.Invoice{}, &models.StockBatch{}, &models.StockMovement{}, &models.PriceHistory{})
+	service := NewStockService(db)
+
+	// Накладная ссылается на филиал, филиал - на юрлицо
+	legalEntity := models.LegalEntity{
+		ID:   uuid.New().String(),
+		Name: "Тестовое ИП " + uuid.New().String()[:8],
+		INN:  fmt.Sprintf("%012d", time.Now().UnixNano()%1e12),
+	}
+	if err := db.Create(&legalEntity).Error; err != nil {
+		t.Fatalf("не удалось создать юрлицо: %v", err)
+	}
+	branch := models.Branch{Name: "Тестовый филиал", LegalEntityID: &legalEntity.ID}
+	if err := db.Create(&branch).Error; err != nil {
+		t.Fatalf("не удалось создать филиал: %v", err)
+	}
+	branchID := branch.ID
+	counterparty := models.Counterparty{
+		ID:   uuid.New().String(),
+		Name: "Тестовый поставщик",
+		INN:  "TEST-" + uuid.New().String()[:8],
+	}
+	if err := db.Create(&counterparty).Error; err != nil {
+		t.Fatalf("не удалось создать поставщика: %v", err)
+	}
+	item := models.NomenclatureItem{
+		SKU:              "TEST-" + uuid.New().String()[:8],
+		Name:             "Соль",
+		BaseUnit:         "g",
+		InboundUnit:      "kg",
+		ConversionFactor: 1000,
+		PriceEntryUnit:   priceEntryUnit,
+		IsActive:         true,
+	}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Where("nomenclature_id = ?", item.ID).Delete(&models.PriceHistory{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.Invoice{})
+		db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+		db.Unscoped().Where("id = ?", counterparty.ID).Delete(&models.Counterparty{})
+		db.Unscoped().Where("id = ?", branchID).Delete(&models.Branch{})
+		db.Unscoped().Where("id = ?", legalEntity.ID).Delete(&models.LegalEntity{})
+	})
+
+	items := []map[string]interface{}{{
+		"nomenclature_id": item.ID,
+		"branch_id":       branchID,
+		"quantity":        10.0,
+		"unit":            "kg",
+		"price_per_unit":  priceEntered,
+	}}
+	if _, err := service.ProcessInboundInvoiceBatch("", items, "test", counterparty.ID, 50, true, "2030-01-18"); err != nil {
+		t.Fatalf("ProcessInboundInvoiceBatch: %v", err)
+	}
+
+	var batch models.StockBatch
+	if err := db.Where("nomenclature_id = ? AND branch_id = ?", item.ID, branchID).First(&batch).Error; err != nil {
+		t.Fatalf("партия не создана: %v", err)
+	}
+
+	stock, err := service.GetStockItems(branchID, true)
+	if err != nil {
+		t.Fatalf("GetStockItems: %v", err)
+	}
+	if len(stock) != 1 {
+		t.Fatalf("GetStockItems вернул %d товаров, want 1", len(stock))
+	}
+	return batch, stock[0]
+}
+
+func assertCheapItemStock(t *testing.T, batch models.StockBatch, stock map[string]interface{}) {
+	t.Helper()
+	if batch.Quantity != 10000 {
+		t.Errorf("количество в партии = %.2f г, want 10000", batch.Quantity)
+	}
+	if batch.CostPerUnit != 5 {
+		t.Errorf("cost_per_unit в партии = %.2f₽/кг, want 5 (не 5000)", batch.CostPerUnit)
+	}
+	if got := stock["cost_per_unit"].(float64); got != 5 {
+		t.Errorf("GetStockItems cost_per_unit = %.2f₽/кг, want 5", got)
+	}
+	if got := stock["cost_value"].(float64); got != 50 {
+		t.Errorf("GetStockItems cost_value = %.2f₽, want 50 (10 кг по 5₽)", got)
+	}
+}
+
+// Дешевый товар за 5₽/кг сохраняется и читается как 5₽/кг, без "исправления" в 5000₽
+func TestInboundPricePerInboundUnitKeepsCheapPrice(t *testing.T) {
+	batch, stock := receiveCheapItem(t, models.PriceEntryUnitInbound, 5)
+	assertCheapItemStock(t, batch, stock)
+}
+
+// Поставщик указывает цену за грамм: 0.005₽/г нормализуется при оприходовании в 5₽/кг
+func TestInboundPricePerBaseUnitNormalizedOnIngestion(t *testing.T) {
+	batch, stock := receiveCheapItem(t, models.PriceEntryUnitBase, 0.005)
+	assertCheapItemStock(t, batch, stock)
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"fmt"
+
+	"zephyrvpn/server/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// substitutionDebit - сколько заменителя списать вместо недостающего основного товара
+type substitutionDebit struct {
+	Substitution models.IngredientSubstitution
+	Nomenclature models.NomenclatureItem
+	Quantity     float64 // В базовых единицах заменителя
+	Covers       float64 // Сколько базовых единиц основного товара покрывает
+}
+
+// planSubstitution подбирает одобренные заменители, чтобы покрыть нехватку основного товара (shortfall, в его базовых единицах)
+// Заменители перебираются по приоритету; возвращает nil, если нехватку не удается покрыть полностью
+func (s *StockService) planSubstitution(tx *gorm.DB, original models.NomenclatureItem, shortfall float64, branchID string) ([]substitutionDebit, error) {
+	var substitutions []models.IngredientSubstitution
+	if err := tx.Preload("Substitute").
+		Where("original_nomenclature_id = ? AND is_approved = true AND conversion_ratio > 0", original.ID).
+		Order("priority ASC, created_at ASC").
+		Find(&substitutions).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки заменителей '%s': %w", original.Name, err)
+	}
+
+	plan := make([]substitutionDebit, 0)
+	remaining := shortfall
+	for _, sub := range substitutions {
+		if remaining <= 0 {
+			break
+		}
+		if sub.Substitute == nil || !sub.Substitute.IsActive {
+			continue
+		}
+
+		// Партии заменителя в карантине не считаем (debitNomenclatureFromStock их не спишет), резервы заказов не трогаем
+		available, err := s.unreservedStock(tx, *sub.Substitute, branchID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка проверки остатков заменителя '%s': %w", sub.Substitute.Name, err)
+		}
+		if available <= 0 {
+			continue
+		}
+
+		needed := remaining * sub.ConversionRatio
+		quantity := needed
+		if available < quantity {
+			quantity = available
+		}
+		covers := quantity / sub.ConversionRatio
+		plan = append(plan, substitutionDebit{
+			Substitution: sub,
+			Nomenclature: *sub.Substitute,
+			Quantity:     quantity,
+			Covers:       covers,
+		})
+		remaining -= covers
+	}
+
+	// Погрешность float64 при делении на коэффициент не должна срывать списание
+	if remaining > 1e-6 {
+		return nil, nil
+	}
+	return plan, nil
+}
+
+// GetIngredientSubstitutions возвращает замены сырья (originalID - опционально, фильтр по основному товару)
+func (s *StockService) GetIngredientSubstitutions(originalID string) ([]models.IngredientSubstitution, error) {
+	query := s.db.Preload("Original").Preload("Substitute").Order("original_nomenclature_id, priority ASC")
+	if originalID != "" {
+		query = query.Where("original_nomenclature_id = ?", originalID)
+	}
+
+	var substitutions []models.IngredientSubstitution
+	if err := query.Find(&substitutions).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки замен сырья: %w", err)
+	}
+	return substitutions, nil
+}
+
+// CreateIngredientSubstitution создает замену сырья
+func (s *StockService) CreateIngredientSubstitution(substitution *models.IngredientSubstitution) error {
+	if substitution.OriginalNomenclatureID == "" || substitution.SubstituteNomenclatureID == "" {
+		return fmt.Errorf("не указан основной товар или заменитель")
+	}
+	if substitution.OriginalNomenclatureID == substitution.SubstituteNomenclatureID {
+		return fmt.Errorf("товар не может быть заменителем самого себя")
+	}
+	if substitution.ConversionRatio <= 0 {
+		return fmt.Errorf("коэффициент замены должен быть больше 0")
+	}
+
+	var count int64
+	if err := s.db.Model(&models.NomenclatureItem{}).
+		Where("id IN ?", []string{substitution.OriginalNomenclatureID, substitution.SubstituteNomenclatureID}).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("ошибка проверки номенклатуры: %w", err)
+	}
+	if count != 2 {
+		return fmt.Errorf("основной товар или заменитель не найден в номенклатуре")
+	}
+
+	if err := s.db.Create(substitution).Error; err != nil {
+		return fmt.Errorf("ошибка создания замены сырья: %w", err)
+	}
+	return nil
+}
+
+// DeleteIngredientSubstitution удаляет замену сырья (soft delete)
+func (s *StockService) DeleteIngredientSubstitution(id string) error {
+	result := s.db.Delete(&models.IngredientSubstitution{}, "id = ?", id)
+	if result.Error != nil {
+		return fmt.Errorf("ошибка удаления замены сырья: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestCreateIngredientSubstitutionValidates(t *testing.T) {
+	service := NewStockService(nil)
+	cases := []models.IngredientSubstitution{
+		{SubstituteNomenclatureID: "cheddar", ConversionRatio: 1},
+		{OriginalNomenclatureID: "mozzarella", ConversionRatio: 1},
+		{OriginalNomenclatureID: "mozzarella", SubstituteNomenclatureID: "mozzarella", ConversionRatio: 1},
+		{OriginalNomenclatureID: "mozzarella", SubstituteNomenclatureID: "cheddar", ConversionRatio: 0},
+		{OriginalNomenclatureID: "mozzarella", SubstituteNomenclatureID: "cheddar", ConversionRatio: -1},
+	}
+	for _, substitution := range cases {
+		if err := service.CreateIngredientSubstitution(&substitution); err == nil {
+			t.Errorf("CreateIngredientSubstitution(%+v): want ошибку", substitution)
+		}
+	}
+}
+
+// Моцареллы 100 г из 300 г: остаток покрывают одобренные заменители по приоритету (чеддер, затем пармезан)
+// с учетом коэффициента, неодобренный сулугуни не используется
+func TestDebitIngredientsFallsBackToSubstitute(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureCategory{}, &models.NomenclatureItem{}, &models.Recipe{}, &models.RecipeIngredient{},
+		&models.StockBatch{}, &models.StockMovement{}, &models.IngredientSubstitution{})
+	service := NewStockService(db)
+	branchID := uuid.New().String()
+	suffix := uuid.New().String()[:8]
+
+	var itemIDs, recipeIDs []string
+	newItem := func(name string, stock float64) string {
+		t.Helper()
+		item := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: name + " " + suffix, BaseUnit: "g", IsActive: true}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("не удалось создать товар: %v", err)
+		}
+		itemIDs = append(itemIDs, item.ID)
+		if stock > 0 {
+			batch := models.StockBatch{NomenclatureID: item.ID, BranchID: branchID, Quantity: stock, RemainingQuantity: stock,
+				Unit: "g", Source: "adjustment"}
+			if err := db.Create(&batch).Error; err != nil {
+				t.Fatalf("не удалось создать партию: %v", err)
+			}
+		}
+		return item.ID
+	}
+	newRecipe := func(allowSubstitutions bool, ingredientID string) string {
+		t.Helper()
+		recipe := models.Recipe{Name: "Пицца " + uuid.New().String()[:8], IsActive: true, PortionSize: 1, PhotoURLs: "[]",
+			AllowSubstitutions: allowSubstitutions,
+			Ingredients:        []models.RecipeIngredient{{NomenclatureID: &ingredientID, Quantity: 300, Unit: "g"}}}
+		if err := db.Create(&recipe).Error; err != nil {
+			t.Fatalf("не удалось создать рецепт: %v", err)
+		}
+		recipeIDs = append(recipeIDs, recipe.ID)
+		return recipe.ID
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("original_nomenclature_id IN ?", itemIDs).Delete(&models.IngredientSubstitution{})
+		db.Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Where("recipe_id IN ?", recipeIDs).Delete(&models.RecipeIngredient{})
+		db.Unscoped().Where("id IN ?", recipeIDs).Delete(&models.Recipe{})
+		db.Unscoped().Where("id IN ?", itemIDs).Delete(&models.NomenclatureItem{})
+	})
+	stockOf := func(nomenclatureID string) float64 {
+		t.Helper()
+		var total float64
+		if err := db.Model(&models.StockBatch{}).Where("nomenclature_id = ? AND branch_id = ?", nomenclatureID, branchID).
+			Select("COALESCE(SUM(remaining_quantity), 0)").Scan(&total).Error; err != nil {
+			t.Fatalf("не удалось прочитать остаток: %v", err)
+		}
+		return total
+	}
+
+	mozzarella := newItem("Моцарелла", 100)
+	suluguni := newItem("Сулугуни", 5000)
+	cheddar := newItem("Чеддер", 150)
+	parmesan := newItem("Пармезан", 1000)
+	addSubstitution := func(substituteID string, ratio float64, priority int, approved bool) {
+		t.Helper()
+		substitution := models.IngredientSubstitution{OriginalNomenclatureID: mozzarella, SubstituteNomenclatureID: substituteID,
+			ConversionRatio: ratio, Priority: priority, IsApproved: approved}
+		if err := service.CreateIngredientSubstitution(&substitution); err != nil {
+			t.Fatalf("CreateIngredientSubstitution: %v", err)
+		}
+	}
+	addSubstitution(suluguni, 1, 0, false)
+	addSubstitution(cheddar, 1.2, 1, true)
+	addSubstitution(parmesan, 0.5, 2, true)
+
+	// Рецепт без разрешения замен падает на нехватке и ничего не списывает
+	if err := service.DebitIngredients(newRecipe(false, mozzarella), branchID, 1); err == nil {
+		t.Fatal("рецепт без замен при нехватке: want ошибку")
+	}
+	if got := stockOf(mozzarella); got != 100 {
+		t.Errorf("после отказа моцарелла %v г, want 100", got)
+	}
+
+	// 100 г моцареллы + 150 г чеддера (покрывают 125 г) + 37.5 г пармезана (покрывают 75 г)
+	if err := service.DebitIngredients(newRecipe(true, mozzarella), branchID, 1, "повар"); err != nil {
+		t.Fatalf("DebitIngredients с заменой: %v", err)
+	}
+	want := map[string]float64{mozzarella: 0, cheddar: 0, parmesan: 962.5, suluguni: 5000}
+	for id, quantity := range want {
+		if got := stockOf(id); got != quantity {
+			t.Errorf("остаток %s = %v г, want %v", id, got, quantity)
+		}
+	}
+
+	var movement models.StockMovement
+	if err := db.Where("nomenclature_id = ? AND branch_id = ?", cheddar, branchID).First(&movement).Error; err != nil {
+		t.Fatalf("нет движения по заменителю: %v", err)
+	}
+	if movement.Quantity != -150 || movement.PerformedBy != "повар" ||
+		!strings.HasPrefix(movement.Notes, "Замена: 'Чеддер "+suffix+"' вместо 'Моцарелла "+suffix+"'") {
+		t.Errorf("движение заменителя %+v, want списание 150 г с пометкой о замене", movement)
+	}
+
+	// 3000 г моцареллы: пармезана хватает только на 1925 г - ничего не списывается
+	if err := service.DebitIngredients(newRecipe(true, mozzarella), branchID, 10); err == nil {
+		t.Fatal("нехватка с учетом заменителей: want ошибку")
+	}
+	if got := stockOf(parmesan); got != 962.5 {
+		t.Errorf("после отказа пармезан %v г, want 962.5", got)
+	}
+}
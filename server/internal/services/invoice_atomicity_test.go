@@ -0,0 +1,146 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Сбой на любом шаге оприходования откатывает всю накладную: партии, движения, last_price, историю цен,
+// финансовую транзакцию и долг поставщика. После устранения сбоя накладная проводится один раз
+func TestProcessInboundInvoiceRollsBackOnFailure(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.NomenclatureItem{}, &models.Counterparty{},
+		&models.Invoice{}, &models.StockBatch{}, &models.StockMovement{}, &models.PriceHistory{}, &models.FinanceTransaction{})
+
+	cases := []struct {
+		name  string
+		table string
+		event string
+		// condition - условие триггера сбоя для филиала и поставщика теста
+		condition func(branchID, counterpartyID string) string
+	}{
+		{"партии", "stock_batches", "INSERT", func(branchID, _ string) string { return fmt.Sprintf("NEW.branch_id = '%s'", branchID) }},
+		{"движения", "stock_movements", "INSERT", func(branchID, _ string) string { return fmt.Sprintf("NEW.branch_id = '%s'", branchID) }},
+		{"финансовая транзакция", "finance_transactions", "INSERT", func(branchID, _ string) string { return fmt.Sprintf("NEW.branch_id = '%s'", branchID) }},
+		{"баланс поставщика", "counterparties", "UPDATE", func(_, counterpartyID string) string { return fmt.Sprintf("NEW.id = '%s'", counterpartyID) }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			service := NewStockService(db)
+			service.SetCounterpartyService(NewCounterpartyService(db))
+			service.SetFinanceService(NewFinanceService(db))
+
+			branchID := newTestBranch(t, db)
+			counterpartyID := newTestCounterparty(t, db)
+			item := models.NomenclatureItem{
+				SKU:              "TEST-" + uuid.New().String()[:8],
+				Name:             "Сыр",
+				BaseUnit:         "g",
+				InboundUnit:      "kg",
+				ConversionFactor: 1000,
+				LastPrice:        40,
+				IsActive:         true,
+			}
+			if err := db.Create(&item).Error; err != nil {
+				t.Fatalf("не удалось создать товар: %v", err)
+			}
+			invoice := models.Invoice{
+				Number:         "TEST-INV-" + uuid.New().String()[:8],
+				CounterpartyID: &counterpartyID,
+				TotalAmount:    500,
+				Status:         models.InvoiceStatusDraft,
+				BranchID:       branchID,
+			}
+			if err := db.Create(&invoice).Error; err != nil {
+				t.Fatalf("не удалось создать черновик накладной: %v", err)
+			}
+			t.Cleanup(func() {
+				db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.FinanceTransaction{})
+				db.Where("nomenclature_id = ?", item.ID).Delete(&models.PriceHistory{})
+				db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+				db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+				db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.Invoice{})
+				db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+			})
+
+			items := []map[string]interface{}{{
+				"nomenclature_id": item.ID,
+				"branch_id":       branchID,
+				"quantity":        10.0,
+				"unit":            "kg",
+				"price_per_unit":  50.0,
+			}}
+
+			restore := failWrites(t, db, tc.table, tc.event, tc.condition(branchID, counterpartyID))
+			if _, err := service.ProcessInboundInvoiceBatch(invoice.ID, items, "test", counterpartyID, 500, false, "2030-01-18"); err == nil {
+				t.Fatal("оприходование прошло несмотря на сбой записи")
+			}
+			assertInvoiceState(t, db, invoice.ID, branchID, counterpartyID, item.ID, inboundState{
+				status: models.InvoiceStatusDraft, lastPrice: 40,
+			})
+
+			restore()
+			result, err := service.ProcessInboundInvoiceBatch(invoice.ID, items, "test", counterpartyID, 500, false, "2030-01-18")
+			if err != nil {
+				t.Fatalf("оприходование после устранения сбоя: %v", err)
+			}
+			if result.AlreadyProcessed || result.BatchesCreated != 1 {
+				t.Fatalf("оприходование после сбоя = %+v, want 1 новая партия", result)
+			}
+			assertInvoiceState(t, db, invoice.ID, branchID, counterpartyID, item.ID, inboundState{
+				status: models.InvoiceStatusCompleted, batches: 1, movements: 1, priceHistory: 1, transactions: 1,
+				balance: 500, lastPrice: 50,
+			})
+		})
+	}
+}
+
+// inboundState - ожидаемые следы оприходования одной накладной в базе
+type inboundState struct {
+	status                                         models.InvoiceStatus
+	batches, movements, priceHistory, transactions int64
+	balance, lastPrice                             float64
+}
+
+// assertInvoiceState сверяет накладную, остатки, финансы и долг поставщика с ожидаемыми
+func assertInvoiceState(t *testing.T, db *gorm.DB, invoiceID, branchID, counterpartyID, nomenclatureID string, want inboundState) {
+	t.Helper()
+	var invoice models.Invoice
+	if err := db.First(&invoice, "id = ?", invoiceID).Error; err != nil {
+		t.Fatalf("накладная не найдена: %v", err)
+	}
+	if invoice.Status != want.status {
+		t.Errorf("статус накладной %s, want %s", invoice.Status, want.status)
+	}
+
+	var got inboundState
+	db.Model(&models.StockBatch{}).Where("branch_id = ?", branchID).Count(&got.batches)
+	db.Model(&models.StockMovement{}).Where("branch_id = ?", branchID).Count(&got.movements)
+	db.Model(&models.PriceHistory{}).Where("nomenclature_id = ?", nomenclatureID).Count(&got.priceHistory)
+	db.Model(&models.FinanceTransaction{}).Where("invoice_id = ?", invoiceID).Count(&got.transactions)
+	if got.batches != want.batches || got.movements != want.movements || got.priceHistory != want.priceHistory || got.transactions != want.transactions {
+		t.Errorf("партий %d, движений %d, истории цен %d, финансовых транзакций %d; want %d, %d, %d, %d",
+			got.batches, got.movements, got.priceHistory, got.transactions,
+			want.batches, want.movements, want.priceHistory, want.transactions)
+	}
+
+	var counterparty models.Counterparty
+	if err := db.First(&counterparty, "id = ?", counterpartyID).Error; err != nil {
+		t.Fatalf("поставщик не найден: %v", err)
+	}
+	if counterparty.BalanceOfficial != want.balance {
+		t.Errorf("долг поставщику %.2f, want %.2f", counterparty.BalanceOfficial, want.balance)
+	}
+
+	var item models.NomenclatureItem
+	if err := db.First(&item, "id = ?", nomenclatureID).Error; err != nil {
+		t.Fatalf("товар не найден: %v", err)
+	}
+	if item.LastPrice != want.lastPrice {
+		t.Errorf("last_price %.2f, want %.2f", item.LastPrice, want.lastPrice)
+	}
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Повторная отправка той же накладной (двойной клик, ретрай клиента) не создает вторую партию
+// и не увеличивает долг поставщика второй раз
+func TestProcessInboundInvoiceTwiceChangesStockOnce(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.NomenclatureItem{}, &models.Counterparty{},
+		&models.Invoice{}, &models.StockBatch{}, &models.StockMovement{}, &models.PriceHistory{}, &models.FinanceTransaction{})
+	service := NewStockService(db)
+	service.SetCounterpartyService(NewCounterpartyService(db))
+	service.SetFinanceService(NewFinanceService(db))
+
+	branchID := newTestBranch(t, db)
+	counterpartyID := newTestCounterparty(t, db)
+	item := models.NomenclatureItem{
+		SKU:              "TEST-" + uuid.New().String()[:8],
+		Name:             "Мука",
+		BaseUnit:         "g",
+		InboundUnit:      "kg",
+		ConversionFactor: 1000,
+		IsActive:         true,
+	}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	invoice := models.Invoice{
+		Number:         "TEST-INV-" + uuid.New().String()[:8],
+		CounterpartyID: &counterpartyID,
+		TotalAmount:    500,
+		Status:         models.InvoiceStatusDraft,
+		BranchID:       branchID,
+	}
+	if err := db.Create(&invoice).Error; err != nil {
+		t.Fatalf("не удалось создать черновик накладной: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.FinanceTransaction{})
+		db.Where("nomenclature_id = ?", item.ID).Delete(&models.PriceHistory{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.Invoice{})
+		db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+	})
+
+	items := []map[string]interface{}{{
+		"nomenclature_id": item.ID,
+		"branch_id":       branchID,
+		"quantity":        10.0,
+		"unit":            "kg",
+		"price_per_unit":  50.0,
+	}}
+	first, err := service.ProcessInboundInvoiceBatch(invoice.ID, items, "test", counterpartyID, 500, false, "2030-01-18")
+	if err != nil {
+		t.Fatalf("первое оприходование: %v", err)
+	}
+	if first.AlreadyProcessed || first.BatchesCreated != 1 {
+		t.Fatalf("первое оприходование = %+v, want 1 партия", first)
+	}
+	second, err := service.ProcessInboundInvoiceBatch(invoice.ID, items, "test", counterpartyID, 500, false, "2030-01-18")
+	if err != nil {
+		t.Fatalf("повторное оприходование: %v", err)
+	}
+	if !second.AlreadyProcessed || second.InvoiceID != invoice.ID {
+		t.Errorf("повторное оприходование = %+v, want AlreadyProcessed по накладной %s", second, invoice.ID)
+	}
+
+	var batches, movements, transactions int64
+	db.Model(&models.StockBatch{}).Where("branch_id = ?", branchID).Count(&batches)
+	db.Model(&models.StockMovement{}).Where("branch_id = ?", branchID).Count(&movements)
+	db.Model(&models.FinanceTransaction{}).Where("invoice_id = ?", invoice.ID).Count(&transactions)
+	if batches != 1 || movements != 1 || transactions != 1 {
+		t.Errorf("партий %d, движений %d, финансовых транзакций %d, want по одной", batches, movements, transactions)
+	}
+
+	var stock float64
+	db.Model(&models.StockBatch{}).Where("branch_id = ?", branchID).Select("COALESCE(SUM(remaining_quantity), 0)").Scan(&stock)
+	if stock != 10000 {
+		t.Errorf("остаток = %.0f г, want 10000", stock)
+	}
+	var counterparty models.Counterparty
+	if err := db.First(&counterparty, "id = ?", counterpartyID).Error; err != nil {
+		t.Fatalf("поставщик не найден: %v", err)
+	}
+	if counterparty.BalanceOfficial != 500 {
+		t.Errorf("долг поставщика = %.2f₽, want 500 (учтен один раз)", counterparty.BalanceOfficial)
+	}
+}
+
+// Та же накладная, отправленная без ID (по номеру), тоже оприходуется один раз
+func TestProcessInboundInvoiceDedupesByNumber(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.NomenclatureItem{}, &models.Counterparty{},
+		&models.Invoice{}, &models.StockBatch{}, &models.StockMovement{}, &models.PriceHistory{})
+	service := NewStockService(db)
+
+	branchID := newTestBranch(t, db)
+	counterpartyID := newTestCounterparty(t, db)
+	item := models.NomenclatureItem{
+		SKU:              "TEST-" + uuid.New().String()[:8],
+		Name:             "Сахар",
+		BaseUnit:         "g",
+		InboundUnit:      "kg",
+		ConversionFactor: 1000,
+		IsActive:         true,
+	}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Where("nomenclature_id = ?", item.ID).Delete(&models.PriceHistory{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.Invoice{})
+		db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+	})
+
+	number := "TEST-INV-" + uuid.New().String()[:8]
+	items := []map[string]interface{}{{
+		"nomenclature_id": item.ID,
+		"branch_id":       branchID,
+		"quantity":        2.0,
+		"unit":            "kg",
+		"price_per_unit":  80.0,
+	}}
+	first, err := service.ProcessInboundInvoiceBatch(number, items, "test", counterpartyID, 160, true, "")
+	if err != nil {
+		t.Fatalf("первое оприходование: %v", err)
+	}
+	second, err := service.ProcessInboundInvoiceBatch(number, items, "test", counterpartyID, 160, true, "")
+	if err != nil {
+		t.Fatalf("повторное оприходование: %v", err)
+	}
+	if !second.AlreadyProcessed || second.InvoiceID != first.InvoiceID {
+		t.Errorf("повторное оприходование = %+v, want AlreadyProcessed по накладной %s", second, first.InvoiceID)
+	}
+
+	var batches int64
+	db.Model(&models.StockBatch{}).Where("branch_id = ?", branchID).Count(&batches)
+	if batches != 1 {
+		t.Errorf("партий %d, want 1", batches)
+	}
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"zephyrvpn/server/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ConsumedInvoiceBatch - партия накладной, из которой уже списывали (мешает аннулированию)
+type ConsumedInvoiceBatch struct {
+	BatchID           string  `json:"batch_id"`
+	NomenclatureID    string  `json:"nomenclature_id"`
+	NomenclatureName  string  `json:"nomenclature_name"`
+	Quantity          float64 `json:"quantity"`
+	RemainingQuantity float64 `json:"remaining_quantity"`
+	Deleted           bool    `json:"deleted"` // Партия удалена (например, объединена с другой)
+}
+
+// InvoiceVoidConflictError - накладную нельзя аннулировать: часть товара уже израсходована
+type InvoiceVoidConflictError struct {
+	Batches []ConsumedInvoiceBatch
+}
+
+func (e *InvoiceVoidConflictError) Error() string {
+	names := make([]string, 0, len(e.Batches))
+	for _, b := range e.Batches {
+		names = append(names, b.NomenclatureName)
+	}
+	return fmt.Sprintf("партии накладной уже использованы: %s", strings.Join(names, ", "))
+}
+
+// VoidInvoice аннулирует проведенную накладную: откатывает оприходование одной транзакцией
+// - партии накладной обнуляются и удаляются, на каждую пишется компенсирующее движение invoice_void
+// - долг/внутренний баланс контрагента уменьшается на сумму накладной
+// - финансовая транзакция накладной отменяется, записи истории цен удаляются (last_price пересчитывается)
+// Если из какой-либо партии уже списывали, возвращает *InvoiceVoidConflictError со списком партий
+func (s *StockService) VoidInvoice(invoiceID, performedBy, reason string) (*models.Invoice, error) {
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var invoice models.Invoice
+	if err := tx.First(&invoice, "id = ?", invoiceID).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("накладная не найдена: %w", err)
+	}
+	if !invoice.IsCompleted() {
+		tx.Rollback()
+		return nil, fmt.Errorf("аннулировать можно только проведенную накладную (текущий статус: %s)", invoice.Status)
+	}
+
+	// Партии накладной (в том числе удаленные - например, объединенные MergeBatches)
+	var batches []models.StockBatch
+	if err := tx.Unscoped().Preload("Nomenclature").
+		Where("invoice_id = ? OR source_reference_id = ?", invoiceID, invoiceID).
+		Find(&batches).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("ошибка загрузки партий накладной: %w", err)
+	}
+
+	consumed := make([]ConsumedInvoiceBatch, 0)
+	for _, batch := range batches {
+		deleted := batch.DeletedAt.Valid
+		if deleted || batch.RemainingQuantity < batch.Quantity-1e-6 {
+			consumed = append(consumed, ConsumedInvoiceBatch{
+				BatchID:           batch.ID,
+				NomenclatureID:    batch.NomenclatureID,
+				NomenclatureName:  batch.Nomenclature.Name,
+				Quantity:          batch.Quantity,
+				RemainingQuantity: batch.RemainingQuantity,
+				Deleted:           deleted,
+			})
+		}
+	}
+	if len(consumed) > 0 {
+		tx.Rollback()
+		return nil, &InvoiceVoidConflictError{Batches: consumed}
+	}
+
+	invoiceRef := invoice.ID
+	for i := range batches {
+		batch := &batches[i]
+		movement := models.StockMovement{
+			StockBatchID:   &batch.ID,
+			NomenclatureID: batch.NomenclatureID,
+			BranchID:       batch.BranchID,
+			Quantity:       -batch.RemainingQuantity, // Компенсирует приход по накладной
+			Unit:           batch.Unit,
+			MovementType:   "invoice_void",
+			InvoiceID:      &invoiceRef,
+			PerformedBy:    performedBy,
+			Notes:          fmt.Sprintf("Аннулирование накладной %s", invoice.Number),
+		}
+		if err := tx.Create(&movement).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("ошибка создания компенсирующего движения: %w", err)
+		}
+		if err := tx.Model(batch).Update("remaining_quantity", 0).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("ошибка обнуления партии: %w", err)
+		}
+		if err := tx.Delete(batch).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("ошибка удаления партии: %w", err)
+		}
+	}
+
+	// Баланс контрагента: оприходование увеличило долг (или внутренний баланс при оплате наличными)
+	if invoice.CounterpartyID != nil && *invoice.CounterpartyID != "" && invoice.TotalAmount > 0 {
+		column := "balance_official"
+		if invoice.IsPaidCash {
+			column = "balance_internal"
+		}
+		if err := tx.Model(&models.Counterparty{}).
+			Where("id = ?", *invoice.CounterpartyID).
+			Update(column, gorm.Expr("COALESCE("+column+", 0) - ?", invoice.TotalAmount)).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("ошибка обновления баланса контрагента: %w", err)
+		}
+	}
+
+	// Финансовая транзакция накладной
+	if err := tx.Model(&models.FinanceTransaction{}).
+		Where("invoice_id = ?", invoiceID).
+		Update("status", models.TransactionStatusCancelled).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("ошибка отмены финансовой транзакции: %w", err)
+	}
+
+	// История цен: цены аннулированной накладной не должны влиять на среднее и last_price
+	var priceRows []models.PriceHistory
+	if err := tx.Where("invoice_id = ?", invoiceID).Find(&priceRows).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("ошибка загрузки истории цен: %w", err)
+	}
+	if len(priceRows) > 0 {
+		if err := tx.Where("invoice_id = ?", invoiceID).Delete(&models.PriceHistory{}).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("ошибка удаления истории цен: %w", err)
+		}
+		for _, row := range priceRows {
+			var previous models.PriceHistory
+			if err := tx.Where("nomenclature_id = ?", row.NomenclatureID).
+				Order("price_date DESC, created_at DESC").
+				First(&previous).Error; err == nil {
+				tx.Model(&models.NomenclatureItem{}).Where("id = ?", row.NomenclatureID).Update("last_price", previous.Price)
+			}
+		}
+	}
+
+	notes := invoice.Notes
+	voidNote := fmt.Sprintf("Аннулирована (%s)", performedBy)
+	if reason != "" {
+		voidNote += ": " + reason
+	}
+	if notes != "" {
+		notes += "\n"
+	}
+	if err := tx.Model(&invoice).Updates(map[string]interface{}{
+		"status": models.InvoiceStatusVoided,
+		"notes":  notes + voidNote,
+	}).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("ошибка обновления статуса накладной: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("ошибка коммита транзакции: %w", err)
+	}
+
+	log.Printf("✅ Аннулирована накладная %s (ID: %s): откатано %d партий", invoice.Number, invoice.ID, len(batches))
+	return &invoice, nil
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestInvoiceVoidConflictError(t *testing.T) {
+	err := &InvoiceVoidConflictError{Batches: []ConsumedInvoiceBatch{{NomenclatureName: "Мука"}, {NomenclatureName: "Сыр"}}}
+	if got, want := err.Error(), "партии накладной уже использованы: Мука, Сыр"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+// Аннулирование нетронутой накладной возвращает остатки и долг перед поставщиком к прежним значениям,
+// накладная с частично израсходованной партией не аннулируется
+func TestVoidInvoice(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.NomenclatureItem{}, &models.Counterparty{},
+		&models.Invoice{}, &models.StockBatch{}, &models.StockMovement{}, &models.PriceHistory{}, &models.FinanceTransaction{})
+	service := NewStockService(db)
+	service.SetCounterpartyService(NewCounterpartyService(db))
+	service.SetFinanceService(NewFinanceService(db))
+	branchID := newTestBranch(t, db)
+	supplierID := newTestCounterparty(t, db)
+
+	item := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: "Мука", BaseUnit: "g", InboundUnit: "kg",
+		ConversionFactor: 1000, IsActive: true}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Where("branch_id = ?", branchID).Delete(&models.FinanceTransaction{})
+		db.Where("nomenclature_id = ?", item.ID).Delete(&models.PriceHistory{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.Invoice{})
+		db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+	})
+	receive := func(kg float64) string {
+		t.Helper()
+		items := []map[string]interface{}{{
+			"nomenclature_id": item.ID,
+			"branch_id":       branchID,
+			"quantity":        kg,
+			"unit":            "kg",
+			"price_per_unit":  50.0,
+		}}
+		result, err := service.ProcessInboundInvoiceBatch("", items, "test", supplierID, kg*50, false, "2030-01-10")
+		if err != nil {
+			t.Fatalf("ProcessInboundInvoiceBatch: %v", err)
+		}
+		return result.InvoiceID
+	}
+	stock := func() float64 {
+		t.Helper()
+		var total float64
+		if err := db.Model(&models.StockBatch{}).Where("nomenclature_id = ? AND branch_id = ?", item.ID, branchID).
+			Select("COALESCE(SUM(remaining_quantity), 0)").Scan(&total).Error; err != nil {
+			t.Fatalf("не удалось прочитать остаток: %v", err)
+		}
+		return total
+	}
+	balance := func() float64 {
+		t.Helper()
+		var counterparty models.Counterparty
+		if err := db.First(&counterparty, "id = ?", supplierID).Error; err != nil {
+			t.Fatalf("не удалось прочитать поставщика: %v", err)
+		}
+		return counterparty.BalanceOfficial
+	}
+
+	// Первая накладная (10 кг) остается проведенной, вторую (4 кг) аннулируем
+	receive(10)
+	stockBefore, balanceBefore := stock(), balance()
+	invoiceID := receive(4)
+	if stock() != stockBefore+4000 || balance() != balanceBefore+200 {
+		t.Fatalf("после прихода остаток %v, долг %v; want %v, %v", stock(), balance(), stockBefore+4000, balanceBefore+200)
+	}
+
+	voided, err := service.VoidInvoice(invoiceID, "менеджер", "ошибка в количестве")
+	if err != nil {
+		t.Fatalf("VoidInvoice: %v", err)
+	}
+	if voided.Status != models.InvoiceStatusVoided {
+		t.Errorf("статус %s, want voided", voided.Status)
+	}
+	if stock() != stockBefore || balance() != balanceBefore {
+		t.Errorf("после аннулирования остаток %v, долг %v; want %v, %v", stock(), balance(), stockBefore, balanceBefore)
+	}
+	var reversal models.StockMovement
+	if err := db.Where("invoice_id = ? AND movement_type = ?", invoiceID, "invoice_void").First(&reversal).Error; err != nil {
+		t.Fatalf("нет компенсирующего движения: %v", err)
+	}
+	if reversal.Quantity != -4000 {
+		t.Errorf("компенсирующее движение %v, want -4000", reversal.Quantity)
+	}
+	var transaction models.FinanceTransaction
+	if err := db.Where("invoice_id = ?", invoiceID).First(&transaction).Error; err != nil {
+		t.Fatalf("нет финансовой транзакции накладной: %v", err)
+	}
+	if transaction.Status != models.TransactionStatusCancelled {
+		t.Errorf("статус транзакции %s, want отменена", transaction.Status)
+	}
+	if _, err := service.VoidInvoice(invoiceID, "менеджер", ""); err == nil {
+		t.Error("повторное аннулирование: want ошибку")
+	}
+
+	// Из партии третьей накладной уже списали - аннулирование отклоняется, ничего не меняется
+	consumedID := receive(2)
+	if err := db.Model(&models.StockBatch{}).Where("invoice_id = ?", consumedID).Update("remaining_quantity", 1500).Error; err != nil {
+		t.Fatalf("не удалось списать из партии: %v", err)
+	}
+	stockBefore, balanceBefore = stock(), balance()
+	_, err = service.VoidInvoice(consumedID, "менеджер", "")
+	var conflict *InvoiceVoidConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("израсходованная партия: %v, want InvoiceVoidConflictError", err)
+	}
+	if len(conflict.Batches) != 1 || conflict.Batches[0].NomenclatureID != item.ID || conflict.Batches[0].RemainingQuantity != 1500 {
+		t.Errorf("партии конфликта %+v, want одну партию муки с остатком 1500", conflict.Batches)
+	}
+	if stock() != stockBefore || balance() != balanceBefore {
+		t.Errorf("после отказа остаток %v, долг %v; want без изменений", stock(), balance())
+	}
+}
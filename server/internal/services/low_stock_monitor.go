@@ -0,0 +1,162 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"zephyrvpn/server/internal/utils"
+)
+
+// DefaultLowStockAlertWindow - через сколько можно повторно уведомить о том же товаре
+const DefaultLowStockAlertWindow = time.Hour
+
+// LowStockAlert - товар, остаток которого опустился ниже минимального уровня
+type LowStockAlert struct {
+	NomenclatureID string  `json:"nomenclature_id"`
+	ProductName    string  `json:"product_name"`
+	BranchID       string  `json:"branch_id"`
+	BranchName     string  `json:"branch_name"`
+	CurrentStock   float64 `json:"current_stock"` // В BaseUnit
+	MinStock       float64 `json:"min_stock"`
+	BaseUnit       string  `json:"base_unit"`
+}
+
+// LowStockMonitor следит за остатками и уведомляет, когда товар пересекает минимальный уровень
+// Уведомление срабатывает на переходе "выше минимума -> ниже", а не на каждой проверке,
+// и не повторяется для того же товара и филиала в течение window
+type LowStockMonitor struct {
+	stockService *StockService
+	redisUtil    *utils.RedisClient // Дедупликация между перезапусками (может быть nil)
+	window       time.Duration
+	notify       func(alerts []LowStockAlert)
+
+	mu          sync.Mutex
+	lastSeen    map[string]LowStockAlert // Последнее известное состояние товара на филиале
+	wasLow      map[string]bool
+	lastAlerted map[string]time.Time // Дедупликация без Redis
+	now         func() time.Time
+}
+
+// NewLowStockMonitor создает монитор низких остатков
+// notify вызывается с товарами, которые только что опустились ниже минимума
+func NewLowStockMonitor(stockService *StockService, redisUtil *utils.RedisClient, window time.Duration, notify func(alerts []LowStockAlert)) *LowStockMonitor {
+	if window <= 0 {
+		window = DefaultLowStockAlertWindow
+	}
+	return &LowStockMonitor{
+		stockService: stockService,
+		redisUtil:    redisUtil,
+		window:       window,
+		notify:       notify,
+		lastSeen:     make(map[string]LowStockAlert),
+		wasLow:       make(map[string]bool),
+		lastAlerted:  make(map[string]time.Time),
+		now:          time.Now,
+	}
+}
+
+// Check проверяет остатки всех филиалов и отправляет уведомление о новых пересечениях минимума
+func (m *LowStockMonitor) Check() ([]LowStockAlert, error) {
+	items, err := m.stockService.GetStockItems("", false)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения остатков: %w", err)
+	}
+
+	alerts := m.evaluate(items)
+	if len(alerts) > 0 {
+		log.Printf("📉 LowStockMonitor: %d товаров опустились ниже минимального остатка", len(alerts))
+		if m.notify != nil {
+			m.notify(alerts)
+		}
+	}
+	return alerts, nil
+}
+
+// evaluate сравнивает остатки с предыдущей проверкой и возвращает товары, только что опустившиеся ниже минимума
+func (m *LowStockMonitor) evaluate(items []map[string]interface{}) []LowStockAlert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := make(map[string]LowStockAlert, len(items))
+	for _, item := range items {
+		state := lowStockStateFromItem(item)
+		current[lowStockKey(state.NomenclatureID, state.BranchID)] = state
+	}
+	// GetStockItems не возвращает товары без остатка: закончившийся товар считаем нулевым
+	for key, state := range m.lastSeen {
+		if _, ok := current[key]; !ok {
+			state.CurrentStock = 0
+			current[key] = state
+		}
+	}
+
+	alerts := make([]LowStockAlert, 0)
+	for key, state := range current {
+		isLow := state.MinStock > 0 && state.CurrentStock < state.MinStock
+		crossed := isLow && !m.wasLow[key]
+		m.wasLow[key] = isLow
+		m.lastSeen[key] = state
+
+		if crossed && m.claimAlert(key) {
+			alerts = append(alerts, state)
+		}
+	}
+	return alerts
+}
+
+// claimAlert резервирует уведомление о товаре на window (вызывается под mu)
+// false - уведомление уже отправлялось недавно (в том числе до перезапуска, если есть Redis)
+func (m *LowStockMonitor) claimAlert(key string) bool {
+	if m.redisUtil != nil {
+		ok, err := m.redisUtil.SetNX("stock:low_alert:"+key, m.now().Unix(), m.window)
+		if err == nil {
+			return ok
+		}
+		log.Printf("⚠️ LowStockMonitor: ошибка Redis при дедупликации, используем память: %v", err)
+	}
+
+	now := m.now()
+	if last, ok := m.lastAlerted[key]; ok && now.Sub(last) < m.window {
+		return false
+	}
+	m.lastAlerted[key] = now
+	return true
+}
+
+// lowStockKey возвращает ключ товара на филиале
+func lowStockKey(nomenclatureID, branchID string) string {
+	return nomenclatureID + ":" + branchID
+}
+
+// lowStockStateFromItem извлекает состояние остатка из строки GetStockItems
+func lowStockStateFromItem(item map[string]interface{}) LowStockAlert {
+	state := LowStockAlert{}
+	state.NomenclatureID, _ = item["product_id"].(string)
+	state.ProductName, _ = item["product_name"].(string)
+	state.BranchID, _ = item["branch_id"].(string)
+	state.BranchName, _ = item["branch_name"].(string)
+	state.CurrentStock, _ = item["current_stock"].(float64)
+	state.MinStock, _ = item["min_stock"].(float64)
+	state.BaseUnit, _ = item["base_unit"].(string)
+	return state
+}
+
+// LowStockNotification формирует критическое уведомление о низком остатке для внешних каналов
+func LowStockNotification(alert LowStockAlert) Notification {
+	return Notification{
+		Key:     "low_stock:" + lowStockKey(alert.NomenclatureID, alert.BranchID),
+		Type:    "low_stock",
+		Level:   NotificationLevelCritical,
+		Title:   fmt.Sprintf("Заканчивается: %s (%s)", alert.ProductName, alert.BranchName),
+		Message: fmt.Sprintf("Остаток %.2f %s при минимуме %.2f %s", alert.CurrentStock, alert.BaseUnit, alert.MinStock, alert.BaseUnit),
+		Data: map[string]interface{}{
+			"nomenclature_id": alert.NomenclatureID,
+			"branch_id":       alert.BranchID,
+			"current_stock":   alert.CurrentStock,
+			"min_stock":       alert.MinStock,
+			"base_unit":       alert.BaseUnit,
+		},
+	}
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// stockRow - строка GetStockItems для монитора низких остатков
+func stockRow(nomenclatureID string, current, min float64) map[string]interface{} {
+	return map[string]interface{}{
+		"product_id":    nomenclatureID,
+		"product_name":  "Товар " + nomenclatureID,
+		"branch_id":     "branch-1",
+		"branch_name":   "Центр",
+		"current_stock": current,
+		"min_stock":     min,
+		"base_unit":     "g",
+	}
+}
+
+// alertedIDs возвращает ID товаров из уведомлений
+func alertedIDs(alerts []LowStockAlert) map[string]bool {
+	ids := make(map[string]bool, len(alerts))
+	for _, alert := range alerts {
+		ids[alert.NomenclatureID] = true
+	}
+	return ids
+}
+
+func TestLowStockMonitorAlertsOnCrossing(t *testing.T) {
+	now := time.Date(2030, 1, 15, 12, 0, 0, 0, time.UTC)
+	monitor := NewLowStockMonitor(nil, nil, time.Hour, nil)
+	monitor.now = func() time.Time { return now }
+
+	// Сразу ниже минимума: "cheese"; без минимума: "salt"; выше минимума: "flour"
+	alerts := monitor.evaluate([]map[string]interface{}{
+		stockRow("cheese", 100, 500),
+		stockRow("salt", 0, 0),
+		stockRow("flour", 2000, 1000),
+	})
+	if ids := alertedIDs(alerts); len(ids) != 1 || !ids["cheese"] {
+		t.Fatalf("первая проверка: уведомления %v, want только cheese", ids)
+	}
+	if alert := alerts[0]; alert.CurrentStock != 100 || alert.MinStock != 500 || alert.BranchName != "Центр" {
+		t.Errorf("уведомление %+v, want остаток 100 при минимуме 500", alert)
+	}
+
+	// Товар остается ниже минимума - повторного уведомления нет; мука пересекла минимум
+	now = now.Add(time.Minute)
+	alerts = monitor.evaluate([]map[string]interface{}{
+		stockRow("cheese", 50, 500),
+		stockRow("flour", 900, 1000),
+	})
+	if ids := alertedIDs(alerts); len(ids) != 1 || !ids["flour"] {
+		t.Fatalf("вторая проверка: уведомления %v, want только flour", ids)
+	}
+
+	// Сыр пополнили и снова израсходовали в пределах окна - уведомление подавлено
+	now = now.Add(time.Minute)
+	monitor.evaluate([]map[string]interface{}{stockRow("cheese", 800, 500), stockRow("flour", 900, 1000)})
+	now = now.Add(time.Minute)
+	if alerts := monitor.evaluate([]map[string]interface{}{stockRow("cheese", 100, 500), stockRow("flour", 900, 1000)}); len(alerts) != 0 {
+		t.Errorf("повторное пересечение в пределах окна: уведомления %v, want нет", alertedIDs(alerts))
+	}
+
+	// После окна новое пересечение снова уведомляет
+	now = now.Add(time.Hour)
+	monitor.evaluate([]map[string]interface{}{stockRow("cheese", 800, 500), stockRow("flour", 900, 1000)})
+	if ids := alertedIDs(monitor.evaluate([]map[string]interface{}{stockRow("cheese", 100, 500), stockRow("flour", 900, 1000)})); !ids["cheese"] {
+		t.Errorf("пересечение после окна: уведомления %v, want cheese", ids)
+	}
+}
+
+// Товар, пропавший из остатков (закончился полностью), считается нулевым
+func TestLowStockMonitorTreatsMissingItemAsEmpty(t *testing.T) {
+	monitor := NewLowStockMonitor(nil, nil, time.Hour, nil)
+
+	if alerts := monitor.evaluate([]map[string]interface{}{stockRow("milk", 3000, 1000)}); len(alerts) != 0 {
+		t.Fatalf("остаток выше минимума: уведомления %v, want нет", alertedIDs(alerts))
+	}
+	alerts := monitor.evaluate(nil)
+	if len(alerts) != 1 || alerts[0].NomenclatureID != "milk" || alerts[0].CurrentStock != 0 {
+		t.Errorf("товар закончился: уведомления %+v, want milk с остатком 0", alerts)
+	}
+}
+
+// Дедупликация через Redis переживает перезапуск: новый монитор не повторяет недавнее уведомление
+func TestLowStockMonitorDedupesAcrossRestarts(t *testing.T) {
+	redisUtil := newTestRedis(t)
+	rows := []map[string]interface{}{stockRow("cheese", 100, 500)}
+
+	first := NewLowStockMonitor(nil, redisUtil, time.Hour, nil)
+	if alerts := first.evaluate(rows); len(alerts) != 1 {
+		t.Fatalf("первый монитор: уведомлений %d, want 1", len(alerts))
+	}
+	restarted := NewLowStockMonitor(nil, redisUtil, time.Hour, nil)
+	if alerts := restarted.evaluate(rows); len(alerts) != 0 {
+		t.Errorf("после перезапуска: уведомлений %d, want 0 (уже отправлено в пределах окна)", len(alerts))
+	}
+}
+
+func TestLowStockNotification(t *testing.T) {
+	notification := LowStockNotification(LowStockAlert{
+		NomenclatureID: "cheese", ProductName: "Сыр", BranchID: "branch-1", BranchName: "Центр",
+		CurrentStock: 120, MinStock: 500, BaseUnit: "g",
+	})
+	if notification.Key != "low_stock:cheese:branch-1" || notification.Level != NotificationLevelCritical {
+		t.Errorf("ключ %q, уровень %v; want low_stock:cheese:branch-1, critical", notification.Key, notification.Level)
+	}
+	if notification.Title != "Заканчивается: Сыр (Центр)" || notification.Message != "Остаток 120.00 g при минимуме 500.00 g" {
+		t.Errorf("заголовок %q, текст %q", notification.Title, notification.Message)
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// MarkdownCurve - кривая агрессивности скидок на товар с истекающим сроком
+// Скидка = MaxPercent * shortfall^Exponent, где shortfall (0..1) - доля партии, которую не успеем продать
+// по полной цене при текущей скорости продаж за оставшиеся часы годности.
+// Exponent < 1 - агрессивнее (заметная скидка уже при небольшом отставании), > 1 - осторожнее
+type MarkdownCurve struct {
+	MaxPercent  float64 // Максимальная скидка, %
+	Exponent    float64 // Показатель степени кривой
+	StepPercent float64 // Скидка округляется вверх до шага (5% -> 5, 10, 15...)
+}
+
+// DefaultMarkdownCurve - линейная кривая до 50% с шагом 5%
+var DefaultMarkdownCurve = MarkdownCurve{MaxPercent: 50, Exponent: 1, StepPercent: 5}
+
+// Действия по партии в плане скидок
+const (
+	MarkdownActionDiscount = "markdown"  // Продать со скидкой
+	MarkdownActionWriteOff = "write_off" // Партия в карантине, в продажу уже не попадет - списать
+)
+
+// MarkdownSuggestion - предложенная скидка на рискованную партию
+type MarkdownSuggestion struct {
+	BatchID          string     `json:"batch_id"`
+	ProductID        string     `json:"product_id"`
+	ProductName      string     `json:"product_name"`
+	BranchID         string     `json:"branch_id"`
+	Quantity         float64    `json:"quantity"` // Остаток партии в BaseUnit
+	Unit             string     `json:"unit"`
+	ExpiryAt         *time.Time `json:"expiry_at"`
+	HoursUntilExpiry float64    `json:"hours_until_expiry"`
+	SalesVelocity    float64    `json:"sales_velocity"`    // Продажи в день за последние 7 дней (BaseUnit)
+	ExpectedSold     float64    `json:"expected_sold"`     // Сколько успеем продать по полной цене до истечения срока
+	ShortfallShare   float64    `json:"shortfall_share"`   // Доля партии, которую нужно дополнительно продать (0..1)
+	SuggestedPercent float64    `json:"suggested_percent"` // Предложенная скидка, %
+	Action           string     `json:"action"`            // markdown, write_off
+	RiskLevel        string     `json:"risk_level"`
+}
+
+// SetMarkdownCurve задает кривую скидок (нулевые поля берутся из DefaultMarkdownCurve)
+func (s *StockService) SetMarkdownCurve(curve MarkdownCurve) {
+	s.markdownCurve = curve
+}
+
+// normalized подставляет значения по умолчанию вместо нулевых и недопустимых полей
+func (c MarkdownCurve) normalized() MarkdownCurve {
+	if c.MaxPercent <= 0 || c.MaxPercent > 100 {
+		c.MaxPercent = DefaultMarkdownCurve.MaxPercent
+	}
+	if c.Exponent <= 0 {
+		c.Exponent = DefaultMarkdownCurve.Exponent
+	}
+	if c.StepPercent <= 0 {
+		c.StepPercent = DefaultMarkdownCurve.StepPercent
+	}
+	return c
+}
+
+// markdownShortfall возвращает, сколько партии успеем продать по полной цене за hoursLeft
+// и какую долю остатка (0..1) придется продавать со скидкой
+func markdownShortfall(quantity, velocityPerDay, hoursLeft float64) (expectedSold, shortfall float64) {
+	if quantity <= 0 {
+		return 0, 0
+	}
+	if velocityPerDay > 0 && hoursLeft > 0 {
+		expectedSold = math.Min(quantity, velocityPerDay*hoursLeft/24)
+	}
+	return expectedSold, 1 - expectedSold/quantity
+}
+
+// Percent возвращает скидку (%) для доли shortfall по кривой
+func (c MarkdownCurve) Percent(shortfall float64) float64 {
+	c = c.normalized()
+	if shortfall <= 0 {
+		return 0
+	}
+	shortfall = math.Min(shortfall, 1)
+	percent := c.MaxPercent * math.Pow(shortfall, c.Exponent)
+	percent = math.Ceil(percent/c.StepPercent-1e-9) * c.StepPercent
+	return math.Min(percent, c.MaxPercent)
+}
+
+// GetMarkdownSuggestions превращает рискованные партии GetAtRiskInventory в план скидок:
+// для партий, которые не успеем продать по полной цене (can_sell_before_expiry = false), считается скидка по кривой,
+// партии в карантине помечаются к списанию. Сначала самые срочные партии
+func (s *StockService) GetMarkdownSuggestions(branchID string) ([]MarkdownSuggestion, error) {
+	if branchID == "" {
+		return nil, fmt.Errorf("branch_id обязателен")
+	}
+	items, err := s.GetAtRiskInventory(branchID)
+	if err != nil {
+		return nil, err
+	}
+	curve := s.markdownCurve.normalized()
+
+	suggestions := make([]MarkdownSuggestion, 0)
+	for _, item := range items {
+		if canSell, _ := item["can_sell_before_expiry"].(bool); canSell {
+			continue
+		}
+		suggestion := MarkdownSuggestion{Action: MarkdownActionDiscount}
+		suggestion.BatchID, _ = item["batch_id"].(string)
+		suggestion.ProductID, _ = item["product_id"].(string)
+		suggestion.ProductName, _ = item["product_name"].(string)
+		suggestion.BranchID, _ = item["branch_id"].(string)
+		suggestion.Quantity, _ = item["quantity"].(float64)
+		suggestion.Unit, _ = item["unit"].(string)
+		suggestion.ExpiryAt, _ = item["expiry_at"].(*time.Time)
+		suggestion.HoursUntilExpiry, _ = item["hours_until_expiry"].(float64)
+		suggestion.SalesVelocity, _ = item["sales_velocity"].(float64)
+		suggestion.RiskLevel, _ = item["risk_level"].(string)
+
+		if quarantined, _ := item["quarantined"].(bool); quarantined {
+			suggestion.Action = MarkdownActionWriteOff
+			suggestion.ShortfallShare = 1
+			suggestions = append(suggestions, suggestion)
+			continue
+		}
+
+		suggestion.ExpectedSold, suggestion.ShortfallShare = markdownShortfall(
+			suggestion.Quantity, suggestion.SalesVelocity, suggestion.HoursUntilExpiry)
+		suggestion.SuggestedPercent = curve.Percent(suggestion.ShortfallShare)
+		if suggestion.SuggestedPercent <= 0 {
+			continue // По часам успеваем продать все
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].HoursUntilExpiry < suggestions[j].HoursUntilExpiry
+	})
+	return suggestions, nil
+}
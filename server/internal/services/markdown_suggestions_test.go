@@ -0,0 +1,107 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestMarkdownCurvePercent(t *testing.T) {
+	cases := []struct {
+		name      string
+		curve     MarkdownCurve
+		shortfall float64
+		want      float64
+	}{
+		{"успеваем продать", DefaultMarkdownCurve, 0, 0},
+		{"половина партии, линейно", DefaultMarkdownCurve, 0.5, 25},
+		{"округление вверх до шага", DefaultMarkdownCurve, 0.42, 25},
+		{"ничего не продается", DefaultMarkdownCurve, 1, 50},
+		{"агрессивная кривая", MarkdownCurve{MaxPercent: 50, Exponent: 0.5, StepPercent: 5}, 0.25, 25},
+		{"осторожная кривая", MarkdownCurve{MaxPercent: 50, Exponent: 2, StepPercent: 5}, 0.5, 15},
+		{"нулевая кривая = по умолчанию", MarkdownCurve{}, 0.5, 25},
+	}
+	for _, tc := range cases {
+		if got := tc.curve.Percent(tc.shortfall); got != tc.want {
+			t.Errorf("%s: Percent(%.2f) = %.2f, want %.2f", tc.name, tc.shortfall, got, tc.want)
+		}
+	}
+}
+
+func TestMarkdownShortfall(t *testing.T) {
+	// 1000 г, продаем 960 г в день, осталось 12 часов: успеем 480 г, со скидкой 52%
+	sold, shortfall := markdownShortfall(1000, 960, 12)
+	if sold != 480 || shortfall != 0.52 {
+		t.Errorf("markdownShortfall = %.0f г, %.2f, want 480 г, 0.52", sold, shortfall)
+	}
+	// Продаж не было - скидка на всю партию
+	if _, shortfall := markdownShortfall(1000, 0, 12); shortfall != 1 {
+		t.Errorf("без продаж shortfall = %.2f, want 1", shortfall)
+	}
+	// Скорость продаж с запасом покрывает остаток
+	if _, shortfall := markdownShortfall(100, 960, 12); shortfall != 0 {
+		t.Errorf("при высокой скорости shortfall = %.2f, want 0", shortfall)
+	}
+}
+
+// Партия истекает через 12 часов, а за неделю продали только 700 г (100 г/день):
+// по полной цене уйдет 50 г из 1000, предлагается скидка
+func TestGetMarkdownSuggestionsForSlowBatch(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.NomenclatureCategory{}, &models.StockBatch{}, &models.StockMovement{})
+	service := NewStockService(db)
+
+	item := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: "Ветчина", BaseUnit: "g", InboundUnit: "kg", IsActive: true}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	branchID := uuid.New().String()
+	expiresAt := time.Now().Add(12 * time.Hour)
+	batch := models.StockBatch{
+		NomenclatureID:    item.ID,
+		BranchID:          branchID,
+		Quantity:          1000,
+		RemainingQuantity: 1000,
+		Unit:              "g",
+		ExpiryAt:          &expiresAt,
+		Source:            "adjustment",
+	}
+	if err := db.Create(&batch).Error; err != nil {
+		t.Fatalf("не удалось создать партию: %v", err)
+	}
+	if err := db.Create(&models.StockMovement{
+		NomenclatureID: item.ID,
+		BranchID:       branchID,
+		Quantity:       -700,
+		Unit:           "g",
+		MovementType:   "sale",
+		CreatedAt:      time.Now().Add(-24 * time.Hour),
+	}).Error; err != nil {
+		t.Fatalf("не удалось создать продажу: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("id = ?", batch.ID).Delete(&models.StockBatch{})
+		db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+	})
+
+	suggestions, err := service.GetMarkdownSuggestions(branchID)
+	if err != nil {
+		t.Fatalf("GetMarkdownSuggestions: %v", err)
+	}
+	if len(suggestions) != 1 {
+		t.Fatalf("предложений %d, want 1", len(suggestions))
+	}
+	suggestion := suggestions[0]
+	if suggestion.BatchID != batch.ID || suggestion.Action != MarkdownActionDiscount {
+		t.Errorf("предложение = %+v, want скидка на партию %s", suggestion, batch.ID)
+	}
+	if suggestion.SuggestedPercent <= 0 || suggestion.SuggestedPercent > DefaultMarkdownCurve.MaxPercent {
+		t.Errorf("скидка = %.0f%%, want от 0 до %.0f%%", suggestion.SuggestedPercent, DefaultMarkdownCurve.MaxPercent)
+	}
+	if suggestion.ShortfallShare < 0.9 {
+		t.Errorf("доля со скидкой = %.2f, want ~0.95 (продастся около 50 г из 1000)", suggestion.ShortfallShare)
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils/rediskeys"
+)
+
+// MenuAvailabilityCacheTTL - сколько живет рассчитанная доступность меню в Redis
+// Короткий TTL: остатки меняются с каждым заказом, но пересчитывать все рецепты на каждый запрос меню дорого
+const MenuAvailabilityCacheTTL = 30 * time.Second
+
+// MenuItemAvailability - можно ли приготовить позицию меню из текущих остатков филиала
+type MenuItemAvailability struct {
+	Available          bool   `json:"available"`
+	MaxPortions        int    `json:"max_portions"`                  // Целых порций из остатков
+	LimitingIngredient string `json:"limiting_ingredient,omitempty"` // Ингредиент, который закончится первым
+	Reason             string `json:"reason,omitempty"`              // Почему позиция недоступна
+}
+
+// MenuAvailability - доступность пицц и наборов меню (ключ - название позиции)
+type MenuAvailability struct {
+	BranchID  string                          `json:"branch_id"`
+	Pizzas    map[string]MenuItemAvailability `json:"pizzas"`
+	Sets      map[string]MenuItemAvailability `json:"sets"` // Набор доступен, если доступны все его пиццы
+	CheckedAt time.Time                       `json:"checked_at"`
+}
+
+// SetStockService подключает сервис остатков для расчета доступности меню
+func (ms *MenuService) SetStockService(stockService *StockService) {
+	ms.stockService = stockService
+}
+
+// GetMenuAvailability считает доступность позиций меню по остаткам филиала (GetMaxProducible для 1 порции)
+// Результат кэшируется в Redis на MenuAvailabilityCacheTTL
+func (ms *MenuService) GetMenuAvailability(branchID string) (*MenuAvailability, error) {
+	if ms.stockService == nil {
+		return nil, fmt.Errorf("сервис остатков недоступен")
+	}
+	if branchID == "" {
+		return nil, fmt.Errorf("branch_id обязателен")
+	}
+
+	cacheKey := rediskeys.MenuAvailabilityKey(branchID)
+	if ms.redisUtil != nil {
+		var cached MenuAvailability
+		if err := ms.redisUtil.GetJSON(cacheKey, &cached); err == nil {
+			return &cached, nil
+		}
+	}
+
+	// Пицца меню связана с рецептом по имени (как в LoadMenu)
+	var recipes []models.Recipe
+	if err := ms.db.Where("is_active = true AND is_semi_finished = false AND deleted_at IS NULL").
+		Find(&recipes).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки рецептов: %w", err)
+	}
+	recipeIDByName := make(map[string]string, len(recipes))
+	for _, recipe := range recipes {
+		key := strings.ToLower(recipe.Name)
+		if _, exists := recipeIDByName[key]; !exists {
+			recipeIDByName[key] = recipe.ID
+		}
+	}
+
+	result := &MenuAvailability{
+		BranchID:  branchID,
+		Pizzas:    make(map[string]MenuItemAvailability),
+		Sets:      make(map[string]MenuItemAvailability),
+		CheckedAt: time.Now(),
+	}
+
+	for name := range models.GetAllPizzas() {
+		recipeID, ok := recipeIDByName[strings.ToLower(name)]
+		if !ok {
+			result.Pizzas[name] = MenuItemAvailability{Reason: "рецепт не найден"}
+			continue
+		}
+		maxQuantity, bottleneck, err := ms.stockService.GetMaxProducible(recipeID, branchID)
+		if err != nil {
+			result.Pizzas[name] = MenuItemAvailability{Reason: err.Error()}
+			continue
+		}
+		portions := int(math.Floor(maxQuantity + 1e-9))
+		item := MenuItemAvailability{
+			Available:          portions >= 1,
+			MaxPortions:        portions,
+			LimitingIngredient: bottleneck,
+		}
+		if !item.Available {
+			item.Reason = fmt.Sprintf("недостаточно остатков: %s", bottleneck)
+		}
+		result.Pizzas[name] = item
+	}
+
+	for name, set := range models.GetAllSets() {
+		item := MenuItemAvailability{Available: true, MaxPortions: -1}
+		for _, pizzaName := range set.Pizzas {
+			pizza, ok := result.Pizzas[pizzaName]
+			if !ok {
+				item = MenuItemAvailability{Reason: fmt.Sprintf("пицца '%s' не найдена в меню", pizzaName)}
+				break
+			}
+			if item.MaxPortions < 0 || pizza.MaxPortions < item.MaxPortions {
+				item.MaxPortions = pizza.MaxPortions
+				item.LimitingIngredient = pizza.LimitingIngredient
+			}
+			if !pizza.Available {
+				item.Available = false
+				item.Reason = fmt.Sprintf("недоступна пицца '%s'", pizzaName)
+			}
+		}
+		if item.MaxPortions < 0 {
+			item.MaxPortions = 0
+		}
+		result.Sets[name] = item
+	}
+
+	if ms.redisUtil != nil {
+		if err := ms.redisUtil.Set(cacheKey, result, MenuAvailabilityCacheTTL); err != nil {
+			log.Printf("⚠️ GetMenuAvailability: не удалось закэшировать доступность меню: %v", err)
+		}
+	}
+
+	return result, nil
+}
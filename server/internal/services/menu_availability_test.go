@@ -0,0 +1,112 @@
+package services
+
+import (
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestGetMenuAvailabilityValidates(t *testing.T) {
+	ms := NewMenuService(nil, nil)
+	if _, err := ms.GetMenuAvailability("branch-1"); err == nil {
+		t.Error("без сервиса остатков: want ошибку")
+	}
+	ms.SetStockService(NewStockService(nil))
+	if _, err := ms.GetMenuAvailability(""); err == nil {
+		t.Error("без branch_id: want ошибку")
+	}
+}
+
+// У Маргариты закончилась моцарелла - она недоступна, ограничивающий ингредиент - моцарелла;
+// Пепперони готовится, набор с Маргаритой недоступен, пицца без рецепта помечена отдельно
+func TestGetMenuAvailabilityReportsOutOfStockPizza(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.NomenclatureItem{}, &models.NomenclatureCategory{},
+		&models.Recipe{}, &models.RecipeIngredient{}, &models.StockBatch{}, &models.StockMovement{}, &models.StockReservation{})
+	branchID := newTestBranch(t, db)
+	suffix := uuid.New().String()[:8]
+
+	var itemIDs, recipeIDs []string
+	t.Cleanup(func() {
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Where("recipe_id IN ?", recipeIDs).Delete(&models.RecipeIngredient{})
+		db.Unscoped().Where("id IN ?", recipeIDs).Delete(&models.Recipe{})
+		db.Unscoped().Where("id IN ?", itemIDs).Delete(&models.NomenclatureItem{})
+	})
+	newItem := func(name string, stock float64) *string {
+		t.Helper()
+		item := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: name + " " + suffix, BaseUnit: "g", IsActive: true}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("не удалось создать товар: %v", err)
+		}
+		itemIDs = append(itemIDs, item.ID)
+		if stock > 0 {
+			batch := models.StockBatch{NomenclatureID: item.ID, BranchID: branchID, Quantity: stock, RemainingQuantity: stock,
+				Unit: "g", Source: "adjustment"}
+			if err := db.Create(&batch).Error; err != nil {
+				t.Fatalf("не удалось создать партию: %v", err)
+			}
+		}
+		return &item.ID
+	}
+	newRecipe := func(name string, ingredients ...models.RecipeIngredient) {
+		t.Helper()
+		recipe := models.Recipe{Name: name, IsActive: true, PortionSize: 1, PhotoURLs: "[]", Ingredients: ingredients}
+		if err := db.Create(&recipe).Error; err != nil {
+			t.Fatalf("не удалось создать рецепт: %v", err)
+		}
+		recipeIDs = append(recipeIDs, recipe.ID)
+	}
+
+	flour := newItem("Мука", 1000)
+	mozzarella := newItem("Моцарелла", 0)
+	salami := newItem("Салями", 250)
+	margherita, pepperoni, unknown := "Маргарита "+suffix, "Пепперони "+suffix, "Без рецепта "+suffix
+	newRecipe(margherita,
+		models.RecipeIngredient{NomenclatureID: flour, Quantity: 200, Unit: "g"},
+		models.RecipeIngredient{NomenclatureID: mozzarella, Quantity: 150, Unit: "g"})
+	newRecipe(pepperoni,
+		models.RecipeIngredient{NomenclatureID: flour, Quantity: 200, Unit: "g"},
+		models.RecipeIngredient{NomenclatureID: salami, Quantity: 100, Unit: "g"})
+
+	pizzas, sets := models.GetAllPizzas(), models.GetAllSets()
+	models.SetPizzas(map[string]models.Pizza{
+		margherita: {Name: margherita, Price: 500},
+		pepperoni:  {Name: pepperoni, Price: 600},
+		unknown:    {Name: unknown, Price: 400},
+	})
+	models.SetSets(map[string]models.PizzaSet{
+		"Дуэт":   {Name: "Дуэт", Pizzas: []string{margherita, pepperoni}},
+		"Мясной": {Name: "Мясной", Pizzas: []string{pepperoni, pepperoni}},
+	})
+	t.Cleanup(func() {
+		models.SetPizzas(pizzas)
+		models.SetSets(sets)
+	})
+
+	ms := NewMenuService(db, nil)
+	ms.SetStockService(NewStockService(db))
+	availability, err := ms.GetMenuAvailability(branchID)
+	if err != nil {
+		t.Fatalf("GetMenuAvailability: %v", err)
+	}
+
+	if got := availability.Pizzas[margherita]; got.Available || got.MaxPortions != 0 ||
+		got.LimitingIngredient != "Моцарелла "+suffix || got.Reason == "" {
+		t.Errorf("Маргарита %+v, want недоступна из-за моцареллы", got)
+	}
+	// Муки на 5 пицц, салями на 2
+	if got := availability.Pizzas[pepperoni]; !got.Available || got.MaxPortions != 2 || got.LimitingIngredient != "Салями "+suffix {
+		t.Errorf("Пепперони %+v, want доступна, 2 порции, ограничивает салями", got)
+	}
+	if got := availability.Pizzas[unknown]; got.Available || got.Reason != "рецепт не найден" {
+		t.Errorf("пицца без рецепта %+v, want недоступна: рецепт не найден", got)
+	}
+	if got := availability.Sets["Дуэт"]; got.Available || got.LimitingIngredient != "Моцарелла "+suffix {
+		t.Errorf("набор с Маргаритой %+v, want недоступен", got)
+	}
+	if got := availability.Sets["Мясной"]; !got.Available || got.MaxPortions != 2 {
+		t.Errorf("набор из Пепперони %+v, want доступен", got)
+	}
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"zephyrvpn/server/internal/models"
+)
+
+// DefaultMenuMarginThreshold - маржа (в % от цены продажи), ниже которой позиция меню помечается как низкомаржинальная
+const DefaultMenuMarginThreshold = 30.0
+
+// MarginRow - себестоимость, цена продажи и маржа позиции меню
+type MarginRow struct {
+	MenuItemID    uint    `json:"menu_item_id"`
+	Kind          string  `json:"kind"` // pizza, extra
+	Name          string  `json:"name"`
+	RecipeID      string  `json:"recipe_id,omitempty"`
+	PrimeCost     float64 `json:"prime_cost"`      // Себестоимость по рецепту, руб
+	SellingPrice  float64 `json:"selling_price"`   // Цена в меню, руб
+	Margin        float64 `json:"margin"`          // Цена - себестоимость, руб
+	MarginPercent float64 `json:"margin_percent"`  // Маржа в % от цены продажи
+	LowMargin     bool    `json:"low_margin"`      // Маржа ниже порога (в том числе убыточные позиции)
+	Issue         string  `json:"issue,omitempty"` // Почему себестоимость не посчитана (нет рецепта, ошибка расчета)
+}
+
+// SetMenuMarginThreshold задает порог маржи (%) для пометки низкомаржинальных позиций меню
+func (s *StockService) SetMenuMarginThreshold(thresholdPercent float64) {
+	s.menuMarginThreshold = thresholdPercent
+}
+
+// GetMenuMarginReport возвращает себестоимость, цену и маржу всех активных позиций меню
+// Пиццы сопоставляются с рецептами по названию (как их создает UnifiedCreateMenuItem), допы - по recipe_id
+// Позиции без рецепта попадают в отчет с Issue, чтобы было видно, где себестоимость неизвестна
+// Сортировка по возрастанию маржи: сначала убыточные позиции
+func (s *StockService) GetMenuMarginReport() ([]MarginRow, error) {
+	threshold := s.menuMarginThreshold
+	if threshold <= 0 {
+		threshold = DefaultMenuMarginThreshold
+	}
+
+	var pizzas []models.PizzaRecipe
+	if err := s.db.Where("is_active = true").Find(&pizzas).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки меню: %w", err)
+	}
+	var extras []models.ExtraDB
+	if err := s.db.Where("is_active = true").Find(&extras).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки допов: %w", err)
+	}
+	var recipes []models.Recipe
+	if err := s.db.Where("is_active = true AND is_semi_finished = false").Find(&recipes).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки рецептов: %w", err)
+	}
+	recipeByName := make(map[string]string, len(recipes))
+	for _, recipe := range recipes {
+		recipeByName[strings.ToLower(strings.TrimSpace(recipe.Name))] = recipe.ID
+	}
+
+	rows := make([]MarginRow, 0, len(pizzas)+len(extras))
+	for _, pizza := range pizzas {
+		row := MarginRow{MenuItemID: pizza.ID, Kind: "pizza", Name: pizza.Name, SellingPrice: float64(pizza.Price)}
+		row.RecipeID = recipeByName[strings.ToLower(strings.TrimSpace(pizza.Name))]
+		rows = append(rows, s.fillMarginRow(row, threshold))
+	}
+	for _, extra := range extras {
+		row := MarginRow{MenuItemID: extra.ID, Kind: "extra", Name: extra.Name, SellingPrice: float64(extra.Price)}
+		if extra.RecipeID != nil {
+			row.RecipeID = *extra.RecipeID
+		} else if extra.NomenclatureID != nil {
+			// Простой доп без рецепта - себестоимость считается по отчету технолога, здесь пропускаем
+			continue
+		}
+		rows = append(rows, s.fillMarginRow(row, threshold))
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		// Позиции без себестоимости - в конце
+		if (rows[i].Issue == "") != (rows[j].Issue == "") {
+			return rows[i].Issue == ""
+		}
+		return rows[i].MarginPercent < rows[j].MarginPercent
+	})
+	return rows, nil
+}
+
+// fillMarginRow считает себестоимость позиции по рецепту и маржу
+func (s *StockService) fillMarginRow(row MarginRow, threshold float64) MarginRow {
+	if row.RecipeID == "" {
+		row.Issue = "Нет технологической карты"
+		return row
+	}
+
+	cost, err := s.CalculatePrimeCost(row.RecipeID)
+	if err != nil {
+		log.Printf("⚠️ GetMenuMarginReport: не удалось посчитать себестоимость '%s': %v", row.Name, err)
+		row.Issue = fmt.Sprintf("Ошибка расчета себестоимости: %v", err)
+		return row
+	}
+
+	row.PrimeCost, row.Margin, row.MarginPercent = calculateMargin(cost, row.SellingPrice)
+	row.LowMargin = row.MarginPercent < threshold
+	return row
+}
+
+// calculateMargin возвращает себестоимость, маржу и маржу в % от цены (округленные до копеек)
+// При нулевой цене маржа в процентах не определена и считается 0
+func calculateMargin(primeCost, sellingPrice float64) (float64, float64, float64) {
+	margin := sellingPrice - primeCost
+	marginPercent := 0.0
+	if sellingPrice > 0 {
+		marginPercent = margin / sellingPrice * 100
+	}
+	return roundTo(primeCost, 2), roundTo(margin, 2), roundTo(marginPercent, 2)
+}
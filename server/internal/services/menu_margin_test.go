@@ -0,0 +1,121 @@
+package services
+
+import (
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestCalculateMargin(t *testing.T) {
+	cases := []struct {
+		primeCost, sellingPrice                 float64
+		wantCost, wantMargin, wantMarginPercent float64
+	}{
+		{130, 500, 130, 370, 74},
+		{123.456, 450, 123.46, 326.54, 72.57},
+		{600, 500, 600, -100, -20}, // Убыточная позиция
+		{50, 0, 50, -50, 0},        // Без цены процент не определен
+	}
+	for _, tc := range cases {
+		cost, margin, marginPercent := calculateMargin(tc.primeCost, tc.sellingPrice)
+		if cost != tc.wantCost || margin != tc.wantMargin || marginPercent != tc.wantMarginPercent {
+			t.Errorf("calculateMargin(%v, %v) = %v, %v, %v; want %v, %v, %v", tc.primeCost, tc.sellingPrice,
+				cost, margin, marginPercent, tc.wantCost, tc.wantMargin, tc.wantMarginPercent)
+		}
+	}
+}
+
+// Позиция без рецепта попадает в отчет с Issue, без обращения к БД
+func TestFillMarginRowWithoutRecipe(t *testing.T) {
+	row := NewStockService(nil).fillMarginRow(MarginRow{Name: "Морс", SellingPrice: 150}, DefaultMenuMarginThreshold)
+	if row.Issue == "" || row.LowMargin || row.Margin != 0 {
+		t.Errorf("строка %+v, want Issue без расчета маржи", row)
+	}
+}
+
+// Маргарита: 200 г сыра по 650 руб/кг = 130 руб при цене 500 руб - маржа 370 руб (74%);
+// с порогом 80% она помечается как низкомаржинальная, убыточный доп идет первым, пицца без рецепта - последней
+func TestGetMenuMarginReport(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.Recipe{}, &models.RecipeIngredient{}, &models.PizzaRecipe{},
+		&models.ExtraDB{})
+	service := NewStockService(db)
+	suffix := uuid.New().String()[:8]
+
+	cheese := models.NomenclatureItem{SKU: "TEST-" + suffix, Name: "Сыр " + suffix, BaseUnit: "g", InboundUnit: "kg",
+		LastPrice: 650, IsActive: true}
+	if err := db.Create(&cheese).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	var recipeIDs []string
+	newRecipe := func(name string, grams float64) string {
+		t.Helper()
+		recipe := models.Recipe{Name: name, IsActive: true, PortionSize: 1, PhotoURLs: "[]",
+			Ingredients: []models.RecipeIngredient{{NomenclatureID: &cheese.ID, Quantity: grams, Unit: "g"}}}
+		if err := db.Create(&recipe).Error; err != nil {
+			t.Fatalf("не удалось создать рецепт: %v", err)
+		}
+		recipeIDs = append(recipeIDs, recipe.ID)
+		return recipe.ID
+	}
+	margherita := models.PizzaRecipe{Name: "Маргарита " + suffix, Price: 500, IsActive: true}
+	unknown := models.PizzaRecipe{Name: "Без карты " + suffix, Price: 400, IsActive: true}
+	extraRecipeID := newRecipe("Двойной сыр "+suffix, 100)
+	extra := models.ExtraDB{Name: "Двойной сыр " + suffix, Price: 50, RecipeID: &extraRecipeID, IsActive: true}
+	t.Cleanup(func() {
+		db.Where("id IN ?", []uint{margherita.ID, unknown.ID}).Delete(&models.PizzaRecipe{})
+		db.Where("id = ?", extra.ID).Delete(&models.ExtraDB{})
+		db.Where("recipe_id IN ?", recipeIDs).Delete(&models.RecipeIngredient{})
+		db.Unscoped().Where("id IN ?", recipeIDs).Delete(&models.Recipe{})
+		db.Unscoped().Where("id = ?", cheese.ID).Delete(&models.NomenclatureItem{})
+	})
+	// Рецепт пиццы сопоставляется по названию без учета регистра
+	margheritaRecipeID := newRecipe("маргарита "+suffix, 200)
+	for _, record := range []interface{}{&margherita, &unknown, &extra} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatalf("не удалось создать позицию меню: %v", err)
+		}
+	}
+
+	service.SetMenuMarginThreshold(80)
+	report, err := service.GetMenuMarginReport()
+	if err != nil {
+		t.Fatalf("GetMenuMarginReport: %v", err)
+	}
+	var ours []MarginRow
+	for _, row := range report {
+		if row.Name == margherita.Name || row.Name == unknown.Name || row.Name == extra.Name {
+			ours = append(ours, row)
+		}
+	}
+	if len(ours) != 3 {
+		t.Fatalf("строк %d, want 3: %+v", len(ours), ours)
+	}
+
+	wantExtra := MarginRow{MenuItemID: extra.ID, Kind: "extra", Name: extra.Name, RecipeID: extraRecipeID,
+		PrimeCost: 65, SellingPrice: 50, Margin: -15, MarginPercent: -30, LowMargin: true}
+	wantPizza := MarginRow{MenuItemID: margherita.ID, Kind: "pizza", Name: margherita.Name, RecipeID: margheritaRecipeID,
+		PrimeCost: 130, SellingPrice: 500, Margin: 370, MarginPercent: 74, LowMargin: true}
+	if ours[0] != wantExtra {
+		t.Errorf("первая строка %+v, want %+v", ours[0], wantExtra)
+	}
+	if ours[1] != wantPizza {
+		t.Errorf("вторая строка %+v, want %+v", ours[1], wantPizza)
+	}
+	if ours[2].Name != unknown.Name || ours[2].Issue == "" {
+		t.Errorf("последняя строка %+v, want позицию без рецепта с Issue", ours[2])
+	}
+
+	// С порогом по умолчанию (30%) маржа 74% не низкая
+	service.SetMenuMarginThreshold(0)
+	report, err = service.GetMenuMarginReport()
+	if err != nil {
+		t.Fatalf("GetMenuMarginReport: %v", err)
+	}
+	for _, row := range report {
+		if row.Name == margherita.Name && row.LowMargin {
+			t.Errorf("маржа 74%% при пороге %v помечена как низкая", DefaultMenuMarginThreshold)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"zephyrvpn/server/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidMenuOverride - запись меню филиала не прошла проверку (нет филиала, позиции или цена <= 0)
+var ErrInvalidMenuOverride = errors.New("неверная настройка меню филиала")
+
+// BranchMenu - меню витрины (ключ - название позиции)
+type BranchMenu struct {
+	Pizzas map[string]models.Pizza    `json:"pizzas"`
+	Extras map[string]models.Extra    `json:"extras"`
+	Sets   map[string]models.PizzaSet `json:"sets"`
+}
+
+// GlobalMenu возвращает общее меню (копию in-memory кэша)
+func GlobalMenu() *BranchMenu {
+	return &BranchMenu{
+		Pizzas: models.GetAllPizzas(),
+		Extras: models.GetAllExtras(),
+		Sets:   models.GetAllSets(),
+	}
+}
+
+// GetBranchMenu возвращает меню филиала: общее меню с примененными branch_menu_overrides
+// Пустой branchID - общее меню без изменений
+func (ms *MenuService) GetBranchMenu(branchID string) (*BranchMenu, error) {
+	menu := GlobalMenu()
+	if branchID == "" {
+		return menu, nil
+	}
+	overrides, err := ms.GetBranchMenuOverrides(branchID)
+	if err != nil {
+		return nil, err
+	}
+	applyMenuOverrides(menu, overrides)
+	return menu, nil
+}
+
+// applyMenuOverrides убирает скрытые позиции и подставляет цены филиала
+// Набор скрывается и тогда, когда скрыта хотя бы одна пицца из него: собрать его в филиале нельзя
+func applyMenuOverrides(menu *BranchMenu, overrides []models.BranchMenuOverride) {
+	hidden := make(map[string]bool)
+	for _, override := range overrides {
+		if !override.Available {
+			hidden[override.ItemName] = true
+			delete(menu.Pizzas, override.ItemName)
+			delete(menu.Extras, override.ItemName)
+			delete(menu.Sets, override.ItemName)
+			continue
+		}
+		if override.PriceOverride == nil {
+			continue
+		}
+		price := *override.PriceOverride
+		if pizza, ok := menu.Pizzas[override.ItemName]; ok {
+			pizza.Price = price
+			menu.Pizzas[override.ItemName] = pizza
+		}
+		if extra, ok := menu.Extras[override.ItemName]; ok {
+			extra.Price = price
+			menu.Extras[override.ItemName] = extra
+		}
+		if set, ok := menu.Sets[override.ItemName]; ok {
+			set.Price = price
+			menu.Sets[override.ItemName] = set
+		}
+	}
+
+	for name, set := range menu.Sets {
+		for _, pizza := range set.Pizzas {
+			if hidden[pizza] {
+				delete(menu.Sets, name)
+				break
+			}
+		}
+	}
+}
+
+// GetBranchMenuOverrides возвращает настройки меню филиала (по названию позиции)
+func (ms *MenuService) GetBranchMenuOverrides(branchID string) ([]models.BranchMenuOverride, error) {
+	overrides := make([]models.BranchMenuOverride, 0)
+	if err := ms.db.Where("branch_id = ?", branchID).Order("item_name").Find(&overrides).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки меню филиала: %w", err)
+	}
+	return overrides, nil
+}
+
+// SetBranchMenuOverride создает или заменяет настройку позиции в меню филиала (одна запись на филиал и позицию)
+// Позиция должна быть в общем меню; PriceOverride, если задан, - больше нуля
+func (ms *MenuService) SetBranchMenuOverride(override *models.BranchMenuOverride) error {
+	override.BranchID = strings.TrimSpace(override.BranchID)
+	override.ItemName = strings.TrimSpace(override.ItemName)
+	if override.BranchID == "" || override.ItemName == "" {
+		return fmt.Errorf("%w: branch_id и item_name обязательны", ErrInvalidMenuOverride)
+	}
+	if override.PriceOverride != nil && *override.PriceOverride <= 0 {
+		return fmt.Errorf("%w: цена должна быть больше нуля", ErrInvalidMenuOverride)
+	}
+	menu := GlobalMenu()
+	_, isPizza := menu.Pizzas[override.ItemName]
+	_, isExtra := menu.Extras[override.ItemName]
+	_, isSet := menu.Sets[override.ItemName]
+	if !isPizza && !isExtra && !isSet {
+		return fmt.Errorf("%w: позиции '%s' нет в меню", ErrInvalidMenuOverride, override.ItemName)
+	}
+
+	if err := ms.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "branch_id"}, {Name: "item_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"available", "price_override", "updated_at"}),
+	}).Create(override).Error; err != nil {
+		return fmt.Errorf("ошибка сохранения меню филиала: %w", err)
+	}
+	// При конфликте ID новой записи не сохранился - возвращаем существующую
+	return ms.db.Where("branch_id = ? AND item_name = ?", override.BranchID, override.ItemName).First(override).Error
+}
+
+// DeleteBranchMenuOverride удаляет настройку: позиция снова доступна в филиале по общей цене
+// Нет записи - gorm.ErrRecordNotFound
+func (ms *MenuService) DeleteBranchMenuOverride(id string) error {
+	result := ms.db.Where("id = ?", id).Delete(&models.BranchMenuOverride{})
+	if result.Error != nil {
+		return fmt.Errorf("ошибка удаления настройки меню филиала: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
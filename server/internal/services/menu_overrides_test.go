@@ -0,0 +1,136 @@
+package services
+
+import (
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// useTestMenu подменяет общее меню на время теста
+func useTestMenu(t *testing.T) {
+	t.Helper()
+	pizzas, extras, sets := models.GetAllPizzas(), models.GetAllExtras(), models.GetAllSets()
+	models.SetPizzas(map[string]models.Pizza{
+		"Маргарита":   {Name: "Маргарита", Price: 500},
+		"Пепперони":   {Name: "Пепперони", Price: 600},
+		"Четыре сыра": {Name: "Четыре сыра", Price: 700},
+	})
+	models.SetExtras(map[string]models.Extra{
+		"Сырный бортик": {ID: 1, Name: "Сырный бортик", Price: 100},
+	})
+	models.SetSets(map[string]models.PizzaSet{
+		"Дуэт":     {Name: "Дуэт", Pizzas: []string{"Маргарита", "Четыре сыра"}, Price: 1100},
+		"Классика": {Name: "Классика", Pizzas: []string{"Маргарита", "Пепперони"}, Price: 1000},
+	})
+	t.Cleanup(func() {
+		models.SetPizzas(pizzas)
+		models.SetExtras(extras)
+		models.SetSets(sets)
+	})
+}
+
+func TestApplyMenuOverridesHidesItemsAndAppliesPrice(t *testing.T) {
+	useTestMenu(t)
+	price := 550
+	overrides := []models.BranchMenuOverride{
+		{BranchID: "A", ItemName: "Четыре сыра", Available: false},
+		{BranchID: "A", ItemName: "Пепперони", Available: true, PriceOverride: &price},
+		{BranchID: "A", ItemName: "Сырный бортик", Available: true},
+	}
+
+	menu := GlobalMenu()
+	applyMenuOverrides(menu, overrides)
+
+	if _, ok := menu.Pizzas["Четыре сыра"]; ok {
+		t.Error("скрытая в филиале пицца осталась в меню")
+	}
+	if _, ok := menu.Sets["Дуэт"]; ok {
+		t.Error("набор со скрытой пиццей остался в меню")
+	}
+	if got := menu.Pizzas["Пепперони"].Price; got != 550 {
+		t.Errorf("цена Пепперони = %d, want 550 (цена филиала)", got)
+	}
+	if got := menu.Pizzas["Маргарита"].Price; got != 500 {
+		t.Errorf("цена Маргариты = %d, want 500 (общая)", got)
+	}
+	if got := menu.Extras["Сырный бортик"].Price; got != 100 {
+		t.Errorf("цена допа без цены филиала = %d, want 100", got)
+	}
+	if _, ok := menu.Sets["Классика"]; !ok {
+		t.Error("набор без скрытых пицц пропал из меню")
+	}
+
+	// Общее меню не изменилось
+	if _, ok := models.GetAllPizzas()["Четыре сыра"]; !ok {
+		t.Error("настройка филиала изменила общее меню")
+	}
+}
+
+func TestGetBranchMenuAppliesOverridesPerBranch(t *testing.T) {
+	db := newTestDB(t, &models.BranchMenuOverride{})
+	useTestMenu(t)
+	service := NewMenuService(db, nil)
+
+	branchA, branchB := uuid.New().String(), uuid.New().String()
+	t.Cleanup(func() {
+		db.Where("branch_id IN ?", []string{branchA, branchB}).Delete(&models.BranchMenuOverride{})
+	})
+
+	hidden := models.BranchMenuOverride{BranchID: branchA, ItemName: "Четыре сыра", Available: false}
+	if err := service.SetBranchMenuOverride(&hidden); err != nil {
+		t.Fatalf("SetBranchMenuOverride: %v", err)
+	}
+	price := 450
+	priced := models.BranchMenuOverride{BranchID: branchA, ItemName: "Маргарита", Available: true, PriceOverride: &price}
+	if err := service.SetBranchMenuOverride(&priced); err != nil {
+		t.Fatalf("SetBranchMenuOverride: %v", err)
+	}
+
+	menuA, err := service.GetBranchMenu(branchA)
+	if err != nil {
+		t.Fatalf("GetBranchMenu(A): %v", err)
+	}
+	if _, ok := menuA.Pizzas["Четыре сыра"]; ok {
+		t.Error("пицца, отключенная в филиале A, видна в его меню")
+	}
+	if got := menuA.Pizzas["Маргарита"].Price; got != 450 {
+		t.Errorf("цена Маргариты в филиале A = %d, want 450", got)
+	}
+
+	menuB, err := service.GetBranchMenu(branchB)
+	if err != nil {
+		t.Fatalf("GetBranchMenu(B): %v", err)
+	}
+	if _, ok := menuB.Pizzas["Четыре сыра"]; !ok {
+		t.Error("пицца, отключенная в филиале A, не видна в филиале B")
+	}
+	if got := menuB.Pizzas["Маргарита"].Price; got != 500 {
+		t.Errorf("цена Маргариты в филиале B = %d, want 500", got)
+	}
+
+	// Повторная запись заменяет настройку, а не дублирует ее
+	hidden.Available = true
+	if err := service.SetBranchMenuOverride(&hidden); err != nil {
+		t.Fatalf("SetBranchMenuOverride: %v", err)
+	}
+	overrides, err := service.GetBranchMenuOverrides(branchA)
+	if err != nil {
+		t.Fatalf("GetBranchMenuOverrides: %v", err)
+	}
+	if len(overrides) != 2 {
+		t.Fatalf("настроек филиала A: %d, want 2", len(overrides))
+	}
+	if menuA, err = service.GetBranchMenu(branchA); err != nil {
+		t.Fatalf("GetBranchMenu(A): %v", err)
+	}
+	if _, ok := menuA.Pizzas["Четыре сыра"]; !ok {
+		t.Error("пицца не вернулась в меню филиала A после включения")
+	}
+
+	unknown := models.BranchMenuOverride{BranchID: branchA, ItemName: "Гавайская", Available: false}
+	if err := service.SetBranchMenuOverride(&unknown); err == nil {
+		t.Error("настройка позиции, которой нет в меню, сохранилась")
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils/rediskeys"
+
+	"github.com/google/uuid"
+)
+
+// MenuReloadLockTTL - срок аренды перезагрузки меню: держатель должен успеть прочитать меню из БД и опубликовать снимок
+// Если инстанс упал, не отпустив аренду, она истечет сама
+const MenuReloadLockTTL = 15 * time.Second
+
+// menuReloadPollInterval - как часто инстансы без аренды проверяют, что перезагрузка завершена
+const menuReloadPollInterval = 200 * time.Millisecond
+
+// menuSnapshotClockSkew - допустимое расхождение часов инстансов при проверке свежести снимка
+const menuSnapshotClockSkew = 2 * time.Second
+
+// releaseMenuReloadLockScript удаляет аренду, только если она все еще принадлежит нам
+// (аренда могла истечь и достаться другому инстансу, пока мы читали БД)
+const releaseMenuReloadLockScript = `
+	if redis.call("GET", KEYS[1]) == ARGV[1] then
+		return redis.call("DEL", KEYS[1])
+	end
+	return 0
+`
+
+// menuSnapshot - меню, прочитанное из БД держателем аренды
+type menuSnapshot struct {
+	Pizzas    map[string]models.Pizza    `json:"pizzas"`
+	Sets      map[string]models.PizzaSet `json:"sets"`
+	Extras    map[string]models.Extra    `json:"extras"`
+	StartedAt time.Time                  `json:"started_at"` // Когда держатель начал читать БД
+}
+
+// reloadMenuShared перезагружает меню так, чтобы из БД читал только один инстанс:
+// держатель аренды (SET NX) вызывает LoadMenu и публикует снимок в Redis, остальные ждут освобождения
+// аренды и применяют снимок. Без Redis или при его ошибке меню читается из БД напрямую
+func (ms *MenuService) reloadMenuShared() error {
+	if ms.redisUtil == nil {
+		return ms.loadFromDB()
+	}
+
+	requestedAt := time.Now()
+	token := uuid.New().String()
+	acquired, err := ms.redisUtil.SetNX(rediskeys.MenuReloadLockKey, token, MenuReloadLockTTL)
+	if err != nil {
+		log.Printf("⚠️ Аренда перезагрузки меню недоступна, читаем БД напрямую: %v", err)
+		return ms.loadFromDB()
+	}
+
+	if acquired {
+		defer ms.releaseMenuReloadLock(token)
+		if err := ms.loadFromDB(); err != nil {
+			return err
+		}
+		ms.publishMenuSnapshot(requestedAt)
+		return nil
+	}
+
+	// Меню перезагружает другой инстанс - ждем, пока он отпустит аренду (не дольше ее срока)
+	deadline := requestedAt.Add(MenuReloadLockTTL)
+	for time.Now().Before(deadline) {
+		exists, err := ms.redisUtil.Exists(rediskeys.MenuReloadLockKey)
+		if err != nil || !exists {
+			break
+		}
+		time.Sleep(menuReloadPollInterval)
+	}
+
+	if ms.applyMenuSnapshot(requestedAt) {
+		log.Println("✅ Меню обновлено из снимка в Redis (перезагрузку из БД выполнил другой инстанс)")
+		return nil
+	}
+
+	// Снимка нет или он сделан до этого обновления - читаем БД сами
+	return ms.loadFromDB()
+}
+
+// publishMenuSnapshot сохраняет текущее меню в Redis для инстансов, ожидающих перезагрузку
+func (ms *MenuService) publishMenuSnapshot(startedAt time.Time) {
+	snapshot := menuSnapshot{
+		Pizzas:    models.GetAllPizzas(),
+		Sets:      models.GetAllSets(),
+		Extras:    models.GetAllExtras(),
+		StartedAt: startedAt,
+	}
+	// Снимок нужен только на время перезагрузки, но держим его до следующего fallback обновления
+	if err := ms.redisUtil.Set(rediskeys.MenuSnapshotKey, snapshot, 2*ms.updateInterval); err != nil {
+		log.Printf("⚠️ Не удалось сохранить снимок меню в Redis: %v", err)
+	}
+}
+
+// applyMenuSnapshot применяет снимок меню из Redis, если он прочитан из БД не раньше requestedAt
+// false - снимка нет, он не читается или устарел
+func (ms *MenuService) applyMenuSnapshot(requestedAt time.Time) bool {
+	var snapshot menuSnapshot
+	if err := ms.redisUtil.GetJSON(rediskeys.MenuSnapshotKey, &snapshot); err != nil {
+		return false
+	}
+	if snapshot.StartedAt.Before(requestedAt.Add(-menuSnapshotClockSkew)) {
+		return false
+	}
+
+	models.SetPizzas(snapshot.Pizzas)
+	models.SetSets(snapshot.Sets)
+	models.SetExtras(snapshot.Extras)
+
+	ms.mu.Lock()
+	ms.lastUpdate = time.Now()
+	ms.mu.Unlock()
+	return true
+}
+
+// releaseMenuReloadLock отпускает аренду перезагрузки, если она все еще наша
+func (ms *MenuService) releaseMenuReloadLock(token string) {
+	client := ms.redisUtil.GetClient()
+	if err := client.Eval(ms.redisUtil.Context(), releaseMenuReloadLockScript, []string{rediskeys.MenuReloadLockKey}, token).Err(); err != nil {
+		log.Printf("⚠️ Не удалось освободить аренду перезагрузки меню (истечет через %v): %v", MenuReloadLockTTL, err)
+	}
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils"
+	"zephyrvpn/server/internal/utils/rediskeys"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// newCountingMenuService - инстанс сервиса меню, у которого чтение из БД подменено счетчиком:
+// "БД" отдает Маргариту за price и отвечает не сразу, чтобы второй инстанс успел упереться в аренду
+func newCountingMenuService(redisUtil *utils.RedisClient, loads *int32, price int) *MenuService {
+	ms := NewMenuService(nil, redisUtil)
+	ms.loadFromDB = func() error {
+		atomic.AddInt32(loads, 1)
+		time.Sleep(300 * time.Millisecond)
+		models.SetPizzas(map[string]models.Pizza{"Маргарита": {Name: "Маргарита", Price: price}})
+		ms.mu.Lock()
+		ms.lastUpdate = time.Now() // Как в LoadMenu
+		ms.mu.Unlock()
+		return nil
+	}
+	return ms
+}
+
+// Два инстанса получают одно событие menu:update: из БД читает только держатель аренды,
+// второй применяет опубликованный снимок
+func TestReloadMenuSharedLoadsOnce(t *testing.T) {
+	redisUtil := newTestRedis(t)
+	useTestMenu(t)
+
+	var loads int32
+	instances := []*MenuService{
+		newCountingMenuService(redisUtil, &loads, 520),
+		newCountingMenuService(redisUtil, &loads, 520),
+	}
+	start := make(chan struct{})
+	errs := make([]error, len(instances))
+	var wg sync.WaitGroup
+	for i, ms := range instances {
+		wg.Add(1)
+		go func(i int, ms *MenuService) {
+			defer wg.Done()
+			<-start
+			errs[i] = ms.reloadMenuShared()
+		}(i, ms)
+	}
+	close(start)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("инстанс %d: reloadMenuShared: %v", i, err)
+		}
+	}
+	if got := atomic.LoadInt32(&loads); got != 1 {
+		t.Fatalf("чтений меню из БД %d, want 1", got)
+	}
+	if price := models.GetAllPizzas()["Маргарита"].Price; price != 520 {
+		t.Errorf("цена Маргариты %v, want 520 из перезагруженного меню", price)
+	}
+	for i, ms := range instances {
+		if ms.GetLastUpdate().IsZero() {
+			t.Errorf("инстанс %d не отметил обновление меню", i)
+		}
+	}
+	if locked, err := redisUtil.Exists(rediskeys.MenuReloadLockKey); err != nil || locked {
+		t.Errorf("аренда не отпущена после перезагрузки (exists=%v, err=%v)", locked, err)
+	}
+
+	// Аренда отпущена - следующее обновление снова читает БД
+	if err := instances[1].reloadMenuShared(); err != nil {
+		t.Fatalf("повторная перезагрузка: %v", err)
+	}
+	if got := atomic.LoadInt32(&loads); got != 2 {
+		t.Errorf("чтений меню из БД после второго обновления %d, want 2", got)
+	}
+}
+
+// Чужая аренда не удаляется при освобождении: она могла истечь и достаться другому инстансу
+func TestReleaseMenuReloadLockKeepsForeignLease(t *testing.T) {
+	redisUtil := newTestRedis(t)
+	ms := NewMenuService(nil, redisUtil)
+	if err := redisUtil.Set(rediskeys.MenuReloadLockKey, "other-instance", MenuReloadLockTTL); err != nil {
+		t.Fatalf("не удалось занять аренду: %v", err)
+	}
+	ms.releaseMenuReloadLock("our-token")
+	if locked, _ := redisUtil.Exists(rediskeys.MenuReloadLockKey); !locked {
+		t.Error("чужая аренда удалена")
+	}
+	ms.releaseMenuReloadLock("other-instance")
+	if locked, _ := redisUtil.Exists(rediskeys.MenuReloadLockKey); locked {
+		t.Error("аренда держателя не удалена")
+	}
+}
+
+// Без Redis или при его недоступности меню читается из БД напрямую, ошибка чтения возвращается
+func TestReloadMenuSharedWithoutRedis(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+
+	for name, redisUtil := range map[string]*utils.RedisClient{"без Redis": nil, "Redis недоступен": utils.NewRedisClient(client)} {
+		var loads int32
+		ms := NewMenuService(nil, redisUtil)
+		loadErr := errors.New("БД недоступна")
+		ms.loadFromDB = func() error {
+			atomic.AddInt32(&loads, 1)
+			return loadErr
+		}
+		if err := ms.reloadMenuShared(); !errors.Is(err, loadErr) {
+			t.Errorf("%s: ошибка %v, want ошибку чтения БД", name, err)
+		}
+		if loads != 1 {
+			t.Errorf("%s: чтений из БД %d, want 1", name, loads)
+		}
+	}
+}
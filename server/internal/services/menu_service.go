@@ -22,16 +22,20 @@ type MenuService struct {
 	lastUpdate    time.Time
 	updateInterval time.Duration
 	stopPubSub    chan struct{} // Канал для остановки Pub/Sub
+	stockService  *StockService // Для доступности меню по остаткам (может быть nil)
+	loadFromDB    func() error  // Чтение меню из БД при перезагрузке (LoadMenu; подменяется в тестах)
 }
 
 // NewMenuService создает новый сервис меню
 func NewMenuService(db *gorm.DB, redisUtil *utils.RedisClient) *MenuService {
-	return &MenuService{
+	ms := &MenuService{
 		db:             db,
 		redisUtil:      redisUtil,
 		updateInterval: 5 * time.Minute, // Fallback: обновляем каждые 5 минут
 		stopPubSub:     make(chan struct{}),
 	}
+	ms.loadFromDB = ms.LoadMenu
+	return ms
 }
 
 // getIngredientComposition формирует строку состава из ингредиентов
@@ -150,6 +154,7 @@ func (ms *MenuService) LoadMenu() error {
 			Ingredients:       ingredients, // Старые данные для обратной совместимости
 			IngredientAmounts: ingredientAmounts,
 			IngredientNames:   ingredientNames, // Динамические названия из номенклатуры
+			PrepSeconds:       pizzaRecipe.PrepSeconds,
 		}
 		
 		log.Printf("✅ Загружена пицца '%s': %d ингредиентов из номенклатуры", pizzaRecipe.Name, len(ingredientNames))
@@ -232,7 +237,7 @@ func (ms *MenuService) StartAutoReload() {
 		for {
 			select {
 			case <-ticker.C:
-				if err := ms.LoadMenu(); err != nil {
+				if err := ms.reloadMenuShared(); err != nil {
 					log.Printf("⚠️ Ошибка автообновления меню: %v", err)
 				}
 			case <-ms.stopPubSub:
@@ -269,7 +274,8 @@ func (ms *MenuService) startPubSubListener() {
 			}
 			if msg != nil {
 				log.Printf("🔔 Получено событие обновления меню из Redis: %s", msg.Payload)
-				if err := ms.LoadMenu(); err != nil {
+				// Событие получают все инстансы одновременно - из БД читает только держатель аренды
+				if err := ms.reloadMenuShared(); err != nil {
 					log.Printf("⚠️ Ошибка обновления меню по Pub/Sub: %v", err)
 				} else {
 					log.Println("✅ Меню обновлено мгновенно через Redis Pub/Sub")
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"zephyrvpn/server/internal/models"
+)
+
+// DefaultDuplicateNameThreshold - порог сходства названий, выше которого импортируемый товар считается возможным дубликатом
+const DefaultDuplicateNameThreshold = 0.85
+
+// normalizeNameForMatch приводит название к виду для сравнения:
+// нижний регистр, ё -> е, пунктуация -> пробелы, "40 %" -> "40%", слова отсортированы
+// "Моцарелла 40 %" и "моцарелла, 40%" дают одинаковый результат
+func normalizeNameForMatch(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r == 'ё':
+			b.WriteRune('е')
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '%':
+			b.WriteRune(r)
+		case r == ',' || r == '.':
+			// Десятичный разделитель: "2,5" и "2.5" - одно и то же
+			b.WriteRune('.')
+		default:
+			b.WriteRune(' ')
+		}
+	}
+
+	tokens := make([]string, 0)
+	for _, token := range strings.Fields(b.String()) {
+		token = strings.Trim(token, ".")
+		if token == "" {
+			continue
+		}
+		// Отдельно стоящий "%" приклеиваем к предыдущему числу
+		if token == "%" && len(tokens) > 0 {
+			tokens[len(tokens)-1] += "%"
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	return strings.Join(tokens, " ")
+}
+
+// nameSimilarity возвращает сходство нормализованных названий от 0 до 1 (1 - расстояние Левенштейна / длина)
+func nameSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	maxLen := len(ra)
+	if len(rb) > maxLen {
+		maxLen = len(rb)
+	}
+	if maxLen == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(maxLen)
+}
+
+// levenshtein считает расстояние редактирования (две строки матрицы вместо полной)
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(min(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// nameIndexEntry - существующий товар в индексе названий
+type nameIndexEntry struct {
+	ID         string
+	Name       string
+	SKU        string
+	normalized string
+	numbers    string
+}
+
+// productNameIndex - предварительный индекс существующих названий для быстрого поиска похожих
+// Кандидаты отбираются по общему префиксу слова (3 символа), Левенштейн считается только для них
+type productNameIndex struct {
+	entries  []nameIndexEntry
+	byPrefix map[string][]int
+}
+
+// newProductNameIndex строит индекс по существующим товарам
+func newProductNameIndex(items []models.NomenclatureItem) *productNameIndex {
+	idx := &productNameIndex{
+		entries:  make([]nameIndexEntry, 0, len(items)),
+		byPrefix: make(map[string][]int),
+	}
+	for _, item := range items {
+		normalized := normalizeNameForMatch(item.Name)
+		if normalized == "" {
+			continue
+		}
+		pos := len(idx.entries)
+		idx.entries = append(idx.entries, nameIndexEntry{
+			ID:         item.ID,
+			Name:       item.Name,
+			SKU:        item.SKU,
+			normalized: normalized,
+			numbers:    numericTokens(normalized),
+		})
+		for _, prefix := range tokenPrefixes(normalized) {
+			idx.byPrefix[prefix] = append(idx.byPrefix[prefix], pos)
+		}
+	}
+	return idx
+}
+
+// FindSimilar возвращает самый похожий существующий товар со сходством >= threshold
+func (idx *productNameIndex) FindSimilar(name string, threshold float64) (*nameIndexEntry, float64) {
+	normalized := normalizeNameForMatch(name)
+	if normalized == "" {
+		return nil, 0
+	}
+	normalizedLen := len([]rune(normalized))
+	numbers := numericTokens(normalized)
+
+	var best *nameIndexEntry
+	bestScore := 0.0
+	checked := make(map[int]bool)
+	for _, prefix := range tokenPrefixes(normalized) {
+		for _, pos := range idx.byPrefix[prefix] {
+			if checked[pos] {
+				continue
+			}
+			checked[pos] = true
+
+			entry := &idx.entries[pos]
+			// Разные числа ("Сыр 40%" и "Сыр 45%", "Мука 1кг" и "Мука 2кг") - разные товары
+			if entry.numbers != numbers {
+				continue
+			}
+			// Отсекаем кандидатов, которые не дотянут до порога по одной только разнице длин
+			entryLen := len([]rune(entry.normalized))
+			longer, shorter := entryLen, normalizedLen
+			if shorter > longer {
+				longer, shorter = shorter, longer
+			}
+			if float64(shorter)/float64(longer) < threshold {
+				continue
+			}
+
+			score := nameSimilarity(normalized, entry.normalized)
+			if score >= threshold && score > bestScore {
+				best, bestScore = entry, score
+			}
+		}
+	}
+	return best, bestScore
+}
+
+// tokenPrefixes возвращает уникальные префиксы слов (до 3 символов) для индекса
+func tokenPrefixes(normalized string) []string {
+	seen := make(map[string]bool)
+	prefixes := make([]string, 0)
+	for _, token := range strings.Fields(normalized) {
+		runes := []rune(token)
+		if len(runes) > 3 {
+			runes = runes[:3]
+		}
+		prefix := string(runes)
+		if !seen[prefix] {
+			seen[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// numericTokens возвращает слова с цифрами (жирность, вес, объем) - они должны совпадать у дубликатов
+func numericTokens(normalized string) string {
+	numbers := make([]string, 0)
+	for _, token := range strings.Fields(normalized) {
+		if strings.IndexFunc(token, unicode.IsDigit) >= 0 {
+			numbers = append(numbers, token)
+		}
+	}
+	return strings.Join(numbers, " ")
+}
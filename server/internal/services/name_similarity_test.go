@@ -0,0 +1,94 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+)
+
+func TestNormalizeNameForMatch(t *testing.T) {
+	cases := []struct {
+		a, b string
+	}{
+		{"Моцарелла 40 %", "моцарелла, 40%"},
+		{"Сметана 2,5%", "сметана 2.5%"},
+		{"Ёжевика свежая", "свежая ежевика"},
+		{"Сыр  (Пармезан)", "пармезан сыр"},
+	}
+	for _, tc := range cases {
+		if got, want := normalizeNameForMatch(tc.a), normalizeNameForMatch(tc.b); got != want {
+			t.Errorf("normalizeNameForMatch(%q) = %q, normalizeNameForMatch(%q) = %q; want одинаково", tc.a, got, tc.b, want)
+		}
+	}
+	if got := normalizeNameForMatch(" ,. "); got != "" {
+		t.Errorf("название из пунктуации нормализовано в %q, want пусто", got)
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	if got := nameSimilarity("", ""); got != 1 {
+		t.Errorf("сходство пустых строк = %v, want 1", got)
+	}
+	if got := nameSimilarity("сыр", "сыр"); got != 1 {
+		t.Errorf("сходство одинаковых строк = %v, want 1", got)
+	}
+	// Одна замена в 10 символах
+	if got := nameSimilarity("моцарелла1", "моцарелла2"); got != 0.9 {
+		t.Errorf("сходство = %v, want 0.9", got)
+	}
+	if got := levenshtein([]rune("котик"), []rune("скотина")); got != 3 {
+		t.Errorf("levenshtein(котик, скотина) = %d, want 3", got)
+	}
+}
+
+func TestProductNameIndexFindSimilar(t *testing.T) {
+	idx := newProductNameIndex([]models.NomenclatureItem{
+		{ID: "1", SKU: "MOZ-40", Name: "Моцарелла 40%"},
+		{ID: "2", SKU: "FLOUR-1", Name: "Мука пшеничная 1кг"},
+		{ID: "3", SKU: "EMPTY", Name: "..."},
+	})
+
+	cases := []struct {
+		name   string
+		wantID string
+	}{
+		{"моцарелла, 40 %", "1"},
+		{"Моцарела 40%", "1"},       // опечатка
+		{"Моцарелла 45%", ""},       // другая жирность - другой товар
+		{"Мука пшеничная 2кг", ""},  // другой вес
+		{"Пшеничная мука 1кг", "2"}, // другой порядок слов
+		{"Томаты", ""},
+		{"...", ""},
+	}
+	for _, tc := range cases {
+		match, score := idx.FindSimilar(tc.name, DefaultDuplicateNameThreshold)
+		gotID := ""
+		if match != nil {
+			gotID = match.ID
+			if score < DefaultDuplicateNameThreshold || score > 1 {
+				t.Errorf("FindSimilar(%q): сходство %v вне [порог, 1]", tc.name, score)
+			}
+		}
+		if gotID != tc.wantID {
+			t.Errorf("FindSimilar(%q) = %q (сходство %v), want %q", tc.name, gotID, score, tc.wantID)
+		}
+	}
+
+	// Порог 1 пропускает только совпадение после нормализации
+	if match, _ := idx.FindSimilar("Моцарела 40%", 1); match != nil {
+		t.Errorf("при пороге 1 найдено неточное совпадение %q", match.Name)
+	}
+}
+
+func BenchmarkProductNameIndexFindSimilar(b *testing.B) {
+	items := make([]models.NomenclatureItem, 10000)
+	for i := range items {
+		items[i] = models.NomenclatureItem{ID: fmt.Sprint(i), Name: fmt.Sprintf("Товар %d кг", i)}
+	}
+	idx := newProductNameIndex(items)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.FindSimilar("Товар 5000 кг", DefaultDuplicateNameThreshold)
+	}
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,11 +12,36 @@ import (
 	"time"
 )
 
+// Повторы и автомат защиты для запросов к Nixtla
+const (
+	nixtlaMaxAttempts     = 3               // Попыток на один прогноз (первая + 2 повтора)
+	nixtlaRetryBaseDelay  = 1 * time.Second // Задержка перед первым повтором, далее удваивается
+	nixtlaBreakerFailures = 3               // Прогнозов подряд с ошибкой до открытия автомата
+	nixtlaBreakerCooldown = 5 * time.Minute // Сколько не обращаемся к Nixtla после открытия автомата
+)
+
 // NixtlaClient клиент для работы с Nixtla API
 type NixtlaClient struct {
 	apiKey  string
 	baseURL string
 	client  *http.Client
+	breaker *CircuitBreaker
+	sleep   func(time.Duration) // Задержка между повторами
+}
+
+// nixtlaHTTPError - ответ Nixtla с кодом ошибки
+type nixtlaHTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *nixtlaHTTPError) Error() string {
+	return fmt.Sprintf("Nixtla API error (status %d): %s", e.StatusCode, e.Body)
+}
+
+// retryable - повторяем только временные ошибки: перегрузка (429) и ошибки сервера (5xx)
+func (e *nixtlaHTTPError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
 }
 
 // NewNixtlaClient создает новый клиент Nixtla
@@ -42,9 +68,16 @@ func NewNixtlaClient(apiKey string) *NixtlaClient {
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		breaker: NewCircuitBreaker(nixtlaBreakerFailures, nixtlaBreakerCooldown),
+		sleep:   time.Sleep,
 	}
 }
 
+// BreakerState возвращает состояние автомата защиты Nixtla (closed, open, half_open)
+func (nc *NixtlaClient) BreakerState() string {
+	return nc.breaker.State()
+}
+
 // TimeSeriesData представляет временной ряд для прогнозирования
 // Используется для внутренней обработки, перед отправкой преобразуется в формат Nixtla
 type TimeSeriesData struct {
@@ -114,18 +147,15 @@ func (nc *NixtlaClient) Forecast(req *ForecastRequest) (*ForecastResponse, error
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	// Создаем HTTP запрос - используем правильный endpoint /timegpt
+	// Используем правильный endpoint /timegpt
 	// Для TimeGPT-2 используется тот же endpoint, но другой baseURL (api-preview.nixtla.io)
 	url := fmt.Sprintf("%s/timegpt", nc.baseURL)
-	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	
+	// Nixtla недавно падала несколько раз подряд - не нагружаем ее до конца cool-down
+	if !nc.breaker.Allow() {
+		log.Printf("⛔ Nixtla: circuit breaker открыт, запрос не отправляется")
+		return nil, ErrCircuitOpen
 	}
-
-	// Устанавливаем заголовки - используем x-api-key вместо Bearer
-	httpReq.Header.Set("Content-Type", "application/json")
-	// Используем правильный формат авторизации: Authorization: Bearer <api_key>
-	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", nc.apiKey))
 	
 	// Логируем запрос для отладки (первые 500 символов)
 	if len(requestBody) > 0 {
@@ -138,32 +168,26 @@ func (nc *NixtlaClient) Forecast(req *ForecastRequest) (*ForecastResponse, error
 		log.Printf("📤 Nixtla: тело запроса (первые 500 символов): %s", requestPreview)
 	}
 
-	// Выполняем запрос
-	resp, err := nc.client.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Читаем ответ
-	body, err := io.ReadAll(resp.Body)
+	// Выполняем запрос с повторами
+	body, err := nc.postWithRetry(url, requestBody)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	// Проверяем статус код
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("❌ Nixtla API error (status %d): %s", resp.StatusCode, string(body))
-		// Логируем тело запроса для отладки (первые 500 символов)
-		if len(requestBody) > 0 {
+		var httpErr *nixtlaHTTPError
+		if errors.As(err, &httpErr) && !httpErr.retryable() {
+			// 4xx - ошибка в нашем запросе, Nixtla доступна: автомат не открываем
+			nc.breaker.RecordSuccess()
+			// Логируем тело запроса для отладки (первые 500 символов)
 			requestPreview := string(requestBody)
 			if len(requestPreview) > 500 {
 				requestPreview = requestPreview[:500] + "..."
 			}
 			log.Printf("📤 Nixtla: отправленный запрос (первые 500 символов): %s", requestPreview)
+		} else {
+			nc.breaker.RecordFailure()
+			log.Printf("❌ Nixtla: запрос не удался после %d попыток (circuit breaker: %s)", nixtlaMaxAttempts, nc.breaker.State())
 		}
-		return nil, fmt.Errorf("Nixtla API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, err
 	}
+	nc.breaker.RecordSuccess()
 
 	// Логируем сырой ответ API для отладки (первые 1000 символов)
 	rawResponsePreview := string(body)
@@ -231,6 +255,60 @@ func (nc *NixtlaClient) Forecast(req *ForecastRequest) (*ForecastResponse, error
 	return &forecastResp, nil
 }
 
+// postWithRetry отправляет запрос к Nixtla, повторяя временные ошибки с экспоненциальной задержкой (1с, 2с)
+// Ошибки клиента (4xx, кроме 429) не повторяются
+func (nc *NixtlaClient) postWithRetry(url string, requestBody []byte) ([]byte, error) {
+	var lastErr error
+	for attempt := 1; attempt <= nixtlaMaxAttempts; attempt++ {
+		if attempt > 1 {
+			delay := nixtlaRetryBaseDelay << (attempt - 2)
+			log.Printf("🔁 Nixtla: повтор %d/%d через %v (ошибка: %v)", attempt, nixtlaMaxAttempts, delay, lastErr)
+			nc.sleep(delay)
+		}
+
+		body, err := nc.post(url, requestBody)
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+
+		var httpErr *nixtlaHTTPError
+		if errors.As(err, &httpErr) && !httpErr.retryable() {
+			return nil, err
+		}
+	}
+	return nil, lastErr
+}
+
+// post выполняет один HTTP запрос к Nixtla
+func (nc *NixtlaClient) post(url string, requestBody []byte) ([]byte, error) {
+	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	// Используем правильный формат авторизации: Authorization: Bearer <api_key>
+	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", nc.apiKey))
+
+	resp, err := nc.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("❌ Nixtla API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, &nixtlaHTTPError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	return body, nil
+}
+
 // parseNixtlaTimestamp парсит timestamp от Nixtla API в разных форматах
 // API может возвращать даты в форматах:
 // - "YYYY-MM-DD HH:MM:SS" (например, "2016-01-14 00:00:00")
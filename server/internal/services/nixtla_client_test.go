@@ -0,0 +1,173 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2030, 1, 15, 12, 0, 0, 0, time.UTC)
+	cb := NewCircuitBreaker(2, time.Minute)
+	cb.now = func() time.Time { return now }
+
+	cb.RecordFailure()
+	if !cb.Allow() || cb.State() != CircuitClosed {
+		t.Fatalf("после 1 ошибки из 2: состояние %s, want closed", cb.State())
+	}
+	cb.RecordFailure()
+	if cb.Allow() || cb.State() != CircuitOpen {
+		t.Fatalf("после 2 ошибок подряд: состояние %s, want open", cb.State())
+	}
+
+	// Cool-down истек: пропускается ровно один пробный запрос
+	now = now.Add(time.Minute)
+	if cb.State() != CircuitHalfOpen || !cb.Allow() {
+		t.Fatalf("после cool-down: состояние %s, пробный запрос не пропущен", cb.State())
+	}
+	if cb.Allow() {
+		t.Error("второй запрос пропущен, пока пробный не завершен")
+	}
+	// Пробный запрос упал - автомат снова открыт на полный cool-down
+	cb.RecordFailure()
+	if cb.State() != CircuitOpen {
+		t.Fatalf("после ошибки пробного запроса: состояние %s, want open", cb.State())
+	}
+
+	now = now.Add(time.Minute)
+	if !cb.Allow() {
+		t.Fatal("пробный запрос после второго cool-down не пропущен")
+	}
+	cb.RecordSuccess()
+	if cb.State() != CircuitClosed || !cb.Allow() || !cb.Allow() {
+		t.Errorf("после успешного пробного запроса: состояние %s, want closed", cb.State())
+	}
+}
+
+// newTestNixtlaClient - клиент Nixtla на тестовом сервере; задержки между повторами записываются, а не ждутся
+func newTestNixtlaClient(t *testing.T, handler http.HandlerFunc) (*NixtlaClient, *[]time.Duration) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	delays := make([]time.Duration, 0)
+	client := &NixtlaClient{
+		apiKey:  "test-key",
+		baseURL: server.URL,
+		client:  server.Client(),
+		breaker: NewCircuitBreaker(nixtlaBreakerFailures, nixtlaBreakerCooldown),
+		sleep:   func(d time.Duration) { delays = append(delays, d) },
+	}
+	return client, &delays
+}
+
+func TestNixtlaForecastRetriesAndOpensBreaker(t *testing.T) {
+	var requests, failing atomic.Int32
+	failing.Store(1)
+	client, delays := newTestNixtlaClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() == 1 {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"timestamp": ["2030-01-16"], "value": [1000]}`)
+	})
+	now := time.Now()
+	client.breaker.now = func() time.Time { return now }
+	request := &ForecastRequest{Model: "timegpt-1", Freq: "D", H: 1}
+
+	// Каждый прогноз - nixtlaMaxAttempts попыток с задержками 1с, 2с
+	for i := 1; i <= nixtlaBreakerFailures; i++ {
+		if _, err := client.Forecast(request); err == nil {
+			t.Fatalf("прогноз %d: ошибка 503 не возвращена", i)
+		}
+	}
+	if got := requests.Load(); got != nixtlaBreakerFailures*nixtlaMaxAttempts {
+		t.Errorf("запросов %d, want %d", got, nixtlaBreakerFailures*nixtlaMaxAttempts)
+	}
+	if len(*delays) < 2 || (*delays)[0] != nixtlaRetryBaseDelay || (*delays)[1] != 2*nixtlaRetryBaseDelay {
+		t.Errorf("задержки между повторами %v, want 1s, 2s, ...", *delays)
+	}
+	if client.BreakerState() != CircuitOpen {
+		t.Fatalf("после %d неудачных прогнозов: автомат %s, want open", nixtlaBreakerFailures, client.BreakerState())
+	}
+
+	// Автомат открыт - Nixtla не вызывается
+	sent := requests.Load()
+	if _, err := client.Forecast(request); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("прогноз при открытом автомате: %v, want ErrCircuitOpen", err)
+	}
+	if requests.Load() != sent {
+		t.Error("при открытом автомате запрос ушел в Nixtla")
+	}
+
+	// Nixtla восстановилась, cool-down истек: пробный запрос закрывает автомат
+	failing.Store(0)
+	now = now.Add(nixtlaBreakerCooldown)
+	response, err := client.Forecast(request)
+	if err != nil {
+		t.Fatalf("пробный прогноз: %v", err)
+	}
+	if len(response.Value) != 1 || response.Value[0] != 1000 || client.BreakerState() != CircuitClosed {
+		t.Errorf("пробный прогноз %+v, автомат %s; want [1000], closed", response.Value, client.BreakerState())
+	}
+}
+
+// Ошибка в запросе (4xx) не повторяется и не открывает автомат: Nixtla доступна
+func TestNixtlaForecastDoesNotRetryClientErrors(t *testing.T) {
+	var requests atomic.Int32
+	client, delays := newTestNixtlaClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "bad request", http.StatusBadRequest)
+	})
+	request := &ForecastRequest{Model: "timegpt-1", Freq: "D", H: 1}
+
+	for i := 0; i < nixtlaBreakerFailures+1; i++ {
+		_, err := client.Forecast(request)
+		var httpErr *nixtlaHTTPError
+		if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadRequest {
+			t.Fatalf("прогноз %d: %v, want ошибка 400", i, err)
+		}
+	}
+	if got := requests.Load(); got != nixtlaBreakerFailures+1 || len(*delays) != 0 {
+		t.Errorf("запросов %d, повторов %d; want %d без повторов", got, len(*delays), nixtlaBreakerFailures+1)
+	}
+	if client.BreakerState() != CircuitClosed {
+		t.Errorf("автомат %s после ошибок 400, want closed", client.BreakerState())
+	}
+
+	// 429 - временная ошибка, повторяется
+	if !(&nixtlaHTTPError{StatusCode: http.StatusTooManyRequests}).retryable() {
+		t.Error("429 не считается временной ошибкой")
+	}
+}
+
+func TestLinearExtrapolationForecast(t *testing.T) {
+	// Выручка растет на 10₽ в день: 100, 110, ..., 190 (на входе в обратном порядке)
+	history := make([]TimeSeriesData, 0, 10)
+	for day := 9; day >= 0; day-- {
+		history = append(history, TimeSeriesData{DS: fmt.Sprintf("2030-01-%02d", day+1), Y: 100 + 10*float64(day)})
+	}
+	forecast := linearExtrapolationForecast(history, 2)
+	// Продолжение тренда: 200 + 210
+	if math.Abs(forecast.ForecastTotal-410) > 1e-9 || forecast.HistoricalAvg != 145 || forecast.Method != "linear_extrapolation" {
+		t.Errorf("прогноз %+v, want итог 410, среднее 145", forecast)
+	}
+	if forecast.RemainingHours != 48 || math.Abs(forecast.AverageHourly-410.0/48) > 1e-9 {
+		t.Errorf("часы %v, в час %v; want 48, %v", forecast.RemainingHours, forecast.AverageHourly, 410.0/48)
+	}
+	if forecast.Confidence >= CalculateConfidenceScore(2) {
+		t.Errorf("уверенность оценки по тренду %v не ниже уверенности AI %v", forecast.Confidence, CalculateConfidenceScore(2))
+	}
+
+	// Падающий тренд не уходит в отрицательную выручку
+	falling := []TimeSeriesData{{DS: "2030-01-01", Y: 300}, {DS: "2030-01-02", Y: 200}, {DS: "2030-01-03", Y: 100}}
+	if forecast := linearExtrapolationForecast(falling, 3); forecast.ForecastTotal != 0 {
+		t.Errorf("прогноз по падающему тренду %v, want 0", forecast.ForecastTotal)
+	}
+}
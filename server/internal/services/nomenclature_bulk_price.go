@@ -0,0 +1,129 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"zephyrvpn/server/internal/models"
+
+	"gorm.io/gorm/clause"
+)
+
+// BulkPriceUpdate - массовое изменение закупочной цены (LastPrice) товаров категории
+// Задается ровно одно из Percent (+10 = наценка 10%, -5 = скидка 5%) или Delta (фиксированная сумма в рублях)
+type BulkPriceUpdate struct {
+	CategoryID     string   `json:"category_id"`
+	Percent        *float64 `json:"percent"`
+	Delta          *float64 `json:"delta"`
+	CounterpartyID string   `json:"counterparty_id"` // Поставщик, поднявший цены (опционально, пишется в историю цен)
+	BranchID       string   `json:"branch_id"`       // Опционально, пишется в историю цен
+	DryRun         bool     `json:"dry_run"`         // Только рассчитать новые цены, ничего не сохранять
+}
+
+// BulkPriceChange - изменение цены одного товара
+type BulkPriceChange struct {
+	NomenclatureID string  `json:"nomenclature_id"`
+	Name           string  `json:"name"`
+	InboundUnit    string  `json:"inbound_unit"`
+	OldPrice       float64 `json:"old_price"`
+	NewPrice       float64 `json:"new_price"` // За InboundUnit, как last_price
+}
+
+// newBulkPrice рассчитывает новую цену товара, округленную до копеек
+func (u BulkPriceUpdate) newBulkPrice(oldPrice float64) decimal.Decimal {
+	price := decimal.NewFromFloat(oldPrice)
+	if u.Percent != nil {
+		return price.Mul(decimal.NewFromFloat(*u.Percent).Div(decimal.NewFromInt(100)).Add(decimal.NewFromInt(1))).Round(2)
+	}
+	return price.Add(decimal.NewFromFloat(*u.Delta)).Round(2)
+}
+
+// BulkUpdateCategoryPrices меняет LastPrice всех активных товаров категории в одной транзакции
+// и записывает каждую новую цену в историю цен. При DryRun только возвращает рассчитанные цены
+func (s *NomenclatureService) BulkUpdateCategoryPrices(update BulkPriceUpdate) ([]BulkPriceChange, error) {
+	if update.CategoryID == "" {
+		return nil, fmt.Errorf("category_id обязателен")
+	}
+	if (update.Percent == nil) == (update.Delta == nil) {
+		return nil, fmt.Errorf("укажите ровно одно из percent или delta")
+	}
+
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Блокируем товары, чтобы параллельное изменение цены не потерялось
+	var items []models.NomenclatureItem
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("category_id = ? AND is_active = true", update.CategoryID).
+		Order("name ASC").
+		Find(&items).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("ошибка загрузки товаров категории: %w", err)
+	}
+
+	changes := make([]BulkPriceChange, 0, len(items))
+	for _, item := range items {
+		newPrice := update.newBulkPrice(item.LastPrice)
+		if newPrice.IsNegative() {
+			tx.Rollback()
+			return nil, fmt.Errorf("новая цена товара '%s' отрицательная: %s", item.Name, newPrice.StringFixed(2))
+		}
+		changes = append(changes, BulkPriceChange{
+			NomenclatureID: item.ID,
+			Name:           item.Name,
+			InboundUnit:    item.InboundUnit,
+			OldPrice:       item.LastPrice,
+			NewPrice:       newPrice.InexactFloat64(),
+		})
+	}
+
+	if update.DryRun {
+		tx.Rollback()
+		return changes, nil
+	}
+
+	var counterpartyRef *string
+	if update.CounterpartyID != "" {
+		counterpartyRef = &update.CounterpartyID
+	}
+	priceDate := time.Now().UTC().Truncate(24 * time.Hour)
+
+	for _, change := range changes {
+		if err := tx.Model(&models.NomenclatureItem{}).
+			Where("id = ?", change.NomenclatureID).
+			Update("last_price", change.NewPrice).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("ошибка обновления цены товара '%s': %w", change.Name, err)
+		}
+
+		entry := models.PriceHistory{
+			NomenclatureID: change.NomenclatureID,
+			CounterpartyID: counterpartyRef,
+			BranchID:       update.BranchID,
+			Price:          change.NewPrice,
+			PriceDate:      priceDate,
+		}
+		// branch_id - uuid: без филиала пишем NULL, а не пустую строку
+		createQuery := tx
+		if update.BranchID == "" {
+			createQuery = createQuery.Omit("branch_id")
+		}
+		if err := createQuery.Create(&entry).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("ошибка записи истории цен товара '%s': %w", change.Name, err)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("ошибка коммита транзакции: %w", err)
+	}
+
+	log.Printf("💲 BulkUpdateCategoryPrices: категория %s, обновлено цен: %d", update.CategoryID, len(changes))
+	return changes, nil
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestNewBulkPrice(t *testing.T) {
+	percent := 10.0
+	delta := -2.5
+
+	if got := (BulkPriceUpdate{Percent: &percent}).newBulkPrice(123.45); got.StringFixed(2) != "135.80" {
+		t.Errorf("+10%% от 123.45 = %s, want 135.80", got.StringFixed(2))
+	}
+	if got := (BulkPriceUpdate{Delta: &delta}).newBulkPrice(100); got.StringFixed(2) != "97.50" {
+		t.Errorf("100 - 2.5 = %s, want 97.50", got.StringFixed(2))
+	}
+}
+
+func TestBulkUpdateCategoryPricesMarkup(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.PriceHistory{})
+	service := NewNomenclatureService(db)
+
+	categoryID := uuid.New().String()
+	prices := map[string]float64{"Моцарелла": 500, "Пармезан": 1234.5, "Сливки": 99.99}
+	want := map[string]float64{"Моцарелла": 550, "Пармезан": 1357.95, "Сливки": 109.99}
+
+	ids := make([]string, 0, len(prices))
+	for name, price := range prices {
+		item := models.NomenclatureItem{
+			SKU:        "TEST-" + uuid.New().String()[:8],
+			Name:       name,
+			CategoryID: &categoryID,
+			LastPrice:  price,
+			IsActive:   true,
+		}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("не удалось создать товар %s: %v", name, err)
+		}
+		ids = append(ids, item.ID)
+	}
+	t.Cleanup(func() {
+		db.Where("nomenclature_id IN ?", ids).Delete(&models.PriceHistory{})
+		db.Unscoped().Where("id IN ?", ids).Delete(&models.NomenclatureItem{})
+	})
+
+	percent := 10.0
+	changes, err := service.BulkUpdateCategoryPrices(BulkPriceUpdate{CategoryID: categoryID, Percent: &percent})
+	if err != nil {
+		t.Fatalf("BulkUpdateCategoryPrices: %v", err)
+	}
+	if len(changes) != len(prices) {
+		t.Fatalf("изменено %d товаров, want %d", len(changes), len(prices))
+	}
+
+	for _, id := range ids {
+		var item models.NomenclatureItem
+		if err := db.First(&item, "id = ?", id).Error; err != nil {
+			t.Fatalf("товар %s не найден: %v", id, err)
+		}
+		if item.LastPrice != want[item.Name] {
+			t.Errorf("%s: last_price = %.2f, want %.2f", item.Name, item.LastPrice, want[item.Name])
+		}
+
+		var history []models.PriceHistory
+		if err := db.Where("nomenclature_id = ?", id).Find(&history).Error; err != nil {
+			t.Fatalf("ошибка загрузки истории цен: %v", err)
+		}
+		if len(history) != 1 {
+			t.Errorf("%s: записей истории цен %d, want 1", item.Name, len(history))
+		} else if history[0].Price != want[item.Name] {
+			t.Errorf("%s: цена в истории %.2f, want %.2f", item.Name, history[0].Price, want[item.Name])
+		}
+	}
+}
@@ -4,10 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"mime/multipart"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -20,16 +20,30 @@ import (
 	"zephyrvpn/server/internal/models"
 )
 
+// ErrRestoreConflict - восстанавливаемая запись конфликтует с живой (тот же SKU или имя)
+var ErrRestoreConflict = errors.New("конфликт при восстановлении")
+
 type NomenclatureService struct {
 	db         *gorm.DB
 	pluService *PLUService // Для генерации SKU на основе PLU
 	uomService *UoMConversionService // Для получения правил конвертации
+	duplicateNameThreshold float64 // Порог сходства названий для предупреждения о дубликате при импорте
+	maxUploadBytes int64 // Максимальный размер файла импорта
 }
 
 func NewNomenclatureService(db *gorm.DB) *NomenclatureService {
 	return &NomenclatureService{
 		db:         db,
 		uomService: NewUoMConversionService(db), // Инициализируем сервис правил конвертации
+		duplicateNameThreshold: DefaultDuplicateNameThreshold,
+		maxUploadBytes: DefaultMaxUploadBytes,
+	}
+}
+
+// SetDuplicateNameThreshold задает порог сходства названий (0..1) для поиска дубликатов при импорте
+func (ns *NomenclatureService) SetDuplicateNameThreshold(threshold float64) {
+	if threshold > 0 && threshold <= 1 {
+		ns.duplicateNameThreshold = threshold
 	}
 }
 
@@ -44,9 +58,16 @@ func (ns *NomenclatureService) SetPLUService(pluService *PLUService) {
 }
 
 // GetAllItems возвращает все товары номенклатуры
-func (ns *NomenclatureService) GetAllItems() ([]models.NomenclatureItem, error) {
+// includeDeleted=true - вместе с удаленными (для поиска того, что можно восстановить)
+func (ns *NomenclatureService) GetAllItems(includeDeleted bool) ([]models.NomenclatureItem, error) {
 	var items []models.NomenclatureItem
-	if err := ns.db.Where("deleted_at IS NULL").Find(&items).Error; err != nil {
+	query := ns.db
+	if includeDeleted {
+		query = query.Unscoped()
+	} else {
+		query = query.Where("deleted_at IS NULL")
+	}
+	if err := query.Find(&items).Error; err != nil {
 		return nil, err
 	}
 	return items, nil
@@ -93,6 +114,21 @@ func (ns *NomenclatureService) CreateItem(item *models.NomenclatureItem) error {
 		}
 	}
 	
+	if item.PriceEntryUnit == "" {
+		item.PriceEntryUnit = models.PriceEntryUnitInbound
+	}
+	if !models.ValidPriceEntryUnit(item.PriceEntryUnit) {
+		return fmt.Errorf("неверный price_entry_unit '%s' (допустимо: inbound, base)", item.PriceEntryUnit)
+	}
+	
+	item.StorageZone = models.NormalizeStorageZone(item.StorageZone)
+	if item.StorageZone == "" {
+		item.StorageZone = models.StorageZoneDry
+	}
+	if !models.ValidStorageZone(item.StorageZone) {
+		return fmt.Errorf("неверная зона хранения '%s' (допустимо: %s)", item.StorageZone, strings.Join(models.StorageZones, ", "))
+	}
+	
 	// КРИТИЧЕСКИ ВАЖНО: Валидация и исправление конфликтов единиц измерения
 	// BaseUnit должен быть минимальной единицей (г/мл), а не крупной (кг/л) для правильной работы формул расчета стоимости
 	ns.validateAndFixUnitSettings(item)
@@ -133,6 +169,7 @@ func (ns *NomenclatureService) CreateItem(item *models.NomenclatureItem) error {
 			item.ConversionFactor, item.Name)
 	}
 	
+	item.Allergens = models.NormalizeAllergens(item.Allergens)
 	return ns.db.Create(item).Error
 }
 
@@ -161,6 +198,17 @@ func (ns *NomenclatureService) UpdateItem(id string, item *models.NomenclatureIt
 		}
 	}
 	
+	// Пустой price_entry_unit - поле не передано, не меняем
+	if item.PriceEntryUnit != "" && !models.ValidPriceEntryUnit(item.PriceEntryUnit) {
+		return fmt.Errorf("неверный price_entry_unit '%s' (допустимо: inbound, base)", item.PriceEntryUnit)
+	}
+	
+	// Пустая зона хранения - поле не передано, не меняем
+	item.StorageZone = models.NormalizeStorageZone(item.StorageZone)
+	if item.StorageZone != "" && !models.ValidStorageZone(item.StorageZone) {
+		return fmt.Errorf("неверная зона хранения '%s' (допустимо: %s)", item.StorageZone, strings.Join(models.StorageZones, ", "))
+	}
+	
 	// КРИТИЧЕСКИ ВАЖНО: Валидация и исправление конфликтов единиц измерения
 	// BaseUnit должен быть минимальной единицей (г/мл), а не крупной (кг/л) для правильной работы формул расчета стоимости
 	ns.validateAndFixUnitSettings(item)
@@ -200,6 +248,11 @@ func (ns *NomenclatureService) UpdateItem(id string, item *models.NomenclatureIt
 		}
 	}
 	
+	// nil - аллергены не переданы (не трогаем), пустой список - очистить
+	if item.Allergens != nil {
+		item.Allergens = models.NormalizeAllergens(item.Allergens)
+	}
+	
 	item.ID = id
 	return ns.db.Model(&existing).Updates(item).Error
 }
@@ -339,6 +392,32 @@ func (ns *NomenclatureService) DeleteItem(id string) error {
 	return ns.db.Where("id = ?", id).Delete(&models.NomenclatureItem{}).Error
 }
 
+// RestoreItem восстанавливает удаленный товар (очищает deleted_at)
+// Партии на складе ссылаются на товар по ID, поэтому после восстановления они снова видны в остатках
+// Если SKU уже занят живым товаром - ErrRestoreConflict
+func (ns *NomenclatureService) RestoreItem(id string) (*models.NomenclatureItem, error) {
+	var item models.NomenclatureItem
+	if err := ns.db.Unscoped().Where("id = ?", id).First(&item).Error; err != nil {
+		return nil, err
+	}
+	if !item.DeletedAt.Valid {
+		return &item, nil // Товар не удален - восстанавливать нечего
+	}
+
+	var live models.NomenclatureItem
+	if err := ns.db.Where("sku = ? AND id != ? AND deleted_at IS NULL", item.SKU, id).First(&live).Error; err == nil {
+		return nil, fmt.Errorf("%w: SKU '%s' уже используется товаром '%s'", ErrRestoreConflict, item.SKU, live.Name)
+	}
+
+	if err := ns.db.Unscoped().Model(&item).Update("deleted_at", nil).Error; err != nil {
+		return nil, fmt.Errorf("ошибка восстановления товара: %w", err)
+	}
+	item.DeletedAt = gorm.DeletedAt{}
+
+	log.Printf("♻️ Восстановлен товар номенклатуры %s (SKU: %s, ID: %s)", item.Name, item.SKU, item.ID)
+	return &item, nil
+}
+
 // generateBasicSKU генерирует базовый SKU на основе названия (fallback если PLU не найден)
 func (ns *NomenclatureService) generateBasicSKU(productName string) string {
 	// Нормализуем название
@@ -393,13 +472,15 @@ func min(a, b int) int {
 func (ns *NomenclatureService) ValidateImport(items []map[string]interface{}, fieldMapping map[string]string, autoCreateCategories bool) []models.ImportValidationResult {
 	results := make([]models.ImportValidationResult, 0, len(items))
 	
-	// Получаем все существующие SKU для проверки дубликатов
+	// Получаем все существующие SKU и названия для проверки дубликатов
 	var existingItems []models.NomenclatureItem
-	ns.db.Where("deleted_at IS NULL").Select("sku").Find(&existingItems)
+	ns.db.Where("deleted_at IS NULL").Select("id", "sku", "name").Find(&existingItems)
 	existingSKUs := make(map[string]bool)
 	for _, item := range existingItems {
 		existingSKUs[item.SKU] = true
 	}
+	// Индекс названий строим один раз: на файлах в 10k строк сравниваем только с кандидатами
+	nameIndex := newProductNameIndex(existingItems)
 	
 	// Получаем все существующие категории
 	var existingCategories []models.NomenclatureCategory
@@ -440,6 +521,7 @@ func (ns *NomenclatureService) ValidateImport(items []map[string]interface{}, fi
 			}
 		}
 		price := getFloatValue(row, "price")
+		storageZone, zoneWarning := importStorageZone(row)
 		
 		// Логирование первых 3 строк для отладки
 		if i < 3 {
@@ -451,6 +533,7 @@ func (ns *NomenclatureService) ValidateImport(items []map[string]interface{}, fi
 		result.Item["category"] = category
 		result.Item["unit"] = unit
 		result.Item["price"] = price
+		result.Item["storage_zone"] = storageZone
 		
 		// Валидация обязательных полей
 		if name == "" {
@@ -480,11 +563,24 @@ func (ns *NomenclatureService) ValidateImport(items []map[string]interface{}, fi
 			result.Warnings = append(result.Warnings, fmt.Sprintf("Неизвестная единица измерения: %s", unit))
 		}
 		
+		if zoneWarning != "" {
+			result.Warnings = append(result.Warnings, zoneWarning)
+		}
+		
 		// Проверка на дубликат SKU
 		if sku != "" && existingSKUs[sku] {
 			result.Warnings = append(result.Warnings, fmt.Sprintf("Дубликат SKU: товар с таким SKU уже существует"))
 		}
 		
+		// Проверка на похожее название ("Моцарелла 40%" и "Моцарелла 40 %" - один товар)
+		if name != "" {
+			if match, score := nameIndex.FindSimilar(name, ns.duplicateNameThreshold); match != nil && match.SKU != sku {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("Возможный дубликат: похож на товар '%s' (ID: %s, SKU: %s, сходство %.0f%%)",
+					match.Name, match.ID, match.SKU, score*100))
+				result.Item["suspected_duplicate_id"] = match.ID
+			}
+		}
+		
 		// Проверка категории
 		if category != "" && !existingCategoryNames[category] {
 			if autoCreateCategories {
@@ -597,6 +693,10 @@ func (ns *NomenclatureService) ProcessImport(items []map[string]interface{}, fie
 			}
 		}
 		price := getFloatValue(row, "price")
+		storageZone, zoneWarning := importStorageZone(row)
+		if zoneWarning != "" {
+			log.Printf("⚠️ Импорт номенклатуры, строка %d: %s", validationResult.Row, zoneWarning)
+		}
 		
 		// Пропускаем если нет обязательных полей
 		if name == "" || sku == "" {
@@ -635,7 +735,7 @@ func (ns *NomenclatureService) ProcessImport(items []map[string]interface{}, fie
 			ProductionUnit:   unit,
 			ConversionFactor: 1.0,
 			MinStockLevel:    0,
-			StorageZone:      "dry_storage",
+			StorageZone:      storageZone,
 			LastPrice:        price,
 			IsActive:         true,
 			CreatedAt:        now,
@@ -794,11 +894,18 @@ func (ns *NomenclatureService) ProcessImport(items []map[string]interface{}, fie
 // GetAllCategories возвращает все категории, включая пустые (без товаров)
 // ВАЖНО: Метод возвращает ВСЕ категории, независимо от наличия в них товаров
 // Это позволяет отделу закупок видеть все категории, даже если они еще пустые
-func (ns *NomenclatureService) GetAllCategories() ([]models.NomenclatureCategory, error) {
+// includeDeleted=true - вместе с удаленными категориями
+func (ns *NomenclatureService) GetAllCategories(includeDeleted bool) ([]models.NomenclatureCategory, error) {
 	var categories []models.NomenclatureCategory
 	// Загружаем все категории без фильтрации по наличию товаров
 	// Не используем JOIN с nomenclature_items, чтобы не отфильтровать пустые категории
-	if err := ns.db.Where("deleted_at IS NULL").Order("name ASC").Find(&categories).Error; err != nil {
+	query := ns.db
+	if includeDeleted {
+		query = query.Unscoped()
+	} else {
+		query = query.Where("deleted_at IS NULL")
+	}
+	if err := query.Order("name ASC").Find(&categories).Error; err != nil {
 		return nil, err
 	}
 	return categories, nil
@@ -811,6 +918,14 @@ func (ns *NomenclatureService) CreateCategory(category *models.NomenclatureCateg
 	if err := ns.db.Where("name = ? AND deleted_at IS NULL", category.Name).First(&existing).Error; err == nil {
 		return fmt.Errorf("категория с именем '%s' уже существует", category.Name)
 	}
+	strategy, ok := models.NormalizeDepletionStrategy(category.DepletionStrategy)
+	if !ok {
+		return fmt.Errorf("неизвестная стратегия списания '%s' (допустимо: fefo, fifo, lifo)", category.DepletionStrategy)
+	}
+	category.DepletionStrategy = strategy
+	if category.QuarantineHours < 0 {
+		return fmt.Errorf("quarantine_hours не может быть отрицательным")
+	}
 	return ns.db.Create(category).Error
 }
 
@@ -829,6 +944,18 @@ func (ns *NomenclatureService) UpdateCategory(id string, category *models.Nomenc
 		}
 	}
 	
+	// Пустая стратегия - не меняем (Updates пропускает нулевые поля)
+	if category.DepletionStrategy != "" {
+		strategy, ok := models.NormalizeDepletionStrategy(category.DepletionStrategy)
+		if !ok {
+			return fmt.Errorf("неизвестная стратегия списания '%s' (допустимо: fefo, fifo, lifo)", category.DepletionStrategy)
+		}
+		category.DepletionStrategy = strategy
+	}
+	if category.QuarantineHours < 0 {
+		return fmt.Errorf("quarantine_hours не может быть отрицательным")
+	}
+	
 	category.ID = id
 	return ns.db.Model(&existing).Updates(category).Error
 }
@@ -847,6 +974,45 @@ func (ns *NomenclatureService) DeleteCategory(id string) error {
 	return ns.db.Where("id = ?", id).Delete(&models.NomenclatureCategory{}).Error
 }
 
+// RestoreCategory восстанавливает удаленную категорию
+// Если имя уже занято живой категорией - ErrRestoreConflict
+func (ns *NomenclatureService) RestoreCategory(id string) (*models.NomenclatureCategory, error) {
+	var category models.NomenclatureCategory
+	if err := ns.db.Unscoped().Where("id = ?", id).First(&category).Error; err != nil {
+		return nil, err
+	}
+	if !category.DeletedAt.Valid {
+		return &category, nil
+	}
+
+	var live models.NomenclatureCategory
+	if err := ns.db.Where("name = ? AND id != ? AND deleted_at IS NULL", category.Name, id).First(&live).Error; err == nil {
+		return nil, fmt.Errorf("%w: категория с именем '%s' уже существует", ErrRestoreConflict, category.Name)
+	}
+
+	if err := ns.db.Unscoped().Model(&category).Update("deleted_at", nil).Error; err != nil {
+		return nil, fmt.Errorf("ошибка восстановления категории: %w", err)
+	}
+	category.DeletedAt = gorm.DeletedAt{}
+
+	log.Printf("♻️ Восстановлена категория номенклатуры %s (ID: %s)", category.Name, category.ID)
+	return &category, nil
+}
+
+// importStorageZone возвращает зону хранения строки импорта; пустая или неизвестная зона заменяется на
+// StorageZoneDry, для неизвестной возвращается текст предупреждения
+func importStorageZone(row map[string]interface{}) (string, string) {
+	raw := getStringValue(row, "storage_zone")
+	zone := models.NormalizeStorageZone(raw)
+	if zone == "" {
+		return models.StorageZoneDry, ""
+	}
+	if !models.ValidStorageZone(zone) {
+		return models.StorageZoneDry, fmt.Sprintf("Неизвестная зона хранения '%s', будет использована %s", raw, models.StorageZoneDry)
+	}
+	return zone, ""
+}
+
 // Helper functions
 func getStringValue(row map[string]interface{}, key string) string {
 	if key == "" {
@@ -890,48 +1056,56 @@ func getFloatValue(row map[string]interface{}, key string) float64 {
 }
 
 // ParseUploadedFile парсит загруженный файл (CSV или XLSX) и возвращает массив строк
-func (ns *NomenclatureService) ParseUploadedFile(file multipart.File, filename string) ([]map[string]interface{}, error) {
-	if strings.HasSuffix(strings.ToLower(filename), ".csv") {
-		return ns.parseCSVFile(file)
-	} else if strings.HasSuffix(strings.ToLower(filename), ".xlsx") || strings.HasSuffix(strings.ToLower(filename), ".xls") {
-		return ns.parseXLSXFile(file)
+// sheet - лист или именованный диапазон XLSX (пустой - определяется автоматически)
+// Формат определяется по содержимому (см. readUpload), а не по расширению
+func (ns *NomenclatureService) ParseUploadedFile(file io.Reader, filename string, sheet string) ([]map[string]interface{}, error) {
+	data, kind, err := ns.readUpload(file, filename)
+	if err != nil {
+		return nil, err
+	}
+	if kind == uploadKindCSV {
+		return ns.parseCSVFile(data)
 	}
-	return nil, fmt.Errorf("неподдерживаемый формат файла: %s. Используйте .csv или .xlsx", filename)
+	return ns.parseXLSXFile(data, sheet)
 }
 
 // DetectFileHeaders определяет заголовки файла и возвращает информацию о структуре
-// Возвращает: headerRowIndex, columnNames, sampleRows
-func (ns *NomenclatureService) DetectFileHeaders(file multipart.File, filename string) (int, []string, [][]string, error) {
-	if strings.HasSuffix(strings.ToLower(filename), ".csv") {
-		return ns.detectCSVHeaders(file)
-	} else if strings.HasSuffix(strings.ToLower(filename), ".xlsx") || strings.HasSuffix(strings.ToLower(filename), ".xls") {
-		return ns.detectXLSXHeaders(file)
-	}
-	return 0, nil, nil, fmt.Errorf("неподдерживаемый формат файла: %s", filename)
+// Для XLSX дополнительно возвращает список листов и именованных диапазонов, sheet - выбранный лист/диапазон
+func (ns *NomenclatureService) DetectFileHeaders(file io.Reader, filename string, sheet string) (*FileHeaders, error) {
+	data, kind, err := ns.readUpload(file, filename)
+	if err != nil {
+		return nil, err
+	}
+	if kind == uploadKindCSV {
+		headerRowIndex, columnNames, sampleRows, err := ns.detectCSVHeaders(data)
+		if err != nil {
+			return nil, err
+		}
+		return &FileHeaders{HeaderRowIndex: headerRowIndex, Columns: columnNames, SampleRows: sampleRows}, nil
+	}
+	return ns.detectXLSXHeaders(data, sheet)
 }
 
 // ParseFileWithMapping парсит файл используя маппинг колонок
 // columnMapping: map[systemField]fileColumnName (например: {"name": "Наименование", "sku": "Артикул"})
 // columns: список колонок из первого этапа (опционально, для точного соответствия)
 // headerRowIndex: индекс строки заголовков (опционально)
-func (ns *NomenclatureService) ParseFileWithMapping(file multipart.File, filename string, columnMapping map[string]string, columns []string, headerRowIndex int) ([]map[string]interface{}, error) {
-	if strings.HasSuffix(strings.ToLower(filename), ".csv") {
-		return ns.parseCSVWithMapping(file, columnMapping, columns)
-	} else if strings.HasSuffix(strings.ToLower(filename), ".xlsx") || strings.HasSuffix(strings.ToLower(filename), ".xls") {
-		return ns.parseXLSXWithMapping(file, columnMapping, columns, headerRowIndex)
+// sheet: лист или именованный диапазон XLSX из первого этапа (опционально)
+func (ns *NomenclatureService) ParseFileWithMapping(file io.Reader, filename string, columnMapping map[string]string, columns []string, headerRowIndex int, sheet string) ([]map[string]interface{}, error) {
+	data, kind, err := ns.readUpload(file, filename)
+	if err != nil {
+		return nil, err
+	}
+	if kind == uploadKindCSV {
+		return ns.parseCSVWithMapping(data, columnMapping, columns)
 	}
-	return nil, fmt.Errorf("неподдерживаемый формат файла: %s", filename)
+	return ns.parseXLSXWithMapping(data, columnMapping, columns, headerRowIndex, sheet)
 }
 
 // parseCSVFile парсит CSV файл с автоматическим определением разделителя и кодировки
-func (ns *NomenclatureService) parseCSVFile(file multipart.File) ([]map[string]interface{}, error) {
-	// Читаем весь файл в память для определения кодировки и разделителя
-	data, err := io.ReadAll(file)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка чтения файла: %w", err)
-	}
-	
+func (ns *NomenclatureService) parseCSVFile(data []byte) ([]map[string]interface{}, error) {
 	// Определяем кодировку и конвертируем в UTF-8
+	var err error
 	var utf8Data []byte
 	if !utf8.Valid(data) {
 		// Пробуем Windows-1251
@@ -1037,14 +1211,9 @@ func detectDelimiter(data []byte) rune {
 }
 
 // detectCSVHeaders определяет заголовки CSV файла
-func (ns *NomenclatureService) detectCSVHeaders(file multipart.File) (int, []string, [][]string, error) {
-	// Читаем весь файл
-	data, err := io.ReadAll(file)
-	if err != nil {
-		return 0, nil, nil, fmt.Errorf("ошибка чтения файла: %w", err)
-	}
-	
+func (ns *NomenclatureService) detectCSVHeaders(data []byte) (int, []string, [][]string, error) {
 	// Определяем кодировку
+	var err error
 	var utf8Data []byte
 	if !utf8.Valid(data) {
 		decoder := charmap.Windows1251.NewDecoder()
@@ -1117,61 +1286,25 @@ func (ns *NomenclatureService) detectCSVHeaders(file multipart.File) (int, []str
 	return headerRowIndex, columnNames, sampleRows, nil
 }
 
-// detectXLSXHeaders определяет заголовки XLSX файла
-func (ns *NomenclatureService) detectXLSXHeaders(file multipart.File) (int, []string, [][]string, error) {
-	data, err := io.ReadAll(file)
-	if err != nil {
-		return 0, nil, nil, fmt.Errorf("ошибка чтения файла: %w", err)
-	}
-	
+// detectXLSXHeaders определяет заголовки XLSX файла (на выбранном листе или в именованном диапазоне)
+func (ns *NomenclatureService) detectXLSXHeaders(data []byte, sheet string) (*FileHeaders, error) {
 	f, err := excelize.OpenReader(bytes.NewReader(data))
 	if err != nil {
-		return 0, nil, nil, fmt.Errorf("ошибка открытия XLSX файла: %w", err)
+		return nil, fmt.Errorf("ошибка открытия XLSX файла: %w", err)
 	}
 	defer f.Close()
 	
-	sheetName := f.GetSheetName(0)
-	if sheetName == "" {
-		return 0, nil, nil, fmt.Errorf("файл не содержит листов")
-	}
-	
-	// Читаем первые 10 строк
-	rows, err := f.GetRows(sheetName)
+	rows, selected, err := readXLSXRows(f, sheet)
 	if err != nil {
-		return 0, nil, nil, fmt.Errorf("ошибка чтения листа: %w", err)
+		return nil, err
 	}
 	
 	if len(rows) == 0 {
-		return 0, nil, nil, fmt.Errorf("файл пуст")
-	}
-	
-	// Ограничиваем до 10 строк для поиска заголовков
-	maxRows := 10
-	if len(rows) < maxRows {
-		maxRows = len(rows)
+		return nil, fmt.Errorf("файл пуст")
 	}
 	
-	// Ищем строку с заголовками
-	headerKeywords := []string{"наименование", "товар", "name", "sku", "артикул", "секция", "категория", "category", "единица", "unit", "цена", "price"}
-	headerRowIndex := 0
-	maxMatches := 0
-	
-	for i := 0; i < maxRows; i++ {
-		matches := 0
-		for _, cell := range rows[i] {
-			cellLower := strings.ToLower(strings.TrimSpace(cell))
-			for _, keyword := range headerKeywords {
-				if strings.Contains(cellLower, keyword) {
-					matches++
-					break
-				}
-			}
-		}
-		if matches > maxMatches {
-			maxMatches = matches
-			headerRowIndex = i
-		}
-	}
+	// Ищем строку с заголовками среди первых 10 строк
+	headerRowIndex, _ := findHeaderRow(rows)
 	
 	// Очищаем заголовки
 	headers := rows[headerRowIndex]
@@ -1187,16 +1320,19 @@ func (ns *NomenclatureService) detectXLSXHeaders(file multipart.File) (int, []st
 		sampleRows = append(sampleRows, rows[i])
 	}
 	
-	return headerRowIndex, columnNames, sampleRows, nil
+	return &FileHeaders{
+		HeaderRowIndex: headerRowIndex,
+		Columns:        columnNames,
+		SampleRows:     sampleRows,
+		Sheet:          selected,
+		Sheets:         f.GetSheetList(),
+		NamedRanges:    xlsxNamedRanges(f),
+	}, nil
 }
 
 // parseCSVWithMapping парсит CSV с использованием маппинга колонок
-func (ns *NomenclatureService) parseCSVWithMapping(file multipart.File, columnMapping map[string]string, knownColumns []string) ([]map[string]interface{}, error) {
-	data, err := io.ReadAll(file)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка чтения файла: %w", err)
-	}
-	
+func (ns *NomenclatureService) parseCSVWithMapping(data []byte, columnMapping map[string]string, knownColumns []string) ([]map[string]interface{}, error) {
+	var err error
 	var utf8Data []byte
 	if !utf8.Valid(data) {
 		decoder := charmap.Windows1251.NewDecoder()
@@ -1318,22 +1454,16 @@ func (ns *NomenclatureService) parseCSVWithMapping(file multipart.File, columnMa
 }
 
 // parseXLSXWithMapping парсит XLSX с использованием маппинга колонок
-func (ns *NomenclatureService) parseXLSXWithMapping(file multipart.File, columnMapping map[string]string, knownColumns []string, headerRowIndex int) ([]map[string]interface{}, error) {
-	data, err := io.ReadAll(file)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка чтения файла: %w", err)
-	}
-	
+func (ns *NomenclatureService) parseXLSXWithMapping(data []byte, columnMapping map[string]string, knownColumns []string, headerRowIndex int, sheet string) ([]map[string]interface{}, error) {
 	f, err := excelize.OpenReader(bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("ошибка открытия XLSX файла: %w", err)
 	}
 	defer f.Close()
 	
-	sheetName := f.GetSheetName(0)
-	rows, err := f.GetRows(sheetName)
+	rows, _, err := readXLSXRows(f, sheet)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка чтения листа: %w", err)
+		return nil, err
 	}
 	
 	if len(rows) == 0 {
@@ -1344,24 +1474,7 @@ func (ns *NomenclatureService) parseXLSXWithMapping(file multipart.File, columnM
 	detectedHeaderRowIndex := headerRowIndex
 	if headerRowIndex < 0 || headerRowIndex >= len(rows) {
 		// Если индекс не передан или неверный, ищем заголовки
-		headerKeywords := []string{"наименование", "товар", "name", "sku", "артикул", "секция", "категория", "category", "единица", "unit", "цена", "price"}
-		maxMatches := 0
-		for i := 0; i < len(rows) && i < 10; i++ {
-			matches := 0
-			for _, cell := range rows[i] {
-				cellLower := strings.ToLower(strings.TrimSpace(cell))
-				for _, keyword := range headerKeywords {
-					if strings.Contains(cellLower, keyword) {
-						matches++
-						break
-					}
-				}
-			}
-			if matches > maxMatches {
-				maxMatches = matches
-				detectedHeaderRowIndex = i
-			}
-		}
+		detectedHeaderRowIndex, _ = findHeaderRow(rows)
 	}
 	
 	// Создаем индекс колонок (используем известные колонки если они переданы)
@@ -1523,13 +1636,7 @@ func (ns *NomenclatureService) parseXLSXWithMapping(file multipart.File, columnM
 }
 
 // parseXLSXFile парсит XLSX файл
-func (ns *NomenclatureService) parseXLSXFile(file multipart.File) ([]map[string]interface{}, error) {
-	// Читаем весь файл в память
-	data, err := io.ReadAll(file)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка чтения файла: %w", err)
-	}
-	
+func (ns *NomenclatureService) parseXLSXFile(data []byte, sheet string) ([]map[string]interface{}, error) {
 	// Excelize работает с bytes.Reader
 	f, err := excelize.OpenReader(bytes.NewReader(data))
 	if err != nil {
@@ -1537,16 +1644,10 @@ func (ns *NomenclatureService) parseXLSXFile(file multipart.File) ([]map[string]
 	}
 	defer f.Close()
 	
-	// Получаем имя первого листа
-	sheetName := f.GetSheetName(0)
-	if sheetName == "" {
-		return nil, fmt.Errorf("файл не содержит листов")
-	}
-	
-	// Читаем все строки с первого листа
-	rows, err := f.GetRows(sheetName)
+	// Читаем все строки выбранного листа (по умолчанию - первый лист с каталогом)
+	rows, _, err := readXLSXRows(f, sheet)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка чтения листа: %w", err)
+		return nil, err
 	}
 	
 	if len(rows) == 0 {
@@ -1618,6 +1719,7 @@ func normalizeUnit(unit string) string {
 	// Маппинг русских единиц на стандартные
 	unitMap := map[string]string{
 		"гр.":        "g",
+		"гр":         "g", // "гр." после отбрасывания точки ниже
 		"г":          "g",
 		"грамм":      "g",
 		"граммы":     "g",
@@ -1666,3 +1768,20 @@ func normalizeUnit(unit string) string {
 	return unit
 }
 
+// GetPriceHistory возвращает историю закупочных цен товара (новые первыми)
+// counterpartyID - фильтр по поставщику (пустой - все поставщики)
+func (s *NomenclatureService) GetPriceHistory(nomenclatureID, counterpartyID string, limit int) ([]models.PriceHistory, error) {
+	query := s.db.Where("nomenclature_id = ?", nomenclatureID)
+	if counterpartyID != "" {
+		query = query.Where("counterparty_id = ?", counterpartyID)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	history := make([]models.PriceHistory, 0)
+	if err := query.Order("price_date DESC, created_at DESC").Find(&history).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки истории цен: %w", err)
+	}
+	return history, nil
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestImportStorageZone(t *testing.T) {
+	cases := []struct {
+		raw, want string
+		warning   bool
+	}{
+		{"", models.StorageZoneDry, false},
+		{" Freezer ", models.StorageZoneFreezer, false},
+		{"fridge", models.StorageZoneFridge, false},
+		{"подвал", models.StorageZoneDry, true},
+	}
+	for _, tc := range cases {
+		zone, warning := importStorageZone(map[string]interface{}{"storage_zone": tc.raw})
+		if zone != tc.want || (warning != "") != tc.warning {
+			t.Errorf("importStorageZone(%q) = %q, %q; want %q, предупреждение %v", tc.raw, zone, warning, tc.want, tc.warning)
+		}
+	}
+}
+
+// Неизвестная зона отклоняется при создании и изменении, пустая - зона по умолчанию / без изменений
+func TestNomenclatureStorageZoneValidation(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.NomenclatureCategory{})
+	service := NewNomenclatureService(db)
+
+	invalid := &models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: "Лед", BaseUnit: "g", InboundUnit: "kg", StorageZone: "cellar"}
+	if err := service.CreateItem(invalid); err == nil {
+		db.Unscoped().Where("id = ?", invalid.ID).Delete(&models.NomenclatureItem{})
+		t.Fatal("CreateItem с зоной 'cellar' прошел, want ошибку")
+	}
+
+	item := &models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: "Мука", BaseUnit: "g", InboundUnit: "kg", IsActive: true}
+	if err := service.CreateItem(item); err != nil {
+		t.Fatalf("CreateItem: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+	})
+	if item.StorageZone != models.StorageZoneDry {
+		t.Errorf("зона по умолчанию = %q, want %q", item.StorageZone, models.StorageZoneDry)
+	}
+
+	update := &models.NomenclatureItem{SKU: item.SKU, Name: item.Name, BaseUnit: "g", InboundUnit: "kg", StorageZone: "cellar"}
+	if err := service.UpdateItem(item.ID, update); err == nil {
+		t.Error("UpdateItem с зоной 'cellar' прошел, want ошибку")
+	}
+	update.StorageZone = "Fridge"
+	if err := service.UpdateItem(item.ID, update); err != nil {
+		t.Fatalf("UpdateItem: %v", err)
+	}
+	stored, err := service.GetItemByID(item.ID)
+	if err != nil {
+		t.Fatalf("GetItemByID: %v", err)
+	}
+	if stored.StorageZone != models.StorageZoneFridge {
+		t.Errorf("зона после обновления = %q, want %q", stored.StorageZone, models.StorageZoneFridge)
+	}
+}
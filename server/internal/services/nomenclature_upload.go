@@ -0,0 +1,109 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultMaxUploadBytes - максимальный размер файла импорта номенклатуры по умолчанию (20 МБ)
+const DefaultMaxUploadBytes int64 = 20 << 20
+
+// ErrUploadTooLarge - файл импорта больше допустимого размера
+var ErrUploadTooLarge = errors.New("файл слишком большой")
+
+// ErrUnsupportedUploadContent - содержимое файла не CSV и не XLSX (независимо от расширения)
+var ErrUnsupportedUploadContent = errors.New("содержимое файла не является CSV или XLSX")
+
+// uploadKind - формат файла импорта, определенный по содержимому
+type uploadKind int
+
+const (
+	uploadKindCSV uploadKind = iota
+	uploadKindXLSX
+)
+
+// uploadSniffLen - сколько байт смотреть при определении текстового формата (как http.DetectContentType)
+const uploadSniffLen = 512
+
+// SetMaxUploadSize задает максимальный размер файла импорта в байтах (0 и меньше - значение по умолчанию)
+func (ns *NomenclatureService) SetMaxUploadSize(maxBytes int64) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxUploadBytes
+	}
+	ns.maxUploadBytes = maxBytes
+}
+
+// MaxUploadSize возвращает максимальный размер файла импорта в байтах
+func (ns *NomenclatureService) MaxUploadSize() int64 {
+	if ns.maxUploadBytes <= 0 {
+		return DefaultMaxUploadBytes
+	}
+	return ns.maxUploadBytes
+}
+
+// readUpload читает файл импорта не больше MaxUploadSize байт и определяет формат по содержимому:
+// XLSX - zip-архив OOXML с книгой (xl/), CSV - текст без управляющих символов.
+// Расширение должно быть .csv/.xlsx/.xls, но решает содержимое: переименованный бинарный файл отклоняется
+func (ns *NomenclatureService) readUpload(file io.Reader, filename string) ([]byte, uploadKind, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv", ".xlsx", ".xls":
+	default:
+		return nil, 0, fmt.Errorf("неподдерживаемый формат файла: %s. Используйте .csv или .xlsx", filename)
+	}
+
+	// Читаем на байт больше лимита: так превышение видно без чтения всего файла
+	maxBytes := ns.MaxUploadSize()
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		return nil, 0, fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, 0, fmt.Errorf("%w: больше %d МБ", ErrUploadTooLarge, maxBytes>>20)
+	}
+
+	kind, err := sniffUpload(data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %s (%v)", ErrUnsupportedUploadContent, filename, err)
+	}
+	return data, kind, nil
+}
+
+// sniffUpload определяет формат файла импорта по содержимому
+func sniffUpload(data []byte) (uploadKind, error) {
+	if len(data) == 0 {
+		return 0, fmt.Errorf("файл пустой")
+	}
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return 0, fmt.Errorf("поврежденный zip-архив: %w", err)
+		}
+		var hasContentTypes, hasWorkbook bool
+		for _, entry := range archive.File {
+			hasContentTypes = hasContentTypes || entry.Name == "[Content_Types].xml"
+			hasWorkbook = hasWorkbook || strings.HasPrefix(entry.Name, "xl/")
+		}
+		if !hasContentTypes || !hasWorkbook {
+			return 0, fmt.Errorf("zip-архив не является книгой XLSX")
+		}
+		return uploadKindXLSX, nil
+	}
+	if bytes.HasPrefix(data, []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1")) {
+		return 0, fmt.Errorf("старый формат Excel (.xls) не поддерживается, сохраните файл как .xlsx")
+	}
+	// Текст в UTF-8 или Windows-1251: DetectContentType отличает его от бинарных данных по управляющим символам
+	sniff := data
+	if len(sniff) > uploadSniffLen {
+		sniff = sniff[:uploadSniffLen]
+	}
+	if contentType := http.DetectContentType(sniff); !strings.HasPrefix(contentType, "text/plain") {
+		return 0, fmt.Errorf("обнаружен тип %s", contentType)
+	}
+	return uploadKindCSV, nil
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestReadUploadRejectsOversizedFile(t *testing.T) {
+	service := NewNomenclatureService(nil)
+	service.SetMaxUploadSize(1 << 10)
+
+	csv := "Наименование;Цена\n" + strings.Repeat("Мука;100\n", 200)
+	_, err := service.DetectFileHeaders(strings.NewReader(csv), "price.csv", "")
+	if !errors.Is(err, ErrUploadTooLarge) {
+		t.Fatalf("DetectFileHeaders(%d байт при лимите 1 КБ): err = %v, want ErrUploadTooLarge", len(csv), err)
+	}
+
+	// Файл в пределах лимита разбирается как обычно
+	detected, err := service.DetectFileHeaders(strings.NewReader("Наименование;Цена\nМука;100\n"), "price.csv", "")
+	if err != nil {
+		t.Fatalf("DetectFileHeaders: %v", err)
+	}
+	if len(detected.Columns) != 2 {
+		t.Errorf("колонки = %v, want 2", detected.Columns)
+	}
+}
+
+func TestReadUploadSniffsContentInsteadOfExtension(t *testing.T) {
+	service := NewNomenclatureService(nil)
+
+	// Исполняемый файл, переименованный в .csv и .xlsx
+	binary := append([]byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff"), bytes.Repeat([]byte{0}, 64)...)
+	for _, name := range []string{"price.csv", "price.xlsx"} {
+		if _, err := service.DetectFileHeaders(bytes.NewReader(binary), name, ""); !errors.Is(err, ErrUnsupportedUploadContent) {
+			t.Errorf("%s: err = %v, want ErrUnsupportedUploadContent", name, err)
+		}
+	}
+	// zip-архив, который не является книгой Excel
+	if _, err := service.DetectFileHeaders(strings.NewReader("PK\x03\x04not a workbook"), "price.xlsx", ""); !errors.Is(err, ErrUnsupportedUploadContent) {
+		t.Errorf("zip без книги: err = %v, want ErrUnsupportedUploadContent", err)
+	}
+
+	// Настоящая книга XLSX, сохраненная с расширением .csv, разбирается как XLSX
+	book := excelize.NewFile()
+	book.SetSheetRow("Sheet1", "A1", &[]interface{}{"Наименование", "Цена"})
+	book.SetSheetRow("Sheet1", "A2", &[]interface{}{"Мука", 100})
+	var buf bytes.Buffer
+	if err := book.Write(&buf); err != nil {
+		t.Fatalf("не удалось записать книгу: %v", err)
+	}
+	detected, err := service.DetectFileHeaders(bytes.NewReader(buf.Bytes()), "price.csv", "")
+	if err != nil {
+		t.Fatalf("XLSX с расширением .csv: %v", err)
+	}
+	if len(detected.Columns) != 2 || detected.Columns[0] != "Наименование" {
+		t.Errorf("колонки = %v, want [Наименование Цена]", detected.Columns)
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+)
+
+// ErrNomenclatureInUse - товар входит в активные рецепты или лежит на складе; удаление без force запрещено
+var ErrNomenclatureInUse = errors.New("товар используется")
+
+// NomenclatureUsage - где используется товар номенклатуры
+type NomenclatureUsage struct {
+	NomenclatureID string               `json:"nomenclature_id"`
+	Recipes        []NomenclatureRecipe `json:"recipes"`
+	Batches        []NomenclatureBatch  `json:"batches"`
+}
+
+// NomenclatureRecipe - активный рецепт, в который товар входит ингредиентом
+type NomenclatureRecipe struct {
+	RecipeID       string  `json:"recipe_id"`
+	RecipeName     string  `json:"recipe_name"`
+	IsSemiFinished bool    `json:"is_semi_finished"`
+	Quantity       float64 `json:"quantity"` // Количество товара на порцию
+	Unit           string  `json:"unit"`
+}
+
+// NomenclatureBatch - партия товара с ненулевым остатком
+type NomenclatureBatch struct {
+	BatchID           string     `json:"batch_id"`
+	BranchID          string     `json:"branch_id"`
+	RemainingQuantity float64    `json:"remaining_quantity"`
+	Unit              string     `json:"unit"`
+	ExpiryAt          *time.Time `json:"expiry_at,omitempty"`
+}
+
+// InUse сообщает, что удаление товара сломает рецепты или оставит остатки без карточки
+func (u *NomenclatureUsage) InUse() bool {
+	return len(u.Recipes) > 0 || len(u.Batches) > 0
+}
+
+// GetItemUsage возвращает активные рецепты (по ингредиентам recipe_ingredients) и живые партии, ссылающиеся на товар
+// Товар не найден - gorm.ErrRecordNotFound
+func (ns *NomenclatureService) GetItemUsage(id string) (*NomenclatureUsage, error) {
+	var item models.NomenclatureItem
+	if err := ns.db.Select("id").Where("id = ?", id).First(&item).Error; err != nil {
+		return nil, err
+	}
+
+	usage := &NomenclatureUsage{
+		NomenclatureID: id,
+		Recipes:        make([]NomenclatureRecipe, 0),
+		Batches:        make([]NomenclatureBatch, 0),
+	}
+	if err := ns.db.Table("recipe_ingredients AS ri").
+		Select("r.id AS recipe_id, r.name AS recipe_name, r.is_semi_finished, ri.quantity, ri.unit").
+		Joins("JOIN recipes r ON r.id = ri.recipe_id AND r.deleted_at IS NULL").
+		Where("ri.nomenclature_id = ? AND r.is_active = ?", id, true).
+		Order("r.name").
+		Scan(&usage.Recipes).Error; err != nil {
+		return nil, fmt.Errorf("ошибка поиска рецептов с товаром: %w", err)
+	}
+	if err := ns.db.Model(&models.StockBatch{}).
+		Select("id AS batch_id, branch_id, remaining_quantity, unit, expiry_at").
+		Where("nomenclature_id = ? AND remaining_quantity > 0 AND is_expired = ?", id, false).
+		Order("created_at").
+		Scan(&usage.Batches).Error; err != nil {
+		return nil, fmt.Errorf("ошибка поиска партий товара: %w", err)
+	}
+	return usage, nil
+}
+
+// DeleteItemChecked удаляет товар (мягко), если он не используется. Используемый товар без force не удаляется:
+// возвращаются места использования и ErrNomenclatureInUse. force удаляет товар несмотря на ссылки:
+// рецепты и партии не меняются, их нужно поправить вручную
+func (ns *NomenclatureService) DeleteItemChecked(id string, force bool) (*NomenclatureUsage, error) {
+	usage, err := ns.GetItemUsage(id)
+	if err != nil {
+		return nil, err
+	}
+	if usage.InUse() {
+		if !force {
+			return usage, fmt.Errorf("%w: рецептов %d, партий с остатком %d", ErrNomenclatureInUse, len(usage.Recipes), len(usage.Batches))
+		}
+		log.Printf("⚠️ Товар %s удален принудительно: рецептов %d, партий с остатком %d", id, len(usage.Recipes), len(usage.Batches))
+	}
+	if err := ns.DeleteItem(id); err != nil {
+		return usage, err
+	}
+	return usage, nil
+}
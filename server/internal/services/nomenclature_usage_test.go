@@ -0,0 +1,102 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Мука в активном рецепте и с остатком на складе: обычное удаление блокируется со списком ссылок, force удаляет
+func TestDeleteItemCheckedBlocksItemInUse(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.NomenclatureItem{},
+		&models.Recipe{}, &models.RecipeIngredient{}, &models.StockBatch{})
+	service := NewNomenclatureService(db)
+	branchID := newTestBranch(t, db)
+
+	newItem := func(name string) models.NomenclatureItem {
+		item := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: name, BaseUnit: "g", IsActive: true}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("не удалось создать товар: %v", err)
+		}
+		return item
+	}
+	flour, salt := newItem("Мука"), newItem("Соль")
+
+	bread := models.Recipe{Name: "Хлеб " + uuid.New().String()[:8], IsActive: true, PhotoURLs: "[]"}
+	archived := models.Recipe{Name: "Старый хлеб " + uuid.New().String()[:8], IsActive: true, PhotoURLs: "[]"}
+	for _, recipe := range []*models.Recipe{&bread, &archived} {
+		if err := db.Create(recipe).Error; err != nil {
+			t.Fatalf("не удалось создать рецепт: %v", err)
+		}
+	}
+	// is_active=false отдельным Update: gorm пропускает false при Create из-за default:true
+	if err := db.Model(&archived).Update("is_active", false).Error; err != nil {
+		t.Fatalf("не удалось выключить рецепт: %v", err)
+	}
+	for _, ingredient := range []models.RecipeIngredient{
+		{RecipeID: bread.ID, NomenclatureID: &flour.ID, Quantity: 500, Unit: "g"},
+		{RecipeID: archived.ID, NomenclatureID: &flour.ID, Quantity: 450, Unit: "g"},
+	} {
+		if err := db.Create(&ingredient).Error; err != nil {
+			t.Fatalf("не удалось добавить ингредиент: %v", err)
+		}
+	}
+	live := models.StockBatch{NomenclatureID: flour.ID, BranchID: branchID, Quantity: 5000, Unit: "g", Source: "adjustment"}
+	if err := db.Create(&live).Error; err != nil {
+		t.Fatalf("не удалось создать партию: %v", err)
+	}
+	empty := models.StockBatch{NomenclatureID: flour.ID, BranchID: branchID, Quantity: 1000, Unit: "g", Source: "adjustment"}
+	if err := db.Create(&empty).Error; err != nil {
+		t.Fatalf("не удалось создать партию: %v", err)
+	}
+	if err := db.Model(&empty).Update("remaining_quantity", 0).Error; err != nil {
+		t.Fatalf("не удалось обнулить партию: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Where("recipe_id IN ?", []string{bread.ID, archived.ID}).Delete(&models.RecipeIngredient{})
+		db.Unscoped().Where("id IN ?", []string{bread.ID, archived.ID}).Delete(&models.Recipe{})
+		db.Unscoped().Where("id IN ?", []string{flour.ID, salt.ID}).Delete(&models.NomenclatureItem{})
+	})
+
+	usage, err := service.GetItemUsage(flour.ID)
+	if err != nil {
+		t.Fatalf("GetItemUsage: %v", err)
+	}
+	if len(usage.Recipes) != 1 || usage.Recipes[0].RecipeID != bread.ID || usage.Recipes[0].Quantity != 500 {
+		t.Errorf("рецепты %+v, want только активный %s (500 g)", usage.Recipes, bread.Name)
+	}
+	if len(usage.Batches) != 1 || usage.Batches[0].BatchID != live.ID {
+		t.Errorf("партии %+v, want только партия с остатком %s", usage.Batches, live.ID)
+	}
+
+	usage, err = service.DeleteItemChecked(flour.ID, false)
+	if !errors.Is(err, ErrNomenclatureInUse) {
+		t.Fatalf("удаление используемого товара err = %v, want ErrNomenclatureInUse", err)
+	}
+	if usage == nil || !usage.InUse() {
+		t.Fatalf("при блокировке не вернулся список ссылок: %+v", usage)
+	}
+	if err := db.First(&models.NomenclatureItem{}, "id = ?", flour.ID).Error; err != nil {
+		t.Fatalf("товар удален несмотря на блокировку: %v", err)
+	}
+
+	if _, err := service.DeleteItemChecked(salt.ID, false); err != nil {
+		t.Fatalf("удаление неиспользуемого товара: %v", err)
+	}
+	if _, err := service.DeleteItemChecked(flour.ID, true); err != nil {
+		t.Fatalf("принудительное удаление: %v", err)
+	}
+	for _, id := range []string{flour.ID, salt.ID} {
+		if err := db.First(&models.NomenclatureItem{}, "id = ?", id).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("товар %s не удален: %v", id, err)
+		}
+	}
+	if _, err := service.GetItemUsage(flour.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetItemUsage удаленного товара err = %v, want gorm.ErrRecordNotFound", err)
+	}
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+
+	"zephyrvpn/server/internal/utils"
+)
+
+// DefaultNotificationDedupWindow - через сколько можно повторно отправить уведомление с тем же ключом
+const DefaultNotificationDedupWindow = time.Hour
+
+// NotificationLevelCritical - уровень уведомлений, которые отправляются менеджерам на телефон
+const NotificationLevelCritical = "critical"
+
+// Notification - уведомление для внешних каналов (webhook, Telegram)
+type Notification struct {
+	Key       string                 `json:"key"`   // Ключ дедупликации (например, expiry:critical:{batch_id})
+	Type      string                 `json:"type"`  // expiry_critical, low_stock
+	Level     string                 `json:"level"` // critical
+	Title     string                 `json:"title"`
+	Message   string                 `json:"message"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// NotificationSink - внешний канал доставки уведомлений
+type NotificationSink interface {
+	Name() string
+	Send(ctx context.Context, n Notification) error
+}
+
+// NotificationService рассылает критические уведомления по подключенным каналам
+// Одно и то же уведомление (по Key) не отправляется повторно в течение window;
+// ошибки каналов не прерывают работу вызывающего кода - только логируются
+type NotificationService struct {
+	redisUtil *utils.RedisClient // Дедупликация между перезапусками (может быть nil)
+	window    time.Duration
+	timeout   time.Duration
+
+	mu       sync.Mutex
+	sinks    []NotificationSink
+	lastSent map[string]time.Time // Дедупликация без Redis
+	now      func() time.Time
+}
+
+// NewNotificationService создает сервис уведомлений без каналов (каналы добавляются через AddSink)
+func NewNotificationService(redisUtil *utils.RedisClient, window time.Duration) *NotificationService {
+	if window <= 0 {
+		window = DefaultNotificationDedupWindow
+	}
+	return &NotificationService{
+		redisUtil: redisUtil,
+		window:    window,
+		timeout:   10 * time.Second,
+		lastSent:  make(map[string]time.Time),
+		now:       time.Now,
+	}
+}
+
+// AddSink подключает канал доставки
+func (ns *NotificationService) AddSink(sink NotificationSink) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	ns.sinks = append(ns.sinks, sink)
+	log.Printf("🔔 NotificationService: подключен канал %s", sink.Name())
+}
+
+// HasSinks возвращает true, если подключен хотя бы один канал
+func (ns *NotificationService) HasSinks() bool {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	return len(ns.sinks) > 0
+}
+
+// Notify отправляет уведомление во все каналы в фоне
+// Возвращает false, если уведомление отброшено (дубликат или нет каналов)
+func (ns *NotificationService) Notify(n Notification) bool {
+	if ns == nil {
+		return false
+	}
+
+	ns.mu.Lock()
+	sinks := append([]NotificationSink(nil), ns.sinks...)
+	if len(sinks) == 0 {
+		ns.mu.Unlock()
+		return false
+	}
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = ns.now().UTC()
+	}
+	if n.Level == "" {
+		n.Level = NotificationLevelCritical
+	}
+	claimed := ns.claim(n.Key)
+	ns.mu.Unlock()
+
+	if !claimed {
+		return false
+	}
+
+	go ns.dispatch(sinks, n)
+	return true
+}
+
+// dispatch отправляет уведомление в каналы; ошибки логируются и не повторяются
+func (ns *NotificationService) dispatch(sinks []NotificationSink, n Notification) {
+	for _, sink := range sinks {
+		ctx, cancel := context.WithTimeout(context.Background(), ns.timeout)
+		if err := sink.Send(ctx, n); err != nil {
+			log.Printf("⚠️ NotificationService: канал %s не доставил уведомление %s: %v", sink.Name(), n.Key, err)
+		}
+		cancel()
+	}
+}
+
+// claim резервирует ключ уведомления на window (вызывается под mu)
+// Пустой ключ не дедуплицируется
+func (ns *NotificationService) claim(key string) bool {
+	if key == "" {
+		return true
+	}
+	if ns.redisUtil != nil {
+		ok, err := ns.redisUtil.SetNX("notify:sent:"+key, ns.now().Unix(), ns.window)
+		if err == nil {
+			return ok
+		}
+		log.Printf("⚠️ NotificationService: ошибка Redis при дедупликации, используем память: %v", err)
+	}
+
+	now := ns.now()
+	if last, ok := ns.lastSent[key]; ok && now.Sub(last) < ns.window {
+		return false
+	}
+	ns.lastSent[key] = now
+	return true
+}
+
+// WebhookSink отправляет уведомление JSON-ом (Notification) POST-запросом на произвольный URL
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink создает канал исходящего webhook
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name возвращает имя канала
+func (w *WebhookSink) Name() string {
+	return "webhook"
+}
+
+// Send отправляет уведомление на webhook
+func (w *WebhookSink) Send(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации уведомления: %w", err)
+	}
+	return postJSON(ctx, w.client, w.url, body)
+}
+
+// TelegramSink отправляет уведомление сообщением от Telegram бота в чат
+type TelegramSink struct {
+	baseURL string
+	token   string
+	chatID  string
+	client  *http.Client
+}
+
+// NewTelegramSink создает канал Telegram бота
+func NewTelegramSink(token, chatID string) *TelegramSink {
+	return &TelegramSink{
+		baseURL: "https://api.telegram.org",
+		token:   token,
+		chatID:  chatID,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name возвращает имя канала
+func (t *TelegramSink) Name() string {
+	return "telegram"
+}
+
+// Send отправляет уведомление через Bot API sendMessage
+func (t *TelegramSink) Send(ctx context.Context, n Notification) error {
+	text := n.Title
+	if n.Message != "" {
+		text += "\n" + n.Message
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"chat_id": t.chatID,
+		"text":    "🚨 " + text,
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации сообщения: %w", err)
+	}
+	return postJSON(ctx, t.client, fmt.Sprintf("%s/bot%s/sendMessage", t.baseURL, t.token), body)
+}
+
+// postJSON отправляет POST с JSON телом и проверяет код ответа
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// В URL может быть секрет (токен бота), поэтому в ошибку он не попадает
+		var urlErr *neturl.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("ошибка отправки запроса: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("ответ %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
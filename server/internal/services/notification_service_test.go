@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sinkRequest - запрос, принятый тестовым HTTP-каналом
+type sinkRequest struct {
+	path string
+	body []byte
+}
+
+// newSinkServer поднимает HTTP-сервер, который передает каждый запрос в канал и отвечает status
+func newSinkServer(t *testing.T, status int) (*httptest.Server, <-chan sinkRequest) {
+	t.Helper()
+	requests := make(chan sinkRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- sinkRequest{path: r.URL.Path, body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+// waitRequest ждет запрос к тестовому каналу (уведомления отправляются в фоне)
+func waitRequest(t *testing.T, requests <-chan sinkRequest) sinkRequest {
+	t.Helper()
+	select {
+	case request := <-requests:
+		return request
+	case <-time.After(5 * time.Second):
+		t.Fatal("канал не получил уведомление")
+		return sinkRequest{}
+	}
+}
+
+// assertNoRequest проверяет, что лишних запросов не было
+func assertNoRequest(t *testing.T, requests <-chan sinkRequest) {
+	t.Helper()
+	select {
+	case request := <-requests:
+		t.Errorf("лишний запрос к каналу: %s %s", request.path, request.body)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestNotifyCriticalAlertSendsOneWebhookCall(t *testing.T) {
+	server, requests := newSinkServer(t, http.StatusOK)
+	sentAt := time.Date(2030, 1, 15, 3, 0, 0, 0, time.UTC)
+	now := sentAt
+	service := NewNotificationService(nil, time.Hour)
+	service.now = func() time.Time { return now }
+
+	if service.Notify(Notification{Key: "expiry:critical:batch-1"}) {
+		t.Error("без каналов уведомление не должно отправляться")
+	}
+	service.AddSink(NewWebhookSink(server.URL + "/hook"))
+
+	alert := Notification{
+		Key:     "expiry:critical:batch-1",
+		Type:    "expiry_critical",
+		Title:   "Истекает срок: Моцарелла",
+		Message: "Партия истекает через 2 ч",
+		Data:    map[string]interface{}{"batch_id": "batch-1"},
+	}
+	if !service.Notify(alert) {
+		t.Fatal("Notify вернул false для нового уведомления")
+	}
+	// Повтор в пределах окна дедуплицируется
+	now = now.Add(30 * time.Minute)
+	if service.Notify(alert) {
+		t.Error("повтор в пределах окна должен быть отброшен")
+	}
+
+	request := waitRequest(t, requests)
+	assertNoRequest(t, requests)
+	if request.path != "/hook" {
+		t.Errorf("путь %s, want /hook", request.path)
+	}
+	var payload Notification
+	if err := json.Unmarshal(request.body, &payload); err != nil {
+		t.Fatalf("тело не JSON: %v (%s)", err, request.body)
+	}
+	if payload.Key != alert.Key || payload.Type != "expiry_critical" || payload.Level != NotificationLevelCritical ||
+		payload.Title != alert.Title || payload.Message != alert.Message || payload.Data["batch_id"] != "batch-1" ||
+		!payload.CreatedAt.Equal(sentAt) {
+		t.Errorf("payload %+v, want %+v с уровнем critical и временем %s", payload, alert, sentAt)
+	}
+
+	// После окна то же уведомление уходит снова
+	now = now.Add(time.Hour)
+	if !service.Notify(alert) {
+		t.Error("после окна уведомление должно отправляться снова")
+	}
+	waitRequest(t, requests)
+}
+
+// Ошибка одного канала не мешает доставке в остальные
+func TestNotifyFailingSinkIsNotFatal(t *testing.T) {
+	failing, failingRequests := newSinkServer(t, http.StatusInternalServerError)
+	working, workingRequests := newSinkServer(t, http.StatusOK)
+	service := NewNotificationService(nil, time.Hour)
+	service.AddSink(NewWebhookSink(failing.URL))
+	service.AddSink(NewWebhookSink(working.URL))
+
+	if !service.Notify(Notification{Key: "low_stock:cheese:branch-1", Title: "Заканчивается: Сыр"}) {
+		t.Fatal("Notify вернул false")
+	}
+	waitRequest(t, failingRequests)
+	waitRequest(t, workingRequests)
+}
+
+func TestTelegramSinkSend(t *testing.T) {
+	server, requests := newSinkServer(t, http.StatusOK)
+	sink := NewTelegramSink("123:secret", "-100500")
+	sink.baseURL = server.URL
+
+	err := sink.Send(context.Background(), Notification{Title: "Заканчивается: Сыр (Центр)", Message: "Остаток 120.00 g при минимуме 500.00 g"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	request := waitRequest(t, requests)
+	if request.path != "/bot123:secret/sendMessage" {
+		t.Errorf("путь %s, want /bot123:secret/sendMessage", request.path)
+	}
+	var payload map[string]string
+	if err := json.Unmarshal(request.body, &payload); err != nil {
+		t.Fatalf("тело не JSON: %v", err)
+	}
+	if payload["chat_id"] != "-100500" || payload["text"] != "🚨 Заканчивается: Сыр (Центр)\nОстаток 120.00 g при минимуме 500.00 g" {
+		t.Errorf("сообщение %v", payload)
+	}
+}
+
+// Ответ с ошибкой возвращается вызывающему, токен бота из URL не попадает в текст ошибки
+func TestTelegramSinkErrors(t *testing.T) {
+	server, _ := newSinkServer(t, http.StatusBadRequest)
+	sink := NewTelegramSink("123:secret", "-100500")
+	sink.baseURL = server.URL
+	if err := sink.Send(context.Background(), Notification{Title: "Тест"}); err == nil || !strings.Contains(err.Error(), "ответ 400") {
+		t.Errorf("ошибка %v, want ответ 400", err)
+	}
+
+	server.Close()
+	err := sink.Send(context.Background(), Notification{Title: "Тест"})
+	if err == nil {
+		t.Fatal("недоступный сервер: want ошибку")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("токен бота попал в ошибку: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils"
+	"zephyrvpn/server/internal/utils/rediskeys"
+)
+
+// ErrOrderNotCancellable - заказ в финальном статусе (completed/cancelled), отменить нельзя
+var ErrOrderNotCancellable = errors.New("заказ нельзя отменить")
+
+// saleNetDepletionRow - чистое списание партии под продажу/заказ (sale минус уже записанные sale_reversal)
+type saleNetDepletionRow struct {
+	StockBatchID   string
+	NomenclatureID string
+	BranchID       string
+	Unit           string
+	Quantity       float64 // Отрицательное - столько еще не возвращено на склад
+}
+
+// ReverseSaleDepletion возвращает на склад все, что списано под продажу/заказ saleID (source_reference_id)
+// По каждой партии чистое списание возвращается в остаток одной транзакцией, на каждую пишется
+// компенсирующее движение sale_reversal. Повторный вызов ничего не меняет - возвращать уже нечего
+func (s *StockService) ReverseSaleDepletion(saleID, performedBy string) ([]models.StockMovement, error) {
+	reversals := make([]models.StockMovement, 0)
+	if _, err := uuid.Parse(saleID); err != nil {
+		// source_reference_id - UUID колонка, под другие идентификаторы списаний не бывает
+		return reversals, nil
+	}
+
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Блокируем списания заказа: параллельная отмена ждет и затем видит уже записанные sale_reversal
+	var sales []models.StockMovement
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("source_reference_id = ? AND movement_type = ?", saleID, "sale").
+		Find(&sales).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("ошибка загрузки списаний: %w", err)
+	}
+	if len(sales) == 0 {
+		tx.Rollback()
+		return reversals, nil
+	}
+
+	var rows []saleNetDepletionRow
+	if err := tx.Model(&models.StockMovement{}).
+		Select("stock_batch_id, nomenclature_id, branch_id, MIN(unit) AS unit, SUM(quantity) AS quantity").
+		Where("source_reference_id = ? AND movement_type IN ? AND stock_batch_id IS NOT NULL", saleID, []string{"sale", "sale_reversal"}).
+		Group("stock_batch_id, nomenclature_id, branch_id").
+		Having("SUM(quantity) < 0").
+		Scan(&rows).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("ошибка расчета списаний: %w", err)
+	}
+
+	for _, row := range rows {
+		var batch models.StockBatch
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&batch, "id = ?", row.StockBatchID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// Партия удалена (например, объединена MergeBatches) - вернуть некуда
+				log.Printf("⚠️ ReverseSaleDepletion: партия %s для продажи %s не найдена, %.2f %s не возвращены",
+					row.StockBatchID, saleID, -row.Quantity, row.Unit)
+				continue
+			}
+			tx.Rollback()
+			return nil, fmt.Errorf("ошибка загрузки партии: %w", err)
+		}
+
+		batchID := batch.ID
+		reference := saleID
+		movement := models.StockMovement{
+			StockBatchID:      &batchID,
+			NomenclatureID:    row.NomenclatureID,
+			BranchID:          row.BranchID,
+			Quantity:          -row.Quantity, // Положительное = возврат на склад
+			Unit:              row.Unit,
+			MovementType:      "sale_reversal",
+			SourceReferenceID: &reference,
+			PerformedBy:       performedBy,
+			Notes:             "Возврат списания при отмене заказа",
+		}
+		if err := tx.Create(&movement).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("ошибка создания компенсирующего движения: %w", err)
+		}
+		if err := tx.Model(&batch).Update("remaining_quantity", gorm.Expr("remaining_quantity + ?", -row.Quantity)).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("ошибка возврата остатка партии: %w", err)
+		}
+		reversals = append(reversals, movement)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("ошибка коммита транзакции: %w", err)
+	}
+	return reversals, nil
+}
+
+// OrderCancellation - результат отмены заказа
+type OrderCancellation struct {
+	OrderID           string                 `json:"order_id"`
+	PreviousStatus    string                 `json:"previous_status"`
+	SlotID            string                 `json:"slot_id,omitempty"`
+	RestoredMovements []models.StockMovement `json:"restored_movements"` // Компенсирующие движения sale_reversal
+	Archived          bool                   `json:"archived"`           // Статус cancelled записан в PostgreSQL
+}
+
+// OrderCancellationService отменяет заказ целиком: склад, слот, наборы ERP в Redis и архив заказов
+type OrderCancellationService struct {
+	redisUtil    *utils.RedisClient
+	slotService  *SlotService
+	stockService *StockService // Может быть nil (PostgreSQL недоступен) - списания не возвращаются
+	orderService *OrderService // Может быть nil - статус в архиве не обновляется
+}
+
+// NewOrderCancellationService создает сервис отмены заказов
+func NewOrderCancellationService(redisUtil *utils.RedisClient, slotService *SlotService, stockService *StockService, orderService *OrderService) *OrderCancellationService {
+	return &OrderCancellationService{
+		redisUtil:    redisUtil,
+		slotService:  slotService,
+		stockService: stockService,
+		orderService: orderService,
+	}
+}
+
+// CancelOrder отменяет заказ и откатывает его последствия:
+//  1. возвращает на склад ингредиенты, списанные под заказ (ReverseSaleDepletion)
+//  2. убирает заказ из активных/отложенных, освобождает место в слоте и снимает резерв ингредиентов (ReleaseOrder)
+//  3. сохраняет заказ в PostgreSQL со статусом cancelled - в выручку он не попадает
+//     и не восстанавливается в Redis при рестарте
+//
+// Склад возвращается первым: при ошибке заказ остается на планшете и отмену можно повторить
+func (s *OrderCancellationService) CancelOrder(order *models.PizzaOrder, performedBy string) (*OrderCancellation, error) {
+	if !order.CanTransitionTo(models.OrderStatusCancelled) {
+		return nil, fmt.Errorf("%w: заказ %s в статусе '%s'", ErrOrderNotCancellable, order.ID, order.Status)
+	}
+
+	result := &OrderCancellation{
+		OrderID:           order.ID,
+		PreviousStatus:    order.Status,
+		SlotID:            order.TargetSlotID,
+		RestoredMovements: make([]models.StockMovement, 0),
+	}
+
+	if s.stockService != nil {
+		reversals, err := s.stockService.ReverseSaleDepletion(order.ID, performedBy)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка возврата списаний по заказу: %w", err)
+		}
+		result.RestoredMovements = reversals
+	}
+
+	order.Status = string(models.OrderStatusCancelled)
+	s.ReleaseOrder(order.ID)
+
+	if s.orderService != nil {
+		if err := s.orderService.SaveOrder(*order); err != nil {
+			log.Printf("⚠️ CancelOrder: не удалось отметить заказ %s отмененным в PostgreSQL: %v", order.ID, err)
+		} else {
+			result.Archived = true
+		}
+	}
+
+	log.Printf("🚫 Заказ %s отменен (был %s): возвращено движений %d, слот %s", order.ID, result.PreviousStatus, len(result.RestoredMovements), result.SlotID)
+	return result, nil
+}
+
+// ReleaseOrder убирает отмененный заказ из активных и отложенных, освобождает место в слоте,
+// снимает резерв ингредиентов и удаляет заказ из Redis
+func (s *OrderCancellationService) ReleaseOrder(orderID string) {
+	// Счетчик pending считает заказы из active и pending_slots (см. RebuildState): уменьшаем его, только если
+	// заказ действительно был в одном из наборов, чтобы повторная отмена не увела счетчик вниз
+	ctx := s.redisUtil.Context()
+	removed := int64(0)
+	for _, setKey := range []string{rediskeys.OrdersActiveKey, rediskeys.OrdersPendingSlotsKey} {
+		n, err := s.redisUtil.GetClient().SRem(ctx, setKey, orderID).Result()
+		if err != nil {
+			log.Printf("⚠️ ReleaseOrder: ошибка удаления заказа %s из %s: %v", orderID, setKey, err)
+			continue
+		}
+		removed += n
+	}
+	if removed > 0 {
+		s.redisUtil.Decrement(rediskeys.OrdersPendingKey)
+	}
+	if s.slotService != nil {
+		if err := s.slotService.ReleaseSlot(orderID); err != nil {
+			log.Printf("⚠️ ReleaseOrder: ошибка освобождения слота для заказа %s: %v", orderID, err)
+		}
+	}
+
+	if s.stockService != nil {
+		if err := s.stockService.ReleaseReservation(orderID); err != nil && !errors.Is(err, ErrReservationNotFound) {
+			log.Printf("⚠️ ReleaseOrder: ошибка снятия резерва ингредиентов заказа %s: %v", orderID, err)
+		}
+	}
+
+	s.redisUtil.Delete(rediskeys.OrderKey(orderID))
+	s.redisUtil.Delete(rediskeys.LegacyOrderKey(orderID))
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils/rediskeys"
+
+	"github.com/google/uuid"
+)
+
+// Заказ назначен на слот и под него списаны ингредиенты: отмена возвращает остатки,
+// освобождает слот и убирает заказ с планшета
+func TestCancelOrderRestoresStockAndFreesSlot(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.StockBatch{}, &models.StockMovement{},
+		&models.Recipe{}, &models.RecipeIngredient{})
+	redisUtil := newTestRedis(t)
+	stockService := NewStockService(db)
+	slotService := NewSlotService(redisUtil, nil, testOpenHour, 0, testCloseHour, 0, NewMockClock(testTime(12, 5, 0)))
+
+	branchID := uuid.New().String()
+	orderID := uuid.New().String()
+	item := models.NomenclatureItem{
+		SKU:      "TEST-" + uuid.New().String()[:8],
+		Name:     "Моцарелла",
+		BaseUnit: "g",
+		IsActive: true,
+	}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	batch := models.StockBatch{
+		NomenclatureID:    item.ID,
+		BranchID:          branchID,
+		Quantity:          1000,
+		RemainingQuantity: 1000,
+		Unit:              "g",
+		Source:            "adjustment",
+	}
+	if err := db.Create(&batch).Error; err != nil {
+		t.Fatalf("не удалось создать партию: %v", err)
+	}
+	recipe := models.Recipe{
+		Name:        "Тест отмены " + uuid.New().String()[:8],
+		PortionSize: 1,
+		Ingredients: []models.RecipeIngredient{{NomenclatureID: &item.ID, Quantity: 150, Unit: "g"}},
+	}
+	if err := db.Create(&recipe).Error; err != nil {
+		t.Fatalf("не удалось создать рецепт: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("id = ?", batch.ID).Delete(&models.StockBatch{})
+		db.Where("recipe_id = ?", recipe.ID).Delete(&models.RecipeIngredient{})
+		db.Unscoped().Where("id = ?", recipe.ID).Delete(&models.Recipe{})
+		db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+		redisUtil.SRem(rediskeys.OrdersActiveKey, orderID)
+	})
+
+	slotID, _, _, err := slotService.AssignSlot(orderID, 700, 2, "")
+	if err != nil {
+		t.Fatalf("AssignSlot: %v", err)
+	}
+	loaded, err := slotService.GetSlotInfo(slotID)
+	if err != nil {
+		t.Fatalf("GetSlotInfo: %v", err)
+	}
+	redisUtil.SAdd(rediskeys.OrdersActiveKey, orderID)
+
+	// Две пиццы: списано 300 г
+	if err := stockService.ProcessSaleDepletion(recipe.ID, 2, branchID, "test", orderID); err != nil {
+		t.Fatalf("ProcessSaleDepletion: %v", err)
+	}
+
+	order := &models.PizzaOrder{ID: orderID, Status: string(models.OrderStatusCooking), TargetSlotID: slotID, FinalPrice: 700}
+	service := NewOrderCancellationService(redisUtil, slotService, stockService, nil)
+	result, err := service.CancelOrder(order, "manager")
+	if err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+	if len(result.RestoredMovements) != 1 || result.RestoredMovements[0].Quantity != 300 {
+		t.Errorf("компенсирующие движения = %+v, want одно на +300 г", result.RestoredMovements)
+	}
+
+	var restored models.StockBatch
+	if err := db.First(&restored, "id = ?", batch.ID).Error; err != nil {
+		t.Fatalf("ошибка загрузки партии: %v", err)
+	}
+	if restored.RemainingQuantity != 1000 {
+		t.Errorf("остаток после отмены = %.2f г, want 1000", restored.RemainingQuantity)
+	}
+
+	freed, err := slotService.GetSlotInfo(slotID)
+	if err != nil {
+		t.Fatalf("GetSlotInfo: %v", err)
+	}
+	if freed.CurrentLoad != loaded.CurrentLoad-700 {
+		t.Errorf("загрузка слота после отмены = %d₽, want %d₽", freed.CurrentLoad, loaded.CurrentLoad-700)
+	}
+	if active, _ := redisUtil.SIsMember(rediskeys.OrdersActiveKey, orderID); active {
+		t.Error("отмененный заказ остался в erp:orders:active")
+	}
+
+	// Повторный возврат ничего не меняет
+	again, err := stockService.ReverseSaleDepletion(orderID, "manager")
+	if err != nil {
+		t.Fatalf("повторный ReverseSaleDepletion: %v", err)
+	}
+	if len(again) != 0 {
+		t.Errorf("повторный возврат записал %d движений, want 0", len(again))
+	}
+}
+
+// Счетчик pending уменьшается один раз на заказ: повторная отмена и отмена заказа,
+// которого уже нет в active/pending_slots, его не трогают
+func TestReleaseOrderDecrementsPendingOnce(t *testing.T) {
+	redisUtil := newTestRedis(t)
+	service := NewOrderCancellationService(redisUtil, nil, nil, nil)
+
+	activeID, pendingID := uuid.New().String(), uuid.New().String()
+	redisUtil.SAdd(rediskeys.OrdersActiveKey, activeID)
+	redisUtil.SAdd(rediskeys.OrdersPendingSlotsKey, pendingID)
+	if err := redisUtil.Set(rediskeys.OrdersPendingKey, "2", 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	service.ReleaseOrder(activeID)
+	service.ReleaseOrder(activeID)
+	service.ReleaseOrder(pendingID)
+	service.ReleaseOrder(uuid.New().String())
+
+	pending, err := redisUtil.Get(rediskeys.OrdersPendingKey)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if pending != "0" {
+		t.Errorf("erp:orders:pending = %s, want 0", pending)
+	}
+	for _, setKey := range []string{rediskeys.OrdersActiveKey, rediskeys.OrdersPendingSlotsKey} {
+		if members, _ := redisUtil.SMembers(setKey); len(members) != 0 {
+			t.Errorf("%s после отмены: %v, want пусто", setKey, members)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func TestSetArchiveRetentionDays(t *testing.T) {
+	orderService := NewOrderService(nil, nil)
+	orderService.SetArchiveRetentionDays(90)
+	if orderService.retentionDays != 90 {
+		t.Errorf("retentionDays = %d, want 90", orderService.retentionDays)
+	}
+	// Отрицательный срок - хранить бессрочно
+	orderService.SetArchiveRetentionDays(-1)
+	if orderService.retentionDays != 0 {
+		t.Errorf("retentionDays = %d, want 0", orderService.retentionDays)
+	}
+
+	if _, err := orderService.PurgeArchivedOrders(time.Now(), true); err == nil {
+		t.Error("PurgeArchivedOrders без БД прошел без ошибки")
+	}
+}
+
+// Удаляются только заархивированные заказы старше before; dry_run ничего не удаляет
+func TestPurgeArchivedOrders(t *testing.T) {
+	db := newTestDB(t)
+	if !db.Migrator().HasTable("orders") {
+		t.Skip("таблица orders не создана (migrations/013): тест пропущен")
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db.DB: %v", err)
+	}
+	orderService := NewOrderService(sqlDB, nil)
+
+	// Партиции orders создаются с текущего месяца, поэтому заказы в пределах последних минут
+	now := time.Now().UTC()
+	before := now.Add(-time.Minute)
+	var ids []string
+	insertOrder := func(status string, created time.Time) string {
+		t.Helper()
+		id := uuid.New().String()
+		ids = append(ids, id)
+		if err := db.Exec(`INSERT INTO orders (id, display_id, items, total_price, final_price, status, created_at)
+			VALUES (?, ?, '[]'::jsonb, 500, 500, ?, ?)`, id, "T-"+id[:6], status, created).Error; err != nil {
+			t.Fatalf("не удалось создать заказ: %v", err)
+		}
+		return id
+	}
+	t.Cleanup(func() {
+		sqlDB.Exec(`DELETE FROM orders WHERE id = ANY($1)`, pq.Array(ids))
+	})
+	oldArchived := insertOrder("archived", before.Add(-time.Minute))
+	freshArchived := insertOrder("archived", now)
+	oldCompleted := insertOrder("completed", before.Add(-time.Minute))
+
+	exists := func(id string) bool {
+		t.Helper()
+		var count int64
+		if err := db.Raw(`SELECT COUNT(*) FROM orders WHERE id = ?`, id).Scan(&count).Error; err != nil {
+			t.Fatalf("не удалось прочитать заказ: %v", err)
+		}
+		return count > 0
+	}
+
+	wouldPurge, err := orderService.PurgeArchivedOrders(before, true)
+	if err != nil {
+		t.Fatalf("PurgeArchivedOrders(dry_run): %v", err)
+	}
+	if wouldPurge < 1 || !exists(oldArchived) {
+		t.Fatalf("dry_run: к удалению %d, заказ на месте %v; want >= 1 и заказ не удален", wouldPurge, exists(oldArchived))
+	}
+
+	purged, err := orderService.PurgeArchivedOrders(before, false)
+	if err != nil {
+		t.Fatalf("PurgeArchivedOrders: %v", err)
+	}
+	if purged != wouldPurge {
+		t.Errorf("удалено %d, dry_run обещал %d", purged, wouldPurge)
+	}
+	if exists(oldArchived) {
+		t.Error("заархивированный заказ старше before не удален")
+	}
+	if !exists(freshArchived) || !exists(oldCompleted) {
+		t.Errorf("удалены лишние заказы: свежий архивный на месте %v, старый завершенный на месте %v", exists(freshArchived), exists(oldCompleted))
+	}
+}
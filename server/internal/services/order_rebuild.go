@@ -0,0 +1,179 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils/rediskeys"
+)
+
+// ErrStateRebuildInProgress - пересборка состояния уже идет (на этом или другом инстансе)
+var ErrStateRebuildInProgress = errors.New("пересборка состояния заказов уже выполняется")
+
+// StateRebuildLockTTL - срок аренды пересборки; если инстанс упал, не отпустив аренду, она истечет сама
+const StateRebuildLockTTL = 5 * time.Minute
+
+// releaseStateRebuildLockScript удаляет аренду, только если она все еще наша (тот же скрипт, что у перезагрузки меню)
+const releaseStateRebuildLockScript = releaseMenuReloadLockScript
+
+// StateRebuildResult - итог пересборки состояния заказов в Redis
+type StateRebuildResult struct {
+	OrdersLoaded   int   `json:"orders_loaded"`   // Активных заказов в PostgreSQL
+	OrdersRestored int   `json:"orders_restored"` // Записано в Redis
+	Active         int   `json:"active"`          // Из них в erp:orders:active
+	PendingSlots   int   `json:"pending_slots"`   // Из них в erp:orders:pending_slots
+	StaleRemoved   int   `json:"stale_removed"`   // Убрано ID из наборов: заказа нет ни в PostgreSQL, ни в Redis
+	SlotsRebuilt   int   `json:"slots_rebuilt"`   // Слотов с пересчитанной загрузкой
+	DurationMs     int64 `json:"duration_ms"`
+}
+
+// RebuildState заново выполняет восстановление BootstrapState на работающем сервере (Redis очищен или разошелся с БД):
+//   - активные заказы из PostgreSQL записываются в Redis и раскладываются по erp:orders:active / pending_slots
+//   - из наборов убираются ID заказов, которых нет ни в PostgreSQL, ни в Redis
+//   - счетчик erp:orders:pending выставляется по размеру наборов
+//   - загрузка слотов активных заказов пересчитывается по всем неотмененным заказам этих слотов (slotService может быть nil)
+//
+// Заказы, которые уже есть в Redis, но еще не сохранены в PostgreSQL, остаются на месте.
+// Параллельный запуск (в том числе с другого инстанса) возвращает ErrStateRebuildInProgress
+func (os *OrderService) RebuildState(slotService *SlotService) (*StateRebuildResult, error) {
+	if os.db == nil {
+		return nil, fmt.Errorf("database connection not available")
+	}
+	if os.redisUtil == nil {
+		return nil, ErrRedisUnavailable
+	}
+
+	token := uuid.New().String()
+	acquired, err := os.redisUtil.SetNX(rediskeys.OrderStateRebuildLockKey, token, StateRebuildLockTTL)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения аренды пересборки: %w", err)
+	}
+	if !acquired {
+		return nil, ErrStateRebuildInProgress
+	}
+	defer func() {
+		client := os.redisUtil.GetClient()
+		if err := client.Eval(os.redisUtil.Context(), releaseStateRebuildLockScript, []string{rediskeys.OrderStateRebuildLockKey}, token).Err(); err != nil {
+			log.Printf("⚠️ Не удалось освободить аренду пересборки состояния (истечет через %v): %v", StateRebuildLockTTL, err)
+		}
+	}()
+
+	startTime := time.Now()
+	result := &StateRebuildResult{}
+
+	// 1. Активные заказы из PostgreSQL
+	rows, err := os.db.Query(activeOrdersQuery)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса активных заказов: %w", err)
+	}
+	orders := make([]models.PizzaOrder, 0)
+	for rows.Next() {
+		order, _, err := scanOrderRow(rows)
+		if err != nil {
+			log.Printf("⚠️ RebuildState: %v", err)
+			continue
+		}
+		orders = append(orders, order)
+	}
+	rows.Close()
+	result.OrdersLoaded = len(orders)
+
+	// 2. Заказы и наборы active/pending_slots
+	restored := make(map[string]bool, len(orders))
+	slotIDs := make([]string, 0)
+	seenSlots := make(map[string]bool)
+	for _, order := range orders {
+		isPending, err := os.restoreOrder(order)
+		if err != nil {
+			log.Printf("⚠️ RebuildState: %v", err)
+			continue
+		}
+		// Заказ мог остаться в другом наборе (VisibleAt наступил, пока Redis расходился с БД)
+		if isPending {
+			os.redisUtil.SRem(rediskeys.OrdersActiveKey, order.ID)
+			result.PendingSlots++
+		} else {
+			os.redisUtil.SRem(rediskeys.OrdersPendingSlotsKey, order.ID)
+			result.Active++
+		}
+		restored[order.ID] = true
+		result.OrdersRestored++
+
+		if order.TargetSlotID != "" && !seenSlots[order.TargetSlotID] {
+			seenSlots[order.TargetSlotID] = true
+			slotIDs = append(slotIDs, order.TargetSlotID)
+		}
+	}
+
+	// 3. Висячие ID: заказа нет в PostgreSQL среди активных и нет JSON в Redis
+	setSizes := 0
+	for _, setKey := range []string{rediskeys.OrdersActiveKey, rediskeys.OrdersPendingSlotsKey} {
+		members, err := os.redisUtil.SMembers(setKey)
+		if err != nil {
+			log.Printf("⚠️ RebuildState: ошибка чтения %s: %v", setKey, err)
+			continue
+		}
+		for _, orderID := range members {
+			if restored[orderID] {
+				setSizes++
+				continue
+			}
+			if exists, err := os.redisUtil.Exists(rediskeys.OrderKey(orderID)); err == nil && !exists {
+				os.redisUtil.SRem(setKey, orderID)
+				result.StaleRemoved++
+				continue
+			}
+			setSizes++
+		}
+	}
+	if err := os.redisUtil.Set(rediskeys.OrdersPendingKey, strconv.Itoa(setSizes), 0); err != nil {
+		log.Printf("⚠️ RebuildState: ошибка обновления счетчика erp:orders:pending: %v", err)
+	}
+
+	// 4. Загрузка слотов: все неотмененные заказы слотов (готовые заказы тоже занимали место в слоте)
+	if slotService != nil && len(slotIDs) > 0 {
+		loads, err := os.slotOrderLoads(slotIDs)
+		if err != nil {
+			return nil, err
+		}
+		slots, err := slotService.RestoreSlotLoads(loads)
+		if err != nil {
+			return nil, err
+		}
+		result.SlotsRebuilt = slots
+	}
+
+	result.DurationMs = time.Since(startTime).Milliseconds()
+	log.Printf("✅ RebuildState: загружено %d, восстановлено %d (active %d, pending_slots %d), убрано висячих %d, слотов %d за %d мс",
+		result.OrdersLoaded, result.OrdersRestored, result.Active, result.PendingSlots, result.StaleRemoved, result.SlotsRebuilt, result.DurationMs)
+	return result, nil
+}
+
+// slotOrderLoads возвращает неотмененные заказы слотов slotIDs с их суммами (как их бронировал AssignSlot)
+func (os *OrderService) slotOrderLoads(slotIDs []string) ([]SlotOrderLoad, error) {
+	rows, err := os.db.Query(`
+		SELECT id, target_slot_id, COALESCE(final_price, 0)
+		FROM orders
+		WHERE target_slot_id = ANY($1) AND status <> 'cancelled'
+	`, pq.Array(slotIDs))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса заказов слотов: %w", err)
+	}
+	defer rows.Close()
+
+	loads := make([]SlotOrderLoad, 0)
+	for rows.Next() {
+		var load SlotOrderLoad
+		if err := rows.Scan(&load.OrderID, &load.SlotID, &load.Price); err != nil {
+			return nil, fmt.Errorf("ошибка чтения заказа слота: %w", err)
+		}
+		loads = append(loads, load)
+	}
+	return loads, rows.Err()
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils/rediskeys"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Redis очищен при работающем сервере: пересборка возвращает заказы в наборы
+// и пересчитывает загрузку слота по всем неотмененным заказам
+func TestRebuildStateRestoresOrdersAndSlotLoad(t *testing.T) {
+	db := newTestDB(t)
+	if !db.Migrator().HasTable("orders") {
+		t.Skip("таблица orders не создана (migrations/013): тест пропущен")
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db.DB: %v", err)
+	}
+	redisUtil := newTestRedis(t)
+	orderService := NewOrderService(sqlDB, redisUtil)
+	slotService := NewSlotService(redisUtil, nil, testOpenHour, 0, testCloseHour, 0, NewMockClock(time.Now()))
+
+	now := time.Now().UTC()
+	slotStart := now.Truncate(15 * time.Minute)
+	slotID := slotService.generateSlotID(slotStart)
+	newOrder := func(status string, visibleAt time.Time, price int) models.PizzaOrder {
+		return models.PizzaOrder{
+			ID:                  uuid.New().String(),
+			DisplayID:           "T-" + uuid.New().String()[:6],
+			Items:               []models.PizzaItem{},
+			TotalPrice:          price,
+			FinalPrice:          price,
+			Status:              status,
+			CreatedAt:           now,
+			TargetSlotID:        slotID,
+			TargetSlotStartTime: slotStart,
+			VisibleAt:           visibleAt,
+		}
+	}
+	active := newOrder(string(models.OrderStatusCooking), now.Add(-5*time.Minute), 700)
+	pending := newOrder(string(models.OrderStatusPending), now.Add(30*time.Minute), 300)
+	cancelled := newOrder(string(models.OrderStatusCancelled), now.Add(-5*time.Minute), 500)
+
+	ids := []string{active.ID, pending.ID, cancelled.ID}
+	t.Cleanup(func() {
+		sqlDB.Exec(`DELETE FROM orders WHERE id = ANY($1)`, pq.Array(ids))
+	})
+	for _, order := range []models.PizzaOrder{active, pending, cancelled} {
+		if err := orderService.SaveOrder(order); err != nil {
+			t.Fatalf("SaveOrder: %v", err)
+		}
+	}
+
+	// Redis потерял состояние, в наборе остался висячий ID
+	if err := redisUtil.GetClient().FlushDB(redisUtil.Context()).Err(); err != nil {
+		t.Fatalf("FlushDB: %v", err)
+	}
+	staleID := uuid.New().String()
+	redisUtil.SAdd(rediskeys.OrdersActiveKey, staleID)
+
+	result, err := orderService.RebuildState(slotService)
+	if err != nil {
+		t.Fatalf("RebuildState: %v", err)
+	}
+	if result.StaleRemoved != 1 {
+		t.Errorf("StaleRemoved = %d, want 1", result.StaleRemoved)
+	}
+
+	if ok, _ := redisUtil.SIsMember(rediskeys.OrdersActiveKey, active.ID); !ok {
+		t.Error("заказ с наступившим VisibleAt не попал в erp:orders:active")
+	}
+	if ok, _ := redisUtil.SIsMember(rediskeys.OrdersPendingSlotsKey, pending.ID); !ok {
+		t.Error("отложенный заказ не попал в erp:orders:pending_slots")
+	}
+	if ok, _ := redisUtil.SIsMember(rediskeys.OrdersActiveKey, staleID); ok {
+		t.Error("висячий ID остался в erp:orders:active")
+	}
+	if exists, _ := redisUtil.Exists(rediskeys.OrderKey(cancelled.ID)); exists {
+		t.Error("отмененный заказ восстановлен в Redis")
+	}
+
+	assigned, err := redisUtil.GetClient().HGet(redisUtil.Context(), rediskeys.OrderSlotKey(active.ID), "slot_id").Result()
+	if err != nil || assigned != slotID {
+		t.Errorf("слот заказа = %q (%v), want %q", assigned, err, slotID)
+	}
+	info, err := slotService.GetSlotInfo(slotID)
+	if err != nil {
+		t.Fatalf("GetSlotInfo: %v", err)
+	}
+	if info.CurrentLoad != 1000 {
+		t.Errorf("загрузка слота = %d₽, want 1000₽ (700 + 300, отмененный не учитывается)", info.CurrentLoad)
+	}
+}
+
+// Аренда уже занята другим инстансом - повторный запуск отклоняется
+func TestRebuildStateRejectsConcurrentRun(t *testing.T) {
+	db := newTestDB(t)
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("db.DB: %v", err)
+	}
+	redisUtil := newTestRedis(t)
+	orderService := NewOrderService(sqlDB, redisUtil)
+
+	if err := redisUtil.Set(rediskeys.OrderStateRebuildLockKey, "other-instance", StateRebuildLockTTL); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, err := orderService.RebuildState(nil); !errors.Is(err, ErrStateRebuildInProgress) {
+		t.Errorf("RebuildState при занятой аренде: %v, want ErrStateRebuildInProgress", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
@@ -13,12 +14,14 @@ import (
 	"github.com/lib/pq"
 	"zephyrvpn/server/internal/models"
 	"zephyrvpn/server/internal/utils"
+	"zephyrvpn/server/internal/utils/rediskeys"
 )
 
 // OrderService управляет заказами и их состоянием
 type OrderService struct {
-	db        *sql.DB
-	redisUtil *utils.RedisClient
+	db            *sql.DB
+	redisUtil     *utils.RedisClient
+	retentionDays int // Срок хранения заархивированных заказов в днях (0 = бессрочно)
 }
 
 // NewOrderService создает новый сервис заказов
@@ -29,6 +32,14 @@ func NewOrderService(db *sql.DB, redisUtil *utils.RedisClient) *OrderService {
 	}
 }
 
+// SetArchiveRetentionDays задает срок хранения заархивированных заказов (ARCHIVE_RETENTION_DAYS)
+func (os *OrderService) SetArchiveRetentionDays(days int) {
+	if days < 0 {
+		days = 0
+	}
+	os.retentionDays = days
+}
+
 // BootstrapState восстанавливает состояние активных заказов из PostgreSQL в Redis
 // Выполняется при старте сервера ПЕРЕД запуском Kafka consumer
 // Цель: восстановить операционное состояние после перезапуска
@@ -37,29 +48,13 @@ func (os *OrderService) BootstrapState() error {
 		return fmt.Errorf("database connection not available")
 	}
 	if os.redisUtil == nil {
-		return fmt.Errorf("Redis connection not available")
+		return ErrRedisUnavailable
 	}
 
 	startTime := time.Now()
 	log.Printf("🔄 BootstrapState: начало восстановления состояния из PostgreSQL...")
 
-	// Запрашиваем все активные заказы (pending, preparing, cooking, ready, delivery)
-	// Используем индекс (status, created_at) для быстрого поиска
-	query := `
-		SELECT 
-			id, display_id, customer_id, customer_first_name, customer_last_name,
-			customer_phone, delivery_address, payment_method, is_pickup, pickup_location_id,
-			call_before_minutes, items, is_set, set_name, total_price, discount_amount,
-			discount_percent, final_price, notes, status, created_at, updated_at,
-			completed_at, cancelled_at, target_slot_id, target_slot_start_time, visible_at,
-			branch_id, station_id, staff_id
-		FROM orders
-		WHERE status IN ('pending', 'preparing', 'cooking', 'ready', 'delivery')
-		ORDER BY created_at DESC
-		LIMIT 10000
-	`
-
-	rows, err := os.db.Query(query)
+	rows, err := os.db.Query(activeOrdersQuery)
 	if err != nil {
 		return fmt.Errorf("ошибка запроса активных заказов: %w", err)
 	}
@@ -77,89 +72,9 @@ func (os *OrderService) BootstrapState() error {
 	orderBatch := make([]models.PizzaOrder, 0, batchSize)
 
 	for rows.Next() {
-		var order models.PizzaOrder
-		var itemsJSON []byte
-		var targetSlotStartTime, visibleAt, completedAt, cancelledAt, updatedAt sql.NullTime
-		var customerID, callBeforeMinutes, discountAmount, discountPercent, finalPrice sql.NullInt64
-		var displayID, customerFirstName, customerLastName, customerPhone, deliveryAddress sql.NullString
-		var paymentMethod, pickupLocationID, setName, notes, targetSlotID sql.NullString
-		var branchID, stationID, staffID sql.NullString
-
-		err := rows.Scan(
-			&order.ID, &displayID, &customerID, &customerFirstName, &customerLastName,
-			&customerPhone, &deliveryAddress, &paymentMethod, &order.IsPickup, &pickupLocationID,
-			&callBeforeMinutes, &itemsJSON, &order.IsSet, &setName, &order.TotalPrice,
-			&discountAmount, &discountPercent, &finalPrice, &notes, &order.Status,
-			&order.CreatedAt, &updatedAt, &completedAt, &cancelledAt,
-			&targetSlotID, &targetSlotStartTime, &visibleAt, &branchID, &stationID, &staffID,
-		)
+		order, _, err := scanOrderRow(rows)
 		if err != nil {
-			log.Printf("⚠️ BootstrapState: ошибка сканирования заказа: %v", err)
-			continue
-		}
-
-		// Заполняем опциональные поля
-		if displayID.Valid {
-			order.DisplayID = displayID.String
-		}
-		if customerID.Valid {
-			order.CustomerID = int(customerID.Int64)
-		}
-		if customerFirstName.Valid {
-			order.CustomerFirstName = customerFirstName.String
-		}
-		if customerLastName.Valid {
-			order.CustomerLastName = customerLastName.String
-		}
-		if customerPhone.Valid {
-			order.CustomerPhone = customerPhone.String
-		}
-		if deliveryAddress.Valid {
-			order.DeliveryAddress = deliveryAddress.String
-		}
-		if paymentMethod.Valid {
-			order.PaymentMethod = paymentMethod.String
-		}
-		if pickupLocationID.Valid {
-			order.PickupLocationID = pickupLocationID.String
-		}
-		if callBeforeMinutes.Valid {
-			order.CallBeforeMinutes = int(callBeforeMinutes.Int64)
-		}
-		if setName.Valid {
-			order.SetName = setName.String
-		}
-		if discountAmount.Valid {
-			order.DiscountAmount = int(discountAmount.Int64)
-		}
-		if discountPercent.Valid {
-			order.DiscountPercent = int(discountPercent.Int64)
-		}
-		if finalPrice.Valid {
-			order.FinalPrice = int(finalPrice.Int64)
-		}
-		if notes.Valid {
-			order.Notes = notes.String
-		}
-		if targetSlotID.Valid {
-			order.TargetSlotID = targetSlotID.String
-		}
-		if targetSlotStartTime.Valid {
-			order.TargetSlotStartTime = targetSlotStartTime.Time
-		}
-		if visibleAt.Valid {
-			order.VisibleAt = visibleAt.Time
-		}
-		if completedAt.Valid {
-			// Можно добавить поле CompletedAt в модель, если нужно
-		}
-		if cancelledAt.Valid {
-			// Можно добавить поле CancelledAt в модель, если нужно
-		}
-
-		// Парсим JSON items
-		if err := json.Unmarshal(itemsJSON, &order.Items); err != nil {
-			log.Printf("⚠️ BootstrapState: ошибка парсинга items для заказа %s: %v", order.ID, err)
+			log.Printf("⚠️ BootstrapState: %v", err)
 			continue
 		}
 
@@ -200,55 +115,184 @@ func (os *OrderService) BootstrapState() error {
 	return nil
 }
 
+// activeOrdersQuery - все активные заказы (pending, preparing, cooking, ready, delivery), новые первыми
+// Используем индекс (status, created_at) для быстрого поиска
+var activeOrdersQuery = `
+		SELECT ` + orderSelectColumns + `
+		FROM orders
+		WHERE status IN ('pending', 'preparing', 'cooking', 'ready', 'delivery')
+		ORDER BY created_at DESC
+		LIMIT 10000
+	`
+
+// orderSelectColumns - колонки orders в порядке, который ожидает scanOrderRow
+const orderSelectColumns = `
+			id, display_id, customer_id, customer_first_name, customer_last_name,
+			customer_phone, delivery_address, payment_method, is_pickup, pickup_location_id,
+			call_before_minutes, items, is_set, set_name, total_price, discount_amount,
+			discount_percent, final_price, notes, status, created_at, updated_at,
+			completed_at, cancelled_at, target_slot_id, target_slot_start_time, visible_at,
+			branch_id, station_id, staff_id, channel, prep_seconds`
+
+// OrderRecord - заказ из PostgreSQL с отметками времени, которых нет в models.PizzaOrder
+type OrderRecord struct {
+	Order       models.PizzaOrder `json:"order"`
+	UpdatedAt   *time.Time        `json:"updated_at,omitempty"`
+	CompletedAt *time.Time        `json:"completed_at,omitempty"`
+	CancelledAt *time.Time        `json:"cancelled_at,omitempty"`
+}
+
+// rowScanner - общий интерфейс *sql.Row и *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanOrderRow читает строку orders (колонки orderSelectColumns)
+func scanOrderRow(row rowScanner) (models.PizzaOrder, OrderRecord, error) {
+	var order models.PizzaOrder
+	var record OrderRecord
+	var itemsJSON []byte
+	var targetSlotStartTime, visibleAt, completedAt, cancelledAt, updatedAt sql.NullTime
+	var customerID, callBeforeMinutes, discountAmount, discountPercent, finalPrice, prepSeconds sql.NullInt64
+	var displayID, customerFirstName, customerLastName, customerPhone, deliveryAddress sql.NullString
+	var paymentMethod, pickupLocationID, setName, notes, targetSlotID sql.NullString
+	var branchID, stationID, staffID, channel sql.NullString
+
+	err := row.Scan(
+		&order.ID, &displayID, &customerID, &customerFirstName, &customerLastName,
+		&customerPhone, &deliveryAddress, &paymentMethod, &order.IsPickup, &pickupLocationID,
+		&callBeforeMinutes, &itemsJSON, &order.IsSet, &setName, &order.TotalPrice,
+		&discountAmount, &discountPercent, &finalPrice, &notes, &order.Status,
+		&order.CreatedAt, &updatedAt, &completedAt, &cancelledAt,
+		&targetSlotID, &targetSlotStartTime, &visibleAt, &branchID, &stationID, &staffID,
+		&channel, &prepSeconds,
+	)
+	if err != nil {
+		return order, record, fmt.Errorf("ошибка сканирования заказа: %w", err)
+	}
+
+	// Заполняем опциональные поля
+	order.DisplayID = displayID.String
+	order.CustomerID = int(customerID.Int64)
+	order.CustomerFirstName = customerFirstName.String
+	order.CustomerLastName = customerLastName.String
+	order.CustomerPhone = customerPhone.String
+	order.DeliveryAddress = deliveryAddress.String
+	order.PaymentMethod = paymentMethod.String
+	order.PickupLocationID = pickupLocationID.String
+	order.Channel = channel.String
+	order.CallBeforeMinutes = int(callBeforeMinutes.Int64)
+	order.SetName = setName.String
+	order.DiscountAmount = int(discountAmount.Int64)
+	order.DiscountPercent = int(discountPercent.Int64)
+	order.FinalPrice = int(finalPrice.Int64)
+	order.Notes = notes.String
+	order.TargetSlotID = targetSlotID.String
+	if targetSlotStartTime.Valid {
+		order.TargetSlotStartTime = targetSlotStartTime.Time
+	}
+	if visibleAt.Valid {
+		order.VisibleAt = visibleAt.Time
+	}
+	order.PrepSeconds = int(prepSeconds.Int64)
+	order.RefreshDueAt()
+	if updatedAt.Valid {
+		record.UpdatedAt = &updatedAt.Time
+	}
+	if completedAt.Valid {
+		record.CompletedAt = &completedAt.Time
+	}
+	if cancelledAt.Valid {
+		record.CancelledAt = &cancelledAt.Time
+	}
+
+	// Парсим JSON items
+	if err := json.Unmarshal(itemsJSON, &order.Items); err != nil {
+		return order, record, fmt.Errorf("ошибка парсинга items для заказа %s: %w", order.ID, err)
+	}
+
+	record.Order = order
+	return order, record, nil
+}
+
+// GetOrderRecord загружает заказ из PostgreSQL (включая архивные); nil, если заказа нет
+func (os *OrderService) GetOrderRecord(orderID string) (*OrderRecord, error) {
+	if os.db == nil {
+		return nil, fmt.Errorf("database connection not available")
+	}
+
+	row := os.db.QueryRow(`SELECT `+orderSelectColumns+` FROM orders WHERE id = $1`, orderID)
+	_, record, err := scanOrderRow(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
 // restoreOrderBatch восстанавливает батч заказов в Redis
 func (os *OrderService) restoreOrderBatch(ctx context.Context, orders []models.PizzaOrder) (restored, pending, active int) {
 	for _, order := range orders {
-		// Сохраняем заказ в Redis
-		orderJSON, err := json.Marshal(order)
+		isPending, err := os.restoreOrder(order)
 		if err != nil {
-			log.Printf("⚠️ restoreOrderBatch: ошибка сериализации заказа %s: %v", order.ID, err)
+			log.Printf("⚠️ restoreOrderBatch: %v", err)
 			continue
 		}
-
-		orderKey := fmt.Sprintf("erp:order:%s", order.ID)
-		if err := os.redisUtil.SetBytes(orderKey, orderJSON, 24*time.Hour); err != nil {
-			log.Printf("⚠️ restoreOrderBatch: ошибка сохранения заказа %s в Redis: %v", order.ID, err)
-			continue
-		}
-
-		// Сохраняем метаданные слота
-		if order.TargetSlotID != "" {
-			slotKey := fmt.Sprintf("order:slot:start:%s", order.ID)
-			if !order.TargetSlotStartTime.IsZero() {
-				os.redisUtil.Set(slotKey, order.TargetSlotStartTime.Format(time.RFC3339), 24*time.Hour)
-			}
-		}
-
-		if !order.VisibleAt.IsZero() {
-			visibleAtKey := fmt.Sprintf("order:visible_at:%s", order.ID)
-			os.redisUtil.Set(visibleAtKey, order.VisibleAt.Format(time.RFC3339), 24*time.Hour)
-		}
-
-		// Определяем, в какой набор добавить заказ
-		now := time.Now().UTC()
-		if !order.VisibleAt.IsZero() && order.VisibleAt.After(now) {
-			// Заказ еще не должен быть показан - добавляем в pending_slots
-			os.redisUtil.SAdd("erp:orders:pending_slots", order.ID)
+		if isPending {
 			pending++
 		} else {
-			// Заказ должен быть показан - добавляем в active
-			os.redisUtil.SAdd("erp:orders:active", order.ID)
 			active++
 		}
 
 		// Обновляем счетчики
-		os.redisUtil.Increment("erp:orders:pending")
+		os.redisUtil.Increment(rediskeys.OrdersPendingKey)
 		restored++
 	}
 
 	return restored, pending, active
 }
 
+// restoreOrder сохраняет заказ и его метаданные (слот, VisibleAt) в Redis и добавляет его
+// в erp:orders:pending_slots (VisibleAt еще не наступил, isPending=true) или в erp:orders:active
+func (os *OrderService) restoreOrder(order models.PizzaOrder) (isPending bool, err error) {
+	// Сохраняем заказ в Redis
+	orderJSON, err := json.Marshal(order)
+	if err != nil {
+		return false, fmt.Errorf("ошибка сериализации заказа %s: %w", order.ID, err)
+	}
+
+	orderKey := rediskeys.OrderKey(order.ID)
+	if err := os.redisUtil.SetBytes(orderKey, orderJSON, rediskeys.OrderTTL()); err != nil {
+		return false, fmt.Errorf("ошибка сохранения заказа %s в Redis: %w", order.ID, err)
+	}
+
+	// Сохраняем метаданные слота
+	if order.TargetSlotID != "" {
+		slotKey := rediskeys.OrderSlotStartKey(order.ID)
+		if !order.TargetSlotStartTime.IsZero() {
+			os.redisUtil.Set(slotKey, order.TargetSlotStartTime.Format(time.RFC3339), rediskeys.OrderTTL())
+		}
+	}
+
+	if !order.VisibleAt.IsZero() {
+		visibleAtKey := rediskeys.OrderVisibleAtKey(order.ID)
+		os.redisUtil.Set(visibleAtKey, order.VisibleAt.Format(time.RFC3339), rediskeys.OrderTTL())
+	}
+
+	// Определяем, в какой набор добавить заказ
+	now := time.Now().UTC()
+	if !order.VisibleAt.IsZero() && order.VisibleAt.After(now) {
+		// Заказ еще не должен быть показан - добавляем в pending_slots
+		os.redisUtil.SAdd(rediskeys.OrdersPendingSlotsKey, order.ID)
+		return true, nil
+	}
+	// Заказ должен быть показан - добавляем в active
+	os.redisUtil.SAdd(rediskeys.OrdersActiveKey, order.ID)
+	return false, nil
+}
+
 // ArchiveOldOrders архивирует старые заказы (старше 1 года) для переноса в холодное хранилище
 // Вызывается фоновым воркером раз в день
 func (os *OrderService) ArchiveOldOrders() error {
@@ -259,13 +303,13 @@ func (os *OrderService) ArchiveOldOrders() error {
 	startTime := time.Now()
 	log.Printf("🗄️ ArchiveOldOrders: начало архивирования старых заказов...")
 
-	// Находим заказы старше 1 года со статусом delivered или cancelled
+	// Находим заказы старше 1 года в финальном статусе (completed/delivered или cancelled)
 	cutoffDate := time.Now().AddDate(-1, 0, 0)
 	
 	query := `
 		UPDATE orders
 		SET status = 'archived', updated_at = NOW()
-		WHERE status IN ('delivered', 'cancelled')
+		WHERE status IN ('completed', 'delivered', 'cancelled')
 		AND created_at < $1
 		AND status != 'archived'
 	`
@@ -283,9 +327,52 @@ func (os *OrderService) ArchiveOldOrders() error {
 	duration := time.Since(startTime)
 	log.Printf("✅ ArchiveOldOrders: заархивировано %d заказов за %v", rowsAffected, duration)
 
+	// Удаляем архив старше срока хранения, иначе таблица orders растет бесконечно
+	if os.retentionDays > 0 {
+		purged, err := os.PurgeArchivedOrders(time.Now().AddDate(0, 0, -os.retentionDays), false)
+		if err != nil {
+			return err
+		}
+		log.Printf("🧹 ArchiveOldOrders: удалено %d заархивированных заказов старше %d дней", purged, os.retentionDays)
+	}
+
 	return nil
 }
 
+// PurgeArchivedOrders удаляет заархивированные заказы, созданные раньше before
+// dryRun = true только считает заказы, которые были бы удалены
+func (os *OrderService) PurgeArchivedOrders(before time.Time, dryRun bool) (int64, error) {
+	if os.db == nil {
+		return 0, fmt.Errorf("database connection not available")
+	}
+
+	if dryRun {
+		var count int64
+		err := os.db.QueryRow(`
+			SELECT COUNT(*) FROM orders
+			WHERE status = 'archived' AND created_at < $1
+		`, before).Scan(&count)
+		if err != nil {
+			return 0, fmt.Errorf("ошибка подсчета заархивированных заказов: %w", err)
+		}
+		return count, nil
+	}
+
+	result, err := os.db.Exec(`
+		DELETE FROM orders
+		WHERE status = 'archived' AND created_at < $1
+	`, before)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка удаления заархивированных заказов: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения количества удаленных заказов: %w", err)
+	}
+	return rowsAffected, nil
+}
+
 // SaveOrder сохраняет заказ в PostgreSQL (использует транзакционную версию)
 func (os *OrderService) SaveOrder(order models.PizzaOrder) error {
 	return os.SaveOrderWithTransaction(order)
@@ -360,14 +447,14 @@ func (os *OrderService) saveOrderInTransaction(order models.PizzaOrder) error {
 			customer_phone, delivery_address, payment_method, is_pickup, pickup_location_id,
 			call_before_minutes, items, is_set, set_name, total_price, discount_amount,
 			discount_percent, final_price, notes, status, created_at, updated_at,
-			target_slot_id, target_slot_start_time, visible_at
+			target_slot_id, target_slot_start_time, visible_at, channel, prep_seconds
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27
 		)
 		ON CONFLICT (id) DO UPDATE SET
 			status = EXCLUDED.status,
 			updated_at = NOW(),
-			completed_at = CASE WHEN EXCLUDED.status = 'delivered' THEN NOW() ELSE orders.completed_at END,
+			completed_at = CASE WHEN EXCLUDED.status IN ('completed', 'delivered') THEN NOW() ELSE orders.completed_at END,
 			cancelled_at = CASE WHEN EXCLUDED.status = 'cancelled' THEN NOW() ELSE orders.cancelled_at END
 	`
 
@@ -377,6 +464,8 @@ func (os *OrderService) saveOrderInTransaction(order models.PizzaOrder) error {
 		order.CallBeforeMinutes, itemsJSON, order.IsSet, order.SetName, order.TotalPrice,
 		order.DiscountAmount, order.DiscountPercent, order.FinalPrice, order.Notes, order.Status,
 		order.CreatedAt, time.Now(), order.TargetSlotID, order.TargetSlotStartTime, order.VisibleAt,
+		sql.NullString{String: order.Channel, Valid: order.Channel != ""},
+		sql.NullInt64{Int64: int64(order.PrepSeconds), Valid: order.PrepSeconds > 0},
 	)
 
 	if err != nil {
@@ -420,7 +509,7 @@ func (os *OrderService) UpdateOrderStatus(orderID string, status string) error {
 	query := `
 		UPDATE orders
 		SET status = $1, updated_at = NOW(),
-			completed_at = CASE WHEN $1 = 'delivered' THEN NOW() ELSE completed_at END,
+			completed_at = CASE WHEN $1 IN ('completed', 'delivered') THEN NOW() ELSE completed_at END,
 			cancelled_at = CASE WHEN $1 = 'cancelled' THEN NOW() ELSE cancelled_at END
 		WHERE id = $2
 	`
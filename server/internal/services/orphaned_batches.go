@@ -0,0 +1,171 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"gorm.io/gorm/clause"
+)
+
+// Действия над осиротевшими партиями (номенклатура удалена)
+const (
+	OrphanActionWriteOff = "write_off" // Списать остаток партии
+	OrphanActionRelink   = "relink"    // Перепривязать партию к другой номенклатуре
+)
+
+// ErrBatchNotOrphaned - партия привязана к действующей номенклатуре, сверка к ней не применяется
+var ErrBatchNotOrphaned = errors.New("партия привязана к действующей номенклатуре")
+
+// orphanedBatchesLogged - номенклатуры, об осиротевших партиях которых GetStockItems уже писал в лог
+var orphanedBatchesLogged sync.Map
+
+// OrphanedBatch - партия с остатком, номенклатура которой удалена (soft delete) или отсутствует
+type OrphanedBatch struct {
+	BatchID               string     `json:"batch_id"`
+	NomenclatureID        string     `json:"nomenclature_id"`
+	ProductName           string     `json:"product_name"` // Имя удаленной номенклатуры (пусто, если строки нет)
+	BranchID              string     `json:"branch_id"`
+	RemainingQuantity     float64    `json:"remaining_quantity"`
+	Unit                  string     `json:"unit"`
+	CostPerUnit           float64    `json:"cost_per_unit"`
+	ExpiryAt              *time.Time `json:"expiry_at"`
+	CreatedAt             time.Time  `json:"created_at"`
+	NomenclatureDeletedAt *time.Time `json:"nomenclature_deleted_at"` // nil - номенклатуры нет в таблице
+}
+
+// logOrphanedBatchOnce пишет в лог о партии без номенклатуры один раз на номенклатуру за время жизни процесса
+func logOrphanedBatchOnce(batch models.StockBatch) {
+	if _, logged := orphanedBatchesLogged.LoadOrStore(batch.NomenclatureID, true); logged {
+		return
+	}
+	log.Printf("⚠️ GetStockItems: партии номенклатуры %s пропущены - номенклатура удалена (пример: партия %s, филиал %s). Сверка: GET /api/v1/inventory/stock/orphaned-batches",
+		batch.NomenclatureID, batch.ID, batch.BranchID)
+}
+
+// GetOrphanedBatches возвращает партии с остатком, номенклатура которых удалена или отсутствует
+func (s *StockService) GetOrphanedBatches(branchID string) ([]OrphanedBatch, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("PostgreSQL недоступен")
+	}
+
+	query := s.db.Table("stock_batches AS sb").
+		Select(`sb.id AS batch_id, sb.nomenclature_id, COALESCE(ni.name, '') AS product_name, sb.branch_id,
+			sb.remaining_quantity, sb.unit, sb.cost_per_unit, sb.expiry_at, sb.created_at,
+			ni.deleted_at AS nomenclature_deleted_at`).
+		Joins("LEFT JOIN nomenclature_items ni ON ni.id = sb.nomenclature_id").
+		Where("sb.deleted_at IS NULL AND sb.remaining_quantity > 0").
+		Where("ni.id IS NULL OR ni.deleted_at IS NOT NULL")
+	if branchID != "" && branchID != "all" {
+		query = query.Where("sb.branch_id = ?", branchID)
+	}
+
+	var batches []OrphanedBatch
+	if err := query.Order("sb.created_at ASC").Scan(&batches).Error; err != nil {
+		return nil, fmt.Errorf("ошибка поиска осиротевших партий: %w", err)
+	}
+	return batches, nil
+}
+
+// ReconcileOrphanedBatches списывает (write_off) или перепривязывает (relink) осиротевшие партии
+// Для relink целевая номенклатура должна быть действующей, а ее базовая единица - совпадать с единицей партии.
+// Каждое изменение пишется в журнал движений; все партии обрабатываются в одной транзакции
+func (s *StockService) ReconcileOrphanedBatches(batchIDs []string, action, targetNomenclatureID, performedBy string) (int, error) {
+	if s.db == nil {
+		return 0, fmt.Errorf("PostgreSQL недоступен")
+	}
+	if len(batchIDs) == 0 {
+		return 0, fmt.Errorf("не указаны партии")
+	}
+	if action != OrphanActionWriteOff && action != OrphanActionRelink {
+		return 0, fmt.Errorf("неизвестное действие '%s', допустимо: %s, %s", action, OrphanActionWriteOff, OrphanActionRelink)
+	}
+
+	var target models.NomenclatureItem
+	if action == OrphanActionRelink {
+		if targetNomenclatureID == "" {
+			return 0, fmt.Errorf("для relink нужна target_nomenclature_id")
+		}
+		if err := s.db.First(&target, "id = ?", targetNomenclatureID).Error; err != nil {
+			return 0, fmt.Errorf("целевая номенклатура не найдена: %w", err)
+		}
+		if !target.IsActive {
+			return 0, fmt.Errorf("целевая номенклатура '%s' неактивна", target.Name)
+		}
+	}
+
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var batches []models.StockBatch
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", batchIDs).Find(&batches).Error; err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("ошибка загрузки партий: %w", err)
+	}
+	if len(batches) != len(batchIDs) {
+		tx.Rollback()
+		return 0, fmt.Errorf("найдено %d из %d партий", len(batches), len(batchIDs))
+	}
+
+	for _, batch := range batches {
+		// Проверяем под блокировкой: номенклатуру могли восстановить после получения списка
+		var active int64
+		if err := tx.Model(&models.NomenclatureItem{}).
+			Where("id = ?", batch.NomenclatureID).Count(&active).Error; err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("ошибка проверки номенклатуры партии %s: %w", batch.ID, err)
+		}
+		if active > 0 {
+			tx.Rollback()
+			return 0, fmt.Errorf("%w: партия %s", ErrBatchNotOrphaned, batch.ID)
+		}
+
+		if action == OrphanActionWriteOff {
+			if err := writeOffBatchRemainder(tx, batch, performedBy, "Списание партии удаленной номенклатуры"); err != nil {
+				tx.Rollback()
+				return 0, err
+			}
+			continue
+		}
+
+		if normalizeUnit(batch.Unit) != normalizeUnit(target.BaseUnit) {
+			tx.Rollback()
+			return 0, fmt.Errorf("единица партии %s (%s) не совпадает с базовой единицей '%s' (%s)",
+				batch.ID, batch.Unit, target.Name, target.BaseUnit)
+		}
+		if err := tx.Model(&batch).Update("nomenclature_id", target.ID).Error; err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("ошибка перепривязки партии %s: %w", batch.ID, err)
+		}
+		movement := models.StockMovement{
+			StockBatchID:   &batch.ID,
+			NomenclatureID: target.ID,
+			BranchID:       batch.BranchID,
+			Quantity:       0, // Остаток не меняется - только номенклатура
+			Unit:           batch.Unit,
+			MovementType:   "adjustment",
+			PerformedBy:    performedBy,
+			Notes:          fmt.Sprintf("Перепривязка партии с удаленной номенклатуры %s на '%s'", batch.NomenclatureID, target.Name),
+		}
+		if err := tx.Create(&movement).Error; err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("ошибка записи в журнал движений: %w", err)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, fmt.Errorf("ошибка коммита транзакции: %w", err)
+	}
+
+	log.Printf("🧹 ReconcileOrphanedBatches: %s, партий: %d (by %s)", action, len(batches), performedBy)
+	return len(batches), nil
+}
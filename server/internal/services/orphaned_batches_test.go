@@ -0,0 +1,139 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// О партиях одной удаленной номенклатуры лог пишется один раз, о другой номенклатуре - отдельно
+func TestLogOrphanedBatchOnce(t *testing.T) {
+	var buf bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(previous) })
+
+	first, second := uuid.New().String(), uuid.New().String()
+	logOrphanedBatchOnce(models.StockBatch{ID: "batch-1", NomenclatureID: first, BranchID: "branch-1"})
+	logOrphanedBatchOnce(models.StockBatch{ID: "batch-2", NomenclatureID: first, BranchID: "branch-2"})
+	logOrphanedBatchOnce(models.StockBatch{ID: "batch-3", NomenclatureID: second, BranchID: "branch-1"})
+
+	output := buf.String()
+	if got := strings.Count(output, first); got != 1 {
+		t.Errorf("записей о номенклатуре %s: %d, want 1\n%s", first, got, output)
+	}
+	if !strings.Contains(output, "batch-1") || strings.Contains(output, "batch-2") || !strings.Contains(output, second) {
+		t.Errorf("лог %q, want первую партию каждой номенклатуры", output)
+	}
+}
+
+// Партии удаленного сыра попадают в список осиротевших и не попадают в остатки; сверка перепривязывает
+// одну партию к действующему товару и списывает другую
+func TestOrphanedBatches(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureCategory{}, &models.NomenclatureItem{}, &models.StockBatch{}, &models.StockMovement{})
+	service := NewStockService(db)
+	branchID := uuid.New().String()
+	suffix := uuid.New().String()[:8]
+
+	var itemIDs []string
+	newItem := func(name, baseUnit string) models.NomenclatureItem {
+		t.Helper()
+		item := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: name + " " + suffix, BaseUnit: baseUnit, IsActive: true}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("не удалось создать товар: %v", err)
+		}
+		itemIDs = append(itemIDs, item.ID)
+		return item
+	}
+	newBatch := func(nomenclatureID string, quantity float64) models.StockBatch {
+		t.Helper()
+		batch := models.StockBatch{NomenclatureID: nomenclatureID, BranchID: branchID, Quantity: 1000, RemainingQuantity: quantity,
+			Unit: "g", CostPerUnit: 0.5, Source: "adjustment"}
+		if err := db.Create(&batch).Error; err != nil {
+			t.Fatalf("не удалось создать партию: %v", err)
+		}
+		return batch
+	}
+	t.Cleanup(func() {
+		db.Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Unscoped().Where("id IN ?", itemIDs).Delete(&models.NomenclatureItem{})
+	})
+
+	flour := newItem("Мука", "g")
+	bottles := newItem("Масло", "pcs")
+	oldCheese := newItem("Старый сыр", "g")
+	active := newBatch(flour.ID, 1000)
+	orphanA := newBatch(oldCheese.ID, 500)
+	orphanB := newBatch(oldCheese.ID, 200)
+	newBatch(oldCheese.ID, 0) // Пустая партия сверки не требует
+	if err := db.Delete(&oldCheese).Error; err != nil {
+		t.Fatalf("не удалось удалить товар: %v", err)
+	}
+
+	orphaned, err := service.GetOrphanedBatches(branchID)
+	if err != nil {
+		t.Fatalf("GetOrphanedBatches: %v", err)
+	}
+	if len(orphaned) != 2 || orphaned[0].BatchID != orphanA.ID || orphaned[1].BatchID != orphanB.ID {
+		t.Fatalf("осиротевшие партии %+v, want %s и %s", orphaned, orphanA.ID, orphanB.ID)
+	}
+	if orphaned[0].ProductName != oldCheese.Name || orphaned[0].NomenclatureDeletedAt == nil || orphaned[0].RemainingQuantity != 500 {
+		t.Errorf("осиротевшая партия %+v, want имя удаленного товара, дату удаления и остаток 500", orphaned[0])
+	}
+	if other, err := service.GetOrphanedBatches(uuid.New().String()); err != nil || len(other) != 0 {
+		t.Errorf("другой филиал: %+v (err=%v), want пусто", other, err)
+	}
+
+	// Остатки: только мука, без строки с пустой единицей от удаленного сыра
+	items, err := service.GetStockItems(branchID, false)
+	if err != nil {
+		t.Fatalf("GetStockItems: %v", err)
+	}
+	if len(items) != 1 || items[0]["id"] != flour.ID {
+		t.Errorf("остатки %v, want только мука", items)
+	}
+
+	// Сверка проверяет действие, партию и единицу целевого товара
+	if _, err := service.ReconcileOrphanedBatches([]string{orphanA.ID}, "delete", "", "кладовщик"); err == nil {
+		t.Error("неизвестное действие: want ошибку")
+	}
+	if _, err := service.ReconcileOrphanedBatches([]string{active.ID}, OrphanActionWriteOff, "", "кладовщик"); !errors.Is(err, ErrBatchNotOrphaned) {
+		t.Errorf("партия действующего товара: %v, want ErrBatchNotOrphaned", err)
+	}
+	if _, err := service.ReconcileOrphanedBatches([]string{orphanA.ID}, OrphanActionRelink, bottles.ID, "кладовщик"); err == nil {
+		t.Error("перепривязка граммов к товару в штуках: want ошибку")
+	}
+
+	count, err := service.ReconcileOrphanedBatches([]string{orphanA.ID}, OrphanActionRelink, flour.ID, "кладовщик")
+	if err != nil || count != 1 {
+		t.Fatalf("relink: %d, %v", count, err)
+	}
+	count, err = service.ReconcileOrphanedBatches([]string{orphanB.ID}, OrphanActionWriteOff, "", "кладовщик")
+	if err != nil || count != 1 {
+		t.Fatalf("write_off: %d, %v", count, err)
+	}
+
+	var relinked, writtenOff models.StockBatch
+	db.First(&relinked, "id = ?", orphanA.ID)
+	db.First(&writtenOff, "id = ?", orphanB.ID)
+	if relinked.NomenclatureID != flour.ID || relinked.RemainingQuantity != 500 {
+		t.Errorf("перепривязанная партия: товар %s, остаток %v; want %s и 500", relinked.NomenclatureID, relinked.RemainingQuantity, flour.ID)
+	}
+	if writtenOff.RemainingQuantity != 0 {
+		t.Errorf("списанная партия: остаток %v, want 0", writtenOff.RemainingQuantity)
+	}
+	var waste models.StockMovement
+	if err := db.Where("stock_batch_id = ? AND movement_type = ?", orphanB.ID, "waste").First(&waste).Error; err != nil || waste.Quantity != -200 {
+		t.Errorf("движение списания %+v (err=%v), want -200", waste, err)
+	}
+	if orphaned, err := service.GetOrphanedBatches(branchID); err != nil || len(orphaned) != 0 {
+		t.Errorf("после сверки осиротевшие партии %+v (err=%v), want пусто", orphaned, err)
+	}
+}
@@ -59,10 +59,17 @@ func (ps *PLUService) FindPLUByProductName(productName string) (*models.PLUCode,
 
 // SuggestSKU предлагает SKU на основе PLU кода или генерирует уникальный
 func (ps *PLUService) SuggestSKU(productName string, branchID string) (string, error) {
+	sku, _, err := ps.suggestSKU(productName, branchID, ps.isSKUUnique)
+	return sku, err
+}
+
+// suggestSKU подбирает SKU для productName: isAvailable решает, свободен ли SKU
+// (в базе, а для пакетного подбора - еще и среди уже предложенных). Возвращает и найденный PLU код
+func (ps *PLUService) suggestSKU(productName string, branchID string, isAvailable func(sku string) bool) (string, *models.PLUCode, error) {
 	// Сначала пытаемся найти PLU код
 	plu, err := ps.FindPLUByProductName(productName)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	if plu != nil {
@@ -75,16 +82,16 @@ func (ps *PLUService) SuggestSKU(productName string, branchID string) (string, e
 		}
 		
 		// Проверяем уникальность
-		if ps.isSKUUnique(sku) {
-			return sku, nil
+		if isAvailable(sku) {
+			return sku, plu, nil
 		}
 		
 		// Если не уникален, добавляем суффикс
 		counter := 1
 		for {
 			newSKU := fmt.Sprintf("%s-%d", sku, counter)
-			if ps.isSKUUnique(newSKU) {
-				return newSKU, nil
+			if isAvailable(newSKU) {
+				return newSKU, plu, nil
 			}
 			counter++
 			if counter > 999 {
@@ -94,7 +101,64 @@ func (ps *PLUService) SuggestSKU(productName string, branchID string) (string, e
 	}
 
 	// Если PLU не найден, генерируем SKU на основе названия
-	return ps.generateSKUFromName(productName, branchID), nil
+	return ps.generateSKUFromName(productName, branchID, isAvailable), plu, nil
+}
+
+// MaxSKUSuggestionBatch - сколько SKU можно подобрать за один пакетный запрос
+const MaxSKUSuggestionBatch = 5000
+
+// SKUSuggestionRequest - строка импорта без SKU
+type SKUSuggestionRequest struct {
+	Name     string `json:"name"`
+	Category string `json:"category,omitempty"`
+}
+
+// SKUSuggestion - предложенный SKU для строки импорта (в порядке запроса)
+type SKUSuggestion struct {
+	Name       string          `json:"name"`
+	Category   string          `json:"category,omitempty"`
+	SKU        string          `json:"sku"`
+	PLU        *models.PLUCode `json:"plu"`
+	IsPLUBased bool            `json:"is_plu_based"`
+}
+
+// SuggestSKUBatch подбирает SKU для всех строк импорта за один вызов, так же как SuggestSKU
+// Предложенные SKU уникальны и между собой (одинаковые названия получают разные SKU), и относительно базы.
+// Ничего не резервируется в базе: SKU проверяются заново при сохранении товаров
+func (ps *PLUService) SuggestSKUBatch(items []SKUSuggestionRequest, branchID string) ([]SKUSuggestion, error) {
+	if len(items) > MaxSKUSuggestionBatch {
+		return nil, fmt.Errorf("слишком много строк: %d (максимум %d)", len(items), MaxSKUSuggestionBatch)
+	}
+
+	proposed := make(map[string]bool, len(items))
+	isAvailable := func(sku string) bool {
+		return !proposed[sku] && ps.isSKUUnique(sku)
+	}
+
+	suggestions := make([]SKUSuggestion, 0, len(items))
+	for i, item := range items {
+		name := strings.TrimSpace(item.Name)
+		if name == "" {
+			return nil, fmt.Errorf("строка %d: не указано название продукта", i+1)
+		}
+		sku, plu, err := ps.suggestSKU(name, branchID, isAvailable)
+		if err != nil {
+			return nil, fmt.Errorf("строка %d (%s): %w", i+1, name, err)
+		}
+		// Запасной AUTO-SKU не проверяется генератором - разводим совпадения суффиксом
+		for base, counter := sku, 1; proposed[sku]; counter++ {
+			sku = fmt.Sprintf("%s-%d", base, counter)
+		}
+		proposed[sku] = true
+		suggestions = append(suggestions, SKUSuggestion{
+			Name:       item.Name,
+			Category:   item.Category,
+			SKU:        sku,
+			PLU:        plu,
+			IsPLUBased: plu != nil,
+		})
+	}
+	return suggestions, nil
 }
 
 // isSKUUnique проверяет уникальность SKU в базе данных
@@ -113,7 +177,7 @@ func (ps *PLUService) isSKUUnique(sku string) bool {
 
 // generateSKUFromName генерирует SKU на основе названия продукта
 // Использует безопасный диапазон 8000-9999 для нестандартных товаров (не конфликтует с PLU)
-func (ps *PLUService) generateSKUFromName(productName string, branchID string) string {
+func (ps *PLUService) generateSKUFromName(productName string, branchID string, isAvailable func(sku string) bool) string {
 	// Генерируем числовой SKU в безопасном диапазоне 8000-9999
 	// Это не конфликтует со стандартными PLU кодами (3000-6999)
 	baseSKU := ps.generateNumericSKU(productName)
@@ -123,11 +187,11 @@ func (ps *PLUService) generateSKUFromName(productName string, branchID string) s
 	sku := baseSKU
 	maxAttempts := 2000 // 8000-9999 = 2000 возможных значений
 	
-	for !ps.isSKUUnique(sku) || ps.isStandardPLU(sku) {
+	for !isAvailable(sku) || ps.isStandardPLU(sku) {
 		counter++
 		if counter >= maxAttempts {
 			// Если не удалось найти уникальный в диапазоне, используем буквенно-цифровой формат
-			return ps.generateAlphanumericSKU(productName, branchID)
+			return ps.generateAlphanumericSKU(productName, branchID, isAvailable)
 		}
 		
 		// Пробуем следующее число в диапазоне 8000-9999
@@ -150,7 +214,7 @@ func (ps *PLUService) generateNumericSKU(productName string) string {
 }
 
 // generateAlphanumericSKU генерирует буквенно-цифровой SKU (fallback)
-func (ps *PLUService) generateAlphanumericSKU(productName string, branchID string) string {
+func (ps *PLUService) generateAlphanumericSKU(productName string, branchID string, isAvailable func(sku string) bool) string {
 	// Нормализуем название
 	normalizedName := normalizeProductName(productName)
 	
@@ -174,7 +238,7 @@ func (ps *PLUService) generateAlphanumericSKU(productName string, branchID strin
 	// Убеждаемся, что SKU уникален и не конфликтует с PLU
 	baseSKU := sku
 	counter := 1
-	for !ps.isSKUUnique(sku) || ps.isStandardPLU(sku) {
+	for !isAvailable(sku) || ps.isStandardPLU(sku) {
 		sku = fmt.Sprintf("%s-%d", baseSKU, counter)
 		counter++
 		if counter > 999 {
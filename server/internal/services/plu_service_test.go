@@ -0,0 +1,60 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// 50 строк импорта: две с одинаковым названием и одна, чей SKU по хешу названия уже занят товаром в базе
+func TestSuggestSKUBatchReturnsDistinctSKUs(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.PLUCode{})
+	service := NewPLUService(db)
+
+	suffix := uuid.New().String()[:8]
+	takenName := "Перец " + suffix
+	existing := models.NomenclatureItem{SKU: service.generateNumericSKU(takenName), Name: takenName, BaseUnit: "g", IsActive: true}
+	if err := db.Create(&existing).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("id = ?", existing.ID).Delete(&models.NomenclatureItem{})
+	})
+
+	items := []SKUSuggestionRequest{
+		{Name: "Соль " + suffix, Category: "Бакалея"},
+		{Name: "Соль " + suffix, Category: "Бакалея"},
+		{Name: takenName, Category: "Овощи"},
+	}
+	for i := len(items); i < 50; i++ {
+		items = append(items, SKUSuggestionRequest{Name: fmt.Sprintf("Товар %s №%d", suffix, i)})
+	}
+
+	suggestions, err := service.SuggestSKUBatch(items, "")
+	if err != nil {
+		t.Fatalf("SuggestSKUBatch: %v", err)
+	}
+	if len(suggestions) != len(items) {
+		t.Fatalf("предложений %d, want %d", len(suggestions), len(items))
+	}
+
+	seen := make(map[string]int)
+	for i, suggestion := range suggestions {
+		if suggestion.Name != items[i].Name || suggestion.Category != items[i].Category {
+			t.Errorf("строка %d: %+v, want порядок и поля запроса (%+v)", i, suggestion, items[i])
+		}
+		if suggestion.SKU == "" {
+			t.Errorf("строка %d: пустой SKU", i)
+		}
+		if prev, ok := seen[suggestion.SKU]; ok {
+			t.Errorf("SKU %s повторяется в строках %d и %d", suggestion.SKU, prev, i)
+		}
+		seen[suggestion.SKU] = i
+		if suggestion.SKU == existing.SKU {
+			t.Errorf("строка %d: SKU %s уже занят товаром в базе", i, suggestion.SKU)
+		}
+	}
+}
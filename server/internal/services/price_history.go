@@ -0,0 +1,118 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"zephyrvpn/server/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// priceTrailingWindow - сколько последних закупок товара входит в скользящее среднее
+const priceTrailingWindow = 5
+
+// PriceChangeAlert - закупочная цена товара выросла относительно скользящего среднего
+type PriceChangeAlert struct {
+	NomenclatureID   string  `json:"nomenclature_id"`
+	NomenclatureName string  `json:"nomenclature_name"`
+	CounterpartyID   string  `json:"counterparty_id"`
+	InvoiceID        string  `json:"invoice_id"`
+	Price            float64 `json:"price"`         // За InboundUnit, в рублях
+	TrailingAverage  float64 `json:"trailing_average"`
+	IncreasePercent  float64 `json:"increase_percent"`
+}
+
+// SetPriceAlert настраивает уведомление о росте закупочной цены
+// thresholdPercent - на сколько процентов цена должна превысить скользящее среднее (0 = отключено)
+func (s *StockService) SetPriceAlert(thresholdPercent float64, notify func(alerts []PriceChangeAlert)) {
+	s.priceAlertThreshold = thresholdPercent
+	s.onPriceAlert = notify
+}
+
+// recordPriceHistory записывает цены накладной в историю (в транзакции оприходования)
+// Возвращает товары, цена которых превысила скользящее среднее больше чем на порог
+func (s *StockService) recordPriceHistory(tx *gorm.DB, prices map[string]decimal.Decimal, counterpartyID, invoiceID, branchID string, priceDate time.Time) ([]PriceChangeAlert, error) {
+	alerts := make([]PriceChangeAlert, 0)
+	var counterpartyRef *string
+	if counterpartyID != "" {
+		counterpartyRef = &counterpartyID
+	}
+
+	for nomID, price := range prices {
+		priceValue := price.Round(2).InexactFloat64()
+
+		// Среднее считаем до вставки новой цены - по всем поставщикам товара
+		var previous []float64
+		if err := tx.Model(&models.PriceHistory{}).
+			Where("nomenclature_id = ?", nomID).
+			Order("price_date DESC, created_at DESC").
+			Limit(priceTrailingWindow).
+			Pluck("price", &previous).Error; err != nil {
+			return nil, fmt.Errorf("ошибка загрузки истории цен товара %s: %w", nomID, err)
+		}
+
+		entry := models.PriceHistory{
+			NomenclatureID: nomID,
+			CounterpartyID: counterpartyRef,
+			InvoiceID:      &invoiceID,
+			BranchID:       branchID,
+			Price:          priceValue,
+			PriceDate:      priceDate,
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return nil, fmt.Errorf("ошибка записи истории цен товара %s: %w", nomID, err)
+		}
+
+		if alert, ok := priceChangeAlert(priceValue, previous, s.priceAlertThreshold); ok {
+			alert.NomenclatureID = nomID
+			alert.CounterpartyID = counterpartyID
+			alert.InvoiceID = invoiceID
+			var nomenclature models.NomenclatureItem
+			if err := tx.Select("id", "name").First(&nomenclature, "id = ?", nomID).Error; err == nil {
+				alert.NomenclatureName = nomenclature.Name
+			}
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts, nil
+}
+
+// priceChangeAlert сравнивает цену со средним предыдущих закупок
+// Без истории или с выключенным порогом уведомления нет
+func priceChangeAlert(price float64, previous []float64, thresholdPercent float64) (PriceChangeAlert, bool) {
+	if thresholdPercent <= 0 || len(previous) == 0 {
+		return PriceChangeAlert{}, false
+	}
+	sum := 0.0
+	for _, p := range previous {
+		sum += p
+	}
+	average := sum / float64(len(previous))
+	if average <= 0 {
+		return PriceChangeAlert{}, false
+	}
+
+	increase := (price - average) / average * 100
+	if increase <= thresholdPercent {
+		return PriceChangeAlert{}, false
+	}
+	return PriceChangeAlert{
+		Price:           price,
+		TrailingAverage: decimal.NewFromFloat(average).Round(2).InexactFloat64(),
+		IncreasePercent: decimal.NewFromFloat(increase).Round(1).InexactFloat64(),
+	}, true
+}
+
+// notifyPriceAlerts отправляет уведомления о росте цен (после коммита накладной)
+func (s *StockService) notifyPriceAlerts(alerts []PriceChangeAlert) {
+	if len(alerts) == 0 {
+		return
+	}
+	log.Printf("📈 Рост закупочных цен: %d товаров дороже скользящего среднего более чем на %.0f%%", len(alerts), s.priceAlertThreshold)
+	if s.onPriceAlert != nil {
+		s.onPriceAlert(alerts)
+	}
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestPriceChangeAlert(t *testing.T) {
+	tests := []struct {
+		name      string
+		price     float64
+		previous  []float64
+		threshold float64
+		want      bool
+		increase  float64
+	}{
+		{"рост на 30% при пороге 25%", 130, []float64{100, 100}, 25, true, 30},
+		{"среднее по всем предыдущим", 130, []float64{90, 110, 100}, 25, true, 30},
+		{"рост ровно на порог", 125, []float64{100}, 25, false, 0},
+		{"снижение цены", 80, []float64{100}, 25, false, 0},
+		{"первая закупка без истории", 500, nil, 25, false, 0},
+		{"порог выключен", 1000, []float64{100}, 0, false, 0},
+		{"нулевые прошлые цены", 100, []float64{0, 0}, 25, false, 0},
+	}
+	for _, tt := range tests {
+		alert, ok := priceChangeAlert(tt.price, tt.previous, tt.threshold)
+		if ok != tt.want {
+			t.Errorf("%s: уведомление %v, want %v", tt.name, ok, tt.want)
+			continue
+		}
+		if ok && (alert.Price != tt.price || alert.IncreasePercent != tt.increase || alert.TrailingAverage != 100) {
+			t.Errorf("%s: %+v, want цена %v, среднее 100, рост %v%%", tt.name, alert, tt.price, tt.increase)
+		}
+	}
+}
+
+// Три накладные по 100₽, 100₽ и 130₽ за кг: все цены попадают в историю, рост на 30% дает уведомление
+func TestInboundPriceHistoryAndAlert(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.NomenclatureItem{}, &models.Counterparty{},
+		&models.Invoice{}, &models.StockBatch{}, &models.StockMovement{}, &models.PriceHistory{})
+	service := NewStockService(db)
+	branchID := newTestBranch(t, db)
+	supplierID := newTestCounterparty(t, db)
+
+	item := models.NomenclatureItem{
+		SKU:              "TEST-" + uuid.New().String()[:8],
+		Name:             "Моцарелла",
+		BaseUnit:         "g",
+		InboundUnit:      "kg",
+		ConversionFactor: 1000,
+		IsActive:         true,
+	}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Where("nomenclature_id = ?", item.ID).Delete(&models.PriceHistory{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.Invoice{})
+		db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+	})
+
+	var alerts []PriceChangeAlert
+	service.SetPriceAlert(25, func(batch []PriceChangeAlert) {
+		alerts = append(alerts, batch...)
+	})
+	receive := func(price float64, date string) {
+		t.Helper()
+		items := []map[string]interface{}{{
+			"nomenclature_id": item.ID,
+			"branch_id":       branchID,
+			"quantity":        10.0,
+			"unit":            "kg",
+			"price_per_unit":  price,
+		}}
+		if _, err := service.ProcessInboundInvoiceBatch("", items, "test", supplierID, price*10, false, date); err != nil {
+			t.Fatalf("ProcessInboundInvoiceBatch(%v): %v", price, err)
+		}
+	}
+
+	receive(100, "2030-01-10")
+	receive(100, "2030-01-20")
+	if len(alerts) != 0 {
+		t.Fatalf("без роста цены: уведомления %+v, want нет", alerts)
+	}
+	receive(130, "2030-02-01")
+	if len(alerts) != 1 {
+		t.Fatalf("рост на 30%%: уведомлений %d, want 1", len(alerts))
+	}
+	alert := alerts[0]
+	if alert.NomenclatureID != item.ID || alert.NomenclatureName != "Моцарелла" || alert.CounterpartyID != supplierID ||
+		alert.Price != 130 || alert.TrailingAverage != 100 || alert.IncreasePercent != 30 || alert.InvoiceID == "" {
+		t.Errorf("уведомление %+v, want Моцарелла 130₽ при среднем 100₽ (+30%%)", alert)
+	}
+
+	history, err := NewNomenclatureService(db).GetPriceHistory(item.ID, "", 0)
+	if err != nil {
+		t.Fatalf("GetPriceHistory: %v", err)
+	}
+	wantPrices := []float64{130, 100, 100} // Новые первыми
+	if len(history) != len(wantPrices) {
+		t.Fatalf("записей в истории %d, want %d", len(history), len(wantPrices))
+	}
+	for i, entry := range history {
+		if entry.Price != wantPrices[i] || entry.CounterpartyID == nil || *entry.CounterpartyID != supplierID || entry.BranchID != branchID {
+			t.Errorf("запись %d: %+v, want цена %v от поставщика %s", i, entry, wantPrices[i], supplierID)
+		}
+	}
+	if got := history[0].PriceDate.Format("2006-01-02"); got != "2030-02-01" {
+		t.Errorf("дата последней цены %s, want 2030-02-01 (дата накладной)", got)
+	}
+}
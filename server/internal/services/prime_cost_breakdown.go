@@ -0,0 +1,105 @@
+package services
+
+import (
+	"fmt"
+
+	"zephyrvpn/server/internal/models"
+)
+
+// CostLine - вклад ингредиента в себестоимость рецепта
+type CostLine struct {
+	NomenclatureID *string `json:"nomenclature_id,omitempty"` // Сырье
+	RecipeID       *string `json:"recipe_id,omitempty"`       // Полуфабрикат
+	Name           string  `json:"name"`
+	Quantity       float64 `json:"quantity"`  // Количество в рецепте
+	Unit           string  `json:"unit"`      // Единица Quantity (BaseUnit сырья, для полуфабриката - как в рецепте)
+	UnitCost       float64 `json:"unit_cost"` // Цена за CostUnit
+	CostUnit       string  `json:"cost_unit"` // InboundUnit сырья (кг/л/шт), для полуфабриката - единица Quantity
+	LineCost       float64 `json:"line_cost"` // Стоимость ингредиента в рецепте, руб
+	Percent        float64 `json:"percent"`   // Доля в себестоимости рецепта верхнего уровня, %
+	// Состав полуфабриката: те же строки в пересчете на его количество в рецепте
+	Components []CostLine `json:"components,omitempty"`
+}
+
+// GetPrimeCostBreakdown раскладывает себестоимость рецепта (как в CalculatePrimeCost, по LastPrice) по ингредиентам
+// Полуфабрикаты раскрываются рекурсивно: строка полуфабриката содержит его сырье в Components.
+// Percent всех строк (и вложенных тоже) считается от себестоимости рецепта, поэтому строки верхнего уровня дают в сумме 100%
+func (s *StockService) GetPrimeCostBreakdown(recipeID string) ([]CostLine, error) {
+	lines, total, err := s.primeCostBreakdown(recipeID, 1, s.newRecipePath())
+	if err != nil {
+		return nil, err
+	}
+	setCostPercents(lines, total)
+	return lines, nil
+}
+
+// primeCostBreakdown возвращает строки рецепта в пересчете на scale его выходов (PortionSize) и их сумму
+func (s *StockService) primeCostBreakdown(recipeID string, scale float64, path *recipePath) ([]CostLine, float64, error) {
+	var recipe models.Recipe
+	if err := s.db.Preload("Ingredients").Preload("Ingredients.Nomenclature").Preload("Ingredients.IngredientRecipe").
+		First(&recipe, "id = ?", recipeID).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := path.enter(recipe.ID, recipe.Name); err != nil {
+		return nil, 0, err
+	}
+	defer path.leave()
+
+	lines := make([]CostLine, 0, len(recipe.Ingredients))
+	var total float64
+	for _, ingredient := range recipe.Ingredients {
+		quantity := ingredient.Quantity * scale
+		var line CostLine
+
+		if ingredient.IngredientRecipeID != nil {
+			subRecipe := ingredient.IngredientRecipe
+			if subRecipe == nil {
+				return nil, 0, fmt.Errorf("полуфабрикат %s не найден", *ingredient.IngredientRecipeID)
+			}
+			line = CostLine{RecipeID: ingredient.IngredientRecipeID, Name: subRecipe.Name, Quantity: quantity, Unit: ingredient.Unit, CostUnit: ingredient.Unit}
+			// Как в calculatePrimeCost: полуфабрикат без размера выхода не стоит ничего
+			if subRecipe.PortionSize > 0 {
+				components, subTotal, err := s.primeCostBreakdown(subRecipe.ID, quantity/subRecipe.PortionSize, path)
+				if err != nil {
+					return nil, 0, err
+				}
+				line.Components = components
+				line.LineCost = subTotal
+				if quantity > 0 {
+					line.UnitCost = subTotal / quantity
+				}
+			}
+		} else if ingredient.NomenclatureID != nil {
+			nomenclature := ingredient.Nomenclature
+			if nomenclature == nil {
+				return nil, 0, fmt.Errorf("номенклатура не найдена: %s", *ingredient.NomenclatureID)
+			}
+			line = CostLine{
+				NomenclatureID: ingredient.NomenclatureID,
+				Name:           nomenclature.Name,
+				Quantity:       quantity,
+				Unit:           nomenclature.BaseUnit,
+				UnitCost:       nomenclature.LastPrice,
+				CostUnit:       nomenclature.InboundUnit,
+				LineCost:       rawIngredientCost(*nomenclature, quantity, nomenclature.LastPrice),
+			}
+		} else {
+			return nil, 0, fmt.Errorf("ингредиент должен иметь либо nomenclature_id, либо ingredient_recipe_id")
+		}
+
+		total += line.LineCost
+		lines = append(lines, line)
+	}
+	return lines, total, nil
+}
+
+// setCostPercents заполняет Percent строк и их составов как долю от total
+func setCostPercents(lines []CostLine, total float64) {
+	for i := range lines {
+		if total > 0 {
+			lines[i].Percent = lines[i].LineCost / total * 100
+		}
+		setCostPercents(lines[i].Components, total)
+	}
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Те же строки, что в TestGetPrimeCostBreakdownPercents, без БД: цены сырья через rawIngredientCost,
+// проценты состава соуса считаются от себестоимости пиццы
+func TestSetCostPercents(t *testing.T) {
+	cheese := models.NomenclatureItem{Name: "Сыр", BaseUnit: "g", InboundUnit: "kg"}
+	flour := models.NomenclatureItem{Name: "Мука", BaseUnit: "g", InboundUnit: "kg"}
+	tomatoes := models.NomenclatureItem{Name: "Томаты", BaseUnit: "g", InboundUnit: "kg"}
+	lines := []CostLine{
+		{Name: "Сыр", LineCost: rawIngredientCost(cheese, 100, 700)},
+		{Name: "Мука", LineCost: rawIngredientCost(flour, 200, 100)},
+		{Name: "Соус", LineCost: 10, Components: []CostLine{
+			{Name: "Томаты", LineCost: rawIngredientCost(tomatoes, 50, 200)},
+		}},
+	}
+	var total float64
+	for _, line := range lines {
+		total += line.LineCost
+	}
+	if total != 100 {
+		t.Fatalf("себестоимость %v, want 100", total)
+	}
+
+	setCostPercents(lines, total)
+	want := []float64{70, 20, 10}
+	var sum float64
+	for i, line := range lines {
+		if math.Abs(line.Percent-want[i]) > 1e-9 {
+			t.Errorf("%s: %v%%, want %v%%", line.Name, line.Percent, want[i])
+		}
+		sum += line.Percent
+	}
+	if math.Abs(sum-100) > 1e-9 {
+		t.Errorf("сумма долей %v%%, want 100%%", sum)
+	}
+	if got := lines[2].Components[0].Percent; math.Abs(got-10) > 1e-9 {
+		t.Errorf("томаты в соусе: %v%%, want 10%% от пиццы", got)
+	}
+
+	// Рецепт без стоимости: доли не делятся на ноль
+	free := []CostLine{{Name: "Вода"}, {Name: "Соль"}}
+	setCostPercents(free, 0)
+	for _, line := range free {
+		if line.Percent != 0 {
+			t.Errorf("%s: %v%% при нулевой себестоимости, want 0", line.Name, line.Percent)
+		}
+	}
+}
+
+// Пицца: 100 г сыра по 700₽/кг (70₽), 200 г муки по 100₽/кг (20₽) и 100 г соуса,
+// соус (выход 100 г) - 50 г томатов по 200₽/кг (10₽). Сыр дает 70% себестоимости
+func TestGetPrimeCostBreakdownPercents(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.Recipe{}, &models.RecipeIngredient{})
+	service := NewStockService(db)
+
+	var itemIDs, recipeIDs []string
+	newItem := func(name string, price float64) models.NomenclatureItem {
+		item := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: name, BaseUnit: "g", InboundUnit: "kg", LastPrice: price, IsActive: true}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("не удалось создать товар: %v", err)
+		}
+		itemIDs = append(itemIDs, item.ID)
+		return item
+	}
+	cheese := newItem("Сыр", 700)
+	flour := newItem("Мука", 100)
+	tomato := newItem("Томаты", 200)
+
+	sauce := models.Recipe{
+		Name:           "Соус " + uuid.New().String()[:8],
+		PortionSize:    100,
+		IsSemiFinished: true,
+		Ingredients:    []models.RecipeIngredient{{NomenclatureID: &tomato.ID, Quantity: 50, Unit: "g"}},
+	}
+	if err := db.Create(&sauce).Error; err != nil {
+		t.Fatalf("не удалось создать полуфабрикат: %v", err)
+	}
+	recipeIDs = append(recipeIDs, sauce.ID)
+	pizza := models.Recipe{
+		Name:        "Пицца " + uuid.New().String()[:8],
+		PortionSize: 1,
+		Ingredients: []models.RecipeIngredient{
+			{NomenclatureID: &cheese.ID, Quantity: 100, Unit: "g"},
+			{NomenclatureID: &flour.ID, Quantity: 200, Unit: "g"},
+			{IngredientRecipeID: &sauce.ID, Quantity: 100, Unit: "g"},
+		},
+	}
+	if err := db.Create(&pizza).Error; err != nil {
+		t.Fatalf("не удалось создать рецепт: %v", err)
+	}
+	recipeIDs = append(recipeIDs, pizza.ID)
+	t.Cleanup(func() {
+		db.Where("recipe_id IN ?", recipeIDs).Delete(&models.RecipeIngredient{})
+		db.Unscoped().Where("id IN ?", recipeIDs).Delete(&models.Recipe{})
+		db.Unscoped().Where("id IN ?", itemIDs).Delete(&models.NomenclatureItem{})
+	})
+
+	lines, err := service.GetPrimeCostBreakdown(pizza.ID)
+	if err != nil {
+		t.Fatalf("GetPrimeCostBreakdown: %v", err)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("строк %d, want 3", len(lines))
+	}
+
+	var totalCost, totalPercent float64
+	byName := make(map[string]CostLine)
+	for _, line := range lines {
+		totalCost += line.LineCost
+		totalPercent += line.Percent
+		byName[line.Name] = line
+	}
+	if math.Abs(totalPercent-100) > 0.001 {
+		t.Errorf("сумма долей = %.4f%%, want 100%%", totalPercent)
+	}
+	primeCost, err := service.CalculatePrimeCost(pizza.ID)
+	if err != nil {
+		t.Fatalf("CalculatePrimeCost: %v", err)
+	}
+	if math.Abs(totalCost-primeCost) > 0.001 || math.Abs(totalCost-100) > 0.001 {
+		t.Errorf("сумма строк = %.2f₽, CalculatePrimeCost = %.2f₽, want 100", totalCost, primeCost)
+	}
+	if line := byName["Сыр"]; math.Abs(line.Percent-70) > 0.001 || math.Abs(line.LineCost-70) > 0.001 {
+		t.Errorf("сыр: %.2f₽ (%.2f%%), want 70₽ (70%%)", line.LineCost, line.Percent)
+	}
+
+	sauceLine := byName[sauce.Name]
+	if math.Abs(sauceLine.Percent-10) > 0.001 || len(sauceLine.Components) != 1 {
+		t.Fatalf("соус: %+v, want 10%% и один компонент", sauceLine)
+	}
+	if component := sauceLine.Components[0]; component.Name != "Томаты" || math.Abs(component.Quantity-50) > 0.001 || math.Abs(component.Percent-10) > 0.001 {
+		t.Errorf("компонент соуса = %+v, want 50 г томатов, 10%%", component)
+	}
+}
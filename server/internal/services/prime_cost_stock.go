@@ -0,0 +1,81 @@
+package services
+
+import (
+	"fmt"
+
+	"zephyrvpn/server/internal/models"
+)
+
+// StockPrimeCost - себестоимость рецепта по фактической стоимости остатков филиала
+type StockPrimeCost struct {
+	RecipeID  string  `json:"recipe_id"`
+	BranchID  string  `json:"branch_id"`
+	PrimeCost float64 `json:"prime_cost"`
+	// Сырье без остатка в филиале - оценено по цене последней закупки (LastPrice)
+	LastPriceFallback []string `json:"last_price_fallback"`
+}
+
+// stockWeightedCostRow - средневзвешенная цена остатков номенклатуры
+type stockWeightedCostRow struct {
+	Remaining float64
+	Value     float64
+}
+
+// CalculatePrimeCostFromStock рассчитывает себестоимость рецепта ("что если") по текущим партиям филиала:
+// сырье оценивается по средневзвешенной цене остатков (сумма остаток * цена / сумма остатков, за InboundUnit)
+// вместо LastPrice. Полуфабрикаты обходятся так же, как в CalculatePrimeCost.
+// Сырье, которого нет на складе филиала, оценивается по LastPrice и перечисляется в LastPriceFallback
+func (s *StockService) CalculatePrimeCostFromStock(recipeID, branchID string) (*StockPrimeCost, error) {
+	if branchID == "" {
+		return nil, fmt.Errorf("branch_id обязателен")
+	}
+
+	result := &StockPrimeCost{
+		RecipeID:          recipeID,
+		BranchID:          branchID,
+		LastPriceFallback: make([]string, 0),
+	}
+	// Один товар может встречаться в нескольких полуфабрикатах - цену считаем один раз
+	prices := make(map[string]float64)
+	unitPrice := func(nomenclature models.NomenclatureItem) (float64, error) {
+		if price, ok := prices[nomenclature.ID]; ok {
+			return price, nil
+		}
+		price, ok, err := s.weightedStockCost(nomenclature.ID, branchID)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			price = nomenclature.LastPrice
+			result.LastPriceFallback = append(result.LastPriceFallback, nomenclature.Name)
+		}
+		prices[nomenclature.ID] = price
+		return price, nil
+	}
+
+	cost, err := s.calculatePrimeCost(recipeID, s.newRecipePath(), unitPrice)
+	if err != nil {
+		return nil, err
+	}
+	result.PrimeCost = cost
+	return result, nil
+}
+
+// weightedStockCost возвращает средневзвешенную цену (за InboundUnit) непросроченных остатков товара в филиале
+// ok=false - остатков нет
+func (s *StockService) weightedStockCost(nomenclatureID, branchID string) (float64, bool, error) {
+	var row stockWeightedCostRow
+	if err := s.db.Table("stock_batches AS sb").
+		Select(`COALESCE(SUM(`+stockRemainingSQL+`), 0) AS remaining,
+			COALESCE(SUM((`+stockRemainingSQL+`) * sb.cost_per_unit), 0) AS value`).
+		Joins("JOIN nomenclature_items ni ON ni.id = sb.nomenclature_id").
+		Where("sb.nomenclature_id = ? AND sb.branch_id = ? AND sb.remaining_quantity > 0 AND sb.is_expired = false AND sb.deleted_at IS NULL",
+			nomenclatureID, branchID).
+		Scan(&row).Error; err != nil {
+		return 0, false, fmt.Errorf("ошибка расчета стоимости остатков: %w", err)
+	}
+	if row.Remaining <= 0 {
+		return 0, false, nil
+	}
+	return row.Value / row.Remaining, true, nil
+}
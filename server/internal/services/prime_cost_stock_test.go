@@ -0,0 +1,98 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Сыр куплен последний раз по 100₽/кг, а на складе лежат партии по 200 и 300₽/кг (средневзвешенно 275₽/кг).
+// Пицца: 100 г сыра + 200 г соуса, соус (порция 100 г) - 50 г того же сыра
+func TestCalculatePrimeCostFromStockUsesWeightedBatchCost(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.StockBatch{}, &models.Recipe{}, &models.RecipeIngredient{})
+	service := NewStockService(db)
+
+	branchID := uuid.New().String()
+	cheese := models.NomenclatureItem{
+		SKU:         "TEST-" + uuid.New().String()[:8],
+		Name:        "Сыр",
+		BaseUnit:    "g",
+		InboundUnit: "kg",
+		LastPrice:   100,
+		IsActive:    true,
+	}
+	if err := db.Create(&cheese).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	var batchIDs []string
+	for _, batch := range []models.StockBatch{
+		{NomenclatureID: cheese.ID, BranchID: branchID, Quantity: 1000, RemainingQuantity: 1000, Unit: "g", CostPerUnit: 200, Source: "adjustment"},
+		{NomenclatureID: cheese.ID, BranchID: branchID, Quantity: 3000, RemainingQuantity: 3000, Unit: "g", CostPerUnit: 300, Source: "adjustment"},
+	} {
+		if err := db.Create(&batch).Error; err != nil {
+			t.Fatalf("не удалось создать партию: %v", err)
+		}
+		batchIDs = append(batchIDs, batch.ID)
+	}
+
+	sauce := models.Recipe{
+		Name:           "Соус " + uuid.New().String()[:8],
+		PortionSize:    100,
+		IsSemiFinished: true,
+		Ingredients:    []models.RecipeIngredient{{NomenclatureID: &cheese.ID, Quantity: 50, Unit: "g"}},
+	}
+	if err := db.Create(&sauce).Error; err != nil {
+		t.Fatalf("не удалось создать полуфабрикат: %v", err)
+	}
+	pizza := models.Recipe{
+		Name:        "Пицца " + uuid.New().String()[:8],
+		PortionSize: 1,
+		Ingredients: []models.RecipeIngredient{
+			{NomenclatureID: &cheese.ID, Quantity: 100, Unit: "g"},
+			{IngredientRecipeID: &sauce.ID, Quantity: 200, Unit: "g"},
+		},
+	}
+	if err := db.Create(&pizza).Error; err != nil {
+		t.Fatalf("не удалось создать рецепт: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Where("recipe_id IN ?", []string{pizza.ID, sauce.ID}).Delete(&models.RecipeIngredient{})
+		db.Unscoped().Where("id IN ?", []string{pizza.ID, sauce.ID}).Delete(&models.Recipe{})
+		db.Unscoped().Where("id IN ?", batchIDs).Delete(&models.StockBatch{})
+		db.Unscoped().Where("id = ?", cheese.ID).Delete(&models.NomenclatureItem{})
+	})
+
+	// По LastPrice: 100 г * 100₽/кг + (50 г * 100₽/кг / 100 г) * 200 г = 10 + 10
+	lastPriceCost, err := service.CalculatePrimeCost(pizza.ID)
+	if err != nil {
+		t.Fatalf("CalculatePrimeCost: %v", err)
+	}
+	if math.Abs(lastPriceCost-20) > 0.001 {
+		t.Errorf("себестоимость по LastPrice = %.2f₽, want 20", lastPriceCost)
+	}
+
+	// По остаткам: 275₽/кг - 27.5 + 27.5
+	fromStock, err := service.CalculatePrimeCostFromStock(pizza.ID, branchID)
+	if err != nil {
+		t.Fatalf("CalculatePrimeCostFromStock: %v", err)
+	}
+	if math.Abs(fromStock.PrimeCost-55) > 0.001 {
+		t.Errorf("себестоимость по остаткам = %.2f₽, want 55", fromStock.PrimeCost)
+	}
+	if len(fromStock.LastPriceFallback) != 0 {
+		t.Errorf("LastPriceFallback = %v, want пусто", fromStock.LastPriceFallback)
+	}
+
+	// В филиале без остатков - та же цена, что по LastPrice
+	otherBranch, err := service.CalculatePrimeCostFromStock(pizza.ID, uuid.New().String())
+	if err != nil {
+		t.Fatalf("CalculatePrimeCostFromStock (пустой филиал): %v", err)
+	}
+	if math.Abs(otherBranch.PrimeCost-lastPriceCost) > 0.001 || len(otherBranch.LastPriceFallback) != 1 {
+		t.Errorf("пустой филиал: %.2f₽, fallback %v; want %.2f₽ и [Сыр]", otherBranch.PrimeCost, otherBranch.LastPriceFallback, lastPriceCost)
+	}
+}
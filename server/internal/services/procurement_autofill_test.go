@@ -0,0 +1,168 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestForecastFromHistory(t *testing.T) {
+	service := NewDemandForecastService(nil)
+	// 2030-01-15 - вторник, сезонный коэффициент января 1.1
+	date := time.Date(2030, 1, 15, 0, 0, 0, 0, time.UTC)
+	tuesday := func(weeksAgo int, quantity float64) models.ProcurementHistory {
+		return models.ProcurementHistory{DeliveryDate: date.AddDate(0, 0, -7*weeksAgo), DayOfWeek: 2, ReceivedQuantity: quantity}
+	}
+
+	tests := []struct {
+		name           string
+		history        []models.ProcurementHistory
+		wantQuantity   float64
+		wantConfidence float64
+		wantLoad       string
+		wantMethod     string
+	}{
+		{
+			name:       "нет истории",
+			wantMethod: "no_data",
+			wantLoad:   "low",
+		},
+		{
+			// Меньше трех записей - простое среднее без сезонности
+			name:           "мало данных",
+			history:        []models.ProcurementHistory{tuesday(1, 10), tuesday(2, 30)},
+			wantQuantity:   20,
+			wantConfidence: 30,
+			wantLoad:       "low",
+			wantMethod:     "moving_average",
+		},
+		{
+			name: "скользящее среднее с сезонностью",
+			history: []models.ProcurementHistory{
+				tuesday(0, 1000), // Сама дата прогноза не учитывается
+				tuesday(1, 40), tuesday(2, 60), tuesday(3, 50), tuesday(4, 50),
+				{DeliveryDate: date.AddDate(0, 0, -1), DayOfWeek: 1, ReceivedQuantity: 1000}, // Другой день недели
+				tuesday(15, 1000), // Старше трех месяцев
+			},
+			wantQuantity:   55, // (40+60+50+50)/4 × 1.1
+			wantConfidence: 70,
+			wantLoad:       "medium",
+			wantMethod:     "moving_average",
+		},
+		{
+			name:           "высокая загрузка",
+			history:        []models.ProcurementHistory{tuesday(1, 120), tuesday(2, 120), tuesday(3, 120)},
+			wantQuantity:   132,
+			wantConfidence: 70,
+			wantLoad:       "high",
+			wantMethod:     "moving_average",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := service.forecastFromHistory(tt.history, date)
+			if math.Abs(got.ForecastedQuantity-tt.wantQuantity) > 1e-9 {
+				t.Errorf("ForecastedQuantity = %v, want %v", got.ForecastedQuantity, tt.wantQuantity)
+			}
+			if got.ConfidenceScore != tt.wantConfidence || got.PredictedKitchenLoad != tt.wantLoad || got.Method != tt.wantMethod {
+				t.Errorf("прогноз = %+v, want confidence %v, load %s, method %s", got, tt.wantConfidence, tt.wantLoad, tt.wantMethod)
+			}
+		})
+	}
+}
+
+func TestAutoFillMonthlyPlanKeepsManualCells(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.Counterparty{}, &models.NomenclatureItem{},
+		&models.StockBatch{}, &models.PurchaseOrder{}, &models.PurchaseOrderItem{}, &models.ProcurementPlan{},
+		&models.ProcurementPlanItem{}, &models.ProcurementHistory{}, &models.DemandForecast{})
+	branchID := newTestBranch(t, db)
+
+	item := models.NomenclatureItem{
+		SKU:         "TEST-" + uuid.New().String()[:8],
+		Name:        "Мука",
+		BaseUnit:    "kg",
+		InboundUnit: "kg",
+		IsActive:    true,
+	}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+
+	// План на следующий месяц: все его дни в будущем и заполняются
+	now := time.Now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+	year, month := monthStart.Year(), int(monthStart.Month())
+
+	// Три месяца до плана закупали по 10 кг каждый день
+	for day := monthStart.AddDate(0, -3, 0); day.Before(monthStart); day = day.AddDate(0, 0, 1) {
+		history := models.ProcurementHistory{
+			BranchID:         branchID,
+			NomenclatureID:   item.ID,
+			OrderDate:        day,
+			DeliveryDate:     day,
+			OrderedQuantity:  10,
+			ReceivedQuantity: 10,
+			Unit:             "kg",
+		}
+		if err := db.Create(&history).Error; err != nil {
+			t.Fatalf("не удалось создать историю закупок: %v", err)
+		}
+	}
+
+	service := NewProcurementPlanningService(db, nil, NewDemandForecastService(db))
+	planResponse, err := service.GetMonthlyPlan(branchID, year, month)
+	if err != nil {
+		t.Fatalf("GetMonthlyPlan: %v", err)
+	}
+	planID := planResponse.Plan.ID
+	t.Cleanup(func() {
+		db.Where("plan_id = ?", planID).Delete(&models.ProcurementPlanItem{})
+		db.Unscoped().Where("id = ?", planID).Delete(&models.ProcurementPlan{})
+		db.Where("branch_id = ?", branchID).Delete(&models.DemandForecast{})
+		db.Where("branch_id = ?", branchID).Delete(&models.ProcurementHistory{})
+		db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+	})
+
+	manualDate := monthStart.AddDate(0, 0, 4).Format("2006-01-02")
+	if err := service.UpdatePlanCell(planID, item.ID, manualDate, 3); err != nil {
+		t.Fatalf("UpdatePlanCell: %v", err)
+	}
+
+	// Повторный запуск пересчитывает автозаполненные ячейки, а не удваивает их
+	for run := 1; run <= 2; run++ {
+		result, err := service.AutoFillMonthlyPlan(branchID, year, month)
+		if err != nil {
+			t.Fatalf("AutoFillMonthlyPlan (запуск %d): %v", run, err)
+		}
+		if result.SkippedManualCells < 1 {
+			t.Errorf("запуск %d: SkippedManualCells = %d, want >= 1", run, result.SkippedManualCells)
+		}
+
+		var row *MonthlyPlanMatrixRow
+		for i := range result.Plan.Matrix {
+			if result.Plan.Matrix[i].NomenclatureID == item.ID {
+				row = &result.Plan.Matrix[i]
+			}
+		}
+		if row == nil {
+			t.Fatalf("запуск %d: товара нет в матрице плана", run)
+		}
+
+		wantDaily := 10 * service.forecastService.getSeasonalFactor(monthStart)
+		for _, cell := range row.Cells {
+			if cell.Date == manualDate {
+				if cell.PlannedQuantity != 3 || cell.IsAutoFilled {
+					t.Errorf("запуск %d: ручная ячейка %s = %v (auto %v), want 3, введенная вручную", run, cell.Date, cell.PlannedQuantity, cell.IsAutoFilled)
+				}
+				continue
+			}
+			if math.Abs(cell.PlannedQuantity-wantDaily) > 0.01 || !cell.IsAutoFilled {
+				t.Errorf("запуск %d: ячейка %s = %v (auto %v), want %.2f из прогноза", run, cell.Date, cell.PlannedQuantity, cell.IsAutoFilled, wantDaily)
+			}
+		}
+	}
+}
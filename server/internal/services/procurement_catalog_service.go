@@ -20,6 +20,12 @@ type ProcurementCatalogService struct {
 // calculateConversionFactorFromUnits вычисляет коэффициент конвертации на основе единиц измерения
 // Используется для проверки конфликтов при синхронизации из каталога поставщиков
 func (s *ProcurementCatalogService) calculateConversionFactorFromUnits(inboundUnit, baseUnit string) float64 {
+	return unitConversionFactor(inboundUnit, baseUnit)
+}
+
+// unitConversionFactor возвращает, сколько baseUnit содержится в одной inboundUnit (кг -> г = 1000)
+// 0 - единицы несовместимы (например, кг и шт)
+func unitConversionFactor(inboundUnit, baseUnit string) float64 {
 	inboundUnitNormalized := strings.ToLower(strings.TrimSpace(inboundUnit))
 	baseUnitNormalized := strings.ToLower(strings.TrimSpace(baseUnit))
 	
@@ -139,6 +145,8 @@ type CatalogItem struct {
 	SupplierName        string  `json:"supplier_name"`       // Название поставщика
 	Brand               string  `json:"brand"`               // Бренд
 	MinOrderBatch       float64 `json:"min_order_batch"`     // Мин партия
+	PackSize            float64 `json:"pack_size"`           // Размер упаковки поставщика (25 для мешка муки 25 кг)
+	PackUnit            string  `json:"pack_unit"`           // Единица размера упаковки (кг, л, шт)
 	CurrentOrder        float64 `json:"current_order"`       // Ваш заказ (для текущего планирования)
 	
 	// Единицы измерения для склада
@@ -275,6 +283,8 @@ func (s *ProcurementCatalogService) GetSetupTemplate(branchID string) (*CatalogT
 			SupplierName:       catalogItem.Supplier.Name,
 			Brand:              catalogItem.Brand,
 			MinOrderBatch:      catalogItem.MinOrderBatch,
+			PackSize:           catalogItem.PackSize,
+			PackUnit:           catalogItem.PackUnit,
 			CurrentOrder:       0,
 			SKU:                catalogItem.Nomenclature.SKU,
 			CategoryID:         &categoryID,
@@ -714,6 +724,8 @@ func (s *ProcurementCatalogService) SaveCatalog(req *SaveCatalogRequest) error {
 		
 		catalogItem.Price = item.Price
 		catalogItem.MinOrderBatch = item.MinOrderBatch
+		catalogItem.PackSize = item.PackSize
+		catalogItem.PackUnit = item.PackUnit
 		catalogItem.IsActive = item.Status == "active"
 
 		if err := tx.Save(&catalogItem).Error; err != nil {
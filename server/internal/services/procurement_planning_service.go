@@ -56,6 +56,7 @@ type MonthlyPlanCell struct {
 	LastMonthQuantity   float64 `json:"last_month_quantity"`   // Количество в прошлом месяце в этот день недели
 	AvgLast3Months      float64 `json:"avg_last_3_months"`    // Среднее за последние 3 месяца
 	HasData             bool    `json:"has_data"`              // Есть ли данные для этой ячейки
+	IsAutoFilled        bool    `json:"is_auto_filled"`        // Количество подставлено из прогноза (не вводилось вручную)
 }
 
 // SupplierSuggestion представляет рекомендацию по поставщику
@@ -80,31 +81,9 @@ type MonthlyPlanAnalytics struct {
 // GetMonthlyPlan возвращает план на месяц с матрицей данных
 func (s *ProcurementPlanningService) GetMonthlyPlan(branchID string, year int, month int) (*MonthlyPlanResponse, error) {
 	// 1. Создаем или загружаем план
-	planMonth := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
-	
-	var plan models.ProcurementPlan
-	err := s.db.Where("branch_id = ? AND year = ? AND month_number = ? AND deleted_at IS NULL", branchID, year, month).
-		Preload("Items").
-		Preload("Items.Nomenclature").
-		Preload("Items.SuggestedSupplier").
-		Preload("Branch").
-		First(&plan).Error
-	
-	if err == gorm.ErrRecordNotFound {
-		// Создаем новый план
-		plan = models.ProcurementPlan{
-			BranchID:    branchID,
-			Month:       planMonth,
-			Year:        year,
-			MonthNumber: month,
-			Status:      models.ProcurementPlanStatusDraft,
-			CreatedBy:   "system", // Будет обновлено при сохранении
-		}
-		if err := s.db.Create(&plan).Error; err != nil {
-			return nil, fmt.Errorf("ошибка создания плана: %w", err)
-		}
-	} else if err != nil {
-		return nil, fmt.Errorf("ошибка загрузки плана: %w", err)
+	plan, err := s.loadOrCreatePlan(branchID, year, month)
+	if err != nil {
+		return nil, err
 	}
 	
 	// 2. Получаем список всех активных товаров из номенклатуры
@@ -118,6 +97,12 @@ func (s *ProcurementPlanningService) GetMonthlyPlan(branchID string, year int, m
 	// 3. Генерируем список дат месяца
 	dates := generateMonthDates(year, month)
 	
+	// Прогнозы на весь месяц - одним пакетом, а не по запросу на ячейку
+	forecasts, err := s.forecastService.GetForecasts(branchID, nomenclatureItems, parsePlanDates(dates))
+	if err != nil {
+		return nil, err
+	}
+	
 	// 4. Строим матрицу: для каждого товара создаем строку с ячейками для каждой даты
 	matrix := make([]MonthlyPlanMatrixRow, 0, len(nomenclatureItems))
 	
@@ -147,22 +132,24 @@ func (s *ProcurementPlanningService) GetMonthlyPlan(branchID string, year int, m
 			}
 			
 			// Получаем прогноз и исторические данные
-			forecast, _ := s.forecastService.GetForecast(branchID, item.ID, date)
 			history, _ := s.forecastService.GetHistoricalData(branchID, item.ID, date)
 			
 			cell := MonthlyPlanCell{
 				Date:                dateStr,
 				PlannedQuantity:     0,
-				ForecastedQuantity:  forecast.ForecastedQuantity,
-				ForecastConfidence:  forecast.ConfidenceScore,
-				PredictedKitchenLoad: forecast.PredictedKitchenLoad,
 				LastMonthQuantity:   history.LastMonthQuantity,
 				AvgLast3Months:      history.AvgLast3Months,
 				HasData:             planItem != nil,
 			}
+			if forecast := forecasts[forecastKey(item.ID, date)]; forecast != nil {
+				cell.ForecastedQuantity = forecast.ForecastedQuantity
+				cell.ForecastConfidence = forecast.ConfidenceScore
+				cell.PredictedKitchenLoad = forecast.PredictedKitchenLoad
+			}
 			
 			if planItem != nil {
 				cell.PlannedQuantity = planItem.PlannedQuantity
+				cell.IsAutoFilled = planItem.IsAutoFilled
 				row.TotalPlanned += planItem.PlannedQuantity
 			}
 			
@@ -182,13 +169,45 @@ func (s *ProcurementPlanningService) GetMonthlyPlan(branchID string, year int, m
 	analytics := s.calculateAnalytics(matrix, dates)
 	
 	return &MonthlyPlanResponse{
-		Plan:      &plan,
+		Plan:      plan,
 		Matrix:    matrix,
 		Dates:     dates,
 		Analytics: analytics,
 	}, nil
 }
 
+// loadOrCreatePlan загружает план филиала на месяц с позициями или создает пустой черновик
+func (s *ProcurementPlanningService) loadOrCreatePlan(branchID string, year int, month int) (*models.ProcurementPlan, error) {
+	planMonth := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	
+	var plan models.ProcurementPlan
+	err := s.db.Where("branch_id = ? AND year = ? AND month_number = ? AND deleted_at IS NULL", branchID, year, month).
+		Preload("Items").
+		Preload("Items.Nomenclature").
+		Preload("Items.SuggestedSupplier").
+		Preload("Branch").
+		First(&plan).Error
+	
+	if err == gorm.ErrRecordNotFound {
+		// Создаем новый план
+		plan = models.ProcurementPlan{
+			BranchID:    branchID,
+			Month:       planMonth,
+			Year:        year,
+			MonthNumber: month,
+			Status:      models.ProcurementPlanStatusDraft,
+			CreatedBy:   "system", // Будет обновлено при сохранении
+		}
+		if err := s.db.Create(&plan).Error; err != nil {
+			return nil, fmt.Errorf("ошибка создания плана: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки плана: %w", err)
+	}
+	
+	return &plan, nil
+}
+
 // UpdatePlanCell обновляет ячейку в плане (количество для конкретной даты и товара)
 func (s *ProcurementPlanningService) UpdatePlanCell(planID string, nomenclatureID string, dateStr string, quantity float64) error {
 	date, err := time.Parse("2006-01-02", dateStr)
@@ -239,8 +258,9 @@ func (s *ProcurementPlanningService) UpdatePlanCell(planID string, nomenclatureI
 	} else if err != nil {
 		return fmt.Errorf("ошибка поиска позиции: %w", err)
 	} else {
-		// Обновляем существующую позицию
+		// Обновляем существующую позицию (ручной ввод снимает флаг автозаполнения)
 		planItem.PlannedQuantity = quantity
+		planItem.IsAutoFilled = false
 		if err := s.db.Save(&planItem).Error; err != nil {
 			return fmt.Errorf("ошибка обновления позиции: %w", err)
 		}
@@ -249,6 +269,215 @@ func (s *ProcurementPlanningService) UpdatePlanCell(planID string, nomenclatureI
 	return nil
 }
 
+// AutoFillPlanResult представляет результат автозаполнения плана из прогноза
+type AutoFillPlanResult struct {
+	Plan               *MonthlyPlanResponse `json:"plan"`
+	FilledCells        int                  `json:"filled_cells"`         // Ячеек заполнено/обновлено из прогноза
+	SkippedManualCells int                  `json:"skipped_manual_cells"` // Ячеек, введенных вручную (не тронуты)
+}
+
+// AutoFillMonthlyPlan заполняет ячейки плана на месяц рекомендуемым количеством:
+// прогноз спроса за день минус текущий остаток на складе (остаток «расходуется» по дням).
+// Ячейки, отредактированные менеджером вручную, не изменяются.
+// Повторный запуск пересчитывает только автозаполненные ячейки, поэтому количества не удваиваются.
+// Заполняются только сегодняшний и будущие дни.
+func (s *ProcurementPlanningService) AutoFillMonthlyPlan(branchID string, year int, month int) (*AutoFillPlanResult, error) {
+	// Гарантируем, что план существует (создается черновик при необходимости)
+	plan, err := s.loadOrCreatePlan(branchID, year, month)
+	if err != nil {
+		return nil, err
+	}
+	
+	if plan.Status != models.ProcurementPlanStatusDraft {
+		return nil, fmt.Errorf("автозаполнение доступно только для черновика (текущий статус: %s)", plan.Status)
+	}
+	
+	var nomenclatureItems []models.NomenclatureItem
+	if err := s.db.Where("is_active = true AND deleted_at IS NULL").
+		Find(&nomenclatureItems).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки номенклатуры: %w", err)
+	}
+	
+	// Существующие позиции плана: nomenclatureID|date -> позиция
+	existingItems := make(map[string]*models.ProcurementPlanItem, len(plan.Items))
+	for i := range plan.Items {
+		existingItems[forecastKey(plan.Items[i].NomenclatureID, plan.Items[i].PlanDate)] = &plan.Items[i]
+	}
+	
+	// Заполняются только сегодняшний и будущие дни
+	today := time.Now().UTC().Format("2006-01-02")
+	dates := make([]time.Time, 0)
+	for _, date := range parsePlanDates(generateMonthDates(year, month)) {
+		if date.Format("2006-01-02") >= today {
+			dates = append(dates, date)
+		}
+	}
+	
+	// Прогнозы и остатки - пакетно на весь месяц, а не по запросу на ячейку
+	forecasts, err := s.forecastService.GetForecasts(branchID, nomenclatureItems, dates)
+	if err != nil {
+		return nil, err
+	}
+	onHandBase, err := s.getOnHandBaseByItem(branchID)
+	if err != nil {
+		log.Printf("⚠️ Не удалось получить остатки филиала %s: %v", branchID, err)
+	}
+	
+	// Сначала считаем все изменения, затем применяем их одной транзакцией
+	type cellUpdate struct {
+		item    *models.ProcurementPlanItem
+		updates map[string]interface{}
+	}
+	updates := make([]cellUpdate, 0)
+	creates := make([]models.ProcurementPlanItem, 0)
+	skippedManualCells := 0
+	
+	for _, item := range nomenclatureItems {
+		// Остаток на складе в единице закупки (InboundUnit), в которой ведется план
+		onHand := toInboundUnit(item, onHandBase[item.ID])
+		var supplierSuggestion *SupplierSuggestion
+		supplierLoaded := false
+		
+		for _, date := range dates {
+			key := forecastKey(item.ID, date)
+			forecast := forecasts[key]
+			if forecast == nil {
+				continue
+			}
+			
+			// Остаток покрывает ближайшие дни, дальше закупаем прогноз целиком
+			suggested := forecast.ForecastedQuantity
+			if onHand >= suggested {
+				onHand -= suggested
+				suggested = 0
+			} else {
+				suggested -= onHand
+				onHand = 0
+			}
+			
+			existing := existingItems[key]
+			if existing != nil && !existing.IsAutoFilled {
+				skippedManualCells++
+				continue
+			}
+			
+			if existing != nil {
+				// Пересчитываем ранее автозаполненную ячейку (идемпотентно)
+				updates = append(updates, cellUpdate{item: existing, updates: map[string]interface{}{
+					"planned_quantity":       suggested,
+					"forecasted_quantity":    forecast.ForecastedQuantity,
+					"forecast_confidence":    forecast.ConfidenceScore,
+					"predicted_kitchen_load": forecast.PredictedKitchenLoad,
+				}})
+				continue
+			}
+			
+			if suggested <= 0 {
+				continue
+			}
+			
+			planItem := models.ProcurementPlanItem{
+				PlanID:               plan.ID,
+				NomenclatureID:       item.ID,
+				PlanDate:             date,
+				PlannedQuantity:      suggested,
+				Unit:                 item.InboundUnit,
+				ForecastedQuantity:   forecast.ForecastedQuantity,
+				ForecastConfidence:   forecast.ConfidenceScore,
+				PredictedKitchenLoad: forecast.PredictedKitchenLoad,
+				IsAutoFilled:         true,
+			}
+			// Поставщик один на товар - запрашиваем его один раз
+			if !supplierLoaded {
+				supplierSuggestion, _ = s.getSupplierSuggestion(branchID, item.ID)
+				supplierLoaded = true
+			}
+			if supplierSuggestion != nil {
+				planItem.SuggestedSupplierID = &supplierSuggestion.SupplierID
+				planItem.SuggestedPricePerUnit = supplierSuggestion.PricePerUnit
+			}
+			creates = append(creates, planItem)
+		}
+	}
+	
+	// План заполняется целиком или не меняется вовсе
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		for _, update := range updates {
+			if err := tx.Model(update.item).Updates(update.updates).Error; err != nil {
+				return fmt.Errorf("ошибка обновления позиции плана: %w", err)
+			}
+		}
+		if len(creates) > 0 {
+			if err := tx.CreateInBatches(&creates, 500).Error; err != nil {
+				return fmt.Errorf("ошибка создания позиции плана: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	filledCells := len(updates) + len(creates)
+	
+	log.Printf("✅ Автозаполнение плана %s: заполнено %d ячеек, пропущено ручных: %d", plan.PlanNumber, filledCells, skippedManualCells)
+	
+	// Возвращаем актуальную матрицу
+	refreshed, err := s.GetMonthlyPlan(branchID, year, month)
+	if err != nil {
+		return nil, err
+	}
+	
+	return &AutoFillPlanResult{
+		Plan:               refreshed,
+		FilledCells:        filledCells,
+		SkippedManualCells: skippedManualCells,
+	}, nil
+}
+
+// getOnHandBaseByItem возвращает текущие остатки филиала по товарам в базовой единице (одним запросом)
+func (s *ProcurementPlanningService) getOnHandBaseByItem(branchID string) (map[string]float64, error) {
+	var rows []struct {
+		NomenclatureID string
+		Quantity       float64
+	}
+	if err := s.db.Model(&models.StockBatch{}).
+		Where("branch_id = ? AND remaining_quantity > 0 AND is_expired = false AND deleted_at IS NULL", branchID).
+		Select("nomenclature_id, COALESCE(SUM(remaining_quantity), 0) AS quantity").
+		Group("nomenclature_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	onHand := make(map[string]float64, len(rows))
+	for _, row := range rows {
+		onHand[row.NomenclatureID] = row.Quantity
+	}
+	return onHand, nil
+}
+
+// toInboundUnit переводит количество из базовой единицы товара в единицу закупки
+func toInboundUnit(item models.NomenclatureItem, quantity float64) float64 {
+	if item.BaseUnit == item.InboundUnit || item.InboundUnit == "" {
+		return quantity
+	}
+	if (item.BaseUnit == "g" && item.InboundUnit == "kg") || (item.BaseUnit == "ml" && item.InboundUnit == "l") {
+		return quantity / 1000
+	}
+	if item.ConversionFactor > 0 {
+		return quantity / item.ConversionFactor
+	}
+	return quantity
+}
+
+// parsePlanDates переводит даты плана (YYYY-MM-DD) в time.Time
+func parsePlanDates(dates []string) []time.Time {
+	result := make([]time.Time, 0, len(dates))
+	for _, dateStr := range dates {
+		date, _ := time.Parse("2006-01-02", dateStr)
+		result = append(result, date)
+	}
+	return result
+}
+
 // SubmitPlan обрабатывает отправку плана и создает PurchaseOrders
 func (s *ProcurementPlanningService) SubmitPlan(planID string, createdBy string) error {
 	// 1. Загружаем план
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// newTestPurchaseOrder создает заказ на закупку на сумму amount (одна позиция 10 кг) при пороге утверждения threshold
+func newTestPurchaseOrder(t *testing.T, threshold, amount float64) (*PurchaseOrderService, *models.PurchaseOrder) {
+	t.Helper()
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.Counterparty{}, &models.NomenclatureItem{},
+		&models.SupplierCatalogItem{}, &models.PurchaseOrder{}, &models.PurchaseOrderItem{})
+	service := NewPurchaseOrderService(db, nil)
+	service.SetApprovalThreshold(threshold)
+
+	branchID := newTestBranch(t, db)
+	supplierID := newTestCounterparty(t, db)
+	item := models.NomenclatureItem{
+		SKU:      "TEST-" + uuid.New().String()[:8],
+		Name:     "Мука",
+		BaseUnit: "g",
+		IsActive: true,
+	}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+
+	order := &models.PurchaseOrder{
+		OrderNumber:          "PO-TEST-" + uuid.New().String()[:8],
+		SupplierID:           supplierID,
+		BranchID:             branchID,
+		ExpectedDeliveryDate: time.Now().AddDate(0, 0, 2),
+		CreatedBy:            "buyer",
+		Items: []models.PurchaseOrderItem{{
+			NomenclatureID:       item.ID,
+			OrderedQuantity:      10,
+			Unit:                 "kg",
+			PurchasePricePerUnit: amount / 10,
+			TotalPrice:           amount,
+		}},
+	}
+	if err := service.CreatePurchaseOrder(order); err != nil {
+		t.Fatalf("CreatePurchaseOrder: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Where("purchase_order_id = ?", order.ID).Delete(&models.PurchaseOrderItem{})
+		db.Unscoped().Where("id = ?", order.ID).Delete(&models.PurchaseOrder{})
+		db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+	})
+	return service, order
+}
+
+func TestPurchaseOrderUnderThresholdSendsFreely(t *testing.T) {
+	service, order := newTestPurchaseOrder(t, 50000, 12000)
+
+	if order.Status != models.PurchaseOrderStatusDraft {
+		t.Fatalf("статус заказа ниже порога = %s, want draft", order.Status)
+	}
+	if err := service.SendPurchaseOrder(order.ID, ""); err != nil {
+		t.Fatalf("SendPurchaseOrder: %v", err)
+	}
+
+	sent, err := service.GetPurchaseOrder(order.ID)
+	if err != nil {
+		t.Fatalf("GetPurchaseOrder: %v", err)
+	}
+	if sent.Status != models.PurchaseOrderStatusOrdered {
+		t.Errorf("статус после отправки = %s, want ordered", sent.Status)
+	}
+}
+
+func TestPurchaseOrderOverThresholdBlockedUntilApproved(t *testing.T) {
+	service, order := newTestPurchaseOrder(t, 50000, 75000)
+
+	if order.Status != models.PurchaseOrderStatusPendingApproval {
+		t.Fatalf("статус заказа выше порога = %s, want pending_approval", order.Status)
+	}
+	if err := service.SendPurchaseOrder(order.ID, ""); !errors.Is(err, ErrPurchaseOrderApprovalRequired) {
+		t.Fatalf("SendPurchaseOrder до утверждения: err = %v, want ErrPurchaseOrderApprovalRequired", err)
+	}
+
+	approved, err := service.ApprovePurchaseOrder(order.ID, "manager-1")
+	if err != nil {
+		t.Fatalf("ApprovePurchaseOrder: %v", err)
+	}
+	if approved.ApprovedBy == nil || *approved.ApprovedBy != "manager-1" || approved.ApprovedAt == nil {
+		t.Errorf("утверждение не записано: approved_by=%v, approved_at=%v", approved.ApprovedBy, approved.ApprovedAt)
+	}
+	if _, err := service.ApprovePurchaseOrder(order.ID, "manager-2"); !errors.Is(err, ErrPurchaseOrderNotPendingApproval) {
+		t.Errorf("повторное утверждение: err = %v, want ErrPurchaseOrderNotPendingApproval", err)
+	}
+
+	if err := service.SendPurchaseOrder(order.ID, "buyer"); err != nil {
+		t.Fatalf("SendPurchaseOrder после утверждения: %v", err)
+	}
+	sent, err := service.GetPurchaseOrder(order.ID)
+	if err != nil {
+		t.Fatalf("GetPurchaseOrder: %v", err)
+	}
+	if sent.Status != models.PurchaseOrderStatusOrdered {
+		t.Errorf("статус после отправки = %s, want ordered", sent.Status)
+	}
+	if sent.ApprovedBy == nil || *sent.ApprovedBy != "manager-1" || sent.ApprovedAt == nil {
+		t.Errorf("отправка перезаписала утверждение: approved_by=%v, approved_at=%v", sent.ApprovedBy, sent.ApprovedAt)
+	}
+}
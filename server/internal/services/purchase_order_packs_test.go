@@ -0,0 +1,149 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestPacksFor(t *testing.T) {
+	tests := []struct {
+		quantity, packQuantity float64
+		want                   int
+	}{
+		{18, 25, 1},
+		{25, 25, 1},
+		{26, 25, 2},
+		{50.0000001, 25, 2}, // погрешность float не добавляет упаковку
+		{0.1 + 0.2, 0.3, 1},
+		{0.001, 25, 1}, // меньше одной упаковки не бывает
+	}
+	for _, tt := range tests {
+		if got := packsFor(tt.quantity, tt.packQuantity); got != tt.want {
+			t.Errorf("packsFor(%v, %v) = %d, want %d", tt.quantity, tt.packQuantity, got, tt.want)
+		}
+	}
+}
+
+func TestUnitConversionFactor(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     float64
+	}{
+		{"kg", "g", 1000},
+		{" КГ ", "г", 1000},
+		{"l", "ml", 1000},
+		{"g", "kg", 0.001},
+		{"pcs", "pcs", 1},
+		{"kg", "pcs", 0},
+	}
+	for _, tt := range tests {
+		if got := unitConversionFactor(tt.from, tt.to); got != tt.want {
+			t.Errorf("unitConversionFactor(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+// Количество округляется вверх до упаковок каталога поставщика; каталог филиала приоритетнее общего,
+// позиции без размера упаковки и с несовместимой единицей не меняются
+func TestCreatePurchaseOrderRoundsToPacks(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.Counterparty{}, &models.NomenclatureItem{},
+		&models.SupplierCatalogItem{}, &models.PurchaseOrder{}, &models.PurchaseOrderItem{})
+	service := NewPurchaseOrderService(db, nil)
+	branchID := newTestBranch(t, db)
+	supplierID := newTestCounterparty(t, db)
+
+	createItem := func(name string) string {
+		t.Helper()
+		item := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: name, BaseUnit: "g", IsActive: true}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("не удалось создать товар: %v", err)
+		}
+		t.Cleanup(func() {
+			db.Unscoped().Where("nomenclature_id = ?", item.ID).Delete(&models.SupplierCatalogItem{})
+			db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+		})
+		return item.ID
+	}
+	flourID := createItem("Мука")
+	sugarID := createItem("Сахар")
+	saltID := createItem("Соль")
+	eggsID := createItem("Яйца")
+
+	addCatalog := func(nomenclatureID, branchID string, packSize float64, packUnit string) {
+		t.Helper()
+		catalogItem := models.SupplierCatalogItem{
+			NomenclatureID: nomenclatureID,
+			SupplierID:     supplierID,
+			BranchID:       branchID,
+			PackSize:       packSize,
+			PackUnit:       packUnit,
+			IsActive:       true,
+		}
+		query := db
+		if branchID == "" {
+			query = db.Omit("BranchID") // Общий каталог: branch_id IS NULL
+		}
+		if err := query.Create(&catalogItem).Error; err != nil {
+			t.Fatalf("не удалось создать позицию каталога: %v", err)
+		}
+	}
+	addCatalog(flourID, "", 25, "kg")
+	addCatalog(sugarID, "", 25, "kg")
+	addCatalog(sugarID, branchID, 10, "kg")
+	addCatalog(eggsID, "", 30, "pcs")
+
+	order := &models.PurchaseOrder{
+		OrderNumber:          "PO-TEST-" + uuid.New().String()[:8],
+		SupplierID:           supplierID,
+		BranchID:             branchID,
+		ExpectedDeliveryDate: time.Now().AddDate(0, 0, 2),
+		CreatedBy:            "buyer",
+		Items: []models.PurchaseOrderItem{
+			// Сумма позиции до округления пересчитывается по количеству в упаковках
+			{NomenclatureID: flourID, OrderedQuantity: 18000, Unit: "g", PurchasePricePerUnit: 0.05, TotalPrice: 900},
+			{NomenclatureID: sugarID, OrderedQuantity: 18, Unit: "kg", PurchasePricePerUnit: 70, TotalPrice: 1260},
+			{NomenclatureID: saltID, OrderedQuantity: 3, Unit: "kg", PurchasePricePerUnit: 20, TotalPrice: 60},
+			{NomenclatureID: eggsID, OrderedQuantity: 5, Unit: "kg", PurchasePricePerUnit: 100, TotalPrice: 500},
+		},
+	}
+	if err := service.CreatePurchaseOrder(order); err != nil {
+		t.Fatalf("CreatePurchaseOrder: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Where("purchase_order_id = ?", order.ID).Delete(&models.PurchaseOrderItem{})
+		db.Unscoped().Where("id = ?", order.ID).Delete(&models.PurchaseOrder{})
+	})
+
+	var saved models.PurchaseOrder
+	if err := db.Preload("Items").First(&saved, "id = ?", order.ID).Error; err != nil {
+		t.Fatalf("не удалось прочитать заказ: %v", err)
+	}
+	want := map[string]struct {
+		ordered, requested float64
+		packs              int
+		rounding           string
+	}{
+		flourID: {25000, 18000, 1, "запрошено 18000 g → 1 упак. (25 kg)"},
+		sugarID: {20, 18, 2, "запрошено 18 kg → 2 упак. (10 kg)"},
+		saltID:  {3, 0, 0, ""},
+		eggsID:  {5, 0, 0, ""},
+	}
+	total := 0.0
+	for _, item := range saved.Items {
+		w := want[item.NomenclatureID]
+		if item.OrderedQuantity != w.ordered || item.RequestedQuantity != w.requested || item.PackCount != w.packs || item.PackRounding != w.rounding {
+			t.Errorf("позиция %s: заказано %v, запрошено %v, упаковок %d, %q; want %v, %v, %d, %q",
+				item.NomenclatureID, item.OrderedQuantity, item.RequestedQuantity, item.PackCount, item.PackRounding,
+				w.ordered, w.requested, w.packs, w.rounding)
+		}
+		total += item.TotalPrice
+	}
+	// 25000 г * 0.05 + 20 кг * 70 + 3 кг * 20 + 5 кг * 100
+	if total != 3210 || saved.TotalAmount != 3210 {
+		t.Errorf("сумма позиций %v, сумма заказа %v; want 3210", total, saved.TotalAmount)
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Заказ на 10 кг принимается двумя поставками: каждая сразу оприходуется своей накладной,
+// заказ остается partially_received до последней поставки, перебор остатка отклоняется
+func TestReceivePurchaseOrderPartialInInstallments(t *testing.T) {
+	service, order := newTestPurchaseOrder(t, 0, 1000)
+	db := newTestDB(t, &models.Invoice{}, &models.StockBatch{}, &models.StockMovement{}, &models.PriceHistory{},
+		&models.FinanceTransaction{})
+	stockService := NewStockService(db)
+	stockService.SetCounterpartyService(NewCounterpartyService(db))
+	stockService.SetFinanceService(NewFinanceService(db))
+	service.stockService = stockService
+
+	itemID := order.Items[0].ID
+	nomenclatureID := order.Items[0].NomenclatureID
+	t.Cleanup(func() {
+		db.Unscoped().Where("branch_id = ?", order.BranchID).Delete(&models.FinanceTransaction{})
+		db.Where("nomenclature_id = ?", nomenclatureID).Delete(&models.PriceHistory{})
+		db.Unscoped().Where("branch_id = ?", order.BranchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("branch_id = ?", order.BranchID).Delete(&models.StockBatch{})
+		db.Unscoped().Where("branch_id = ?", order.BranchID).Delete(&models.Invoice{})
+	})
+
+	if err := service.SendPurchaseOrder(order.ID, ""); err != nil {
+		t.Fatalf("SendPurchaseOrder: %v", err)
+	}
+
+	first, err := service.ReceivePurchaseOrderPartial(order.ID, []ReceivedItem{{OrderItemID: itemID, Quantity: 4}}, "storekeeper")
+	if err != nil {
+		t.Fatalf("первая поставка: %v", err)
+	}
+	if first.Status != models.PurchaseOrderStatusPartiallyReceived {
+		t.Errorf("статус после первой поставки = %s, want partially_received", first.Status)
+	}
+	assertReceivedStock(t, db, order.BranchID, nomenclatureID, 4000)
+
+	// Остаток к получению - 6 кг
+	if _, err := service.ReceivePurchaseOrderPartial(order.ID, []ReceivedItem{{OrderItemID: itemID, Quantity: 7}}, "storekeeper"); err == nil {
+		t.Error("поставка сверх остатка заказа принята")
+	}
+	assertReceivedStock(t, db, order.BranchID, nomenclatureID, 4000)
+
+	second, err := service.ReceivePurchaseOrderPartial(order.ID, []ReceivedItem{{OrderItemID: itemID, Quantity: 6}}, "storekeeper")
+	if err != nil {
+		t.Fatalf("вторая поставка: %v", err)
+	}
+	if second.Status != models.PurchaseOrderStatusReceived || second.ActualDeliveryDate == nil {
+		t.Errorf("после второй поставки: статус %s, дата поставки %v, want received с датой", second.Status, second.ActualDeliveryDate)
+	}
+	assertReceivedStock(t, db, order.BranchID, nomenclatureID, 10000)
+
+	var invoices []models.Invoice
+	if err := db.Where("branch_id = ?", order.BranchID).Order("number").Find(&invoices).Error; err != nil {
+		t.Fatalf("не удалось прочитать накладные: %v", err)
+	}
+	if len(invoices) != 2 || invoices[0].Number != "INV-"+order.OrderNumber+"-1" || invoices[1].Number != "INV-"+order.OrderNumber+"-2" {
+		t.Errorf("накладные поставок: %+v, want две с номерами INV-%s-1/-2", invoices, order.OrderNumber)
+	}
+	for _, invoice := range invoices {
+		if invoice.Status != models.InvoiceStatusCompleted {
+			t.Errorf("накладная %s в статусе %s, want completed", invoice.Number, invoice.Status)
+		}
+	}
+
+	if _, err := service.ReceivePurchaseOrderPartial(order.ID, []ReceivedItem{{OrderItemID: itemID, Quantity: 1}}, "storekeeper"); err == nil {
+		t.Error("поставка по полностью полученному заказу принята")
+	}
+}
+
+// assertReceivedStock проверяет суммарный остаток партий товара в филиале (в базовой единице)
+func assertReceivedStock(t *testing.T, db *gorm.DB, branchID, nomenclatureID string, want float64) {
+	t.Helper()
+	var total float64
+	if err := db.Model(&models.StockBatch{}).
+		Where("branch_id = ? AND nomenclature_id = ?", branchID, nomenclatureID).
+		Select("COALESCE(SUM(remaining_quantity), 0)").
+		Scan(&total).Error; err != nil {
+		t.Fatalf("не удалось прочитать остаток: %v", err)
+	}
+	if total != want {
+		t.Errorf("остаток на складе = %v, want %v", total, want)
+	}
+}
@@ -1,19 +1,29 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"time"
 
 	"zephyrvpn/server/internal/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrPurchaseOrderApprovalRequired - сумма заказа выше порога, а заказ еще не утвержден
+var ErrPurchaseOrderApprovalRequired = errors.New("заказ выше порога утверждения: требуется утверждение менеджера")
+
+// ErrPurchaseOrderNotPendingApproval - утвердить можно только заказ в статусе pending_approval
+var ErrPurchaseOrderNotPendingApproval = errors.New("заказ не ожидает утверждения")
+
 // PurchaseOrderService управляет заказами на закупку
 type PurchaseOrderService struct {
 	db          *gorm.DB
 	stockService *StockService
+	approvalThreshold float64 // Заказы дороже порога требуют утверждения (0 = утверждение отключено)
 }
 
 // NewPurchaseOrderService создает новый экземпляр PurchaseOrderService
@@ -24,6 +34,19 @@ func NewPurchaseOrderService(db *gorm.DB, stockService *StockService) *PurchaseO
 	}
 }
 
+// SetApprovalThreshold задает порог суммы заказа, выше которого нужно утверждение менеджера (0 = отключено)
+func (s *PurchaseOrderService) SetApprovalThreshold(threshold float64) {
+	if threshold < 0 {
+		threshold = 0
+	}
+	s.approvalThreshold = threshold
+}
+
+// requiresApproval - нужно ли утверждение заказа с такой суммой
+func (s *PurchaseOrderService) requiresApproval(totalAmount float64) bool {
+	return s.approvalThreshold > 0 && totalAmount > s.approvalThreshold
+}
+
 // ReceivedItem представляет полученный товар при обработке заказа
 type ReceivedItem struct {
 	OrderItemID string     `json:"order_item_id"` // ID позиции заказа
@@ -111,9 +134,24 @@ func (s *PurchaseOrderService) CreatePurchaseOrder(order *models.PurchaseOrder)
 		return fmt.Errorf("заказ должен содержать хотя бы одну позицию")
 	}
 
+	// Округляем количества до целых упаковок поставщика (мешок 25 кг, коробка 12 шт)
+	for i := range order.Items {
+		s.applyPackRounding(order, &order.Items[i])
+	}
+
 	// Пересчитываем общую сумму
 	order.TotalAmount = order.CalculateTotalAmount()
 
+	// Утверждение выдается только через ApprovePurchaseOrder, заказ выше порога ждет его
+	order.ApprovedBy = nil
+	order.ApprovedAt = nil
+	if order.Status == "" || order.Status == models.PurchaseOrderStatusDraft {
+		order.Status = models.PurchaseOrderStatusDraft
+		if s.requiresApproval(order.TotalAmount) {
+			order.Status = models.PurchaseOrderStatusPendingApproval
+		}
+	}
+
 	// Сохраняем заказ и позиции в транзакции
 	tx := s.db.Begin()
 	defer func() {
@@ -123,7 +161,8 @@ func (s *PurchaseOrderService) CreatePurchaseOrder(order *models.PurchaseOrder)
 		}
 	}()
 
-	if err := tx.Create(order).Error; err != nil {
+	// Позиции сохраняются ниже явно: без Omit GORM вставил бы их вместе с заказом, и повторная вставка упала бы по ключу
+	if err := tx.Omit(clause.Associations).Create(order).Error; err != nil {
 		tx.Rollback()
 		return fmt.Errorf("ошибка создания заказа: %w", err)
 	}
@@ -142,6 +181,61 @@ func (s *PurchaseOrderService) CreatePurchaseOrder(order *models.PurchaseOrder)
 	return nil
 }
 
+// applyPackRounding округляет количество позиции вверх до целого числа упаковок из каталога поставщика
+// Каталог ищется для филиала заказа, затем общий (без филиала). Без PackSize позиция не меняется
+func (s *PurchaseOrderService) applyPackRounding(order *models.PurchaseOrder, item *models.PurchaseOrderItem) {
+	if item.NomenclatureID == "" || item.OrderedQuantity <= 0 {
+		return
+	}
+
+	var catalogItem models.SupplierCatalogItem
+	err := s.db.Where("nomenclature_id = ? AND supplier_id = ? AND is_active = true AND pack_size > 0", item.NomenclatureID, order.SupplierID).
+		Where("branch_id = ? OR branch_id IS NULL", order.BranchID).
+		Order("branch_id IS NULL"). // Каталог филиала приоритетнее общего
+		First(&catalogItem).Error
+	if err != nil {
+		return
+	}
+
+	packUnit := catalogItem.PackUnit
+	if packUnit == "" {
+		packUnit = item.Unit
+	}
+	// Сколько единиц позиции в одной упаковке (мешок 25 кг при заказе в г = 25000)
+	factor := unitConversionFactor(packUnit, item.Unit)
+	if factor == 0 {
+		log.Printf("⚠️ Округление до упаковок пропущено: единица упаковки %s несовместима с %s (номенклатура %s)",
+			packUnit, item.Unit, item.NomenclatureID)
+		return
+	}
+	packQuantity := catalogItem.PackSize * factor
+
+	packs := packsFor(item.OrderedQuantity, packQuantity)
+
+	item.RequestedQuantity = item.OrderedQuantity
+	item.PackCount = packs
+	item.PackSize = catalogItem.PackSize
+	item.PackUnit = packUnit
+	item.OrderedQuantity = float64(packs) * packQuantity
+	item.TotalPrice = item.OrderedQuantity * item.PurchasePricePerUnit
+	item.PackRounding = item.DescribePackRounding()
+
+	if item.OrderedQuantity != item.RequestedQuantity {
+		log.Printf("📦 Округление до упаковок: %s (номенклатура %s)", item.PackRounding, item.NomenclatureID)
+	}
+}
+
+// packsFor возвращает число целых упаковок размера packQuantity, покрывающих quantity (не меньше одной)
+func packsFor(quantity, packQuantity float64) int {
+	// Допуск защищает от лишней упаковки из-за погрешности float (50.0000001 / 25 = 2.000000004)
+	// Количества хранятся с точностью до сотых, поэтому допуск в миллионную долю упаковки безопасен
+	packs := int(math.Ceil(quantity/packQuantity - 1e-6))
+	if packs < 1 {
+		packs = 1
+	}
+	return packs
+}
+
 // UpdatePurchaseOrder обновляет заказ (только для черновиков)
 func (s *PurchaseOrderService) UpdatePurchaseOrder(orderID string, updates map[string]interface{}) (*models.PurchaseOrder, error) {
 	var order models.PurchaseOrder
@@ -149,11 +243,16 @@ func (s *PurchaseOrderService) UpdatePurchaseOrder(orderID string, updates map[s
 		return nil, fmt.Errorf("заказ не найден: %w", err)
 	}
 
-	// Проверяем, что заказ является черновиком
-	if order.Status != models.PurchaseOrderStatusDraft {
+	// Проверяем, что заказ является черновиком (или ждет утверждения - его можно поправить до утверждения)
+	if order.Status != models.PurchaseOrderStatusDraft && order.Status != models.PurchaseOrderStatusPendingApproval {
 		return nil, fmt.Errorf("можно обновлять только черновики (текущий статус: %s)", order.Status)
 	}
 
+	// Статус и утверждение меняются только через Send/Approve/Cancel
+	delete(updates, "status")
+	delete(updates, "approved_by")
+	delete(updates, "approved_at")
+
 	// Обновляем поля
 	if err := s.db.Model(&order).Updates(updates).Error; err != nil {
 		return nil, fmt.Errorf("ошибка обновления заказа: %w", err)
@@ -162,8 +261,22 @@ func (s *PurchaseOrderService) UpdatePurchaseOrder(orderID string, updates map[s
 	// Пересчитываем общую сумму, если изменились позиции
 	if _, ok := updates["items"]; ok {
 		if err := s.db.Preload("Items").First(&order, "id = ?", orderID).Error; err == nil {
+			oldTotal := order.TotalAmount
 			order.TotalAmount = order.CalculateTotalAmount()
-			s.db.Model(&order).Update("total_amount", order.TotalAmount)
+			orderUpdates := map[string]interface{}{"total_amount": order.TotalAmount}
+			// Изменение суммы снимает утверждение: заказ выше порога снова ждет утверждения
+			if order.TotalAmount != oldTotal {
+				order.Status = models.PurchaseOrderStatusDraft
+				if s.requiresApproval(order.TotalAmount) {
+					order.Status = models.PurchaseOrderStatusPendingApproval
+				}
+				order.ApprovedBy = nil
+				order.ApprovedAt = nil
+				orderUpdates["status"] = order.Status
+				orderUpdates["approved_by"] = nil
+				orderUpdates["approved_at"] = nil
+			}
+			s.db.Model(&order).Updates(orderUpdates)
 		}
 	}
 
@@ -171,12 +284,17 @@ func (s *PurchaseOrderService) UpdatePurchaseOrder(orderID string, updates map[s
 }
 
 // SendPurchaseOrder отправляет заказ поставщику (draft → ordered)
+// Заказ выше порога утверждения отправляется только после ApprovePurchaseOrder - иначе ErrPurchaseOrderApprovalRequired
 func (s *PurchaseOrderService) SendPurchaseOrder(orderID string, approvedBy string) error {
 	var order models.PurchaseOrder
 	if err := s.db.Preload("Items").First(&order, "id = ? AND deleted_at IS NULL", orderID).Error; err != nil {
 		return fmt.Errorf("заказ не найден: %w", err)
 	}
 
+	if order.IsPendingApproval() {
+		return ErrPurchaseOrderApprovalRequired
+	}
+
 	if order.Status != models.PurchaseOrderStatusDraft {
 		return fmt.Errorf("можно отправить только черновик (текущий статус: %s)", order.Status)
 	}
@@ -185,8 +303,14 @@ func (s *PurchaseOrderService) SendPurchaseOrder(orderID string, approvedBy stri
 		return fmt.Errorf("нельзя отправить заказ без позиций")
 	}
 
+	// Черновик, созданный до включения порога (или до его снижения), тоже требует утверждения
+	if order.ApprovedAt == nil && s.requiresApproval(order.TotalAmount) {
+		return ErrPurchaseOrderApprovalRequired
+	}
+
 	order.Status = models.PurchaseOrderStatusOrdered
-	if approvedBy != "" {
+	// Утвердивший менеджер не перезаписывается отправителем
+	if approvedBy != "" && order.ApprovedAt == nil {
 		order.ApprovedBy = &approvedBy
 	}
 
@@ -198,6 +322,44 @@ func (s *PurchaseOrderService) SendPurchaseOrder(orderID string, approvedBy stri
 	return nil
 }
 
+// ApprovePurchaseOrder утверждает заказ выше порога (pending_approval → draft), после чего его можно отправить
+// Записывает утвердившего и время утверждения
+func (s *PurchaseOrderService) ApprovePurchaseOrder(orderID string, approvedBy string) (*models.PurchaseOrder, error) {
+	if approvedBy == "" {
+		return nil, fmt.Errorf("не указан утверждающий")
+	}
+
+	var order models.PurchaseOrder
+	if err := s.db.First(&order, "id = ? AND deleted_at IS NULL", orderID).Error; err != nil {
+		return nil, fmt.Errorf("заказ не найден: %w", err)
+	}
+	if !order.IsPendingApproval() {
+		return nil, fmt.Errorf("%w (текущий статус: %s)", ErrPurchaseOrderNotPendingApproval, order.Status)
+	}
+
+	now := time.Now()
+	// Условие на статус защищает от двойного утверждения и параллельного изменения заказа
+	result := s.db.Model(&models.PurchaseOrder{}).
+		Where("id = ? AND status = ?", order.ID, models.PurchaseOrderStatusPendingApproval).
+		Updates(map[string]interface{}{
+			"status":      models.PurchaseOrderStatusDraft,
+			"approved_by": approvedBy,
+			"approved_at": now,
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("ошибка утверждения заказа: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrPurchaseOrderNotPendingApproval
+	}
+
+	order.Status = models.PurchaseOrderStatusDraft
+	order.ApprovedBy = &approvedBy
+	order.ApprovedAt = &now
+	log.Printf("✅ Заказ утвержден: %s (ID: %s, сумма %.2f, утвердил %s)", order.OrderNumber, order.ID, order.TotalAmount, approvedBy)
+	return &order, nil
+}
+
 // ReceivePurchaseOrder обрабатывает получение заказа складским работником
 // Создает накладную-черновик для сверки бухгалтерией (НЕ оприходует товар автоматически)
 func (s *PurchaseOrderService) ReceivePurchaseOrder(
@@ -223,7 +385,7 @@ func (s *PurchaseOrderService) ReceivePurchaseOrder(
 	if order.IsReceived() {
 		return fmt.Errorf("заказ уже получен полностью")
 	}
-	if order.Status == models.PurchaseOrderStatusDraft {
+	if order.Status == models.PurchaseOrderStatusDraft || order.IsPendingApproval() {
 		return fmt.Errorf("нельзя получить черновик, сначала отправьте заказ поставщику")
 	}
 
@@ -382,6 +544,195 @@ func (s *PurchaseOrderService) ReceivePurchaseOrder(
 	return nil
 }
 
+// ReceivePurchaseOrderPartial принимает очередную поставку по заказу (доставка частями)
+// В отличие от ReceivePurchaseOrder сразу оприходует пришедшее количество на склад
+// через StockService.ProcessInboundInvoiceBatch: на каждую поставку создается своя накладная и партии
+// Заказ остается в статусе partially_received, пока все позиции не будут получены полностью
+func (s *PurchaseOrderService) ReceivePurchaseOrderPartial(
+	purchaseOrderID string,
+	receivedItems []ReceivedItem,
+	performedBy string,
+) (*models.PurchaseOrder, error) {
+	if s.stockService == nil {
+		return nil, fmt.Errorf("StockService не инициализирован")
+	}
+	if len(receivedItems) == 0 {
+		return nil, fmt.Errorf("не указаны полученные позиции")
+	}
+
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			log.Printf("❌ Транзакция откачена из-за panic: %v", r)
+		}
+	}()
+
+	// 1. Блокируем заказ, чтобы две поставки не были приняты одновременно
+	var order models.PurchaseOrder
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&order, "id = ? AND deleted_at IS NULL", purchaseOrderID).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("заказ не найден: %w", err)
+	}
+	if err := tx.Preload("Nomenclature").
+		Where("purchase_order_id = ?", order.ID).
+		Find(&order.Items).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("ошибка загрузки позиций заказа: %w", err)
+	}
+
+	// 2. Проверяем статус заказа
+	if order.Status != models.PurchaseOrderStatusOrdered && order.Status != models.PurchaseOrderStatusPartiallyReceived {
+		tx.Rollback()
+		return nil, fmt.Errorf("принимать поставку можно только по отправленному заказу (текущий статус: %s)", order.Status)
+	}
+
+	// 3. Проверяем количества и формируем позиции накладной только для пришедшего товара
+	itemsByID := make(map[string]*models.PurchaseOrderItem, len(order.Items))
+	for i := range order.Items {
+		itemsByID[order.Items[i].ID] = &order.Items[i]
+	}
+
+	totalAmount := 0.0
+	invoiceItems := make([]map[string]interface{}, 0, len(receivedItems))
+	changedItems := make(map[string]*models.PurchaseOrderItem)
+
+	for _, receivedItem := range receivedItems {
+		orderItem, ok := itemsByID[receivedItem.OrderItemID]
+		if !ok {
+			tx.Rollback()
+			return nil, fmt.Errorf("позиция заказа не найдена: %s", receivedItem.OrderItemID)
+		}
+		if receivedItem.Quantity <= 0 {
+			tx.Rollback()
+			return nil, fmt.Errorf("полученное количество должно быть > 0 для позиции %s", receivedItem.OrderItemID)
+		}
+
+		remaining := orderItem.GetRemainingQuantity()
+		if receivedItem.Quantity > remaining {
+			tx.Rollback()
+			return nil, fmt.Errorf("полученное количество (%.2f) превышает остаток к получению (%.2f) для позиции %s",
+				receivedItem.Quantity, remaining, receivedItem.OrderItemID)
+		}
+
+		orderItem.ReceivedQuantity += receivedItem.Quantity
+		orderItem.ReceivedTotalPrice = orderItem.ReceivedQuantity * orderItem.PurchasePricePerUnit
+		changedItems[orderItem.ID] = orderItem
+
+		lineTotal := receivedItem.Quantity * orderItem.PurchasePricePerUnit
+		totalAmount += lineTotal
+
+		itemData := map[string]interface{}{
+			"nomenclature_id": orderItem.NomenclatureID,
+			"branch_id":       order.BranchID,
+			"quantity":        receivedItem.Quantity,
+			"unit":            orderItem.Unit,
+			"price_per_unit":  orderItem.PurchasePricePerUnit,
+		}
+		expiryDate := receivedItem.ExpiryDate
+		if expiryDate == nil {
+			expiryDate = orderItem.ExpiryDate
+		}
+		if expiryDate != nil {
+			itemData["expiry_date"] = expiryDate.Format("2006-01-02")
+		}
+
+		// ProcessInboundInvoiceBatch молча пропускает невалидные строки - проверяем заранее,
+		// иначе received_quantity разойдется с фактически оприходованным количеством
+		if _, err := ValidateInvoiceItem(s.db, itemData); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("позиция %s не может быть оприходована: %w", receivedItem.OrderItemID, err)
+		}
+		invoiceItems = append(invoiceItems, itemData)
+	}
+
+	// 4. Обновляем позиции и статус заказа
+	for _, item := range changedItems {
+		if err := tx.Model(item).Updates(map[string]interface{}{
+			"received_quantity":    item.ReceivedQuantity,
+			"received_total_price": item.ReceivedTotalPrice,
+		}).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("ошибка обновления позиции: %w", err)
+		}
+	}
+
+	allItemsReceived := true
+	for _, item := range order.Items {
+		if !item.IsFullyReceived() {
+			allItemsReceived = false
+			break
+		}
+	}
+
+	orderUpdates := map[string]interface{}{
+		"received_by": performedBy,
+	}
+	if allItemsReceived {
+		now := time.Now()
+		order.Status = models.PurchaseOrderStatusReceived
+		order.ActualDeliveryDate = &now
+		orderUpdates["actual_delivery_date"] = now
+	} else {
+		order.Status = models.PurchaseOrderStatusPartiallyReceived
+	}
+	orderUpdates["status"] = order.Status
+	order.ReceivedBy = &performedBy
+
+	if err := tx.Model(&models.PurchaseOrder{}).Where("id = ?", order.ID).Updates(orderUpdates).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("ошибка обновления заказа: %w", err)
+	}
+
+	// 5. Оприходуем пришедшую часть: черновик накладной с номером поставки,
+	// который ProcessInboundInvoiceBatch переведет в completed и создаст партии
+	var installmentCount int64
+	s.db.Model(&models.Invoice{}).
+		Where("number LIKE ?", fmt.Sprintf("INV-%s-%%", order.OrderNumber)).
+		Count(&installmentCount)
+
+	invoice := &models.Invoice{
+		Number:         fmt.Sprintf("INV-%s-%d", order.OrderNumber, installmentCount+1),
+		CounterpartyID: &order.SupplierID,
+		TotalAmount:    totalAmount,
+		Status:         models.InvoiceStatusDraft,
+		BranchID:       order.BranchID,
+		InvoiceDate:    time.Now(),
+		PerformedBy:    performedBy,
+		Notes:          fmt.Sprintf("Поставка по заказу %s", order.OrderNumber),
+	}
+	if err := s.db.Create(invoice).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("ошибка создания накладной: %w", err)
+	}
+
+	isPaidCash := order.PaymentMethod == "cash"
+	if _, err := s.stockService.ProcessInboundInvoiceBatch(
+		invoice.ID,
+		invoiceItems,
+		performedBy,
+		order.SupplierID,
+		totalAmount,
+		isPaidCash,
+		invoice.InvoiceDate.Format("2006-01-02"),
+	); err != nil {
+		tx.Rollback()
+		s.db.Delete(invoice)
+		return nil, fmt.Errorf("ошибка оприходования поставки: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("❌ Поставка по заказу %s оприходована (накладная %s), но заказ не обновлен: %v",
+			order.OrderNumber, invoice.Number, err)
+		return nil, fmt.Errorf("ошибка коммита транзакции: %w", err)
+	}
+
+	log.Printf("✅ Принята поставка по заказу %s: накладная %s, %d позиций, сумма %.2f, статус заказа: %s",
+		order.OrderNumber, invoice.Number, len(invoiceItems), totalAmount, order.Status)
+	return &order, nil
+}
+
 // CancelPurchaseOrder отменяет заказ
 func (s *PurchaseOrderService) CancelPurchaseOrder(orderID string, reason string) error {
 	var order models.PurchaseOrder
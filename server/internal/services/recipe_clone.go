@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"zephyrvpn/server/internal/models"
+)
+
+// ErrRecipeNameConflict - рецепт с таким именем уже существует (меню и станции ищут рецепт по имени)
+var ErrRecipeNameConflict = errors.New("рецепт с таким именем уже существует")
+
+// CloneRecipe создает копию рецепта с ингредиентами под новым именем как черновик (is_active = false)
+// Копируются только строки RecipeIngredient: ссылки на сырье и полуфабрикаты остаются прежними,
+// вложенные рецепты не дублируются. Копия не привязывается к позиции меню
+func (s *RecipeService) CloneRecipe(sourceID, newName string) (*models.Recipe, error) {
+	source, err := s.GetRecipe(sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		newName = source.Name + " (копия)"
+	}
+
+	var existing int64
+	if err := s.db.Model(&models.Recipe{}).Where("name = ?", newName).Count(&existing).Error; err != nil {
+		return nil, fmt.Errorf("ошибка проверки имени рецепта: %w", err)
+	}
+	if existing > 0 {
+		return nil, fmt.Errorf("%w: '%s'", ErrRecipeNameConflict, newName)
+	}
+
+	clone := models.Recipe{
+		Name:               newName,
+		Description:        source.Description,
+		StationIDs:         source.StationIDs,
+		PortionSize:        source.PortionSize,
+		Unit:               source.Unit,
+		IsSemiFinished:     source.IsSemiFinished,
+		AllowSubstitutions: source.AllowSubstitutions,
+		InstructionText:    source.InstructionText,
+		VideoURL:           source.VideoURL,
+		PhotoURLs:          source.PhotoURLs,
+	}
+
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			log.Printf("❌ CloneRecipe: panic recovered, transaction rolled back: %v", r)
+		}
+	}()
+
+	// photo_urls (JSONB) не вставляем пустой строкой - как в CreateRecipe
+	createQuery := tx.Omit("Ingredients")
+	if clone.PhotoURLs == "" {
+		createQuery = createQuery.Omit("photo_urls")
+	}
+	if err := createQuery.Create(&clone).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("ошибка создания копии рецепта: %w", err)
+	}
+	// is_active имеет default:true, поэтому false при Create не попадает в INSERT
+	if err := tx.Model(&clone).Update("is_active", false).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("ошибка пометки копии как черновика: %w", err)
+	}
+
+	for i, ingredient := range source.Ingredients {
+		copied := models.RecipeIngredient{
+			RecipeID:           clone.ID,
+			NomenclatureID:     ingredient.NomenclatureID,
+			IngredientRecipeID: ingredient.IngredientRecipeID, // Ссылка на существующий полуфабрикат
+			Quantity:           ingredient.Quantity,
+			Unit:               ingredient.Unit,
+			IsOptional:         ingredient.IsOptional,
+		}
+		if err := tx.Create(&copied).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("ошибка копирования ингредиента #%d: %w", i+1, err)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("ошибка коммита транзакции: %w", err)
+	}
+
+	log.Printf("📋 CloneRecipe: рецепт '%s' (ID: %s) скопирован как черновик '%s' (ID: %s), ингредиентов: %d",
+		source.Name, source.ID, clone.Name, clone.ID, len(source.Ingredients))
+
+	return s.GetRecipe(clone.ID)
+}
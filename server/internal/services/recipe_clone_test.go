@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Пицца с двумя видами сырья и полуфабрикатом-тестом: копия - неактивный черновик с теми же строками,
+// полуфабрикат не дублируется
+func TestCloneRecipe(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureCategory{}, &models.NomenclatureItem{}, &models.Recipe{}, &models.RecipeIngredient{})
+	service := NewRecipeService(db)
+	suffix := uuid.New().String()[:8]
+
+	var itemIDs, recipeIDs []string
+	t.Cleanup(func() {
+		db.Where("recipe_id IN ?", recipeIDs).Delete(&models.RecipeIngredient{})
+		db.Unscoped().Where("id IN ?", recipeIDs).Delete(&models.Recipe{})
+		db.Unscoped().Where("id IN ?", itemIDs).Delete(&models.NomenclatureItem{})
+	})
+	newItem := func(name string) string {
+		t.Helper()
+		item := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: name + " " + suffix, BaseUnit: "g", IsActive: true}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("не удалось создать товар: %v", err)
+		}
+		itemIDs = append(itemIDs, item.ID)
+		return item.ID
+	}
+	cheese, tomatoes := newItem("Моцарелла"), newItem("Томаты")
+
+	dough := models.Recipe{Name: "Тесто " + suffix, IsActive: true, IsSemiFinished: true, PortionSize: 1000, Unit: "g", PhotoURLs: "[]"}
+	if err := db.Create(&dough).Error; err != nil {
+		t.Fatalf("не удалось создать полуфабрикат: %v", err)
+	}
+	recipeIDs = append(recipeIDs, dough.ID)
+	source := models.Recipe{
+		Name: "Маргарита " + suffix, Description: "Классика", PortionSize: 1, Unit: "pcs", IsActive: true,
+		AllowSubstitutions: true, InstructionText: "Раскатать тесто", PhotoURLs: "[]",
+		Ingredients: []models.RecipeIngredient{
+			{NomenclatureID: &cheese, Quantity: 150, Unit: "g"},
+			{NomenclatureID: &tomatoes, Quantity: 80, Unit: "g", IsOptional: true},
+			{IngredientRecipeID: &dough.ID, Quantity: 300, Unit: "g"},
+		},
+	}
+	if err := db.Create(&source).Error; err != nil {
+		t.Fatalf("не удалось создать рецепт: %v", err)
+	}
+	recipeIDs = append(recipeIDs, source.ID)
+
+	var recipesBefore int64
+	db.Model(&models.Recipe{}).Count(&recipesBefore)
+
+	clone, err := service.CloneRecipe(source.ID, "  Маргарита XL "+suffix+" ")
+	if err != nil {
+		t.Fatalf("CloneRecipe: %v", err)
+	}
+	recipeIDs = append(recipeIDs, clone.ID)
+
+	if clone.ID == source.ID || clone.Name != "Маргарита XL "+suffix || clone.IsActive {
+		t.Errorf("копия %s '%s' (активна: %v), want новый неактивный рецепт 'Маргарита XL'", clone.ID, clone.Name, clone.IsActive)
+	}
+	if clone.Description != "Классика" || clone.InstructionText != "Раскатать тесто" || !clone.AllowSubstitutions ||
+		clone.PortionSize != 1 || clone.Unit != "pcs" {
+		t.Errorf("поля копии %+v не совпадают с исходным рецептом", clone)
+	}
+	if len(clone.Ingredients) != 3 {
+		t.Fatalf("ингредиентов в копии %d, want 3", len(clone.Ingredients))
+	}
+	byTarget := make(map[string]models.RecipeIngredient)
+	for _, ingredient := range clone.Ingredients {
+		if ingredient.RecipeID != clone.ID {
+			t.Errorf("ингредиент %s привязан к %s, want к копии", ingredient.ID, ingredient.RecipeID)
+		}
+		switch {
+		case ingredient.NomenclatureID != nil:
+			byTarget[*ingredient.NomenclatureID] = ingredient
+		case ingredient.IngredientRecipeID != nil:
+			byTarget[*ingredient.IngredientRecipeID] = ingredient
+		}
+	}
+	if got := byTarget[cheese]; got.Quantity != 150 || got.IsOptional {
+		t.Errorf("моцарелла в копии %+v, want 150 г", got)
+	}
+	if got := byTarget[tomatoes]; got.Quantity != 80 || !got.IsOptional {
+		t.Errorf("томаты в копии %+v, want 80 г, опционально", got)
+	}
+	if got := byTarget[dough.ID]; got.Quantity != 300 {
+		t.Errorf("полуфабрикат в копии %+v, want ссылку на существующее тесто 300 г", got)
+	}
+
+	// Создан ровно один рецепт - копия; исходный рецепт не изменился
+	var recipesAfter int64
+	db.Model(&models.Recipe{}).Count(&recipesAfter)
+	if recipesAfter != recipesBefore+1 {
+		t.Errorf("рецептов стало %d, want %d (полуфабрикат не дублируется)", recipesAfter, recipesBefore+1)
+	}
+	original, err := service.GetRecipe(source.ID)
+	if err != nil || len(original.Ingredients) != 3 || !original.IsActive {
+		t.Errorf("исходный рецепт изменился: %+v, %v", original, err)
+	}
+
+	if _, err := service.CloneRecipe(source.ID, "Маргарита XL "+suffix); !errors.Is(err, ErrRecipeNameConflict) {
+		t.Errorf("повтор имени: %v, want ErrRecipeNameConflict", err)
+	}
+	if _, err := service.CloneRecipe(uuid.New().String(), "Несуществующий "+suffix); err == nil {
+		t.Error("несуществующий рецепт: want ошибку")
+	}
+}
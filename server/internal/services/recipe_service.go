@@ -35,14 +35,15 @@ func (s *RecipeService) validateNomenclatureIngredient(tx *gorm.DB, ingredient *
 	if normalizedUnit == "" {
 		normalizedUnit = "g" // Значение по умолчанию
 	}
-	ingredient.Unit = normalizedUnit
 
-	// Проверяем совместимость единиц измерения
-	if !s.isUnitCompatible(normalizedUnit, nomenclature) {
-		return fmt.Errorf("ингредиент #%d: единица измерения '%s' несовместима с номенклатурой '%s' (поддерживаемые единицы: %s, %s, %s)", 
-			ingredientIndex+1, normalizedUnit, nomenclature.Name,
-			nomenclature.BaseUnit, nomenclature.InboundUnit, nomenclature.ProductionUnit)
+	// Проверяем, что единицу можно пересчитать в базовую теми же правилами, что и при списании
+	unit, err := resolveIngredientUnit(normalizedUnit, nomenclature)
+	if err != nil {
+		return fmt.Errorf("%w: ингредиент #%d '%s': единица '%s' не пересчитывается в базовую единицу '%s' (допустимые единицы: %s)",
+			ErrInvalidIngredientUnit, ingredientIndex+1, nomenclature.Name, normalizedUnit, nomenclature.BaseUnit,
+			strings.Join(acceptableIngredientUnits(nomenclature), ", "))
 	}
+	ingredient.Unit = unit
 
 	return nil
 }
@@ -365,10 +366,15 @@ func (s *RecipeService) UnifiedCreateMenuItem(
 }
 
 // GetRecipes возвращает список всех рецептов
-func (s *RecipeService) GetRecipes(includeInactive bool) ([]models.Recipe, error) {
+// includeDeleted=true - вместе с удаленными рецептами (для восстановления)
+func (s *RecipeService) GetRecipes(includeInactive, includeDeleted bool) ([]models.Recipe, error) {
 	var recipes []models.Recipe
-	query := s.db.Preload("Ingredients").Preload("Ingredients.Nomenclature").Preload("Ingredients.IngredientRecipe").
-		Where("deleted_at IS NULL") // Исключаем удаленные рецепты
+	query := s.db.Preload("Ingredients").Preload("Ingredients.Nomenclature").Preload("Ingredients.IngredientRecipe")
+	if includeDeleted {
+		query = query.Unscoped()
+	} else {
+		query = query.Where("deleted_at IS NULL") // Исключаем удаленные рецепты
+	}
 
 	if !includeInactive {
 		query = query.Where("is_active = ?", true)
@@ -378,7 +384,7 @@ func (s *RecipeService) GetRecipes(includeInactive bool) ([]models.Recipe, error
 		return nil, err
 	}
 
-	log.Printf("📋 GetRecipes: возвращено %d рецептов (includeInactive: %v)", len(recipes), includeInactive)
+	log.Printf("📋 GetRecipes: возвращено %d рецептов (includeInactive: %v, includeDeleted: %v)", len(recipes), includeInactive, includeDeleted)
 	return recipes, nil
 }
 
@@ -579,6 +585,7 @@ func (s *RecipeService) UpdateRecipe(recipeID string, recipe *models.Recipe) err
 		"unit":            recipe.Unit,
 		"is_semi_finished": recipe.IsSemiFinished,
 		"is_active":       recipe.IsActive,
+		"allow_substitutions": recipe.AllowSubstitutions,
 	}
 	
 	// Обновляем поля Recipe Book (если указаны)
@@ -676,6 +683,54 @@ func (s *RecipeService) DeleteRecipe(recipeID string) error {
 	return nil
 }
 
+// RestoreRecipe восстанавливает удаленный рецепт
+// Меню и распределение по станциям ищут рецепт по имени, поэтому два живых рецепта
+// с одним именем недопустимы - в этом случае ErrRestoreConflict
+func (s *RecipeService) RestoreRecipe(recipeID string) (*models.Recipe, error) {
+	var recipe models.Recipe
+	if err := s.db.Unscoped().Where("id = ?", recipeID).First(&recipe).Error; err != nil {
+		return nil, err
+	}
+	if !recipe.DeletedAt.Valid {
+		return s.GetRecipe(recipeID)
+	}
+
+	var live models.Recipe
+	if err := s.db.Where("name = ? AND id != ? AND deleted_at IS NULL", recipe.Name, recipeID).First(&live).Error; err == nil {
+		return nil, fmt.Errorf("%w: рецепт с именем '%s' уже существует", ErrRestoreConflict, recipe.Name)
+	}
+
+	if err := s.db.Unscoped().Model(&recipe).Update("deleted_at", nil).Error; err != nil {
+		return nil, fmt.Errorf("ошибка восстановления рецепта: %w", err)
+	}
+
+	log.Printf("♻️ Восстановлен рецепт %s (ID: %s)", recipe.Name, recipeID)
+	s.invalidateMenuCache()
+
+	return s.GetRecipe(recipeID)
+}
+
+// SetPizzaPrepTime задает время приготовления пиццы (секунды, 0 - значение по умолчанию)
+// Сумма по позициям заказа дает срок готовности на KDS; меню перезагружается через Pub/Sub
+func (s *RecipeService) SetPizzaPrepTime(pizzaName string, seconds int) error {
+	if seconds < 0 {
+		return fmt.Errorf("время приготовления не может быть отрицательным")
+	}
+
+	result := s.db.Model(&models.PizzaRecipe{}).Where("name = ?", pizzaName).Update("prep_seconds", seconds)
+	if result.Error != nil {
+		return fmt.Errorf("ошибка обновления времени приготовления: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	log.Printf("⏱️ Время приготовления пиццы %s: %d сек", pizzaName, seconds)
+	s.invalidateMenuCache()
+
+	return nil
+}
+
 // invalidateMenuCache публикует событие обновления меню в Redis
 func (s *RecipeService) invalidateMenuCache() {
 	if s.redisUtil != nil {
@@ -732,6 +787,50 @@ func (s *RecipeService) checkCyclicDependency(originalRecipeID string, currentRe
 	return nil
 }
 
+// GetRecipeAllergens возвращает объединение аллергенов всех ингредиентов рецепта,
+// включая ингредиенты вложенных полуфабрикатов (на любую глубину)
+func (s *RecipeService) GetRecipeAllergens(recipeID string) ([]string, error) {
+	var recipe models.Recipe
+	if err := s.db.First(&recipe, "id = ?", recipeID).Error; err != nil {
+		return nil, fmt.Errorf("рецепт не найден: %w", err)
+	}
+
+	allergens := make([]string, 0)
+	visited := make(map[string]bool)
+	if err := s.collectRecipeAllergens(recipeID, visited, &allergens); err != nil {
+		return nil, err
+	}
+	return models.NormalizeAllergens(allergens), nil
+}
+
+// collectRecipeAllergens рекурсивно собирает аллергены рецепта
+// visited защищает от циклов и повторного обхода общего полуфабриката (как в checkCyclicDependency)
+func (s *RecipeService) collectRecipeAllergens(recipeID string, visited map[string]bool, allergens *[]string) error {
+	if visited[recipeID] {
+		return nil
+	}
+	visited[recipeID] = true
+
+	var recipe models.Recipe
+	if err := s.db.Preload("Ingredients.Nomenclature").First(&recipe, "id = ?", recipeID).Error; err != nil {
+		return fmt.Errorf("ошибка загрузки рецепта %s: %w", recipeID, err)
+	}
+
+	for _, ingredient := range recipe.Ingredients {
+		if ingredient.IngredientRecipeID != nil {
+			if err := s.collectRecipeAllergens(*ingredient.IngredientRecipeID, visited, allergens); err != nil {
+				return err
+			}
+			continue
+		}
+		if ingredient.Nomenclature != nil {
+			*allergens = append(*allergens, ingredient.Nomenclature.Allergens...)
+		}
+	}
+
+	return nil
+}
+
 // GetFolderContent возвращает содержимое папки (дочерние узлы)
 func (s *RecipeService) GetFolderContent(parentID *string) ([]models.RecipeNode, error) {
 	var nodes []models.RecipeNode
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultMaxRecipeDepth - максимальная вложенность полуфабрикатов при обходе рецепта
+const DefaultMaxRecipeDepth = 20
+
+// ErrRecipeCycle - рецепт (через полуфабрикаты) ссылается сам на себя
+var ErrRecipeCycle = errors.New("обнаружена циклическая зависимость в рецептах")
+
+// ErrRecipeDepthExceeded - полуфабрикаты вложены глубже допустимого
+var ErrRecipeDepthExceeded = errors.New("превышена допустимая вложенность полуфабрикатов")
+
+// recipePath - цепочка рецептов текущей ветки обхода (от готового блюда к полуфабрикату)
+// Цикл - это повтор рецепта в своей же ветке; один полуфабрикат в соседних ветках циклом не считается
+type recipePath struct {
+	ids      []string
+	names    []string
+	maxDepth int
+}
+
+// SetMaxRecipeDepth задает максимальную вложенность полуфабрикатов (0 = DefaultMaxRecipeDepth)
+func (s *StockService) SetMaxRecipeDepth(depth int) {
+	s.maxRecipeDepth = depth
+}
+
+// newRecipePath создает пустую цепочку обхода с лимитом вложенности сервиса
+func (s *StockService) newRecipePath() *recipePath {
+	maxDepth := s.maxRecipeDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxRecipeDepth
+	}
+	return &recipePath{maxDepth: maxDepth}
+}
+
+// enter добавляет рецепт в цепочку; после успешного enter обязателен leave
+// Возвращает ErrRecipeCycle с полным путем по названиям или ErrRecipeDepthExceeded
+func (p *recipePath) enter(id, name string) error {
+	for i, visited := range p.ids {
+		if visited == id {
+			loop := append(append([]string{}, p.names[i:]...), name)
+			return fmt.Errorf("%w: %s", ErrRecipeCycle, strings.Join(loop, " → "))
+		}
+	}
+	if len(p.ids) >= p.maxDepth {
+		chain := append(append([]string{}, p.names...), name)
+		return fmt.Errorf("%w (максимум %d): %s", ErrRecipeDepthExceeded, p.maxDepth, strings.Join(chain, " → "))
+	}
+	p.ids = append(p.ids, id)
+	p.names = append(p.names, name)
+	return nil
+}
+
+// leave убирает последний рецепт из цепочки
+func (p *recipePath) leave() {
+	p.ids = p.ids[:len(p.ids)-1]
+	p.names = p.names[:len(p.names)-1]
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestRecipePath(t *testing.T) {
+	path := &recipePath{maxDepth: 5}
+	names := []string{"Пицца", "Соус", "Основа", "Бульон", "Специи"}
+	for i, name := range names {
+		if err := path.enter(string(rune('a'+i)), name); err != nil {
+			t.Fatalf("уровень %d (%s): %v", i+1, name, err)
+		}
+	}
+	err := path.enter("f", "Соль")
+	if !errors.Is(err, ErrRecipeDepthExceeded) || !strings.Contains(err.Error(), "Пицца → Соус → Основа → Бульон → Специи → Соль") {
+		t.Errorf("шестой уровень: %v, want ErrRecipeDepthExceeded с цепочкой", err)
+	}
+
+	// Один полуфабрикат в соседних ветках - не цикл
+	path.leave()
+	path.leave()
+	if err := path.enter("e", "Специи"); err != nil {
+		t.Errorf("повторный вход в соседней ветке: %v", err)
+	}
+
+	// Возврат к рецепту своей ветки - цикл, в ошибке путь по названиям от повторного рецепта
+	err = path.enter("b", "Соус")
+	if !errors.Is(err, ErrRecipeCycle) || !strings.Contains(err.Error(), "Соус → Основа → Специи → Соус") {
+		t.Errorf("цикл: %v, want ErrRecipeCycle с путем", err)
+	}
+}
+
+// Пять уровней полуфабрикатов считаются, лимит вложенности ниже глубины рецепта дает ошибку,
+// цикл из трех рецептов называет их все
+func TestCalculatePrimeCostNesting(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.Recipe{}, &models.RecipeIngredient{})
+	service := NewStockService(db)
+	suffix := uuid.New().String()[:8]
+
+	salt := models.NomenclatureItem{SKU: "TEST-" + suffix, Name: "Соль " + suffix, BaseUnit: "g", InboundUnit: "kg",
+		LastPrice: 100, IsActive: true}
+	if err := db.Create(&salt).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	var recipeIDs []string
+	t.Cleanup(func() {
+		db.Where("recipe_id IN ?", recipeIDs).Delete(&models.RecipeIngredient{})
+		db.Unscoped().Where("id IN ?", recipeIDs).Delete(&models.Recipe{})
+		db.Unscoped().Where("id = ?", salt.ID).Delete(&models.NomenclatureItem{})
+	})
+	newRecipe := func(name string, ingredient models.RecipeIngredient) string {
+		t.Helper()
+		recipe := models.Recipe{Name: name + " " + suffix, IsActive: true, IsSemiFinished: true, PortionSize: 1000,
+			PhotoURLs: "[]", Ingredients: []models.RecipeIngredient{ingredient}}
+		if err := db.Create(&recipe).Error; err != nil {
+			t.Fatalf("не удалось создать рецепт: %v", err)
+		}
+		recipeIDs = append(recipeIDs, recipe.ID)
+		return recipe.ID
+	}
+	semiFinished := func(id string) models.RecipeIngredient {
+		return models.RecipeIngredient{IngredientRecipeID: &id, Quantity: 1000, Unit: "g"}
+	}
+
+	// Специи (1 кг соли = 100 руб) → Бульон → Основа → Соус → Пицца: каждый уровень берет порцию целиком
+	recipeID := newRecipe("Специи", models.RecipeIngredient{NomenclatureID: &salt.ID, Quantity: 1000, Unit: "g"})
+	for _, name := range []string{"Бульон", "Основа", "Соус", "Пицца"} {
+		recipeID = newRecipe(name, semiFinished(recipeID))
+	}
+	cost, err := service.CalculatePrimeCost(recipeID)
+	if err != nil || cost != 100 {
+		t.Fatalf("пять уровней: %v, %v; want 100", cost, err)
+	}
+
+	service.SetMaxRecipeDepth(4)
+	if _, err := service.CalculatePrimeCost(recipeID); !errors.Is(err, ErrRecipeDepthExceeded) {
+		t.Errorf("лимит 4 при глубине 5: %v, want ErrRecipeDepthExceeded", err)
+	}
+	service.SetMaxRecipeDepth(0)
+
+	// Тесто → Закваска → Опара → Тесто
+	dough := newRecipe("Тесто", models.RecipeIngredient{NomenclatureID: &salt.ID, Quantity: 10, Unit: "g"})
+	starter := newRecipe("Закваска", semiFinished(dough))
+	sponge := newRecipe("Опара", semiFinished(starter))
+	if err := db.Create(&models.RecipeIngredient{RecipeID: dough, IngredientRecipeID: &sponge, Quantity: 100, Unit: "g"}).Error; err != nil {
+		t.Fatalf("не удалось замкнуть цикл: %v", err)
+	}
+	_, err = service.CalculatePrimeCost(sponge)
+	want := "Опара " + suffix + " → Закваска " + suffix + " → Тесто " + suffix + " → Опара " + suffix
+	if !errors.Is(err, ErrRecipeCycle) || !strings.Contains(err.Error(), want) {
+		t.Errorf("цикл: %v, want ErrRecipeCycle с путем %q", err, want)
+	}
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"errors"
+
+	"zephyrvpn/server/internal/models"
+)
+
+// ErrInvalidIngredientUnit - единица ингредиента не пересчитывается в базовую единицу номенклатуры
+// Без проверки при сохранении рецепта ошибка всплывала бы только при списании на продаже
+var ErrInvalidIngredientUnit = errors.New("недопустимая единица измерения ингредиента")
+
+// ingredientUnitCandidates - стандартные единицы, которые предлагаются технологу в подсказке
+var ingredientUnitCandidates = []string{"g", "kg", "ml", "l", "pcs", "box"}
+
+// resolveIngredientUnit возвращает единицу, в которой ингредиент сохраняется в рецепте
+// Единица принимается как есть, если пересчитывается в базовую; иначе пробуется ее стандартное написание
+// ("шт" -> "pcs", "гр." -> "g"), чтобы не отклонять рецепт из-за синонима
+func resolveIngredientUnit(unit string, nomenclature models.NomenclatureItem) (string, error) {
+	_, err := convertQuantityToBaseUnit(1, unit, nomenclature)
+	if err == nil {
+		return unit, nil
+	}
+	if normalized := normalizeUnit(unit); normalized != unit {
+		if _, normErr := convertQuantityToBaseUnit(1, normalized, nomenclature); normErr == nil {
+			return normalized, nil
+		}
+	}
+	return "", err
+}
+
+// acceptableIngredientUnits перечисляет единицы, в которых можно указать ингредиент номенклатуры
+// (базовая, закупки, производства и стандартные единицы, для которых есть пересчет)
+func acceptableIngredientUnits(nomenclature models.NomenclatureItem) []string {
+	candidates := append([]string{nomenclature.BaseUnit, nomenclature.InboundUnit, nomenclature.ProductionUnit}, ingredientUnitCandidates...)
+	seen := make(map[string]bool, len(candidates))
+	units := make([]string, 0, len(candidates))
+	for _, unit := range candidates {
+		if unit == "" || seen[unit] {
+			continue
+		}
+		seen[unit] = true
+		if _, err := convertQuantityToBaseUnit(1, unit, nomenclature); err == nil {
+			units = append(units, unit)
+		}
+	}
+	return units
+}
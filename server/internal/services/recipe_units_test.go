@@ -0,0 +1,109 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestResolveIngredientUnit(t *testing.T) {
+	cheese := models.NomenclatureItem{Name: "Моцарелла", BaseUnit: "g", InboundUnit: "kg", ConversionFactor: 1000}
+	eggs := models.NomenclatureItem{Name: "Яйца", BaseUnit: "pcs", InboundUnit: "box", ConversionFactor: 30}
+
+	cases := []struct {
+		unit         string
+		nomenclature models.NomenclatureItem
+		want         string
+	}{
+		{"g", cheese, "g"},
+		{"kg", cheese, "kg"},
+		{"гр.", cheese, "g"}, // Синоним приводится к стандартной записи
+		{"box", eggs, "box"},
+		{"шт", eggs, "pcs"},
+	}
+	for _, tc := range cases {
+		got, err := resolveIngredientUnit(tc.unit, tc.nomenclature)
+		if err != nil || got != tc.want {
+			t.Errorf("resolveIngredientUnit(%q, %s) = %q, %v; want %q", tc.unit, tc.nomenclature.Name, got, err, tc.want)
+		}
+	}
+
+	// Объем и штуки без веса единицы в граммы не пересчитываются
+	invalid := []struct {
+		unit         string
+		nomenclature models.NomenclatureItem
+	}{
+		{"ml", cheese},
+		{"шт", cheese},
+		{"g", eggs},
+		{"щепотка", cheese},
+	}
+	for _, tc := range invalid {
+		if got, err := resolveIngredientUnit(tc.unit, tc.nomenclature); err == nil {
+			t.Errorf("resolveIngredientUnit(%q, %s) = %q; want ошибку", tc.unit, tc.nomenclature.Name, got)
+		}
+	}
+
+	if got, want := acceptableIngredientUnits(cheese), []string{"g", "kg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("допустимые единицы сыра %v, want %v", got, want)
+	}
+	if got, want := acceptableIngredientUnits(eggs), []string{"pcs", "box"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("допустимые единицы яиц %v, want %v", got, want)
+	}
+}
+
+// Рецепт с сыром в килограммах сохраняется; тот же сыр в миллилитрах отклоняется при сохранении
+// с ошибкой, называющей ингредиент и допустимые единицы, и рецепт не создается
+func TestCreateRecipeValidatesIngredientUnits(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureCategory{}, &models.NomenclatureItem{}, &models.Recipe{}, &models.RecipeIngredient{})
+	service := NewRecipeService(db)
+	suffix := uuid.New().String()[:8]
+
+	cheese := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: "Моцарелла " + suffix, BaseUnit: "g",
+		InboundUnit: "kg", ConversionFactor: 1000, IsActive: true}
+	if err := db.Create(&cheese).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	t.Cleanup(func() {
+		var recipeIDs []string
+		db.Model(&models.Recipe{}).Where("name LIKE ?", "%"+suffix).Pluck("id", &recipeIDs)
+		db.Where("recipe_id IN ?", recipeIDs).Delete(&models.RecipeIngredient{})
+		db.Unscoped().Where("id IN ?", recipeIDs).Delete(&models.Recipe{})
+		db.Unscoped().Where("id = ?", cheese.ID).Delete(&models.NomenclatureItem{})
+	})
+
+	valid := models.Recipe{Name: "Маргарита " + suffix, PortionSize: 1, Unit: "pcs", IsActive: true,
+		Ingredients: []models.RecipeIngredient{{NomenclatureID: &cheese.ID, Quantity: 0.15, Unit: " KG "}}}
+	if err := service.CreateRecipe(&valid); err != nil {
+		t.Fatalf("CreateRecipe с единицей kg: %v", err)
+	}
+	var saved models.RecipeIngredient
+	if err := db.Where("recipe_id = ?", valid.ID).First(&saved).Error; err != nil {
+		t.Fatalf("ингредиент не сохранен: %v", err)
+	}
+	if saved.Unit != "kg" || saved.Quantity != 0.15 {
+		t.Errorf("ингредиент %v %s, want 0.15 kg", saved.Quantity, saved.Unit)
+	}
+
+	invalid := models.Recipe{Name: "Четыре сыра " + suffix, PortionSize: 1, Unit: "pcs", IsActive: true,
+		Ingredients: []models.RecipeIngredient{{NomenclatureID: &cheese.ID, Quantity: 150, Unit: "ml"}}}
+	err := service.CreateRecipe(&invalid)
+	if !errors.Is(err, ErrInvalidIngredientUnit) {
+		t.Fatalf("CreateRecipe с единицей ml: %v, want ErrInvalidIngredientUnit", err)
+	}
+	for _, part := range []string{"'Моцарелла " + suffix + "'", "'ml'", "допустимые единицы: g, kg"} {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("ошибка %q не содержит %q", err, part)
+		}
+	}
+	var count int64
+	db.Model(&models.Recipe{}).Where("name = ?", invalid.Name).Count(&count)
+	if count != 0 {
+		t.Errorf("рецепт с недопустимой единицей сохранен (%d записей)", count)
+	}
+}
@@ -0,0 +1,7 @@
+package services
+
+import "errors"
+
+// ErrRedisUnavailable - Redis не подключен: операции со слотами, активными заказами и очередями кухни невозможны
+// Контроллеры отвечают на нее 503 с degraded: true (см. api.respondRedisUnavailable)
+var ErrRedisUnavailable = errors.New("Redis недоступен")
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Удаленный товар скрыт из списка, виден с includeDeleted и после восстановления снова живой
+func TestRestoreNomenclatureItem(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{})
+	service := NewNomenclatureService(db)
+
+	item := models.NomenclatureItem{
+		SKU:      "TEST-" + uuid.New().String()[:8],
+		Name:     "Базилик",
+		BaseUnit: "g",
+		IsActive: true,
+	}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+	})
+	if err := db.Delete(&item).Error; err != nil {
+		t.Fatalf("не удалось удалить товар: %v", err)
+	}
+
+	containsItem := func(includeDeleted bool) bool {
+		items, err := service.GetAllItems(includeDeleted)
+		if err != nil {
+			t.Fatalf("GetAllItems(%v): %v", includeDeleted, err)
+		}
+		for _, candidate := range items {
+			if candidate.ID == item.ID {
+				return true
+			}
+		}
+		return false
+	}
+	if containsItem(false) || !containsItem(true) {
+		t.Fatalf("удаленный товар: в списке %v, в списке с удаленными %v; want false, true", containsItem(false), containsItem(true))
+	}
+
+	restored, err := service.RestoreItem(item.ID)
+	if err != nil {
+		t.Fatalf("RestoreItem: %v", err)
+	}
+	if restored.DeletedAt.Valid || !containsItem(false) {
+		t.Error("восстановленный товар не виден в списке")
+	}
+
+	// Повторное восстановление живого товара ничего не меняет
+	if _, err := service.RestoreItem(item.ID); err != nil {
+		t.Errorf("RestoreItem живого товара: %v", err)
+	}
+}
+
+// Рецепт не восстанавливается, пока есть живой рецепт с тем же именем
+func TestRestoreRecipeConflictsWithLiveName(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.Recipe{}, &models.RecipeIngredient{})
+	service := NewRecipeService(db)
+
+	name := "Маргарита " + uuid.New().String()[:8]
+	deleted := models.Recipe{Name: name, IsActive: true}
+	live := models.Recipe{Name: name, IsActive: true}
+	for _, recipe := range []*models.Recipe{&deleted, &live} {
+		if err := db.Create(recipe).Error; err != nil {
+			t.Fatalf("не удалось создать рецепт: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("id IN ?", []string{deleted.ID, live.ID}).Delete(&models.Recipe{})
+	})
+	if err := db.Delete(&deleted).Error; err != nil {
+		t.Fatalf("не удалось удалить рецепт: %v", err)
+	}
+
+	if _, err := service.RestoreRecipe(deleted.ID); !errors.Is(err, ErrRestoreConflict) {
+		t.Fatalf("RestoreRecipe при живом тезке: %v, want ErrRestoreConflict", err)
+	}
+
+	if err := db.Delete(&live).Error; err != nil {
+		t.Fatalf("не удалось удалить рецепт: %v", err)
+	}
+	restored, err := service.RestoreRecipe(deleted.ID)
+	if err != nil {
+		t.Fatalf("RestoreRecipe: %v", err)
+	}
+	if restored.ID != deleted.ID || restored.DeletedAt.Valid {
+		t.Errorf("восстановлен %s (удален: %v), want живой %s", restored.ID, restored.DeletedAt.Valid, deleted.ID)
+	}
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"sort"
+
+	"github.com/shopspring/decimal"
+	"zephyrvpn/server/internal/models"
+)
+
+// Способы оплаты в разбивке выручки
+const (
+	revenueBucketCash     = "cash"
+	revenueBucketCashless = "cashless"
+	revenueBucketOnline   = "online"
+)
+
+var (
+	decimalHundred = decimal.NewFromInt(100)
+	revenueBuckets = []string{revenueBucketCash, revenueBucketCashless, revenueBucketOnline}
+)
+
+// revenuePaymentBucket относит способ оплаты заказа к наличным, безналу или онлайн (неизвестный - безнал)
+func revenuePaymentBucket(paymentMethod string) string {
+	switch paymentMethod {
+	case "CASH", "cash":
+		return revenueBucketCash
+	case "ONLINE", "online", "CRYPTO", "crypto":
+		return revenueBucketOnline
+	default: // CARD, CARD_ONLINE и заказы без способа оплаты
+		return revenueBucketCashless
+	}
+}
+
+// orderRevenueAmount - выручка заказа в рублях без округления
+// FinalPrice уже посчитан при создании заказа; для старых заказов без него скидки считаются точно,
+// без отбрасывания копеек (как в CalculateOrderPrice, но в decimal)
+func orderRevenueAmount(order *models.PizzaOrder) decimal.Decimal {
+	if order.FinalPrice > 0 {
+		return decimal.NewFromInt(int64(order.FinalPrice))
+	}
+
+	subtotal := decimal.Zero
+	for _, item := range order.Items {
+		lineTotal := decimal.NewFromInt(int64(item.LineTotal()))
+		discount := decimal.NewFromInt(int64(item.DiscountAmount))
+		if item.DiscountAmount == 0 && item.DiscountPercent > 0 {
+			discount = lineTotal.Mul(decimal.NewFromInt(int64(item.DiscountPercent))).Div(decimalHundred)
+		}
+		subtotal = subtotal.Add(lineTotal.Sub(decimal.Min(decimal.Max(discount, decimal.Zero), lineTotal)))
+	}
+	if len(order.Items) == 0 {
+		subtotal = decimal.NewFromInt(int64(order.TotalPrice))
+	}
+
+	orderDiscount := decimal.NewFromInt(int64(order.DiscountAmount))
+	if order.DiscountAmount == 0 && order.DiscountPercent > 0 {
+		orderDiscount = subtotal.Mul(decimal.NewFromInt(int64(order.DiscountPercent))).Div(decimalHundred)
+	}
+	return subtotal.Sub(decimal.Min(decimal.Max(orderDiscount, decimal.Zero), subtotal))
+}
+
+// revenueAccumulator суммирует выручку заказов точно (decimal) и округляет до копеек один раз в finish
+type revenueAccumulator struct {
+	byBucket  map[string]decimal.Decimal
+	byChannel map[string]decimal.Decimal
+	orders    map[string]int // Число заказов по каналу
+	discounts decimal.Decimal
+	count     int
+}
+
+func newRevenueAccumulator() *revenueAccumulator {
+	return &revenueAccumulator{
+		byBucket:  make(map[string]decimal.Decimal),
+		byChannel: make(map[string]decimal.Decimal),
+		orders:    make(map[string]int),
+	}
+}
+
+// add учитывает завершенный заказ
+func (a *revenueAccumulator) add(paymentMethod, channel string, amount, discount decimal.Decimal) {
+	if channel == "" {
+		channel = models.OrderChannelUnknown
+	}
+	bucket := revenuePaymentBucket(paymentMethod)
+	a.byBucket[bucket] = a.byBucket[bucket].Add(amount)
+	a.byChannel[channel] = a.byChannel[channel].Add(amount)
+	a.orders[channel]++
+	if discount.IsPositive() {
+		a.discounts = a.discounts.Add(discount)
+	}
+	a.count++
+}
+
+// finish записывает суммы в stats. Total - точная сумма, округленная до копеек; копейки округления
+// распределяются между способами оплаты (и каналами) так, что они в сумме дают ровно Total
+func (a *revenueAccumulator) finish(stats *RevenueStats) {
+	bucketAmounts := make([]decimal.Decimal, len(revenueBuckets))
+	for i, bucket := range revenueBuckets {
+		bucketAmounts[i] = a.byBucket[bucket]
+	}
+	total, bucketKopecks := allocateKopecks(bucketAmounts)
+	stats.Total = kopecksToRubles(total)
+	stats.Cash = kopecksToRubles(bucketKopecks[0])
+	stats.Cashless = kopecksToRubles(bucketKopecks[1])
+	stats.Online = kopecksToRubles(bucketKopecks[2])
+
+	channels := make([]string, 0, len(a.byChannel))
+	for channel := range a.byChannel {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels) // Детерминированное распределение копеек
+	channelAmounts := make([]decimal.Decimal, len(channels))
+	for i, channel := range channels {
+		channelAmounts[i] = a.byChannel[channel]
+	}
+	_, channelKopecks := allocateKopecks(channelAmounts)
+	stats.ByChannel = make(map[string]ChannelRevenue, len(channels))
+	for i, channel := range channels {
+		stats.ByChannel[channel] = ChannelRevenue{Revenue: kopecksToRubles(channelKopecks[i]), Orders: a.orders[channel]}
+	}
+
+	stats.Discounts = a.discounts.Round(2).InexactFloat64()
+	stats.CompletedOrders = a.count
+}
+
+// allocateKopecks округляет сумму неотрицательных amounts до копеек и делит ее на части методом наибольшего остатка:
+// каждая часть - округленная вниз сумма в копейках плюс, при необходимости, одна копейка, а части в сумме дают total
+func allocateKopecks(amounts []decimal.Decimal) (int64, []int64) {
+	sum := decimal.Zero
+	parts := make([]int64, len(amounts))
+	remainders := make([]decimal.Decimal, len(amounts))
+	var floorSum int64
+	for i, amount := range amounts {
+		sum = sum.Add(amount)
+		kopecks := amount.Mul(decimalHundred)
+		parts[i] = kopecks.Floor().IntPart()
+		remainders[i] = kopecks.Sub(kopecks.Floor())
+		floorSum += parts[i]
+	}
+	total := sum.Mul(decimalHundred).Round(0).IntPart()
+
+	order := make([]int, len(amounts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return remainders[order[i]].GreaterThan(remainders[order[j]])
+	})
+	for i := int64(0); i < total-floorSum && int(i) < len(order); i++ {
+		parts[order[i]]++
+	}
+	return total, parts
+}
+
+// kopecksToRubles переводит копейки в рубли для ответа API
+func kopecksToRubles(kopecks int64) float64 {
+	return decimal.New(kopecks, -2).InexactFloat64()
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// rublesToKopecks - сравнение сумм из RevenueStats без ошибок float
+func rublesToKopecks(rubles float64) int64 {
+	return decimal.NewFromFloat(rubles).Mul(decimalHundred).Round(0).IntPart()
+}
+
+func TestOrderRevenueAmountKeepsFractionalKopecks(t *testing.T) {
+	// 999 ₽ со скидкой 15% на позицию (849.15 ₽) и 7% на заказ = 789.7095 ₽
+	order := &models.PizzaOrder{
+		Items:           []models.PizzaItem{{PizzaName: "Маргарита", Price: 999, Quantity: 1, DiscountPercent: 15}},
+		TotalPrice:      999,
+		DiscountPercent: 7,
+	}
+	if got := orderRevenueAmount(order); got.String() != "789.7095" {
+		t.Errorf("orderRevenueAmount = %s, want 789.7095", got)
+	}
+
+	// Посчитанный при создании FinalPrice не пересчитывается
+	order.FinalPrice = 789
+	if got := orderRevenueAmount(order); got.String() != "789" {
+		t.Errorf("orderRevenueAmount с FinalPrice = %s, want 789", got)
+	}
+}
+
+func TestRevenueComponentsSumToTotal(t *testing.T) {
+	orders := []struct {
+		order         models.PizzaOrder
+		paymentMethod string
+		channel       string
+	}{
+		// 789.7095 ₽
+		{models.PizzaOrder{Items: []models.PizzaItem{{Price: 999, Quantity: 1, DiscountPercent: 15}}, DiscountPercent: 7}, "cash", models.OrderChannelWebsite},
+		// 333 * 0.85 = 283.05, * 0.97 = 274.5585 ₽
+		{models.PizzaOrder{Items: []models.PizzaItem{{Price: 333, Quantity: 1, DiscountPercent: 15}}, DiscountPercent: 3}, "card", models.OrderChannelTelegram},
+		// 777 * 0.9 = 699.3, * 0.99 = 692.307 ₽
+		{models.PizzaOrder{Items: []models.PizzaItem{{Price: 777, Quantity: 1, DiscountPercent: 10}}, DiscountPercent: 1}, "online", models.OrderChannelWalkIn},
+		// 555 * 0.95 = 527.25, * 0.99 = 521.9775 ₽
+		{models.PizzaOrder{Items: []models.PizzaItem{{Price: 555, Quantity: 1, DiscountPercent: 5}}, DiscountPercent: 1}, "cash", ""},
+	}
+
+	revenue := newRevenueAccumulator()
+	exact := decimal.Zero
+	for _, o := range orders {
+		amount := orderRevenueAmount(&o.order)
+		exact = exact.Add(amount)
+		revenue.add(o.paymentMethod, o.channel, amount, decimal.Zero)
+	}
+	stats := &RevenueStats{}
+	revenue.finish(stats)
+
+	// 789.7095 + 274.5585 + 692.307 + 521.9775 = 2278.5525 -> 2278.55
+	wantTotal := exact.Mul(decimalHundred).Round(0).IntPart()
+	if total := rublesToKopecks(stats.Total); total != wantTotal || total != 227855 {
+		t.Fatalf("Total = %.2f, want %.2f", stats.Total, float64(wantTotal)/100)
+	}
+
+	components := rublesToKopecks(stats.Cash) + rublesToKopecks(stats.Cashless) + rublesToKopecks(stats.Online)
+	if components != wantTotal {
+		t.Errorf("cash + cashless + online = %d коп., total = %d коп.", components, wantTotal)
+	}
+
+	var channels int64
+	for _, channel := range stats.ByChannel {
+		channels += rublesToKopecks(channel.Revenue)
+	}
+	if channels != wantTotal {
+		t.Errorf("сумма по каналам = %d коп., total = %d коп.", channels, wantTotal)
+	}
+	if stats.CompletedOrders != len(orders) || stats.ByChannel[models.OrderChannelUnknown].Orders != 1 {
+		t.Errorf("заказов %d (unknown: %d), want %d (unknown: 1)",
+			stats.CompletedOrders, stats.ByChannel[models.OrderChannelUnknown].Orders, len(orders))
+	}
+}
+
+func TestAllocateKopecksUsesLargestRemainder(t *testing.T) {
+	// Три по 0.333 ₽: округление каждой дало бы 0.99, а сумма - 1.00 ₽
+	third := decimal.RequireFromString("0.3333")
+	total, parts := allocateKopecks([]decimal.Decimal{third, third, third.Add(decimal.RequireFromString("0.0001"))})
+	if total != 100 {
+		t.Fatalf("total = %d коп., want 100", total)
+	}
+	if parts[0]+parts[1]+parts[2] != total || parts[2] != 34 {
+		t.Errorf("части = %v, want [33 33 34]", parts)
+	}
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils/rediskeys"
+)
+
+// Два заказа с сайта и один из Telegram: выручка дня делится по каналам, заказ без канала - unknown,
+// незавершенный заказ не учитывается
+func TestGetRevenueForDateByChannel(t *testing.T) {
+	redisUtil := newTestRedis(t)
+	rs := NewRevenueService(redisUtil, nil)
+
+	today := BusinessDate(time.Now(), time.UTC)
+	dayStart, _, err := BusinessDayBounds(today, time.UTC)
+	if err != nil {
+		t.Fatalf("BusinessDayBounds: %v", err)
+	}
+	orders := []models.PizzaOrder{
+		{ID: "order-web-1", Channel: models.OrderChannelWebsite, PaymentMethod: "card", FinalPrice: 800, Status: "delivered"},
+		{ID: "order-web-2", Channel: models.OrderChannelWebsite, PaymentMethod: "cash", FinalPrice: 450, Status: "ready"},
+		{ID: "order-tg-1", Channel: models.OrderChannelTelegram, PaymentMethod: "online", FinalPrice: 1200, Status: "archived"},
+		{ID: "order-tg-2", Channel: models.OrderChannelTelegram, PaymentMethod: "online", FinalPrice: 999, Status: "cooking"},
+		{ID: "order-legacy", PaymentMethod: "cash", FinalPrice: 300, Status: "delivered"},
+	}
+	for _, order := range orders {
+		order.CreatedAt = dayStart.Add(time.Second)
+		if err := redisUtil.Set(rediskeys.OrderKey(order.ID), order, time.Hour); err != nil {
+			t.Fatalf("не удалось сохранить заказ: %v", err)
+		}
+		if err := redisUtil.SAdd(rediskeys.OrdersActiveKey, order.ID); err != nil {
+			t.Fatalf("не удалось добавить заказ в активные: %v", err)
+		}
+	}
+
+	stats, err := rs.GetRevenueForDate(today)
+	if err != nil {
+		t.Fatalf("GetRevenueForDate: %v", err)
+	}
+	if stats.Total != 2750 || stats.CompletedOrders != 4 {
+		t.Errorf("итого %v за %d заказов, want 2750 за 4", stats.Total, stats.CompletedOrders)
+	}
+	want := map[string]ChannelRevenue{
+		models.OrderChannelWebsite:  {Revenue: 1250, Orders: 2},
+		models.OrderChannelTelegram: {Revenue: 1200, Orders: 1},
+		models.OrderChannelUnknown:  {Revenue: 300, Orders: 1},
+	}
+	if len(stats.ByChannel) != len(want) {
+		t.Errorf("каналы %v, want %v", stats.ByChannel, want)
+	}
+	for channel, wantRevenue := range want {
+		if got := stats.ByChannel[channel]; got != wantRevenue {
+			t.Errorf("канал %s: %+v, want %+v", channel, got, wantRevenue)
+		}
+	}
+}
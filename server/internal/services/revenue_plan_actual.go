@@ -0,0 +1,120 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm/clause"
+	"zephyrvpn/server/internal/models"
+)
+
+// SetRevenueService подключает расчет фактической выручки для сверки плана с фактом
+func (rps *RevenuePlanService) SetRevenueService(revenueService *RevenueService) {
+	rps.revenueService = revenueService
+}
+
+// ReconcileDay сохраняет в revenue_plan_actuals план на дату (прогноз из revenue_plans) и фактическую выручку
+// Планы выручки ведутся по сети целиком, поэтому строка пишется с пустым branch_id
+// Если плана на дату нет, сравнивать не с чем: возвращается nil без ошибки
+func (rps *RevenuePlanService) ReconcileDay(date time.Time) (*models.RevenuePlanActual, error) {
+	if rps.revenueService == nil {
+		return nil, fmt.Errorf("revenue service not available")
+	}
+	stats, err := rps.revenueService.GetRevenueForDate(date.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка расчета выручки за %s: %w", date.Format("2006-01-02"), err)
+	}
+	return rps.reconcileDay(date, "", stats.Total)
+}
+
+// reconcileDay сверяет фактическую выручку actual с планом на дату и сохраняет результат
+func (rps *RevenuePlanService) reconcileDay(date time.Time, branchID string, actual float64) (*models.RevenuePlanActual, error) {
+	if rps.db == nil {
+		return nil, fmt.Errorf("database connection not available")
+	}
+	plan, err := rps.GetPlanForDate(date)
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil {
+		return nil, nil
+	}
+
+	variance, variancePercent := planVariance(plan.ForecastTotal, actual)
+	row := &models.RevenuePlanActual{
+		PlanDate:        time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC),
+		BranchID:        branchID,
+		Planned:         decimal.NewFromFloat(plan.ForecastTotal).Round(2).InexactFloat64(),
+		Actual:          decimal.NewFromFloat(actual).Round(2).InexactFloat64(),
+		Variance:        variance,
+		VariancePercent: variancePercent,
+	}
+	// Повторная сверка дня перезаписывает строку (UPSERT по дате и филиалу)
+	err = rps.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "plan_date"}, {Name: "branch_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"planned", "actual", "variance", "variance_percent", "updated_at"}),
+	}).Create(row).Error
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сохранения сверки плана выручки: %w", err)
+	}
+	return row, nil
+}
+
+// planVariance - отклонение факта от плана в рублях и в процентах от плана (копейки без ошибок float)
+// При нулевом плане процент не определен - nil
+func planVariance(planned, actual float64) (float64, *float64) {
+	plannedDec := decimal.NewFromFloat(planned).Round(2)
+	variance := decimal.NewFromFloat(actual).Round(2).Sub(plannedDec)
+	if plannedDec.IsZero() {
+		return variance.InexactFloat64(), nil
+	}
+	percent := variance.Mul(decimal.NewFromInt(100)).Div(plannedDec).Round(2).InexactFloat64()
+	return variance.InexactFloat64(), &percent
+}
+
+// GetPlanVsActual возвращает сохраненные сверки плана с фактом за период (включительно), по дате
+// branchID = "" - все строки, иначе только строки филиала
+func (rps *RevenuePlanService) GetPlanVsActual(from, to time.Time, branchID string) ([]models.RevenuePlanActual, error) {
+	if rps.db == nil {
+		return nil, fmt.Errorf("database connection not available")
+	}
+	query := rps.db.Where("plan_date BETWEEN ? AND ?", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if branchID != "" {
+		query = query.Where("branch_id = ?", branchID)
+	}
+	rows := make([]models.RevenuePlanActual, 0)
+	if err := query.Order("plan_date ASC, branch_id ASC").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("ошибка получения сверки плана выручки: %w", err)
+	}
+	return rows, nil
+}
+
+// StartPlanActualReconciler раз в день в момент закрытия (closeHour:closeMin UTC) сверяет план с фактом
+// Вчерашний день пересчитывается еще раз: заказы, закрытые после снимка, попадают в факт
+func (rps *RevenuePlanService) StartPlanActualReconciler(closeHour, closeMin int) {
+	go func() {
+		for {
+			now := time.Now().UTC()
+			next := time.Date(now.Year(), now.Month(), now.Day(), closeHour, closeMin, 0, 0, time.UTC)
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			time.Sleep(time.Until(next))
+
+			for _, day := range []time.Time{next.AddDate(0, 0, -1), next} {
+				row, err := rps.ReconcileDay(day)
+				if err != nil {
+					log.Printf("⚠️ Ошибка сверки плана выручки за %s: %v", day.Format("2006-01-02"), err)
+					continue
+				}
+				if row != nil {
+					log.Printf("📈 План/факт за %s: план %.2f₽, факт %.2f₽, отклонение %.2f₽",
+						day.Format("2006-01-02"), row.Planned, row.Actual, row.Variance)
+				}
+			}
+		}
+	}()
+	log.Printf("📈 Ежедневная сверка плана выручки с фактом запланирована на %02d:%02d UTC", closeHour, closeMin)
+}
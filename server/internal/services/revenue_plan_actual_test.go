@@ -0,0 +1,101 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+)
+
+func TestPlanVariance(t *testing.T) {
+	percent := func(v float64) *float64 { return &v }
+	cases := []struct {
+		name            string
+		planned, actual float64
+		variance        float64
+		percent         *float64
+	}{
+		// 0.1 + 0.2 в float дает 0.30000000000000004 - отклонение считается в копейках
+		{"копейки без ошибок float", 1000.10, 1000.40, 0.3, percent(0.03)},
+		{"недобор", 50000, 42500.5, -7499.5, percent(-15)},
+		{"перевыполнение, процент округляется", 3000, 4000, 1000, percent(33.33)},
+		{"суммы округляются до копеек до вычитания", 1234.567, 1234.561, -0.01, percent(0)},
+		{"нулевой план", 0, 1500, 1500, nil},
+		{"нулевой план без выручки", 0, 0, 0, nil},
+	}
+	for _, tc := range cases {
+		variance, percent := planVariance(tc.planned, tc.actual)
+		if variance != tc.variance {
+			t.Errorf("%s: отклонение %v, want %v", tc.name, variance, tc.variance)
+		}
+		if (percent == nil) != (tc.percent == nil) || (percent != nil && *percent != *tc.percent) {
+			t.Errorf("%s: отклонение в процентах %s, want %s", tc.name, formatPercent(percent), formatPercent(tc.percent))
+		}
+	}
+}
+
+// formatPercent - процент отклонения для сообщений теста (nil - не определен)
+func formatPercent(percent *float64) string {
+	if percent == nil {
+		return "nil"
+	}
+	return fmt.Sprint(*percent)
+}
+
+func TestReconcileDayStoresVarianceAndSeries(t *testing.T) {
+	db := newTestDB(t, &models.RevenuePlan{}, &models.RevenuePlanActual{})
+	// Даты далеко в будущем, чтобы не задеть реальные планы
+	first := time.Date(2031, 3, 10, 0, 0, 0, 0, time.UTC)
+	second := first.AddDate(0, 0, 1)
+	clearRows := func() {
+		db.Exec("DELETE FROM revenue_plan_actuals WHERE plan_date BETWEEN ? AND ?", "2031-03-01", "2031-03-31")
+		db.Exec("DELETE FROM revenue_plans WHERE plan_date BETWEEN ? AND ?", "2031-03-01", "2031-03-31")
+	}
+	clearRows()
+	t.Cleanup(clearRows)
+
+	rps := NewRevenuePlanService(db)
+	for date, total := range map[time.Time]float64{first: 50000.10, second: 40000} {
+		if err := rps.SavePlan(&RevenueForecast{ForecastTotal: total, Method: "test"}, date); err != nil {
+			t.Fatalf("SavePlan %s: %v", date.Format("2006-01-02"), err)
+		}
+	}
+
+	row, err := rps.reconcileDay(first, "", 45500.35)
+	if err != nil {
+		t.Fatalf("reconcileDay: %v", err)
+	}
+	if row.Planned != 50000.10 || row.Actual != 45500.35 || row.Variance != -4499.75 {
+		t.Errorf("сверка: план %v, факт %v, отклонение %v; want 50000.1, 45500.35, -4499.75", row.Planned, row.Actual, row.Variance)
+	}
+	// Повторная сверка дня перезаписывает строку, а не добавляет вторую
+	if _, err := rps.reconcileDay(first, "", 52000); err != nil {
+		t.Fatalf("повторная reconcileDay: %v", err)
+	}
+	if _, err := rps.reconcileDay(second, "", 40000); err != nil {
+		t.Fatalf("reconcileDay второго дня: %v", err)
+	}
+	// Без плана сверять не с чем
+	if row, err := rps.reconcileDay(second.AddDate(0, 0, 1), "", 1000); err != nil || row != nil {
+		t.Errorf("день без плана = (%v, %v), want (nil, nil)", row, err)
+	}
+
+	series, err := rps.GetPlanVsActual(first.AddDate(0, 0, -1), second.AddDate(0, 0, 5), "")
+	if err != nil {
+		t.Fatalf("GetPlanVsActual: %v", err)
+	}
+	if len(series) != 2 {
+		t.Fatalf("точек %d, want 2", len(series))
+	}
+	if !series[0].PlanDate.Equal(first) || series[0].Actual != 52000 || series[0].Variance != 1999.9 {
+		t.Errorf("первая точка: %s факт %v отклонение %v; want 2031-03-10, 52000, 1999.9",
+			series[0].PlanDate.Format("2006-01-02"), series[0].Actual, series[0].Variance)
+	}
+	if series[0].VariancePercent == nil || *series[0].VariancePercent != 4 {
+		t.Errorf("первая точка: отклонение в процентах %v, want 4", series[0].VariancePercent)
+	}
+	if !series[1].PlanDate.Equal(second) || series[1].Variance != 0 {
+		t.Errorf("вторая точка: %s отклонение %v; want 2031-03-11, 0", series[1].PlanDate.Format("2006-01-02"), series[1].Variance)
+	}
+}
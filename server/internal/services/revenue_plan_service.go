@@ -12,7 +12,8 @@ import (
 
 // RevenuePlanService управляет планами выручки в PostgreSQL
 type RevenuePlanService struct {
-	db *gorm.DB
+	db             *gorm.DB
+	revenueService *RevenueService // Фактическая выручка для сверки с планом (см. ReconcileDay)
 }
 
 // NewRevenuePlanService создает новый сервис планов выручки
@@ -6,11 +6,14 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"sort"
 	"time"
 
+	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 	"zephyrvpn/server/internal/models"
 	"zephyrvpn/server/internal/utils"
+	"zephyrvpn/server/internal/utils/rediskeys"
 )
 
 // RevenueService управляет расчетом выручки из заказов
@@ -58,6 +61,13 @@ type RevenueStats struct {
 	Discounts       float64 `json:"discounts"`        // Сумма скидок
 	CompletedOrders int     `json:"completed_orders"` // Количество завершенных заказов
 	Change          float64 `json:"change"`          // Изменение в процентах (по сравнению с предыдущим днем)
+	ByChannel       map[string]ChannelRevenue `json:"by_channel"` // Разбивка по каналам заказа (website, telegram, walk_in, unknown)
+}
+
+// ChannelRevenue - выручка и число завершенных заказов одного канала
+type ChannelRevenue struct {
+	Revenue float64 `json:"revenue"`
+	Orders  int     `json:"orders"`
 }
 
 // RevenueForecast содержит прогноз выручки
@@ -70,6 +80,56 @@ type RevenueForecast struct {
 	HistoricalAvg    float64 `json:"historical_avg"`    // Средняя выручка за аналогичные дни недели
 	Confidence       float64 `json:"confidence"`        // Уверенность в прогнозе (0-100%)
 	Method           string  `json:"method"`             // Метод прогнозирования
+	BreakerState     string  `json:"breaker_state,omitempty"` // Состояние circuit breaker Nixtla (closed, open, half_open)
+	Notice           string  `json:"notice,omitempty"`   // Сообщение для UI (например, "AI недоступен, используется оценка")
+}
+
+// linearExtrapolationForecast - запасной прогноз, когда Nixtla недоступна
+// Строит линейный тренд (метод наименьших квадратов) по дневной выручке и продлевает его на horizon дней
+func linearExtrapolationForecast(historicalData []TimeSeriesData, horizon int) *RevenueForecast {
+	sorted := make([]TimeSeriesData, len(historicalData))
+	copy(sorted, historicalData)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].DS < sorted[j].DS
+	})
+
+	n := float64(len(sorted))
+	var sumX, sumY, sumXY, sumXX float64
+	for i, point := range sorted {
+		x := float64(i)
+		sumX += x
+		sumY += point.Y
+		sumXY += x * point.Y
+		sumXX += x * x
+	}
+
+	avg := 0.0
+	slope := 0.0
+	if n > 0 {
+		avg = sumY / n
+		if denominator := n*sumXX - sumX*sumX; denominator != 0 {
+			slope = (n*sumXY - sumX*sumY) / denominator
+		}
+	}
+	intercept := avg - slope*(sumX/math.Max(n, 1))
+
+	total := 0.0
+	for day := 0; day < horizon; day++ {
+		value := intercept + slope*(n+float64(day))
+		if value < 0 {
+			value = 0 // Выручка не бывает отрицательной
+		}
+		total += value
+	}
+
+	return &RevenueForecast{
+		ForecastTotal:  total,
+		RemainingHours: float64(horizon * 24),
+		AverageHourly:  total / float64(horizon*24),
+		HistoricalAvg:  avg,
+		Confidence:     CalculateConfidenceScore(horizon) * 0.8, // Оценка по тренду менее надежна, чем AI
+		Method:         "linear_extrapolation",
+	}
 }
 
 // CalculateConfidenceScore рассчитывает оценку уверенности прогноза на основе временного горизонта
@@ -98,16 +158,25 @@ func CalculateConfidenceScore(days int) float64 {
 	return math.Round(confidence*10) / 10
 }
 
-// GetRevenueForDate получает выручку за указанную дату
+// GetRevenueForDate получает выручку за указанную дату (границы дня в UTC)
 // date - дата в формате "2006-01-02", если пустая - сегодня
 func (rs *RevenueService) GetRevenueForDate(date string) (*RevenueStats, error) {
+	return rs.GetRevenueForBranchDate("", date)
+}
+
+// GetRevenueForBranchDate получает выручку за бизнес-день в часовом поясе филиала
+// Для филиала UTC+5 день длится с 00:00 до 24:00 местного времени (19:00-19:00 UTC)
+// branchID - филиал, чей timezone задает границы дня (пустой - UTC)
+func (rs *RevenueService) GetRevenueForBranchDate(branchID, date string) (*RevenueStats, error) {
 	if rs.redisUtil == nil {
-		return nil, fmt.Errorf("Redis not available")
+		return nil, ErrRedisUnavailable
 	}
 
-	// Если дата не указана, используем сегодня
+	loc := BranchLocation(rs.db, branchID)
+
+	// Если дата не указана, используем сегодня (в часовом поясе филиала)
 	if date == "" {
-		date = time.Now().Format("2006-01-02")
+		date = BusinessDate(time.Now(), loc)
 	}
 
 	stats := &RevenueStats{
@@ -118,13 +187,16 @@ func (rs *RevenueService) GetRevenueForDate(date string) (*RevenueStats, error)
 		Discounts:        0,
 		CompletedOrders: 0,
 		Change:          0,
+		ByChannel:       make(map[string]ChannelRevenue),
 	}
 
-	// Парсим дату для фильтрации
-	targetDate, err := time.Parse("2006-01-02", date)
+	// Парсим дату для фильтрации: границы бизнес-дня филиала в UTC
+	targetDateStart, targetDateEnd, err := BusinessDayBounds(date, loc)
 	if err != nil {
 		return nil, fmt.Errorf("invalid date format: %s", date)
 	}
+	targetDate := targetDateStart
+	prevDateStr := targetDateStart.In(loc).AddDate(0, 0, -1).Format("2006-01-02")
 	
 	// ВАЛИДАЦИЯ: Проверяем, что дата находится в допустимом диапазоне (последние 12 месяцев)
 	now := time.Now()
@@ -143,9 +215,6 @@ func (rs *RevenueService) GetRevenueForDate(date string) (*RevenueStats, error)
 		return stats, nil // Возвращаем пустую статистику вместо ошибки
 	}
 	
-	targetDateStart := time.Date(targetDate.Year(), targetDate.Month(), targetDate.Day(), 0, 0, 0, 0, time.UTC)
-	targetDateEnd := targetDateStart.Add(24 * time.Hour)
-
 	// ОПТИМИЗАЦИЯ: Сначала проверяем PostgreSQL (быстрее для исторических данных)
 	// Только если данных нет в PostgreSQL, проверяем Redis
 	if rs.db != nil {
@@ -154,16 +223,14 @@ func (rs *RevenueService) GetRevenueForDate(date string) (*RevenueStats, error)
 			pgStats := rs.getRevenueFromPostgreSQL(targetDateStart, targetDateEnd)
 			if pgStats.CompletedOrders > 0 {
 				log.Printf("📊 GetRevenueForDate: найдено %d заказов в PostgreSQL для даты %s", pgStats.CompletedOrders, date)
-				stats = pgStats
-				// Общая выручка уже рассчитана в getRevenueFromPostgreSQL
-				stats.Total = stats.Cash + stats.Cashless + stats.Online
+				stats = pgStats // Total = Cash + Cashless + Online (см. revenueAccumulator)
 				
 				// Рассчитываем изменение в процентах (по сравнению с предыдущим днем)
 				prevDate := targetDateStart.AddDate(0, 0, -1)
 				minValidDate := now.AddDate(0, -12, 0) // 12 месяцев назад
 				
 				if prevDate.After(minValidDate) || prevDate.Equal(minValidDate) {
-					prevStats, _ := rs.GetRevenueForDate(prevDate.Format("2006-01-02"))
+					prevStats, _ := rs.GetRevenueForBranchDate(branchID, prevDateStr)
 					if prevStats != nil && prevStats.Total > 0 {
 						stats.Change = ((stats.Total - prevStats.Total) / prevStats.Total) * 100
 					}
@@ -184,7 +251,7 @@ func (rs *RevenueService) GetRevenueForDate(date string) (*RevenueStats, error)
 
 	// Только для сегодня/вчера проверяем Redis
 	maxArchiveOrders := 1000
-	archiveKey := "erp:orders:archive"
+	archiveKey := rediskeys.OrdersArchiveKey
 	archiveLength, _ := rs.redisUtil.LLen(archiveKey)
 	startIndex := int64(0)
 	if archiveLength > int64(maxArchiveOrders) {
@@ -197,7 +264,7 @@ func (rs *RevenueService) GetRevenueForDate(date string) (*RevenueStats, error)
 		return stats, nil
 	}
 
-	activeOrderIDs, _ := rs.redisUtil.SMembers("erp:orders:active")
+	activeOrderIDs, _ := rs.redisUtil.SMembers(rediskeys.OrdersActiveKey)
 	allOrderIDs := append(orderIDs, activeOrderIDs...)
 
 	uniqueOrderIDs := make(map[string]bool)
@@ -211,6 +278,7 @@ func (rs *RevenueService) GetRevenueForDate(date string) (*RevenueStats, error)
 
 	processedCount := 0
 	maxProcessOrders := 2000
+	revenue := newRevenueAccumulator()
 	for orderID := range uniqueOrderIDs {
 		if processedCount >= maxProcessOrders {
 			break
@@ -231,49 +299,28 @@ func (rs *RevenueService) GetRevenueForDate(date string) (*RevenueStats, error)
 			continue
 		}
 
-		orderPrice := float64(order.FinalPrice)
-		if orderPrice == 0 {
-			orderPrice = float64(order.TotalPrice)
-		}
-
-		paymentMethod := order.PaymentMethod
-		switch paymentMethod {
-		case "CASH", "cash":
-			stats.Cash += orderPrice
-		case "CARD", "CARD_ONLINE", "card", "card_online":
-			stats.Cashless += orderPrice
-		case "ONLINE", "online", "CRYPTO", "crypto":
-			stats.Online += orderPrice
-		default:
-			stats.Cashless += orderPrice
-		}
-
-		if order.DiscountAmount > 0 {
-			stats.Discounts += float64(order.DiscountAmount)
-		}
-
-		stats.CompletedOrders++
+		// Скидки на заказ и на позиции
+		discounts := decimal.NewFromInt(int64(order.DiscountAmount + order.ItemDiscountTotal()))
+		revenue.add(order.PaymentMethod, order.Channel, orderRevenueAmount(order), discounts)
 	}
+	revenue.finish(stats)
 
 	log.Printf("📊 GetRevenueForDate: обработано %d заказов из Redis, найдено %d завершенных заказов за %s", 
 		processedCount, stats.CompletedOrders, date)
 
-	// Общая выручка
-	stats.Total = stats.Cash + stats.Cashless + stats.Online
-
 	// Рассчитываем изменение в процентах (по сравнению с предыдущим днем)
 	// ВАЛИДАЦИЯ: Проверяем, что предыдущий день не слишком старый (в пределах 12 месяцев)
 	prevDate := targetDateStart.AddDate(0, 0, -1)
 	minValidDate := now.AddDate(0, -12, 0) // 12 месяцев назад
 	
 	if prevDate.After(minValidDate) || prevDate.Equal(minValidDate) {
-		prevStats, _ := rs.GetRevenueForDate(prevDate.Format("2006-01-02"))
+		prevStats, _ := rs.GetRevenueForBranchDate(branchID, prevDateStr)
 		if prevStats != nil && prevStats.Total > 0 {
 			stats.Change = ((stats.Total - prevStats.Total) / prevStats.Total) * 100
 		}
 	} else {
 		log.Printf("⚠️ GetRevenueForDate: предыдущий день %s слишком старый (раньше %s), пропускаем расчет изменения", 
-			prevDate.Format("2006-01-02"), minValidDate.Format("2006-01-02"))
+			prevDateStr, minValidDate.Format("2006-01-02"))
 	}
 
 	return stats, nil
@@ -284,10 +331,15 @@ func (rs *RevenueService) GetRevenueForToday() (*RevenueStats, error) {
 	return rs.GetRevenueForDate("")
 }
 
+// GetRevenueForBranchToday получает выручку за текущий бизнес-день филиала
+func (rs *RevenueService) GetRevenueForBranchToday(branchID string) (*RevenueStats, error) {
+	return rs.GetRevenueForBranchDate(branchID, "")
+}
+
 // getOrderFromRedis получает заказ из Redis
 func (rs *RevenueService) getOrderFromRedis(orderID string) (*models.PizzaOrder, error) {
 	// Пробуем получить из erp:order:{id}
-	orderKey := fmt.Sprintf("erp:order:%s", orderID)
+	orderKey := rediskeys.OrderKey(orderID)
 	orderJSON, err := rs.redisUtil.GetBytes(orderKey)
 	if err == nil && len(orderJSON) > 0 {
 		var order models.PizzaOrder
@@ -297,7 +349,7 @@ func (rs *RevenueService) getOrderFromRedis(orderID string) (*models.PizzaOrder,
 	}
 
 	// Пробуем получить из order:{id}
-	orderKey2 := fmt.Sprintf("order:%s", orderID)
+	orderKey2 := rediskeys.LegacyOrderKey(orderID)
 	orderJSON2, err := rs.redisUtil.GetBytes(orderKey2)
 	if err == nil && len(orderJSON2) > 0 {
 		var order models.PizzaOrder
@@ -389,6 +441,7 @@ func (rs *RevenueService) getRevenueFromPostgreSQL(startDate, endDate time.Time)
 		Discounts:       0,
 		CompletedOrders: 0,
 		Change:          0,
+		ByChannel:       make(map[string]ChannelRevenue),
 	}
 
 	// Быстрая проверка наличия данных перед полным запросом
@@ -402,7 +455,8 @@ func (rs *RevenueService) getRevenueFromPostgreSQL(startDate, endDate time.Time)
 			payment_method,
 			COALESCE(final_price, total_price - COALESCE(discount_amount, 0)) as final_price,
 			COALESCE(discount_amount, 0) as discount_amount,
-			status
+			status,
+			COALESCE(channel, '') as channel
 		FROM orders
 		WHERE created_at >= $1 
 		  AND created_at < $2
@@ -420,44 +474,23 @@ func (rs *RevenueService) getRevenueFromPostgreSQL(startDate, endDate time.Time)
 		}
 	}()
 
+	revenue := newRevenueAccumulator()
 	for rows.Next() {
 		var paymentMethod sql.NullString
 		var finalPrice int
 		var discountAmount int
 		var status string
+		var channel string
 
-		err := rows.Scan(&paymentMethod, &finalPrice, &discountAmount, &status)
+		err := rows.Scan(&paymentMethod, &finalPrice, &discountAmount, &status, &channel)
 		if err != nil {
 			log.Printf("⚠️ getRevenueFromPostgreSQL: ошибка сканирования: %v", err)
 			continue
 		}
 
-		orderPrice := float64(finalPrice)
-
-		// Разбиваем по типам оплаты
-		pm := paymentMethod.String
-		switch pm {
-		case "CASH", "cash":
-			stats.Cash += orderPrice
-		case "CARD", "CARD_ONLINE", "card", "card_online":
-			stats.Cashless += orderPrice
-		case "ONLINE", "online", "CRYPTO", "crypto":
-			stats.Online += orderPrice
-		default:
-			// По умолчанию считаем как безнал
-			stats.Cashless += orderPrice
-		}
-
-		// Учитываем скидки
-		if discountAmount > 0 {
-			stats.Discounts += float64(discountAmount)
-		}
-
-		stats.CompletedOrders++
+		revenue.add(paymentMethod.String, channel, decimal.NewFromInt(int64(finalPrice)), decimal.NewFromInt(int64(discountAmount)))
 	}
-
-	// Общая выручка
-	stats.Total = stats.Cash + stats.Cashless + stats.Online
+	revenue.finish(stats)
 
 	return stats
 }
@@ -604,7 +637,7 @@ func (rs *RevenueService) GetRevenueForecast() (*RevenueForecast, error) {
 // startDate и endDate в формате "2006-01-02", если пустые - используется сегодня
 func (rs *RevenueService) GetRevenueForecastForPeriod(startDate, endDate string) (*RevenueForecast, error) {
 	if rs.redisUtil == nil {
-		return nil, fmt.Errorf("Redis not available")
+		return nil, ErrRedisUnavailable
 	}
 
 	log.Printf("📊 GetRevenueForecastForPeriod: запуск прогнозирования (startDate=%s, endDate=%s, useNixtla=%v)", 
@@ -771,6 +804,7 @@ func (rs *RevenueService) GetRevenueForecastForPeriod(startDate, endDate string)
 					HistoricalAvg:  historicalData[len(historicalData)-1].Y, // Последнее историческое значение
 					Confidence:     confidence,
 					Method:         "nixtla_ai",
+					BreakerState:   rs.nixtlaClient.BreakerState(),
 				}
 				
 				log.Printf("🤖 Nixtla: прогноз успешно получен: %.2f₽ (уверенность: %.1f%%)", 
@@ -778,8 +812,14 @@ func (rs *RevenueService) GetRevenueForecastForPeriod(startDate, endDate string)
 				
 				return forecast, nil
 			} else {
-				log.Printf("❌ Nixtla: ошибка прогнозирования (%v), линейная экстраполяция ОТКЛЮЧЕНА", err)
-				return nil, fmt.Errorf("Nixtla AI прогнозирование недоступно: %v (линейная экстраполяция временно отключена)", err)
+				// Nixtla не ответила после повторов или автомат защиты открыт - отдаем оценку по тренду истории
+				log.Printf("⚠️ Nixtla: ошибка прогнозирования (%v), используем линейную экстраполяцию", err)
+				forecast := linearExtrapolationForecast(historicalData, horizon)
+				forecast.CurrentRevenue = currentStats.Total
+				forecast.CurrentHourly = currentStats.Total / float64(currentHour+1)
+				forecast.BreakerState = rs.nixtlaClient.BreakerState()
+				forecast.Notice = "AI недоступен, используется оценка"
+				return forecast, nil
 			}
 		} else {
 			log.Printf("❌ Nixtla: недостаточно исторических данных (%d дней, нужно минимум 14), линейная экстраполяция ОТКЛЮЧЕНА", 
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Пятого ингредиента нет на складе: продажа должна откатиться целиком,
+// первые четыре ингредиента не списываются
+func TestProcessSaleDepletionRollsBackOnShortage(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.StockBatch{}, &models.StockMovement{},
+		&models.Recipe{}, &models.RecipeIngredient{})
+	service := NewStockService(db)
+
+	branchID := uuid.New().String()
+	saleID := uuid.New().String()
+	recipe := models.Recipe{Name: "Тест продажи " + uuid.New().String()[:8], PortionSize: 1}
+
+	var itemIDs, batchIDs []string
+	for i := 1; i <= 5; i++ {
+		item := models.NomenclatureItem{
+			SKU:      "TEST-" + uuid.New().String()[:8],
+			Name:     fmt.Sprintf("Ингредиент %d", i),
+			BaseUnit: "g",
+			IsActive: true,
+		}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("не удалось создать товар: %v", err)
+		}
+		itemIDs = append(itemIDs, item.ID)
+		recipe.Ingredients = append(recipe.Ingredients, models.RecipeIngredient{
+			NomenclatureID: &item.ID,
+			Quantity:       100,
+			Unit:           "g",
+		})
+
+		// Остаток есть только у первых четырех
+		if i == 5 {
+			continue
+		}
+		batch := models.StockBatch{
+			NomenclatureID:    item.ID,
+			BranchID:          branchID,
+			Quantity:          1000,
+			RemainingQuantity: 1000,
+			Unit:              "g",
+			Source:            "adjustment",
+		}
+		if err := db.Create(&batch).Error; err != nil {
+			t.Fatalf("не удалось создать партию: %v", err)
+		}
+		batchIDs = append(batchIDs, batch.ID)
+	}
+	if err := db.Create(&recipe).Error; err != nil {
+		t.Fatalf("не удалось создать рецепт: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("id IN ?", batchIDs).Delete(&models.StockBatch{})
+		db.Where("recipe_id = ?", recipe.ID).Delete(&models.RecipeIngredient{})
+		db.Unscoped().Where("id = ?", recipe.ID).Delete(&models.Recipe{})
+		db.Unscoped().Where("id IN ?", itemIDs).Delete(&models.NomenclatureItem{})
+	})
+
+	err := service.ProcessSaleDepletion(recipe.ID, 2, branchID, "test", saleID)
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("ProcessSaleDepletion: err = %v, want ErrInsufficientStock", err)
+	}
+
+	var batches []models.StockBatch
+	if err := db.Where("id IN ?", batchIDs).Find(&batches).Error; err != nil {
+		t.Fatalf("ошибка загрузки партий: %v", err)
+	}
+	for _, batch := range batches {
+		if batch.RemainingQuantity != 1000 {
+			t.Errorf("партия %s: остаток %.2f, want 1000 (списание должно откатиться)", batch.ID, batch.RemainingQuantity)
+		}
+	}
+
+	var movements int64
+	if err := db.Model(&models.StockMovement{}).Where("source_reference_id = ?", saleID).Count(&movements).Error; err != nil {
+		t.Fatalf("ошибка подсчета движений: %v", err)
+	}
+	if movements != 0 {
+		t.Errorf("записано %d движений по продаже, want 0", movements)
+	}
+}
+
+func TestPlanBatchDeductions(t *testing.T) {
+	batches := []models.StockBatch{
+		{ID: "expires-first", RemainingQuantity: 120},
+		{ID: "empty", RemainingQuantity: 0},
+		{ID: "expires-later", RemainingQuantity: 500},
+	}
+	cases := []struct {
+		name     string
+		required float64
+		want     map[string]float64
+		shortage float64
+	}{
+		{"хватает первой партии", 100, map[string]float64{"expires-first": 100}, 0},
+		{"остаток берется со следующей партии", 300, map[string]float64{"expires-first": 120, "expires-later": 180}, 0},
+		{"ровно весь остаток", 620, map[string]float64{"expires-first": 120, "expires-later": 500}, 0},
+		{"нехватка", 700, map[string]float64{"expires-first": 120, "expires-later": 500}, 80},
+		{"ничего не требуется", 0, map[string]float64{}, 0},
+	}
+	for _, tc := range cases {
+		deductions, shortage := planBatchDeductions(batches, tc.required)
+		got := make(map[string]float64, len(deductions))
+		for _, deduction := range deductions {
+			got[deduction.Batch.ID] = deduction.Quantity
+		}
+		if !reflect.DeepEqual(got, tc.want) || shortage != tc.shortage {
+			t.Errorf("%s: списания %v, нехватка %v; want %v, %v", tc.name, got, shortage, tc.want, tc.shortage)
+		}
+	}
+
+	if deductions, shortage := planBatchDeductions(nil, 50); len(deductions) != 0 || shortage != 50 {
+		t.Errorf("без партий: %v, нехватка %v; want пусто и 50", deductions, shortage)
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"zephyrvpn/server/internal/models"
+)
+
+// ErrSetNotFound - активного набора с таким названием нет
+var ErrSetNotFound = errors.New("набор не найден")
+
+// ErrSetRecipeMissing - у пиццы из набора нет технологической карты, списать набор нельзя
+var ErrSetRecipeMissing = errors.New("у пиццы набора нет рецепта")
+
+// SetRecipeComponent - пицца набора и ее рецепт
+type SetRecipeComponent struct {
+	PizzaName string  `json:"pizza_name"`
+	RecipeID  string  `json:"recipe_id"`
+	Quantity  float64 `json:"quantity"` // Сколько таких пицц в одном наборе
+}
+
+// ResolveSetRecipes раскладывает набор на рецепты входящих в него пицц
+// Пиццы сопоставляются с рецептами по названию, как в меню (активные рецепты, не полуфабрикаты).
+// Одинаковые пиццы в наборе объединяются в один компонент с Quantity > 1
+func (s *StockService) ResolveSetRecipes(setName string) ([]SetRecipeComponent, error) {
+	var set models.PizzaSetDB
+	result := s.db.Where("name = ? AND is_active = ?", setName, true).Limit(1).Find(&set)
+	if result.Error != nil {
+		return nil, fmt.Errorf("ошибка загрузки набора: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: '%s'", ErrSetNotFound, setName)
+	}
+	var pizzas []string
+	if err := json.Unmarshal([]byte(set.Pizzas), &pizzas); err != nil {
+		return nil, fmt.Errorf("ошибка разбора пицц набора '%s': %w", setName, err)
+	}
+	if len(pizzas) == 0 {
+		return nil, fmt.Errorf("в наборе '%s' нет пицц", setName)
+	}
+
+	components := make([]SetRecipeComponent, 0, len(pizzas))
+	indexByName := make(map[string]int)
+	for _, pizza := range pizzas {
+		key := strings.ToLower(strings.TrimSpace(pizza))
+		if i, ok := indexByName[key]; ok {
+			components[i].Quantity++
+			continue
+		}
+
+		var recipe models.Recipe
+		result := s.db.Select("id").
+			Where("LOWER(name) = ? AND is_active = ? AND is_semi_finished = ?", key, true, false).
+			Order("created_at").Limit(1).Find(&recipe)
+		if result.Error != nil {
+			return nil, fmt.Errorf("ошибка поиска рецепта пиццы '%s': %w", pizza, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil, fmt.Errorf("%w: '%s' (набор '%s')", ErrSetRecipeMissing, pizza, setName)
+		}
+		indexByName[key] = len(components)
+		components = append(components, SetRecipeComponent{PizzaName: pizza, RecipeID: recipe.ID, Quantity: 1})
+	}
+	return components, nil
+}
+
+// ProcessSetDepletion списывает ингредиенты quantity проданных наборов: каждая пицца набора списывается по своему рецепту
+// Все компоненты списываются одной транзакцией: при любой ошибке (в том числе ErrInsufficientStock) не меняется ничего.
+// Если у какой-либо пиццы нет рецепта, возвращается ErrSetRecipeMissing до начала списания
+func (s *StockService) ProcessSetDepletion(setName string, quantity float64, branchID string, performedBy string, saleID string) error {
+	components, err := s.ResolveSetRecipes(setName)
+	if err != nil {
+		return err
+	}
+
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, component := range components {
+		if err := s.depleteRecipe(tx, component.RecipeID, component.Quantity*quantity, branchID, performedBy, saleID); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("пицца '%s' набора '%s': %w", component.PizzaName, setName, err)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("ошибка коммита транзакции: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Набор из двух пицц с разными ингредиентами: продажа двух наборов списывает сырье обоих рецептов
+func TestProcessSetDepletionDebitsComponentRecipes(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.StockBatch{}, &models.StockMovement{},
+		&models.Recipe{}, &models.RecipeIngredient{}, &models.PizzaSetDB{})
+	service := NewStockService(db)
+
+	branchID := uuid.New().String()
+	suffix := uuid.New().String()[:8]
+
+	var itemIDs, batchIDs, recipeIDs []string
+	newPizza := func(name, ingredient string, grams float64) string {
+		item := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: ingredient, BaseUnit: "g", IsActive: true}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("не удалось создать товар: %v", err)
+		}
+		itemIDs = append(itemIDs, item.ID)
+		batch := models.StockBatch{NomenclatureID: item.ID, BranchID: branchID, Quantity: 1000, RemainingQuantity: 1000, Unit: "g", Source: "adjustment"}
+		if err := db.Create(&batch).Error; err != nil {
+			t.Fatalf("не удалось создать партию: %v", err)
+		}
+		batchIDs = append(batchIDs, batch.ID)
+		recipe := models.Recipe{
+			Name:        name,
+			PortionSize: 1,
+			IsActive:    true,
+			Ingredients: []models.RecipeIngredient{{NomenclatureID: &item.ID, Quantity: grams, Unit: "g"}},
+		}
+		if err := db.Create(&recipe).Error; err != nil {
+			t.Fatalf("не удалось создать рецепт: %v", err)
+		}
+		recipeIDs = append(recipeIDs, recipe.ID)
+		return batch.ID
+	}
+	margherita := newPizza("Маргарита "+suffix, "Моцарелла", 150)
+	pepperoni := newPizza("Пепперони "+suffix, "Пепперони", 80)
+
+	pizzas, _ := json.Marshal([]string{"Маргарита " + suffix, "пепперони " + suffix})
+	set := models.PizzaSetDB{Name: "Тестовый набор " + suffix, Pizzas: string(pizzas), Price: 1000, IsActive: true}
+	if err := db.Create(&set).Error; err != nil {
+		t.Fatalf("не удалось создать набор: %v", err)
+	}
+
+	saleID := uuid.New().String()
+	t.Cleanup(func() {
+		db.Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("id IN ?", batchIDs).Delete(&models.StockBatch{})
+		db.Where("recipe_id IN ?", recipeIDs).Delete(&models.RecipeIngredient{})
+		db.Unscoped().Where("id IN ?", recipeIDs).Delete(&models.Recipe{})
+		db.Unscoped().Where("id IN ?", itemIDs).Delete(&models.NomenclatureItem{})
+		db.Where("id = ?", set.ID).Delete(&models.PizzaSetDB{})
+	})
+
+	if err := service.ProcessSetDepletion(set.Name, 2, branchID, "test", saleID); err != nil {
+		t.Fatalf("ProcessSetDepletion: %v", err)
+	}
+
+	remaining := func(batchID string) float64 {
+		var batch models.StockBatch
+		if err := db.First(&batch, "id = ?", batchID).Error; err != nil {
+			t.Fatalf("партия не найдена: %v", err)
+		}
+		return batch.RemainingQuantity
+	}
+	if got := remaining(margherita); got != 700 {
+		t.Errorf("моцарелла: остаток %.0f г, want 700 (2 набора по 150 г)", got)
+	}
+	if got := remaining(pepperoni); got != 840 {
+		t.Errorf("пепперони: остаток %.0f г, want 840 (2 набора по 80 г)", got)
+	}
+}
+
+// Пиццы набора без рецепта - набор не списывается вовсе
+func TestProcessSetDepletionRequiresRecipes(t *testing.T) {
+	db := newTestDB(t, &models.Recipe{}, &models.RecipeIngredient{}, &models.PizzaSetDB{})
+	service := NewStockService(db)
+
+	suffix := uuid.New().String()[:8]
+	pizzas, _ := json.Marshal([]string{"Несуществующая пицца " + suffix})
+	set := models.PizzaSetDB{Name: "Набор без рецептов " + suffix, Pizzas: string(pizzas), Price: 500, IsActive: true}
+	if err := db.Create(&set).Error; err != nil {
+		t.Fatalf("не удалось создать набор: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Where("id = ?", set.ID).Delete(&models.PizzaSetDB{})
+	})
+
+	if err := service.ProcessSetDepletion(set.Name, 1, uuid.New().String(), "test", uuid.New().String()); !errors.Is(err, ErrSetRecipeMissing) {
+		t.Errorf("ProcessSetDepletion: err = %v, want ErrSetRecipeMissing", err)
+	}
+	if err := service.ProcessSetDepletion("Нет такого набора "+suffix, 1, uuid.New().String(), "test", uuid.New().String()); !errors.Is(err, ErrSetNotFound) {
+		t.Errorf("ProcessSetDepletion: err = %v, want ErrSetNotFound", err)
+	}
+}
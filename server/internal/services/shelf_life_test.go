@@ -0,0 +1,95 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestShelfLifeExpiry(t *testing.T) {
+	receivedAt := time.Date(2030, 1, 30, 0, 0, 0, 0, time.UTC)
+
+	if got := shelfLifeExpiry(receivedAt, 0); got != nil {
+		t.Errorf("shelf_life_days = 0: срок %v, want без срока", got)
+	}
+	if got := shelfLifeExpiry(receivedAt, -3); got != nil {
+		t.Errorf("shelf_life_days < 0: срок %v, want без срока", got)
+	}
+	// Срок считается календарными днями, через границу месяца
+	want := time.Date(2030, 2, 4, 0, 0, 0, 0, time.UTC)
+	if got := shelfLifeExpiry(receivedAt, 5); got == nil || !got.Equal(want) {
+		t.Errorf("shelf_life_days = 5: срок %v, want %v", got, want)
+	}
+}
+
+// Партия без expiry_date получает срок от даты накладной по shelf_life_days;
+// явный срок из накладной и непортящийся товар не пересчитываются
+func TestProcessInboundInvoiceDerivesExpiryFromShelfLife(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.NomenclatureItem{}, &models.Invoice{},
+		&models.StockBatch{}, &models.StockMovement{}, &models.PriceHistory{})
+	service := NewStockService(db)
+	branchID := newTestBranch(t, db)
+
+	createItem := func(name string, shelfLifeDays int) string {
+		t.Helper()
+		item := models.NomenclatureItem{
+			SKU:              "TEST-" + uuid.New().String()[:8],
+			Name:             name,
+			BaseUnit:         "g",
+			InboundUnit:      "kg",
+			ConversionFactor: 1000,
+			ShelfLifeDays:    shelfLifeDays,
+			IsActive:         true,
+		}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("не удалось создать товар: %v", err)
+		}
+		t.Cleanup(func() {
+			db.Where("nomenclature_id = ?", item.ID).Delete(&models.PriceHistory{})
+			db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+		})
+		return item.ID
+	}
+	milkID := createItem("Молоко", 5)
+	creamID := createItem("Сливки", 7)
+	saltID := createItem("Соль", 0)
+	t.Cleanup(func() {
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.Invoice{})
+	})
+
+	line := func(nomenclatureID string) map[string]interface{} {
+		return map[string]interface{}{
+			"nomenclature_id": nomenclatureID,
+			"branch_id":       branchID,
+			"quantity":        1.0,
+			"unit":            "kg",
+			"price_per_unit":  100.0,
+		}
+	}
+	cream := line(creamID)
+	cream["expiry_date"] = "2030-01-31"
+	items := []map[string]interface{}{line(milkID), cream, line(saltID)}
+	if _, err := service.ProcessInboundInvoice("TEST-INV-"+uuid.New().String()[:8], items, "test", "", 300, false, "2030-01-30"); err != nil {
+		t.Fatalf("ProcessInboundInvoice: %v", err)
+	}
+
+	// Пустая строка - партия без срока
+	for nomenclatureID, want := range map[string]string{milkID: "2030-02-04", creamID: "2030-01-31", saltID: ""} {
+		var batch models.StockBatch
+		if err := db.Where("branch_id = ? AND nomenclature_id = ?", branchID, nomenclatureID).First(&batch).Error; err != nil {
+			t.Fatalf("партия не создана: %v", err)
+		}
+		got := ""
+		if batch.ExpiryAt != nil {
+			got = batch.ExpiryAt.UTC().Format("2006-01-02")
+		}
+		if got != want {
+			t.Errorf("товар %s: срок %q, want %q", nomenclatureID, got, want)
+		}
+	}
+}
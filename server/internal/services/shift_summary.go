@@ -0,0 +1,225 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils/timefmt"
+)
+
+// shiftCompletedStatuses - заказ отдан кухней (те же статусы, что у выручки, плюс completed)
+// Заархивированные отмены исключаются по cancelled_at
+const shiftCompletedStatuses = `('ready', 'delivered', 'completed', 'archived')`
+
+// ShiftSlotSummary - самый загруженный слот смены
+type ShiftSlotSummary struct {
+	SlotID    string     `json:"slot_id"`
+	StartTime *time.Time `json:"start_time,omitempty"`
+	Orders    int        `json:"orders"`
+	Revenue   int        `json:"revenue"` // Сумма заказов слота в рублях
+}
+
+// ShiftStationSummary - сколько позиций приготовила станция
+type ShiftStationSummary struct {
+	StationID   string `json:"station_id"` // Пусто - заказы без станции
+	StationName string `json:"station_name"`
+	Orders      int    `json:"orders"`
+	Items       int    `json:"items"` // Сумма quantity позиций заказов станции
+}
+
+// ShiftIngredientSummary - израсходованное сырье (продажи за вычетом возвратов при отмене)
+type ShiftIngredientSummary struct {
+	NomenclatureID string  `json:"nomenclature_id"`
+	Name           string  `json:"name"`
+	Unit           string  `json:"unit"`     // BaseUnit
+	Quantity       float64 `json:"quantity"` // В BaseUnit
+	Value          float64 `json:"value"`    // По цене списанных партий, в рублях
+}
+
+// ShiftSummary - итоги смены кухни за бизнес-день филиала
+type ShiftSummary struct {
+	BranchID             string                   `json:"branch_id"`
+	Date                 string                   `json:"date"`
+	CompletedOrders      int                      `json:"completed_orders"`
+	AverageTicketSeconds int                      `json:"average_ticket_seconds"` // От появления на планшете (visible_at, иначе created_at) до completed_at
+	TimedOrders          int                      `json:"timed_orders"`           // Заказов с completed_at, по которым считалось среднее
+	BusiestSlot          *ShiftSlotSummary        `json:"busiest_slot"`
+	Stations             []ShiftStationSummary    `json:"stations"`
+	Ingredients          []ShiftIngredientSummary `json:"ingredients"`
+	ConsumedValue        float64                  `json:"consumed_value"`
+}
+
+// ShiftSummaryService собирает отчет "итоги смены" из заказов, движений склада и станций
+type ShiftSummaryService struct {
+	db *gorm.DB
+}
+
+// NewShiftSummaryService создает сервис отчета по смене
+func NewShiftSummaryService(db *gorm.DB) *ShiftSummaryService {
+	return &ShiftSummaryService{db: db}
+}
+
+// GetShiftSummary возвращает итоги смены филиала за бизнес-дату date (YYYY-MM-DD в часовом поясе филиала или момент RFC3339)
+// Пустая date - сегодня. Заказы относятся к смене по created_at, расход сырья - по времени движения
+func (s *ShiftSummaryService) GetShiftSummary(branchID, date string) (*ShiftSummary, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("PostgreSQL недоступен")
+	}
+	if branchID == "" {
+		return nil, fmt.Errorf("branch_id обязателен")
+	}
+	loc := BranchLocation(s.db, branchID)
+	if date == "" {
+		date = BusinessDate(time.Now(), loc)
+	} else if !timefmt.IsDateOnly(date) {
+		// Момент RFC3339 относится к бизнес-дню филиала, в который он попадает
+		moment, err := timefmt.Parse(date)
+		if err != nil {
+			return nil, fmt.Errorf("неверная дата '%s': %w", date, err)
+		}
+		date = BusinessDate(moment, loc)
+	}
+	dayStart, dayEnd, err := BusinessDayBounds(date, loc)
+	if err != nil {
+		return nil, fmt.Errorf("неверная дата '%s': %w", date, err)
+	}
+
+	summary := &ShiftSummary{
+		BranchID:    branchID,
+		Date:        date,
+		Stations:    make([]ShiftStationSummary, 0),
+		Ingredients: make([]ShiftIngredientSummary, 0),
+	}
+	completed := s.db.Table("orders").
+		Where("orders.branch_id = ? AND orders.created_at >= ? AND orders.created_at < ?", branchID, dayStart, dayEnd).
+		Where("orders.status IN " + shiftCompletedStatuses + " AND orders.cancelled_at IS NULL")
+
+	// 1. Количество и среднее время приготовления
+	var totals struct {
+		Completed      int
+		Timed          int
+		AverageSeconds float64
+	}
+	if err := completed.Session(&gorm.Session{}).
+		Select(`COUNT(*) AS completed,
+			COUNT(completed_at) AS timed,
+			COALESCE(AVG(EXTRACT(EPOCH FROM completed_at - GREATEST(created_at, COALESCE(visible_at, created_at)))), 0) AS average_seconds`).
+		Scan(&totals).Error; err != nil {
+		return nil, fmt.Errorf("ошибка подсчета заказов смены: %w", err)
+	}
+	summary.CompletedOrders = totals.Completed
+	summary.TimedOrders = totals.Timed
+	summary.AverageTicketSeconds = int(totals.AverageSeconds + 0.5)
+
+	// 2. Самый загруженный слот: больше всего заказов, при равенстве - больше сумма
+	var slots []struct {
+		SlotID    string
+		StartTime *time.Time
+		Orders    int
+		Revenue   int
+	}
+	if err := completed.Session(&gorm.Session{}).
+		Select(`target_slot_id AS slot_id, MIN(target_slot_start_time) AS start_time, COUNT(*) AS orders,
+			COALESCE(SUM(COALESCE(NULLIF(final_price, 0), total_price)), 0) AS revenue`).
+		Where("target_slot_id IS NOT NULL AND target_slot_id <> ''").
+		Group("target_slot_id").
+		Order("orders DESC, revenue DESC, slot_id").
+		Limit(1).
+		Scan(&slots).Error; err != nil {
+		return nil, fmt.Errorf("ошибка поиска загруженного слота: %w", err)
+	}
+	if len(slots) > 0 {
+		slot := slots[0]
+		summary.BusiestSlot = &ShiftSlotSummary{SlotID: slot.SlotID, StartTime: slot.StartTime, Orders: slot.Orders, Revenue: slot.Revenue}
+	}
+
+	// 3. Позиции по станциям (позиция без quantity считается за одну)
+	if err := completed.Session(&gorm.Session{}).
+		Select(`COALESCE(orders.station_id::text, '') AS station_id, COALESCE(MAX(st.name), '') AS station_name,
+			COUNT(DISTINCT orders.id) AS orders,
+			COALESCE(SUM(COALESCE(NULLIF((item->>'quantity')::int, 0), 1)), 0) AS items`).
+		Joins("CROSS JOIN LATERAL jsonb_array_elements(orders.items) AS item").
+		Joins("LEFT JOIN stations st ON st.id = orders.station_id::text").
+		Group("orders.station_id").
+		Order("items DESC").
+		Scan(&summary.Stations).Error; err != nil {
+		return nil, fmt.Errorf("ошибка подсчета позиций по станциям: %w", err)
+	}
+	for i := range summary.Stations {
+		if summary.Stations[i].StationID == "" {
+			summary.Stations[i].StationName = "Без станции"
+		}
+	}
+
+	// 4. Расход сырья
+	ingredients, consumed, err := s.shiftConsumption(branchID, dayStart, dayEnd)
+	if err != nil {
+		return nil, err
+	}
+	summary.Ingredients = ingredients
+	summary.ConsumedValue = consumed
+	return summary, nil
+}
+
+// shiftConsumption суммирует списания при продаже (sale минус sale_reversal) по номенклатуре
+// Стоимость - по цене партий, из которых списано: (количество * цена) / ConversionFactor
+func (s *ShiftSummaryService) shiftConsumption(branchID string, from, to time.Time) ([]ShiftIngredientSummary, float64, error) {
+	var rows []struct {
+		NomenclatureID   string
+		Name             string
+		BaseUnit         string
+		InboundUnit      string
+		ConversionFactor float64
+		CostPerUnit      float64
+		Quantity         float64
+	}
+	if err := s.db.Table("stock_movements AS sm").
+		Select(`sm.nomenclature_id, ni.name, ni.base_unit, ni.inbound_unit, ni.conversion_factor,
+			COALESCE(sb.cost_per_unit, 0) AS cost_per_unit, -SUM(sm.quantity) AS quantity`).
+		Joins("JOIN nomenclature_items ni ON ni.id = sm.nomenclature_id").
+		Joins("LEFT JOIN stock_batches sb ON sb.id = sm.stock_batch_id").
+		Where("sm.branch_id = ? AND sm.created_at >= ? AND sm.created_at < ?", branchID, from, to).
+		Where("sm.movement_type IN ('sale', 'sale_reversal') AND sm.deleted_at IS NULL").
+		Group("sm.nomenclature_id, ni.name, ni.base_unit, ni.inbound_unit, ni.conversion_factor, sb.cost_per_unit").
+		Scan(&rows).Error; err != nil {
+		return nil, 0, fmt.Errorf("ошибка подсчета расхода сырья: %w", err)
+	}
+
+	type consumption struct {
+		summary ShiftIngredientSummary
+		value   decimal.Decimal
+	}
+	byItem := make(map[string]*consumption)
+	for _, row := range rows {
+		item, ok := byItem[row.NomenclatureID]
+		if !ok {
+			item = &consumption{summary: ShiftIngredientSummary{NomenclatureID: row.NomenclatureID, Name: row.Name, Unit: row.BaseUnit}}
+			byItem[row.NomenclatureID] = item
+		}
+		item.summary.Quantity += row.Quantity
+		item.value = item.value.Add(calculateBatchValue(
+			decimal.NewFromFloat(row.Quantity),
+			decimal.NewFromFloat(row.CostPerUnit),
+			costConversionFactor(models.NomenclatureItem{BaseUnit: row.BaseUnit, InboundUnit: row.InboundUnit, ConversionFactor: row.ConversionFactor}),
+		))
+	}
+
+	result := make([]ShiftIngredientSummary, 0, len(byItem))
+	total := decimal.Zero
+	for _, item := range byItem {
+		if item.summary.Quantity <= 0 {
+			continue // Все списания вернули при отмене
+		}
+		item.summary.Value = item.value.Round(stockCostDecimals).InexactFloat64()
+		total = total.Add(item.value)
+		result = append(result, item.summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Value > result[j].Value
+	})
+	return result, total.Round(stockCostDecimals).InexactFloat64(), nil
+}
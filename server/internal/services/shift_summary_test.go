@@ -0,0 +1,132 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Смена филиала: два доставленных заказа в слоте 12:00 (10 и 20 минут), готовый заказ в слоте 12:15 без станции,
+// отмененный заказ и заказ другого филиала. Сыр списан из двух партий, часть возвращена при отмене
+func TestGetShiftSummaryOverFixtureShift(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.StockBatch{}, &models.StockMovement{}, &models.Station{})
+	if !db.Migrator().HasTable("orders") {
+		t.Skip("таблица orders не создана (migrations/013): тест пропущен")
+	}
+	db.Exec("SELECT create_orders_partition(CURRENT_DATE)") // Партиция текущего месяца, если ее еще нет
+	service := NewShiftSummaryService(db)
+
+	branchID := uuid.New().String()
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+	at := func(hour, min int) time.Time {
+		return day.Add(time.Duration(hour)*time.Hour + time.Duration(min)*time.Minute)
+	}
+	slotNoon, slotQuarter := "slot:test-"+uuid.New().String()[:8], "slot:test-"+uuid.New().String()[:8]
+
+	station := models.Station{ID: uuid.New().String(), Name: "Печь", BranchID: branchID}
+	if err := db.Create(&station).Error; err != nil {
+		t.Fatalf("не удалось создать станцию: %v", err)
+	}
+
+	var orderIDs []string
+	insertOrder := func(branch, status, items string, price int, slotID string, slotStart time.Time, created time.Time, completed, cancelled *time.Time, stationID *string) {
+		id := uuid.New().String()
+		orderIDs = append(orderIDs, id)
+		if err := db.Exec(`INSERT INTO orders (id, display_id, items, total_price, final_price, status, created_at, completed_at,
+				cancelled_at, visible_at, target_slot_id, target_slot_start_time, branch_id, station_id)
+			VALUES (?, ?, ?::jsonb, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, "T-"+id[:6], items, price, price, status, created, completed, cancelled, created.Add(5*time.Minute),
+			slotID, slotStart, branch, stationID).Error; err != nil {
+			t.Fatalf("не удалось создать заказ: %v", err)
+		}
+	}
+	done := func(ts time.Time) *time.Time { return &ts }
+
+	// Окно: visible_at = created_at + 5 минут
+	insertOrder(branchID, "delivered", `[{"quantity": 2}, {"quantity": 1}]`, 1000, slotNoon, at(12, 0), at(11, 50), done(at(12, 5)), nil, &station.ID)
+	insertOrder(branchID, "delivered", `[{"quantity": 1}]`, 500, slotNoon, at(12, 0), at(11, 52), done(at(12, 17)), nil, &station.ID)
+	insertOrder(branchID, "ready", `[{"quantity": 3}]`, 2000, slotQuarter, at(12, 15), at(12, 0), nil, nil, nil)
+	insertOrder(branchID, "cancelled", `[{"quantity": 5}]`, 3000, slotQuarter, at(12, 15), at(12, 1), nil, done(at(12, 3)), nil)
+	insertOrder(uuid.New().String(), "delivered", `[{"quantity": 9}]`, 9000, slotQuarter, at(12, 15), at(12, 2), done(at(12, 10)), nil, nil)
+
+	cheese := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: "Сыр", BaseUnit: "g", InboundUnit: "kg", IsActive: true}
+	if err := db.Create(&cheese).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	var batchIDs []string
+	newBatch := func(cost float64) string {
+		batch := models.StockBatch{NomenclatureID: cheese.ID, BranchID: branchID, Quantity: 1000, RemainingQuantity: 1000, Unit: "g", CostPerUnit: cost, Source: "adjustment"}
+		if err := db.Create(&batch).Error; err != nil {
+			t.Fatalf("не удалось создать партию: %v", err)
+		}
+		batchIDs = append(batchIDs, batch.ID)
+		return batch.ID
+	}
+	cheap, expensive := newBatch(500), newBatch(1000)
+	for _, movement := range []struct {
+		batchID  string
+		quantity float64
+		kind     string
+	}{
+		{cheap, -200, "sale"},         // 100₽
+		{expensive, -100, "sale"},     // 100₽
+		{cheap, 100, "sale_reversal"}, // -50₽
+		{expensive, 500, "invoice"},   // Не расход
+	} {
+		batchID := movement.batchID
+		if err := db.Create(&models.StockMovement{
+			StockBatchID:   &batchID,
+			NomenclatureID: cheese.ID,
+			BranchID:       branchID,
+			Quantity:       movement.quantity,
+			Unit:           "g",
+			MovementType:   movement.kind,
+			CreatedAt:      at(12, 30),
+		}).Error; err != nil {
+			t.Fatalf("не удалось создать движение: %v", err)
+		}
+	}
+
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM orders WHERE id = ANY(?)", pq.Array(orderIDs))
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("id IN ?", batchIDs).Delete(&models.StockBatch{})
+		db.Unscoped().Where("id = ?", cheese.ID).Delete(&models.NomenclatureItem{})
+		db.Unscoped().Where("id = ?", station.ID).Delete(&models.Station{})
+	})
+
+	summary, err := service.GetShiftSummary(branchID, day.Format("2006-01-02"))
+	if err != nil {
+		t.Fatalf("GetShiftSummary: %v", err)
+	}
+
+	if summary.CompletedOrders != 3 {
+		t.Errorf("выполнено заказов %d, want 3 (отмененный и чужой филиал не считаются)", summary.CompletedOrders)
+	}
+	// (10 + 20 минут) / 2 от появления на планшете
+	if summary.TimedOrders != 2 || summary.AverageTicketSeconds != 900 {
+		t.Errorf("среднее время %d с по %d заказам, want 900 с по 2", summary.AverageTicketSeconds, summary.TimedOrders)
+	}
+	if summary.BusiestSlot == nil || summary.BusiestSlot.SlotID != slotNoon || summary.BusiestSlot.Orders != 2 || summary.BusiestSlot.Revenue != 1500 {
+		t.Errorf("самый загруженный слот = %+v, want %s: 2 заказа на 1500₽", summary.BusiestSlot, slotNoon)
+	}
+	if math.Abs(summary.ConsumedValue-150) > 0.001 {
+		t.Errorf("стоимость расхода = %.2f₽, want 150", summary.ConsumedValue)
+	}
+	if len(summary.Ingredients) != 1 || summary.Ingredients[0].Quantity != 200 {
+		t.Errorf("расход сырья = %+v, want Сыр 200 г", summary.Ingredients)
+	}
+
+	items := make(map[string]int)
+	for _, s := range summary.Stations {
+		items[s.StationID] = s.Items
+	}
+	if items[station.ID] != 4 || items[""] != 3 {
+		t.Errorf("позиции по станциям = %v, want Печь: 4, без станции: 3", items)
+	}
+}
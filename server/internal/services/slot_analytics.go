@@ -0,0 +1,180 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+)
+
+// SlotUtilization - загрузка одного слота за день по журналу бронирования
+type SlotUtilization struct {
+	SlotID         string    `json:"slot_id"`
+	StartTime      time.Time `json:"start_time"`
+	Orders         int       `json:"orders"`          // Назначено заказов (за вычетом отмененных)
+	Load           int       `json:"load"`            // Сумма назначенных заказов в рублях (за вычетом отмененных)
+	Capacity       int       `json:"capacity"`        // Номинальная емкость слота в рублях
+	Utilization    float64   `json:"utilization"`     // Load / Capacity, %
+	OverflowOrders int       `json:"overflow_orders"` // Заказов, которые не поместились в слот и ушли дальше
+}
+
+// SlotAnalytics - загрузка слотов и отказы за день
+type SlotAnalytics struct {
+	Date               string            `json:"date"`
+	Slots              []SlotUtilization `json:"slots"`
+	AssignedOrders     int               `json:"assigned_orders"`
+	RejectedOrders     int               `json:"rejected_orders"` // Не приняты: свободных слотов не было
+	RejectionRate      float64           `json:"rejection_rate"`  // Rejected / (Assigned + Rejected), %
+	AverageUtilization float64           `json:"average_utilization"`
+	FullSlots          int               `json:"full_slots"` // Слотов с загрузкой >= 100%
+}
+
+// RecordSlotOutcome пишет исход бронирования слота в журнал slot_outcomes
+// Запись идет в фоне: ошибка PostgreSQL не должна задерживать или срывать назначение заказа
+func (ss *SlotService) RecordSlotOutcome(outcome models.SlotOutcome) {
+	if ss.db == nil {
+		return
+	}
+	// Время исхода - по часам сервиса, как и время слотов: иначе отказ может попасть в другой день аналитики
+	if outcome.CreatedAt.IsZero() {
+		outcome.CreatedAt = ss.clock.Now().UTC()
+	}
+	go func() {
+		if err := ss.db.Create(&outcome).Error; err != nil {
+			log.Printf("⚠️ SlotService: не удалось записать исход слота (%s, заказ %s): %v", outcome.Outcome, outcome.OrderID, err)
+		}
+	}()
+}
+
+// recordSlotResult записывает назначение или переполнение слота
+func (ss *SlotService) recordSlotResult(outcome, slotID string, slotStart time.Time, orderID string, orderPrice, load, capacity int, branchID string) {
+	start := slotStart.UTC()
+	ss.RecordSlotOutcome(models.SlotOutcome{
+		SlotID:     slotID,
+		SlotStart:  &start,
+		BranchID:   branchID,
+		OrderID:    orderID,
+		Outcome:    outcome,
+		OrderPrice: orderPrice,
+		Load:       load,
+		Capacity:   capacity,
+	})
+}
+
+// recordSlotRejection записывает отказ: на сегодня не осталось слотов с местом
+func (ss *SlotService) recordSlotRejection(orderID string, orderPrice int, branchID string) {
+	ss.RecordSlotOutcome(models.SlotOutcome{
+		BranchID:   branchID,
+		OrderID:    orderID,
+		Outcome:    models.SlotOutcomeRejected,
+		OrderPrice: orderPrice,
+	})
+}
+
+// GetSlotAnalytics возвращает загрузку слотов и количество отказов за день (date - UTC)
+// branchID - опционально. Загрузка считается по журналу: назначения минус отмены
+func (ss *SlotService) GetSlotAnalytics(date time.Time, branchID string) (*SlotAnalytics, error) {
+	if ss.db == nil {
+		return nil, fmt.Errorf("PostgreSQL недоступен")
+	}
+
+	dayStart := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	dayEnd := dayStart.AddDate(0, 0, 1)
+
+	// Слоты дня - по времени начала слота, отказы - по времени попытки заказа
+	query := ss.db.Where("(slot_start >= ? AND slot_start < ?) OR (outcome = ? AND created_at >= ? AND created_at < ?)",
+		dayStart, dayEnd, models.SlotOutcomeRejected, dayStart, dayEnd)
+	if branchID != "" {
+		// Освобождение слота пишется без филиала - относим его к филиалу назначения заказа
+		query = query.Where("branch_id = ? OR (outcome = ? AND order_id IN (?))", branchID, models.SlotOutcomeReleased,
+			ss.db.Model(&models.SlotOutcome{}).Select("order_id").Where("outcome = ? AND branch_id = ?", models.SlotOutcomeAssigned, branchID))
+	}
+
+	var outcomes []models.SlotOutcome
+	if err := query.Order("created_at ASC").Find(&outcomes).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки журнала слотов: %w", err)
+	}
+
+	analytics := computeSlotAnalytics(outcomes)
+	analytics.Date = dayStart.Format("2006-01-02")
+	return analytics, nil
+}
+
+// computeSlotAnalytics агрегирует журнал бронирования (outcomes - по возрастанию created_at)
+func computeSlotAnalytics(outcomes []models.SlotOutcome) *SlotAnalytics {
+	bySlot := make(map[string]*SlotUtilization)
+	overflowed := make(map[string]map[string]bool) // slot_id -> заказы, не поместившиеся в слот
+	rejected := make(map[string]bool)
+	analytics := &SlotAnalytics{Slots: []SlotUtilization{}}
+
+	slot := func(o models.SlotOutcome) *SlotUtilization {
+		s, ok := bySlot[o.SlotID]
+		if !ok {
+			s = &SlotUtilization{SlotID: o.SlotID}
+			if o.SlotStart != nil {
+				s.StartTime = o.SlotStart.UTC()
+			}
+			bySlot[o.SlotID] = s
+		}
+		// Берем последнюю известную емкость слота (могла меняться в течение дня)
+		if o.Capacity > 0 {
+			s.Capacity = o.Capacity
+		}
+		return s
+	}
+
+	for _, o := range outcomes {
+		switch o.Outcome {
+		case models.SlotOutcomeAssigned:
+			s := slot(o)
+			s.Orders++
+			s.Load += o.OrderPrice
+		case models.SlotOutcomeReleased:
+			s := slot(o)
+			s.Orders--
+			s.Load -= o.OrderPrice
+		case models.SlotOutcomeOverflow:
+			slot(o)
+			if overflowed[o.SlotID] == nil {
+				overflowed[o.SlotID] = make(map[string]bool)
+			}
+			overflowed[o.SlotID][o.OrderID] = true
+		case models.SlotOutcomeRejected:
+			rejected[o.OrderID] = true
+		}
+	}
+
+	utilizationSum := 0.0
+	for id, s := range bySlot {
+		if s.Orders < 0 {
+			s.Orders = 0
+		}
+		if s.Load < 0 {
+			s.Load = 0
+		}
+		s.OverflowOrders = len(overflowed[id])
+		if s.Capacity > 0 {
+			s.Utilization = roundTo(float64(s.Load)/float64(s.Capacity)*100, 1)
+		}
+		if s.Utilization >= 100 {
+			analytics.FullSlots++
+		}
+		utilizationSum += s.Utilization
+		analytics.AssignedOrders += s.Orders
+		analytics.Slots = append(analytics.Slots, *s)
+	}
+	sort.Slice(analytics.Slots, func(i, j int) bool {
+		return analytics.Slots[i].StartTime.Before(analytics.Slots[j].StartTime)
+	})
+
+	analytics.RejectedOrders = len(rejected)
+	if len(analytics.Slots) > 0 {
+		analytics.AverageUtilization = roundTo(utilizationSum/float64(len(analytics.Slots)), 1)
+	}
+	if total := analytics.AssignedOrders + analytics.RejectedOrders; total > 0 {
+		analytics.RejectionRate = roundTo(float64(analytics.RejectedOrders)/float64(total)*100, 1)
+	}
+	return analytics
+}
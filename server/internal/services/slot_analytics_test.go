@@ -0,0 +1,119 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestComputeSlotAnalytics(t *testing.T) {
+	first, second := testTime(12, 0, 0), testTime(12, 15, 0)
+	outcome := func(kind string, slotStart *time.Time, orderID string, price, capacity int) models.SlotOutcome {
+		o := models.SlotOutcome{Outcome: kind, OrderID: orderID, OrderPrice: price, Capacity: capacity}
+		if slotStart != nil {
+			o.SlotStart = slotStart
+			o.SlotID = "slot-" + slotStart.Format("1504")
+		}
+		return o
+	}
+	outcomes := []models.SlotOutcome{
+		outcome(models.SlotOutcomeAssigned, &first, "a", 600, 1000),
+		outcome(models.SlotOutcomeAssigned, &first, "b", 400, 1000),
+		outcome(models.SlotOutcomeOverflow, &first, "c", 500, 1000),
+		outcome(models.SlotOutcomeAssigned, &second, "c", 500, 1000),
+		// Повторная попытка того же заказа считается одним переполнением
+		outcome(models.SlotOutcomeOverflow, &first, "d", 700, 1000),
+		outcome(models.SlotOutcomeOverflow, &first, "d", 700, 1000),
+		outcome(models.SlotOutcomeOverflow, &second, "d", 700, 1000),
+		outcome(models.SlotOutcomeRejected, nil, "d", 700, 0),
+		outcome(models.SlotOutcomeRejected, nil, "e", 300, 0),
+		// Отмена освобождает место: освобождение пишется без емкости
+		outcome(models.SlotOutcomeReleased, &first, "b", 400, 0),
+	}
+
+	got := computeSlotAnalytics(outcomes)
+	want := &SlotAnalytics{
+		Slots: []SlotUtilization{
+			{SlotID: "slot-1200", StartTime: first, Orders: 1, Load: 600, Capacity: 1000, Utilization: 60, OverflowOrders: 2},
+			{SlotID: "slot-1215", StartTime: second, Orders: 1, Load: 500, Capacity: 1000, Utilization: 50, OverflowOrders: 1},
+		},
+		AssignedOrders:     2,
+		RejectedOrders:     2,
+		RejectionRate:      50,
+		AverageUtilization: 55,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("computeSlotAnalytics:\n got %+v\nwant %+v", got, want)
+	}
+
+	full := computeSlotAnalytics([]models.SlotOutcome{
+		outcome(models.SlotOutcomeAssigned, &first, "a", 1000, 1000),
+		outcome(models.SlotOutcomeAssigned, &first, "b", 100, 1000), // Овербукинг
+	})
+	if full.FullSlots != 1 || full.Slots[0].Utilization != 110 || full.RejectionRate != 0 {
+		t.Errorf("полный слот: %+v, want загрузку 110%% и один полный слот", full)
+	}
+
+	if empty := computeSlotAnalytics(nil); len(empty.Slots) != 0 || empty.RejectionRate != 0 || empty.AverageUtilization != 0 {
+		t.Errorf("пустой журнал: %+v", empty)
+	}
+}
+
+// Два слота до закрытия по одному заказу на 1000₽: назначения, переполнения и отказ третьего заказа
+// попадают в журнал и в аналитику дня
+func TestSlotAnalyticsReflectsAssignments(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.SlotOutcome{})
+	clock := NewMockClock(testTime(21, 20, 0))
+	ss := NewSlotService(newTestRedis(t), db, testOpenHour, 0, testCloseHour, 0, clock)
+	ss.SetMaxCapacity(1000)
+	branchID := newTestBranch(t, db)
+	t.Cleanup(func() {
+		db.Where("branch_id = ?", branchID).Delete(&models.SlotOutcome{})
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, _, _, err := ss.AssignSlot("order-analytics-"+uuid.New().String()[:8], 1000, 1, branchID); err != nil {
+			t.Fatalf("заказ #%d: %v", i+1, err)
+		}
+	}
+	if _, _, _, err := ss.AssignSlot("order-analytics-rejected", 1000, 1, branchID); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("третий заказ: %v, want ResourceExhausted", err)
+	}
+
+	// Журнал пишется в фоне - ждем, пока попадут все записи
+	var analytics *SlotAnalytics
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var err error
+		analytics, err = ss.GetSlotAnalytics(testTime(0, 0, 0), branchID)
+		if err != nil {
+			t.Fatalf("GetSlotAnalytics: %v", err)
+		}
+		if (analytics.AssignedOrders == 2 && analytics.RejectedOrders == 1) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if analytics.Date != "2030-01-15" || analytics.AssignedOrders != 2 || analytics.RejectedOrders != 1 ||
+		analytics.RejectionRate != 33.3 || analytics.FullSlots != 2 || len(analytics.Slots) != 2 {
+		t.Fatalf("аналитика %+v, want 2 назначенных, 1 отказ (33.3%%), 2 полных слота", analytics)
+	}
+	wantStarts := []time.Time{testTime(21, 30, 0), testTime(21, 45, 0)}
+	for i, slot := range analytics.Slots {
+		if !slot.StartTime.Equal(wantStarts[i]) || slot.Orders != 1 || slot.Load != 1000 || slot.Capacity != 1000 ||
+			slot.Utilization != 100 {
+			t.Errorf("слот %d: %+v, want %v с одним заказом на 1000₽ из 1000₽", i, slot, wantStarts[i])
+		}
+	}
+	// Второй заказ не поместился в 21:30, третий - ни в один слот
+	if analytics.Slots[0].OverflowOrders != 2 || analytics.Slots[1].OverflowOrders != 1 {
+		t.Errorf("переполнения %d и %d, want 2 и 1", analytics.Slots[0].OverflowOrders, analytics.Slots[1].OverflowOrders)
+	}
+}
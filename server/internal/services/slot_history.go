@@ -0,0 +1,117 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils/rediskeys"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultSlotArchiveInterval - период переноса закончившихся слотов в slot_history (SLOT_ARCHIVE_INTERVAL_MINUTES)
+const DefaultSlotArchiveInterval = 5 * time.Minute
+
+// ArchiveEndedSlots переносит в slot_history итог каждого закончившегося слота рабочих часов,
+// счетчики которого еще живут в Redis (окно SlotHistoryTTL). Уже перенесенные слоты пропускаются,
+// поэтому задачу можно запускать на нескольких инстансах. Пустые слоты тоже пишутся (загрузка 0) -
+// по ним видна простаивающая емкость. Возвращает количество новых записей
+func (ss *SlotService) ArchiveEndedSlots() (int, error) {
+	if ss.db == nil {
+		return 0, fmt.Errorf("PostgreSQL недоступен")
+	}
+	if ss.redisUtil == nil || ss.client == nil {
+		return 0, ErrRedisUnavailable
+	}
+
+	now := ss.clock.Now().UTC()
+	windowStart := now.Add(-rediskeys.SlotHistoryTTL()).Truncate(ss.slotDuration)
+
+	starts := make(map[string]time.Time)
+	slotIDs := make([]string, 0)
+	for start := windowStart; !start.Add(ss.slotDuration).After(now); start = start.Add(ss.slotDuration) {
+		if start.Before(now.Add(-rediskeys.SlotHistoryTTL())) || !ss.isWithinWorkingHours(start) {
+			continue // Счетчики слота могли уже истечь или это нерабочее время
+		}
+		slotID := ss.generateSlotID(start)
+		starts[slotID] = start
+		slotIDs = append(slotIDs, slotID)
+	}
+	if len(slotIDs) == 0 {
+		return 0, nil
+	}
+
+	var archived []string
+	if err := ss.db.Model(&models.SlotHistory{}).Where("slot_id IN ?", slotIDs).Pluck("slot_id", &archived).Error; err != nil {
+		return 0, fmt.Errorf("ошибка чтения архива слотов: %w", err)
+	}
+	done := make(map[string]bool, len(archived))
+	for _, slotID := range archived {
+		done[slotID] = true
+	}
+
+	ctx := ss.redisUtil.Context()
+	rows := make([]models.SlotHistory, 0)
+	for _, slotID := range slotIDs {
+		if done[slotID] {
+			continue
+		}
+		load, err := ss.client.Get(ctx, rediskeys.SlotKey(slotID)).Int()
+		if err != nil && err != redis.Nil {
+			return 0, fmt.Errorf("ошибка чтения загрузки слота %s: %w", slotID, err)
+		}
+		ordersCount, err := ss.client.SCard(ctx, rediskeys.SlotOrdersKey(slotID)).Result()
+		if err != nil {
+			return 0, fmt.Errorf("ошибка чтения заказов слота %s: %w", slotID, err)
+		}
+		capacity := ss.GetSlotMaxCapacity(slotID)
+		rows = append(rows, models.SlotHistory{
+			SlotID:            slotID,
+			StartTime:         starts[slotID],
+			EndTime:           starts[slotID].Add(ss.slotDuration),
+			Load:              load,
+			OrdersCount:       int(ordersCount),
+			Capacity:          capacity,
+			EffectiveCapacity: ss.effectiveCapacity(capacity),
+			Disabled:          ss.IsSlotDisabled(slotID),
+		})
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	// Другой инстанс мог записать слот между проверкой и вставкой
+	result := ss.db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "slot_id"}}, DoNothing: true}).Create(&rows)
+	if result.Error != nil {
+		return 0, fmt.Errorf("ошибка записи архива слотов: %w", result.Error)
+	}
+	return int(result.RowsAffected), nil
+}
+
+// StartSlotArchiver запускает периодический перенос закончившихся слотов в slot_history
+// interval должен быть меньше SlotHistoryTTL, иначе часть слотов истечет в Redis до переноса
+func (ss *SlotService) StartSlotArchiver(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultSlotArchiveInterval
+	}
+	if interval >= rediskeys.SlotHistoryTTL() {
+		log.Printf("⚠️ Период архивации слотов %s не меньше TTL истории слотов %s: часть слотов не попадет в архив",
+			interval, rediskeys.SlotHistoryTTL())
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if count, err := ss.ArchiveEndedSlots(); err != nil {
+				log.Printf("⚠️ Ошибка архивации слотов: %v", err)
+			} else if count > 0 {
+				log.Printf("🗄️ В slot_history перенесено слотов: %d", count)
+			}
+			<-ticker.C
+		}
+	}()
+	log.Printf("✅ Архивация прошедших слотов в PostgreSQL запущена (каждые %s)", interval)
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+)
+
+// Слот, время которого прошло, переносится в slot_history с итоговой загрузкой; повторный запуск не дублирует запись
+func TestArchiveEndedSlotsPersistsFinalLoad(t *testing.T) {
+	db := newTestDB(t, &models.SlotHistory{}, &models.SlotOutcome{})
+	clock := NewMockClock(testTime(12, 0, 0))
+	ss := NewSlotService(newTestRedis(t), db, testOpenHour, 0, testCloseHour, 0, clock)
+	ss.SetMaxCapacity(5000)
+	t.Cleanup(func() {
+		db.Where("start_time >= ? AND start_time < ?", testTime(0, 0, 0), testTime(23, 59, 59)).Delete(&models.SlotHistory{})
+		db.Where("order_id LIKE ?", "order-archive-%").Delete(&models.SlotOutcome{})
+	})
+
+	slotID, slotStart, _, err := ss.AssignSlot("order-archive-a", 1200, 1, "")
+	if err != nil {
+		t.Fatalf("AssignSlot: %v", err)
+	}
+	if _, _, _, err := ss.AssignSlot("order-archive-b", 800, 1, ""); err != nil {
+		t.Fatalf("AssignSlot: %v", err)
+	}
+
+	// Слот 12:15-12:30 еще не закончился - в архив не попадает
+	clock.Set(testTime(12, 20, 0))
+	if _, err := ss.ArchiveEndedSlots(); err != nil {
+		t.Fatalf("ArchiveEndedSlots: %v", err)
+	}
+	var count int64
+	db.Model(&models.SlotHistory{}).Where("slot_id = ?", slotID).Count(&count)
+	if count != 0 {
+		t.Fatalf("идущий слот %s попал в архив", slotID)
+	}
+
+	clock.Set(slotStart.Add(ss.slotDuration).Add(time.Minute))
+	if _, err := ss.ArchiveEndedSlots(); err != nil {
+		t.Fatalf("ArchiveEndedSlots: %v", err)
+	}
+	var history models.SlotHistory
+	if err := db.Where("slot_id = ?", slotID).First(&history).Error; err != nil {
+		t.Fatalf("слот %s не перенесен в архив: %v", slotID, err)
+	}
+	if history.Load != 2000 || history.OrdersCount != 2 || history.Capacity != 5000 {
+		t.Errorf("архив слота: загрузка %d₽, заказов %d, емкость %d₽; want 2000₽, 2, 5000₽",
+			history.Load, history.OrdersCount, history.Capacity)
+	}
+	if !history.StartTime.Equal(slotStart) || !history.EndTime.Equal(slotStart.Add(ss.slotDuration)) {
+		t.Errorf("время слота в архиве %v - %v, want %v", history.StartTime, history.EndTime, slotStart)
+	}
+
+	// Пустой прошедший слот тоже в архиве - с нулевой загрузкой
+	var empty models.SlotHistory
+	if err := db.Where("slot_id = ?", ss.generateSlotID(testTime(12, 0, 0))).First(&empty).Error; err != nil {
+		t.Fatalf("пустой слот 12:00 не перенесен в архив: %v", err)
+	}
+	if empty.Load != 0 || empty.OrdersCount != 0 {
+		t.Errorf("пустой слот: загрузка %d₽, заказов %d; want 0", empty.Load, empty.OrdersCount)
+	}
+
+	added, err := ss.ArchiveEndedSlots()
+	if err != nil {
+		t.Fatalf("повторный ArchiveEndedSlots: %v", err)
+	}
+	if added != 0 {
+		t.Errorf("повторный запуск добавил %d записей, want 0", added)
+	}
+	db.Model(&models.SlotHistory{}).Where("slot_id = ?", slotID).Count(&count)
+	if count != 1 {
+		t.Errorf("записей слота %s в архиве: %d, want 1", slotID, count)
+	}
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"testing"
+
+	"zephyrvpn/server/internal/utils/rediskeys"
+)
+
+// План пишется в PostgreSQL, кэш в Redis только сбрасывается; поврежденный кэш
+// не отдается - план перечитывается из БД и кэш перезаписывается
+func TestSlotPlanReadsThroughFromDatabase(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.Exec(`CREATE TABLE IF NOT EXISTS slot_plans (
+		slot_id VARCHAR(255) PRIMARY KEY,
+		delivery_plan INTEGER NOT NULL DEFAULT 0,
+		pickup_plan INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	)`).Error; err != nil {
+		t.Fatalf("не удалось создать slot_plans: %v", err)
+	}
+	redisUtil := newTestRedis(t)
+	ss := NewSlotService(redisUtil, db, testOpenHour, 0, testCloseHour, 0, NewMockClock(testTime(12, 0, 0)))
+
+	slotID := ss.generateSlotID(testTime(13, 0, 0))
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM slot_plans WHERE slot_id = ?", slotID)
+	})
+	ctx := redisUtil.Context()
+	infoKey := rediskeys.SlotInfoKey(slotID)
+
+	// Старое значение в кэше сбрасывается записью
+	redisUtil.GetClient().HSet(ctx, infoKey, "delivery_plan", "1", "pickup_plan", "1")
+	if err := ss.SetSlotPlan(slotID, 8500, 1500); err != nil {
+		t.Fatalf("SetSlotPlan: %v", err)
+	}
+	if cached, _ := redisUtil.GetClient().HExists(ctx, infoKey, "delivery_plan").Result(); cached {
+		t.Error("SetSlotPlan оставил план в кэше, want сброс")
+	}
+
+	delivery, pickup, err := ss.GetSlotPlan(slotID)
+	if err != nil || delivery != 8500 || pickup != 1500 {
+		t.Fatalf("GetSlotPlan = %d/%d (%v), want 8500/1500", delivery, pickup, err)
+	}
+
+	// Кэш поврежден
+	redisUtil.GetClient().HSet(ctx, infoKey, "delivery_plan", "garbage")
+	delivery, pickup, err = ss.GetSlotPlan(slotID)
+	if err != nil || delivery != 8500 || pickup != 1500 {
+		t.Fatalf("GetSlotPlan после порчи кэша = %d/%d (%v), want 8500/1500", delivery, pickup, err)
+	}
+	cached, err := redisUtil.GetClient().HGet(ctx, infoKey, "delivery_plan").Result()
+	if err != nil || cached != "8500" {
+		t.Errorf("кэш delivery_plan = %q (%v), want 8500", cached, err)
+	}
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"zephyrvpn/server/internal/utils/rediskeys"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SlotMove - перенос заказа из одного слота в другой
+type SlotMove struct {
+	OrderID    string    `json:"order_id"`
+	FromSlotID string    `json:"from_slot_id"`
+	ToSlotID   string    `json:"to_slot_id"`
+	SlotStart  time.Time `json:"slot_start"`
+	VisibleAt  time.Time `json:"visible_at"`
+	Price      int       `json:"price"`
+}
+
+// GetSlotOrderIDs возвращает ID заказов, забронировавших место в слоте (slot:{id}:orders), в стабильном порядке
+func (ss *SlotService) GetSlotOrderIDs(slotID string) ([]string, error) {
+	if ss.redisUtil == nil || ss.client == nil {
+		return nil, ErrRedisUnavailable
+	}
+	orderIDs, err := ss.client.SMembers(ss.redisUtil.Context(), rediskeys.SlotOrdersKey(slotID)).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	sort.Strings(orderIDs)
+	return orderIDs, nil
+}
+
+// MoveOrderToLaterSlot переносит заказ в слот, начинающийся не раньше чем через offset после его текущего слота
+// Место освобождается через ReleaseSlot и бронируется заново через AssignSlot с учетом емкости слотов.
+// Если более поздние слоты заполнены, заказ возвращается в исходный слот и возвращается ошибка
+func (ss *SlotService) MoveOrderToLaterSlot(orderID string, offset time.Duration, branchID string) (*SlotMove, error) {
+	if ss.redisUtil == nil || ss.client == nil {
+		return nil, ErrRedisUnavailable
+	}
+
+	ctx := ss.redisUtil.Context()
+	info, err := ss.client.HGetAll(ctx, rediskeys.OrderSlotKey(orderID)).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	fromSlotID := info["slot_id"]
+	fromStart, ok := parseSlotStartTime(fromSlotID)
+	if !ok {
+		return nil, fmt.Errorf("заказ %s не назначен на слот", orderID)
+	}
+	price := 0
+	fmt.Sscanf(info["price"], "%d", &price)
+
+	if err := ss.ReleaseSlot(orderID); err != nil {
+		return nil, err
+	}
+
+	toSlotID, slotStart, visibleAt, err := ss.assignSlot(orderID, price, 0, branchID, fromStart.Add(offset))
+	if err != nil {
+		if restoreErr := ss.restoreSlotBooking(orderID, fromSlotID, price); restoreErr != nil {
+			log.Printf("❌ MoveOrderToLaterSlot: заказ %s не перенесен и не возвращен в слот %s: %v", orderID, fromSlotID, restoreErr)
+			return nil, fmt.Errorf("%w (заказ не удалось вернуть в слот %s: %v)", err, fromSlotID, restoreErr)
+		}
+		return nil, err
+	}
+
+	log.Printf("⏩ SlotService: заказ %s перенесен из слота %s в %s (%d₽)", orderID, fromSlotID, toSlotID, price)
+	return &SlotMove{
+		OrderID:    orderID,
+		FromSlotID: fromSlotID,
+		ToSlotID:   toSlotID,
+		SlotStart:  slotStart,
+		VisibleAt:  visibleAt,
+		Price:      price,
+	}, nil
+}
+
+// restoreSlotBooking возвращает заказу место в слоте, освобожденное перед неудачным переносом
+// Емкость не проверяется: место только что занимал этот же заказ
+func (ss *SlotService) restoreSlotBooking(orderID, slotID string, price int) error {
+	luaScript := `
+		local slot_key = KEYS[1]
+		local order_key = KEYS[2]
+		local slot_id = ARGV[1]
+		local order_id = ARGV[2]
+		local order_price = tonumber(ARGV[3])
+		local history_ttl = tonumber(ARGV[4])
+		
+		redis.call('INCRBY', slot_key, order_price)
+		redis.call('EXPIRE', slot_key, history_ttl)
+		redis.call('HSET', order_key, 'slot_id', slot_id, 'price', order_price)
+		redis.call('EXPIRE', order_key, history_ttl)
+		redis.call('SADD', slot_key .. ':orders', order_id)
+		redis.call('EXPIRE', slot_key .. ':orders', history_ttl)
+		return 1
+	`
+
+	slotKey := rediskeys.SlotKey(slotID)
+	_, err := ss.client.Eval(ss.redisUtil.Context(), luaScript, []string{
+		slotKey,
+		rediskeys.OrderSlotKey(orderID),
+	}, []interface{}{
+		slotID,
+		orderID,
+		price,
+		int64(rediskeys.SlotHistoryTTL().Seconds()),
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("ошибка возврата заказа в слот: %w", err)
+	}
+	return nil
+}
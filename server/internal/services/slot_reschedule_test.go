@@ -0,0 +1,106 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Слот 12:15 с двумя заказами переносится на 15 минут: в слоте 12:30 уже 700₽ из 1200₽, поэтому заказ
+// на 600₽ уходит в 12:45, а заказ на 400₽ помещается в 12:30; исходный слот освобождается
+func TestMoveOrderToLaterSlot(t *testing.T) {
+	clock := NewMockClock(testTime(12, 0, 0))
+	ss := newRedisSlotService(t, clock)
+	ss.SetMaxCapacity(1200)
+
+	assign := func(orderID string, price int, want time.Time) string {
+		t.Helper()
+		slotID, slotStart, _, err := ss.AssignSlot(orderID, price, 1, "")
+		if err != nil {
+			t.Fatalf("AssignSlot(%s): %v", orderID, err)
+		}
+		if !slotStart.Equal(want) {
+			t.Fatalf("AssignSlot(%s): слот %v, want %v", orderID, slotStart, want)
+		}
+		return slotID
+	}
+	slotID := assign("order-a", 600, testTime(12, 15, 0))
+	assign("order-b", 400, testTime(12, 15, 0))
+	assign("order-blocker", 700, testTime(12, 30, 0)) // В 12:15 уже не помещается
+
+	orderIDs, err := ss.GetSlotOrderIDs(slotID)
+	if err != nil {
+		t.Fatalf("GetSlotOrderIDs: %v", err)
+	}
+	if !reflect.DeepEqual(orderIDs, []string{"order-a", "order-b"}) {
+		t.Fatalf("заказы слота %v, want [order-a order-b]", orderIDs)
+	}
+
+	want := map[string]time.Time{"order-a": testTime(12, 45, 0), "order-b": testTime(12, 30, 0)}
+	for _, orderID := range orderIDs {
+		move, err := ss.MoveOrderToLaterSlot(orderID, 15*time.Minute, "")
+		if err != nil {
+			t.Fatalf("MoveOrderToLaterSlot(%s): %v", orderID, err)
+		}
+		if move.FromSlotID != slotID || !move.SlotStart.Equal(want[orderID]) || move.ToSlotID == slotID {
+			t.Errorf("перенос %s: %+v, want из %s в слот %v", orderID, move, slotID, want[orderID])
+		}
+		if move.VisibleAt.After(move.SlotStart) {
+			t.Errorf("перенос %s: visible_at %v позже начала слота %v", orderID, move.VisibleAt, move.SlotStart)
+		}
+	}
+
+	if remaining, err := ss.GetSlotOrderIDs(slotID); err != nil || len(remaining) != 0 {
+		t.Errorf("в исходном слоте остались заказы %v (err=%v)", remaining, err)
+	}
+	info, err := ss.GetSlotInfo(slotID)
+	if err != nil {
+		t.Fatalf("GetSlotInfo: %v", err)
+	}
+	if info.CurrentLoad != 0 {
+		t.Errorf("загрузка исходного слота %d, want 0", info.CurrentLoad)
+	}
+}
+
+// Если более поздних слотов до закрытия нет, заказ остается в исходном слоте с прежней загрузкой
+func TestMoveOrderToLaterSlotKeepsOrderWhenNoRoom(t *testing.T) {
+	clock := NewMockClock(testTime(21, 20, 0))
+	ss := newRedisSlotService(t, clock)
+
+	slotID, slotStart, _, err := ss.AssignSlot("order-last", 700, 1, "")
+	if err != nil {
+		t.Fatalf("AssignSlot: %v", err)
+	}
+	if !slotStart.Equal(testTime(21, 30, 0)) {
+		t.Fatalf("слот %v, want 21:30", slotStart)
+	}
+
+	if _, err := ss.MoveOrderToLaterSlot("order-last", 30*time.Minute, ""); err == nil {
+		t.Fatal("перенос за время закрытия: want ошибку")
+	}
+	orderIDs, err := ss.GetSlotOrderIDs(slotID)
+	if err != nil || !reflect.DeepEqual(orderIDs, []string{"order-last"}) {
+		t.Errorf("заказы исходного слота %v (err=%v), want [order-last]", orderIDs, err)
+	}
+	info, err := ss.GetSlotInfo(slotID)
+	if err != nil {
+		t.Fatalf("GetSlotInfo: %v", err)
+	}
+	if info.CurrentLoad != 700 {
+		t.Errorf("загрузка исходного слота %d, want 700", info.CurrentLoad)
+	}
+
+	if _, err := ss.MoveOrderToLaterSlot("order-unknown", 15*time.Minute, ""); err == nil {
+		t.Error("заказ без слота: want ошибку")
+	}
+}
+
+func TestMoveOrderToLaterSlotWithoutRedis(t *testing.T) {
+	ss := newTestSlotService(NewMockClock(testTime(12, 0, 0)))
+	if _, err := ss.MoveOrderToLaterSlot("order-a", 15*time.Minute, ""); err != ErrRedisUnavailable {
+		t.Errorf("MoveOrderToLaterSlot без Redis: %v, want ErrRedisUnavailable", err)
+	}
+	if _, err := ss.GetSlotOrderIDs("slot:1"); err != ErrRedisUnavailable {
+		t.Errorf("GetSlotOrderIDs без Redis: %v, want ErrRedisUnavailable", err)
+	}
+}
@@ -2,10 +2,12 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -16,6 +18,7 @@ import (
 	"zephyrvpn/server/internal/pb"
 	"google.golang.org/protobuf/proto"
 	"zephyrvpn/server/internal/utils"
+	"zephyrvpn/server/internal/utils/rediskeys"
 )
 
 // SlotService управляет временными слотами для Capacity-Based Slot Scheduling
@@ -25,12 +28,21 @@ type SlotService struct {
 	db        *gorm.DB      // Доступ к PostgreSQL для персистентного хранения планов
 	slotDuration time.Duration // Длительность слота (по умолчанию 15 минут)
 	maxCapacityPerSlot int     // Максимальная емкость слота в РУБЛЯХ (не количество заказов!)
+	overbookingMu       sync.Mutex // Защищает overbookingPercent и overbookingLoadedAt (AssignSlot вызывается из воркеров параллельно)
+	overbookingPercent  int        // На сколько процентов загрузка может превысить емкость (компенсация неявок и отмен)
+	overbookingLoadedAt time.Time  // Когда overbookingPercent последний раз читался из Redis
+	defaultPrepLead time.Duration // Время подготовки до начала слота, если у филиала не задан prep_lead_minutes
+	defaultMinBeforeSlotEnd time.Duration // Минимум времени до конца текущего слота, если у филиала не задан min_minutes_before_slot_end
+	branchSettingsMu    sync.Mutex                    // Защищает branchSettings
+	branchSettings      map[string]branchSlotSettings // Настройки слотов филиалов из branches (кэш на branchSlotSettingsTTL)
 	
 	// Бизнес-часы пиццерии (в UTC, клиент сам конвертирует в свой часовой пояс)
 	openHour  int // Час открытия в UTC
 	openMin   int // Минута открытия в UTC
 	closeHour int // Час закрытия в UTC
 	closeMin  int // Минута закрытия в UTC
+
+	clock Clock // Источник текущего времени (MockClock в тестах)
 }
 
 // OrderInfo информация о заказе в слоте
@@ -46,7 +58,9 @@ type SlotInfo struct {
 	StartTime     time.Time   `json:"start_time"`     // RFC3339 формат
 	EndTime       time.Time   `json:"end_time"`       // RFC3339 формат
 	CurrentLoad   int         `json:"current_load"`   // Текущая сумма в рублях
-	MaxCapacity   int         `json:"max_capacity"`   // Максимальная сумма в рублях
+	MaxCapacity   int         `json:"max_capacity"`   // Максимальная сумма в рублях (номинальная емкость)
+	EffectiveCapacity int     `json:"effective_capacity"` // Потолок с учетом овербукинга (по нему принимаются заказы)
+	OverbookingPercent int    `json:"overbooking_percent"` // Допустимое превышение емкости в процентах
 	Disabled      bool        `json:"disabled"`       // Отключен ли слот
 	OrdersCount   int         `json:"orders_count"`   // Общее количество заказов
 	DeliveryCount int         `json:"delivery_count"` // Количество заказов на доставку
@@ -60,16 +74,24 @@ type SlotInfo struct {
 // ВАЖНО: Все временные операции выполняются в UTC
 // Конвертация в локальное время происходит на клиенте (фронтенде)
 // Бизнес-часы задаются в UTC через переменные окружения
-func NewSlotService(redisUtil *utils.RedisClient, db *gorm.DB, openHour, openMin, closeHour, closeMin int) *SlotService {
+// clock - источник текущего времени (nil = RealClock)
+func NewSlotService(redisUtil *utils.RedisClient, db *gorm.DB, openHour, openMin, closeHour, closeMin int, clock Clock) *SlotService {
+	if clock == nil {
+		clock = RealClock{}
+	}
 	ss := &SlotService{
 		redisUtil:         redisUtil,
 		db:                db,              // PostgreSQL для персистентного хранения планов
 		slotDuration:      15 * time.Minute, // 15 минут по умолчанию
 		maxCapacityPerSlot: 10000,           // 10000 рублей на слот по умолчанию (устанавливается через ERP API UpdateSlotConfig)
+		defaultPrepLead:   30 * time.Minute, // 30 минут по умолчанию (переопределяется branches.prep_lead_minutes)
+		defaultMinBeforeSlotEnd: 8 * time.Minute, // 8 минут по умолчанию (переопределяется branches.min_minutes_before_slot_end)
 		openHour:          openHour,         // Открытие в UTC
 		openMin:           openMin,          // Минута открытия в UTC
 		closeHour:         closeHour,        // Закрытие в UTC
 		closeMin:          closeMin,         // Минута закрытия в UTC
+		clock:             clock,
+		branchSettings:    make(map[string]branchSlotSettings),
 	}
 	
 	log.Printf("✅ SlotService инициализирован: рабочие часы %02d:%02d - %02d:%02d UTC (клиент конвертирует в свой часовой пояс)", 
@@ -81,11 +103,15 @@ func NewSlotService(redisUtil *utils.RedisClient, db *gorm.DB, openHour, openMin
 		// Загружаем сохраненное значение maxCapacity из Redis
 		if ss.client != nil {
 			ctx := redisUtil.Context()
-			savedCapacity, err := ss.client.Get(ctx, "slot:config:max_capacity").Int()
+			savedCapacity, err := ss.client.Get(ctx, rediskeys.SlotConfigMaxCapacityKey).Int()
 			if err == nil && savedCapacity > 0 {
 				ss.maxCapacityPerSlot = savedCapacity
 				log.Printf("✅ Загружено сохраненное значение maxCapacity из Redis: %d₽", savedCapacity)
 			}
+			if savedPercent, err := ss.client.Get(ctx, rediskeys.SlotConfigOverbookingKey).Int(); err == nil && savedPercent >= 0 {
+				ss.overbookingPercent = savedPercent
+				ss.overbookingLoadedAt = time.Now()
+			}
 		}
 	}
 	
@@ -104,7 +130,7 @@ func (ss *SlotService) SetMaxCapacity(capacity int) {
 	// Сохраняем в Redis для персистентности
 	if ss.client != nil && ss.redisUtil != nil {
 		ctx := ss.redisUtil.Context()
-		if err := ss.client.Set(ctx, "slot:config:max_capacity", capacity, 0).Err(); err != nil {
+		if err := ss.client.Set(ctx, rediskeys.SlotConfigMaxCapacityKey, capacity, 0).Err(); err != nil {
 			log.Printf("⚠️ Ошибка сохранения maxCapacity в Redis: %v", err)
 		} else {
 			log.Printf("✅ maxCapacity обновлен: %d₽ -> %d₽ (сохранено в Redis)", oldCapacity, capacity)
@@ -114,6 +140,145 @@ func (ss *SlotService) SetMaxCapacity(capacity int) {
 	}
 }
 
+// GetMaxCapacity возвращает общую емкость слота в рублях (без индивидуальных лимитов)
+func (ss *SlotService) GetMaxCapacity() int {
+	return ss.maxCapacityPerSlot
+}
+
+// SetOverbookingPercent устанавливает допустимое превышение емкости слота в процентах
+// Например, 10 - слот принимает заказы до 110% от max_capacity (часть заказов не забирают или отменяют)
+func (ss *SlotService) SetOverbookingPercent(percent int) {
+	if percent < 0 {
+		percent = 0
+	}
+	ss.overbookingMu.Lock()
+	oldPercent := ss.overbookingPercent
+	ss.overbookingPercent = percent
+	ss.overbookingLoadedAt = time.Now()
+	ss.overbookingMu.Unlock()
+
+	if ss.client != nil && ss.redisUtil != nil {
+		if err := ss.client.Set(ss.redisUtil.Context(), rediskeys.SlotConfigOverbookingKey, percent, 0).Err(); err != nil {
+			log.Printf("⚠️ Ошибка сохранения овербукинга в Redis: %v", err)
+			return
+		}
+	}
+	log.Printf("✅ Овербукинг слотов обновлен: %d%% -> %d%%", oldPercent, percent)
+}
+
+// overbookingRefresh - как часто GetOverbookingPercent перечитывает значение из Redis
+// Изменение на другом инстансе становится видно не позже чем через этот интервал
+const overbookingRefresh = 5 * time.Second
+
+// GetOverbookingPercent возвращает текущий процент овербукинга (Redis - источник истины между инстансами)
+// Значение кэшируется на overbookingRefresh, чтобы AssignSlot не читал Redis для каждого проверяемого слота
+func (ss *SlotService) GetOverbookingPercent() int {
+	ss.overbookingMu.Lock()
+	defer ss.overbookingMu.Unlock()
+	if ss.client != nil && ss.redisUtil != nil && time.Since(ss.overbookingLoadedAt) >= overbookingRefresh {
+		if saved, err := ss.client.Get(ss.redisUtil.Context(), rediskeys.SlotConfigOverbookingKey).Int(); err == nil && saved >= 0 {
+			ss.overbookingPercent = saved
+		}
+		ss.overbookingLoadedAt = time.Now()
+	}
+	return ss.overbookingPercent
+}
+
+// effectiveCapacity возвращает потолок загрузки слота с учетом овербукинга
+func (ss *SlotService) effectiveCapacity(maxCapacity int) int {
+	return maxCapacity * (100 + ss.GetOverbookingPercent()) / 100
+}
+
+// Настройки слотов филиала меняются редко, а читаются при каждом AssignSlot: держим их в памяти.
+// Изменение в branches становится видно не позже чем через branchSlotSettingsTTL
+const branchSlotSettingsTTL = time.Minute
+
+// branchSlotSettings - настройки слотов филиала из branches (0 - не задано, используется значение по умолчанию)
+type branchSlotSettings struct {
+	prepLeadMinutes         int
+	minMinutesBeforeSlotEnd int
+	loadedAt                time.Time
+}
+
+// getBranchSettings возвращает настройки слотов филиала из кэша, перечитывая их из БД раз в branchSlotSettingsTTL
+// Ненайденный филиал тоже кэшируется (со значениями по умолчанию); при ошибке БД кэш не обновляется
+func (ss *SlotService) getBranchSettings(branchID string) branchSlotSettings {
+	if branchID == "" {
+		return branchSlotSettings{}
+	}
+
+	ss.branchSettingsMu.Lock()
+	defer ss.branchSettingsMu.Unlock()
+	if cached, ok := ss.branchSettings[branchID]; ok && time.Since(cached.loadedAt) < branchSlotSettingsTTL {
+		return cached
+	}
+	if ss.db == nil {
+		return branchSlotSettings{}
+	}
+
+	var branch models.Branch
+	err := ss.db.Select("id", "prep_lead_minutes", "min_minutes_before_slot_end").Where("id = ?", branchID).First(&branch).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("⚠️ SlotService: ошибка чтения настроек филиала %s, используем значения по умолчанию: %v", branchID, err)
+		return branchSlotSettings{}
+	}
+	if err != nil {
+		log.Printf("⚠️ SlotService: филиал %s не найден, используем значения по умолчанию", branchID)
+	}
+	settings := branchSlotSettings{
+		prepLeadMinutes:         branch.PrepLeadMinutes,
+		minMinutesBeforeSlotEnd: branch.MinMinutesBeforeSlotEnd,
+		loadedAt:                time.Now(),
+	}
+	ss.branchSettings[branchID] = settings
+	return settings
+}
+
+// GetPrepLeadTime возвращает время подготовки заказа до начала слота для филиала
+// Берется из branches.prep_lead_minutes; если филиал не указан или не найден - используется значение по умолчанию
+func (ss *SlotService) GetPrepLeadTime(branchID string) time.Duration {
+	settings := ss.getBranchSettings(branchID)
+	if settings.prepLeadMinutes <= 0 {
+		return ss.defaultPrepLead
+	}
+	return time.Duration(settings.prepLeadMinutes) * time.Minute
+}
+
+// GetMinTimeBeforeSlotEnd возвращает, сколько времени должно оставаться до конца текущего слота,
+// чтобы кухня филиала успела приготовить заказ в нем (иначе заказ переносится на следующий слот)
+// Берется из branches.min_minutes_before_slot_end; если филиал не указан или не найден - используется значение по умолчанию
+func (ss *SlotService) GetMinTimeBeforeSlotEnd(branchID string) time.Duration {
+	settings := ss.getBranchSettings(branchID)
+	if settings.minMinutesBeforeSlotEnd <= 0 {
+		return ss.defaultMinBeforeSlotEnd
+	}
+	return time.Duration(settings.minMinutesBeforeSlotEnd) * time.Minute
+}
+
+// firstSlotStart возвращает начало первого слота, в который можно назначить заказ в момент now
+// ПРОВЕРКА БЛИЖНЯКА: если до конца текущего слота осталось меньше минимального времени кухни филиала
+// (branches.min_minutes_before_slot_end, по умолчанию 8 минут), повар физически не успеет - перелетаем сразу на следующий
+func (ss *SlotService) firstSlotStart(now time.Time, branchID string) time.Time {
+	slotStart := ss.getSlotStartTime(now)
+	timeUntilSlotEnd := slotStart.Add(ss.slotDuration).Sub(now)
+	minBeforeSlotEnd := ss.GetMinTimeBeforeSlotEnd(branchID)
+	if timeUntilSlotEnd < minBeforeSlotEnd {
+		log.Printf("⚠️ AssignSlot: до конца текущего слота осталось %v (< %v), перелетаем на следующий слот", timeUntilSlotEnd, minBeforeSlotEnd)
+		slotStart = slotStart.Add(ss.slotDuration)
+	}
+	return slotStart
+}
+
+// calculateVisibleAt вычисляет время появления заказа на планшете повара
+// Заказ показывается за prepLead до начала слота, но не раньше текущего момента:
+// если это "ближняк" (до начала слота меньше prepLead), показываем с начала слота
+func calculateVisibleAt(slotStart, now time.Time, prepLead time.Duration) time.Time {
+	if slotStart.Sub(now) >= prepLead {
+		return slotStart.Add(-prepLead)
+	}
+	return slotStart
+}
+
 // isWithinWorkingHours проверяет, находится ли время в рабочих часах пиццерии
 // ВАЖНО: время должно быть в UTC, рабочие часы тоже заданы в UTC
 func (ss *SlotService) isWithinWorkingHours(t time.Time) bool {
@@ -153,7 +318,7 @@ func (ss *SlotService) IsSlotDisabled(slotID string) bool {
 		return false
 	}
 	
-	key := fmt.Sprintf("slot:%s:disabled", slotID)
+	key := rediskeys.SlotDisabledKey(slotID)
 	
 	disabled, err := ss.redisUtil.Get(key)
 	if err != nil {
@@ -166,14 +331,14 @@ func (ss *SlotService) IsSlotDisabled(slotID string) bool {
 // SetSlotDisabled устанавливает статус отключения слота
 func (ss *SlotService) SetSlotDisabled(slotID string, disabled bool) error {
 	if ss.redisUtil == nil {
-		return fmt.Errorf("Redis client not initialized")
+		return ErrRedisUnavailable
 	}
 	
-	key := fmt.Sprintf("slot:%s:disabled", slotID)
+	key := rediskeys.SlotDisabledKey(slotID)
 	
 	if disabled {
 		// Устанавливаем TTL 24 часа для автоматической очистки
-		return ss.redisUtil.Set(key, "1", 24*time.Hour)
+		return ss.redisUtil.Set(key, "1", rediskeys.SlotMetaTTL())
 	} else {
 		// Удаляем ключ, если слот включается
 		return ss.redisUtil.Delete(key)
@@ -181,12 +346,17 @@ func (ss *SlotService) SetSlotDisabled(slotID string, disabled bool) error {
 }
 
 // SetSlotPlan устанавливает план для слота (delivery_plan и pickup_plan)
-// КРИТИЧНО: Сохраняет в PostgreSQL (персистентно) и Redis (кэш)
+// КРИТИЧНО: PostgreSQL - источник истины. План сохраняется в транзакции, после коммита кэш в Redis
+// сбрасывается (а не заполняется): следующий GetSlotPlan перечитает план из БД.
+// Без PostgreSQL план хранится только в Redis
 func (ss *SlotService) SetSlotPlan(slotID string, deliveryPlan, pickupPlan int) error {
-	// 1. Сохраняем в PostgreSQL для персистентности
-	if ss.db != nil {
-		// Используем UPSERT (INSERT ... ON CONFLICT UPDATE) для PostgreSQL
-		query := `
+	if ss.db == nil {
+		return ss.cacheSlotPlan(slotID, deliveryPlan, pickupPlan)
+	}
+
+	// Используем UPSERT (INSERT ... ON CONFLICT UPDATE); параллельные записи одного слота упорядочивает блокировка строки
+	err := ss.db.Transaction(func(tx *gorm.DB) error {
+		return tx.Exec(`
 			INSERT INTO slot_plans (slot_id, delivery_plan, pickup_plan, updated_at)
 			VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
 			ON CONFLICT (slot_id) 
@@ -194,93 +364,125 @@ func (ss *SlotService) SetSlotPlan(slotID string, deliveryPlan, pickupPlan int)
 				delivery_plan = EXCLUDED.delivery_plan,
 				pickup_plan = EXCLUDED.pickup_plan,
 				updated_at = CURRENT_TIMESTAMP
-		`
-		if err := ss.db.Exec(query, slotID, deliveryPlan, pickupPlan).Error; err != nil {
-			log.Printf("⚠️ Ошибка сохранения плана слота в БД: %v", err)
-			// Не возвращаем ошибку - продолжаем с Redis
+		`, slotID, deliveryPlan, pickupPlan).Error
+	})
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения плана слота в БД: %w", err)
+	}
+
+	// Сбрасываем кэш; если Redis недоступен, старый план живет в кэше до истечения TTL
+	if ss.redisUtil != nil && ss.client != nil {
+		if err := ss.client.HDel(ss.redisUtil.Context(), rediskeys.SlotInfoKey(slotID), slotPlanFields...).Err(); err != nil {
+			log.Printf("⚠️ План слота %s сохранен в БД, но кэш в Redis не сброшен: %v", slotID, err)
 		}
 	}
-	
-	// 2. Сохраняем в Redis для быстрого доступа (кэш)
-	if ss.redisUtil == nil {
-		return fmt.Errorf("Redis client not initialized")
+	return nil
+}
+
+// slotPlanFields - поля кэша плана в hash slot:{id}:info
+var slotPlanFields = []string{"delivery_plan", "pickup_plan"}
+
+// cacheSlotPlan записывает план в hash слота (единственное хранилище, когда PostgreSQL не подключен)
+func (ss *SlotService) cacheSlotPlan(slotID string, deliveryPlan, pickupPlan int) error {
+	if ss.redisUtil == nil || ss.client == nil {
+		return ErrRedisUnavailable
 	}
-	
 	ctx := ss.redisUtil.Context()
-	slotKey := fmt.Sprintf("slot:%s:info", slotID)
-	
-	// Сохраняем планы в Redis hash
-	info := make(map[string]interface{})
-	info["delivery_plan"] = strconv.Itoa(deliveryPlan)
-	info["pickup_plan"] = strconv.Itoa(pickupPlan)
-	
-	// Используем HSet для обновления только этих полей
-	if ss.client != nil {
-		for k, v := range info {
-			if err := ss.client.HSet(ctx, slotKey, k, v).Err(); err != nil {
-				return fmt.Errorf("failed to set slot plan in Redis: %w", err)
-			}
+	slotKey := rediskeys.SlotInfoKey(slotID)
+	if err := ss.client.HSet(ctx, slotKey, "delivery_plan", strconv.Itoa(deliveryPlan), "pickup_plan", strconv.Itoa(pickupPlan)).Err(); err != nil {
+		return fmt.Errorf("failed to set slot plan in Redis: %w", err)
+	}
+	// Устанавливаем TTL 24 часа (кэш)
+	ss.client.Expire(ctx, slotKey, rediskeys.SlotMetaTTL())
+	return nil
+}
+
+// cachedSlotPlan читает план из кэша; ok=false - в кэше нет обоих полей или значение повреждено
+func (ss *SlotService) cachedSlotPlan(slotID string) (deliveryPlan, pickupPlan int, ok bool) {
+	if ss.redisUtil == nil || ss.client == nil {
+		return 0, 0, false
+	}
+	values, err := ss.client.HMGet(ss.redisUtil.Context(), rediskeys.SlotInfoKey(slotID), slotPlanFields...).Result()
+	if err != nil || len(values) != len(slotPlanFields) {
+		return 0, 0, false
+	}
+	plans := make([]int, len(values))
+	for i, value := range values {
+		str, isString := value.(string)
+		if !isString {
+			return 0, 0, false
 		}
-		// Устанавливаем TTL 24 часа (кэш)
-		ss.client.Expire(ctx, slotKey, 24*time.Hour)
-		return nil
+		plan, err := strconv.Atoi(str)
+		if err != nil {
+			log.Printf("⚠️ Поврежденный кэш плана слота %s (%s=%q), перечитываем из БД", slotID, slotPlanFields[i], str)
+			return 0, 0, false
+		}
+		plans[i] = plan
 	}
-	
-	return fmt.Errorf("Redis client not available")
+	return plans[0], plans[1], true
+}
+
+// loadSlotPlan читает план из PostgreSQL; found=false - план для слота не задавался
+func (ss *SlotService) loadSlotPlan(slotID string) (deliveryPlan, pickupPlan int, found bool, err error) {
+	var result struct {
+		DeliveryPlan int `gorm:"column:delivery_plan"`
+		PickupPlan   int `gorm:"column:pickup_plan"`
+	}
+	query := ss.db.Raw("SELECT delivery_plan, pickup_plan FROM slot_plans WHERE slot_id = ?", slotID).Scan(&result)
+	if query.Error != nil {
+		return 0, 0, false, fmt.Errorf("ошибка чтения плана слота из БД: %w", query.Error)
+	}
+	return result.DeliveryPlan, result.PickupPlan, query.RowsAffected > 0, nil
 }
 
 // GetSlotPlan получает планы для слота
-// КРИТИЧНО: Сначала проверяет Redis (кэш), затем PostgreSQL (персистентное хранилище)
+// Сначала проверяется кэш в Redis, при промахе план читается из PostgreSQL и кладется в кэш.
+// Кэш заполняется под WATCH: если SetSlotPlan сбросил его, пока читалась БД, прочитанное значение
+// могло устареть - тогда оно не кэшируется, а план перечитывается из БД
 func (ss *SlotService) GetSlotPlan(slotID string) (deliveryPlan, pickupPlan int, err error) {
-	// 1. Сначала проверяем Redis (быстрый кэш)
-	if ss.redisUtil != nil && ss.client != nil {
-		ctx := ss.redisUtil.Context()
-		slotKey := fmt.Sprintf("slot:%s:info", slotID)
-		
-		info, err := ss.client.HGetAll(ctx, slotKey).Result()
-		if err == nil && len(info) > 0 {
-			if deliveryStr, ok := info["delivery_plan"]; ok && deliveryStr != "" {
-				deliveryPlan, _ = strconv.Atoi(deliveryStr)
-			}
-			if pickupStr, ok := info["pickup_plan"]; ok && pickupStr != "" {
-				pickupPlan, _ = strconv.Atoi(pickupStr)
-			}
-			// Если оба плана найдены в Redis - возвращаем их
-			if deliveryPlan > 0 || pickupPlan > 0 {
-				return deliveryPlan, pickupPlan, nil
-			}
-		}
+	// 1. Кэш
+	if deliveryPlan, pickupPlan, ok := ss.cachedSlotPlan(slotID); ok {
+		return deliveryPlan, pickupPlan, nil
 	}
-	
-	// 2. Если в Redis нет или планы = 0, загружаем из PostgreSQL
-	if ss.db != nil {
-		var result struct {
-			DeliveryPlan int `gorm:"column:delivery_plan"`
-			PickupPlan   int `gorm:"column:pickup_plan"`
-		}
-		
-		if err := ss.db.Raw("SELECT delivery_plan, pickup_plan FROM slot_plans WHERE slot_id = ?", slotID).Scan(&result).Error; err == nil {
-			// Если нашли в БД - обновляем Redis кэш и возвращаем
-			if result.DeliveryPlan > 0 || result.PickupPlan > 0 {
-				deliveryPlan = result.DeliveryPlan
-				pickupPlan = result.PickupPlan
-				
-				// Обновляем Redis кэш для следующего раза
-				if ss.redisUtil != nil && ss.client != nil {
-					ctx := ss.redisUtil.Context()
-					slotKey := fmt.Sprintf("slot:%s:info", slotID)
-					ss.client.HSet(ctx, slotKey, "delivery_plan", strconv.Itoa(deliveryPlan))
-					ss.client.HSet(ctx, slotKey, "pickup_plan", strconv.Itoa(pickupPlan))
-					ss.client.Expire(ctx, slotKey, 24*time.Hour)
-				}
-				
-				return deliveryPlan, pickupPlan, nil
-			}
+
+	// 2. Без PostgreSQL кэш - единственное хранилище: плана нет (это нормально для новых слотов)
+	if ss.db == nil {
+		return 0, 0, nil
+	}
+	if ss.redisUtil == nil || ss.client == nil {
+		deliveryPlan, pickupPlan, _, err = ss.loadSlotPlan(slotID)
+		return deliveryPlan, pickupPlan, err
+	}
+
+	// 3. PostgreSQL + заполнение кэша
+	ctx := ss.redisUtil.Context()
+	slotKey := rediskeys.SlotInfoKey(slotID)
+	var dbErr error
+	watchErr := ss.client.Watch(ctx, func(tx *redis.Tx) error {
+		var found bool
+		deliveryPlan, pickupPlan, found, dbErr = ss.loadSlotPlan(slotID)
+		if dbErr != nil || !found {
+			return dbErr
 		}
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, slotKey, "delivery_plan", strconv.Itoa(deliveryPlan), "pickup_plan", strconv.Itoa(pickupPlan))
+			pipe.Expire(ctx, slotKey, rediskeys.SlotMetaTTL())
+			return nil
+		})
+		return err
+	}, slotKey)
+	if dbErr != nil {
+		return 0, 0, dbErr
 	}
-	
-	// 3. Если ни в Redis, ни в БД нет - возвращаем 0, 0 (это нормально для новых слотов)
-	return 0, 0, nil
+	if errors.Is(watchErr, redis.TxFailedErr) {
+		// План поменялся во время чтения - берем свежий из БД, кэш заполнит следующий вызов
+		deliveryPlan, pickupPlan, _, err = ss.loadSlotPlan(slotID)
+		return deliveryPlan, pickupPlan, err
+	}
+	if watchErr != nil {
+		log.Printf("⚠️ Не удалось обновить кэш плана слота %s: %v", slotID, watchErr)
+	}
+	return deliveryPlan, pickupPlan, nil
 }
 
 // GetSlotMaxCapacity получает максимальную емкость слота (индивидуальную или общую)
@@ -289,7 +491,7 @@ func (ss *SlotService) GetSlotMaxCapacity(slotID string) int {
 		return ss.maxCapacityPerSlot
 	}
 	
-	key := fmt.Sprintf("slot:%s:max_capacity", slotID)
+	key := rediskeys.SlotMaxCapacityKey(slotID)
 	
 	capacityStr, err := ss.redisUtil.Get(key)
 	if err != nil {
@@ -310,6 +512,15 @@ func (ss *SlotService) GenerateSlotID(startTime time.Time) string {
 	return ss.generateSlotID(startTime)
 }
 
+// SlotBounds возвращает начало и конец слота по его ID (slot:<unix>); false - ID не в формате generateSlotID
+func (ss *SlotService) SlotBounds(slotID string) (time.Time, time.Time, bool) {
+	start, ok := parseSlotStartTime(slotID)
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	return start, start.Add(ss.slotDuration), true
+}
+
 // generateSlotID генерирует ID слота на основе времени начала
 // ВАЖНО: ID не должен зависеть от формата времени или часового пояса
 // Используем Unix timestamp для уникальности и независимости от формата
@@ -351,18 +562,33 @@ func (ss *SlotService) getSlotStartTime(now time.Time) time.Time {
 // AssignSlot атомарно бронирует место в слоте через Redis
 // orderPrice - сумма заказа в рублях (используется для расчета загрузки слота)
 // itemsCount - количество элементов в заказе (для расчета времени подготовки)
+// branchID - филиал, чей prep_lead_minutes определяет время показа заказа (может быть пустым)
 // Возвращает ID слота, время начала слота, время показа заказа и ошибку
-func (ss *SlotService) AssignSlot(orderID string, orderPrice int, itemsCount int) (string, time.Time, time.Time, error) {
+// Идемпотентна: если заказ уже держит слот (order:slot:{id}), повторно место не бронируется
+func (ss *SlotService) AssignSlot(orderID string, orderPrice int, itemsCount int, branchID string) (string, time.Time, time.Time, error) {
+	return ss.assignSlot(orderID, orderPrice, itemsCount, branchID, time.Time{})
+}
+
+// assignSlot - AssignSlot, рассматривающий только слоты, которые начинаются не раньше notBefore (нулевое - без ограничения)
+func (ss *SlotService) assignSlot(orderID string, orderPrice int, itemsCount int, branchID string, notBefore time.Time) (string, time.Time, time.Time, error) {
 	if ss.redisUtil == nil {
-		return "", time.Time{}, time.Time{}, fmt.Errorf("Redis client not initialized")
+		return "", time.Time{}, time.Time{}, ErrRedisUnavailable
 	}
 
 	ctx := ss.redisUtil.Context()
+
+	// Повторная обработка того же заказа (ретрай клиента, повторное чтение из Kafka после рестарта)
+	// не должна занимать второе место в слоте
+	if slotID, slotStart, ok := ss.getAssignedSlot(orderID); ok {
+		log.Printf("ℹ️ AssignSlot: заказ %s уже назначен на слот %s, повторное бронирование пропущено", orderID, slotID)
+		visibleAt := calculateVisibleAt(slotStart, ss.clock.Now().UTC(), ss.GetPrepLeadTime(branchID))
+		return slotID, slotStart, visibleAt, nil
+	}
 	
 	// ВАЖНО: Загружаем актуальное значение maxCapacity из Redis перед каждым использованием
 	// Это гарантирует, что мы используем последнее установленное значение
 	if ss.client != nil {
-		savedCapacity, err := ss.client.Get(ctx, "slot:config:max_capacity").Int()
+		savedCapacity, err := ss.client.Get(ctx, rediskeys.SlotConfigMaxCapacityKey).Int()
 		if err == nil && savedCapacity > 0 {
 			if savedCapacity != ss.maxCapacityPerSlot {
 				log.Printf("🔄 AssignSlot: обновлено maxCapacity из Redis: %d₽ -> %d₽", 
@@ -373,19 +599,13 @@ func (ss *SlotService) AssignSlot(orderID string, orderPrice int, itemsCount int
 	}
 	
 	// Используем UTC для всех временных операций
-	now := time.Now().UTC()
+	now := ss.clock.Now().UTC()
 	
-	// Начинаем с ближайшего будущего слота
-	slotStart := ss.getSlotStartTime(now)
-	
-	// ПРОВЕРКА БЛИЖНЯКА:
-	// Если до конца текущего слота осталось меньше 8 минут,
-	// повар физически не успеет. Перелетаем сразу на следующий.
-	currentSlotEnd := slotStart.Add(ss.slotDuration)
-	timeUntilSlotEnd := currentSlotEnd.Sub(now)
-	
-	if timeUntilSlotEnd < 8*time.Minute {
-		log.Printf("⚠️ AssignSlot: до конца текущего слота осталось %v (< 8 минут), перелетаем на следующий слот", timeUntilSlotEnd)
+	// Начинаем с ближайшего будущего слота (с учетом ближняка филиала)
+	slotStart := ss.firstSlotStart(now, branchID)
+
+	// Перенос заказа (MoveOrderToLaterSlot): более ранние слоты не рассматриваются
+	for slotStart.Before(notBefore) {
 		slotStart = slotStart.Add(ss.slotDuration)
 	}
 	
@@ -404,6 +624,7 @@ func (ss *SlotService) AssignSlot(orderID string, orderPrice int, itemsCount int
 			if isKitchenOpen && slotsChecked > 0 {
 				// Кухня была открыта, но все слоты заполнены
 				log.Printf("⚠️ AssignSlot: все слоты заполнены на сегодня (проверено %d слотов в рабочих часах)", slotsChecked)
+				ss.recordSlotRejection(orderID, orderPrice, branchID)
 				return "", time.Time{}, time.Time{}, status.Error(codes.ResourceExhausted, "All slots are full for today")
 			}
 			// Кухня закрыта
@@ -420,6 +641,7 @@ func (ss *SlotService) AssignSlot(orderID string, orderPrice int, itemsCount int
 			if isKitchenOpen && slotsChecked > 0 {
 				// Кухня была открыта, но все слоты заполнены
 				log.Printf("⚠️ AssignSlot: все слоты заполнены на сегодня (проверено %d слотов в рабочих часах)", slotsChecked)
+				ss.recordSlotRejection(orderID, orderPrice, branchID)
 				return "", time.Time{}, time.Time{}, status.Error(codes.ResourceExhausted, "All slots are full for today")
 			}
 			// Кухня закрыта
@@ -433,6 +655,7 @@ func (ss *SlotService) AssignSlot(orderID string, orderPrice int, itemsCount int
 			if isKitchenOpen && slotsChecked > 0 {
 				// Кухня была открыта, но все слоты заполнены
 				log.Printf("⚠️ AssignSlot: все слоты заполнены на сегодня (проверено %d слотов в рабочих часах)", slotsChecked)
+				ss.recordSlotRejection(orderID, orderPrice, branchID)
 				return "", time.Time{}, time.Time{}, status.Error(codes.ResourceExhausted, "All slots are full for today")
 			}
 			// Кухня закрыта
@@ -452,8 +675,9 @@ func (ss *SlotService) AssignSlot(orderID string, orderPrice int, itemsCount int
 			continue
 		}
 		
-		// Получаем индивидуальный лимит слота или общий
+		// Получаем индивидуальный лимит слота или общий и потолок с учетом овербукинга
 		maxCapacity := ss.GetSlotMaxCapacity(slotID)
+		ceiling := ss.effectiveCapacity(maxCapacity)
 		
 		// Используем Redis Lua script для атомарной операции
 		// Это гарантирует, что только один заказ сможет занять последнее место
@@ -461,12 +685,20 @@ func (ss *SlotService) AssignSlot(orderID string, orderPrice int, itemsCount int
 		luaScript := `
 			local slot_key = KEYS[1]
 			local order_key = KEYS[2]
-			local max_capacity = tonumber(ARGV[1])  -- Максимальная сумма в рублях (индивидуальная или общая)
+			local ceiling = tonumber(ARGV[1])  -- Потолок в рублях: емкость слота + овербукинг
 			local slot_id = ARGV[2]
 			local order_id = ARGV[3]
 			local order_price = tonumber(ARGV[4])  -- Сумма текущего заказа
 			local slot_start = ARGV[5]
 			local slot_end = ARGV[6]
+			local max_capacity = tonumber(ARGV[7])  -- Номинальная емкость (индивидуальная или общая)
+			local history_ttl = tonumber(ARGV[8])  -- TTL истории слота в секундах (rediskeys.SlotHistoryTTL)
+			
+			-- Заказ уже держит слот (параллельный повтор) - второе место не бронируем
+			local assigned_slot = redis.call('HGET', order_key, 'slot_id')
+			if assigned_slot then
+				return {2, assigned_slot}
+			end
 			
 			-- Получаем текущую загрузку слота (сумма в рублях)
 			local current_load = redis.call('GET', slot_key)
@@ -477,14 +709,14 @@ func (ss *SlotService) AssignSlot(orderID string, orderPrice int, itemsCount int
 			end
 			
 			-- Проверяем, есть ли место (по сумме, а не по количеству!)
-			if current_load + order_price > max_capacity then
+			if current_load + order_price > ceiling then
 				return {0, current_load} -- Слот переполнен (не хватает места по сумме)
 			end
 			
 			-- Атомарно увеличиваем сумму слота на сумму заказа
-			-- КРИТИЧНО: TTL увеличен до 2 часов (7200 сек) для сохранения истории прошедших слотов
+			-- КРИТИЧНО: TTL (по умолчанию 2 часа) сохраняет историю прошедших слотов
 			redis.call('INCRBY', slot_key, order_price)
-			redis.call('EXPIRE', slot_key, 7200) -- TTL 2 часа для истории
+			redis.call('EXPIRE', slot_key, history_ttl)
 			
 			-- Сохраняем информацию о слоте (если еще не сохранена)
 			local slot_info_key = slot_key .. ':info'
@@ -493,39 +725,40 @@ func (ss *SlotService) AssignSlot(orderID string, orderPrice int, itemsCount int
 					'start_time', slot_start,
 					'end_time', slot_end,
 					'max_capacity', max_capacity)
-				redis.call('EXPIRE', slot_info_key, 7200) -- TTL 2 часа для истории
+				redis.call('EXPIRE', slot_info_key, history_ttl)
 			end
 			
 			-- Сохраняем связь заказ -> слот и сумму заказа
-			-- КРИТИЧНО: TTL увеличен до 2 часов для сохранения истории
 			redis.call('HSET', order_key, 'slot_id', slot_id, 'price', order_price)
-			redis.call('EXPIRE', order_key, 7200) -- TTL 2 часа для истории
+			redis.call('EXPIRE', order_key, history_ttl)
 			
 			-- Добавляем заказ в список заказов слота
 			redis.call('SADD', slot_key .. ':orders', order_id)
-			redis.call('EXPIRE', slot_key .. ':orders', 7200) -- TTL 2 часа для истории
+			redis.call('EXPIRE', slot_key .. ':orders', history_ttl)
 			
 			return {1, current_load + order_price} -- Успех, возвращаем новую сумму
 		`
 		
-		slotKey := fmt.Sprintf("slot:%s", slotID)
-		orderSlotKey := fmt.Sprintf("order:slot:%s", orderID)
+		slotKey := rediskeys.SlotKey(slotID)
+		orderSlotKey := rediskeys.OrderSlotKey(orderID)
 		slotEnd := slotStart.Add(ss.slotDuration)
 		
 		if ss.client == nil {
-			return "", time.Time{}, time.Time{}, fmt.Errorf("Redis client not available for Lua scripts")
+			return "", time.Time{}, time.Time{}, ErrRedisUnavailable
 		}
 		
 		result, err := ss.client.Eval(ctx, luaScript, []string{
 			slotKey,
 			orderSlotKey,
 		}, []interface{}{
-			maxCapacity,                  // Максимальная сумма в рублях (индивидуальная или общая)
+			ceiling,                      // Потолок загрузки в рублях (емкость + овербукинг)
 			slotID,
 			orderID,
 			orderPrice,                   // Сумма заказа в рублях
 			slotStart.Format(time.RFC3339),
 			slotEnd.Format(time.RFC3339),
+			maxCapacity,                  // Номинальная емкость (индивидуальная или общая)
+			int64(rediskeys.SlotHistoryTTL().Seconds()),
 		}).Result()
 		
 		if err != nil {
@@ -552,28 +785,28 @@ func (ss *SlotService) AssignSlot(orderID string, orderPrice int, itemsCount int
 		}
 		
 		success, _ := resultArray[0].(int64)
+		if success == 2 {
+			// Слот был назначен параллельным вызовом для того же заказа
+			assignedSlotID, _ := resultArray[1].(string)
+			if assignedStart, ok := parseSlotStartTime(assignedSlotID); ok {
+				log.Printf("ℹ️ AssignSlot: заказ %s уже назначен на слот %s, повторное бронирование пропущено", orderID, assignedSlotID)
+				return assignedSlotID, assignedStart, calculateVisibleAt(assignedStart, now, ss.GetPrepLeadTime(branchID)), nil
+			}
+			return "", time.Time{}, time.Time{}, fmt.Errorf("заказ %s уже назначен на слот с некорректным ID '%s'", orderID, assignedSlotID)
+		}
 		currentLoad, _ := resultArray[1].(int64)
 		if success == 1 {
 			// РАСЧЕТ VISIBLE_AT:
-			// Заказ должен появиться на планшете за 30 минут до начала слота.
-			// НО: если это "ближняк" (до начала слота < 30 минут), показываем с начала слота.
-			prepTimeBeforeSlot := 30 * time.Minute
-			timeUntilSlotStart := slotStart.Sub(now)
-			
-			var visibleAt time.Time
-			if timeUntilSlotStart >= prepTimeBeforeSlot {
-				// Достаточно времени - показываем за 30 минут до начала слота
-				visibleAt = slotStart.Add(-prepTimeBeforeSlot)
-			} else {
-				// Ближняк - показываем с начала слота
-				visibleAt = slotStart
-			}
+			// Заказ должен появиться на планшете за prep_lead_minutes филиала до начала слота.
+			// НО: если это "ближняк" (до начала слота меньше этого времени), показываем с начала слота.
+			visibleAt := calculateVisibleAt(slotStart, now, ss.GetPrepLeadTime(branchID))
 			
 			// Успешно забронировали место! Логируем только успешные назначения
 			if attempt > 0 {
 				log.Printf("✅ AssignSlot: заказ %s (сумма: %d₽) назначен на слот %s после %d попыток (загрузка: %d₽/%d₽)", 
-					orderID, orderPrice, slotID, attempt+1, currentLoad, ss.maxCapacityPerSlot)
+					orderID, orderPrice, slotID, attempt+1, currentLoad, ceiling)
 			}
+			ss.recordSlotResult(models.SlotOutcomeAssigned, slotID, slotStart, orderID, orderPrice, int(currentLoad), maxCapacity, branchID)
 			return slotID, slotStart, visibleAt, nil
 		}
 		
@@ -581,9 +814,10 @@ func (ss *SlotService) AssignSlot(orderID string, orderPrice int, itemsCount int
 		// Логируем только каждую 50-ю попытку, чтобы не засорять логи
 		if failedAttempts%50 == 0 {
 			log.Printf("✅ [Successful Overload Prevention] Слот %s переполнен: %d₽/%d₽ (попытка #%d)", 
-				slotID, currentLoad, ss.maxCapacityPerSlot, attempt+1)
+				slotID, currentLoad, ceiling, attempt+1)
 		}
 		failedAttempts++
+		ss.recordSlotResult(models.SlotOutcomeOverflow, slotID, slotStart, orderID, orderPrice, int(currentLoad), maxCapacity, branchID)
 		
 		// Jitter backoff для уменьшения contention при высокой нагрузке
 		jitter := time.Duration(rand.Intn(10)) * time.Millisecond
@@ -597,6 +831,7 @@ func (ss *SlotService) AssignSlot(orderID string, orderPrice int, itemsCount int
 	if isKitchenOpen && slotsChecked > 0 {
 		// Кухня была открыта, но все слоты заполнены
 		log.Printf("⚠️ AssignSlot: все слоты заполнены на сегодня (проверено %d слотов в рабочих часах)", slotsChecked)
+		ss.recordSlotRejection(orderID, orderPrice, branchID)
 		return "", time.Time{}, time.Time{}, status.Error(codes.ResourceExhausted, "All slots are full for today")
 	}
 	
@@ -604,17 +839,42 @@ func (ss *SlotService) AssignSlot(orderID string, orderPrice int, itemsCount int
 	return "", time.Time{}, time.Time{}, fmt.Errorf("все слоты переполнены, попробуйте позже")
 }
 
+// getAssignedSlot возвращает слот, который уже забронирован за заказом (order:slot:{id})
+func (ss *SlotService) getAssignedSlot(orderID string) (string, time.Time, bool) {
+	if ss.client == nil {
+		return "", time.Time{}, false
+	}
+	slotID, err := ss.client.HGet(ss.redisUtil.Context(), rediskeys.OrderSlotKey(orderID), "slot_id").Result()
+	if err != nil || slotID == "" {
+		return "", time.Time{}, false
+	}
+	slotStart, ok := parseSlotStartTime(slotID)
+	if !ok {
+		return "", time.Time{}, false
+	}
+	return slotID, slotStart, true
+}
+
+// parseSlotStartTime восстанавливает время начала слота из его ID (slot:<unix>, см. generateSlotID)
+func parseSlotStartTime(slotID string) (time.Time, bool) {
+	var unix int64
+	if _, err := fmt.Sscanf(slotID, "slot:%d", &unix); err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0).UTC(), true
+}
+
 // GetSlotInfo получает информацию о слоте (базовая версия, использует только Redis counter)
 func (ss *SlotService) GetSlotInfo(slotID string) (*SlotInfo, error) {
 	if ss.redisUtil == nil {
-		return nil, fmt.Errorf("Redis client not initialized")
+		return nil, ErrRedisUnavailable
 	}
 
 	ctx := ss.redisUtil.Context()
-	slotKey := fmt.Sprintf("slot:%s", slotID)
+	slotKey := rediskeys.SlotKey(slotID)
 	
 	if ss.client == nil {
-		return nil, fmt.Errorf("Redis client not available")
+		return nil, ErrRedisUnavailable
 	}
 	
 	// Получаем текущую загрузку из Slot Counter (сумма в рублях)
@@ -626,6 +886,8 @@ func (ss *SlotService) GetSlotInfo(slotID string) (*SlotInfo, error) {
 			SlotID:      slotID,
 			CurrentLoad: 0,
 			MaxCapacity: maxCapacity,
+			EffectiveCapacity: ss.effectiveCapacity(maxCapacity),
+			OverbookingPercent: ss.GetOverbookingPercent(),
 			Disabled:    ss.IsSlotDisabled(slotID),
 			Orders:      make([]OrderInfo, 0),
 		}, nil
@@ -658,6 +920,8 @@ func (ss *SlotService) GetSlotInfo(slotID string) (*SlotInfo, error) {
 		EndTime:     endTime,
 		CurrentLoad: int(currentLoad),
 		MaxCapacity: maxCapacity,
+		EffectiveCapacity: ss.effectiveCapacity(maxCapacity),
+		OverbookingPercent: ss.GetOverbookingPercent(),
 		Orders:      make([]OrderInfo, 0),
 		Disabled:    ss.IsSlotDisabled(slotID),
 	}, nil
@@ -676,14 +940,15 @@ func (ss *SlotService) GetSlotInfo(slotID string) (*SlotInfo, error) {
 //    - erp:orders:active - активные заказы на KDS
 // 3. Итоговая загрузка = базовая загрузка (если > 0) или сумма pending + active заказов
 //
-// ВАЖНО: Slot Counter сохраняется в Redis с TTL 2 часа для истории прошедших слотов
+// ВАЖНО: Slot Counter сохраняется в Redis на SlotHistoryTTL (REDIS_SLOT_HISTORY_TTL_MINUTES, по умолчанию 2 часа),
+// итог закончившегося слота переносится в slot_history (см. ArchiveEndedSlots)
 func (ss *SlotService) GetSlotInfoWithOrders(slotID string, slotStart, slotEnd time.Time) (*SlotInfo, error) {
 	if ss.redisUtil == nil || ss.client == nil {
-		return nil, fmt.Errorf("Redis client not initialized")
+		return nil, ErrRedisUnavailable
 	}
 
 	ctx := ss.redisUtil.Context()
-	slotKey := fmt.Sprintf("slot:%s", slotID)
+	slotKey := rediskeys.SlotKey(slotID)
 	
 	// 1. Получаем базовую загрузку из Slot Counter (это сумма всех заказов, когда-либо назначенных на слот)
 	baseLoad, err := ss.client.Get(ctx, slotKey).Int64()
@@ -710,16 +975,16 @@ func (ss *SlotService) GetSlotInfoWithOrders(slotID string, slotStart, slotEnd t
 		// Проверяем каждый заказ: pending или active?
 		for _, orderID := range orderIDs {
 			// Проверяем, находится ли заказ в pending_slots
-			isPending, _ := ss.redisUtil.SIsMember("erp:orders:pending_slots", orderID)
+			isPending, _ := ss.redisUtil.SIsMember(rediskeys.OrdersPendingSlotsKey, orderID)
 			// Проверяем, находится ли заказ в active
-			isActive, _ := ss.redisUtil.SIsMember("erp:orders:active", orderID)
+			isActive, _ := ss.redisUtil.SIsMember(rediskeys.OrdersActiveKey, orderID)
 			
 			// Считаем заказ только если он pending или active
 			if isPending || isActive {
 				ordersCount++
 				
 				// Получаем полную информацию о заказе для определения типа доставки
-				orderKey := "erp:order:" + orderID
+				orderKey := rediskeys.OrderKey(orderID)
 				orderBytes, err := ss.redisUtil.GetBytes(orderKey)
 				isPickup := false
 				if err == nil {
@@ -754,7 +1019,7 @@ func (ss *SlotService) GetSlotInfoWithOrders(slotID string, slotStart, slotEnd t
 				}
 				
 				// Получаем сумму заказа
-				orderSlotKey := fmt.Sprintf("order:slot:%s", orderID)
+				orderSlotKey := rediskeys.OrderSlotKey(orderID)
 				orderInfo, err := ss.client.HGetAll(ctx, orderSlotKey).Result()
 				orderTotal := 0
 				if err == nil {
@@ -820,6 +1085,8 @@ func (ss *SlotService) GetSlotInfoWithOrders(slotID string, slotStart, slotEnd t
 			EndTime:       slotEnd,
 			CurrentLoad:   int(totalLoad),
 			MaxCapacity:   maxCapacity,
+			EffectiveCapacity: ss.effectiveCapacity(maxCapacity),
+			OverbookingPercent: ss.GetOverbookingPercent(),
 			Disabled:      ss.IsSlotDisabled(slotID),
 			OrdersCount:   ordersCount,
 			DeliveryCount: deliveryCount,
@@ -849,6 +1116,8 @@ func (ss *SlotService) GetSlotInfoWithOrders(slotID string, slotStart, slotEnd t
 		EndTime:       endTime,
 		CurrentLoad:   int(totalLoad),
 		MaxCapacity:   maxCapacity,
+		EffectiveCapacity: ss.effectiveCapacity(maxCapacity),
+		OverbookingPercent: ss.GetOverbookingPercent(),
 		Disabled:      ss.IsSlotDisabled(slotID),
 		OrdersCount:   ordersCount,
 		DeliveryCount: deliveryCount,
@@ -860,14 +1129,14 @@ func (ss *SlotService) GetSlotInfoWithOrders(slotID string, slotStart, slotEnd t
 // ReleaseSlot освобождает место в слоте (если заказ отменен)
 func (ss *SlotService) ReleaseSlot(orderID string) error {
 	if ss.redisUtil == nil {
-		return fmt.Errorf("Redis client not initialized")
+		return ErrRedisUnavailable
 	}
 
 	ctx := ss.redisUtil.Context()
-	orderSlotKey := fmt.Sprintf("order:slot:%s", orderID)
+	orderSlotKey := rediskeys.OrderSlotKey(orderID)
 	
 	if ss.client == nil {
-		return fmt.Errorf("Redis client not available")
+		return ErrRedisUnavailable
 	}
 	
 	// Получаем ID слота и сумму заказа для этого заказа
@@ -890,7 +1159,7 @@ func (ss *SlotService) ReleaseSlot(orderID string) error {
 		fmt.Sscanf(orderPriceStr, "%d", &orderPrice)
 	}
 	
-	slotKey := fmt.Sprintf("slot:%s", slotID)
+	slotKey := rediskeys.SlotKey(slotID)
 	
 	// Атомарно уменьшаем сумму слота на сумму заказа и удаляем заказ из списка
 	luaScript := `
@@ -932,20 +1201,109 @@ func (ss *SlotService) ReleaseSlot(orderID string) error {
 	}
 	
 	log.Printf("✅ SlotService: место в слоте %s освобождено для заказа %s", slotID, orderID)
+	if slotStart, ok := parseSlotStartTime(slotID); ok {
+		ss.recordSlotResult(models.SlotOutcomeReleased, slotID, slotStart, orderID, orderPrice, 0, 0, "")
+	}
 	return nil
 }
 
+// ErrSlotOverflow возвращается, если после изменения заказа сумма слота превысит лимит
+var ErrSlotOverflow = errors.New("слот переполнен")
+
+// AdjustSlotLoad пересчитывает загрузку слота после изменения суммы заказа (редактирование позиций)
+// Атомарно применяет разницу между новой и прежней суммой заказа к счетчику slot:{id}
+// Увеличение, которое переполняет слот, отклоняется с ErrSlotOverflow. Возвращает ID слота и новую загрузку
+func (ss *SlotService) AdjustSlotLoad(orderID string, newPrice int) (string, int, error) {
+	if ss.redisUtil == nil || ss.client == nil {
+		return "", 0, ErrRedisUnavailable
+	}
+
+	ctx := ss.redisUtil.Context()
+	orderSlotKey := rediskeys.OrderSlotKey(orderID)
+
+	slotID, err := ss.client.HGet(ctx, orderSlotKey, "slot_id").Result()
+	if err == redis.Nil || slotID == "" {
+		return "", 0, fmt.Errorf("заказ %s не назначен на слот", orderID)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	slotKey := rediskeys.SlotKey(slotID)
+
+	// Разница считается внутри скрипта: параллельное редактирование не потеряет изменения
+	luaScript := `
+		local slot_key = KEYS[1]
+		local order_key = KEYS[2]
+		local slot_id = ARGV[1]
+		local new_price = tonumber(ARGV[2])
+		local ceiling = tonumber(ARGV[3])
+		
+		-- Заказ мог быть перенесен или отменен между HGET и скриптом
+		if redis.call('HGET', order_key, 'slot_id') ~= slot_id then
+			return {-1, 0}
+		end
+		
+		local old_price = tonumber(redis.call('HGET', order_key, 'price') or '0')
+		local current_load = tonumber(redis.call('GET', slot_key) or '0')
+		local delta = new_price - old_price
+		
+		-- Уменьшение суммы разрешено всегда, увеличение - только в пределах лимита с овербукингом
+		if delta > 0 and current_load + delta > ceiling then
+			return {0, current_load}
+		end
+		
+		local new_load = current_load + delta
+		if new_load < 0 then
+			new_load = 0
+		end
+		redis.call('SET', slot_key, new_load, 'KEEPTTL')
+		redis.call('HSET', order_key, 'price', new_price)
+		
+		return {1, new_load}
+	`
+
+	result, err := ss.client.Eval(ctx, luaScript, []string{
+		slotKey,
+		orderSlotKey,
+	}, []interface{}{
+		slotID,
+		newPrice,
+		ss.effectiveCapacity(ss.GetSlotMaxCapacity(slotID)),
+	}).Result()
+	if err != nil {
+		return "", 0, fmt.Errorf("ошибка пересчета загрузки слота: %w", err)
+	}
+
+	resultArray, ok := result.([]interface{})
+	if !ok || len(resultArray) < 2 {
+		return "", 0, fmt.Errorf("неожиданный результат от Lua script: %v", result)
+	}
+	outcome, _ := resultArray[0].(int64)
+	load, _ := resultArray[1].(int64)
+
+	switch outcome {
+	case -1:
+		return "", 0, fmt.Errorf("заказ %s больше не назначен на слот %s", orderID, slotID)
+	case 0:
+		return slotID, int(load), fmt.Errorf("%w: загрузка %d₽, лимит %d₽", ErrSlotOverflow, load, ss.effectiveCapacity(ss.GetSlotMaxCapacity(slotID)))
+	}
+
+	log.Printf("✅ SlotService: загрузка слота %s пересчитана после изменения заказа %s: %d₽", slotID, orderID, load)
+	return slotID, int(load), nil
+}
+
 // GetAllSlots получает информацию о ВСЕХ слотах (включая прошедшие, текущие и будущие)
 // КРИТИЧНО: Возвращает слоты только в рабочих часах (openHour:openMin - closeHour:closeMin)
 // Включает прошедшие слоты для истории (минимум 1-2 часа назад)
 // ВАЖНО: Все времена в UTC, клиент сам конвертирует в свой часовой пояс
 func (ss *SlotService) GetAllSlots() ([]*SlotInfo, error) {
 	if ss.redisUtil == nil || ss.client == nil {
-		return nil, fmt.Errorf("Redis client not initialized")
+		return nil, ErrRedisUnavailable
 	}
 
 	// Используем UTC для всех временных операций
-	now := time.Now().UTC()
+	now := ss.clock.Now().UTC()
 	slots := make([]*SlotInfo, 0)
 
 	// Начинаем с начала рабочего дня (openHour:openMin) для показа истории
@@ -953,8 +1311,8 @@ func (ss *SlotService) GetAllSlots() ([]*SlotInfo, error) {
 	// Определяем конец рабочего дня (closeHour:closeMin)
 	endOfDay := time.Date(now.Year(), now.Month(), now.Day(), ss.closeHour, ss.closeMin, 0, 0, time.UTC)
 	
-	// Также включаем слоты за последние 2 часа для истории
-	historyStart := now.Add(-2 * time.Hour)
+	// Также включаем слоты, история которых еще хранится в Redis (SlotHistoryTTL, по умолчанию 2 часа)
+	historyStart := now.Add(-rediskeys.SlotHistoryTTL())
 	if historyStart.Before(startOfDay) {
 		historyStart = startOfDay
 	}
@@ -1015,6 +1373,8 @@ func (ss *SlotService) GetAllSlots() ([]*SlotInfo, error) {
 				EndTime:       slotEnd,
 				CurrentLoad:   0,
 				MaxCapacity:   maxCapacity,
+				EffectiveCapacity: ss.effectiveCapacity(maxCapacity),
+				OverbookingPercent: ss.GetOverbookingPercent(),
 				Disabled:      ss.IsSlotDisabled(slotID),
 				OrdersCount:   0,
 				DeliveryCount: 0,
@@ -1030,6 +1390,8 @@ func (ss *SlotService) GetAllSlots() ([]*SlotInfo, error) {
 			slotInfo.SlotID = slotID
 			// Обновляем индивидуальный лимит и disabled статус
 			slotInfo.MaxCapacity = ss.GetSlotMaxCapacity(slotID)
+			slotInfo.EffectiveCapacity = ss.effectiveCapacity(slotInfo.MaxCapacity)
+			slotInfo.OverbookingPercent = ss.GetOverbookingPercent()
 			slotInfo.Disabled = ss.IsSlotDisabled(slotID)
 			
 			// КРИТИЧНО: Убеждаемся, что планы загружены из Redis/БД
@@ -1073,3 +1435,65 @@ func (ss *SlotService) GetAllSlots() ([]*SlotInfo, error) {
 
 	return slots, nil
 }
+
+// SlotOrderLoad - заказ, занимающий место в слоте (сумма заказа в рублях)
+type SlotOrderLoad struct {
+	OrderID string
+	SlotID  string
+	Price   int
+}
+
+// RestoreSlotLoads перезаписывает загрузку слотов по списку заказов: slot:{id} = сумма заказов,
+// slot:{id}:orders, slot:{id}:info и связи order:slot:{id}. Слоты, которых нет в списке, не трогаются.
+// Используется при пересборке состояния из PostgreSQL; бронирования, сделанные во время пересборки,
+// в загрузку не попадут - возвращает количество восстановленных слотов
+func (ss *SlotService) RestoreSlotLoads(loads []SlotOrderLoad) (int, error) {
+	if ss.redisUtil == nil || ss.client == nil {
+		return 0, ErrRedisUnavailable
+	}
+
+	bySlot := make(map[string][]SlotOrderLoad)
+	for _, load := range loads {
+		if load.SlotID == "" {
+			continue
+		}
+		bySlot[load.SlotID] = append(bySlot[load.SlotID], load)
+	}
+
+	ctx := ss.redisUtil.Context()
+	historyTTL := rediskeys.SlotHistoryTTL()
+	_, err := ss.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for slotID, orders := range bySlot {
+			total := 0
+			orderIDs := make([]interface{}, 0, len(orders))
+			for _, order := range orders {
+				total += order.Price
+				orderIDs = append(orderIDs, order.OrderID)
+				orderSlotKey := rediskeys.OrderSlotKey(order.OrderID)
+				pipe.HSet(ctx, orderSlotKey, "slot_id", slotID, "price", order.Price)
+				pipe.Expire(ctx, orderSlotKey, historyTTL)
+			}
+
+			slotKey := rediskeys.SlotKey(slotID)
+			pipe.Set(ctx, slotKey, total, historyTTL)
+			ordersKey := rediskeys.SlotOrdersKey(slotID)
+			pipe.Del(ctx, ordersKey)
+			pipe.SAdd(ctx, ordersKey, orderIDs...)
+			pipe.Expire(ctx, ordersKey, historyTTL)
+
+			if slotStart, ok := parseSlotStartTime(slotID); ok {
+				infoKey := rediskeys.SlotInfoKey(slotID)
+				pipe.HSet(ctx, infoKey,
+					"start_time", slotStart.Format(time.RFC3339),
+					"end_time", slotStart.Add(ss.slotDuration).Format(time.RFC3339),
+					"max_capacity", ss.GetSlotMaxCapacity(slotID))
+				pipe.Expire(ctx, infoKey, historyTTL)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("ошибка восстановления загрузки слотов: %w", err)
+	}
+	return len(bySlot), nil
+}
@@ -0,0 +1,450 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils/rediskeys"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Рабочие часы тестов: 10:00 - 22:00 UTC, слоты по 15 минут
+const (
+	testOpenHour  = 10
+	testCloseHour = 22
+)
+
+// testTime - момент тестового дня (далекая дата, чтобы ключи слотов не пересекались с реальными)
+func testTime(hour, min, sec int) time.Time {
+	return time.Date(2030, time.January, 15, hour, min, sec, 0, time.UTC)
+}
+
+// newTestSlotService создает SlotService без Redis и PostgreSQL
+func newTestSlotService(clock Clock) *SlotService {
+	return NewSlotService(nil, nil, testOpenHour, 0, testCloseHour, 0, clock)
+}
+
+// newRedisSlotService создает SlotService на тестовом Redis (newTestRedis); без TEST_REDIS_URL тест пропускается
+func newRedisSlotService(t *testing.T, clock Clock) *SlotService {
+	t.Helper()
+	return NewSlotService(newTestRedis(t), nil, testOpenHour, 0, testCloseHour, 0, clock)
+}
+
+func TestMockClockIsFrozen(t *testing.T) {
+	clock := NewMockClock(testTime(12, 0, 0))
+	if got := clock.Now(); !got.Equal(testTime(12, 0, 0)) {
+		t.Fatalf("Now() = %v, want %v", got, testTime(12, 0, 0))
+	}
+	clock.Advance(10 * time.Minute)
+	if got := clock.Now(); !got.Equal(testTime(12, 10, 0)) {
+		t.Fatalf("после Advance Now() = %v, want %v", got, testTime(12, 10, 0))
+	}
+}
+
+func TestGetSlotStartTimeReturnsNextSlot(t *testing.T) {
+	ss := newTestSlotService(NewMockClock(testTime(12, 0, 0)))
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{"ровно начало слота", testTime(12, 0, 0), testTime(12, 15, 0)},
+		{"середина слота", testTime(12, 7, 30), testTime(12, 15, 0)},
+		{"последняя секунда слота", testTime(12, 14, 59), testTime(12, 15, 0)},
+		{"переход через час", testTime(12, 50, 0), testTime(13, 0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ss.getSlotStartTime(tt.now); !got.Equal(tt.want) {
+				t.Errorf("getSlotStartTime(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsWithinWorkingHoursBoundaries(t *testing.T) {
+	ss := newTestSlotService(nil)
+
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		{testTime(9, 59, 0), false},
+		{testTime(10, 0, 0), true},
+		{testTime(21, 59, 0), true},
+		{testTime(22, 0, 0), true},
+		{testTime(22, 1, 0), false},
+	}
+	for _, tt := range tests {
+		if got := ss.isWithinWorkingHours(tt.at); got != tt.want {
+			t.Errorf("isWithinWorkingHours(%s) = %v, want %v", tt.at.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestCalculateVisibleAt(t *testing.T) {
+	slotStart := testTime(13, 0, 0)
+	prepLead := 30 * time.Minute
+
+	// Заказ заранее: показываем за prepLead до начала слота
+	if got := calculateVisibleAt(slotStart, testTime(12, 0, 0), prepLead); !got.Equal(testTime(12, 30, 0)) {
+		t.Errorf("заранее: visibleAt = %v, want %v", got, testTime(12, 30, 0))
+	}
+	// Ближняк: до слота меньше prepLead - показываем с начала слота
+	if got := calculateVisibleAt(slotStart, testTime(12, 50, 0), prepLead); !got.Equal(slotStart) {
+		t.Errorf("ближняк: visibleAt = %v, want %v", got, slotStart)
+	}
+}
+
+func TestAssignSlotJustBeforeClose(t *testing.T) {
+	clock := NewMockClock(testTime(21, 40, 0))
+	ss := newRedisSlotService(t, clock)
+
+	// 21:40 - последний слот дня (21:45) еще доступен
+	slotID, slotStart, _, err := ss.AssignSlot("order-before-close", 500, 1, "")
+	if err != nil {
+		t.Fatalf("AssignSlot в 21:40: %v", err)
+	}
+	if !slotStart.Equal(testTime(21, 45, 0)) {
+		t.Errorf("слот = %s (%v), want 21:45", slotID, slotStart)
+	}
+
+	// 21:50 - следующий слот начинается в момент закрытия, заказ не принимается
+	clock.Set(testTime(21, 50, 0))
+	_, _, _, err = ss.AssignSlot("order-after-last-slot", 500, 1, "")
+	if err == nil {
+		t.Fatal("AssignSlot в 21:50: ожидалась ошибка, кухня закрывается")
+	}
+	if status.Code(err) == codes.ResourceExhausted {
+		t.Errorf("AssignSlot в 21:50: ожидалась ошибка закрытия, а не переполнения: %v", err)
+	}
+}
+
+func TestAssignSlotInLastMinutesOfSlot(t *testing.T) {
+	// До конца текущего слота (12:00-12:15) осталось 5 минут
+	clock := NewMockClock(testTime(12, 10, 0))
+	ss := newRedisSlotService(t, clock)
+
+	_, slotStart, visibleAt, err := ss.AssignSlot("order-late-in-slot", 500, 1, "")
+	if err != nil {
+		t.Fatalf("AssignSlot: %v", err)
+	}
+	if !slotStart.Equal(testTime(12, 15, 0)) {
+		t.Errorf("слот начинается в %v, want 12:15 (текущий слот не назначается)", slotStart)
+	}
+	// До начала слота меньше prepLead (30 минут) - заказ виден сразу с начала слота
+	if !visibleAt.Equal(slotStart) {
+		t.Errorf("visibleAt = %v, want %v", visibleAt, slotStart)
+	}
+}
+
+func TestAssignSlotAllSlotsFull(t *testing.T) {
+	clock := NewMockClock(testTime(21, 20, 0))
+	ss := newRedisSlotService(t, clock)
+	ss.SetMaxCapacity(1000)
+
+	// До закрытия остаются два слота (21:30 и 21:45), каждый вмещает один заказ на 1000₽
+	want := []time.Time{testTime(21, 30, 0), testTime(21, 45, 0)}
+	for i, wantStart := range want {
+		_, slotStart, _, err := ss.AssignSlot("order-full-"+string(rune('a'+i)), 1000, 1, "")
+		if err != nil {
+			t.Fatalf("заказ #%d: %v", i+1, err)
+		}
+		if !slotStart.Equal(wantStart) {
+			t.Errorf("заказ #%d: слот %v, want %v", i+1, slotStart, wantStart)
+		}
+	}
+
+	_, _, _, err := ss.AssignSlot("order-full-rejected", 1000, 1, "")
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("третий заказ: ожидался ResourceExhausted, получено %v", err)
+	}
+}
+
+func TestEffectiveCapacityWithOverbooking(t *testing.T) {
+	ss := newTestSlotService(NewMockClock(testTime(12, 0, 0)))
+	if got := ss.effectiveCapacity(1000); got != 1000 {
+		t.Errorf("без овербукинга потолок = %d, want 1000", got)
+	}
+	ss.SetOverbookingPercent(10)
+	if got := ss.effectiveCapacity(1000); got != 1100 {
+		t.Errorf("овербукинг 10%%: потолок = %d, want 1100", got)
+	}
+	ss.SetOverbookingPercent(-5)
+	if got := ss.GetOverbookingPercent(); got != 0 {
+		t.Errorf("отрицательный овербукинг сохранен как %d, want 0", got)
+	}
+}
+
+func TestOverbookingPercentConcurrentAccess(t *testing.T) {
+	// Запускается с -race: AssignSlot читает процент из нескольких воркеров, пока ERP его меняет
+	ss := newTestSlotService(NewMockClock(testTime(12, 0, 0)))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(percent int) {
+			defer wg.Done()
+			ss.SetOverbookingPercent(percent)
+		}(i)
+		go func() {
+			defer wg.Done()
+			ss.effectiveCapacity(1000)
+		}()
+	}
+	wg.Wait()
+	if got := ss.GetOverbookingPercent(); got < 0 || got > 7 {
+		t.Errorf("процент после параллельной записи = %d, want 0..7", got)
+	}
+}
+
+func TestAssignSlotOverbookingAdmitsOneExtraOrder(t *testing.T) {
+	// 21:40 - доступен только последний слот дня (21:45)
+	clock := NewMockClock(testTime(21, 40, 0))
+	ss := newRedisSlotService(t, clock)
+	ss.SetMaxCapacity(1000)
+	ss.SetOverbookingPercent(10)
+
+	// Второй заказ выводит загрузку на 1100₽ - выше номинала, но в пределах буфера 10%
+	for _, orderID := range []string{"order-overbook-1", "order-overbook-2"} {
+		if _, _, _, err := ss.AssignSlot(orderID, 550, 1, ""); err != nil {
+			t.Fatalf("%s: %v", orderID, err)
+		}
+	}
+
+	_, _, _, err := ss.AssignSlot("order-overbook-3", 550, 1, "")
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("третий заказ сверх буфера: ожидался ResourceExhausted, получено %v", err)
+	}
+}
+
+func TestParseSlotStartTime(t *testing.T) {
+	ss := newTestSlotService(NewMockClock(testTime(12, 0, 0)))
+	start := testTime(12, 15, 0)
+	got, ok := parseSlotStartTime(ss.generateSlotID(start))
+	if !ok || !got.Equal(start) {
+		t.Errorf("parseSlotStartTime(generateSlotID(%v)) = %v, %v, want %v, true", start, got, ok, start)
+	}
+	for _, slotID := range []string{"", "slot:", "slot:abc", "order:1893456000"} {
+		if _, ok := parseSlotStartTime(slotID); ok {
+			t.Errorf("parseSlotStartTime(%q) = ok, want ошибку разбора", slotID)
+		}
+	}
+}
+
+func TestAssignSlotIsIdempotent(t *testing.T) {
+	clock := NewMockClock(testTime(12, 0, 0))
+	ss := newRedisSlotService(t, clock)
+	ss.SetMaxCapacity(10000)
+
+	// Повтор после успешного назначения возвращает тот же слот
+	slotID, slotStart, _, err := ss.AssignSlot("order-retry", 700, 1, "")
+	if err != nil {
+		t.Fatalf("AssignSlot: %v", err)
+	}
+	retrySlotID, retryStart, _, err := ss.AssignSlot("order-retry", 700, 1, "")
+	if err != nil {
+		t.Fatalf("повторный AssignSlot: %v", err)
+	}
+	if retrySlotID != slotID || !retryStart.Equal(slotStart) {
+		t.Errorf("повтор назначил %s (%v), want %s (%v)", retrySlotID, retryStart, slotID, slotStart)
+	}
+
+	// Параллельные повторы другого заказа бронируют место один раз
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, _, err := ss.AssignSlot("order-parallel", 300, 1, ""); err != nil {
+				t.Errorf("параллельный AssignSlot: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	ctx := ss.redisUtil.Context()
+	load, err := ss.client.Get(ctx, rediskeys.SlotKey(slotID)).Int()
+	if err != nil {
+		t.Fatalf("не удалось прочитать загрузку слота: %v", err)
+	}
+	if load != 1000 {
+		t.Errorf("загрузка слота = %d₽, want 1000₽ (700 + 300, повторы не учитываются)", load)
+	}
+	orders, err := ss.client.SCard(ctx, rediskeys.SlotOrdersKey(slotID)).Result()
+	if err != nil {
+		t.Fatalf("не удалось прочитать заказы слота: %v", err)
+	}
+	if orders != 2 {
+		t.Errorf("заказов в слоте = %d, want 2", orders)
+	}
+}
+
+func TestPrepLeadTimePerBranch(t *testing.T) {
+	ss := newTestSlotService(NewMockClock(testTime(12, 0, 0)))
+	ss.branchSettings["branch-slow"] = branchSlotSettings{prepLeadMinutes: 45, loadedAt: time.Now()}
+	ss.branchSettings["branch-unset"] = branchSlotSettings{loadedAt: time.Now()}
+
+	cases := []struct {
+		branchID string
+		want     time.Duration
+	}{
+		{"branch-slow", 45 * time.Minute},
+		{"branch-unset", 30 * time.Minute}, // prep_lead_minutes не задан - значение по умолчанию
+		{"branch-unknown", 30 * time.Minute},
+		{"", 30 * time.Minute},
+	}
+	for _, tc := range cases {
+		if got := ss.GetPrepLeadTime(tc.branchID); got != tc.want {
+			t.Errorf("GetPrepLeadTime(%q) = %v, want %v", tc.branchID, got, tc.want)
+		}
+	}
+
+	// Заказ на 13:00 филиала с подготовкой 45 минут появляется на планшете в 12:15
+	slotStart := testTime(13, 0, 0)
+	if got := calculateVisibleAt(slotStart, testTime(12, 0, 0), ss.GetPrepLeadTime("branch-slow")); !got.Equal(testTime(12, 15, 0)) {
+		t.Errorf("visibleAt = %v, want 12:15", got)
+	}
+
+	// Устаревшая запись кэша без БД не используется
+	ss.branchSettings["branch-slow"] = branchSlotSettings{prepLeadMinutes: 45, loadedAt: time.Now().Add(-2 * branchSlotSettingsTTL)}
+	if got := ss.GetPrepLeadTime("branch-slow"); got != 30*time.Minute {
+		t.Errorf("устаревший кэш: GetPrepLeadTime = %v, want 30m", got)
+	}
+}
+
+func TestBranchSettingsCachedFromDB(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{})
+	branchID := newTestBranch(t, db)
+	if err := db.Model(&models.Branch{}).Where("id = ?", branchID).
+		Updates(map[string]interface{}{"prep_lead_minutes": 45, "min_minutes_before_slot_end": 12}).Error; err != nil {
+		t.Fatal(err)
+	}
+	ss := NewSlotService(nil, db, testOpenHour, 0, testCloseHour, 0, NewMockClock(testTime(12, 0, 0)))
+
+	if got := ss.GetPrepLeadTime(branchID); got != 45*time.Minute {
+		t.Fatalf("GetPrepLeadTime = %v, want 45m", got)
+	}
+	if got := ss.GetMinTimeBeforeSlotEnd(branchID); got != 12*time.Minute {
+		t.Fatalf("GetMinTimeBeforeSlotEnd = %v, want 12m", got)
+	}
+
+	// Повторные вызовы берут значение из кэша, пока оно не устарело
+	if err := db.Model(&models.Branch{}).Where("id = ?", branchID).Update("prep_lead_minutes", 20).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := ss.GetPrepLeadTime(branchID); got != 45*time.Minute {
+		t.Errorf("из кэша GetPrepLeadTime = %v, want 45m", got)
+	}
+	ss.branchSettingsMu.Lock()
+	cached := ss.branchSettings[branchID]
+	cached.loadedAt = time.Now().Add(-2 * branchSlotSettingsTTL)
+	ss.branchSettings[branchID] = cached
+	ss.branchSettingsMu.Unlock()
+	if got := ss.GetPrepLeadTime(branchID); got != 20*time.Minute {
+		t.Errorf("после истечения кэша GetPrepLeadTime = %v, want 20m", got)
+	}
+}
+
+func TestFirstSlotStartPerBranchNearBoundary(t *testing.T) {
+	ss := newTestSlotService(NewMockClock(testTime(12, 12, 0)))
+	ss.branchSettings["branch-fast"] = branchSlotSettings{minMinutesBeforeSlotEnd: 8, loadedAt: time.Now()}
+	ss.branchSettings["branch-slow"] = branchSlotSettings{minMinutesBeforeSlotEnd: 20, loadedAt: time.Now()}
+
+	// 12:12: ближайший слот 12:15-12:30, до его конца 18 минут
+	now := testTime(12, 12, 0)
+	cases := []struct {
+		branchID string
+		want     time.Time
+	}{
+		{"branch-fast", testTime(12, 15, 0)},
+		{"branch-slow", testTime(12, 30, 0)}, // Кухне нужно 20 минут - слот 12:15 пропускается
+		{"", testTime(12, 15, 0)},            // По умолчанию 8 минут
+	}
+	for _, tc := range cases {
+		if got := ss.firstSlotStart(now, tc.branchID); !got.Equal(tc.want) {
+			t.Errorf("firstSlotStart(%q) = %v, want %v", tc.branchID, got.Format("15:04"), tc.want.Format("15:04"))
+		}
+	}
+
+	// Обе настройки филиала берутся из одной записи кэша
+	if got := ss.GetMinTimeBeforeSlotEnd("branch-slow"); got != 20*time.Minute {
+		t.Errorf("GetMinTimeBeforeSlotEnd = %v, want 20m", got)
+	}
+	if got := ss.GetPrepLeadTime("branch-slow"); got != 30*time.Minute {
+		t.Errorf("GetPrepLeadTime = %v, want 30m по умолчанию", got)
+	}
+}
+
+func TestAdjustSlotLoad(t *testing.T) {
+	clock := NewMockClock(testTime(12, 0, 0))
+	ss := newRedisSlotService(t, clock)
+	ss.SetMaxCapacity(2000)
+
+	slotID, _, _, err := ss.AssignSlot("order-edit", 700, 1, "")
+	if err != nil {
+		t.Fatalf("AssignSlot: %v", err)
+	}
+	if _, _, _, err := ss.AssignSlot("order-other", 800, 1, ""); err != nil {
+		t.Fatalf("AssignSlot: %v", err)
+	}
+
+	// Увеличение в пределах лимита: 1500 + (1000 - 700)
+	gotSlot, load, err := ss.AdjustSlotLoad("order-edit", 1000)
+	if err != nil || gotSlot != slotID || load != 1800 {
+		t.Fatalf("AdjustSlotLoad(1000) = %s, %d₽, %v; want %s, 1800₽", gotSlot, load, err, slotID)
+	}
+
+	// Увеличение сверх лимита отклоняется, загрузка и цена заказа не меняются
+	if _, load, err := ss.AdjustSlotLoad("order-edit", 1500); !errors.Is(err, ErrSlotOverflow) || load != 1800 {
+		t.Fatalf("AdjustSlotLoad(1500) = %d₽, %v; want 1800₽, ErrSlotOverflow", load, err)
+	}
+
+	// Уменьшение разрешено всегда; разница считается от последней принятой цены (1000), а не от исходной
+	if _, load, err := ss.AdjustSlotLoad("order-edit", 400); err != nil || load != 1200 {
+		t.Errorf("AdjustSlotLoad(400) = %d₽, %v; want 1200₽", load, err)
+	}
+
+	if _, _, err := ss.AdjustSlotLoad("order-unknown", 500); err == nil {
+		t.Error("пересчет для заказа без слота прошел без ошибки")
+	}
+}
+
+// Параллельные правки разных заказов слота не теряют изменения друг друга
+func TestAdjustSlotLoadConcurrent(t *testing.T) {
+	clock := NewMockClock(testTime(12, 0, 0))
+	ss := newRedisSlotService(t, clock)
+	ss.SetMaxCapacity(100000)
+
+	var slotID string
+	for i := 0; i < 10; i++ {
+		id, _, _, err := ss.AssignSlot(fmt.Sprintf("order-%d", i), 100, 1, "")
+		if err != nil {
+			t.Fatalf("AssignSlot: %v", err)
+		}
+		slotID = id
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, _, err := ss.AdjustSlotLoad(fmt.Sprintf("order-%d", i), 250); err != nil {
+				t.Errorf("AdjustSlotLoad: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	load, err := ss.client.Get(ss.redisUtil.Context(), rediskeys.SlotKey(slotID)).Int()
+	if err != nil || load != 2500 {
+		t.Errorf("загрузка слота = %d₽ (%v), want 2500₽", load, err)
+	}
+}
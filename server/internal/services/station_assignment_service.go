@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
 	"time"
 
 	"gorm.io/gorm"
 	"zephyrvpn/server/internal/models"
 	"zephyrvpn/server/internal/utils"
+	"zephyrvpn/server/internal/utils/rediskeys"
 )
 
 // StationAssignmentService управляет распределением заказов по станциям
@@ -30,7 +32,7 @@ func NewStationAssignmentService(db *gorm.DB, redisUtil *utils.RedisClient) *Sta
 // Если Recipe не найден или StationID не указан - возвращает ошибку
 func (sas *StationAssignmentService) AssignOrderToStations(order *models.PizzaOrder) error {
 	if sas.redisUtil == nil {
-		return fmt.Errorf("Redis недоступен")
+		return ErrRedisUnavailable
 	}
 
 	if sas.db == nil {
@@ -119,7 +121,7 @@ func (sas *StationAssignmentService) AssignOrderToStations(order *models.PizzaOr
 // - Станция без специальных capabilities - видит только свои позиции, назначенные на эту станцию
 func (sas *StationAssignmentService) GetOrderForStation(order *models.PizzaOrder, stationID string) (*models.PizzaOrder, bool, error) {
 	if sas.redisUtil == nil {
-		return nil, false, fmt.Errorf("Redis недоступен")
+		return nil, false, ErrRedisUnavailable
 	}
 
 	// Получаем маппинг заказа
@@ -140,6 +142,35 @@ func (sas *StationAssignmentService) GetOrderForStation(order *models.PizzaOrder
 	// Определяем, какие позиции видит эта станция
 	visibleItems := make([]models.PizzaItem, 0)
 	canWork := false
+	for _, view := range sas.stationItemViews(mapping, station, stationID) {
+		visibleItems = append(visibleItems, order.Items[view.status.ItemIndex])
+		if view.canWork {
+			canWork = true
+		}
+	}
+
+	// Если нет видимых позиций, заказ не показываем
+	if len(visibleItems) == 0 {
+		return nil, false, nil
+	}
+
+	// Создаем копию заказа с видимыми позициями
+	orderCopy := *order
+	orderCopy.Items = visibleItems
+
+	return &orderCopy, canWork, nil
+}
+
+// stationItemView - позиция заказа, которую видит станция
+type stationItemView struct {
+	status  models.OrderItemStatus
+	canWork bool // Станция может работать с позицией (а не только видит ее)
+}
+
+// stationItemViews определяет, какие позиции заказа видит станция и с какими может работать
+// Правила видимости по capabilities описаны в GetOrderForStation
+func (sas *StationAssignmentService) stationItemViews(mapping *models.OrderStationMapping, station models.Station, stationID string) []stationItemView {
+	views := make([]stationItemView, 0)
 
 	// Проверяем capabilities станции
 	hasViewComposition := contains(station.Config.Capabilities, "view_composition")
@@ -147,14 +178,13 @@ func (sas *StationAssignmentService) GetOrderForStation(order *models.PizzaOrder
 	hasOrderAssembly := contains(station.Config.Capabilities, "order_assembly")
 
 	for _, itemStatus := range mapping.ItemStatuses {
-		item := order.Items[itemStatus.ItemIndex]
 		shouldShow := false
 		canWorkOnThis := false
 
 		// Проверяем, что станция входит в список StationIDs для этой позиции
 		stationIDs, err := sas.parseStationIDs(itemStatus.StationIDs)
 		if err != nil {
-			log.Printf("⚠️ GetOrderForStation: ошибка парсинга StationIDs для позиции %d: %v", itemStatus.ItemIndex, err)
+			log.Printf("⚠️ stationItemViews: ошибка парсинга StationIDs для позиции %d: %v", itemStatus.ItemIndex, err)
 			continue
 		}
 		isStationInList := sas.containsStation(stationIDs, stationID)
@@ -214,30 +244,18 @@ func (sas *StationAssignmentService) GetOrderForStation(order *models.PizzaOrder
 		}
 
 		if shouldShow {
-			visibleItems = append(visibleItems, item)
-			if canWorkOnThis {
-				canWork = true
-			}
+			views = append(views, stationItemView{status: itemStatus, canWork: canWorkOnThis})
 		}
 	}
 
-	// Если нет видимых позиций, заказ не показываем
-	if len(visibleItems) == 0 {
-		return nil, false, nil
-	}
-
-	// Создаем копию заказа с видимыми позициями
-	orderCopy := *order
-	orderCopy.Items = visibleItems
-
-	return &orderCopy, canWork, nil
+	return views
 }
 
 // UpdateItemStatus обновляет статус позиции заказа
 // При изменении статуса на "ready" проверяет, нужно ли передать заказ следующей станции
 func (sas *StationAssignmentService) UpdateItemStatus(orderID string, itemIndex int, newStatus string, stationID string) error {
 	if sas.redisUtil == nil {
-		return fmt.Errorf("Redis недоступен")
+		return ErrRedisUnavailable
 	}
 
 	// Получаем маппинг
@@ -277,6 +295,10 @@ func (sas *StationAssignmentService) UpdateItemStatus(orderID string, itemIndex
 		// Уменьшаем счетчик очереди текущей станции
 		if itemStatus.StationID != "" {
 			sas.decrementStationQueue(itemStatus.StationID)
+			// Время работы станции над позицией (для средней скорости в GetStationLoad)
+			if !itemStatus.StartedAt.IsZero() {
+				sas.recordStationCompletion(itemStatus.StationID, itemStatus.CompletedAt.Sub(itemStatus.StartedAt))
+			}
 		}
 		
 		// Переходим на следующую станцию из списка StationIDs
@@ -308,6 +330,7 @@ func (sas *StationAssignmentService) UpdateItemStatus(orderID string, itemIndex
 						itemStatus.StationID = nextStation.ID
 						itemStatus.CurrentStationIndex = nextIndex
 						itemStatus.Status = "pending" // Сбрасываем статус для новой станции
+						itemStatus.StartedAt = time.Time{} // Время начала считается заново на новой станции
 						mapping.StationAssignments[nextStation.ID] = append(mapping.StationAssignments[nextStation.ID], itemIndex)
 						sas.incrementStationQueue(nextStation.ID)
 						
@@ -346,13 +369,13 @@ func (sas *StationAssignmentService) saveOrderStationMapping(mapping *models.Ord
 	}
 
 	// Сохраняем в Redis
-	key := fmt.Sprintf("erp:order:%s:stations", mapping.OrderID)
+	key := rediskeys.OrderStationsKey(mapping.OrderID)
 	return sas.redisUtil.Set(key, string(mappingJSON), 24*time.Hour)
 }
 
 // getOrderStationMapping получает маппинг заказа к станциям из Redis
 func (sas *StationAssignmentService) getOrderStationMapping(orderID string) (*models.OrderStationMapping, error) {
-	key := fmt.Sprintf("erp:order:%s:stations", orderID)
+	key := rediskeys.OrderStationsKey(orderID)
 	mappingJSON, err := sas.redisUtil.Get(key)
 	if err != nil {
 		return nil, fmt.Errorf("маппинг не найден: %w", err)
@@ -406,6 +429,137 @@ func (sas *StationAssignmentService) decrementStationQueue(stationID string) {
 	}
 }
 
+// stationDurationSamples - сколько последних завершенных позиций учитывается в средней скорости станции
+const stationDurationSamples = 100
+
+// StationLoad - текущая загрузка станции кухни
+type StationLoad struct {
+	StationID            string  `json:"station_id"`
+	StationName          string  `json:"station_name"`
+	BranchID             string  `json:"branch_id"`
+	Status               string  `json:"status"`            // online / offline
+	PendingItems         int     `json:"pending_items"`     // Позиции в очереди станции (еще не начаты)
+	InProgressItems      int     `json:"in_progress_items"` // Позиции в работе (preparing)
+	TotalItems           int     `json:"total_items"`
+	AvgCompletionSeconds float64 `json:"avg_completion_seconds"` // Среднее время preparing -> ready по последним позициям
+	CompletedSamples     int     `json:"completed_samples"`      // Сколько позиций вошло в среднее
+}
+
+// GetStationLoad возвращает загрузку станций: позиции в очереди и в работе по активным и ожидающим заказам
+// и среднее время выполнения позиции (по отметкам StartedAt/CompletedAt из UpdateItemStatus)
+// branchID пустой - все филиалы
+func (sas *StationAssignmentService) GetStationLoad(branchID string) ([]StationLoad, error) {
+	if sas.redisUtil == nil {
+		return nil, ErrRedisUnavailable
+	}
+	if sas.db == nil {
+		return nil, fmt.Errorf("PostgreSQL недоступен")
+	}
+
+	var stations []models.Station
+	query := sas.db.Where("deleted_at IS NULL")
+	if branchID != "" {
+		query = query.Where("branch_id = ?", branchID)
+	}
+	if err := query.Order("name").Find(&stations).Error; err != nil {
+		return nil, fmt.Errorf("ошибка получения станций: %w", err)
+	}
+
+	loads := make([]StationLoad, len(stations))
+	loadByStation := make(map[string]*StationLoad, len(stations))
+	for i, station := range stations {
+		loads[i] = StationLoad{
+			StationID:   station.ID,
+			StationName: station.Name,
+			BranchID:    station.BranchID,
+			Status:      station.Status,
+		}
+		loadByStation[station.ID] = &loads[i]
+	}
+
+	// Позиции заказов, которые уже на планшетах или ждут своего слота
+	orderIDs := make(map[string]struct{})
+	for _, setKey := range []string{rediskeys.OrdersActiveKey, rediskeys.OrdersPendingSlotsKey} {
+		ids, err := sas.redisUtil.SMembers(setKey)
+		if err != nil {
+			log.Printf("⚠️ GetStationLoad: ошибка чтения %s: %v", setKey, err)
+			continue
+		}
+		for _, id := range ids {
+			orderIDs[id] = struct{}{}
+		}
+	}
+
+	for orderID := range orderIDs {
+		mapping, err := sas.getOrderStationMapping(orderID)
+		if err != nil {
+			continue // Заказ без распределения по станциям
+		}
+		for _, itemStatus := range mapping.ItemStatuses {
+			load, ok := loadByStation[itemStatus.StationID]
+			if !ok {
+				continue
+			}
+			switch itemStatus.Status {
+			case "pending":
+				load.PendingItems++
+			case "preparing":
+				load.InProgressItems++
+			}
+		}
+	}
+
+	for i := range loads {
+		loads[i].TotalItems = loads[i].PendingItems + loads[i].InProgressItems
+		loads[i].AvgCompletionSeconds, loads[i].CompletedSamples = sas.getAverageCompletion(loads[i].StationID)
+	}
+
+	return loads, nil
+}
+
+// recordStationCompletion сохраняет время выполнения позиции станцией (последние stationDurationSamples)
+func (sas *StationAssignmentService) recordStationCompletion(stationID string, duration time.Duration) {
+	if duration <= 0 {
+		return
+	}
+	client := sas.redisUtil.GetClient()
+	if client == nil {
+		return
+	}
+	ctx := sas.redisUtil.Context()
+	key := fmt.Sprintf("erp:station:%s:durations", stationID)
+
+	pipe := client.Pipeline()
+	pipe.LPush(ctx, key, int64(duration.Seconds()))
+	pipe.LTrim(ctx, key, 0, stationDurationSamples-1)
+	pipe.Expire(ctx, key, 7*24*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("⚠️ recordStationCompletion: ошибка сохранения времени станции %s: %v", stationID, err)
+	}
+}
+
+// getAverageCompletion возвращает среднее время выполнения позиции станцией (секунды) и число замеров
+func (sas *StationAssignmentService) getAverageCompletion(stationID string) (float64, int) {
+	values, err := sas.redisUtil.LRange(fmt.Sprintf("erp:station:%s:durations", stationID), 0, stationDurationSamples-1)
+	if err != nil || len(values) == 0 {
+		return 0, 0
+	}
+	var total float64
+	samples := 0
+	for _, value := range values {
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		total += seconds
+		samples++
+	}
+	if samples == 0 {
+		return 0, 0
+	}
+	return total / float64(samples), samples
+}
+
 // contains проверяет, содержит ли слайс элемент
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
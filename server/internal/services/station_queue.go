@@ -0,0 +1,126 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+)
+
+// StationQueueItem - позиция заказа в очереди станции
+type StationQueueItem struct {
+	OrderID            string    `json:"order_id"`
+	DisplayID          string    `json:"display_id"`
+	ItemIndex          int       `json:"item_index"` // Для PUT /stations/:id/orders/:order_id/items/:item_index
+	PizzaName          string    `json:"pizza_name"`
+	Quantity           int       `json:"quantity"`
+	Extras             []string  `json:"extras,omitempty"`
+	ExcludeIngredients []string  `json:"exclude_ingredients,omitempty"` // Что НЕ класть
+	Status             string    `json:"status"`                        // pending / preparing / ready / completed
+	CanWork            bool      `json:"can_work"`                      // false - позиция видна, но еще готовится на другой станции
+	DueAt              time.Time `json:"due_at,omitempty"`              // Срок готовности заказа (или начало слота)
+}
+
+// queueItemPriority - порядок позиций с одинаковым сроком: сначала начатые, затем ожидающие
+func queueItemPriority(status string) int {
+	switch status {
+	case "preparing":
+		return 0
+	case "pending":
+		return 1
+	default:
+		return 2
+	}
+}
+
+// orderQueueDue - срок, по которому сортируется очередь: DueAt, иначе начало слота, иначе время появления на планшете
+func orderQueueDue(order *models.PizzaOrder) time.Time {
+	if !order.DueAt.IsZero() {
+		return order.DueAt
+	}
+	if !order.TargetSlotStartTime.IsZero() {
+		return order.TargetSlotStartTime
+	}
+	return order.VisibleAt
+}
+
+// GetStationQueue возвращает позиции активных заказов, которые видит станция (правила GetOrderForStation),
+// отсортированные по сроку слота, затем по приоритету (начатые раньше ожидающих) и времени заказа.
+// Заказы без распределения по станциям в очередь не попадают
+func (sas *StationAssignmentService) GetStationQueue(stationID string, orders []*models.PizzaOrder) ([]StationQueueItem, error) {
+	if sas.redisUtil == nil {
+		return nil, ErrRedisUnavailable
+	}
+	if sas.db == nil {
+		return nil, fmt.Errorf("PostgreSQL недоступен")
+	}
+
+	var station models.Station
+	if err := sas.db.Where("id = ? AND deleted_at IS NULL", stationID).First(&station).Error; err != nil {
+		return nil, fmt.Errorf("станция не найдена: %w", err)
+	}
+
+	type queueEntry struct {
+		item      StationQueueItem
+		due       time.Time
+		createdAt time.Time
+	}
+	entries := make([]queueEntry, 0)
+	for _, order := range orders {
+		mapping, err := sas.getOrderStationMapping(order.ID)
+		if err != nil {
+			continue
+		}
+		due := orderQueueDue(order)
+		for _, view := range sas.stationItemViews(mapping, station, stationID) {
+			if view.status.ItemIndex < 0 || view.status.ItemIndex >= len(order.Items) {
+				continue
+			}
+			item := order.Items[view.status.ItemIndex]
+			entries = append(entries, queueEntry{
+				item: StationQueueItem{
+					OrderID:            order.ID,
+					DisplayID:          order.DisplayID,
+					ItemIndex:          view.status.ItemIndex,
+					PizzaName:          item.PizzaName,
+					Quantity:           item.Quantity,
+					Extras:             item.Extras,
+					ExcludeIngredients: item.ExcludeIngredients,
+					Status:             view.status.Status,
+					CanWork:            view.canWork,
+					DueAt:              due,
+				},
+				due:       due,
+				createdAt: order.CreatedAt,
+			})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if !a.due.Equal(b.due) {
+			// Позиции без срока - в конце очереди
+			if a.due.IsZero() || b.due.IsZero() {
+				return b.due.IsZero()
+			}
+			return a.due.Before(b.due)
+		}
+		if pa, pb := queueItemPriority(a.item.Status), queueItemPriority(b.item.Status); pa != pb {
+			return pa < pb
+		}
+		if !a.createdAt.Equal(b.createdAt) {
+			return a.createdAt.Before(b.createdAt)
+		}
+		if a.item.OrderID != b.item.OrderID {
+			return a.item.OrderID < b.item.OrderID
+		}
+		return a.item.ItemIndex < b.item.ItemIndex
+	})
+
+	queue := make([]StationQueueItem, len(entries))
+	for i, entry := range entries {
+		queue[i] = entry.item
+	}
+	return queue, nil
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils/rediskeys"
+
+	"github.com/google/uuid"
+)
+
+func TestGetStationQueueReturnsOnlyStationItems(t *testing.T) {
+	redisUtil := newTestRedis(t)
+	db := newTestDB(t, &models.Station{}, &models.Recipe{})
+	sas := NewStationAssignmentService(db, redisUtil)
+
+	suffix := uuid.New().String()[:8]
+	grill := models.Station{ID: uuid.New().String(), Name: "Гриль " + suffix, Icon: "Flame"}
+	pizza := models.Station{ID: uuid.New().String(), Name: "Пицца " + suffix, Icon: "ChefHat"}
+	recipes := []models.Recipe{
+		{Name: "Стейк " + suffix, StationIDs: `["` + grill.ID + `"]`, IsActive: true},
+		{Name: "Маргарита " + suffix, StationIDs: `["` + pizza.ID + `"]`, IsActive: true},
+	}
+	for _, station := range []*models.Station{&grill, &pizza} {
+		if err := db.Create(station).Error; err != nil {
+			t.Fatalf("не удалось создать станцию: %v", err)
+		}
+	}
+	for i := range recipes {
+		if err := db.Create(&recipes[i]).Error; err != nil {
+			t.Fatalf("не удалось создать рецепт: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("id IN ?", []string{grill.ID, pizza.ID}).Delete(&models.Station{})
+		db.Unscoped().Where("id IN ?", []string{recipes[0].ID, recipes[1].ID}).Delete(&models.Recipe{})
+	})
+
+	now := time.Now().UTC()
+	late := &models.PizzaOrder{
+		ID:        uuid.New().String(),
+		DisplayID: "A-2",
+		DueAt:     now.Add(30 * time.Minute),
+		Items: []models.PizzaItem{
+			{PizzaName: recipes[1].Name, Quantity: 1},
+			{PizzaName: recipes[0].Name, Quantity: 1, ExcludeIngredients: []string{"лук"}},
+		},
+	}
+	early := &models.PizzaOrder{
+		ID:        uuid.New().String(),
+		DisplayID: "A-1",
+		DueAt:     now.Add(10 * time.Minute),
+		Items:     []models.PizzaItem{{PizzaName: recipes[1].Name, Quantity: 2}},
+	}
+	for _, order := range []*models.PizzaOrder{late, early} {
+		if err := sas.AssignOrderToStations(order); err != nil {
+			t.Fatalf("AssignOrderToStations(%s): %v", order.DisplayID, err)
+		}
+	}
+	orders := []*models.PizzaOrder{late, early}
+
+	grillQueue, err := sas.GetStationQueue(grill.ID, orders)
+	if err != nil {
+		t.Fatalf("GetStationQueue(гриль): %v", err)
+	}
+	if len(grillQueue) != 1 || grillQueue[0].PizzaName != recipes[0].Name {
+		t.Fatalf("очередь гриля = %+v, want только стейк", grillQueue)
+	}
+	if grillQueue[0].DisplayID != "A-2" || grillQueue[0].ItemIndex != 1 ||
+		len(grillQueue[0].ExcludeIngredients) != 1 || grillQueue[0].ExcludeIngredients[0] != "лук" {
+		t.Errorf("позиция гриля = %+v, want заказ A-2, позиция 1, без лука", grillQueue[0])
+	}
+
+	pizzaQueue, err := sas.GetStationQueue(pizza.ID, orders)
+	if err != nil {
+		t.Fatalf("GetStationQueue(пицца): %v", err)
+	}
+	if len(pizzaQueue) != 2 {
+		t.Fatalf("очередь пиццы = %+v, want 2 позиции", pizzaQueue)
+	}
+	for _, item := range pizzaQueue {
+		if item.PizzaName != recipes[1].Name {
+			t.Errorf("в очереди пиццы чужая позиция %q", item.PizzaName)
+		}
+	}
+	// Заказ с более ранним сроком - первым
+	if pizzaQueue[0].DisplayID != "A-1" || pizzaQueue[1].DisplayID != "A-2" {
+		t.Errorf("порядок очереди пиццы: %s, %s, want A-1, A-2", pizzaQueue[0].DisplayID, pizzaQueue[1].DisplayID)
+	}
+}
+
+func TestGetStationLoadCountsQueueAndAverage(t *testing.T) {
+	redisUtil := newTestRedis(t)
+	db := newTestDB(t, &models.Station{}, &models.Recipe{})
+	sas := NewStationAssignmentService(db, redisUtil)
+
+	suffix := uuid.New().String()[:8]
+	grill := models.Station{ID: uuid.New().String(), Name: "Гриль " + suffix, Icon: "Flame"}
+	pizza := models.Station{ID: uuid.New().String(), Name: "Пицца " + suffix, Icon: "ChefHat"}
+	recipes := []models.Recipe{
+		{Name: "Стейк " + suffix, StationIDs: `["` + grill.ID + `"]`, IsActive: true},
+		{Name: "Маргарита " + suffix, StationIDs: `["` + pizza.ID + `"]`, IsActive: true},
+	}
+	for _, station := range []*models.Station{&grill, &pizza} {
+		if err := db.Create(station).Error; err != nil {
+			t.Fatalf("не удалось создать станцию: %v", err)
+		}
+	}
+	for i := range recipes {
+		if err := db.Create(&recipes[i]).Error; err != nil {
+			t.Fatalf("не удалось создать рецепт: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("id IN ?", []string{grill.ID, pizza.ID}).Delete(&models.Station{})
+		db.Unscoped().Where("id IN ?", []string{recipes[0].ID, recipes[1].ID}).Delete(&models.Recipe{})
+	})
+
+	order := &models.PizzaOrder{
+		ID:        uuid.New().String(),
+		DisplayID: "A-1",
+		Items: []models.PizzaItem{
+			{PizzaName: recipes[1].Name, Quantity: 1},
+			{PizzaName: recipes[1].Name, Quantity: 1},
+			{PizzaName: recipes[0].Name, Quantity: 1},
+		},
+	}
+	if err := sas.AssignOrderToStations(order); err != nil {
+		t.Fatalf("AssignOrderToStations: %v", err)
+	}
+	if err := redisUtil.SAdd(rediskeys.OrdersActiveKey, order.ID); err != nil {
+		t.Fatalf("SAdd: %v", err)
+	}
+	if err := sas.UpdateItemStatus(order.ID, 0, "preparing", pizza.ID); err != nil {
+		t.Fatalf("UpdateItemStatus: %v", err)
+	}
+	sas.recordStationCompletion(grill.ID, time.Minute)
+	sas.recordStationCompletion(grill.ID, 2*time.Minute)
+	sas.recordStationCompletion(grill.ID, 0) // Нулевая длительность не учитывается
+
+	loads, err := sas.GetStationLoad("")
+	if err != nil {
+		t.Fatalf("GetStationLoad: %v", err)
+	}
+	byStation := make(map[string]StationLoad)
+	for _, load := range loads {
+		byStation[load.StationID] = load
+	}
+
+	pizzaLoad := byStation[pizza.ID]
+	if pizzaLoad.PendingItems != 1 || pizzaLoad.InProgressItems != 1 || pizzaLoad.TotalItems != 2 {
+		t.Errorf("загрузка пиццы = %+v, want 1 в очереди, 1 в работе", pizzaLoad)
+	}
+	grillLoad := byStation[grill.ID]
+	if grillLoad.PendingItems != 1 || grillLoad.InProgressItems != 0 {
+		t.Errorf("загрузка гриля = %+v, want 1 в очереди", grillLoad)
+	}
+	if grillLoad.AvgCompletionSeconds != 90 || grillLoad.CompletedSamples != 2 {
+		t.Errorf("среднее время гриля = %.0f с по %d замерам, want 90 с по 2", grillLoad.AvgCompletionSeconds, grillLoad.CompletedSamples)
+	}
+}
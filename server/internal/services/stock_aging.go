@@ -0,0 +1,146 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/shopspring/decimal"
+)
+
+// agingBucketRange - диапазон возраста партии в днях (MaxDays = 0 - без верхней границы)
+type agingBucketRange struct {
+	Label   string
+	MinDays int
+	MaxDays int
+}
+
+// agingBucketRanges - корзины отчета по залежалости остатков
+var agingBucketRanges = []agingBucketRange{
+	{Label: "0-7", MinDays: 0, MaxDays: 7},
+	{Label: "8-30", MinDays: 8, MaxDays: 30},
+	{Label: "31-90", MinDays: 31, MaxDays: 90},
+	{Label: "90+", MinDays: 91},
+}
+
+// AgingBucket - остаток товара, пролежавший на складе заданное число дней
+type AgingBucket struct {
+	NomenclatureID   string  `json:"nomenclature_id"`
+	NomenclatureName string  `json:"nomenclature_name"`
+	Unit             string  `json:"unit"` // BaseUnit остатка
+	Bucket           string  `json:"bucket"`
+	MinDays          int     `json:"min_days"`
+	MaxDays          int     `json:"max_days,omitempty"` // 0 - без верхней границы
+	Quantity         float64 `json:"quantity"`
+	Value            float64 `json:"value"` // Стоимость остатка в рублях
+	BatchCount       int     `json:"batch_count"`
+	OldestDays       int     `json:"oldest_days"` // Возраст самой старой партии в корзине
+}
+
+// GetAgingReport группирует живые партии (остаток > 0, не просрочены) по возрасту от created_at:
+// 0-7, 8-30, 31-90 и 90+ дней. Количество и стоимость считаются по товару в каждой корзине
+// Показывает товар, который долго лежит и замораживает деньги, независимо от срока годности
+// branchID - опционально ("" или "all" - все филиалы)
+func (s *StockService) GetAgingReport(branchID string) ([]AgingBucket, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("PostgreSQL недоступен")
+	}
+
+	query := s.db.Preload("Nomenclature").
+		Where("remaining_quantity > 0 AND is_expired = false")
+	if branchID != "" && branchID != "all" {
+		query = query.Where("branch_id = ?", branchID)
+	}
+
+	var batches []models.StockBatch
+	if err := query.Find(&batches).Error; err != nil {
+		return nil, fmt.Errorf("ошибка получения партий: %w", err)
+	}
+
+	return bucketBatchesByAge(batches, time.Now()), nil
+}
+
+// bucketBatchesByAge раскладывает партии по корзинам возраста на момент now
+// Возраст - число полных суток с created_at; результат отсортирован по товару и корзине
+func bucketBatchesByAge(batches []models.StockBatch, now time.Time) []AgingBucket {
+	type accumulator struct {
+		bucket   AgingBucket
+		quantity decimal.Decimal
+		value    decimal.Decimal
+		order    int
+	}
+	byKey := make(map[string]*accumulator)
+
+	for _, batch := range batches {
+		age := int(now.Sub(batch.CreatedAt).Hours() / 24)
+		if age < 0 {
+			age = 0
+		}
+		rangeIndex := len(agingBucketRanges) - 1
+		for i, r := range agingBucketRanges {
+			if age >= r.MinDays && (r.MaxDays == 0 || age <= r.MaxDays) {
+				rangeIndex = i
+				break
+			}
+		}
+		r := agingBucketRanges[rangeIndex]
+
+		key := batch.NomenclatureID + "|" + r.Label
+		acc, ok := byKey[key]
+		if !ok {
+			unit := batch.Nomenclature.BaseUnit
+			if unit == "" {
+				unit = batch.Unit
+			}
+			acc = &accumulator{
+				bucket: AgingBucket{
+					NomenclatureID:   batch.NomenclatureID,
+					NomenclatureName: batch.Nomenclature.Name,
+					Unit:             unit,
+					Bucket:           r.Label,
+					MinDays:          r.MinDays,
+					MaxDays:          r.MaxDays,
+				},
+				order: rangeIndex,
+			}
+			byKey[key] = acc
+		}
+
+		remaining := decimal.NewFromFloat(batch.RemainingQuantity)
+		acc.quantity = acc.quantity.Add(remaining)
+		acc.value = acc.value.Add(calculateBatchValue(
+			remaining,
+			decimal.NewFromFloat(batch.CostPerUnit),
+			costConversionFactor(batch.Nomenclature),
+		))
+		acc.bucket.BatchCount++
+		if age > acc.bucket.OldestDays {
+			acc.bucket.OldestDays = age
+		}
+	}
+
+	accumulators := make([]*accumulator, 0, len(byKey))
+	for _, acc := range byKey {
+		acc.bucket.Quantity = acc.quantity.Round(2).InexactFloat64()
+		acc.bucket.Value = acc.value.Round(2).InexactFloat64()
+		accumulators = append(accumulators, acc)
+	}
+	sort.Slice(accumulators, func(i, j int) bool {
+		a, b := accumulators[i], accumulators[j]
+		if a.bucket.NomenclatureName != b.bucket.NomenclatureName {
+			return a.bucket.NomenclatureName < b.bucket.NomenclatureName
+		}
+		if a.bucket.NomenclatureID != b.bucket.NomenclatureID {
+			return a.bucket.NomenclatureID < b.bucket.NomenclatureID
+		}
+		return a.order < b.order
+	})
+
+	result := make([]AgingBucket, 0, len(accumulators))
+	for _, acc := range accumulators {
+		result = append(result, acc.bucket)
+	}
+	return result
+}
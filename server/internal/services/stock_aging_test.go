@@ -0,0 +1,64 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+)
+
+func TestBucketBatchesByAge(t *testing.T) {
+	now := time.Date(2030, 6, 1, 12, 0, 0, 0, time.UTC)
+	flour := models.NomenclatureItem{ID: "flour", Name: "Мука", BaseUnit: "g", InboundUnit: "kg"}
+	eggs := models.NomenclatureItem{ID: "eggs", Name: "Яйца", BaseUnit: "pcs"}
+	batch := func(item models.NomenclatureItem, ageDays float64, remaining, costPerUnit float64) models.StockBatch {
+		return models.StockBatch{
+			NomenclatureID:    item.ID,
+			Nomenclature:      item,
+			RemainingQuantity: remaining,
+			CostPerUnit:       costPerUnit,
+			Unit:              item.BaseUnit,
+			CreatedAt:         now.Add(-time.Duration(ageDays * 24 * float64(time.Hour))),
+		}
+	}
+	batches := []models.StockBatch{
+		batch(flour, 0.5, 2000, 50), // 100 руб
+		batch(flour, 7.9, 1000, 60), // Полных суток 7 - еще первая корзина, 60 руб
+		batch(flour, 8, 500, 40),    // 20 руб
+		batch(flour, 30, 1500, 45),  // 67.5 руб
+		batch(flour, 31, 1000, 45),  // 45 руб
+		batch(flour, 90, 333, 30),   // 9.99 руб
+		batch(flour, 91, 100, 50),   // 5 руб
+		batch(flour, 400, 250, 50),  // 12.5 руб
+		batch(eggs, 3, 30, 12),      // 360 руб
+		batch(eggs, -1, 10, 12),     // Дата в будущем считается сегодняшней, 120 руб
+	}
+
+	got := bucketBatchesByAge(batches, now)
+	want := []AgingBucket{
+		{NomenclatureID: "flour", NomenclatureName: "Мука", Unit: "g", Bucket: "0-7", MinDays: 0, MaxDays: 7,
+			Quantity: 3000, Value: 160, BatchCount: 2, OldestDays: 7},
+		{NomenclatureID: "flour", NomenclatureName: "Мука", Unit: "g", Bucket: "8-30", MinDays: 8, MaxDays: 30,
+			Quantity: 2000, Value: 87.5, BatchCount: 2, OldestDays: 30},
+		{NomenclatureID: "flour", NomenclatureName: "Мука", Unit: "g", Bucket: "31-90", MinDays: 31, MaxDays: 90,
+			Quantity: 1333, Value: 54.99, BatchCount: 2, OldestDays: 90},
+		{NomenclatureID: "flour", NomenclatureName: "Мука", Unit: "g", Bucket: "90+", MinDays: 91,
+			Quantity: 350, Value: 17.5, BatchCount: 2, OldestDays: 400},
+		{NomenclatureID: "eggs", NomenclatureName: "Яйца", Unit: "pcs", Bucket: "0-7", MinDays: 0, MaxDays: 7,
+			Quantity: 40, Value: 480, BatchCount: 2, OldestDays: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bucketBatchesByAge:\n got %+v\nwant %+v", got, want)
+	}
+
+	if got := bucketBatchesByAge(nil, now); len(got) != 0 {
+		t.Errorf("без партий: %+v, want пусто", got)
+	}
+}
+
+func TestGetAgingReportWithoutDB(t *testing.T) {
+	if _, err := NewStockService(nil).GetAgingReport(""); err == nil {
+		t.Error("без PostgreSQL: want ошибку")
+	}
+}
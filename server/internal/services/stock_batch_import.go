@@ -11,6 +11,7 @@ import (
 	"zephyrvpn/server/internal/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // InvoiceItem представляет валидированный товар из накладной
@@ -19,13 +20,24 @@ type InvoiceItem struct {
 	BranchID       string
 	Quantity       decimal.Decimal // Количество в BaseUnit (г/мл/шт)
 	Unit           string          // Единица измерения из накладной
-	PricePerUnit   decimal.Decimal // Цена за упаковку (если указан pack_size) или за InboundUnit
+	PricePerUnit   decimal.Decimal // Цена за упаковку (если указан pack_size) или за единицу из price_entry_unit номенклатуры
 	PricePerKg     decimal.Decimal // Цена за InboundUnit (кг/л/шт) - вычисленная цена за единицу после деления на pack_size
 	PricePerGram   decimal.Decimal // Цена за BaseUnit (г/мл/шт) - вычисляется через ConversionFactor из номенклатуры
 	TotalCost      decimal.Decimal // Общая стоимость: Quantity * PricePerGram
 	ExpiryAt       *time.Time
 	ConversionFactor decimal.Decimal // Коэффициент конвертации из номенклатуры (InboundUnit -> BaseUnit)
 	PackSize       decimal.Decimal   // Размер упаковки (например, 10 для "Ведро 10кг") - опционально
+	ShelfLifeDays  int               // Срок годности номенклатуры в днях (0 - не ограничен)
+}
+
+// shelfLifeExpiry вычисляет срок годности партии от даты поступления
+// Товары с shelf_life_days = 0 (непортящиеся) остаются без срока
+func shelfLifeExpiry(receivedAt time.Time, shelfLifeDays int) *time.Time {
+	if shelfLifeDays <= 0 {
+		return nil
+	}
+	expiryAt := receivedAt.AddDate(0, 0, shelfLifeDays)
+	return &expiryAt
 }
 
 // ValidateInvoiceItem выполняет предварительную валидацию товара
@@ -306,11 +318,18 @@ func ValidateInvoiceItem(db *gorm.DB, itemData map[string]interface{}) (*Invoice
 	// Формула: CostPerUnit (за кг/л) = Сумма_за_упаковку / Вес_упаковки_в_кг
 	// Пример: "Ведро 10кг" за 1221₽ -> pricePerUnit = 1221, packSize = 10 -> pricePerInboundUnit = 1221 / 10 = 122.1₽/кг
 	// В StockBatch.cost_per_unit сохраняется цена за единицу (122.1), а не за упаковку (1221)
+	//
+	// Без pack_size единицу цены задает номенклатура (price_entry_unit), а не величина цены:
+	// дешевый товар за 5₽/кг остается 5₽/кг. Цена за грамм/мл приводится к цене за кг/л здесь, при оприходовании
 	pricePerInboundUnit := pricePerUnit
 	if packSize.GreaterThan(decimal.Zero) {
 		pricePerInboundUnit = pricePerUnit.Div(packSize)
 		log.Printf("📦 Нормализация цены: цена за упаковку %.2f₽ / размер упаковки %.2f %s = цена за единицу %.2f₽/%s",
 			pricePerUnit.InexactFloat64(), packSize.InexactFloat64(), inboundUnit, pricePerInboundUnit.InexactFloat64(), inboundUnit)
+	} else if nomenclature.PriceEntryUnit == models.PriceEntryUnitBase {
+		pricePerInboundUnit = pricePerUnit.Mul(costConversionFactor(nomenclature))
+		log.Printf("📦 Нормализация цены: %.4f₽/%s (price_entry_unit=base) -> %.2f₽/%s",
+			pricePerUnit.InexactFloat64(), nomenclature.BaseUnit, pricePerInboundUnit.InexactFloat64(), inboundUnit)
 	}
 	
 	// ВАЖНО: Расчет общей стоимости используя shopspring/decimal для точности
@@ -346,19 +365,61 @@ func ValidateInvoiceItem(db *gorm.DB, itemData map[string]interface{}) (*Invoice
 			BranchID:        branchID,
 			Quantity:        quantityInBaseUnit, // Количество в BaseUnit (г/мл/шт) - конвертировано из unit
 			Unit:            baseUnit,           // Единица измерения в BaseUnit
-			PricePerUnit:    pricePerUnit,       // Цена за упаковку (если указан pack_size) или за InboundUnit
+			PricePerUnit:    pricePerUnit,       // Цена за упаковку (если указан pack_size) или за единицу из price_entry_unit
 			PricePerKg:      pricePerInboundUnit, // Цена за InboundUnit (кг/л/шт) - нормализованная цена за единицу
 			PricePerGram:    pricePerBaseUnit,   // Цена за BaseUnit (г/мл/шт) - вычисляется через ConversionFactor
 			TotalCost:       totalCost,          // Общая стоимость: (QuantityInBaseUnit / ConversionFactor) * PricePerInboundUnit
 			ExpiryAt:        expiryAt,
 			ConversionFactor: conversionFactor,
 			PackSize:        packSize,           // Размер упаковки в InboundUnit (опционально)
+			ShelfLifeDays:   nomenclature.ShelfLifeDays,
 		}, nil
 }
 
+// InboundInvoiceResult - итог оприходования накладной
+type InboundInvoiceResult struct {
+	InvoiceID        string `json:"invoice_id"`
+	Number           string `json:"number"`
+	BatchesCreated   int    `json:"batches_created"`
+	AlreadyProcessed bool   `json:"already_processed"` // Накладная была проведена раньше, повторный вызов ничего не изменил
+}
+
+// findPostedInvoice ищет проведенную накладную по ключу дедупликации: номер, поставщик, филиал
+// Возвращает nil, если такой накладной нет
+func findPostedInvoice(db *gorm.DB, number, counterpartyID, branchID string) (*models.Invoice, error) {
+	var invoice models.Invoice
+	result := db.Where("number = ? AND COALESCE(counterparty_id::text, '') = ? AND branch_id = ? AND status = ?",
+		number, counterpartyID, branchID, models.InvoiceStatusCompleted).
+		Limit(1).Find(&invoice)
+	if result.Error != nil {
+		return nil, fmt.Errorf("ошибка поиска проведенной накладной: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &invoice, nil
+}
+
+// postedInvoiceResult возвращает итог уже проведенной накладной: партии созданы первым вызовом
+func postedInvoiceResult(db *gorm.DB, invoice *models.Invoice) *InboundInvoiceResult {
+	var batches int64
+	db.Unscoped().Model(&models.StockBatch{}).Where("invoice_id = ?", invoice.ID).Count(&batches)
+	log.Printf("ℹ️ Накладная %s (ID: %s) уже проведена, повторное оприходование пропущено", invoice.Number, invoice.ID)
+	return &InboundInvoiceResult{
+		InvoiceID:        invoice.ID,
+		Number:           invoice.Number,
+		BatchesCreated:   int(batches),
+		AlreadyProcessed: true,
+	}
+}
+
 // ProcessInboundInvoiceBatch обрабатывает входящую накладную с использованием батч-вставки
 // Создает Invoice как Source of Truth, затем батч-вставляет товары
-func (s *StockService) ProcessInboundInvoiceBatch(invoiceID string, items []map[string]interface{}, performedBy string, counterpartyID string, totalAmount float64, isPaidCash bool, invoiceDate string) error {
+//
+// Накладная, партии, движения, история цен, финансовая транзакция и баланс поставщика пишутся одной транзакцией.
+// Повторный вызов безопасен: если накладная уже проведена (тот же ID или тот же номер, поставщик и филиал),
+// остатки и баланс не меняются, а результат возвращается с AlreadyProcessed
+func (s *StockService) ProcessInboundInvoiceBatch(invoiceID string, items []map[string]interface{}, performedBy string, counterpartyID string, totalAmount float64, isPaidCash bool, invoiceDate string) (*InboundInvoiceResult, error) {
 	// Шаг 1: Pre-flight валидация всех товаров (до транзакции)
 	validatedItems := make([]*InvoiceItem, 0, len(items))
 	validationErrors := make([]string, 0)
@@ -378,7 +439,7 @@ func (s *StockService) ProcessInboundInvoiceBatch(invoiceID string, items []map[
 	}
 	
 	if len(validatedItems) == 0 {
-		return fmt.Errorf("нет валидных товаров для обработки")
+		return nil, fmt.Errorf("нет валидных товаров для обработки")
 	}
 	
 	// Шаг 2: Начинаем транзакцию
@@ -416,8 +477,57 @@ func (s *StockService) ProcessInboundInvoiceBatch(invoiceID string, items []map[
 	}
 	
 	// Проверяем, существует ли накладная (черновик)
+	// Строка блокируется до конца транзакции: параллельный вызов с тем же ID дождется коммита и увидит completed
 	var existingInvoice models.Invoice
-	invoiceExists := tx.Where("id = ?", invoiceUUID).First(&existingInvoice).Error == nil
+	invoiceExists := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", invoiceUUID).First(&existingInvoice).Error == nil
+	if invoiceExists {
+		switch existingInvoice.Status {
+		case models.InvoiceStatusCompleted:
+			tx.Rollback()
+			return postedInvoiceResult(s.db, &existingInvoice), nil
+		case models.InvoiceStatusCancelled, models.InvoiceStatusVoided:
+			tx.Rollback()
+			return nil, fmt.Errorf("накладная %s в статусе %s, оприходование невозможно", existingInvoice.Number, existingInvoice.Status)
+		}
+	}
+	
+	// Определяем валюту накладной: валюта черновика, иначе валюта расчетов поставщика
+	// Остатки, last_price, финансы и балансы контрагентов ведутся в рублях по курсу на дату накладной
+	currency := models.BaseCurrency
+	if invoiceExists && existingInvoice.Currency != "" {
+		currency = existingInvoice.Currency
+	}
+	if currency == models.BaseCurrency && counterpartyID != "" {
+		var counterparty models.Counterparty
+		if err := tx.Select("id", "currency").First(&counterparty, "id = ?", counterpartyID).Error; err == nil && counterparty.Currency != "" {
+			currency = counterparty.Currency
+		}
+	}
+	currency = NormalizeCurrency(currency)
+	
+	exchangeRate := decimal.NewFromInt(1)
+	if currency != models.BaseCurrency {
+		if s.currencyService == nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("накладная в валюте %s, но сервис валют не инициализирован", currency)
+		}
+		rate, err := s.currencyService.GetRate(currency, parsedInvoiceDate)
+		if err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("не удалось получить курс для накладной: %w", err)
+		}
+		exchangeRate = rate
+		for _, item := range validatedItems {
+			item.PricePerUnit = item.PricePerUnit.Mul(exchangeRate)
+			item.PricePerKg = item.PricePerKg.Mul(exchangeRate)
+			item.PricePerGram = item.PricePerGram.Mul(exchangeRate)
+			item.TotalCost = item.TotalCost.Mul(exchangeRate)
+		}
+		log.Printf("💱 Накладная в %s: курс %s₽ на %s, цены пересчитаны в рубли",
+			currency, exchangeRate.String(), parsedInvoiceDate.Format("2006-01-02"))
+	}
+	originalTotalAmount := totalAmount
+	totalAmount = decimal.NewFromFloat(totalAmount).Mul(exchangeRate).Round(2).InexactFloat64()
 	
 	// Определяем номер накладной (будет использован везде)
 	var invoiceNumber string
@@ -428,6 +538,9 @@ func (s *StockService) ProcessInboundInvoiceBatch(invoiceID string, items []map[
 		invoiceNumber = existingInvoice.Number // Используем существующий номер
 		existingInvoice.Status = models.InvoiceStatusCompleted
 		existingInvoice.TotalAmount = totalAmount
+		existingInvoice.Currency = currency
+		existingInvoice.OriginalTotalAmount = originalTotalAmount
+		existingInvoice.ExchangeRate = exchangeRate.InexactFloat64()
 		existingInvoice.IsPaidCash = isPaidCash
 		existingInvoice.PerformedBy = performedBy
 		if counterpartyID != "" {
@@ -436,7 +549,7 @@ func (s *StockService) ProcessInboundInvoiceBatch(invoiceID string, items []map[
 		existingInvoice.Notes = fmt.Sprintf("Оприходование %d товаров", len(validatedItems))
 		if err := tx.Save(&existingInvoice).Error; err != nil {
 			tx.Rollback()
-			return fmt.Errorf("ошибка обновления накладной: %w", err)
+			return nil, fmt.Errorf("ошибка обновления накладной: %w", err)
 		}
 		invoice = &existingInvoice
 		log.Printf("✅ Обновлена накладная (черновик → завершена): ID=%s, номер=%s", invoiceUUID, invoiceNumber)
@@ -447,11 +560,29 @@ func (s *StockService) ProcessInboundInvoiceBatch(invoiceID string, items []map[
 			invoiceNumber = fmt.Sprintf("INV-%s", time.Now().Format("20060102-150405"))
 		}
 		
+		// Ключ дедупликации: накладная с тем же номером от того же поставщика в тот же филиал уже проведена
+		posted, err := findPostedInvoice(tx, invoiceNumber, counterpartyID, branchID)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if posted != nil {
+			tx.Rollback()
+			return postedInvoiceResult(s.db, posted), nil
+		}
+		
+		var invoiceCounterpartyID *string
+		if counterpartyID != "" {
+			invoiceCounterpartyID = &counterpartyID
+		}
 		invoice = &models.Invoice{
 			ID:            invoiceUUID,
 			Number:        invoiceNumber,
-			CounterpartyID: &counterpartyID,
+			CounterpartyID: invoiceCounterpartyID,
 			TotalAmount:   totalAmount,
+			Currency:      currency,
+			OriginalTotalAmount: originalTotalAmount,
+			ExchangeRate:  exchangeRate.InexactFloat64(),
 			Status:        models.InvoiceStatusCompleted,
 			BranchID:      branchID,
 			InvoiceDate:   parsedInvoiceDate,
@@ -462,7 +593,13 @@ func (s *StockService) ProcessInboundInvoiceBatch(invoiceID string, items []map[
 		
 		if err := tx.Create(invoice).Error; err != nil {
 			tx.Rollback()
-			return fmt.Errorf("ошибка создания накладной: %w", err)
+			// Параллельный запрос успел провести ту же накладную (уникальный индекс, migrations/041)
+			if isUniqueConstraintError(err) {
+				if posted, findErr := findPostedInvoice(s.db, invoiceNumber, counterpartyID, branchID); findErr == nil && posted != nil {
+					return postedInvoiceResult(s.db, posted), nil
+				}
+			}
+			return nil, fmt.Errorf("ошибка создания накладной: %w", err)
 		}
 		log.Printf("✅ Создана новая накладная: ID=%s, номер=%s, сумма=%.2f", invoiceUUID, invoiceNumber, totalAmount)
 	}
@@ -513,13 +650,19 @@ func (s *StockService) ProcessInboundInvoiceBatch(invoiceID string, items []map[
 		// КРИТИЧЕСКИ ВАЖНО: CostPerUnit должен быть ценой за 1кг/1л, НЕ за грамм!
 		// Если указан pack_size, цена нормализуется: pricePerInboundUnit = pricePerUnit / packSize
 		// Пример: "Ведро 10кг" за 1,221₽ -> pack_size=10 -> CostPerUnit = 1221/10 = 122.1₽/кг
-		// Если pack_size не указан, то CostPerUnit = price_per_unit (цена уже за единицу)
+		// Если pack_size не указан, то CostPerUnit = price_per_unit (за InboundUnit) или price_per_unit * ConversionFactor (price_entry_unit = base)
 		// 
 		// Количество сохраняется в BaseUnit (граммы): 10кг = 10000г
 		// 
 		// Формула расчета стоимости при чтении:
 		// TotalValue = (RemainingQuantityInGrams * CostPerKg) / 1000
 		// Пример: (10000г * 122.1₽/кг) / 1000 = 1,221₽
+		// Срок не указан в накладной - вычисляем по сроку годности товара от даты накладной
+		expiryAt := item.ExpiryAt
+		if expiryAt == nil {
+			expiryAt = shelfLifeExpiry(parsedInvoiceDate, item.ShelfLifeDays)
+		}
+		
 		batch := models.StockBatch{
 			ID:                batchID,
 			NomenclatureID:    item.NomenclatureID,
@@ -527,7 +670,7 @@ func (s *StockService) ProcessInboundInvoiceBatch(invoiceID string, items []map[
 			Quantity:          item.Quantity.InexactFloat64(), // Количество в BaseUnit (г/мл/шт)
 			Unit:              item.Unit,
 			CostPerUnit:       item.PricePerKg.InexactFloat64(), // Цена за InboundUnit (кг/л/шт) - цена за 1кг/1л!
-			ExpiryAt:          item.ExpiryAt,
+			ExpiryAt:          expiryAt,
 			Source:            "invoice",
 			InvoiceID:         &invoiceUUID, // FK на Invoice (Source of Truth)
 			RemainingQuantity: item.Quantity.InexactFloat64(), // Остаток в BaseUnit (г/мл/шт)
@@ -564,7 +707,7 @@ func (s *StockService) ProcessInboundInvoiceBatch(invoiceID string, items []map[
 		chunk := batches[i:end]
 		if err := tx.CreateInBatches(chunk, chunkSize).Error; err != nil {
 			tx.Rollback()
-			return fmt.Errorf("ошибка батч-вставки партий (чанк %d-%d): %w", i, end, err)
+			return nil, fmt.Errorf("ошибка батч-вставки партий (чанк %d-%d): %w", i, end, err)
 		}
 	}
 	
@@ -578,7 +721,7 @@ func (s *StockService) ProcessInboundInvoiceBatch(invoiceID string, items []map[
 		chunk := movements[i:end]
 		if err := tx.CreateInBatches(chunk, chunkSize).Error; err != nil {
 			tx.Rollback()
-			return fmt.Errorf("ошибка батч-вставки движений (чанк %d-%d): %w", i, end, err)
+			return nil, fmt.Errorf("ошибка батч-вставки движений (чанк %d-%d): %w", i, end, err)
 		}
 	}
 	
@@ -595,11 +738,19 @@ func (s *StockService) ProcessInboundInvoiceBatch(invoiceID string, items []map[
 		if err := tx.Model(&models.NomenclatureItem{}).
 			Where("id = ?", nomID).
 			Update("last_price", pricePerKg.InexactFloat64()).Error; err != nil {
-			log.Printf("⚠️ Ошибка обновления last_price для товара %s: %v", nomID, err)
-			// Не прерываем транзакцию
+			// После ошибки PostgreSQL все равно не примет остальные запросы транзакции
+			tx.Rollback()
+			return nil, fmt.Errorf("ошибка обновления last_price для товара %s: %w", nomID, err)
 		}
 	}
 	
+	// Шаг 6.1: Записываем цены в историю (last_price хранит только последнюю)
+	priceAlerts, err := s.recordPriceHistory(tx, nomenclaturePriceMap, counterpartyID, invoiceUUID, branchID, parsedInvoiceDate)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	
 	// Шаг 7: Создаем финансовую транзакцию (в той же транзакции)
 	if s.financeService != nil && counterpartyID != "" && totalAmount > 0 {
 		// Определяем источник транзакции
@@ -623,6 +774,9 @@ func (s *StockService) ProcessInboundInvoiceBatch(invoiceID string, items []map[
 			Type:          models.TransactionTypeExpense,
 			Category:      "Операционные расходы",
 			Amount:        totalAmount,
+			Currency:      currency,
+			OriginalAmount: originalTotalAmount,
+			ExchangeRate:  exchangeRate.InexactFloat64(),
 			Description:   fmt.Sprintf("Оприходование накладной %s", invoiceNumber),
 			BranchID:      branchID,
 			Source:        source,
@@ -634,7 +788,7 @@ func (s *StockService) ProcessInboundInvoiceBatch(invoiceID string, items []map[
 		
 		if err := tx.Create(financeTransaction).Error; err != nil {
 			tx.Rollback()
-			return fmt.Errorf("ошибка создания финансовой транзакции: %w", err)
+			return nil, fmt.Errorf("ошибка создания финансовой транзакции: %w", err)
 		}
 		
 		log.Printf("✅ Создана финансовая транзакция для накладной %s (ID: %s)", invoiceNumber, financeTransaction.ID)
@@ -649,7 +803,7 @@ func (s *StockService) ProcessInboundInvoiceBatch(invoiceID string, items []map[
 				Where("id = ?", counterpartyID).
 				Update("balance_official", gorm.Expr("COALESCE(balance_official, 0) + ?", totalAmount)).Error; err != nil {
 				tx.Rollback()
-				return fmt.Errorf("ошибка обновления баланса контрагента: %w", err)
+				return nil, fmt.Errorf("ошибка обновления баланса контрагента: %w", err)
 			}
 		} else {
 			// Внутренний баланс
@@ -657,7 +811,7 @@ func (s *StockService) ProcessInboundInvoiceBatch(invoiceID string, items []map[
 				Where("id = ?", counterpartyID).
 				Update("balance_internal", gorm.Expr("COALESCE(balance_internal, 0) + ?", totalAmount)).Error; err != nil {
 				tx.Rollback()
-				return fmt.Errorf("ошибка обновления баланса контрагента: %w", err)
+				return nil, fmt.Errorf("ошибка обновления баланса контрагента: %w", err)
 			}
 		}
 		log.Printf("✅ Обновлен баланс контрагента %s: +%.2f", counterpartyID, totalAmount)
@@ -665,13 +819,18 @@ func (s *StockService) ProcessInboundInvoiceBatch(invoiceID string, items []map[
 	
 	// Шаг 9: Коммитим транзакцию (все или ничего)
 	if err := tx.Commit().Error; err != nil {
-		return fmt.Errorf("ошибка коммита транзакции: %w", err)
+		return nil, fmt.Errorf("ошибка коммита транзакции: %w", err)
 	}
+	s.notifyPriceAlerts(priceAlerts)
 	
 	log.Printf("✅ Обработана накладная %s (ID: %s): создано %d партий (валидировано %d из %d)", 
 		invoiceNumber, invoiceUUID, len(batches), len(validatedItems), len(items))
 	
-	return nil
+	return &InboundInvoiceResult{
+		InvoiceID:      invoiceUUID,
+		Number:         invoiceNumber,
+		BatchesCreated: len(batches),
+	}, nil
 }
 
 
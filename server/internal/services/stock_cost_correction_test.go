@@ -0,0 +1,113 @@
+package services
+
+import (
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestCorrectBatchCostWithoutDB(t *testing.T) {
+	service := NewStockService(nil)
+	if _, err := service.CorrectBatchCost("batch-1", 1234, "admin", ""); err == nil {
+		t.Error("CorrectBatchCost без PostgreSQL: want ошибку")
+	}
+	if _, err := service.FindSuspectedCostErrors("all"); err == nil {
+		t.Error("FindSuspectedCostErrors без PostgreSQL: want ошибку")
+	}
+}
+
+// Чтение остатков не меняет цену дешевой партии; подозрительная цена только попадает в список,
+// а исправляется явно через CorrectBatchCost с записью в журнал движений
+func TestStockCostCorrection(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.StockBatch{}, &models.StockMovement{}, &models.Branch{})
+	service := NewStockService(db)
+
+	branchID := uuid.New().String()
+	item := models.NomenclatureItem{
+		SKU:         "TEST-" + uuid.New().String()[:8],
+		Name:        "Соль",
+		BaseUnit:    "g",
+		InboundUnit: "kg",
+		IsActive:    true,
+	}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+	})
+	// Соль за 8₽/кг - дешево, но корректно
+	batch := models.StockBatch{
+		NomenclatureID:    item.ID,
+		BranchID:          branchID,
+		Quantity:          5000,
+		RemainingQuantity: 5000,
+		Unit:              "g",
+		CostPerUnit:       8,
+		Source:            "adjustment",
+	}
+	if err := db.Create(&batch).Error; err != nil {
+		t.Fatalf("не удалось создать партию: %v", err)
+	}
+	storedCost := func() float64 {
+		t.Helper()
+		var stored models.StockBatch
+		if err := db.First(&stored, "id = ?", batch.ID).Error; err != nil {
+			t.Fatalf("не удалось прочитать партию: %v", err)
+		}
+		return stored.CostPerUnit
+	}
+
+	items, err := service.GetStockItems(branchID, false)
+	if err != nil {
+		t.Fatalf("GetStockItems: %v", err)
+	}
+	if len(items) != 1 || items[0]["cost_per_unit"] != float64(8) || items[0]["cost_value"] != float64(40) {
+		t.Fatalf("остатки %v, want одну строку с ценой 8₽/кг и стоимостью 40₽", items)
+	}
+	if cost := storedCost(); cost != 8 {
+		t.Errorf("после чтения остатков цена партии %v, want 8 (чтение не меняет цену)", cost)
+	}
+
+	suspects, err := service.FindSuspectedCostErrors(branchID)
+	if err != nil {
+		t.Fatalf("FindSuspectedCostErrors: %v", err)
+	}
+	if len(suspects) != 1 || suspects[0].BatchID != batch.ID || suspects[0].SuggestedCostPerUnit != 8000 {
+		t.Errorf("подозрительные партии %+v, want партию %s с подсказкой 8000", suspects, batch.ID)
+	}
+	if cost := storedCost(); cost != 8 {
+		t.Errorf("после поиска подозрительных цена партии %v, want 8", cost)
+	}
+
+	if _, err := service.CorrectBatchCost(batch.ID, -1, "admin", ""); err == nil {
+		t.Error("отрицательная цена: want ошибку")
+	}
+	if _, err := service.CorrectBatchCost(uuid.New().String(), 10, "admin", ""); err == nil {
+		t.Error("несуществующая партия: want ошибку")
+	}
+	corrected, err := service.CorrectBatchCost(batch.ID, 12, "admin", "опечатка в накладной")
+	if err != nil {
+		t.Fatalf("CorrectBatchCost: %v", err)
+	}
+	if corrected.CostPerUnit != 12 || storedCost() != 12 {
+		t.Errorf("цена после исправления %v (в БД %v), want 12", corrected.CostPerUnit, storedCost())
+	}
+
+	var movements []models.StockMovement
+	if err := db.Where("stock_batch_id = ?", batch.ID).Find(&movements).Error; err != nil {
+		t.Fatalf("не удалось прочитать журнал движений: %v", err)
+	}
+	if len(movements) != 1 {
+		t.Fatalf("записей в журнале %d, want 1", len(movements))
+	}
+	movement := movements[0]
+	if movement.MovementType != MovementTypeCostCorrection || movement.Quantity != 0 || movement.PerformedBy != "admin" ||
+		movement.Notes != "Исправление цены партии: 8.00₽ -> 12.00₽ за g. Причина: опечатка в накладной" {
+		t.Errorf("запись журнала %+v, want исправление цены 8 -> 12 без изменения количества", movement)
+	}
+}
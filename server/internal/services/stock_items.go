@@ -0,0 +1,260 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"zephyrvpn/server/internal/models"
+)
+
+// stockAggregateRow - остаток номенклатуры в филиале по одной цене партии, посчитанный в SQL
+type stockAggregateRow struct {
+	NomenclatureID    string
+	BranchID          string
+	CostPerUnit       float64
+	RemainingQuantity float64   // Сумма остатков партий в BaseUnit (с поправкой для остатков, сохраненных в кг/л)
+	LastCreatedAt     time.Time // Самая новая партия группы - ее цена показывается как cost_per_unit товара
+	SampleBatchID     string
+	Orphaned          bool // Номенклатура удалена или отсутствует
+}
+
+// stockRemainingSQL - остаток партии в BaseUnit. Весовые/объемные остатки меньше 1000 считаются
+// сохраненными в кг/л и переводятся в г/мл (прежняя поправка GetStockItems, теперь на стороне БД)
+const stockRemainingSQL = `CASE WHEN ni.base_unit IN ('g', 'ml') AND sb.remaining_quantity < 1000
+	THEN sb.remaining_quantity * 1000 ELSE sb.remaining_quantity END`
+
+// GetStockItems возвращает остатки товаров с учетом партий и сроков годности
+// Остатки суммируются в SQL по номенклатуре, филиалу и цене партии - партии в память не загружаются.
+// В строках списка batches пустой: разбивка по партиям - GetStockItemBatches для одного товара
+func (s *StockService) GetStockItems(branchID string, includeExpired bool) ([]map[string]interface{}, error) {
+	return s.getStockItems(branchID, "", includeExpired)
+}
+
+// GetStockItemBatches возвращает остатки одного товара (по филиалам) с разбивкой по партиям (FEFO)
+// Формат строк тот же, что у GetStockItems
+func (s *StockService) GetStockItemBatches(nomenclatureID, branchID string, includeExpired bool) ([]map[string]interface{}, error) {
+	if nomenclatureID == "" {
+		return nil, fmt.Errorf("nomenclature_id обязателен")
+	}
+	return s.getStockItems(branchID, nomenclatureID, includeExpired)
+}
+
+func (s *StockService) getStockItems(branchID, nomenclatureID string, includeExpired bool) ([]map[string]interface{}, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("PostgreSQL недоступен")
+	}
+
+	query := s.db.Table("stock_batches AS sb").
+		Select(`sb.nomenclature_id, sb.branch_id, sb.cost_per_unit,
+			SUM(` + stockRemainingSQL + `) AS remaining_quantity,
+			MAX(sb.created_at) AS last_created_at,
+			MIN(sb.id::text) AS sample_batch_id,
+			BOOL_OR(ni.id IS NULL OR ni.deleted_at IS NOT NULL) AS orphaned`).
+		Joins("LEFT JOIN nomenclature_items ni ON ni.id = sb.nomenclature_id").
+		Where("sb.deleted_at IS NULL AND sb.remaining_quantity > 0")
+	if branchID != "" && branchID != "all" {
+		query = query.Where("sb.branch_id = ?", branchID)
+	}
+	if nomenclatureID != "" {
+		query = query.Where("sb.nomenclature_id = ?", nomenclatureID)
+	}
+	if !includeExpired {
+		query = query.Where("sb.is_expired = false")
+	}
+
+	var rows []stockAggregateRow
+	if err := query.Group("sb.nomenclature_id, sb.branch_id, sb.cost_per_unit").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("ошибка агрегации остатков: %w", err)
+	}
+
+	// Партии удаленной номенклатуры пропускаем (сверка через GetOrphanedBatches)
+	linked := rows[:0]
+	nomenclatureIDs := make([]string, 0)
+	branchIDs := make([]string, 0)
+	seenNomenclature := make(map[string]bool)
+	seenBranch := make(map[string]bool)
+	for _, row := range rows {
+		if row.Orphaned {
+			logOrphanedBatchOnce(models.StockBatch{ID: row.SampleBatchID, NomenclatureID: row.NomenclatureID, BranchID: row.BranchID})
+			continue
+		}
+		linked = append(linked, row)
+		if !seenNomenclature[row.NomenclatureID] {
+			seenNomenclature[row.NomenclatureID] = true
+			nomenclatureIDs = append(nomenclatureIDs, row.NomenclatureID)
+		}
+		if !seenBranch[row.BranchID] {
+			seenBranch[row.BranchID] = true
+			branchIDs = append(branchIDs, row.BranchID)
+		}
+	}
+	rows = linked
+
+	nomenclatureMap := make(map[string]models.NomenclatureItem, len(nomenclatureIDs))
+	if len(nomenclatureIDs) > 0 {
+		var items []models.NomenclatureItem
+		if err := s.db.Where("id IN ?", nomenclatureIDs).Find(&items).Error; err != nil {
+			return nil, fmt.Errorf("ошибка загрузки номенклатуры: %w", err)
+		}
+		for _, item := range items {
+			nomenclatureMap[item.ID] = item
+		}
+	}
+
+	branchMap := make(map[string]string)
+	if len(branchIDs) > 0 {
+		var branches []models.Branch
+		if err := s.db.Where("id IN ?", branchIDs).Find(&branches).Error; err == nil {
+			for _, branch := range branches {
+				branchMap[branch.ID] = branch.Name
+			}
+		}
+	}
+
+	// Сумма по ценам: стоимость каждой группы - та же формула, что для отдельной партии
+	// (RemainingQuantity * CostPerUnit) / ConversionFactor, цена строки - цена самой новой партии
+	type stockTotals struct {
+		nomenclature  models.NomenclatureItem
+		branchID      string
+		currentStock  float64
+		costValue     decimal.Decimal
+		costPerUnit   float64
+		lastCreatedAt time.Time
+	}
+	totals := make(map[string]*stockTotals)
+	order := make([]string, 0)
+	for _, row := range rows {
+		nomenclature, ok := nomenclatureMap[row.NomenclatureID]
+		if !ok {
+			continue // Удалена между запросами
+		}
+		key := row.NomenclatureID + "_" + row.BranchID
+		total, exists := totals[key]
+		if !exists {
+			total = &stockTotals{nomenclature: nomenclature, branchID: row.BranchID}
+			totals[key] = total
+			order = append(order, key)
+		}
+		total.currentStock += row.RemainingQuantity
+		total.costValue = total.costValue.Add(calculateBatchValue(
+			decimal.NewFromFloat(row.RemainingQuantity),
+			decimal.NewFromFloat(row.CostPerUnit),
+			costConversionFactor(nomenclature),
+		))
+		if !exists || row.LastCreatedAt.After(total.lastCreatedAt) {
+			total.costPerUnit = row.CostPerUnit
+			total.lastCreatedAt = row.LastCreatedAt
+		}
+	}
+
+	var batchesByKey map[string][]map[string]interface{}
+	if nomenclatureID != "" {
+		var err error
+		batchesByKey, err = s.stockItemBatches(branchID, nomenclatureID, includeExpired)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]map[string]interface{}, 0, len(order))
+	for _, key := range order {
+		total := totals[key]
+		nomenclature := total.nomenclature
+		minStock := nomenclature.MinStockLevel
+
+		status := "in_stock"
+		if total.currentStock <= 0 {
+			status = "out_of_stock"
+		} else if total.currentStock < minStock {
+			status = "low_stock"
+		}
+
+		batches := batchesByKey[key]
+		if batches == nil {
+			batches = []map[string]interface{}{}
+		}
+
+		result = append(result, map[string]interface{}{
+			"id":             nomenclature.ID,
+			"product_id":     nomenclature.ID,
+			"product_name":   nomenclature.Name,
+			"category":       nomenclature.CategoryName,
+			"category_color": nomenclature.CategoryColor,
+			"category_id":    nomenclature.CategoryID,
+			"unit":           nomenclature.InboundUnit, // Единица измерения для отображения (кг/л/шт) - используется для цены
+			"base_unit":      nomenclature.BaseUnit,    // Базовая единица склада (г/мл/шт) - для точного учета
+			"inbound_unit":   nomenclature.InboundUnit, // Единица поступления (кг/л/шт) - для цены закупки
+			"branch_id":      total.branchID,
+			"branch_name":    branchMap[total.branchID],
+			"current_stock":  total.currentStock, // В BaseUnit
+			"min_stock":      minStock,
+			"cost_per_unit":  total.costPerUnit,                // Цена за InboundUnit (кг/л/шт) самой новой партии
+			"cost_value":     total.costValue.InexactFloat64(), // Сумма (остаток * цена) / ConversionFactor по всем партиям
+			"status":         status,
+			"batches":        batches,
+		})
+	}
+
+	return result, nil
+}
+
+// stockItemBatches загружает партии одного товара для детализации, ключ - nomenclature_id + "_" + branch_id
+func (s *StockService) stockItemBatches(branchID, nomenclatureID string, includeExpired bool) (map[string][]map[string]interface{}, error) {
+	query := s.db.Model(&models.StockBatch{}).
+		Where("nomenclature_id = ? AND remaining_quantity > 0", nomenclatureID)
+	if branchID != "" && branchID != "all" {
+		query = query.Where("branch_id = ?", branchID)
+	}
+	if !includeExpired {
+		query = query.Where("is_expired = false")
+	}
+
+	var batches []models.StockBatch
+	if err := query.Order("expiry_at ASC NULLS LAST, created_at ASC").Find(&batches).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки партий: %w", err)
+	}
+
+	invoiceMap := make(map[string]string) // invoiceID -> invoiceNumber
+	invoiceIDs := make([]string, 0)
+	for _, batch := range batches {
+		if batch.InvoiceID != nil && *batch.InvoiceID != "" {
+			if _, exists := invoiceMap[*batch.InvoiceID]; !exists {
+				invoiceMap[*batch.InvoiceID] = ""
+				invoiceIDs = append(invoiceIDs, *batch.InvoiceID)
+			}
+		}
+	}
+	if len(invoiceIDs) > 0 {
+		var invoices []models.Invoice
+		if err := s.db.Select("id", "number").Where("id IN ?", invoiceIDs).Find(&invoices).Error; err == nil {
+			for _, invoice := range invoices {
+				invoiceMap[invoice.ID] = invoice.Number
+			}
+		}
+	}
+
+	result := make(map[string][]map[string]interface{})
+	for _, batch := range batches {
+		batchData := map[string]interface{}{
+			"id":                 batch.ID,
+			"quantity":           batch.RemainingQuantity,
+			"expiry_at":          batch.ExpiryAt,
+			"days_until_expiry":  s.calculateDaysUntilExpiry(batch.ExpiryAt),
+			"hours_until_expiry": s.calculateHoursUntilExpiry(batch.ExpiryAt),
+			"is_expired":         batch.IsExpired,
+			"is_at_risk":         s.isAtRisk(batch),
+			"cost_per_unit":      batch.CostPerUnit, // Цена за InboundUnit (как сохранена в партии)
+		}
+		// Добавляем информацию о накладной, если есть
+		if batch.InvoiceID != nil && *batch.InvoiceID != "" {
+			batchData["invoice_id"] = *batch.InvoiceID
+			if invoiceNumber := invoiceMap[*batch.InvoiceID]; invoiceNumber != "" {
+				batchData["invoice_number"] = invoiceNumber
+			}
+		}
+		key := batch.NomenclatureID + "_" + batch.BranchID
+		result[key] = append(result[key], batchData)
+	}
+	return result, nil
+}
@@ -0,0 +1,532 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"zephyrvpn/server/internal/models"
+)
+
+// legacyGetStockItems - прежняя реализация GetStockItems: все партии загружаются в память и группируются в Go
+// Оставлена как эталон для сравнения результата и бенчмарка новой агрегации в SQL
+func (s *StockService) legacyGetStockItems(branchID string, includeExpired bool) ([]map[string]interface{}, error) {
+	type BatchWithBranch struct {
+		models.StockBatch
+		BranchName string `gorm:"column:branch_name"`
+	}
+
+	var batches []models.StockBatch
+
+	query := s.db.Model(&models.StockBatch{}).
+		Preload("Nomenclature").
+		Where("remaining_quantity > 0")
+
+	if branchID != "" && branchID != "all" {
+		query = query.Where("branch_id = ?", branchID)
+	}
+
+	if !includeExpired {
+		query = query.Where("is_expired = false")
+	}
+
+	if err := query.Find(&batches).Error; err != nil {
+		return nil, err
+	}
+
+	// Preload не находит удаленную номенклатуру - такие партии пропускаем (сверка через GetOrphanedBatches)
+	linked := batches[:0]
+	for _, batch := range batches {
+		if batch.Nomenclature.ID == "" || batch.Nomenclature.Name == "" {
+			logOrphanedBatchOnce(batch)
+			continue
+		}
+		linked = append(linked, batch)
+	}
+	batches = linked
+
+	// Загружаем филиалы для получения имен
+	branchMap := make(map[string]string)
+	var branchIDs []string
+	for _, batch := range batches {
+		if _, exists := branchMap[batch.BranchID]; !exists {
+			branchIDs = append(branchIDs, batch.BranchID)
+		}
+	}
+
+	if len(branchIDs) > 0 {
+		var branches []models.Branch
+		if err := s.db.Where("id IN ?", branchIDs).Find(&branches).Error; err == nil {
+			for _, branch := range branches {
+				branchMap[branch.ID] = branch.Name
+			}
+		}
+	}
+
+	// Загружаем накладные для получения номеров
+	invoiceMap := make(map[string]string) // invoiceID -> invoiceNumber
+	var invoiceIDs []string
+	for _, batch := range batches {
+		if batch.InvoiceID != nil && *batch.InvoiceID != "" {
+			if _, exists := invoiceMap[*batch.InvoiceID]; !exists {
+				invoiceIDs = append(invoiceIDs, *batch.InvoiceID)
+			}
+		}
+	}
+
+	if len(invoiceIDs) > 0 {
+		var invoices []models.Invoice
+		if err := s.db.Where("id IN ?", invoiceIDs).Find(&invoices).Error; err == nil {
+			for _, invoice := range invoices {
+				invoiceMap[invoice.ID] = invoice.Number
+			}
+		}
+	}
+
+	// Группируем по товарам и филиалам
+	stockMap := make(map[string]map[string]interface{})
+
+	for _, batch := range batches {
+		key := batch.NomenclatureID + "_" + batch.BranchID
+		nomenclature := batch.Nomenclature
+
+		// Вычисляем коэффициент конвертации для правильного расчета стоимости
+		// cost_per_unit всегда за InboundUnit (кг/л/шт), а current_stock может быть в Base Unit (г)
+		conversionFactor := costConversionFactor(nomenclature)
+		baseUnit := nomenclature.BaseUnit
+		inboundUnit := nomenclature.InboundUnit
+
+		// ВАЖНО: CostPerUnit никогда не меняется - это константа закупки (цена за InboundUnit)
+		// ПРАВИЛЬНАЯ формула расчета стоимости:
+		// TotalValue = (RemainingQuantityInGrams * CostPerKg) / 1000
+		// Пример: (10000г * 1234₽/кг) / 1000 = 12,340₽
+		//
+		// Чтение остатков НЕ исправляет цену: дешевый товар (< 10₽/кг) - это нормально.
+		// Цена за грамм приводится к цене за кг при оприходовании (price_entry_unit номенклатуры).
+		// Ошибочные цены старых партий ищутся через FindSuspectedCostErrors
+		// и исправляются явно через CorrectBatchCost (с записью в журнал движений)
+		costPerUnit := batch.CostPerUnit
+
+		// Логирование для отладки
+		log.Printf("🔍 GetStockItems: расчет стоимости для %s (ID: %s)", nomenclature.Name, batch.NomenclatureID)
+		log.Printf("   RemainingQuantity: %.2f %s", batch.RemainingQuantity, baseUnit)
+		log.Printf("   CostPerUnit (из БД): %.4f₽/%s", batch.CostPerUnit, inboundUnit)
+		log.Printf("   ConversionFactor: %.0f", conversionFactor.InexactFloat64())
+		// КРИТИЧЕСКИ ВАЖНО: batch.RemainingQuantity должен быть в BaseUnit
+		// Если BaseUnit = "g", а RemainingQuantity < 1000, возможно он сохранен в кг - конвертируем
+		var batchRemainingQtyForCalc float64 = batch.RemainingQuantity
+		if baseUnit == "g" && batch.RemainingQuantity < 1000 && batch.RemainingQuantity > 0 {
+			// Умножаем на 1000 для конвертации в граммы
+			batchRemainingQtyForCalc = batch.RemainingQuantity * 1000
+		} else if baseUnit == "ml" && batch.RemainingQuantity < 1000 && batch.RemainingQuantity > 0 {
+			// Аналогично для миллилитров
+			batchRemainingQtyForCalc = batch.RemainingQuantity * 1000
+		}
+
+		log.Printf("   Формула: (%.2f * %.2f) / %.0f", batchRemainingQtyForCalc, costPerUnit, conversionFactor.InexactFloat64())
+
+		batchCostValueDecimal := calculateBatchValue(
+			decimal.NewFromFloat(batchRemainingQtyForCalc), // Остаток в BaseUnit (граммы/мл) - исправленный если нужно
+			decimal.NewFromFloat(costPerUnit),              // Цена за InboundUnit (цена за 1кг/1л)
+			conversionFactor,                               // Коэффициент конвертации (1000 для г->кг)
+		)
+
+		log.Printf("   Результат: %.2f₽", batchCostValueDecimal.InexactFloat64())
+		// Правильный расчет ожидаемого результата с учетом реального BaseUnit
+		var expectedResult float64
+		if conversionFactor.GreaterThan(decimal.NewFromInt(1)) {
+			expectedResult = (batchRemainingQtyForCalc * costPerUnit) / conversionFactor.InexactFloat64()
+		} else {
+			expectedResult = batchRemainingQtyForCalc * costPerUnit
+		}
+		log.Printf("   Ожидаемый результат для %.2f %s по %.2f₽/%s: %.2f₽",
+			batchRemainingQtyForCalc, baseUnit, costPerUnit, inboundUnit, expectedResult)
+
+		if stockItem, exists := stockMap[key]; exists {
+			// Обновляем существующий товар
+			// КРИТИЧЕСКИ ВАЖНО: batch.RemainingQuantity должен быть в BaseUnit
+			// Если BaseUnit = "g", а RemainingQuantity < 1000, возможно он сохранен в кг - конвертируем
+			var batchRemainingQty float64 = batch.RemainingQuantity
+			if baseUnit == "g" && batch.RemainingQuantity < 1000 && batch.RemainingQuantity > 0 {
+				// Проверяем, возможно RemainingQuantity сохранен в килограммах вместо граммов
+				// Если значение меньше 1000 и больше 0, вероятно это килограммы
+				// Умножаем на 1000 для конвертации в граммы
+				batchRemainingQty = batch.RemainingQuantity * 1000
+				log.Printf("⚠️ GetStockItems: исправление единиц для %s (ID: %s): %.2f кг -> %.2f г",
+					nomenclature.Name, batch.NomenclatureID, batch.RemainingQuantity, batchRemainingQty)
+			} else if baseUnit == "ml" && batch.RemainingQuantity < 1000 && batch.RemainingQuantity > 0 {
+				// Аналогично для миллилитров
+				batchRemainingQty = batch.RemainingQuantity * 1000
+				log.Printf("⚠️ GetStockItems: исправление единиц для %s (ID: %s): %.2f л -> %.2f мл",
+					nomenclature.Name, batch.NomenclatureID, batch.RemainingQuantity, batchRemainingQty)
+			}
+			currentStock := stockItem["current_stock"].(float64) + batchRemainingQty
+			stockItem["current_stock"] = currentStock
+
+			// Суммируем стоимость всех батчей (каждый батч может иметь свою цену)
+			// ВАЖНО: Не пересчитываем общую стоимость по средневзвешенной цене,
+			// а суммируем стоимость каждого батча отдельно по правильной формуле:
+			// TotalCost = Sum((RemainingQuantity_i * CostPerUnit_i) / ConversionFactor)
+			// Сначала умножаем, потом делим - это избегает потери точности
+			existingCostValue := decimal.NewFromFloat(stockItem["cost_value"].(float64))
+			totalCostValue := existingCostValue.Add(batchCostValueDecimal)
+			stockItem["cost_value"] = totalCostValue.InexactFloat64()
+
+			// ПРИМЕЧАНИЕ: cost_per_unit в итоговом объекте берется от последнего батча (для отображения)
+			// Реальная стоимость рассчитывается через суммирование стоимости каждого батча отдельно
+			stockItem["cost_per_unit"] = costPerUnit
+
+			// Обновляем branch_name, если его еще нет
+			if _, hasBranchName := stockItem["branch_name"]; !hasBranchName {
+				stockItem["branch_name"] = branchMap[batch.BranchID]
+			}
+
+			// Обновляем информацию о сроках годности
+			batchesList := stockItem["batches"].([]map[string]interface{})
+
+			batchData := map[string]interface{}{
+				"id":                 batch.ID,
+				"quantity":           batch.RemainingQuantity,
+				"expiry_at":          batch.ExpiryAt,
+				"days_until_expiry":  s.calculateDaysUntilExpiry(batch.ExpiryAt),
+				"hours_until_expiry": s.calculateHoursUntilExpiry(batch.ExpiryAt),
+				"is_expired":         batch.IsExpired,
+				"is_at_risk":         s.isAtRisk(batch),
+				"cost_per_unit":      batch.CostPerUnit, // Цена за InboundUnit (как сохранена в партии)
+			}
+			// Добавляем информацию о накладной, если есть
+			if batch.InvoiceID != nil && *batch.InvoiceID != "" {
+				batchData["invoice_id"] = *batch.InvoiceID
+				if invoiceNumber, exists := invoiceMap[*batch.InvoiceID]; exists {
+					batchData["invoice_number"] = invoiceNumber
+				}
+			}
+			batchesList = append(batchesList, batchData)
+			stockItem["batches"] = batchesList
+		} else {
+			// Создаем новый товар
+			minStock := nomenclature.MinStockLevel
+			// КРИТИЧЕСКИ ВАЖНО: batch.RemainingQuantity должен быть в BaseUnit
+			// Если BaseUnit = "g", а RemainingQuantity < 1000, возможно он сохранен в кг - конвертируем
+			var currentStock float64 = batch.RemainingQuantity
+			if baseUnit == "g" && batch.RemainingQuantity < 1000 && batch.RemainingQuantity > 0 {
+				// Проверяем, возможно RemainingQuantity сохранен в килограммах вместо граммов
+				// Если значение меньше 1000 и больше 0, вероятно это килограммы
+				// Умножаем на 1000 для конвертации в граммы
+				currentStock = batch.RemainingQuantity * 1000
+				log.Printf("⚠️ GetStockItems: исправление единиц для %s (ID: %s): %.2f кг -> %.2f г",
+					nomenclature.Name, batch.NomenclatureID, batch.RemainingQuantity, currentStock)
+			} else if baseUnit == "ml" && batch.RemainingQuantity < 1000 && batch.RemainingQuantity > 0 {
+				// Аналогично для миллилитров
+				currentStock = batch.RemainingQuantity * 1000
+				log.Printf("⚠️ GetStockItems: исправление единиц для %s (ID: %s): %.2f л -> %.2f мл",
+					nomenclature.Name, batch.NomenclatureID, batch.RemainingQuantity, currentStock)
+			}
+
+			status := "in_stock"
+			if currentStock <= 0 {
+				status = "out_of_stock"
+			} else if currentStock < minStock {
+				status = "low_stock"
+			}
+
+			// Вычисляем cost_value используя правильную формулу
+			// Формула: (Остаток в BaseUnit * Цена за InboundUnit) / ConversionFactor
+			costValue := batchCostValueDecimal.InexactFloat64()
+
+			stockMap[key] = map[string]interface{}{
+				"id":             nomenclature.ID,
+				"product_id":     nomenclature.ID,
+				"product_name":   nomenclature.Name,
+				"category":       nomenclature.CategoryName,
+				"category_color": nomenclature.CategoryColor,
+				"category_id":    nomenclature.CategoryID,
+				"unit":           nomenclature.InboundUnit, // Единица измерения для отображения (кг/л/шт) - используется для цены
+				"base_unit":      nomenclature.BaseUnit,    // Базовая единица склада (г/мл/шт) - для точного учета
+				"inbound_unit":   nomenclature.InboundUnit, // Единица поступления (кг/л/шт) - для цены закупки
+				"branch_id":      batch.BranchID,
+				"branch_name":    branchMap[batch.BranchID], // Добавляем имя филиала
+				"current_stock":  currentStock,              // В BaseUnit
+				"min_stock":      minStock,
+				"cost_per_unit":  costPerUnit, // Цена за InboundUnit (кг/л/шт)
+				"cost_value":     costValue,   // Стоимость = (currentStockInBaseUnit * CorrectedCostPerUnit) / ConversionFactor
+				"status":         status,
+				"batches": []map[string]interface{}{
+					func() map[string]interface{} {
+						batchData := map[string]interface{}{
+							"id":                 batch.ID,
+							"quantity":           batch.RemainingQuantity,
+							"expiry_at":          batch.ExpiryAt,
+							"days_until_expiry":  s.calculateDaysUntilExpiry(batch.ExpiryAt),
+							"hours_until_expiry": s.calculateHoursUntilExpiry(batch.ExpiryAt),
+							"is_expired":         batch.IsExpired,
+							"is_at_risk":         s.isAtRisk(batch),
+							"cost_per_unit":      batch.CostPerUnit, // Цена за InboundUnit (как сохранена в партии)
+						}
+						// Добавляем информацию о накладной, если есть
+						if batch.InvoiceID != nil && *batch.InvoiceID != "" {
+							batchData["invoice_id"] = *batch.InvoiceID
+							if invoiceNumber, exists := invoiceMap[*batch.InvoiceID]; exists {
+								batchData["invoice_number"] = invoiceNumber
+							}
+						}
+						return batchData
+					}(),
+				},
+			}
+		}
+	}
+
+	// Преобразуем map в slice
+	result := make([]map[string]interface{}, 0, len(stockMap))
+	for _, item := range stockMap {
+		result = append(result, item)
+	}
+
+	return result, nil
+}
+
+// stockFixture - товары и партии одного тестового филиала
+type stockFixture struct {
+	branchID     string
+	mozzarellaID string
+}
+
+// newStockFixture создает на отдельном филиале: товар в граммах с партиями по двум ценам
+// (включая остаток < 1000, который считается сохраненным в кг), штучный товар, просроченную партию
+// и партию удаленной номенклатуры
+func newStockFixture(t testing.TB, db *gorm.DB) stockFixture {
+	t.Helper()
+	branchID := uuid.New().String()
+	categoryID := uuid.New().String()
+	newItem := func(name, baseUnit, inboundUnit string, minStock float64) models.NomenclatureItem {
+		item := models.NomenclatureItem{
+			SKU:           "TEST-" + uuid.New().String()[:8],
+			Name:          name,
+			CategoryID:    &categoryID,
+			CategoryName:  "Тест",
+			BaseUnit:      baseUnit,
+			InboundUnit:   inboundUnit,
+			MinStockLevel: minStock,
+			IsActive:      true,
+		}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("не удалось создать товар: %v", err)
+		}
+		return item
+	}
+	mozzarella := newItem("Моцарелла", "g", "kg", 600000)
+	eggs := newItem("Яйца", "pcs", "pcs", 10)
+	cream := newItem("Сливки", "ml", "l", 0)
+	deleted := newItem("Удаленный товар", "g", "kg", 0)
+
+	created := time.Now().Add(-time.Hour)
+	newBatch := func(item models.NomenclatureItem, remaining, cost float64, expired bool) {
+		created = created.Add(time.Minute)
+		batch := models.StockBatch{
+			NomenclatureID:    item.ID,
+			BranchID:          branchID,
+			Quantity:          remaining,
+			RemainingQuantity: remaining,
+			Unit:              item.BaseUnit,
+			CostPerUnit:       cost,
+			Source:            "adjustment",
+			IsExpired:         expired,
+			CreatedAt:         created,
+		}
+		if err := db.Create(&batch).Error; err != nil {
+			t.Fatalf("не удалось создать партию: %v", err)
+		}
+	}
+	newBatch(mozzarella, 10000, 500, false)
+	newBatch(mozzarella, 2000, 520, false)
+	newBatch(mozzarella, 500, 500, false) // < 1000 г - считается 500 кг
+	newBatch(eggs, 30, 12.5, false)
+	newBatch(eggs, 12, 12, false)
+	newBatch(cream, 5000, 300, true)
+	newBatch(deleted, 1000, 100, false)
+	if err := db.Delete(&deleted).Error; err != nil {
+		t.Fatalf("не удалось удалить товар: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Unscoped().Where("category_id = ?", categoryID).Delete(&models.NomenclatureItem{})
+	})
+	return stockFixture{branchID: branchID, mozzarellaID: mozzarella.ID}
+}
+
+// stockItemsByKey раскладывает строки остатков по nomenclature_id + branch_id
+func stockItemsByKey(items []map[string]interface{}) map[string]map[string]interface{} {
+	result := make(map[string]map[string]interface{}, len(items))
+	for _, item := range items {
+		result[fmt.Sprint(item["id"])+"_"+fmt.Sprint(item["branch_id"])] = item
+	}
+	return result
+}
+
+// assertSameStockItems сравнивает строки остатков; withBatches=false - без разбивки по партиям
+func assertSameStockItems(t *testing.T, got, want []map[string]interface{}, withBatches bool) {
+	t.Helper()
+	gotByKey, wantByKey := stockItemsByKey(got), stockItemsByKey(want)
+	if len(gotByKey) != len(wantByKey) {
+		t.Fatalf("строк остатков %d, want %d", len(gotByKey), len(wantByKey))
+	}
+	for key, wantItem := range wantByKey {
+		gotItem, ok := gotByKey[key]
+		if !ok {
+			t.Errorf("нет строки %s", key)
+			continue
+		}
+		for field, wantValue := range wantItem {
+			if field == "batches" {
+				continue
+			}
+			if !reflect.DeepEqual(gotItem[field], wantValue) {
+				t.Errorf("%s: %s = %#v, want %#v", key, field, gotItem[field], wantValue)
+			}
+		}
+		if len(gotItem) != len(wantItem) {
+			t.Errorf("%s: полей %d, want %d", key, len(gotItem), len(wantItem))
+		}
+
+		gotBatches := gotItem["batches"].([]map[string]interface{})
+		if !withBatches {
+			if len(gotBatches) != 0 {
+				t.Errorf("%s: в общем списке партий %d, want 0", key, len(gotBatches))
+			}
+			continue
+		}
+		wantBatches := wantItem["batches"].([]map[string]interface{})
+		wantBatchByID := make(map[interface{}]map[string]interface{}, len(wantBatches))
+		for _, batch := range wantBatches {
+			wantBatchByID[batch["id"]] = batch
+		}
+		if len(gotBatches) != len(wantBatches) {
+			t.Errorf("%s: партий %d, want %d", key, len(gotBatches), len(wantBatches))
+		}
+		for _, batch := range gotBatches {
+			if !reflect.DeepEqual(batch, wantBatchByID[batch["id"]]) {
+				t.Errorf("%s: партия %v = %#v, want %#v", key, batch["id"], batch, wantBatchByID[batch["id"]])
+			}
+		}
+	}
+}
+
+func TestGetStockItemsMatchesLegacy(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.NomenclatureItem{}, &models.StockBatch{})
+	service := NewStockService(db)
+	fixture := newStockFixture(t, db)
+
+	for _, includeExpired := range []bool{false, true} {
+		want, err := service.legacyGetStockItems(fixture.branchID, includeExpired)
+		if err != nil {
+			t.Fatalf("legacyGetStockItems: %v", err)
+		}
+		got, err := service.GetStockItems(fixture.branchID, includeExpired)
+		if err != nil {
+			t.Fatalf("GetStockItems: %v", err)
+		}
+		assertSameStockItems(t, got, want, false)
+
+		// Один товар - с разбивкой по партиям, как в прежнем ответе
+		detail, err := service.GetStockItemBatches(fixture.mozzarellaID, fixture.branchID, includeExpired)
+		if err != nil {
+			t.Fatalf("GetStockItemBatches: %v", err)
+		}
+		var wantDetail []map[string]interface{}
+		for _, item := range want {
+			if item["id"] == fixture.mozzarellaID {
+				wantDetail = append(wantDetail, item)
+			}
+		}
+		assertSameStockItems(t, detail, wantDetail, true)
+	}
+
+	// Контрольные значения: 500 г по 500₽/кг считаются 500 кг, цена строки - самой новой партии
+	items, _ := service.GetStockItemBatches(fixture.mozzarellaID, fixture.branchID, false)
+	if len(items) != 1 {
+		t.Fatalf("строк моцареллы %d, want 1", len(items))
+	}
+	if got := items[0]["current_stock"]; got != 512000.0 {
+		t.Errorf("current_stock = %v, want 512000", got)
+	}
+	if got := items[0]["cost_value"]; got != 256040.0 {
+		t.Errorf("cost_value = %v, want 256040 (255000 + 1040)", got)
+	}
+	if got := items[0]["cost_per_unit"]; got != 500.0 {
+		t.Errorf("cost_per_unit = %v, want 500", got)
+	}
+	if got := items[0]["status"]; got != "low_stock" {
+		t.Errorf("status = %v, want low_stock", got)
+	}
+}
+
+// BenchmarkGetStockItems сравнивает загрузку всех партий в память (legacy) и агрегацию в SQL
+// на филиале с 200 товарами по 50 партий (TEST_DATABASE_URL, go test -bench GetStockItems -run ^$)
+func BenchmarkGetStockItems(b *testing.B) {
+	db := newTestDB(b, &models.LegalEntity{}, &models.Branch{}, &models.NomenclatureItem{}, &models.StockBatch{})
+	service := NewStockService(db)
+
+	branchID := uuid.New().String()
+	categoryID := uuid.New().String()
+	for i := 0; i < 200; i++ {
+		item := models.NomenclatureItem{
+			SKU:         "BENCH-" + uuid.New().String()[:8],
+			Name:        fmt.Sprintf("Товар %d", i),
+			CategoryID:  &categoryID,
+			BaseUnit:    "g",
+			InboundUnit: "kg",
+			IsActive:    true,
+		}
+		if err := db.Create(&item).Error; err != nil {
+			b.Fatalf("не удалось создать товар: %v", err)
+		}
+		batches := make([]models.StockBatch, 0, 50)
+		for j := 0; j < 50; j++ {
+			batches = append(batches, models.StockBatch{
+				ID:                uuid.New().String(),
+				NomenclatureID:    item.ID,
+				BranchID:          branchID,
+				Quantity:          5000,
+				RemainingQuantity: float64(1000 + j*10),
+				Unit:              "g",
+				CostPerUnit:       float64(100 + j%5),
+				Source:            "adjustment",
+			})
+		}
+		if err := db.CreateInBatches(batches, 500).Error; err != nil {
+			b.Fatalf("не удалось создать партии: %v", err)
+		}
+	}
+	b.Cleanup(func() {
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Unscoped().Where("category_id = ?", categoryID).Delete(&models.NomenclatureItem{})
+	})
+
+	// Прежняя реализация пишет несколько строк лога на каждую партию
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	b.Run("legacy", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := service.legacyGetStockItems(branchID, false); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("sql", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := service.GetStockItems(branchID, false); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
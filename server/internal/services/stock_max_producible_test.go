@@ -0,0 +1,112 @@
+package services
+
+import (
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Пицца: 200 г теста (полуфабрикат, порция 1000 г: 600 г муки + 400 г воды), 150 г сыра, 5 г базилика (опционально)
+// Теста хватает на 50 пицц, сыра с учетом резерва - на 8: узкое место - сыр
+func TestGetMaxProducible(t *testing.T) {
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.NomenclatureItem{}, &models.NomenclatureCategory{},
+		&models.Recipe{}, &models.RecipeIngredient{}, &models.StockBatch{}, &models.StockMovement{}, &models.StockReservation{})
+	service := NewStockService(db)
+	branchID := newTestBranch(t, db)
+
+	var itemIDs, recipeIDs []string
+	newItem := func(name string) *string {
+		item := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: name, BaseUnit: "g", IsActive: true}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("не удалось создать товар: %v", err)
+		}
+		itemIDs = append(itemIDs, item.ID)
+		return &item.ID
+	}
+	newRecipe := func(name string, portionSize float64, ingredients ...models.RecipeIngredient) *string {
+		recipe := models.Recipe{Name: name + " " + uuid.New().String()[:8], IsActive: true, PortionSize: portionSize,
+			PhotoURLs: "[]", Ingredients: ingredients}
+		if err := db.Create(&recipe).Error; err != nil {
+			t.Fatalf("не удалось создать рецепт: %v", err)
+		}
+		recipeIDs = append(recipeIDs, recipe.ID)
+		return &recipe.ID
+	}
+	addStock := func(nomenclatureID *string, quantity float64, expired bool) {
+		t.Helper()
+		batch := models.StockBatch{NomenclatureID: *nomenclatureID, BranchID: branchID, Quantity: quantity,
+			RemainingQuantity: quantity, Unit: "g", Source: "adjustment", IsExpired: expired}
+		if err := db.Create(&batch).Error; err != nil {
+			t.Fatalf("не удалось создать партию: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		db.Where("branch_id = ?", branchID).Delete(&models.StockReservation{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Where("recipe_id IN ?", recipeIDs).Delete(&models.RecipeIngredient{})
+		db.Unscoped().Where("id IN ?", recipeIDs).Delete(&models.Recipe{})
+		db.Unscoped().Where("id IN ?", itemIDs).Delete(&models.NomenclatureItem{})
+	})
+
+	flour, water, cheese, basil := newItem("Мука"), newItem("Вода"), newItem("Сыр"), newItem("Базилик")
+	dough := newRecipe("Тесто", 1000,
+		models.RecipeIngredient{NomenclatureID: flour, Quantity: 600, Unit: "g"},
+		models.RecipeIngredient{NomenclatureID: water, Quantity: 400, Unit: "g"},
+	)
+	pizza := newRecipe("Пицца", 1,
+		models.RecipeIngredient{IngredientRecipeID: dough, Quantity: 200, Unit: "g"},
+		models.RecipeIngredient{NomenclatureID: cheese, Quantity: 150, Unit: "g"},
+		models.RecipeIngredient{NomenclatureID: basil, Quantity: 5, Unit: "g", IsOptional: true},
+	)
+	empty := newRecipe("Без ингредиентов", 1, models.RecipeIngredient{NomenclatureID: basil, Quantity: 5, Unit: "g", IsOptional: true})
+
+	addStock(flour, 6000, false) // 10 порций теста
+	addStock(water, 8000, false) // 20 порций теста
+	addStock(cheese, 1000, false)
+	addStock(cheese, 500, false)
+	addStock(cheese, 5000, true) // Просроченный сыр не считается
+	reservation := models.StockReservation{OrderID: "order-" + uuid.New().String()[:8], RecipeID: *pizza, BranchID: branchID,
+		NomenclatureID: *cheese, Quantity: 300, Unit: "g", Status: models.ReservationStatusReserved}
+	if err := db.Create(&reservation).Error; err != nil {
+		t.Fatalf("не удалось создать резерв: %v", err)
+	}
+
+	cases := []struct {
+		recipeID   *string
+		want       float64
+		bottleneck string
+	}{
+		{pizza, 8, "Сыр"},   // (1500 - 300) / 150
+		{dough, 10, "Мука"}, // 6000 / 600
+	}
+	for _, tc := range cases {
+		got, bottleneck, err := service.GetMaxProducible(*tc.recipeID, branchID)
+		if err != nil {
+			t.Fatalf("GetMaxProducible: %v", err)
+		}
+		if got != tc.want || bottleneck != tc.bottleneck {
+			t.Errorf("GetMaxProducible(%s) = %v, %q; want %v, %q", *tc.recipeID, got, bottleneck, tc.want, tc.bottleneck)
+		}
+	}
+
+	// Муки осталось на 1 порцию теста = 5 пицц: узкое место уходит внутрь полуфабриката
+	if err := db.Model(&models.StockBatch{}).Where("nomenclature_id = ?", *flour).Update("remaining_quantity", 600).Error; err != nil {
+		t.Fatalf("не удалось изменить остаток: %v", err)
+	}
+	if got, bottleneck, err := service.GetMaxProducible(*pizza, branchID); err != nil || got != 5 || bottleneck != "Мука" {
+		t.Errorf("GetMaxProducible после расхода муки = %v, %q, %v; want 5, Мука", got, bottleneck, err)
+	}
+
+	// В другом филиале ничего нет
+	if got, _, err := service.GetMaxProducible(*pizza, uuid.New().String()); err != nil || got != 0 {
+		t.Errorf("GetMaxProducible в пустом филиале = %v, %v; want 0", got, err)
+	}
+	if _, _, err := service.GetMaxProducible(*empty, branchID); err == nil {
+		t.Error("рецепт только из опциональных ингредиентов: want ошибку")
+	}
+	if _, _, err := service.GetMaxProducible(uuid.New().String(), branchID); err == nil {
+		t.Error("несуществующий рецепт: want ошибку")
+	}
+}
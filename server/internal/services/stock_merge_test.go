@@ -0,0 +1,133 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// stockTotals возвращает число живых партий, суммарный остаток и стоимость остатка товара в филиале
+func stockTotals(t *testing.T, db *gorm.DB, nomenclatureID, branchID string) (int, decimal.Decimal, decimal.Decimal) {
+	t.Helper()
+	var batches []models.StockBatch
+	if err := db.Where("nomenclature_id = ? AND branch_id = ?", nomenclatureID, branchID).Find(&batches).Error; err != nil {
+		t.Fatalf("не удалось прочитать партии: %v", err)
+	}
+	quantity, value := decimal.Zero, decimal.Zero
+	for _, batch := range batches {
+		remaining := decimal.NewFromFloat(batch.RemainingQuantity)
+		quantity = quantity.Add(remaining)
+		value = value.Add(remaining.Mul(decimal.NewFromFloat(batch.CostPerUnit)))
+	}
+	return len(batches), quantity, value
+}
+
+func TestMergeBatchesKeepsQuantityAndValue(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.StockBatch{}, &models.StockMovement{}, &models.ExpiryAlert{})
+
+	item := models.NomenclatureItem{
+		SKU:      "TEST-" + uuid.New().String()[:8],
+		Name:     "Томаты",
+		BaseUnit: "kg",
+		IsActive: true,
+	}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	branchID := uuid.New().String()
+	t.Cleanup(func() {
+		db.Unscoped().Where("nomenclature_id = ? AND branch_id = ?", item.ID, branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("nomenclature_id = ? AND branch_id = ?", item.ID, branchID).Delete(&models.StockBatch{})
+		db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+	})
+
+	// Пять одинаковых партий (день истечения, цена, единица) и одна с другой ценой
+	expiresAt := time.Now().UTC().AddDate(0, 0, 10)
+	remaining := []float64{1.1, 2.2, 3.3, 4.4, 5.5}
+	batchIDs := make([]string, 0, len(remaining))
+	for i := range remaining {
+		batch := models.StockBatch{
+			NomenclatureID:    item.ID,
+			BranchID:          branchID,
+			Quantity:          3.3,
+			RemainingQuantity: remaining[i],
+			Unit:              "kg",
+			CostPerUnit:       123.45,
+			ExpiryAt:          &expiresAt,
+			Source:            "adjustment",
+			CreatedAt:         time.Now().Add(time.Duration(i) * time.Second),
+		}
+		if err := db.Create(&batch).Error; err != nil {
+			t.Fatalf("не удалось создать партию: %v", err)
+		}
+		batchIDs = append(batchIDs, batch.ID)
+	}
+	other := models.StockBatch{
+		NomenclatureID:    item.ID,
+		BranchID:          branchID,
+		Quantity:          2,
+		RemainingQuantity: 2,
+		Unit:              "kg",
+		CostPerUnit:       99.9,
+		ExpiryAt:          &expiresAt,
+		Source:            "adjustment",
+	}
+	if err := db.Create(&other).Error; err != nil {
+		t.Fatalf("не удалось создать партию: %v", err)
+	}
+
+	// Движение поглощаемой партии должно перейти к наследнику
+	movement := models.StockMovement{
+		StockBatchID:   &batchIDs[3],
+		NomenclatureID: item.ID,
+		BranchID:       branchID,
+		Quantity:       -0.5,
+		Unit:           "kg",
+		MovementType:   "sale",
+	}
+	if err := db.Create(&movement).Error; err != nil {
+		t.Fatalf("не удалось создать движение: %v", err)
+	}
+
+	countBefore, quantityBefore, valueBefore := stockTotals(t, db, item.ID, branchID)
+
+	merged, err := NewStockService(db).MergeBatches(item.ID, branchID)
+	if err != nil {
+		t.Fatalf("MergeBatches: %v", err)
+	}
+	if merged != 4 {
+		t.Errorf("поглощено партий = %d, want 4", merged)
+	}
+
+	countAfter, quantityAfter, valueAfter := stockTotals(t, db, item.ID, branchID)
+	if countBefore != 6 || countAfter != 2 {
+		t.Errorf("партий до/после = %d/%d, want 6/2", countBefore, countAfter)
+	}
+	if !quantityAfter.Equal(quantityBefore) {
+		t.Errorf("остаток после объединения = %s, want %s", quantityAfter, quantityBefore)
+	}
+	if !valueAfter.Equal(valueBefore) {
+		t.Errorf("стоимость после объединения = %s, want %s", valueAfter, valueBefore)
+	}
+
+	var survivor models.StockBatch
+	if err := db.First(&survivor, "id = ?", batchIDs[0]).Error; err != nil {
+		t.Fatalf("самая ранняя партия должна остаться наследником: %v", err)
+	}
+	if survivor.Quantity != 16.5 || survivor.RemainingQuantity != 16.5 {
+		t.Errorf("наследник: quantity %v, remaining %v, want 16.5/16.5", survivor.Quantity, survivor.RemainingQuantity)
+	}
+
+	var moved models.StockMovement
+	if err := db.First(&moved, "id = ?", movement.ID).Error; err != nil {
+		t.Fatalf("не удалось прочитать движение: %v", err)
+	}
+	if moved.StockBatchID == nil || *moved.StockBatchID != survivor.ID {
+		t.Errorf("движение привязано к %v, want наследника %s", moved.StockBatchID, survivor.ID)
+	}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// 1500 движений (больше прежнего лимита 1000) читаются страницами без пропусков и повторов,
+// даже когда у нескольких движений одинаковое время
+func TestGetStockMovementsPagesThroughAll(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.StockBatch{}, &models.StockMovement{})
+	service := NewStockService(db)
+	branchID := uuid.New().String()
+
+	var itemIDs []string
+	newItem := func(name string) string {
+		t.Helper()
+		item := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: name, BaseUnit: "g", IsActive: true}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("не удалось создать товар: %v", err)
+		}
+		itemIDs = append(itemIDs, item.ID)
+		return item.ID
+	}
+	t.Cleanup(func() {
+		db.Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("id IN ?", itemIDs).Delete(&models.NomenclatureItem{})
+	})
+	flour, cheese := newItem("Мука"), newItem("Сыр")
+
+	const total = 1500
+	start := time.Date(2030, 5, 1, 8, 0, 0, 0, time.UTC)
+	movements := make([]models.StockMovement, 0, total)
+	for i := 0; i < total; i++ {
+		nomenclatureID, performedBy := flour, "повар"
+		if i%3 == 0 {
+			nomenclatureID, performedBy = cheese, "кладовщик"
+		}
+		movements = append(movements, models.StockMovement{
+			NomenclatureID: nomenclatureID,
+			BranchID:       branchID,
+			Quantity:       -1,
+			Unit:           "g",
+			MovementType:   "sale",
+			PerformedBy:    performedBy,
+			CreatedAt:      start.Add(time.Duration(i/4) * time.Minute), // По 4 движения на минуту
+		})
+	}
+	if err := db.CreateInBatches(&movements, 500).Error; err != nil {
+		t.Fatalf("не удалось создать движения: %v", err)
+	}
+
+	seen := make(map[string]bool, total)
+	var previous time.Time
+	for offset := 0; ; offset += 400 {
+		page, count, err := service.GetStockMovements(StockMovementFilter{BranchID: branchID, Limit: 400, Offset: offset})
+		if err != nil {
+			t.Fatalf("GetStockMovements(offset %d): %v", offset, err)
+		}
+		if count != total {
+			t.Fatalf("общее количество %d, want %d", count, total)
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, movement := range page {
+			if seen[movement.ID] {
+				t.Fatalf("движение %s встретилось на двух страницах (offset %d)", movement.ID, offset)
+			}
+			seen[movement.ID] = true
+			if !previous.IsZero() && movement.CreatedAt.After(previous) {
+				t.Fatalf("нарушен порядок created_at DESC на offset %d", offset)
+			}
+			previous = movement.CreatedAt
+		}
+	}
+	if len(seen) != total {
+		t.Errorf("прочитано %d движений, want %d", len(seen), total)
+	}
+
+	// Фильтры по товару и сотруднику; количество - по примененным фильтрам
+	filters := []struct {
+		filter StockMovementFilter
+		want   int64
+	}{
+		{StockMovementFilter{BranchID: branchID, NomenclatureID: cheese}, 500},
+		{StockMovementFilter{BranchID: branchID, PerformedBy: "повар"}, 1000},
+		{StockMovementFilter{BranchID: branchID, NomenclatureID: flour, PerformedBy: "кладовщик"}, 0},
+		{StockMovementFilter{BranchID: branchID, DateFrom: "2030-05-01T08:00:00Z", DateTo: "2030-05-01T08:09:59Z"}, 40},
+		{StockMovementFilter{BranchID: branchID, Search: "Сыр"}, 500},
+	}
+	for _, tc := range filters {
+		page, count, err := service.GetStockMovements(tc.filter)
+		if err != nil {
+			t.Fatalf("GetStockMovements(%+v): %v", tc.filter, err)
+		}
+		if count != tc.want {
+			t.Errorf("GetStockMovements(%+v): всего %d, want %d", tc.filter, count, tc.want)
+		}
+		if int64(len(page)) != tc.want {
+			t.Errorf("GetStockMovements(%+v): на странице %d, want %d (лимит по умолчанию 1000)", tc.filter, len(page), tc.want)
+		}
+	}
+
+	// Без лимита возвращается не больше 1000, общее количество - полное
+	page, count, err := service.GetStockMovements(StockMovementFilter{BranchID: branchID})
+	if err != nil {
+		t.Fatalf("GetStockMovements: %v", err)
+	}
+	if len(page) != 1000 || count != total {
+		t.Errorf("страница по умолчанию %d из %d, want 1000 из %d", len(page), count, total)
+	}
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+func TestInQuarantine(t *testing.T) {
+	now := time.Date(2030, 3, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		expiryAt   time.Time
+		quarantine time.Duration
+		want       bool
+	}{
+		{now.Add(10 * time.Hour), 24 * time.Hour, true},
+		{now.Add(24 * time.Hour), 24 * time.Hour, true}, // Граница окна уже в карантине
+		{now.Add(24*time.Hour + time.Second), 24 * time.Hour, false},
+		{now.Add(-time.Hour), 24 * time.Hour, true},
+		{now.Add(time.Hour), 0, false}, // Без карантина партия списывается до самого срока
+	}
+	for _, tc := range cases {
+		if got := inQuarantine(tc.expiryAt, tc.quarantine, now); got != tc.want {
+			t.Errorf("inQuarantine(%v до срока, карантин %v) = %v, want %v", tc.expiryAt.Sub(now), tc.quarantine, got, tc.want)
+		}
+	}
+}
+
+// Сыр с карантином 24 ч: партия, истекающая через 10 ч, пропускается при списании и проверке доступности
+// в пользу партии с дальним сроком, но остается в списке at-risk к списанию
+func TestQuarantinedBatchIsSkipped(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureCategory{}, &models.NomenclatureItem{}, &models.Recipe{}, &models.RecipeIngredient{},
+		&models.StockBatch{}, &models.StockMovement{})
+	service := NewStockService(db)
+	suffix := uuid.New().String()[:8]
+	branchID := uuid.New().String()
+
+	category := models.NomenclatureCategory{Name: "Сыры " + suffix, QuarantineHours: 24}
+	if err := db.Create(&category).Error; err != nil {
+		t.Fatalf("не удалось создать категорию: %v", err)
+	}
+	cheese := models.NomenclatureItem{SKU: "TEST-" + suffix, Name: "Моцарелла " + suffix, BaseUnit: "g",
+		CategoryID: &category.ID, IsActive: true}
+	if err := db.Create(&cheese).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	recipe := models.Recipe{Name: "Маргарита " + suffix, IsActive: true, PortionSize: 1, PhotoURLs: "[]",
+		Ingredients: []models.RecipeIngredient{{NomenclatureID: &cheese.ID, Quantity: 200, Unit: "g"}}}
+	if err := db.Create(&recipe).Error; err != nil {
+		t.Fatalf("не удалось создать рецепт: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Where("recipe_id = ?", recipe.ID).Delete(&models.RecipeIngredient{})
+		db.Unscoped().Where("id = ?", recipe.ID).Delete(&models.Recipe{})
+		db.Unscoped().Where("id = ?", cheese.ID).Delete(&models.NomenclatureItem{})
+		db.Unscoped().Where("id = ?", category.ID).Delete(&models.NomenclatureCategory{})
+	})
+
+	newBatch := func(expiresIn time.Duration, quantity float64) models.StockBatch {
+		t.Helper()
+		expiryAt := time.Now().UTC().Add(expiresIn)
+		batch := models.StockBatch{NomenclatureID: cheese.ID, BranchID: branchID, Quantity: quantity, RemainingQuantity: quantity,
+			Unit: "g", Source: "adjustment", ExpiryAt: &expiryAt}
+		if err := db.Create(&batch).Error; err != nil {
+			t.Fatalf("не удалось создать партию: %v", err)
+		}
+		return batch
+	}
+	soon := newBatch(10*time.Hour, 500)
+	later := newBatch(72*time.Hour, 300)
+
+	// Доступно только 300 г из 800: одна пицца есть, две уже нет
+	if err := service.CheckRecipeAvailability(recipe.ID, 1, branchID); err != nil {
+		t.Errorf("CheckRecipeAvailability(1): %v", err)
+	}
+	if err := service.CheckRecipeAvailability(recipe.ID, 2, branchID); err == nil {
+		t.Error("CheckRecipeAvailability(2): партия в карантине посчитана доступной")
+	}
+
+	// Продажа и производство тоже не видят партию в карантине
+	err := db.Transaction(func(tx *gorm.DB) error {
+		depletable, err := service.depletableBatches(tx, recipe.Ingredients[0], branchID)
+		if err != nil {
+			return err
+		}
+		if len(depletable) != 1 || depletable[0].ID != later.ID {
+			t.Errorf("depletableBatches: %d партий, want только партию с дальним сроком", len(depletable))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("depletableBatches: %v", err)
+	}
+
+	if err := service.DebitIngredients(recipe.ID, branchID, 1, "повар"); err != nil {
+		t.Fatalf("DebitIngredients: %v", err)
+	}
+	remaining := func(batch models.StockBatch) float64 {
+		t.Helper()
+		var current models.StockBatch
+		if err := db.First(&current, "id = ?", batch.ID).Error; err != nil {
+			t.Fatalf("партия не найдена: %v", err)
+		}
+		return current.RemainingQuantity
+	}
+	if got := remaining(soon); got != 500 {
+		t.Errorf("партия в карантине: остаток %v, want 500 (не списывается)", got)
+	}
+	if got := remaining(later); got != 100 {
+		t.Errorf("партия с дальним сроком: остаток %v, want 100", got)
+	}
+
+	atRisk, err := service.GetAtRiskInventory(branchID)
+	if err != nil {
+		t.Fatalf("GetAtRiskInventory: %v", err)
+	}
+	found := false
+	for _, item := range atRisk {
+		if item["batch_id"] != soon.ID {
+			continue
+		}
+		found = true
+		if item["quarantined"] != true || item["risk_level"] != "critical" || item["can_sell_before_expiry"] != false {
+			t.Errorf("партия в карантине в at-risk: %v, want quarantined, critical и нельзя продать", item)
+		}
+	}
+	if !found {
+		t.Errorf("партия в карантине не попала в at-risk: %v", atRisk)
+	}
+}
+
+// Спрос покрывает только партия в карантине (и у основного товара, и у заменителя): DebitIngredients
+// отказывает без частичного списания, а debitNomenclatureFromStock возвращает ErrInsufficientStock
+func TestOnlyQuarantinedStockIsInsufficient(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureCategory{}, &models.NomenclatureItem{}, &models.Recipe{}, &models.RecipeIngredient{},
+		&models.StockBatch{}, &models.StockMovement{}, &models.IngredientSubstitution{})
+	service := NewStockService(db)
+	suffix := uuid.New().String()[:8]
+	branchID := uuid.New().String()
+
+	category := models.NomenclatureCategory{Name: "Сыры " + suffix, QuarantineHours: 24}
+	if err := db.Create(&category).Error; err != nil {
+		t.Fatalf("не удалось создать категорию: %v", err)
+	}
+	newItem := func(name string) models.NomenclatureItem {
+		t.Helper()
+		item := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: name + " " + suffix, BaseUnit: "g",
+			CategoryID: &category.ID, IsActive: true}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("не удалось создать товар: %v", err)
+		}
+		return item
+	}
+	cheese := newItem("Моцарелла")
+	substitute := newItem("Сулугуни")
+	substitution := models.IngredientSubstitution{OriginalNomenclatureID: cheese.ID, SubstituteNomenclatureID: substitute.ID,
+		ConversionRatio: 1, IsApproved: true}
+	if err := db.Create(&substitution).Error; err != nil {
+		t.Fatalf("не удалось создать замену: %v", err)
+	}
+	recipe := models.Recipe{Name: "Маргарита " + suffix, IsActive: true, PortionSize: 1, PhotoURLs: "[]", AllowSubstitutions: true,
+		Ingredients: []models.RecipeIngredient{{NomenclatureID: &cheese.ID, Quantity: 200, Unit: "g"}}}
+	if err := db.Create(&recipe).Error; err != nil {
+		t.Fatalf("не удалось создать рецепт: %v", err)
+	}
+	itemIDs := []string{cheese.ID, substitute.ID}
+	t.Cleanup(func() {
+		db.Where("branch_id = ?", branchID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Unscoped().Where("id = ?", substitution.ID).Delete(&models.IngredientSubstitution{})
+		db.Where("recipe_id = ?", recipe.ID).Delete(&models.RecipeIngredient{})
+		db.Unscoped().Where("id = ?", recipe.ID).Delete(&models.Recipe{})
+		db.Unscoped().Where("id IN ?", itemIDs).Delete(&models.NomenclatureItem{})
+		db.Unscoped().Where("id = ?", category.ID).Delete(&models.NomenclatureCategory{})
+	})
+
+	// У каждого товара одна партия на 500 г, истекающая через 10 ч - вся в карантине
+	expiryAt := time.Now().UTC().Add(10 * time.Hour)
+	for _, item := range []models.NomenclatureItem{cheese, substitute} {
+		batch := models.StockBatch{NomenclatureID: item.ID, BranchID: branchID, Quantity: 500, RemainingQuantity: 500,
+			Unit: "g", Source: "adjustment", ExpiryAt: &expiryAt}
+		if err := db.Create(&batch).Error; err != nil {
+			t.Fatalf("не удалось создать партию: %v", err)
+		}
+	}
+
+	if err := service.DebitIngredients(recipe.ID, branchID, 1, "повар"); err == nil {
+		t.Error("DebitIngredients: партии в карантине посчитаны доступными")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return service.debitNomenclatureFromStock(tx, cheese.ID, 200, branchID, recipe.ID, "повар", cheese, "")
+	})
+	if !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("debitNomenclatureFromStock: %v, want ErrInsufficientStock", err)
+	}
+
+	var movements int64
+	db.Model(&models.StockMovement{}).Where("branch_id = ?", branchID).Count(&movements)
+	var stock float64
+	db.Model(&models.StockBatch{}).Where("branch_id = ?", branchID).Select("COALESCE(SUM(remaining_quantity), 0)").Scan(&stock)
+	if movements != 0 || stock != 1000 {
+		t.Errorf("после отказа: движений %d, остаток %v, want 0 и 1000 (ничего не списано)", movements, stock)
+	}
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrReservationNotFound - у заказа нет действующего резерва ингредиентов
+var ErrReservationNotFound = errors.New("резерв заказа не найден")
+
+// ReserveIngredients откладывает ингредиенты рецепта под заказ (quantity - количество в единицах порции рецепта).
+// Партии не меняются: резерв уменьшает доступный остаток для CheckRecipeAvailability, GetMaxProducible, DebitIngredients
+// и следующих резервов. Полуфабрикаты резервируются как товар склада, как в DebitIngredients. Не хватает хоть одного
+// товара - ErrInsufficientStock со списком недостающих, ничего не резервируется. Повторный вызов для того же заказа
+// и рецепта возвращает уже созданный резерв
+func (s *StockService) ReserveIngredients(orderID, recipeID string, quantity float64, branchID string) ([]models.StockReservation, error) {
+	var reservations []models.StockReservation
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		reservations, err = s.reserveInTx(tx, orderID, recipeID, quantity, branchID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("📌 Зарезервированы ингредиенты заказа %s (рецепт %s, количество %.2f): позиций %d", orderID, recipeID, quantity, len(reservations))
+	return reservations, nil
+}
+
+// ReserveOrder резервирует ингредиенты всех пицц заказа одной транзакцией (portions: recipe_id -> количество порций)
+// Вызывается при назначении заказу слота; при нехватке любого рецепта не резервируется ничего (ErrInsufficientStock)
+func (s *StockService) ReserveOrder(orderID string, portions map[string]float64, branchID string) ([]models.StockReservation, error) {
+	reservations := make([]models.StockReservation, 0)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for recipeID, count := range portions {
+			var recipe models.Recipe
+			if err := tx.Select("id", "portion_size").First(&recipe, "id = ?", recipeID).Error; err != nil {
+				return fmt.Errorf("рецепт не найден: %w", err)
+			}
+			recipeReservations, err := s.reserveInTx(tx, orderID, recipeID, count*recipe.PortionSize, branchID)
+			if err != nil {
+				return err
+			}
+			reservations = append(reservations, recipeReservations...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("📌 Зарезервированы ингредиенты заказа %s: рецептов %d, позиций %d", orderID, len(portions), len(reservations))
+	return reservations, nil
+}
+
+// reserveInTx - ReserveIngredients внутри транзакции tx
+// Резервы одного заказа выполняются по очереди (advisory-блокировка до конца транзакции), поэтому повторный запрос
+// видит уже созданный резерв; уникальный индекс (order_id, recipe_id, nomenclature_id) по действующим резервам
+// не дает записать дубль, даже если блокировка обойдена
+func (s *StockService) reserveInTx(tx *gorm.DB, orderID, recipeID string, quantity float64, branchID string) ([]models.StockReservation, error) {
+	if orderID == "" {
+		return nil, fmt.Errorf("не указан заказ для резерва")
+	}
+	if quantity <= 0 {
+		return nil, fmt.Errorf("количество для резерва должно быть больше 0")
+	}
+
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "stock_reservation:"+orderID).Error; err != nil {
+		return nil, fmt.Errorf("ошибка блокировки резерва заказа: %w", err)
+	}
+
+	var reservations []models.StockReservation
+	if err := tx.Where("order_id = ? AND recipe_id = ? AND status = ?", orderID, recipeID, models.ReservationStatusReserved).
+		Find(&reservations).Error; err != nil {
+		return nil, fmt.Errorf("ошибка проверки резерва: %w", err)
+	}
+	if len(reservations) > 0 {
+		return reservations, nil
+	}
+
+	required, err := s.reservationRequirements(tx, recipeID, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	var missingItems []string
+	for _, item := range required {
+		available, err := s.availableForReservation(tx, item.Nomenclature, branchID, true)
+		if err != nil {
+			return nil, err
+		}
+		if available < item.Quantity {
+			missingItems = append(missingItems, fmt.Sprintf("'%s': требуется %.4f %s, доступно %.4f %s",
+				item.Nomenclature.Name, item.Quantity, item.Nomenclature.BaseUnit, available, item.Nomenclature.BaseUnit))
+			continue
+		}
+		reservations = append(reservations, models.StockReservation{
+			OrderID:        orderID,
+			RecipeID:       recipeID,
+			BranchID:       branchID,
+			NomenclatureID: item.Nomenclature.ID,
+			Quantity:       item.Quantity,
+			Unit:           item.Nomenclature.BaseUnit,
+			Status:         models.ReservationStatusReserved,
+		})
+	}
+	if len(missingItems) > 0 {
+		return nil, fmt.Errorf("%w для резерва заказа %s: %s", ErrInsufficientStock, orderID, strings.Join(missingItems, "; "))
+	}
+	if len(reservations) == 0 {
+		return reservations, nil
+	}
+
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "order_id"}, {Name: "recipe_id"}, {Name: "nomenclature_id"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "status = 'reserved'"}}},
+		DoNothing:   true,
+	}).Create(&reservations).Error; err != nil {
+		return nil, fmt.Errorf("ошибка сохранения резерва: %w", err)
+	}
+	// Возвращаем то, что лежит в таблице: при конфликте строки уже были созданы другим запросом
+	if err := tx.Where("order_id = ? AND recipe_id = ? AND status = ?", orderID, recipeID, models.ReservationStatusReserved).
+		Find(&reservations).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки резерва: %w", err)
+	}
+	return reservations, nil
+}
+
+// CommitReservation списывает резерв заказа со склада (по стратегии категории, как DebitIngredients) и закрывает его.
+// Если остатков уже не хватает (например, ручное списание), не списывается ничего и резерв остается
+func (s *StockService) CommitReservation(orderID string, performedBy ...string) error {
+	performedByUser := "system"
+	if len(performedBy) > 0 && performedBy[0] != "" {
+		performedByUser = performedBy[0]
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var reservations []models.StockReservation
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("order_id = ? AND status = ?", orderID, models.ReservationStatusReserved).
+			Find(&reservations).Error; err != nil {
+			return fmt.Errorf("ошибка загрузки резерва: %w", err)
+		}
+		if len(reservations) == 0 {
+			return fmt.Errorf("%w: %s", ErrReservationNotFound, orderID)
+		}
+
+		for _, reservation := range reservations {
+			var nomenclature models.NomenclatureItem
+			if err := tx.First(&nomenclature, "id = ?", reservation.NomenclatureID).Error; err != nil {
+				return fmt.Errorf("номенклатура резерва не найдена: %w", err)
+			}
+			// Резерв этого заказа входит в остаток, поэтому проверяем физический остаток, а не доступный
+			onHand, err := s.availableForReservation(tx, nomenclature, reservation.BranchID, false)
+			if err != nil {
+				return err
+			}
+			if onHand < reservation.Quantity {
+				return fmt.Errorf("%w: '%s' для заказа %s (требуется %.4f %s, на складе %.4f %s)", ErrInsufficientStock,
+					nomenclature.Name, orderID, reservation.Quantity, nomenclature.BaseUnit, onHand, nomenclature.BaseUnit)
+			}
+			notes := fmt.Sprintf("Списание резерва заказа %s (рецепт: %s)", orderID, reservation.RecipeID)
+			if err := s.debitNomenclatureFromStock(tx, nomenclature.ID, reservation.Quantity, reservation.BranchID,
+				reservation.RecipeID, performedByUser, nomenclature, notes); err != nil {
+				return fmt.Errorf("ошибка списания резерва '%s': %w", nomenclature.Name, err)
+			}
+		}
+
+		return resolveReservations(tx, orderID, models.ReservationStatusCommitted)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("✅ Резерв заказа %s списан со склада", orderID)
+	return nil
+}
+
+// ReleaseReservation снимает резерв заказа (заказ отменен): ингредиенты снова доступны, склад не меняется
+func (s *StockService) ReleaseReservation(orderID string) error {
+	if err := resolveReservations(s.db, orderID, models.ReservationStatusReleased); err != nil {
+		return err
+	}
+	log.Printf("↩️ Резерв заказа %s снят", orderID)
+	return nil
+}
+
+// resolveReservations переводит действующий резерв заказа в status; нет резерва - ErrReservationNotFound
+func resolveReservations(tx *gorm.DB, orderID, status string) error {
+	result := tx.Model(&models.StockReservation{}).
+		Where("order_id = ? AND status = ?", orderID, models.ReservationStatusReserved).
+		Updates(map[string]interface{}{"status": status, "resolved_at": time.Now()})
+	if result.Error != nil {
+		return fmt.Errorf("ошибка обновления резерва: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrReservationNotFound, orderID)
+	}
+	return nil
+}
+
+// reservationItem - сколько товара (в базовой единице) нужно отложить под заказ
+type reservationItem struct {
+	Nomenclature models.NomenclatureItem
+	Quantity     float64
+}
+
+// reservationRequirements считает потребность рецепта в товарах склада на quantity (единицы порции).
+// Полуфабрикат ищется в номенклатуре по имени рецепта, как в DebitIngredients; один товар в нескольких строках суммируется
+func (s *StockService) reservationRequirements(tx *gorm.DB, recipeID string, quantity float64) ([]reservationItem, error) {
+	var recipe models.Recipe
+	if err := tx.Preload("Ingredients").Preload("Ingredients.IngredientRecipe").
+		First(&recipe, "id = ?", recipeID).Error; err != nil {
+		return nil, fmt.Errorf("рецепт не найден: %w", err)
+	}
+	if recipe.PortionSize <= 0 {
+		return nil, fmt.Errorf("неверный размер порции рецепта: %.2f", recipe.PortionSize)
+	}
+	portions := quantity / recipe.PortionSize
+
+	items := make([]reservationItem, 0, len(recipe.Ingredients))
+	index := make(map[string]int)
+	for _, ingredient := range recipe.Ingredients {
+		var nomenclature models.NomenclatureItem
+		switch {
+		case ingredient.IngredientRecipeID != nil:
+			if ingredient.IngredientRecipe == nil {
+				return nil, fmt.Errorf("рецепт полуфабриката %s не найден", *ingredient.IngredientRecipeID)
+			}
+			if err := tx.Where("name = ? AND is_active = true", ingredient.IngredientRecipe.Name).
+				First(&nomenclature).Error; err != nil {
+				return nil, fmt.Errorf("полуфабрикат '%s' не найден в номенклатуре", ingredient.IngredientRecipe.Name)
+			}
+		case ingredient.NomenclatureID != nil:
+			if err := tx.First(&nomenclature, "id = ?", *ingredient.NomenclatureID).Error; err != nil {
+				return nil, fmt.Errorf("номенклатура не найдена: %w", err)
+			}
+		default:
+			return nil, fmt.Errorf("ингредиент должен иметь либо nomenclature_id, либо ingredient_recipe_id")
+		}
+
+		required, err := s.convertToBaseUnit(ingredient.Quantity*portions, ingredient.Unit, nomenclature)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка конвертации единиц для %s: %w", nomenclature.Name, err)
+		}
+		if i, ok := index[nomenclature.ID]; ok {
+			items[i].Quantity += required
+			continue
+		}
+		index[nomenclature.ID] = len(items)
+		items = append(items, reservationItem{Nomenclature: nomenclature, Quantity: required})
+	}
+	return items, nil
+}
+
+// availableForReservation возвращает остаток товара в филиале, доступный для списания (без просроченных и карантина).
+// Партии блокируются до конца транзакции, чтобы параллельные резервы и списания не разобрали один остаток.
+// subtractReserved - вычесть действующие резервы всех заказов
+func (s *StockService) availableForReservation(tx *gorm.DB, nomenclature models.NomenclatureItem, branchID string, subtractReserved bool) (float64, error) {
+	var batches []models.StockBatch
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "remaining_quantity").
+		Where("nomenclature_id = ? AND branch_id = ? AND remaining_quantity > 0 AND is_expired = false", nomenclature.ID, branchID)
+	if err := excludeQuarantined(query, s.getDepletionPolicy(tx, nomenclature).Quarantine).Find(&batches).Error; err != nil {
+		return 0, fmt.Errorf("ошибка получения партий '%s': %w", nomenclature.Name, err)
+	}
+	available := 0.0
+	for _, batch := range batches {
+		available += batch.RemainingQuantity
+	}
+	if !subtractReserved {
+		return available, nil
+	}
+	reserved, err := reservedQuantity(tx, nomenclature.ID, branchID)
+	if err != nil {
+		return 0, err
+	}
+	return available - reserved, nil
+}
+
+// unreservedStock - остаток товара, который можно списать, за вычетом действующих резервов заказов (не меньше 0)
+// Используется проверками DebitIngredients: списание вне заказа не должно разбирать отложенное под заказы
+func (s *StockService) unreservedStock(tx *gorm.DB, nomenclature models.NomenclatureItem, branchID string) (float64, error) {
+	usable, err := s.usableStock(tx, nomenclature, branchID)
+	if err != nil {
+		return 0, err
+	}
+	reserved, err := reservedQuantity(tx, nomenclature.ID, branchID)
+	if err != nil {
+		return 0, err
+	}
+	return math.Max(usable-reserved, 0), nil
+}
+
+// reservedQuantity - сколько товара отложено под заказы в филиале (действующие резервы)
+func reservedQuantity(db *gorm.DB, nomenclatureID, branchID string) (float64, error) {
+	var reserved float64
+	if err := db.Model(&models.StockReservation{}).
+		Where("nomenclature_id = ? AND branch_id = ? AND status = ?", nomenclatureID, branchID, models.ReservationStatusReserved).
+		Select("COALESCE(SUM(quantity), 0)").
+		Scan(&reserved).Error; err != nil {
+		return 0, fmt.Errorf("ошибка получения резерва: %w", err)
+	}
+	return reserved, nil
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// newTestReservationRecipe создает рецепт "1 порция = 300 г муки" и партию муки 1000 г в новом филиале
+func newTestReservationRecipe(t *testing.T) (*gorm.DB, *StockService, string, models.Recipe, models.StockBatch) {
+	t.Helper()
+	db := newTestDB(t, &models.LegalEntity{}, &models.Branch{}, &models.NomenclatureItem{}, &models.NomenclatureCategory{},
+		&models.Recipe{}, &models.RecipeIngredient{}, &models.StockBatch{}, &models.StockMovement{}, &models.StockReservation{})
+	branchID := newTestBranch(t, db)
+
+	flour := models.NomenclatureItem{SKU: "TEST-" + uuid.New().String()[:8], Name: "Мука", BaseUnit: "g", IsActive: true}
+	if err := db.Create(&flour).Error; err != nil {
+		t.Fatalf("не удалось создать товар: %v", err)
+	}
+	recipe := models.Recipe{Name: "Лепешка " + uuid.New().String()[:8], IsActive: true, PortionSize: 1, PhotoURLs: "[]"}
+	if err := db.Create(&recipe).Error; err != nil {
+		t.Fatalf("не удалось создать рецепт: %v", err)
+	}
+	ingredient := models.RecipeIngredient{RecipeID: recipe.ID, NomenclatureID: &flour.ID, Quantity: 300, Unit: "g"}
+	if err := db.Create(&ingredient).Error; err != nil {
+		t.Fatalf("не удалось добавить ингредиент: %v", err)
+	}
+	batch := models.StockBatch{NomenclatureID: flour.ID, BranchID: branchID, Quantity: 1000, Unit: "g", Source: "adjustment"}
+	if err := db.Create(&batch).Error; err != nil {
+		t.Fatalf("не удалось создать партию: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Where("branch_id = ?", branchID).Delete(&models.StockReservation{})
+		db.Where("stock_batch_id = ?", batch.ID).Delete(&models.StockMovement{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+		db.Where("recipe_id = ?", recipe.ID).Delete(&models.RecipeIngredient{})
+		db.Unscoped().Where("id = ?", recipe.ID).Delete(&models.Recipe{})
+		db.Unscoped().Where("id = ?", flour.ID).Delete(&models.NomenclatureItem{})
+	})
+	return db, NewStockService(db), branchID, recipe, batch
+}
+
+// assertMaxProducible проверяет число порций, доступных с учетом резервов
+func assertMaxProducible(t *testing.T, service *StockService, recipeID, branchID string, want float64) {
+	t.Helper()
+	got, _, err := service.GetMaxProducible(recipeID, branchID)
+	if err != nil {
+		t.Fatalf("GetMaxProducible: %v", err)
+	}
+	if math.Abs(got-want) > 1e-9 {
+		t.Errorf("доступно порций %.4f, want %.4f", got, want)
+	}
+}
+
+// Снятый резерв возвращает доступность, партия при этом не меняется
+func TestReserveThenReleaseRestoresAvailability(t *testing.T) {
+	db, service, branchID, recipe, batch := newTestReservationRecipe(t)
+	orderID := uuid.New().String()
+
+	reservations, err := service.ReserveIngredients(orderID, recipe.ID, 2, branchID)
+	if err != nil {
+		t.Fatalf("ReserveIngredients: %v", err)
+	}
+	if len(reservations) != 1 || reservations[0].Quantity != 600 {
+		t.Fatalf("резерв %+v, want одна строка на 600 g", reservations)
+	}
+	assertMaxProducible(t, service, recipe.ID, branchID, 400.0/300)
+	if err := service.CheckRecipeAvailability(recipe.ID, 2, branchID); err == nil {
+		t.Error("CheckRecipeAvailability не учел резерв: 2 порции из 400 g доступны")
+	}
+
+	// Остаток 400 g: второй заказ на 2 порции не резервируется совсем
+	secondOrderID := uuid.New().String()
+	if _, err := service.ReserveIngredients(secondOrderID, recipe.ID, 2, branchID); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("резерв сверх остатка err = %v, want ErrInsufficientStock", err)
+	}
+	var count int64
+	db.Model(&models.StockReservation{}).Where("order_id = ?", secondOrderID).Count(&count)
+	if count != 0 {
+		t.Errorf("при нехватке создано строк резерва: %d", count)
+	}
+
+	if err := service.ReleaseReservation(orderID); err != nil {
+		t.Fatalf("ReleaseReservation: %v", err)
+	}
+	assertMaxProducible(t, service, recipe.ID, branchID, 1000.0/300)
+	if err := service.ReleaseReservation(orderID); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("повторное снятие err = %v, want ErrReservationNotFound", err)
+	}
+	if err := service.CommitReservation(orderID); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("списание снятого резерва err = %v, want ErrReservationNotFound", err)
+	}
+
+	var reloaded models.StockBatch
+	if err := db.First(&reloaded, "id = ?", batch.ID).Error; err != nil {
+		t.Fatalf("партия не найдена: %v", err)
+	}
+	if reloaded.RemainingQuantity != 1000 {
+		t.Errorf("остаток партии %.2f, want 1000 (резерв не списывает)", reloaded.RemainingQuantity)
+	}
+}
+
+// Списанный резерв уменьшает партию ровно на зарезервированное количество и больше не учитывается как резерв
+func TestReserveThenCommitDebitsStock(t *testing.T) {
+	db, service, branchID, recipe, batch := newTestReservationRecipe(t)
+	orderID := uuid.New().String()
+
+	if _, err := service.ReserveIngredients(orderID, recipe.ID, 2, branchID); err != nil {
+		t.Fatalf("ReserveIngredients: %v", err)
+	}
+	// Повторный резерв того же заказа не удваивает резерв
+	if _, err := service.ReserveIngredients(orderID, recipe.ID, 2, branchID); err != nil {
+		t.Fatalf("повторный ReserveIngredients: %v", err)
+	}
+	reserved, err := reservedQuantity(db, batch.NomenclatureID, branchID)
+	if err != nil {
+		t.Fatalf("reservedQuantity: %v", err)
+	}
+	if reserved != 600 {
+		t.Fatalf("зарезервировано %.2f g, want 600", reserved)
+	}
+
+	if err := service.CommitReservation(orderID, "test"); err != nil {
+		t.Fatalf("CommitReservation: %v", err)
+	}
+
+	var reloaded models.StockBatch
+	if err := db.First(&reloaded, "id = ?", batch.ID).Error; err != nil {
+		t.Fatalf("партия не найдена: %v", err)
+	}
+	if reloaded.RemainingQuantity != 400 {
+		t.Errorf("остаток партии %.2f, want 400", reloaded.RemainingQuantity)
+	}
+	var reservation models.StockReservation
+	if err := db.First(&reservation, "order_id = ?", orderID).Error; err != nil {
+		t.Fatalf("резерв не найден: %v", err)
+	}
+	if reservation.Status != models.ReservationStatusCommitted || reservation.ResolvedAt == nil {
+		t.Errorf("резерв после списания: статус %s, resolved_at %v", reservation.Status, reservation.ResolvedAt)
+	}
+	// Остаток 400 g без резервов
+	assertMaxProducible(t, service, recipe.ID, branchID, 400.0/300)
+	if err := service.ReleaseReservation(orderID); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("снятие списанного резерва err = %v, want ErrReservationNotFound", err)
+	}
+}
+
+// Параллельные резервы одного заказа (ретраи при назначении слота) откладывают ингредиенты один раз,
+// а DebitIngredients вне заказа не разбирает зарезервированное
+func TestReserveOrderConcurrentAndDebitRespectsReservations(t *testing.T) {
+	db, service, branchID, recipe, batch := newTestReservationRecipe(t)
+	orderID := uuid.New().String()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := service.ReserveOrder(orderID, map[string]float64{recipe.ID: 2}, branchID)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("ReserveOrder: %v", err)
+		}
+	}
+	var rows int64
+	db.Model(&models.StockReservation{}).Where("order_id = ? AND status = ?", orderID, models.ReservationStatusReserved).Count(&rows)
+	if rows != 1 {
+		t.Fatalf("действующих строк резерва %d, want 1", rows)
+	}
+
+	// Уникальный индекс не дает записать второй действующий резерв того же товара
+	duplicate := models.StockReservation{OrderID: orderID, RecipeID: recipe.ID, BranchID: branchID,
+		NomenclatureID: batch.NomenclatureID, Quantity: 600, Unit: "g"}
+	if err := db.Create(&duplicate).Error; err == nil {
+		t.Error("дубль действующего резерва записан, want unique violation")
+	}
+
+	// Свободно 400 g из 1000: две порции (600 g) списать нельзя, одну можно
+	if err := service.DebitIngredients(recipe.ID, branchID, 2, "test"); err == nil {
+		t.Error("DebitIngredients списал зарезервированное под заказ")
+	}
+	if err := service.DebitIngredients(recipe.ID, branchID, 1, "test"); err != nil {
+		t.Fatalf("DebitIngredients(1): %v", err)
+	}
+	var reloaded models.StockBatch
+	if err := db.First(&reloaded, "id = ?", batch.ID).Error; err != nil {
+		t.Fatalf("партия не найдена: %v", err)
+	}
+	if reloaded.RemainingQuantity != 700 {
+		t.Errorf("остаток партии %.2f, want 700", reloaded.RemainingQuantity)
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+// DefaultStockQuantityDecimals - знаков после запятой для весовых и объемных остатков (кг, л, г, мл)
+const DefaultStockQuantityDecimals = 2
+
+// stockCostDecimals - стоимость округляется до копеек
+const stockCostDecimals = 2
+
+// pieceUnits - штучные единицы, остатки по которым показываются целыми
+var pieceUnits = map[string]bool{
+	"pcs": true, "шт": true, "шт.": true, "box": true,
+}
+
+// SetQuantityDecimals устанавливает число знаков после запятой для отображаемых остатков (< 0 = DefaultStockQuantityDecimals)
+func (s *StockService) SetQuantityDecimals(decimals int) {
+	if decimals < 0 {
+		decimals = DefaultStockQuantityDecimals
+	}
+	s.quantityDecimals = &decimals
+}
+
+// quantityPlaces возвращает точность отображения количества в единице unit
+func (s *StockService) quantityPlaces(unit string) int32 {
+	if pieceUnits[unit] {
+		return 0
+	}
+	if s.quantityDecimals != nil {
+		return int32(*s.quantityDecimals)
+	}
+	return DefaultStockQuantityDecimals
+}
+
+// RoundStockItems округляет количества и стоимости в ответе GetStockItems (изменяет items на месте)
+// Количества округляются по единице склада (base_unit), стоимость - до копеек
+func (s *StockService) RoundStockItems(items []map[string]interface{}) {
+	for _, item := range items {
+		unit, _ := item["base_unit"].(string)
+		places := s.quantityPlaces(unit)
+		roundStockField(item, "current_stock", places)
+		roundStockField(item, "min_stock", places)
+		roundStockField(item, "cost_per_unit", stockCostDecimals)
+		roundStockField(item, "cost_value", stockCostDecimals)
+
+		batches, _ := item["batches"].([]map[string]interface{})
+		for _, batch := range batches {
+			roundStockField(batch, "quantity", places)
+			roundStockField(batch, "cost_per_unit", stockCostDecimals)
+		}
+	}
+}
+
+// RoundBatchesHistory округляет количества и стоимости в ответе GetBatchesHistory (изменяет batches на месте)
+// Количества в BaseUnit округляются по unit, в InboundUnit - по major_unit
+func (s *StockService) RoundBatchesHistory(batches []map[string]interface{}) {
+	for _, batch := range batches {
+		unit, _ := batch["unit"].(string)
+		majorUnit, _ := batch["major_unit"].(string)
+		if majorUnit == "" {
+			majorUnit = unit
+		}
+		roundStockField(batch, "quantity", s.quantityPlaces(unit))
+		roundStockField(batch, "remaining_quantity", s.quantityPlaces(unit))
+		roundStockField(batch, "quantity_major", s.quantityPlaces(majorUnit))
+		roundStockField(batch, "remaining_quantity_major", s.quantityPlaces(majorUnit))
+		roundStockField(batch, "cost_per_unit", stockCostDecimals)
+		roundStockField(batch, "cost_value", stockCostDecimals)
+	}
+}
+
+// RoundStockZones округляет ответ GetStockByZone: строки - как RoundStockItems, итоги по единицам - по своей единице
+func (s *StockService) RoundStockZones(groups []*StockZoneGroup) {
+	for _, group := range groups {
+		s.RoundStockItems(group.Items)
+		for unit, total := range group.TotalByUnit {
+			group.TotalByUnit[unit] = decimal.NewFromFloat(total).Round(s.quantityPlaces(unit)).InexactFloat64()
+		}
+	}
+}
+
+// roundStockField округляет числовое поле ответа через decimal, чтобы 2.675 не превращалось в 2.67 из-за float64
+func roundStockField(data map[string]interface{}, key string, places int32) {
+	value, ok := data[key].(float64)
+	if !ok {
+		return
+	}
+	data[key] = decimal.NewFromFloat(value).Round(places).InexactFloat64()
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Партия 12.3456 кг показывается как 12.35 кг, стоимость - до копеек
+func TestRoundBatchesHistory(t *testing.T) {
+	service := NewStockService(nil)
+	batches := []map[string]interface{}{
+		{
+			"unit":                     "g",
+			"major_unit":               "kg",
+			"quantity":                 12345.6,
+			"remaining_quantity":       12345.6,
+			"quantity_major":           12.3456,
+			"remaining_quantity_major": 12.3456,
+			"cost_per_unit":            123.456,
+			"cost_value":               1524.1183, // 12.3456 кг * 123.456 руб/кг
+			"invoice_number":           "INV-1",
+		},
+		{"unit": "pcs", "quantity": 29.6, "remaining_quantity": 2.4, "cost_per_unit": 2.675, "cost_value": 6.42},
+	}
+
+	service.RoundBatchesHistory(batches)
+	want := []map[string]interface{}{
+		{
+			"unit":                     "g",
+			"major_unit":               "kg",
+			"quantity":                 12345.6,
+			"remaining_quantity":       12345.6,
+			"quantity_major":           12.35,
+			"remaining_quantity_major": 12.35,
+			"cost_per_unit":            123.46,
+			"cost_value":               1524.12,
+			"invoice_number":           "INV-1",
+		},
+		// Штуки - целыми; 2.675 округляется вверх (decimal, а не float64)
+		{"unit": "pcs", "quantity": 30.0, "remaining_quantity": 2.0, "cost_per_unit": 2.68, "cost_value": 6.42},
+	}
+	if !reflect.DeepEqual(batches, want) {
+		t.Errorf("RoundBatchesHistory:\n got %v\nwant %v", batches, want)
+	}
+}
+
+func TestRoundStockItems(t *testing.T) {
+	service := NewStockService(nil)
+	service.SetQuantityDecimals(1)
+	items := []map[string]interface{}{{
+		"base_unit":     "kg",
+		"current_stock": 12.3456,
+		"min_stock":     5.55,
+		"cost_per_unit": 99.999,
+		"cost_value":    1234.5678,
+		"batches": []map[string]interface{}{
+			{"quantity": 0.04, "cost_per_unit": 10.005},
+		},
+	}}
+
+	service.RoundStockItems(items)
+	item := items[0]
+	if item["current_stock"] != 12.3 || item["min_stock"] != 5.6 || item["cost_per_unit"] != 100.0 || item["cost_value"] != 1234.57 {
+		t.Errorf("товар %v, want остатки с одним знаком и стоимость до копеек", item)
+	}
+	batch := item["batches"].([]map[string]interface{})[0]
+	if batch["quantity"] != 0.0 || batch["cost_per_unit"] != 10.01 {
+		t.Errorf("партия %v, want quantity 0 и cost_per_unit 10.01", batch)
+	}
+
+	// Отрицательное значение - точность по умолчанию
+	service.SetQuantityDecimals(-1)
+	if got := service.quantityPlaces("kg"); got != DefaultStockQuantityDecimals {
+		t.Errorf("точность %d, want %d", got, DefaultStockQuantityDecimals)
+	}
+}
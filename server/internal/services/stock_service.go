@@ -1,22 +1,37 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 	"zephyrvpn/server/internal/models"
+	"zephyrvpn/server/internal/utils/timefmt"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
+// ErrInsufficientStock - остатков ингредиента не хватает для списания продажи (ничего не списано)
+var ErrInsufficientStock = errors.New("недостаточно остатков")
+
 // StockService управляет остатками товаров, партиями и сроками годности
 type StockService struct {
 	db                *gorm.DB
 	counterpartyService *CounterpartyService
 	financeService     *FinanceService
+	currencyService    *CurrencyService
+	priceAlertThreshold float64                      // Рост цены к скользящему среднему (%), выше которого уведомляем
+	onPriceAlert        func(alerts []PriceChangeAlert) // Уведомление о росте закупочных цен (может быть nil)
+	notificationService *NotificationService           // Критические уведомления во внешние каналы (может быть nil)
+	menuMarginThreshold float64                        // Порог маржи (%) для отчета по меню (0 = DefaultMenuMarginThreshold)
+	maxRecipeDepth      int                            // Максимальная вложенность полуфабрикатов (0 = DefaultMaxRecipeDepth)
+	quantityDecimals    *int                           // Знаков после запятой в отображаемых остатках (nil = DefaultStockQuantityDecimals)
+	markdownCurve       MarkdownCurve                  // Кривая скидок на товар с истекающим сроком (нулевые поля = DefaultMarkdownCurve)
 }
 
 // GetDB возвращает экземпляр БД для доступа из других сервисов
@@ -34,11 +49,42 @@ func (s *StockService) SetCounterpartyService(cs *CounterpartyService) {
 	s.counterpartyService = cs
 }
 
+// SetNotificationService подключает внешние уведомления (webhook, Telegram) для критических алертов склада
+func (s *StockService) SetNotificationService(ns *NotificationService) {
+	s.notificationService = ns
+}
+
 // SetFinanceService устанавливает сервис финансов
 func (s *StockService) SetFinanceService(fs *FinanceService) {
 	s.financeService = fs
 }
 
+// SetCurrencyService устанавливает сервис валют (пересчет валютных накладных в рубли)
+func (s *StockService) SetCurrencyService(cs *CurrencyService) {
+	s.currencyService = cs
+}
+
+// costConversionFactor возвращает коэффициент из BaseUnit остатка в InboundUnit цены партии
+// (1000 для г->кг и мл->л, ConversionFactor номенклатуры для прочих единиц, 1 если единицы совпадают)
+func costConversionFactor(nomenclature models.NomenclatureItem) decimal.Decimal {
+	baseUnit := nomenclature.BaseUnit
+	inboundUnit := nomenclature.InboundUnit
+	if baseUnit == inboundUnit || inboundUnit == "" {
+		return decimal.NewFromInt(1)
+	}
+	if (baseUnit == "g" && inboundUnit == "kg") || (baseUnit == "ml" && inboundUnit == "l") {
+		return decimal.NewFromInt(1000) // граммы в килограммы, миллилитры в литры
+	}
+	if (baseUnit == "kg" && inboundUnit == "g") || (baseUnit == "l" && inboundUnit == "ml") {
+		return decimal.NewFromFloat(0.001)
+	}
+	if nomenclature.ConversionFactor > 0 {
+		// Используем коэффициент конвертации из модели
+		return decimal.NewFromFloat(nomenclature.ConversionFactor)
+	}
+	return decimal.NewFromInt(1)
+}
+
 // calculateBatchValue рассчитывает стоимость батча по правильной формуле
 // КРИТИЧЕСКИ ВАЖНО: Формула должна быть ТОЧНО такой:
 // TotalValue = (RemainingQuantityInGrams * CostPerKg) / 1000
@@ -64,329 +110,12 @@ func calculateBatchValue(remainingQty decimal.Decimal, costPerUnit decimal.Decim
 	// Для товаров в граммах/миллилитрах: conversionFactor = 1000
 	// Для товаров в штуках: conversionFactor = 1 (деление не нужно)
 	if !conversionFactor.Equal(decimal.NewFromInt(1)) {
-		result := total.Div(conversionFactor)
-		// Логирование для отладки (можно убрать после проверки)
-		log.Printf("💰 calculateBatchValue: %.2f %s * %.2f₽/%s / %.0f = %.2f₽",
-			remainingQty.InexactFloat64(), "base_unit",
-			costPerUnit.InexactFloat64(), "major_unit",
-			conversionFactor.InexactFloat64(),
-			result.InexactFloat64())
-		return result
+		return total.Div(conversionFactor)
 	}
 	
 	return total
 }
 
-// GetStockItems возвращает остатки товаров с учетом партий и сроков годности
-func (s *StockService) GetStockItems(branchID string, includeExpired bool) ([]map[string]interface{}, error) {
-	type BatchWithBranch struct {
-		models.StockBatch
-		BranchName string `gorm:"column:branch_name"`
-	}
-	
-	var batches []models.StockBatch
-	
-	query := s.db.Model(&models.StockBatch{}).
-		Preload("Nomenclature").
-		Where("remaining_quantity > 0")
-	
-	if branchID != "" && branchID != "all" {
-		query = query.Where("branch_id = ?", branchID)
-	}
-	
-	if !includeExpired {
-		query = query.Where("is_expired = false")
-	}
-	
-	if err := query.Find(&batches).Error; err != nil {
-		return nil, err
-	}
-	
-	// Загружаем филиалы для получения имен
-	branchMap := make(map[string]string)
-	var branchIDs []string
-	for _, batch := range batches {
-		if _, exists := branchMap[batch.BranchID]; !exists {
-			branchIDs = append(branchIDs, batch.BranchID)
-		}
-	}
-	
-	if len(branchIDs) > 0 {
-		var branches []models.Branch
-		if err := s.db.Where("id IN ?", branchIDs).Find(&branches).Error; err == nil {
-			for _, branch := range branches {
-				branchMap[branch.ID] = branch.Name
-			}
-		}
-	}
-	
-	// Загружаем накладные для получения номеров
-	invoiceMap := make(map[string]string) // invoiceID -> invoiceNumber
-	var invoiceIDs []string
-	for _, batch := range batches {
-		if batch.InvoiceID != nil && *batch.InvoiceID != "" {
-			if _, exists := invoiceMap[*batch.InvoiceID]; !exists {
-				invoiceIDs = append(invoiceIDs, *batch.InvoiceID)
-			}
-		}
-	}
-	
-	if len(invoiceIDs) > 0 {
-		var invoices []models.Invoice
-		if err := s.db.Where("id IN ?", invoiceIDs).Find(&invoices).Error; err == nil {
-			for _, invoice := range invoices {
-				invoiceMap[invoice.ID] = invoice.Number
-			}
-		}
-	}
-	
-	// Группируем по товарам и филиалам
-	stockMap := make(map[string]map[string]interface{})
-	
-		for _, batch := range batches {
-		key := batch.NomenclatureID + "_" + batch.BranchID
-		nomenclature := batch.Nomenclature
-		
-		// Вычисляем коэффициент конвертации для правильного расчета стоимости
-		// cost_per_unit всегда за InboundUnit (кг/л/шт), а current_stock может быть в Base Unit (г)
-		conversionFactor := decimal.NewFromInt(1)
-		baseUnit := nomenclature.BaseUnit
-		inboundUnit := nomenclature.InboundUnit
-		
-		// Если единицы разные, вычисляем коэффициент конвертации
-		if baseUnit != inboundUnit && inboundUnit != "" {
-			if (baseUnit == "g" && inboundUnit == "kg") || (baseUnit == "ml" && inboundUnit == "l") {
-				conversionFactor = decimal.NewFromInt(1000) // граммы в килограммы, миллилитры в литры
-			} else if (baseUnit == "kg" && inboundUnit == "g") || (baseUnit == "l" && inboundUnit == "ml") {
-				conversionFactor = decimal.NewFromFloat(0.001)
-			} else if nomenclature.ConversionFactor > 0 {
-				// Используем коэффициент конвертации из модели
-				conversionFactor = decimal.NewFromFloat(nomenclature.ConversionFactor)
-			}
-		}
-		
-			// ВАЖНО: CostPerUnit никогда не меняется - это константа закупки (цена за InboundUnit)
-		// КРИТИЧЕСКИ ВАЖНО: CostPerUnit должен быть ценой за 1кг/1л, НЕ за грамм!
-		// ПРАВИЛЬНАЯ формула расчета стоимости:
-		// TotalValue = (RemainingQuantityInGrams * CostPerKg) / 1000
-		// Пример: (10000г * 1234₽/кг) / 1000 = 12,340₽
-		// 
-		// КРИТИЧЕСКИ ВАЖНО: Проверяем, что CostPerUnit - это цена за 1кг/1л, НЕ за грамм!
-		// Если CostPerUnit < 10, возможно он сохранен как цена за грамм (неправильно!)
-		// Пример: если цена должна быть 1234₽/кг, но сохранена как 1.234₽, это ошибка!
-		// В этом случае нужно умножить CostPerUnit на 1000 для правильного расчета
-		var correctedCostPerUnit float64 = batch.CostPerUnit
-		if batch.CostPerUnit > 0 && batch.CostPerUnit < 10 && (baseUnit == "g" && inboundUnit == "kg") {
-			log.Printf("⚠️ ВНИМАНИЕ: CostPerUnit кажется слишком низким для товара %s (ID: %s)", nomenclature.Name, batch.NomenclatureID)
-			log.Printf("   CostPerUnit в БД: %.4f₽/%s - возможно сохранена цена за грамм вместо цены за кг!", batch.CostPerUnit, inboundUnit)
-			log.Printf("   Исправляем: умножаем на 1000 -> %.2f₽/кг", batch.CostPerUnit*1000)
-			correctedCostPerUnit = batch.CostPerUnit * 1000 // Исправляем цену
-		} else if batch.CostPerUnit > 0 && batch.CostPerUnit < 10 && (baseUnit == "ml" && inboundUnit == "l") {
-			log.Printf("⚠️ ВНИМАНИЕ: CostPerUnit кажется слишком низким для товара %s (ID: %s)", nomenclature.Name, batch.NomenclatureID)
-			log.Printf("   CostPerUnit в БД: %.4f₽/%s - возможно сохранена цена за мл вместо цены за л!", batch.CostPerUnit, inboundUnit)
-			log.Printf("   Исправляем: умножаем на 1000 -> %.2f₽/л", batch.CostPerUnit*1000)
-			correctedCostPerUnit = batch.CostPerUnit * 1000 // Исправляем цену
-		}
-		
-		// Логирование для отладки
-		log.Printf("🔍 GetStockItems: расчет стоимости для %s (ID: %s)", nomenclature.Name, batch.NomenclatureID)
-		log.Printf("   RemainingQuantity: %.2f %s", batch.RemainingQuantity, baseUnit)
-		log.Printf("   CostPerUnit (из БД): %.4f₽/%s", batch.CostPerUnit, inboundUnit)
-		if correctedCostPerUnit != batch.CostPerUnit {
-			log.Printf("   CostPerUnit (исправлено): %.2f₽/%s", correctedCostPerUnit, inboundUnit)
-		}
-		log.Printf("   ConversionFactor: %.0f", conversionFactor.InexactFloat64())
-		// КРИТИЧЕСКИ ВАЖНО: batch.RemainingQuantity должен быть в BaseUnit
-		// Если BaseUnit = "g", а RemainingQuantity < 1000, возможно он сохранен в кг - конвертируем
-		var batchRemainingQtyForCalc float64 = batch.RemainingQuantity
-		if baseUnit == "g" && batch.RemainingQuantity < 1000 && batch.RemainingQuantity > 0 {
-			// Умножаем на 1000 для конвертации в граммы
-			batchRemainingQtyForCalc = batch.RemainingQuantity * 1000
-		} else if baseUnit == "ml" && batch.RemainingQuantity < 1000 && batch.RemainingQuantity > 0 {
-			// Аналогично для миллилитров
-			batchRemainingQtyForCalc = batch.RemainingQuantity * 1000
-		}
-		
-		log.Printf("   Формула: (%.2f * %.2f) / %.0f", batchRemainingQtyForCalc, correctedCostPerUnit, conversionFactor.InexactFloat64())
-		
-		batchCostValueDecimal := calculateBatchValue(
-			decimal.NewFromFloat(batchRemainingQtyForCalc), // Остаток в BaseUnit (граммы/мл) - исправленный если нужно
-			decimal.NewFromFloat(correctedCostPerUnit),       // Цена за InboundUnit (цена за 1кг/1л) - исправленная если нужно
-			conversionFactor,                                 // Коэффициент конвертации (1000 для г->кг)
-		)
-		
-		log.Printf("   Результат: %.2f₽", batchCostValueDecimal.InexactFloat64())
-		// Правильный расчет ожидаемого результата с учетом реального BaseUnit
-		var expectedResult float64
-		if conversionFactor.GreaterThan(decimal.NewFromInt(1)) {
-			expectedResult = (batchRemainingQtyForCalc * correctedCostPerUnit) / conversionFactor.InexactFloat64()
-		} else {
-			expectedResult = batchRemainingQtyForCalc * correctedCostPerUnit
-		}
-		log.Printf("   Ожидаемый результат для %.2f %s по %.2f₽/%s: %.2f₽", 
-			batchRemainingQtyForCalc, baseUnit, correctedCostPerUnit, inboundUnit, expectedResult)
-		
-		if stockItem, exists := stockMap[key]; exists {
-			// Обновляем существующий товар
-			// КРИТИЧЕСКИ ВАЖНО: batch.RemainingQuantity должен быть в BaseUnit
-			// Если BaseUnit = "g", а RemainingQuantity < 1000, возможно он сохранен в кг - конвертируем
-			var batchRemainingQty float64 = batch.RemainingQuantity
-			if baseUnit == "g" && batch.RemainingQuantity < 1000 && batch.RemainingQuantity > 0 {
-				// Проверяем, возможно RemainingQuantity сохранен в килограммах вместо граммов
-				// Если значение меньше 1000 и больше 0, вероятно это килограммы
-				// Умножаем на 1000 для конвертации в граммы
-				batchRemainingQty = batch.RemainingQuantity * 1000
-				log.Printf("⚠️ GetStockItems: исправление единиц для %s (ID: %s): %.2f кг -> %.2f г",
-					nomenclature.Name, batch.NomenclatureID, batch.RemainingQuantity, batchRemainingQty)
-			} else if baseUnit == "ml" && batch.RemainingQuantity < 1000 && batch.RemainingQuantity > 0 {
-				// Аналогично для миллилитров
-				batchRemainingQty = batch.RemainingQuantity * 1000
-				log.Printf("⚠️ GetStockItems: исправление единиц для %s (ID: %s): %.2f л -> %.2f мл",
-					nomenclature.Name, batch.NomenclatureID, batch.RemainingQuantity, batchRemainingQty)
-			}
-			currentStock := stockItem["current_stock"].(float64) + batchRemainingQty
-			stockItem["current_stock"] = currentStock
-			
-			// Суммируем стоимость всех батчей (каждый батч может иметь свою цену)
-			// ВАЖНО: Не пересчитываем общую стоимость по средневзвешенной цене,
-			// а суммируем стоимость каждого батча отдельно по правильной формуле:
-			// TotalCost = Sum((RemainingQuantity_i * CostPerUnit_i) / ConversionFactor)
-			// Сначала умножаем, потом делим - это избегает потери точности
-			existingCostValue := decimal.NewFromFloat(stockItem["cost_value"].(float64))
-			totalCostValue := existingCostValue.Add(batchCostValueDecimal)
-			stockItem["cost_value"] = totalCostValue.InexactFloat64()
-			
-			// ПРИМЕЧАНИЕ: cost_per_unit в итоговом объекте берется от последнего батча (для отображения)
-			// Реальная стоимость рассчитывается через суммирование стоимости каждого батча отдельно
-			// Обновляем cost_per_unit в stockItem на исправленное значение
-			stockItem["cost_per_unit"] = correctedCostPerUnit
-			
-			// Обновляем branch_name, если его еще нет
-			if _, hasBranchName := stockItem["branch_name"]; !hasBranchName {
-				stockItem["branch_name"] = branchMap[batch.BranchID]
-			}
-			
-			// Обновляем информацию о сроках годности
-			batchesList := stockItem["batches"].([]map[string]interface{})
-			
-			// Исправляем cost_per_unit если он сохранен как цена за грамм
-			var batchCorrectedCostPerUnit float64 = batch.CostPerUnit
-			if batch.CostPerUnit > 0 && batch.CostPerUnit < 10 && (baseUnit == "g" && inboundUnit == "kg") {
-				batchCorrectedCostPerUnit = batch.CostPerUnit * 1000
-			} else if batch.CostPerUnit > 0 && batch.CostPerUnit < 10 && (baseUnit == "ml" && inboundUnit == "l") {
-				batchCorrectedCostPerUnit = batch.CostPerUnit * 1000
-			}
-			
-			batchData := map[string]interface{}{
-				"id":                batch.ID,
-				"quantity":          batch.RemainingQuantity,
-				"expiry_at":         batch.ExpiryAt,
-				"days_until_expiry": s.calculateDaysUntilExpiry(batch.ExpiryAt),
-				"hours_until_expiry": s.calculateHoursUntilExpiry(batch.ExpiryAt),
-				"is_expired":        batch.IsExpired,
-				"is_at_risk":        s.isAtRisk(batch),
-				"cost_per_unit":     batchCorrectedCostPerUnit, // Цена за InboundUnit (исправленная если нужно)
-			}
-			// Добавляем информацию о накладной, если есть
-			if batch.InvoiceID != nil && *batch.InvoiceID != "" {
-				batchData["invoice_id"] = *batch.InvoiceID
-				if invoiceNumber, exists := invoiceMap[*batch.InvoiceID]; exists {
-					batchData["invoice_number"] = invoiceNumber
-				}
-			}
-			batchesList = append(batchesList, batchData)
-			stockItem["batches"] = batchesList
-		} else {
-			// Создаем новый товар
-			minStock := nomenclature.MinStockLevel
-			// КРИТИЧЕСКИ ВАЖНО: batch.RemainingQuantity должен быть в BaseUnit
-			// Если BaseUnit = "g", а RemainingQuantity < 1000, возможно он сохранен в кг - конвертируем
-			var currentStock float64 = batch.RemainingQuantity
-			if baseUnit == "g" && batch.RemainingQuantity < 1000 && batch.RemainingQuantity > 0 {
-				// Проверяем, возможно RemainingQuantity сохранен в килограммах вместо граммов
-				// Если значение меньше 1000 и больше 0, вероятно это килограммы
-				// Умножаем на 1000 для конвертации в граммы
-				currentStock = batch.RemainingQuantity * 1000
-				log.Printf("⚠️ GetStockItems: исправление единиц для %s (ID: %s): %.2f кг -> %.2f г",
-					nomenclature.Name, batch.NomenclatureID, batch.RemainingQuantity, currentStock)
-			} else if baseUnit == "ml" && batch.RemainingQuantity < 1000 && batch.RemainingQuantity > 0 {
-				// Аналогично для миллилитров
-				currentStock = batch.RemainingQuantity * 1000
-				log.Printf("⚠️ GetStockItems: исправление единиц для %s (ID: %s): %.2f л -> %.2f мл",
-					nomenclature.Name, batch.NomenclatureID, batch.RemainingQuantity, currentStock)
-			}
-			
-			status := "in_stock"
-			if currentStock <= 0 {
-				status = "out_of_stock"
-			} else if currentStock < minStock {
-				status = "low_stock"
-			}
-			
-			// Вычисляем cost_value используя правильную формулу
-			// Формула: (Остаток в BaseUnit * Цена за InboundUnit) / ConversionFactor
-			costValue := batchCostValueDecimal.InexactFloat64()
-			
-			stockMap[key] = map[string]interface{}{
-				"id":                nomenclature.ID,
-				"product_id":        nomenclature.ID,
-				"product_name":     nomenclature.Name,
-				"category":         nomenclature.CategoryName,
-				"category_color":    nomenclature.CategoryColor,
-				"category_id":       nomenclature.CategoryID,
-				"unit":             nomenclature.InboundUnit, // Единица измерения для отображения (кг/л/шт) - используется для цены
-				"base_unit":        nomenclature.BaseUnit, // Базовая единица склада (г/мл/шт) - для точного учета
-				"inbound_unit":     nomenclature.InboundUnit, // Единица поступления (кг/л/шт) - для цены закупки
-				"branch_id":        batch.BranchID,
-				"branch_name":      branchMap[batch.BranchID], // Добавляем имя филиала
-				"current_stock":    currentStock, // В BaseUnit
-				"min_stock":        minStock,
-				"cost_per_unit":    correctedCostPerUnit, // Цена за InboundUnit (кг/л/шт) - исправленная если нужно
-				"cost_value":       costValue, // Стоимость = (currentStockInBaseUnit * CorrectedCostPerUnit) / ConversionFactor
-				"status":           status,
-				"batches": []map[string]interface{}{
-					func() map[string]interface{} {
-						// Исправляем cost_per_unit если он сохранен как цена за грамм
-						var batchCorrectedCostPerUnit float64 = batch.CostPerUnit
-						if batch.CostPerUnit > 0 && batch.CostPerUnit < 10 && (baseUnit == "g" && inboundUnit == "kg") {
-							batchCorrectedCostPerUnit = batch.CostPerUnit * 1000
-						} else if batch.CostPerUnit > 0 && batch.CostPerUnit < 10 && (baseUnit == "ml" && inboundUnit == "l") {
-							batchCorrectedCostPerUnit = batch.CostPerUnit * 1000
-						}
-						
-						batchData := map[string]interface{}{
-							"id":                batch.ID,
-							"quantity":          batch.RemainingQuantity,
-							"expiry_at":         batch.ExpiryAt,
-							"days_until_expiry": s.calculateDaysUntilExpiry(batch.ExpiryAt),
-							"hours_until_expiry": s.calculateHoursUntilExpiry(batch.ExpiryAt),
-							"is_expired":        batch.IsExpired,
-							"is_at_risk":        s.isAtRisk(batch),
-							"cost_per_unit":     batchCorrectedCostPerUnit, // Цена за InboundUnit (исправленная если нужно)
-						}
-						// Добавляем информацию о накладной, если есть
-						if batch.InvoiceID != nil && *batch.InvoiceID != "" {
-							batchData["invoice_id"] = *batch.InvoiceID
-							if invoiceNumber, exists := invoiceMap[*batch.InvoiceID]; exists {
-								batchData["invoice_number"] = invoiceNumber
-							}
-						}
-						return batchData
-					}(),
-				},
-			}
-		}
-	}
-	
-	// Преобразуем map в slice
-	result := make([]map[string]interface{}, 0, len(stockMap))
-	for _, item := range stockMap {
-		result = append(result, item)
-	}
-	
-	return result, nil
-}
-
 // GetBatchesHistory возвращает историю всех батчей для конкретной номенклатуры
 // Включает все батчи (даже с нулевым остатком) для полной истории приходов
 func (s *StockService) GetBatchesHistory(nomenclatureID string, branchID string) ([]map[string]interface{}, error) {
@@ -504,6 +233,234 @@ func (s *StockService) GetBatchesHistory(nomenclatureID string, branchID string)
 	return result, nil
 }
 
+// MergeBatches объединяет партии одной номенклатуры в филиале, у которых совпадают
+// день истечения срока годности и цена закупки (CostPerUnit).
+// Движения склада переносятся на партию-«наследника», поглощенные партии мягко удаляются.
+// Партии с разной ценой не объединяются, чтобы не искажать оценку остатков.
+// Возвращает количество поглощенных партий.
+func (s *StockService) MergeBatches(nomenclatureID, branchID string) (int, error) {
+	if s.db == nil {
+		return 0, fmt.Errorf("PostgreSQL недоступен")
+	}
+	if nomenclatureID == "" || branchID == "" {
+		return 0, fmt.Errorf("nomenclature_id и branch_id обязательны")
+	}
+
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var batches []models.StockBatch
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("nomenclature_id = ? AND branch_id = ?", nomenclatureID, branchID).
+		Order("created_at ASC").
+		Find(&batches).Error; err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("ошибка получения партий: %w", err)
+	}
+
+	// Группируем по дню истечения срока, цене, единице и признаку просрочки
+	groups := make(map[string][]*models.StockBatch)
+	var groupOrder []string
+	for i := range batches {
+		batch := &batches[i]
+		expiryKey := "none"
+		if batch.ExpiryAt != nil {
+			expiryKey = batch.ExpiryAt.UTC().Format("2006-01-02")
+		}
+		key := fmt.Sprintf("%s|%s|%s|%t", expiryKey,
+			decimal.NewFromFloat(batch.CostPerUnit).StringFixed(4), batch.Unit, batch.IsExpired)
+		if _, exists := groups[key]; !exists {
+			groupOrder = append(groupOrder, key)
+		}
+		groups[key] = append(groups[key], batch)
+	}
+
+	mergedCount := 0
+	for _, key := range groupOrder {
+		group := groups[key]
+		if len(group) < 2 {
+			continue
+		}
+
+		// Самая ранняя партия становится наследником
+		survivor := group[0]
+		totalQuantity := decimal.NewFromFloat(survivor.Quantity)
+		totalRemaining := decimal.NewFromFloat(survivor.RemainingQuantity)
+		absorbedIDs := make([]string, 0, len(group)-1)
+		for _, batch := range group[1:] {
+			totalQuantity = totalQuantity.Add(decimal.NewFromFloat(batch.Quantity))
+			totalRemaining = totalRemaining.Add(decimal.NewFromFloat(batch.RemainingQuantity))
+			absorbedIDs = append(absorbedIDs, batch.ID)
+		}
+
+		// Переносим ссылки движений склада на партию-наследника
+		if err := tx.Model(&models.StockMovement{}).
+			Where("stock_batch_id IN ?", absorbedIDs).
+			Update("stock_batch_id", survivor.ID).Error; err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("ошибка переноса движений на партию %s: %w", survivor.ID, err)
+		}
+
+		// Уведомления поглощенных партий закрываем - наследник получит свои при следующей проверке
+		now := time.Now()
+		if err := tx.Model(&models.ExpiryAlert{}).
+			Where("stock_batch_id IN ? AND is_resolved = false", absorbedIDs).
+			Updates(map[string]interface{}{"is_resolved": true, "resolved_at": now}).Error; err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("ошибка закрытия уведомлений поглощенных партий: %w", err)
+		}
+
+		if err := tx.Model(&models.StockBatch{}).
+			Where("id = ?", survivor.ID).
+			Updates(map[string]interface{}{
+				"quantity":           totalQuantity.InexactFloat64(),
+				"remaining_quantity": totalRemaining.InexactFloat64(),
+			}).Error; err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("ошибка обновления партии %s: %w", survivor.ID, err)
+		}
+
+		// Мягкое удаление поглощенных партий
+		if err := tx.Where("id IN ?", absorbedIDs).Delete(&models.StockBatch{}).Error; err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("ошибка удаления поглощенных партий: %w", err)
+		}
+
+		mergedCount += len(absorbedIDs)
+		log.Printf("🔗 Объединено %d партий в партию %s (остаток: %.2f %s)",
+			len(group), survivor.ID, totalRemaining.InexactFloat64(), survivor.Unit)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, fmt.Errorf("ошибка коммита транзакции: %w", err)
+	}
+
+	return mergedCount, nil
+}
+
+// MovementTypeCostCorrection - тип записи журнала движений для ручного исправления цены партии
+const MovementTypeCostCorrection = "cost_correction"
+
+// CorrectBatchCost явно исправляет цену партии (CostPerUnit за InboundUnit)
+// Изменение записывается в журнал движений (stock_movements) с количеством 0: старая и новая цена, причина, автор
+func (s *StockService) CorrectBatchCost(batchID string, newCostPerUnit float64, performedBy string, reason string) (*models.StockBatch, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("PostgreSQL недоступен")
+	}
+	if newCostPerUnit < 0 {
+		return nil, fmt.Errorf("цена не может быть отрицательной")
+	}
+
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var batch models.StockBatch
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&batch, "id = ?", batchID).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("партия не найдена: %w", err)
+	}
+
+	oldCostPerUnit := batch.CostPerUnit
+	if err := tx.Model(&batch).Update("cost_per_unit", newCostPerUnit).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("ошибка обновления цены партии: %w", err)
+	}
+
+	notes := fmt.Sprintf("Исправление цены партии: %.2f₽ -> %.2f₽ за %s", oldCostPerUnit, newCostPerUnit, batch.Unit)
+	if reason != "" {
+		notes += ". Причина: " + reason
+	}
+	movement := models.StockMovement{
+		StockBatchID:   &batch.ID,
+		NomenclatureID: batch.NomenclatureID,
+		BranchID:       batch.BranchID,
+		Quantity:       0, // Количество не меняется - только стоимость
+		Unit:           batch.Unit,
+		MovementType:   MovementTypeCostCorrection,
+		PerformedBy:    performedBy,
+		Notes:          notes,
+	}
+	if err := tx.Create(&movement).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("ошибка записи в журнал движений: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("ошибка коммита транзакции: %w", err)
+	}
+
+	log.Printf("✏️ CorrectBatchCost: партия %s, %.2f₽ -> %.2f₽ (by %s)", batch.ID, oldCostPerUnit, newCostPerUnit, performedBy)
+	return &batch, nil
+}
+
+// SuspectedCostError - партия, цена которой похожа на цену за грамм/мл вместо кг/л
+type SuspectedCostError struct {
+	BatchID              string    `json:"batch_id"`
+	NomenclatureID       string    `json:"nomenclature_id"`
+	ProductName          string    `json:"product_name"`
+	BranchID             string    `json:"branch_id"`
+	CostPerUnit          float64   `json:"cost_per_unit"`
+	InboundUnit          string    `json:"inbound_unit"`
+	LastPrice            float64   `json:"last_price"`             // Последняя закупочная цена товара (для сравнения)
+	SuggestedCostPerUnit float64   `json:"suggested_cost_per_unit"` // CostPerUnit * 1000 - только подсказка, не применяется
+	RemainingQuantity    float64   `json:"remaining_quantity"`
+	CreatedAt            time.Time `json:"created_at"`
+}
+
+// FindSuspectedCostErrors возвращает партии с подозрительно низкой ценой (< 10₽ за кг/л)
+// Нужен для партий, оприходованных до появления price_entry_unit: новые партии нормализуются при оприходовании
+// Только чтение: исправление выполняется вручную через CorrectBatchCost после проверки
+func (s *StockService) FindSuspectedCostErrors(branchID string) ([]SuspectedCostError, error) {
+	if s.db == nil {
+		return nil, fmt.Errorf("PostgreSQL недоступен")
+	}
+
+	query := s.db.Model(&models.StockBatch{}).
+		Preload("Nomenclature").
+		Where("remaining_quantity > 0 AND cost_per_unit > 0 AND cost_per_unit < 10")
+	if branchID != "" && branchID != "all" {
+		query = query.Where("branch_id = ?", branchID)
+	}
+
+	var batches []models.StockBatch
+	if err := query.Order("created_at DESC").Find(&batches).Error; err != nil {
+		return nil, fmt.Errorf("ошибка получения партий: %w", err)
+	}
+
+	suspects := make([]SuspectedCostError, 0)
+	for _, batch := range batches {
+		nomenclature := batch.Nomenclature
+		weighed := (nomenclature.BaseUnit == "g" && nomenclature.InboundUnit == "kg") ||
+			(nomenclature.BaseUnit == "ml" && nomenclature.InboundUnit == "l")
+		if !weighed {
+			continue
+		}
+		suspects = append(suspects, SuspectedCostError{
+			BatchID:              batch.ID,
+			NomenclatureID:       batch.NomenclatureID,
+			ProductName:          nomenclature.Name,
+			BranchID:             batch.BranchID,
+			CostPerUnit:          batch.CostPerUnit,
+			InboundUnit:          nomenclature.InboundUnit,
+			LastPrice:            nomenclature.LastPrice,
+			SuggestedCostPerUnit: batch.CostPerUnit * 1000,
+			RemainingQuantity:    batch.RemainingQuantity,
+			CreatedAt:            batch.CreatedAt,
+		})
+	}
+
+	return suspects, nil
+}
+
 // GetAtRiskInventory возвращает товары с риском истечения срока годности
 func (s *StockService) GetAtRiskInventory(branchID string) ([]map[string]interface{}, error) {
 	var batches []models.StockBatch
@@ -523,9 +480,17 @@ func (s *StockService) GetAtRiskInventory(branchID string) ([]map[string]interfa
 	}
 	
 	atRiskItems := []map[string]interface{}{}
+	quarantineByNomenclature := make(map[string]time.Duration)
 	
 	for _, batch := range batches {
-		if !s.isAtRisk(batch) {
+		// Партия в карантине уже не списывается, но еще числится на складе - ее нужно списать вручную
+		quarantine, ok := quarantineByNomenclature[batch.NomenclatureID]
+		if !ok {
+			quarantine = s.getDepletionPolicy(s.db, batch.Nomenclature).Quarantine
+			quarantineByNomenclature[batch.NomenclatureID] = quarantine
+		}
+		quarantined := inQuarantine(*batch.ExpiryAt, quarantine, time.Now())
+		if !s.isAtRisk(batch) && !quarantined {
 			continue
 		}
 		
@@ -538,6 +503,13 @@ func (s *StockService) GetAtRiskInventory(branchID string) ([]map[string]interfa
 		// Рассчитываем, успеем ли продать до истечения срока
 		canSellBeforeExpiry := salesVelocity > 0 && (float64(batch.RemainingQuantity)/salesVelocity) < float64(daysUntilExpiry)
 		
+		riskLevel := s.getRiskLevel(hoursUntilExpiry)
+		if quarantined {
+			// Продать уже нельзя: в продажу партия не попадет
+			canSellBeforeExpiry = false
+			riskLevel = "critical"
+		}
+		
 		atRiskItems = append(atRiskItems, map[string]interface{}{
 			"batch_id":          batch.ID,
 			"product_id":        batch.NomenclatureID,
@@ -551,7 +523,8 @@ func (s *StockService) GetAtRiskInventory(branchID string) ([]map[string]interfa
 			"days_until_expiry": daysUntilExpiry,
 			"sales_velocity":   salesVelocity,
 			"can_sell_before_expiry": canSellBeforeExpiry,
-			"risk_level":       s.getRiskLevel(hoursUntilExpiry),
+			"risk_level":       riskLevel,
+			"quarantined":      quarantined,
 			"branch_id":        batch.BranchID,
 		})
 	}
@@ -584,25 +557,24 @@ func (s *StockService) GetExpiryAlerts(branchID string, alertType string) ([]mod
 	return alerts, nil
 }
 
-// processIngredientDepletion рекурсивно обрабатывает списание ингредиента (сырье или полуфабрикат)
-func (s *StockService) processIngredientDepletion(ingredient models.RecipeIngredient, requiredQuantity float64, branchID string, performedBy string, saleID string, visitedRecipes map[string]bool) error {
-	// Защита от циклических зависимостей
-	if ingredient.IngredientRecipeID != nil {
-		if visitedRecipes[*ingredient.IngredientRecipeID] {
-			return fmt.Errorf("обнаружена циклическая зависимость в рецептах: %s", *ingredient.IngredientRecipeID)
-		}
-		visitedRecipes[*ingredient.IngredientRecipeID] = true
-	}
-
+// processIngredientDepletion рекурсивно обрабатывает списание ингредиента (сырье или полуфабрикат) внутри транзакции продажи
+// path - цепочка рецептов текущей ветки (защита от циклов и слишком глубокой вложенности)
+func (s *StockService) processIngredientDepletion(tx *gorm.DB, ingredient models.RecipeIngredient, requiredQuantity float64, branchID string, performedBy string, saleID string, path *recipePath) error {
 	// Если ингредиент - это полуфабрикат (есть связанный рецепт)
 	if ingredient.IngredientRecipeID != nil {
 		// Загружаем рецепт полуфабриката
 		var subRecipe models.Recipe
-		if err := s.db.Preload("Ingredients").Preload("Ingredients.Nomenclature").Preload("Ingredients.IngredientRecipe").
+		if err := tx.Preload("Ingredients").Preload("Ingredients.Nomenclature").Preload("Ingredients.IngredientRecipe").
 			First(&subRecipe, "id = ?", *ingredient.IngredientRecipeID).Error; err != nil {
 			return fmt.Errorf("рецепт полуфабриката не найден: %w", err)
 		}
 
+		// Защита от циклических зависимостей и слишком глубокой вложенности
+		if err := path.enter(subRecipe.ID, subRecipe.Name); err != nil {
+			return err
+		}
+		defer path.leave()
+
 		// Рекурсивно списываем ингредиенты полуфабриката
 		// requiredQuantity уже в граммах, нужно пересчитать на количество порций полуфабриката
 		// Если в рецепте указано 500g теста, а нужно 1000g, то нужно 2 порции теста
@@ -610,7 +582,7 @@ func (s *StockService) processIngredientDepletion(ingredient models.RecipeIngred
 
 		for _, subIngredient := range subRecipe.Ingredients {
 			subRequiredQuantity := subIngredient.Quantity * subRecipeQuantity
-			if err := s.processIngredientDepletion(subIngredient, subRequiredQuantity, branchID, performedBy, saleID, visitedRecipes); err != nil {
+			if err := s.processIngredientDepletion(tx, subIngredient, subRequiredQuantity, branchID, performedBy, saleID, path); err != nil {
 				return err
 			}
 		}
@@ -622,106 +594,169 @@ func (s *StockService) processIngredientDepletion(ingredient models.RecipeIngred
 		return fmt.Errorf("ингредиент должен иметь либо nomenclature_id, либо ingredient_recipe_id")
 	}
 
-	// Находим партии с достаточным остатком (FIFO по сроку годности)
-	var batches []models.StockBatch
-	if err := s.db.Where("nomenclature_id = ? AND branch_id = ? AND remaining_quantity > 0 AND is_expired = false",
-		*ingredient.NomenclatureID, branchID).
-		Order("COALESCE(expiry_at, '9999-12-31') ASC"). // Сначала с ближайшим сроком годности
-		Find(&batches).Error; err != nil {
+	// Находим партии с остатком (по стратегии категории, без карантина) и блокируем их до конца транзакции
+	batches, err := s.depletableBatches(tx, ingredient, branchID)
+	if err != nil {
 		return err
 	}
 
-	remainingToDeduct := requiredQuantity
-
-	for _, batch := range batches {
-		if remainingToDeduct <= 0 {
-			break
+	// Нехватка выясняется до записи движений: при ней продажа откатывается целиком
+	deductions, shortage := planBatchDeductions(batches, requiredQuantity)
+	if shortage > 0 {
+		ingredientName := *ingredient.NomenclatureID
+		if ingredient.Nomenclature != nil {
+			ingredientName = ingredient.Nomenclature.Name
 		}
+		return fmt.Errorf("%w: ингредиент '%s' (требуется: %.2f g, недостает: %.2f g)",
+			ErrInsufficientStock, ingredientName, requiredQuantity, shortage)
+	}
 
-		deductQuantity := remainingToDeduct
-		if batch.RemainingQuantity < deductQuantity {
-			deductQuantity = batch.RemainingQuantity
-		}
+	for _, deduction := range deductions {
+		batch := deduction.Batch
 
 		// Создаем движение остатков
 		movement := models.StockMovement{
 			StockBatchID:      &batch.ID,
 			NomenclatureID:    *ingredient.NomenclatureID,
 			BranchID:          branchID,
-			Quantity:          -deductQuantity, // Отрицательное = расход (в граммах)
-			Unit:              "g",              // Всегда граммы
+			Quantity:          -deduction.Quantity, // Отрицательное = расход (в граммах)
+			Unit:              "g",                 // Всегда граммы
 			MovementType:      "sale",
 			SourceReferenceID: &saleID,
 			PerformedBy:       performedBy,
 			Notes:             "Автоматическое списание при продаже",
 		}
 
-		if err := s.db.Create(&movement).Error; err != nil {
+		if err := tx.Create(&movement).Error; err != nil {
 			return err
 		}
 
 		// Обновляем остаток партии
 		// ВАЖНО: Обновляем ТОЛЬКО RemainingQuantity, CostPerUnit никогда не меняется (это константа закупки)
-		batch.RemainingQuantity -= deductQuantity
-		if err := s.db.Model(&batch).Update("remaining_quantity", batch.RemainingQuantity).Error; err != nil {
+		batch.RemainingQuantity -= deduction.Quantity
+		if err := tx.Model(&batch).Update("remaining_quantity", batch.RemainingQuantity).Error; err != nil {
 			return err
 		}
-
-		remainingToDeduct -= deductQuantity
 	}
 
-	if remainingToDeduct > 0 {
-		var ingredientName string
-		if ingredient.Nomenclature != nil {
-			ingredientName = ingredient.Nomenclature.Name
-		} else {
-			ingredientName = "неизвестный ингредиент"
+	return nil
+}
+
+// depletableBatches загружает партии сырья ингредиента, которые можно списать, в порядке стратегии категории товара
+// (как debitNomenclatureFromStock): без просроченных партий и партий в карантине, с блокировкой до конца транзакции
+func (s *StockService) depletableBatches(tx *gorm.DB, ingredient models.RecipeIngredient, branchID string) ([]models.StockBatch, error) {
+	nomenclature := ingredient.Nomenclature
+	if nomenclature == nil {
+		nomenclature = &models.NomenclatureItem{}
+		if err := tx.Select("id", "name", "category_id", "category_name").
+			First(nomenclature, "id = ?", *ingredient.NomenclatureID).Error; err != nil {
+			return nil, fmt.Errorf("номенклатура не найдена: %w", err)
 		}
-		log.Printf("⚠️ Недостаточно остатков для ингредиента %s (требуется: %.2f g, недостает: %.2f g)",
-			ingredientName, requiredQuantity, remainingToDeduct)
 	}
 
-	return nil
+	policy := s.getDepletionPolicy(tx, *nomenclature)
+	var batches []models.StockBatch
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("nomenclature_id = ? AND branch_id = ? AND remaining_quantity > 0 AND is_expired = false AND deleted_at IS NULL",
+			nomenclature.ID, branchID)
+	if err := excludeQuarantined(query, policy.Quarantine).
+		Order(depletionOrder(policy.Strategy)).
+		Find(&batches).Error; err != nil {
+		return nil, fmt.Errorf("ошибка получения партий '%s': %w", nomenclature.Name, err)
+	}
+	return batches, nil
+}
+
+// batchDeduction - сколько списать с партии при продаже
+type batchDeduction struct {
+	Batch    models.StockBatch
+	Quantity float64
+}
+
+// planBatchDeductions раскладывает required по партиям в порядке batches (FEFO) и возвращает недостающее количество
+// shortage > 0 - остатков партий не хватает, списывать нельзя
+func planBatchDeductions(batches []models.StockBatch, required float64) ([]batchDeduction, float64) {
+	remaining := required
+	deductions := make([]batchDeduction, 0, len(batches))
+	for _, batch := range batches {
+		if remaining <= 0 {
+			break
+		}
+		quantity := math.Min(remaining, batch.RemainingQuantity)
+		if quantity <= 0 {
+			continue
+		}
+		deductions = append(deductions, batchDeduction{Batch: batch, Quantity: quantity})
+		remaining -= quantity
+	}
+	return deductions, math.Max(remaining, 0)
 }
 
 // ProcessSaleDepletion обрабатывает списание ингредиентов при продаже (с поддержкой рекурсивных рецептов)
+// Все ингредиенты списываются в одной транзакции: при любой ошибке (в том числе ErrInsufficientStock)
+// ни одна партия не меняется и движения не пишутся
 func (s *StockService) ProcessSaleDepletion(recipeID string, quantity float64, branchID string, performedBy string, saleID string) error {
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := s.depleteRecipe(tx, recipeID, quantity, branchID, performedBy, saleID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("ошибка коммита транзакции: %w", err)
+	}
+
+	return nil
+}
+
+// depleteRecipe списывает ингредиенты quantity порций рецепта внутри транзакции продажи tx (рекурсивно по полуфабрикатам)
+func (s *StockService) depleteRecipe(tx *gorm.DB, recipeID string, quantity float64, branchID string, performedBy string, saleID string) error {
 	// Получаем рецепт
 	var recipe models.Recipe
-	if err := s.db.Preload("Ingredients").Preload("Ingredients.Nomenclature").Preload("Ingredients.IngredientRecipe").
+	if err := tx.Preload("Ingredients").Preload("Ingredients.Nomenclature").Preload("Ingredients.IngredientRecipe").
 		First(&recipe, "id = ?", recipeID).Error; err != nil {
 		return err
 	}
 
 	// Для каждого ингредиента списываем остатки (рекурсивно)
-	visitedRecipes := make(map[string]bool)
-	visitedRecipes[recipeID] = true // Помечаем текущий рецепт как посещенный
+	path := s.newRecipePath()
+	if err := path.enter(recipe.ID, recipe.Name); err != nil {
+		return err
+	}
 
 	for _, ingredient := range recipe.Ingredients {
 		// requiredQuantity в граммах (quantity - количество порций готового продукта)
 		requiredQuantity := ingredient.Quantity * quantity
 
-		if err := s.processIngredientDepletion(ingredient, requiredQuantity, branchID, performedBy, saleID, visitedRecipes); err != nil {
+		if err := s.processIngredientDepletion(tx, ingredient, requiredQuantity, branchID, performedBy, saleID, path); err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
 // CalculatePrimeCost рекурсивно рассчитывает себестоимость рецепта (в рублях)
-// visitedRecipes может быть nil - функция создаст новый map
-func (s *StockService) CalculatePrimeCost(recipeID string, visitedRecipes map[string]bool) (float64, error) {
-	if visitedRecipes == nil {
-		visitedRecipes = make(map[string]bool)
-	}
-	
-	// Защита от циклических зависимостей
-	if visitedRecipes[recipeID] {
-		return 0, fmt.Errorf("обнаружена циклическая зависимость в рецептах: %s", recipeID)
-	}
-	visitedRecipes[recipeID] = true
+// Ошибка ErrRecipeCycle/ErrRecipeDepthExceeded - если полуфабрикаты зациклены или вложены слишком глубоко
+func (s *StockService) CalculatePrimeCost(recipeID string) (float64, error) {
+	return s.calculatePrimeCost(recipeID, s.newRecipePath(), lastPurchasePrice)
+}
+
+// ingredientPriceFunc возвращает цену сырья за InboundUnit (кг/л/шт), по которой оценивается ингредиент
+type ingredientPriceFunc func(nomenclature models.NomenclatureItem) (float64, error)
 
+// lastPurchasePrice - цена последней закупки (NomenclatureItem.LastPrice)
+func lastPurchasePrice(nomenclature models.NomenclatureItem) (float64, error) {
+	return nomenclature.LastPrice, nil
+}
+
+// calculatePrimeCost рассчитывает себестоимость рецепта в ветке обхода path, сырье оценивается по unitPrice
+func (s *StockService) calculatePrimeCost(recipeID string, path *recipePath, unitPrice ingredientPriceFunc) (float64, error) {
 	// Получаем рецепт
 	var recipe models.Recipe
 	if err := s.db.Preload("Ingredients").Preload("Ingredients.Nomenclature").Preload("Ingredients.IngredientRecipe").
@@ -729,6 +764,12 @@ func (s *StockService) CalculatePrimeCost(recipeID string, visitedRecipes map[st
 		return 0, err
 	}
 
+	// Защита от циклических зависимостей и слишком глубокой вложенности
+	if err := path.enter(recipe.ID, recipe.Name); err != nil {
+		return 0, err
+	}
+	defer path.leave()
+
 	var totalCost float64 = 0
 
 	// Для каждого ингредиента рассчитываем стоимость
@@ -737,14 +778,8 @@ func (s *StockService) CalculatePrimeCost(recipeID string, visitedRecipes map[st
 
 		// Если ингредиент - это полуфабрикат (есть связанный рецепт)
 		if ingredient.IngredientRecipeID != nil {
-			// Создаем копию visitedRecipes для рекурсивного вызова
-			subVisited := make(map[string]bool)
-			for k, v := range visitedRecipes {
-				subVisited[k] = v
-			}
-			
 			// Рекурсивно рассчитываем себестоимость полуфабриката
-			subRecipeCost, err := s.CalculatePrimeCost(*ingredient.IngredientRecipeID, subVisited)
+			subRecipeCost, err := s.calculatePrimeCost(*ingredient.IngredientRecipeID, path, unitPrice)
 			if err != nil {
 				return 0, err
 			}
@@ -763,31 +798,17 @@ func (s *StockService) CalculatePrimeCost(recipeID string, visitedRecipes map[st
 				ingredientCost = 0
 			}
 		} else if ingredient.NomenclatureID != nil {
-			// Если ингредиент - это сырье, берем цену из номенклатуры
+			// Если ингредиент - это сырье, берем цену из номенклатуры (или из партий - см. unitPrice)
 			var nomenclature models.NomenclatureItem
 			if err := s.db.First(&nomenclature, "id = ?", *ingredient.NomenclatureID).Error; err != nil {
 				return 0, fmt.Errorf("номенклатура не найдена: %w", err)
 			}
-
-			// ВАЖНО: Используем правильную формулу расчета стоимости с shopspring/decimal для точности
-			// LastPrice хранится за InboundUnit (кг/л/шт) - это нормализованная цена за единицу
-			// ingredient.Quantity в BaseUnit (г/мл/шт)
-			// Формула: TotalCost = (QuantityInGrams / 1000) * CostPerUnit(за кг)
-			// Пример: (5500г / 1000) * 122.1₽/кг = 5.5 * 122.1 = 671.55₽
-			conversionFactor := decimal.NewFromFloat(1.0)
-			if nomenclature.BaseUnit == "g" && nomenclature.InboundUnit == "kg" {
-				conversionFactor = decimal.NewFromInt(1000)
-			} else if nomenclature.BaseUnit == "ml" && nomenclature.InboundUnit == "l" {
-				conversionFactor = decimal.NewFromInt(1000)
-			} else if nomenclature.ConversionFactor > 0 {
-				conversionFactor = decimal.NewFromFloat(nomenclature.ConversionFactor)
+			price, err := unitPrice(nomenclature)
+			if err != nil {
+				return 0, err
 			}
-			
-			// Используем calculateBatchValue для точного расчета стоимости
-			quantityDecimal := decimal.NewFromFloat(ingredient.Quantity)
-			priceDecimal := decimal.NewFromFloat(nomenclature.LastPrice)
-			ingredientCostDecimal := calculateBatchValue(quantityDecimal, priceDecimal, conversionFactor)
-			ingredientCost = ingredientCostDecimal.InexactFloat64()
+
+			ingredientCost = rawIngredientCost(nomenclature, ingredient.Quantity, price)
 		} else {
 			return 0, fmt.Errorf("ингредиент должен иметь либо nomenclature_id, либо ingredient_recipe_id")
 		}
@@ -798,6 +819,26 @@ func (s *StockService) CalculatePrimeCost(recipeID string, visitedRecipes map[st
 	return totalCost, nil
 }
 
+// rawIngredientCost - стоимость quantity сырья (в BaseUnit) по цене price за InboundUnit
+func rawIngredientCost(nomenclature models.NomenclatureItem, quantity, price float64) float64 {
+	// ВАЖНО: Используем правильную формулу расчета стоимости с shopspring/decimal для точности
+	// Цена хранится за InboundUnit (кг/л/шт) - это нормализованная цена за единицу
+	// quantity в BaseUnit (г/мл/шт)
+	// Формула: TotalCost = (QuantityInGrams / 1000) * CostPerUnit(за кг)
+	// Пример: (5500г / 1000) * 122.1₽/кг = 5.5 * 122.1 = 671.55₽
+	conversionFactor := decimal.NewFromFloat(1.0)
+	if nomenclature.BaseUnit == "g" && nomenclature.InboundUnit == "kg" {
+		conversionFactor = decimal.NewFromInt(1000)
+	} else if nomenclature.BaseUnit == "ml" && nomenclature.InboundUnit == "l" {
+		conversionFactor = decimal.NewFromInt(1000)
+	} else if nomenclature.ConversionFactor > 0 {
+		conversionFactor = decimal.NewFromFloat(nomenclature.ConversionFactor)
+	}
+
+	// Используем calculateBatchValue для точного расчета стоимости
+	return calculateBatchValue(decimal.NewFromFloat(quantity), decimal.NewFromFloat(price), conversionFactor).InexactFloat64()
+}
+
 // CommitProduction обрабатывает ручное производство полуфабриката
 // quantity - количество производимого полуфабриката в граммах
 func (s *StockService) CommitProduction(recipeID string, quantity float64, branchID string, performedBy string, productionOrderID string) error {
@@ -818,8 +859,7 @@ func (s *StockService) CommitProduction(recipeID string, quantity float64, branc
 	}
 
 	// Рассчитываем себестоимость
-	visitedRecipes := make(map[string]bool)
-	primeCost, err := s.CalculatePrimeCost(recipeID, visitedRecipes)
+	primeCost, err := s.CalculatePrimeCost(recipeID)
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("ошибка расчета себестоимости: %w", err)
@@ -830,8 +870,11 @@ func (s *StockService) CommitProduction(recipeID string, quantity float64, branc
 	totalCost := costPerGram * quantity
 
 	// Списываем ингредиенты (используем рекурсивную логику)
-	visitedRecipes = make(map[string]bool)
-	visitedRecipes[recipeID] = true
+	path := s.newRecipePath()
+	if err := path.enter(recipe.ID, recipe.Name); err != nil {
+		tx.Rollback()
+		return err
+	}
 
 	// Количество порций для списания
 	portionsToProduce := quantity / recipe.PortionSize
@@ -839,7 +882,7 @@ func (s *StockService) CommitProduction(recipeID string, quantity float64, branc
 	for _, ingredient := range recipe.Ingredients {
 		requiredQuantity := ingredient.Quantity * portionsToProduce
 
-		if err := s.processIngredientDepletionInTx(tx, ingredient, requiredQuantity, branchID, performedBy, productionOrderID, visitedRecipes); err != nil {
+		if err := s.processIngredientDepletionInTx(tx, ingredient, requiredQuantity, branchID, performedBy, productionOrderID, path); err != nil {
 			tx.Rollback()
 			return err
 		}
@@ -866,15 +909,7 @@ func (s *StockService) CommitProduction(recipeID string, quantity float64, branc
 }
 
 // processIngredientDepletionInTx - версия processIngredientDepletion для работы внутри транзакции
-func (s *StockService) processIngredientDepletionInTx(tx *gorm.DB, ingredient models.RecipeIngredient, requiredQuantity float64, branchID string, performedBy string, sourceID string, visitedRecipes map[string]bool) error {
-	// Защита от циклических зависимостей
-	if ingredient.IngredientRecipeID != nil {
-		if visitedRecipes[*ingredient.IngredientRecipeID] {
-			return fmt.Errorf("обнаружена циклическая зависимость в рецептах: %s", *ingredient.IngredientRecipeID)
-		}
-		visitedRecipes[*ingredient.IngredientRecipeID] = true
-	}
-
+func (s *StockService) processIngredientDepletionInTx(tx *gorm.DB, ingredient models.RecipeIngredient, requiredQuantity float64, branchID string, performedBy string, sourceID string, path *recipePath) error {
 	// Если ингредиент - это полуфабрикат
 	if ingredient.IngredientRecipeID != nil {
 		var subRecipe models.Recipe
@@ -883,11 +918,17 @@ func (s *StockService) processIngredientDepletionInTx(tx *gorm.DB, ingredient mo
 			return fmt.Errorf("рецепт полуфабриката не найден: %w", err)
 		}
 
+		// Защита от циклических зависимостей и слишком глубокой вложенности
+		if err := path.enter(subRecipe.ID, subRecipe.Name); err != nil {
+			return err
+		}
+		defer path.leave()
+
 		subRecipeQuantity := requiredQuantity / subRecipe.PortionSize
 
 		for _, subIngredient := range subRecipe.Ingredients {
 			subRequiredQuantity := subIngredient.Quantity * subRecipeQuantity
-			if err := s.processIngredientDepletionInTx(tx, subIngredient, subRequiredQuantity, branchID, performedBy, sourceID, visitedRecipes); err != nil {
+			if err := s.processIngredientDepletionInTx(tx, subIngredient, subRequiredQuantity, branchID, performedBy, sourceID, path); err != nil {
 				return err
 			}
 		}
@@ -899,11 +940,8 @@ func (s *StockService) processIngredientDepletionInTx(tx *gorm.DB, ingredient mo
 		return fmt.Errorf("ингредиент должен иметь либо nomenclature_id, либо ingredient_recipe_id")
 	}
 
-	var batches []models.StockBatch
-	if err := tx.Where("nomenclature_id = ? AND branch_id = ? AND remaining_quantity > 0 AND is_expired = false",
-		*ingredient.NomenclatureID, branchID).
-		Order("COALESCE(expiry_at, '9999-12-31') ASC").
-		Find(&batches).Error; err != nil {
+	batches, err := s.depletableBatches(tx, ingredient, branchID)
+	if err != nil {
 		return err
 	}
 
@@ -1031,13 +1069,9 @@ func (s *StockService) DebitIngredients(recipeID string, branchID string, quanti
 				return fmt.Errorf("ошибка конвертации единиц для полуфабриката '%s': %w", subRecipe.Name, err)
 			}
 
-			// Проверяем наличие на складе
-			var totalStock float64
-			if err := tx.Model(&models.StockBatch{}).
-				Where("nomenclature_id = ? AND branch_id = ? AND remaining_quantity > 0 AND is_expired = false AND deleted_at IS NULL",
-					semiFinishedNomenclature.ID, branchID).
-				Select("COALESCE(SUM(remaining_quantity), 0)").
-				Scan(&totalStock).Error; err != nil {
+			// Проверяем наличие на складе (без партий в карантине и резервов заказов)
+			totalStock, err := s.unreservedStock(tx, semiFinishedNomenclature, branchID)
+			if err != nil {
 				tx.Rollback()
 				return fmt.Errorf("ошибка проверки остатков полуфабриката '%s': %w", subRecipe.Name, err)
 			}
@@ -1050,7 +1084,7 @@ func (s *StockService) DebitIngredients(recipeID string, branchID string, quanti
 			}
 
 			// Списываем полуфабрикат со склада (FEFO)
-			if err := s.debitNomenclatureFromStock(tx, semiFinishedNomenclature.ID, requiredInBaseUnit, branchID, recipeID, performedByUser, semiFinishedNomenclature); err != nil {
+			if err := s.debitNomenclatureFromStock(tx, semiFinishedNomenclature.ID, requiredInBaseUnit, branchID, recipeID, performedByUser, semiFinishedNomenclature, ""); err != nil {
 				tx.Rollback()
 				return fmt.Errorf("ошибка списания полуфабриката '%s': %w", subRecipe.Name, err)
 			}
@@ -1079,26 +1113,52 @@ func (s *StockService) DebitIngredients(recipeID string, branchID string, quanti
 			return fmt.Errorf("ошибка конвертации единиц для %s: %w", nomenclature.Name, err)
 		}
 
-		// Проверяем наличие на складе
-		var totalStock float64
-		if err := tx.Model(&models.StockBatch{}).
-			Where("nomenclature_id = ? AND branch_id = ? AND remaining_quantity > 0 AND is_expired = false AND deleted_at IS NULL",
-				*ingredient.NomenclatureID, branchID).
-			Select("COALESCE(SUM(remaining_quantity), 0)").
-			Scan(&totalStock).Error; err != nil {
+		// Проверяем наличие на складе (без партий в карантине и резервов заказов)
+		totalStock, err := s.unreservedStock(tx, nomenclature, branchID)
+		if err != nil {
 			tx.Rollback()
 			return fmt.Errorf("ошибка проверки остатков: %w", err)
 		}
 
 		if totalStock < requiredInBaseUnit {
-			missingItems = append(missingItems,
-				fmt.Sprintf("'%s': требуется %.4f %s, доступно %.4f %s",
-					nomenclature.Name, requiredInBaseUnit, nomenclature.BaseUnit, totalStock, nomenclature.BaseUnit))
-			continue // Продолжаем проверку остальных ингредиентов
+			// Если рецепт разрешает замены - недостающее покрываем одобренными заменителями
+			var substitutes []substitutionDebit
+			if recipe.AllowSubstitutions {
+				substitutes, err = s.planSubstitution(tx, nomenclature, requiredInBaseUnit-totalStock, branchID)
+				if err != nil {
+					tx.Rollback()
+					return err
+				}
+			}
+			if substitutes == nil {
+				missingItems = append(missingItems,
+					fmt.Sprintf("'%s': требуется %.4f %s, доступно %.4f %s",
+						nomenclature.Name, requiredInBaseUnit, nomenclature.BaseUnit, totalStock, nomenclature.BaseUnit))
+				continue // Продолжаем проверку остальных ингредиентов
+			}
+
+			// Основной товар списываем сколько есть, остальное - заменителями
+			if totalStock > 0 {
+				if err := s.debitNomenclatureFromStock(tx, nomenclature.ID, totalStock, branchID, recipeID, performedByUser, nomenclature, ""); err != nil {
+					tx.Rollback()
+					return fmt.Errorf("ошибка списания '%s': %w", nomenclature.Name, err)
+				}
+			}
+			for _, sub := range substitutes {
+				notes := fmt.Sprintf("Замена: '%s' вместо '%s' (%.4f %s вместо %.4f %s, коэффициент %.4f), рецепт: %s",
+					sub.Nomenclature.Name, nomenclature.Name, sub.Quantity, sub.Nomenclature.BaseUnit,
+					sub.Covers, nomenclature.BaseUnit, sub.Substitution.ConversionRatio, recipeID)
+				if err := s.debitNomenclatureFromStock(tx, sub.Nomenclature.ID, sub.Quantity, branchID, recipeID, performedByUser, sub.Nomenclature, notes); err != nil {
+					tx.Rollback()
+					return fmt.Errorf("ошибка списания заменителя '%s': %w", sub.Nomenclature.Name, err)
+				}
+				log.Printf("🔁 '%s' заменен на '%s': %.4f %s", nomenclature.Name, sub.Nomenclature.Name, sub.Quantity, sub.Nomenclature.BaseUnit)
+			}
+			continue
 		}
 
 		// Списываем сырье со склада (FEFO)
-		if err := s.debitNomenclatureFromStock(tx, *ingredient.NomenclatureID, requiredInBaseUnit, branchID, recipeID, performedByUser, nomenclature); err != nil {
+		if err := s.debitNomenclatureFromStock(tx, *ingredient.NomenclatureID, requiredInBaseUnit, branchID, recipeID, performedByUser, nomenclature, ""); err != nil {
 			tx.Rollback()
 			return fmt.Errorf("ошибка списания '%s': %w", nomenclature.Name, err)
 		}
@@ -1114,7 +1174,7 @@ func (s *StockService) DebitIngredients(recipeID string, branchID string, quanti
 			errorMsg += fmt.Sprintf("  %d. %s\n", i+1, item)
 		}
 		errorMsg += "\nПроизводство полуфабрикатов должно быть выполнено отдельно через Production service."
-		return fmt.Errorf(errorMsg)
+		return fmt.Errorf("%s", errorMsg)
 	}
 
 	// Коммитим транзакцию
@@ -1126,20 +1186,28 @@ func (s *StockService) DebitIngredients(recipeID string, branchID string, quanti
 	return nil
 }
 
-// debitNomenclatureFromStock списывает номенклатуру со склада по FEFO принципу
+// debitNomenclatureFromStock списывает номенклатуру со склада по стратегии категории товара (FEFO по умолчанию)
 // Это вспомогательный метод для упрощения кода DebitIngredients
-func (s *StockService) debitNomenclatureFromStock(tx *gorm.DB, nomenclatureID string, requiredQuantity float64, branchID string, sourceRecipeID string, performedBy string, nomenclature models.NomenclatureItem) error {
-	// Получаем доступные партии с FEFO сортировкой и пессимистической блокировкой
+// notes - комментарий к движению (пустой - стандартный "Списание при производстве")
+func (s *StockService) debitNomenclatureFromStock(tx *gorm.DB, nomenclatureID string, requiredQuantity float64, branchID string, sourceRecipeID string, performedBy string, nomenclature models.NomenclatureItem, notes string) error {
+	if notes == "" {
+		notes = fmt.Sprintf("Списание при производстве (рецепт: %s)", sourceRecipeID)
+	}
+
+	// Получаем доступные партии в порядке списания и с пессимистической блокировкой
+	// Партии в карантине (срок годности истекает в ближайшие quarantine_hours категории) не списываются
+	policy := s.getDepletionPolicy(tx, nomenclature)
 	var batches []models.StockBatch
-	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
 		Where("nomenclature_id = ? AND branch_id = ? AND remaining_quantity > 0 AND is_expired = false AND deleted_at IS NULL",
-			nomenclatureID, branchID).
-		Order("COALESCE(expiry_at, '9999-12-31'::timestamp) ASC, created_at ASC").
+			nomenclatureID, branchID)
+	if err := excludeQuarantined(query, policy.Quarantine).
+		Order(depletionOrder(policy.Strategy)).
 		Find(&batches).Error; err != nil {
 		return fmt.Errorf("ошибка получения партий: %w", err)
 	}
 
-	// Списываем по FEFO принципу (частичное списание по батчам)
+	// Списываем по выбранной стратегии (частичное списание по батчам)
 	remainingToDeduct := requiredQuantity
 
 	for i := range batches {
@@ -1163,7 +1231,7 @@ func (s *StockService) debitNomenclatureFromStock(tx *gorm.DB, nomenclatureID st
 			MovementType:      "production",
 			SourceReferenceID: &sourceRecipeID,
 			PerformedBy:       performedBy,
-			Notes:             fmt.Sprintf("Списание при производстве (рецепт: %s)", sourceRecipeID),
+			Notes:             notes,
 		}
 
 		if err := tx.Create(&movement).Error; err != nil {
@@ -1179,21 +1247,134 @@ func (s *StockService) debitNomenclatureFromStock(tx *gorm.DB, nomenclatureID st
 
 		remainingToDeduct -= deductQuantity
 
-		log.Printf("📦 Списано %.4f %s из партии %s (остаток: %.4f %s)",
-			deductQuantity, nomenclature.BaseUnit, batch.ID, batch.RemainingQuantity, nomenclature.BaseUnit)
+		log.Printf("📦 Списано %.4f %s из партии %s (остаток: %.4f %s)",
+			deductQuantity, nomenclature.BaseUnit, batch.ID, batch.RemainingQuantity, nomenclature.BaseUnit)
+	}
+
+	// Партий без карантина не хватило: частичное списание не допускаем, транзакцию откатывает вызывающий
+	if remainingToDeduct > 1e-6 {
+		return fmt.Errorf("%w: '%s' (требуется %.4f %s, не хватает %.4f %s)", ErrInsufficientStock,
+			nomenclature.Name, requiredQuantity, nomenclature.BaseUnit, remainingToDeduct, nomenclature.BaseUnit)
+	}
+
+	return nil
+}
+
+// debitIngredientRecursive УДАЛЕН - больше не используется
+// Логика упрощена: полуфабрикаты проверяются как обычные товары на складе
+// Рекурсивное "взрывание" полуфабрикатов больше не выполняется
+
+// convertToBaseUnit конвертирует количество из единицы ингредиента в базовую единицу номенклатуры
+// 
+// ВАЖНО: Использует float64, что может привести к погрешностям округления при больших объемах.
+// depletionOrder возвращает ORDER BY для выборки партий по стратегии списания
+// FEFO: партии без срока годности идут последними и между собой - по дате поступления
+func depletionOrder(strategy string) string {
+	switch strategy {
+	case models.DepletionStrategyFIFO:
+		return "created_at ASC"
+	case models.DepletionStrategyLIFO:
+		return "created_at DESC"
+	default:
+		return "COALESCE(expiry_at, '9999-12-31'::timestamp) ASC, created_at ASC"
+	}
+}
+
+// depletionPolicy - правила списания партий товара, заданные его категорией
+type depletionPolicy struct {
+	Strategy   string        // fefo, fifo, lifo
+	Quarantine time.Duration // За сколько до истечения срока годности партия перестает списываться (0 - до самого срока)
+}
+
+// getDepletionPolicy определяет стратегию списания и карантин по категории товара (FEFO без карантина, если категория не задана)
+func (s *StockService) getDepletionPolicy(tx *gorm.DB, nomenclature models.NomenclatureItem) depletionPolicy {
+	policy := depletionPolicy{Strategy: models.DepletionStrategyFEFO}
+
+	var category models.NomenclatureCategory
+	query := tx.Select("depletion_strategy", "quarantine_hours")
+	var err error
+	if nomenclature.CategoryID != nil && *nomenclature.CategoryID != "" {
+		err = query.Where("id = ?", *nomenclature.CategoryID).First(&category).Error
+	} else if nomenclature.CategoryName != "" {
+		err = query.Where("name = ?", nomenclature.CategoryName).First(&category).Error
+	} else {
+		return policy
+	}
+	if err != nil {
+		return policy
+	}
+	if strategy, ok := models.NormalizeDepletionStrategy(category.DepletionStrategy); ok {
+		policy.Strategy = strategy
+	}
+	if category.QuarantineHours > 0 {
+		policy.Quarantine = time.Duration(category.QuarantineHours) * time.Hour
+	}
+	return policy
+}
+
+// inQuarantine - партия со сроком годности expiryAt на момент now уже в карантине и не списывается
+// (то же условие, что и в excludeQuarantined)
+func inQuarantine(expiryAt time.Time, quarantine time.Duration, now time.Time) bool {
+	return quarantine > 0 && !expiryAt.After(now.Add(quarantine))
+}
+
+// excludeQuarantined исключает из выборки партии, срок годности которых истекает раньше чем через quarantine
+// Партии без срока годности доступны всегда
+func excludeQuarantined(query *gorm.DB, quarantine time.Duration) *gorm.DB {
+	if quarantine <= 0 {
+		return query
+	}
+	return query.Where("(expiry_at IS NULL OR expiry_at > ?)", time.Now().Add(quarantine))
+}
+
+// usableStock возвращает остаток товара в филиале, который можно списать: без просроченных партий и партий в карантине
+// (те же условия, что и у выборки в debitNomenclatureFromStock)
+func (s *StockService) usableStock(tx *gorm.DB, nomenclature models.NomenclatureItem, branchID string) (float64, error) {
+	var total float64
+	query := tx.Model(&models.StockBatch{}).
+		Where("nomenclature_id = ? AND branch_id = ? AND remaining_quantity > 0 AND is_expired = false AND deleted_at IS NULL",
+			nomenclature.ID, branchID)
+	if err := excludeQuarantined(query, s.getDepletionPolicy(tx, nomenclature).Quarantine).
+		Select("COALESCE(SUM(remaining_quantity), 0)").
+		Scan(&total).Error; err != nil {
+		return 0, fmt.Errorf("ошибка проверки остатков '%s': %w", nomenclature.Name, err)
+	}
+	return total, nil
+}
+
+// ingredientQuarantine возвращает карантин сырья ингредиента (номенклатура подгружается, если не была в Preload)
+func (s *StockService) ingredientQuarantine(ingredient models.RecipeIngredient) time.Duration {
+	if ingredient.Nomenclature != nil {
+		return s.getDepletionPolicy(s.db, *ingredient.Nomenclature).Quarantine
+	}
+	var nomenclature models.NomenclatureItem
+	if err := s.db.Select("id", "category_id", "category_name").Where("id = ?", *ingredient.NomenclatureID).First(&nomenclature).Error; err != nil {
+		return 0
 	}
+	return s.getDepletionPolicy(s.db, nomenclature).Quarantine
+}
 
-	return nil
+// countableUnitRank - штучные единицы по возрастанию размера (коробка крупнее штуки)
+var countableUnitRank = map[string]int{
+	"pcs": 1, "шт": 1,
+	"box": 2, "pack": 2, "упак": 2,
 }
 
-// debitIngredientRecursive УДАЛЕН - больше не используется
-// Логика упрощена: полуфабрикаты проверяются как обычные товары на складе
-// Рекурсивное "взрывание" полуфабрикатов больше не выполняется
+// isSmallerUnit проверяет, что unit мельче базовой единицы baseUnit
+// Базовая единица склада по соглашению минимальная, поэтому любая другая единица считается крупнее,
+// кроме штучных единиц, для которых размер известен (pcs при base=box)
+func isSmallerUnit(unit, baseUnit string) bool {
+	unitRank, baseRank := countableUnitRank[unit], countableUnitRank[baseUnit]
+	return unitRank > 0 && baseRank > 0 && unitRank < baseRank
+}
 
-// convertToBaseUnit конвертирует количество из единицы ингредиента в базовую единицу номенклатуры
-// 
-// ВАЖНО: Использует float64, что может привести к погрешностям округления при больших объемах.
+// convertToBaseUnit пересчитывает количество ингредиента из единицы рецепта fromUnit в базовую единицу склада
 func (s *StockService) convertToBaseUnit(quantity float64, fromUnit string, nomenclature models.NomenclatureItem) (float64, error) {
+	return convertQuantityToBaseUnit(quantity, fromUnit, nomenclature)
+}
+
+// convertQuantityToBaseUnit - правила пересчета единиц, общие для списания (StockService) и проверки рецептов (RecipeService)
+func convertQuantityToBaseUnit(quantity float64, fromUnit string, nomenclature models.NomenclatureItem) (float64, error) {
 	// Если единицы совпадают, возвращаем как есть
 	if fromUnit == nomenclature.BaseUnit {
 		return quantity, nil
@@ -1215,37 +1396,35 @@ func (s *StockService) convertToBaseUnit(quantity float64, fromUnit string, nome
 		return quantity * 1000.0, nil
 	}
 
-	// Конвертация штуки -> граммы/килограммы (требуется unit_weight)
-	if fromUnit == "pcs" {
-		if nomenclature.UnitWeight <= 0 {
-			return 0, fmt.Errorf("для конвертации штук (pcs) в %s требуется указать unit_weight в номенклатуре товара '%s'", nomenclature.BaseUnit, nomenclature.Name)
-		}
-		
-		// Конвертируем штуки в граммы
+	isWeightBase := nomenclature.BaseUnit == "g" || nomenclature.BaseUnit == "kg"
+
+	// Конвертация штуки/коробки -> граммы/килограммы (unit_weight - вес одной единицы в граммах)
+	if countableUnitRank[fromUnit] > 0 && isWeightBase && nomenclature.UnitWeight > 0 {
 		grams := quantity * nomenclature.UnitWeight
-		
-		// Если базовая единица - килограммы, конвертируем граммы в кг
 		if nomenclature.BaseUnit == "kg" {
 			return grams / 1000.0, nil
 		}
-		if nomenclature.BaseUnit == "g" {
-			return grams, nil
-		}
-		
-		// Если базовая единица не граммы/килограммы, возвращаем ошибку
-		return 0, fmt.Errorf("конвертация штук (pcs) в %s не поддерживается (требуется g или kg)", nomenclature.BaseUnit)
+		return grams, nil
 	}
 
-	// Используем коэффициент конвертации из номенклатуры
-	if nomenclature.ConversionFactor > 0 {
-		// Если production_unit отличается от base_unit, используем conversion_factor
-		if fromUnit == nomenclature.ProductionUnit && nomenclature.BaseUnit != nomenclature.ProductionUnit {
-			return quantity / nomenclature.ConversionFactor, nil
+	// Штуки в граммы без веса единицы не пересчитать (conversion_factor по умолчанию 1 дал бы 1 шт = 1 г)
+	if fromUnit == "pcs" && isWeightBase {
+		return 0, fmt.Errorf("для конвертации штук (pcs) в %s требуется указать unit_weight в номенклатуре товара '%s'", nomenclature.BaseUnit, nomenclature.Name)
+	}
+
+	// Коэффициент конвертации из номенклатуры связывает единицу закупки/производства с базовой единицей
+	// Направление определяется тем, какая единица крупнее: крупная -> базовая умножается, мелкая -> базовая делится
+	// (например, base=pcs, production=box, factor=12: 1 box = 12 pcs; base=box, production=pcs: 12 pcs = 1 box)
+	if nomenclature.ConversionFactor > 0 && (fromUnit == nomenclature.ProductionUnit || fromUnit == nomenclature.InboundUnit) {
+		// Коэффициент хранится как "сколько мелких единиц в крупной"; значения < 1 - тот же коэффициент, записанный в обратную сторону
+		perLargerUnit := nomenclature.ConversionFactor
+		if perLargerUnit < 1 {
+			perLargerUnit = 1 / perLargerUnit
 		}
-		// Если inbound_unit отличается от base_unit
-		if fromUnit == nomenclature.InboundUnit && nomenclature.BaseUnit != nomenclature.InboundUnit {
-			return quantity / nomenclature.ConversionFactor, nil
+		if isSmallerUnit(fromUnit, nomenclature.BaseUnit) {
+			return quantity / perLargerUnit, nil
 		}
+		return quantity * perLargerUnit, nil
 	}
 
 	// Если единицы не совпадают и нет способа конвертации
@@ -1253,139 +1432,143 @@ func (s *StockService) convertToBaseUnit(quantity float64, fromUnit string, nome
 		fromUnit, nomenclature.BaseUnit, nomenclature.Name)
 }
 
-// GetStockMovements возвращает список движений склада с фильтрацией
-// branchID - фильтр по филиалу (пустая строка или "all" = все филиалы)
-// movementType - фильтр по типу движения (sale, production, adjustment, waste, invoice, пустая строка = все)
-// dateFrom - начальная дата (опционально)
-// dateTo - конечная дата (опционально)
-// searchQuery - поиск по названию товара (опционально)
-// limit - максимальное количество записей (по умолчанию 1000)
-func (s *StockService) GetStockMovements(branchID, movementType, dateFrom, dateTo, searchQuery string, limit int) ([]models.StockMovement, error) {
-	if limit <= 0 || limit > 10000 {
-		limit = 1000 // Защита от слишком больших запросов
+// StockMovementFilter - фильтры и страница журнала движений склада
+// Пустые строковые поля не фильтруют; branch_id "all" - все филиалы
+type StockMovementFilter struct {
+	BranchID       string
+	MovementType   string
+	NomenclatureID string
+	PerformedBy    string
+	DateFrom       string // YYYY-MM-DD или RFC3339
+	DateTo         string // YYYY-MM-DD (включительно) или RFC3339
+	Search         string // Поиск по названию товара
+	Limit          int
+	Offset         int
+}
+
+// GetStockMovements возвращает журнал движений склада (аудит) с фильтрами и пагинацией
+// Возвращает страницу движений и общее количество по примененным фильтрам
+// Сортировка created_at DESC, id DESC - стабильна между страницами и идет по индексу (branch_id, created_at)
+func (s *StockService) GetStockMovements(filter StockMovementFilter) ([]models.StockMovement, int64, error) {
+	if filter.Limit <= 0 || filter.Limit > 10000 {
+		filter.Limit = 1000 // Защита от слишком больших запросов
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
 	}
 
-	query := s.db.Model(&models.StockMovement{}).
-		Preload("Nomenclature").
-		Preload("Batch").
-		Order("created_at DESC")
+	query := s.db.Model(&models.StockMovement{})
 
 	// Фильтр по филиалу
-	if branchID != "" && branchID != "all" {
-		query = query.Where("branch_id = ?", branchID)
+	if filter.BranchID != "" && filter.BranchID != "all" {
+		query = query.Where("stock_movements.branch_id = ?", filter.BranchID)
 	}
 
 	// Фильтр по типу движения
-	if movementType != "" {
-		query = query.Where("movement_type = ?", movementType)
+	if filter.MovementType != "" {
+		query = query.Where("stock_movements.movement_type = ?", filter.MovementType)
+	}
+
+	// Фильтр по товару
+	if filter.NomenclatureID != "" {
+		query = query.Where("stock_movements.nomenclature_id = ?", filter.NomenclatureID)
+	}
+
+	// Фильтр по сотруднику
+	if filter.PerformedBy != "" {
+		query = query.Where("stock_movements.performed_by = ?", filter.PerformedBy)
 	}
 
 	// Фильтр по дате (от)
-	if dateFrom != "" {
-		if dateFromTime, err := time.Parse("2006-01-02", dateFrom); err == nil {
-			query = query.Where("created_at >= ?", dateFromTime)
+	if filter.DateFrom != "" {
+		if dateFromTime, err := timefmt.Parse(filter.DateFrom); err == nil {
+			query = query.Where("stock_movements.created_at >= ?", dateFromTime)
 		}
 	}
 
 	// Фильтр по дате (до)
-	if dateTo != "" {
-		if dateToTime, err := time.Parse("2006-01-02", dateTo); err == nil {
-			// Добавляем 23:59:59 к конечной дате, чтобы включить весь день
-			dateToTime = dateToTime.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
-			query = query.Where("created_at <= ?", dateToTime)
+	if filter.DateTo != "" {
+		// Дата берется целиком (строго меньше начала следующего дня), момент RFC3339 - как есть
+		if dateToTime, err := timefmt.RangeEnd(filter.DateTo, time.UTC); err == nil {
+			query = query.Where("stock_movements.created_at < ?", dateToTime)
 		}
 	}
 
 	// Поиск по названию товара (через JOIN с номенклатурой)
-	if searchQuery != "" {
+	if filter.Search != "" {
 		query = query.Joins("JOIN nomenclature_items ON stock_movements.nomenclature_id = nomenclature_items.id").
-			Where("nomenclature_items.name ILIKE ?", "%"+searchQuery+"%")
+			Where("nomenclature_items.name ILIKE ?", "%"+filter.Search+"%")
 	}
 
-	// Ограничение количества записей
-	query = query.Limit(limit)
+	// Общее количество по фильтрам (до пагинации)
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("ошибка подсчета движений: %w", err)
+	}
 
 	var movements []models.StockMovement
-	if err := query.Find(&movements).Error; err != nil {
-		return nil, fmt.Errorf("ошибка получения движений: %w", err)
+	if err := query.Preload("Nomenclature").
+		Preload("Batch").
+		Order("stock_movements.created_at DESC, stock_movements.id DESC").
+		Limit(filter.Limit).
+		Offset(filter.Offset).
+		Find(&movements).Error; err != nil {
+		return nil, 0, fmt.Errorf("ошибка получения движений: %w", err)
 	}
 
-	return movements, nil
+	return movements, total, nil
 }
 
-// CheckAndCreateExpiryAlerts проверяет сроки годности и создает уведомления
-func (s *StockService) CheckAndCreateExpiryAlerts() error {
-	now := time.Now()
-	warningThreshold := now.Add(3 * time.Hour) // За 3 часа до истечения
-	
-	// Находим партии, которые истекают в ближайшие 3 часа
-	var warningBatches []models.StockBatch
-	if err := s.db.Where("expiry_at IS NOT NULL").
-		Where("expiry_at <= ?", warningThreshold).
-		Where("expiry_at > ?", now).
-		Where("remaining_quantity > 0").
-		Where("is_expired = false").
-		Find(&warningBatches).Error; err != nil {
-		return err
+// GetMovementsBySourceReference возвращает движения, привязанные к продаже/производству (source_reference_id)
+// Используется для трассировки заказа: какие партии были списаны под него
+func (s *StockService) GetMovementsBySourceReference(referenceID string) ([]models.StockMovement, error) {
+	if _, err := uuid.Parse(referenceID); err != nil {
+		// source_reference_id - UUID колонка, другие идентификаторы в ней не встречаются
+		return []models.StockMovement{}, nil
 	}
-	
-	// Создаем предупреждения
-	for _, batch := range warningBatches {
-		// Проверяем, нет ли уже активного предупреждения
-		var existingAlert models.ExpiryAlert
-		if err := s.db.Where("stock_batch_id = ? AND alert_type = 'warning' AND is_resolved = false", batch.ID).
-			First(&existingAlert).Error; err == nil {
-			continue // Предупреждение уже существует
-		}
-		
-		alert := models.ExpiryAlert{
-			StockBatchID: batch.ID,
-			AlertType:    "warning",
-			ExpiresAt:    *batch.ExpiryAt,
-		}
-		
-		if err := s.db.Create(&alert).Error; err != nil {
-			log.Printf("❌ Ошибка создания предупреждения для партии %s: %v", batch.ID, err)
-		}
+
+	movements := make([]models.StockMovement, 0)
+	if err := s.db.Preload("Nomenclature").Preload("Batch").
+		Where("source_reference_id = ?", referenceID).
+		Order("created_at ASC").
+		Find(&movements).Error; err != nil {
+		return nil, fmt.Errorf("ошибка загрузки движений: %w", err)
 	}
-	
-	// Находим просроченные партии
-	var expiredBatches []models.StockBatch
-	if err := s.db.Where("expiry_at IS NOT NULL").
-		Where("expiry_at <= ?", now).
-		Where("remaining_quantity > 0").
-		Where("is_expired = false").
-		Find(&expiredBatches).Error; err != nil {
-		return err
+	return movements, nil
+}
+
+// CheckAndCreateExpiryAlerts проверяет сроки годности и создает уведомления (периодическая проверка)
+func (s *StockService) CheckAndCreateExpiryAlerts() error {
+	_, err := s.RecomputeExpiry()
+	return err
+}
+
+// notifyExpiredBatch отправляет критическое уведомление о просроченной партии во внешние каналы
+func (s *StockService) notifyExpiredBatch(batch models.StockBatch) {
+	if s.notificationService == nil {
+		return
 	}
-	
-	// Помечаем как просроченные и создаем критические уведомления
-	for _, batch := range expiredBatches {
-		batch.IsExpired = true
-		if err := s.db.Save(&batch).Error; err != nil {
-			log.Printf("❌ Ошибка обновления просроченной партии %s: %v", batch.ID, err)
-			continue
-		}
-		
-		// Создаем критическое уведомление
-		var existingAlert models.ExpiryAlert
-		if err := s.db.Where("stock_batch_id = ? AND alert_type = 'critical' AND is_resolved = false", batch.ID).
-			First(&existingAlert).Error; err == nil {
-			continue // Уведомление уже существует
-		}
-		
-		alert := models.ExpiryAlert{
-			StockBatchID: batch.ID,
-			AlertType:    "critical",
-			ExpiresAt:    *batch.ExpiryAt,
-		}
-		
-		if err := s.db.Create(&alert).Error; err != nil {
-			log.Printf("❌ Ошибка создания критического уведомления для партии %s: %v", batch.ID, err)
-		}
+
+	var item models.NomenclatureItem
+	productName := batch.NomenclatureID
+	if err := s.db.Select("id", "name").Where("id = ?", batch.NomenclatureID).First(&item).Error; err == nil {
+		productName = item.Name
 	}
-	
-	return nil
+
+	s.notificationService.Notify(Notification{
+		Key:     "expiry:critical:" + batch.ID,
+		Type:    "expiry_critical",
+		Level:   NotificationLevelCritical,
+		Title:   fmt.Sprintf("Просрочена партия: %s", productName),
+		Message: fmt.Sprintf("Остаток %.2f %s, срок годности истек %s", batch.RemainingQuantity, batch.Unit, batch.ExpiryAt.UTC().Format("02.01.2006 15:04 UTC")),
+		Data: map[string]interface{}{
+			"stock_batch_id":     batch.ID,
+			"nomenclature_id":    batch.NomenclatureID,
+			"branch_id":          batch.BranchID,
+			"remaining_quantity": batch.RemainingQuantity,
+			"expiry_at":          batch.ExpiryAt,
+		},
+	})
 }
 
 // Helper functions
@@ -1465,207 +1648,12 @@ func (s *StockService) calculateSalesVelocity(nomenclatureID string, branchID st
 // totalAmount: общая сумма накладной
 // isPaidCash: true если оплачено наличными (внутренний баланс), false если банком (официальный баланс)
 // invoiceDate: дата накладной (опционально, формат: 2006-01-02)
-func (s *StockService) ProcessInboundInvoice(invoiceID string, items []map[string]interface{}, performedBy string, counterpartyID string, totalAmount float64, isPaidCash bool, invoiceDate string) error {
+// Повторный вызов для уже проведенной накладной возвращает результат с AlreadyProcessed
+func (s *StockService) ProcessInboundInvoice(invoiceID string, items []map[string]interface{}, performedBy string, counterpartyID string, totalAmount float64, isPaidCash bool, invoiceDate string) (*InboundInvoiceResult, error) {
 	// ВАЖНО: Используем оптимизированную батч-версию для обработки
 	// ProcessInboundInvoiceBatch правильно нормализует цены (делит на pack_size если указан)
 	// и сохраняет CostPerUnit как цену за 1кг/1л, НЕ за грамм
 	return s.ProcessInboundInvoiceBatch(invoiceID, items, performedBy, counterpartyID, totalAmount, isPaidCash, invoiceDate)
-	// Начинаем транзакцию
-	tx := s.db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-	
-	for _, itemData := range items {
-		// Извлекаем данные товара
-		nomenclatureID, ok := itemData["nomenclature_id"].(string)
-		if !ok {
-			log.Printf("⚠️ Пропущен товар: отсутствует nomenclature_id")
-			continue
-		}
-		
-		quantity, ok := itemData["quantity"].(float64)
-		if !ok {
-			log.Printf("⚠️ Пропущен товар %s: неверное количество", nomenclatureID)
-			continue
-		}
-		
-		unit, ok := itemData["unit"].(string)
-		if !ok {
-			unit = "kg" // Значение по умолчанию
-		}
-		
-		pricePerUnit, ok := itemData["price_per_unit"].(float64)
-		if !ok {
-			pricePerUnit = 0
-		}
-		
-		branchID, ok := itemData["branch_id"].(string)
-		if !ok {
-			log.Printf("⚠️ Пропущен товар %s: отсутствует branch_id", nomenclatureID)
-			continue
-		}
-		
-		// Обрабатываем expiry_date (может быть строкой или null)
-		var expiryAt *time.Time
-		if expiryDate, exists := itemData["expiry_date"]; exists && expiryDate != nil {
-			if expiryStr, ok := expiryDate.(string); ok && expiryStr != "" {
-				if parsedTime, err := time.Parse("2006-01-02", expiryStr); err == nil {
-					expiryAt = &parsedTime
-				}
-			}
-		}
-		
-		// Создаем StockBatch
-		// SourceReferenceID используем только если invoiceID является валидным UUID
-		var sourceRefID *string
-		if invoiceID != "" {
-			// Проверяем, является ли invoiceID валидным UUID
-			if len(invoiceID) == 36 && (invoiceID[8] == '-' && invoiceID[13] == '-' && invoiceID[18] == '-' && invoiceID[23] == '-') {
-				sourceRefID = &invoiceID
-			} else {
-				// Если это не UUID (например, timestamp), не используем его как SourceReferenceID
-				log.Printf("⚠️ invoiceID '%s' не является UUID, SourceReferenceID не будет установлен", invoiceID)
-				sourceRefID = nil
-			}
-		}
-		
-		batch := models.StockBatch{
-			NomenclatureID:    nomenclatureID,
-			BranchID:          branchID,
-			Quantity:          quantity,
-			Unit:              unit,
-			CostPerUnit:       pricePerUnit,
-			ExpiryAt:          expiryAt,
-			Source:            "invoice",
-			SourceReferenceID: sourceRefID,
-			RemainingQuantity: quantity,
-		}
-		
-		if err := tx.Create(&batch).Error; err != nil {
-			tx.Rollback()
-			return fmt.Errorf("ошибка создания партии для товара %s: %v", nomenclatureID, err)
-		}
-		
-		// Создаем StockMovement
-		// SourceReferenceID используем только если invoiceID является валидным UUID
-		var movementSourceRefID *string
-		if invoiceID != "" {
-			// Проверяем, является ли invoiceID валидным UUID
-			if len(invoiceID) == 36 && (invoiceID[8] == '-' && invoiceID[13] == '-' && invoiceID[18] == '-' && invoiceID[23] == '-') {
-				movementSourceRefID = &invoiceID
-			} else {
-				movementSourceRefID = nil
-			}
-		}
-		
-		movement := models.StockMovement{
-			StockBatchID:      &batch.ID,
-			NomenclatureID:    nomenclatureID,
-			BranchID:          branchID,
-			Quantity:          quantity, // Положительное = приход
-			Unit:              unit,
-			MovementType:      "invoice",
-			SourceReferenceID: movementSourceRefID,
-			PerformedBy:       performedBy,
-			Notes:             fmt.Sprintf("Оприходование по накладной %s", invoiceID),
-		}
-		
-		if err := tx.Create(&movement).Error; err != nil {
-			tx.Rollback()
-			return fmt.Errorf("ошибка создания движения для товара %s: %v", nomenclatureID, err)
-		}
-		
-		// Обновляем last_price в NomenclatureItem
-		// ВАЖНО: pricePerUnit всегда указывается за Major Unit (кг/л/шт), а не за грамм/миллилитр
-		// Например: если товар хранится в граммах (base_unit = 'g'), но цена указывается за килограмм (inbound_unit = 'kg'),
-		// то pricePerUnit = 100 означает 100 руб за 1 кг, а не за 1 грамм
-		if pricePerUnit > 0 {
-			if err := tx.Model(&models.NomenclatureItem{}).
-				Where("id = ?", nomenclatureID).
-				Update("last_price", pricePerUnit).Error; err != nil {
-				log.Printf("⚠️ Ошибка обновления last_price для товара %s: %v", nomenclatureID, err)
-				// Не прерываем транзакцию, это не критично
-			} else {
-				log.Printf("✅ Обновлена цена для товара %s: %.2f (за Major Unit)", nomenclatureID, pricePerUnit)
-			}
-		}
-	}
-	
-	// Коммитим транзакцию
-	if err := tx.Commit().Error; err != nil {
-		return fmt.Errorf("ошибка коммита транзакции: %v", err)
-	}
-	
-	// Обновляем баланс контрагента и создаем финансовые записи (после коммита основной транзакции)
-	if counterpartyID != "" && totalAmount > 0 {
-		// Обновляем баланс контрагента
-		if s.counterpartyService != nil {
-			// Если не оплачено наличными, увеличиваем долг (положительная сумма = долг)
-			if !isPaidCash {
-				if err := s.counterpartyService.UpdateCounterpartyBalance(counterpartyID, totalAmount, true); err != nil {
-					log.Printf("⚠️ Ошибка обновления баланса контрагента: %v", err)
-					// Не возвращаем ошибку, это не критично для создания партий
-				} else {
-					log.Printf("✅ Обновлен баланс контрагента %s: +%.2f (официальный)", counterpartyID, totalAmount)
-				}
-			} else {
-				// Оплачено наличными - обновляем внутренний баланс
-				if err := s.counterpartyService.UpdateCounterpartyBalance(counterpartyID, totalAmount, false); err != nil {
-					log.Printf("⚠️ Ошибка обновления баланса контрагента: %v", err)
-				} else {
-					log.Printf("✅ Обновлен баланс контрагента %s: +%.2f (внутренний)", counterpartyID, totalAmount)
-				}
-			}
-		}
-
-		// Создаем финансовую транзакцию (Expense) и Bank Operation (если банковская)
-		if s.financeService != nil && len(items) > 0 {
-			// Парсим дату накладной или используем текущую дату
-			parsedDate := time.Now()
-			if invoiceDate != "" {
-				if parsed, err := time.Parse("2006-01-02", invoiceDate); err == nil {
-					parsedDate = parsed
-				}
-			}
-			
-			// Получаем branch_id из первого товара
-			branchID := ""
-			if branchIDVal, ok := items[0]["branch_id"].(string); ok {
-				branchID = branchIDVal
-			}
-			
-			if branchID != "" {
-				// Создаем Expense транзакцию
-				_, err := s.financeService.CreateExpenseFromInvoice(
-					invoiceID,
-					counterpartyID,
-					totalAmount,
-					branchID,
-					parsedDate,
-					isPaidCash,
-					performedBy,
-				)
-				if err != nil {
-					log.Printf("⚠️ Ошибка создания финансовой транзакции: %v", err)
-					// Не возвращаем ошибку, это не критично для создания партий
-				} else {
-					log.Printf("✅ Создана финансовая транзакция (Expense) для накладной %s", invoiceID)
-					
-					// Если это банковская операция (не наличные), создаем запись Bank Operation со статусом Pending
-					if !isPaidCash {
-						log.Printf("📋 Создана банковская операция со статусом Pending для накладной %s", invoiceID)
-						// Bank Operation уже создана как часть FinanceTransaction со статусом Pending
-					}
-				}
-			}
-		}
-	}
-	
-	log.Printf("✅ Обработана накладная %s: создано %d партий", invoiceID, len(items))
-	return nil
 }
 
 // CreateInvoice создает новую накладную (черновик) в БД
@@ -1826,14 +1814,16 @@ func (s *StockService) CheckRecipeAvailability(recipeID string, quantity float64
 	}
 
 	// Для каждого ингредиента проверяем остатки (рекурсивно)
-	visitedRecipes := make(map[string]bool)
-	visitedRecipes[recipeID] = true
+	path := s.newRecipePath()
+	if err := path.enter(recipe.ID, recipe.Name); err != nil {
+		return err
+	}
 
 	for _, ingredient := range recipe.Ingredients {
 		// requiredQuantity в граммах (quantity - количество порций готового продукта)
 		requiredQuantity := ingredient.Quantity * quantity
 
-		if err := s.checkIngredientAvailability(ingredient, requiredQuantity, branchID, visitedRecipes); err != nil {
+		if err := s.checkIngredientAvailability(ingredient, requiredQuantity, branchID, path); err != nil {
 			return err
 		}
 	}
@@ -1842,15 +1832,7 @@ func (s *StockService) CheckRecipeAvailability(recipeID string, quantity float64
 }
 
 // checkIngredientAvailability рекурсивно проверяет доступность ингредиента
-func (s *StockService) checkIngredientAvailability(ingredient models.RecipeIngredient, requiredQuantity float64, branchID string, visitedRecipes map[string]bool) error {
-	// Защита от циклических зависимостей
-	if ingredient.IngredientRecipeID != nil {
-		if visitedRecipes[*ingredient.IngredientRecipeID] {
-			return fmt.Errorf("обнаружена циклическая зависимость в рецептах: %s", *ingredient.IngredientRecipeID)
-		}
-		visitedRecipes[*ingredient.IngredientRecipeID] = true
-	}
-
+func (s *StockService) checkIngredientAvailability(ingredient models.RecipeIngredient, requiredQuantity float64, branchID string, path *recipePath) error {
 	// Если ингредиент - это полуфабрикат (есть связанный рецепт)
 	if ingredient.IngredientRecipeID != nil {
 		// Загружаем рецепт полуфабриката
@@ -1860,12 +1842,18 @@ func (s *StockService) checkIngredientAvailability(ingredient models.RecipeIngre
 			return fmt.Errorf("рецепт полуфабриката не найден: %w", err)
 		}
 
+		// Защита от циклических зависимостей и слишком глубокой вложенности
+		if err := path.enter(subRecipe.ID, subRecipe.Name); err != nil {
+			return err
+		}
+		defer path.leave()
+
 		// Рекурсивно проверяем ингредиенты полуфабриката
 		subRecipeQuantity := requiredQuantity / subRecipe.PortionSize // Количество порций полуфабриката
 
 		for _, subIngredient := range subRecipe.Ingredients {
 			subRequiredQuantity := subIngredient.Quantity * subRecipeQuantity
-			if err := s.checkIngredientAvailability(subIngredient, subRequiredQuantity, branchID, visitedRecipes); err != nil {
+			if err := s.checkIngredientAvailability(subIngredient, subRequiredQuantity, branchID, path); err != nil {
 				return err
 			}
 		}
@@ -1878,19 +1866,26 @@ func (s *StockService) checkIngredientAvailability(ingredient models.RecipeIngre
 	}
 
 	// Находим партии с достаточным остатком (FEFO по сроку годности)
+	// Партии в карантине по сроку годности не считаются доступными (как при списании)
 	var batches []models.StockBatch
-	if err := s.db.Where("nomenclature_id = ? AND branch_id = ? AND remaining_quantity > 0 AND is_expired = false",
-		*ingredient.NomenclatureID, branchID).
+	query := s.db.Where("nomenclature_id = ? AND branch_id = ? AND remaining_quantity > 0 AND is_expired = false",
+		*ingredient.NomenclatureID, branchID)
+	if err := excludeQuarantined(query, s.ingredientQuarantine(ingredient)).
 		Order("COALESCE(expiry_at, '9999-12-31') ASC").
 		Find(&batches).Error; err != nil {
 		return fmt.Errorf("ошибка получения партий: %w", err)
 	}
 
-	// Проверяем, достаточно ли остатков
+	// Проверяем, достаточно ли остатков (за вычетом резервов заказов)
 	availableQuantity := 0.0
 	for _, batch := range batches {
 		availableQuantity += batch.RemainingQuantity
 	}
+	reserved, err := reservedQuantity(s.db, *ingredient.NomenclatureID, branchID)
+	if err != nil {
+		return err
+	}
+	availableQuantity -= reserved
 
 	if availableQuantity < requiredQuantity {
 		var ingredientName string
@@ -1906,6 +1901,91 @@ func (s *StockService) checkIngredientAvailability(ingredient models.RecipeIngre
 	return nil
 }
 
+// GetMaxProducible считает, сколько порций рецепта можно приготовить из текущих остатков филиала
+// Для каждого ингредиента (рекурсивно через полуфабрикаты) ограничение = доступно / требуется на порцию,
+// результат - минимум по ингредиентам и название ингредиента-"узкого места"
+// Общее сырье разных полуфабрикатов учитывается независимо (как в CheckRecipeAvailability)
+func (s *StockService) GetMaxProducible(recipeID, branchID string) (float64, string, error) {
+	available := make(map[string]float64)
+	return s.maxProducibleForRecipe(recipeID, branchID, available, s.newRecipePath())
+}
+
+// maxProducibleForRecipe возвращает максимум порций рецепта и ограничивающий ингредиент
+// path - рецепты текущей ветки рекурсии (защита от циклов и глубины), available - кэш остатков по номенклатуре
+func (s *StockService) maxProducibleForRecipe(recipeID, branchID string, available map[string]float64, path *recipePath) (float64, string, error) {
+	var recipe models.Recipe
+	if err := s.db.Preload("Ingredients").Preload("Ingredients.Nomenclature").Preload("Ingredients.IngredientRecipe").
+		First(&recipe, "id = ?", recipeID).Error; err != nil {
+		return 0, "", fmt.Errorf("рецепт не найден: %w", err)
+	}
+
+	if err := path.enter(recipe.ID, recipe.Name); err != nil {
+		return 0, "", err
+	}
+	defer path.leave()
+
+	maxPortions := -1.0
+	bottleneck := ""
+	for _, ingredient := range recipe.Ingredients {
+		// Опциональные ингредиенты не ограничивают выпуск
+		if ingredient.IsOptional || ingredient.Quantity <= 0 {
+			continue
+		}
+
+		var limit float64
+		var name string
+		if ingredient.IngredientRecipeID != nil {
+			subPortions, subBottleneck, err := s.maxProducibleForRecipe(*ingredient.IngredientRecipeID, branchID, available, path)
+			if err != nil {
+				return 0, "", err
+			}
+			// Рецепт полуфабриката дает PortionSize единиц на порцию
+			portionSize := 1.0
+			if ingredient.IngredientRecipe != nil && ingredient.IngredientRecipe.PortionSize > 0 {
+				portionSize = ingredient.IngredientRecipe.PortionSize
+			}
+			limit = subPortions * portionSize / ingredient.Quantity
+			name = subBottleneck
+		} else if ingredient.NomenclatureID != nil {
+			qty, ok := available[*ingredient.NomenclatureID]
+			if !ok {
+				query := s.db.Model(&models.StockBatch{}).
+					Where("nomenclature_id = ? AND branch_id = ? AND remaining_quantity > 0 AND is_expired = false",
+						*ingredient.NomenclatureID, branchID)
+				if err := excludeQuarantined(query, s.ingredientQuarantine(ingredient)).
+					Select("COALESCE(SUM(remaining_quantity), 0)").
+					Scan(&qty).Error; err != nil {
+					return 0, "", fmt.Errorf("ошибка получения остатков: %w", err)
+				}
+				reserved, err := reservedQuantity(s.db, *ingredient.NomenclatureID, branchID)
+				if err != nil {
+					return 0, "", err
+				}
+				qty = math.Max(qty-reserved, 0)
+				available[*ingredient.NomenclatureID] = qty
+			}
+			limit = qty / ingredient.Quantity
+			if ingredient.Nomenclature != nil {
+				name = ingredient.Nomenclature.Name
+			} else {
+				name = *ingredient.NomenclatureID
+			}
+		} else {
+			return 0, "", fmt.Errorf("ингредиент должен иметь либо nomenclature_id, либо ingredient_recipe_id")
+		}
+
+		if maxPortions < 0 || limit < maxPortions {
+			maxPortions = limit
+			bottleneck = name
+		}
+	}
+
+	if maxPortions < 0 {
+		return 0, "", fmt.Errorf("рецепт '%s' не содержит обязательных ингредиентов", recipe.Name)
+	}
+	return maxPortions, bottleneck, nil
+}
+
 // CheckExtraAvailability проверяет доступность ингредиентов для допа
 // extraID - ID допа из таблицы extras
 // quantity - количество единиц допа
@@ -1945,6 +2025,11 @@ func (s *StockService) CheckExtraAvailability(extraID uint, quantity int, branch
 		for _, batch := range batches {
 			availableQuantity += batch.RemainingQuantity
 		}
+		reserved, err := reservedQuantity(s.db, *extra.NomenclatureID, branchID)
+		if err != nil {
+			return err
+		}
+		availableQuantity -= reserved
 
 		if availableQuantity < requiredQuantity {
 			extraName := extra.Name
@@ -1968,3 +2053,131 @@ func (s *StockService) CheckExtraAvailability(extraID uint, quantity int, branch
 }
 
 
+
+// StockValuationPoint - стоимость склада филиала на дату (точка истории оценки)
+type StockValuationPoint struct {
+	Date       string  `json:"date"`
+	BranchID   string  `json:"branch_id"`
+	TotalValue float64 `json:"total_value"`
+	ItemsCount int     `json:"items_count"`
+}
+
+// TakeValuationSnapshot сохраняет оценку остатков филиала на текущую дату
+// Стоимость берется из GetStockItems (та же decimal-формула), поэтому снимок сходится с живым отчетом
+// Повторный снимок за ту же дату заменяет предыдущий
+func (s *StockService) TakeValuationSnapshot(branchID string) error {
+	if branchID == "" || branchID == "all" {
+		return fmt.Errorf("branch_id обязателен для снимка склада")
+	}
+
+	items, err := s.GetStockItems(branchID, false)
+	if err != nil {
+		return fmt.Errorf("ошибка получения остатков: %w", err)
+	}
+
+	now := time.Now().UTC()
+	snapshotDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	snapshots := make([]models.StockSnapshot, 0, len(items))
+	totalValue := decimal.Zero
+	for _, item := range items {
+		nomenclatureID, _ := item["product_id"].(string)
+		if nomenclatureID == "" {
+			continue
+		}
+		name, _ := item["product_name"].(string)
+		baseUnit, _ := item["base_unit"].(string)
+		quantity, _ := item["current_stock"].(float64)
+		costValue, _ := item["cost_value"].(float64)
+
+		snapshots = append(snapshots, models.StockSnapshot{
+			SnapshotDate:     snapshotDate,
+			BranchID:         branchID,
+			NomenclatureID:   nomenclatureID,
+			NomenclatureName: name,
+			Quantity:         quantity,
+			BaseUnit:         baseUnit,
+			CostValue:        decimal.NewFromFloat(costValue).Round(2).InexactFloat64(),
+		})
+		totalValue = totalValue.Add(decimal.NewFromFloat(costValue))
+	}
+
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Where("snapshot_date = ? AND branch_id = ?", snapshotDate.Format("2006-01-02"), branchID).
+		Delete(&models.StockSnapshot{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("ошибка удаления предыдущего снимка: %w", err)
+	}
+
+	if len(snapshots) > 0 {
+		if err := tx.CreateInBatches(&snapshots, 200).Error; err != nil {
+			tx.Rollback()
+			return fmt.Errorf("ошибка сохранения снимка склада: %w", err)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("ошибка коммита транзакции: %w", err)
+	}
+
+	log.Printf("📸 Снимок склада филиала %s на %s: %d позиций, %s₽",
+		branchID, snapshotDate.Format("2006-01-02"), len(snapshots), totalValue.StringFixed(2))
+	return nil
+}
+
+// TakeValuationSnapshots делает снимок склада по всем активным филиалам (ежедневная задача)
+func (s *StockService) TakeValuationSnapshots() error {
+	var branches []models.Branch
+	if err := s.db.Where("is_active = ?", true).Find(&branches).Error; err != nil {
+		return fmt.Errorf("ошибка получения филиалов: %w", err)
+	}
+
+	var lastErr error
+	for _, branch := range branches {
+		if err := s.TakeValuationSnapshot(branch.ID); err != nil {
+			log.Printf("⚠️ Ошибка снимка склада филиала %s: %v", branch.ID, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// GetValuationHistory возвращает стоимость склада по дням из сохраненных снимков
+// branchID = "" или "all" - по всем филиалам (отдельная точка на каждый филиал)
+func (s *StockService) GetValuationHistory(branchID string, from, to time.Time) ([]StockValuationPoint, error) {
+	type valuationRow struct {
+		SnapshotDate time.Time
+		BranchID     string
+		TotalValue   float64
+		ItemsCount   int
+	}
+
+	query := s.db.Model(&models.StockSnapshot{}).
+		Select("snapshot_date, branch_id, SUM(cost_value) AS total_value, COUNT(*) AS items_count").
+		Where("snapshot_date BETWEEN ? AND ?", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if branchID != "" && branchID != "all" {
+		query = query.Where("branch_id = ?", branchID)
+	}
+
+	var rows []valuationRow
+	if err := query.Group("snapshot_date, branch_id").Order("snapshot_date ASC, branch_id ASC").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("ошибка получения истории оценки склада: %w", err)
+	}
+
+	points := make([]StockValuationPoint, 0, len(rows))
+	for _, row := range rows {
+		points = append(points, StockValuationPoint{
+			Date:       row.SnapshotDate.Format("2006-01-02"),
+			BranchID:   row.BranchID,
+			TotalValue: decimal.NewFromFloat(row.TotalValue).Round(2).InexactFloat64(),
+			ItemsCount: row.ItemsCount,
+		})
+	}
+	return points, nil
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestTakeValuationSnapshotRequiresBranch(t *testing.T) {
+	service := NewStockService(nil)
+	for _, branchID := range []string{"", "all"} {
+		if err := service.TakeValuationSnapshot(branchID); err == nil {
+			t.Errorf("снимок для branch_id %q принят", branchID)
+		}
+	}
+}
+
+// Снимок хранит стоимость остатка по товарам; повторный снимок за день заменяет предыдущий,
+// история суммирует стоимость по дням
+func TestValuationSnapshotAndHistory(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.StockBatch{}, &models.StockSnapshot{})
+	service := NewStockService(db)
+	branchID := uuid.New().String()
+
+	createItem := func(name string) string {
+		t.Helper()
+		item := models.NomenclatureItem{
+			SKU:              "TEST-" + uuid.New().String()[:8],
+			Name:             name,
+			BaseUnit:         "g",
+			InboundUnit:      "kg",
+			ConversionFactor: 1000,
+			IsActive:         true,
+		}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("не удалось создать товар: %v", err)
+		}
+		t.Cleanup(func() {
+			db.Unscoped().Where("id = ?", item.ID).Delete(&models.NomenclatureItem{})
+		})
+		return item.ID
+	}
+	createBatch := func(nomenclatureID string, grams, costPerKg float64) *models.StockBatch {
+		t.Helper()
+		batch := models.StockBatch{
+			NomenclatureID:    nomenclatureID,
+			BranchID:          branchID,
+			Quantity:          grams,
+			RemainingQuantity: grams,
+			Unit:              "g",
+			CostPerUnit:       costPerKg,
+			Source:            "adjustment",
+		}
+		if err := db.Create(&batch).Error; err != nil {
+			t.Fatalf("не удалось создать партию: %v", err)
+		}
+		return &batch
+	}
+	t.Cleanup(func() {
+		db.Where("branch_id = ?", branchID).Delete(&models.StockSnapshot{})
+		db.Unscoped().Where("branch_id = ?", branchID).Delete(&models.StockBatch{})
+	})
+
+	cheese := createBatch(createItem("Сыр"), 2000, 150)
+	createBatch(createItem("Мука"), 500, 40)
+
+	if err := service.TakeValuationSnapshot(branchID); err != nil {
+		t.Fatalf("TakeValuationSnapshot: %v", err)
+	}
+	// Остаток сыра уменьшился до 1 кг: повторный снимок за тот же день перезаписывает строки
+	if err := db.Model(cheese).Update("remaining_quantity", 1000).Error; err != nil {
+		t.Fatalf("не удалось изменить остаток: %v", err)
+	}
+	if err := service.TakeValuationSnapshot(branchID); err != nil {
+		t.Fatalf("повторный TakeValuationSnapshot: %v", err)
+	}
+
+	var snapshots []models.StockSnapshot
+	if err := db.Where("branch_id = ?", branchID).Find(&snapshots).Error; err != nil {
+		t.Fatalf("не удалось прочитать снимки: %v", err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("строк снимка %d, want 2 (по одной на товар)", len(snapshots))
+	}
+
+	today := time.Now().UTC()
+	points, err := service.GetValuationHistory(branchID, today.AddDate(0, 0, -1), today)
+	if err != nil {
+		t.Fatalf("GetValuationHistory: %v", err)
+	}
+	if len(points) != 1 {
+		t.Fatalf("точек истории %d, want 1: %+v", len(points), points)
+	}
+	// 1 кг * 150₽ + 0.5 кг * 40₽
+	if points[0].TotalValue != 170 || points[0].ItemsCount != 2 || points[0].Date != today.Format("2006-01-02") {
+		t.Errorf("точка истории %+v, want %s: 170₽, 2 позиции", points[0], today.Format("2006-01-02"))
+	}
+
+	// Период без снимков
+	points, err = service.GetValuationHistory(branchID, today.AddDate(0, 0, -10), today.AddDate(0, 0, -5))
+	if err != nil || len(points) != 0 {
+		t.Errorf("история за период без снимков: %+v (%v), want пусто", points, err)
+	}
+}
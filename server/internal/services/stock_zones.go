@@ -0,0 +1,95 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+	"zephyrvpn/server/internal/models"
+)
+
+// StockZoneGroup - остатки филиала в одной зоне хранения
+type StockZoneGroup struct {
+	Zone          string                   `json:"zone"`
+	ItemCount     int                      `json:"item_count"`
+	LowStockCount int                      `json:"low_stock_count"`
+	TotalValue    float64                  `json:"total_value"`   // Сумма cost_value товаров зоны
+	TotalByUnit   map[string]float64       `json:"total_by_unit"` // Сумма остатков по базовым единицам (g, ml, pcs)
+	Items         []map[string]interface{} `json:"items"`         // Строки в формате GetStockItems + storage_zone
+}
+
+// GetStockByZone группирует текущие (непросроченные) остатки филиала по зонам хранения номенклатуры
+// Зоны идут в порядке models.StorageZones, пустые зоны возвращаются с нулевыми итогами.
+// Товары со старым недопустимым значением зоны попадают в отдельные группы после основных
+func (s *StockService) GetStockByZone(branchID string) ([]*StockZoneGroup, error) {
+	if branchID == "" {
+		return nil, fmt.Errorf("branch_id обязателен")
+	}
+	items, err := s.GetStockItems(branchID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	nomenclatureIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		if id, ok := item["product_id"].(string); ok {
+			nomenclatureIDs = append(nomenclatureIDs, id)
+		}
+	}
+	zoneByItem := make(map[string]string, len(nomenclatureIDs))
+	if len(nomenclatureIDs) > 0 {
+		var zones []models.NomenclatureItem
+		if err := s.db.Unscoped().Select("id", "storage_zone").Where("id IN ?", nomenclatureIDs).Find(&zones).Error; err != nil {
+			return nil, fmt.Errorf("ошибка загрузки зон хранения: %w", err)
+		}
+		for _, zone := range zones {
+			zoneByItem[zone.ID] = zone.StorageZone
+		}
+	}
+
+	groups := make([]*StockZoneGroup, 0, len(models.StorageZones))
+	byZone := make(map[string]*StockZoneGroup)
+	addGroup := func(zone string) *StockZoneGroup {
+		group := &StockZoneGroup{
+			Zone:        zone,
+			TotalByUnit: make(map[string]float64),
+			Items:       make([]map[string]interface{}, 0),
+		}
+		groups = append(groups, group)
+		byZone[zone] = group
+		return group
+	}
+	for _, zone := range models.StorageZones {
+		addGroup(zone)
+	}
+
+	values := make(map[string]decimal.Decimal)
+	for _, item := range items {
+		id, _ := item["product_id"].(string)
+		zone := models.NormalizeStorageZone(zoneByItem[id])
+		if zone == "" {
+			zone = models.StorageZoneDry
+		}
+		group, ok := byZone[zone]
+		if !ok {
+			group = addGroup(zone)
+		}
+
+		item["storage_zone"] = zone
+		group.Items = append(group.Items, item)
+		group.ItemCount++
+		if status, _ := item["status"].(string); status == "low_stock" {
+			group.LowStockCount++
+		}
+		if unit, ok := item["base_unit"].(string); ok {
+			stock, _ := item["current_stock"].(float64)
+			group.TotalByUnit[unit] += stock
+		}
+		value, _ := item["cost_value"].(float64)
+		values[zone] = values[zone].Add(decimal.NewFromFloat(value))
+	}
+	for _, group := range groups {
+		group.TotalValue = values[group.Zone].Round(stockCostDecimals).InexactFloat64()
+	}
+
+	return groups, nil
+}
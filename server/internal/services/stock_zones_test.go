@@ -0,0 +1,94 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Остатки филиала: мороженое в морозильнике, сыр и сливки в холодильнике, мука без зоны (сухой склад)
+func TestGetStockByZoneGroupsAndTotals(t *testing.T) {
+	db := newTestDB(t, &models.NomenclatureItem{}, &models.StockBatch{}, &models.Branch{})
+	service := NewStockService(db)
+	branchID := uuid.New().String()
+
+	var itemIDs, batchIDs []string
+	newStock := func(name, baseUnit, zone string, remaining, cost float64) {
+		item := models.NomenclatureItem{
+			SKU:         "TEST-" + uuid.New().String()[:8],
+			Name:        name,
+			BaseUnit:    baseUnit,
+			InboundUnit: baseUnit,
+			StorageZone: zone,
+			IsActive:    true,
+		}
+		if err := db.Create(&item).Error; err != nil {
+			t.Fatalf("не удалось создать товар: %v", err)
+		}
+		itemIDs = append(itemIDs, item.ID)
+		batch := models.StockBatch{
+			NomenclatureID:    item.ID,
+			BranchID:          branchID,
+			Quantity:          remaining,
+			RemainingQuantity: remaining,
+			Unit:              baseUnit,
+			CostPerUnit:       cost,
+			Source:            "adjustment",
+		}
+		if err := db.Create(&batch).Error; err != nil {
+			t.Fatalf("не удалось создать партию: %v", err)
+		}
+		batchIDs = append(batchIDs, batch.ID)
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("id IN ?", batchIDs).Delete(&models.StockBatch{})
+		db.Unscoped().Where("id IN ?", itemIDs).Delete(&models.NomenclatureItem{})
+	})
+
+	newStock("Мороженое", "pcs", models.StorageZoneFreezer, 20, 50)
+	newStock("Сыр", "pcs", models.StorageZoneFridge, 4, 300)
+	newStock("Сливки", "pcs", models.StorageZoneFridge, 6, 100)
+	newStock("Мука", "pcs", "", 10, 40)
+
+	zones, err := service.GetStockByZone(branchID)
+	if err != nil {
+		t.Fatalf("GetStockByZone: %v", err)
+	}
+	if len(zones) != len(models.StorageZones) {
+		t.Fatalf("зон %d, want %d", len(zones), len(models.StorageZones))
+	}
+
+	want := map[string]struct {
+		items int
+		pcs   float64
+		value float64
+	}{
+		models.StorageZoneFreezer: {1, 20, 1000},
+		models.StorageZoneFridge:  {2, 10, 1800},
+		models.StorageZoneDry:     {1, 10, 400},
+		models.StorageZoneBar:     {0, 0, 0},
+	}
+	for i, group := range zones {
+		if group.Zone != models.StorageZones[i] {
+			t.Errorf("зона %d = %q, want %q", i, group.Zone, models.StorageZones[i])
+		}
+		w := want[group.Zone]
+		if group.ItemCount != w.items || len(group.Items) != w.items {
+			t.Errorf("%s: товаров %d (строк %d), want %d", group.Zone, group.ItemCount, len(group.Items), w.items)
+		}
+		if group.TotalByUnit["pcs"] != w.pcs {
+			t.Errorf("%s: остаток %.0f шт, want %.0f", group.Zone, group.TotalByUnit["pcs"], w.pcs)
+		}
+		if math.Abs(group.TotalValue-w.value) > 0.001 {
+			t.Errorf("%s: стоимость %.2f₽, want %.2f₽", group.Zone, group.TotalValue, w.value)
+		}
+		for _, item := range group.Items {
+			if item["storage_zone"] != group.Zone {
+				t.Errorf("%s: строка %v с зоной %v", group.Zone, item["product_name"], item["storage_zone"])
+			}
+		}
+	}
+}
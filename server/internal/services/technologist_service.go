@@ -262,6 +262,9 @@ func (ts *TechnologistService) CreateRecipeVersion(recipeID string, changedBy st
 		ChangedBy:       changedBy,
 		ChangeReason:    changeReason,
 		IngredientsJSON: string(ingredientsJSON),
+		PortionSize:     recipe.PortionSize,
+		Unit:            recipe.Unit,
+		InstructionText: recipe.InstructionText,
 	}
 
 	if err := ts.db.Create(version).Error; err != nil {
@@ -283,6 +286,148 @@ func (ts *TechnologistService) GetRecipeVersions(recipeID string) ([]models.Reci
 	return versions, nil
 }
 
+// IngredientChange - ингредиент, количество или единица которого изменились между версиями
+type IngredientChange struct {
+	Key         string  `json:"key"` // nomenclature_id или ingredient_recipe_id
+	Name        string  `json:"name"`
+	OldQuantity float64 `json:"old_quantity"`
+	NewQuantity float64 `json:"new_quantity"`
+	OldUnit     string  `json:"old_unit"`
+	NewUnit     string  `json:"new_unit"`
+}
+
+// RecipeDiff - разница между двумя версиями рецепта
+type RecipeDiff struct {
+	RecipeID           string                    `json:"recipe_id"`
+	FromVersion        int                       `json:"from_version"`
+	ToVersion          int                       `json:"to_version"`
+	Added              []models.RecipeIngredient `json:"added"`
+	Removed            []models.RecipeIngredient `json:"removed"`
+	Changed            []IngredientChange        `json:"changed"`
+	PortionSizeChanged bool                      `json:"portion_size_changed"`
+	OldPortionSize     float64                   `json:"old_portion_size"`
+	NewPortionSize     float64                   `json:"new_portion_size"`
+	OldUnit            string                    `json:"old_unit"`
+	NewUnit            string                    `json:"new_unit"`
+	InstructionChanged bool                      `json:"instruction_changed"`
+	OldInstructionText string                    `json:"old_instruction_text,omitempty"`
+	NewInstructionText string                    `json:"new_instruction_text,omitempty"`
+}
+
+// DiffRecipeVersions сравнивает две версии рецепта
+// Ингредиенты сопоставляются по номенклатуре (или по вложенному рецепту для полуфабрикатов)
+func (ts *TechnologistService) DiffRecipeVersions(recipeID string, fromVersion, toVersion int) (RecipeDiff, error) {
+	var from, to models.RecipeVersion
+	if err := ts.db.Where("recipe_id = ? AND version = ?", recipeID, fromVersion).First(&from).Error; err != nil {
+		return newRecipeDiff(recipeID, fromVersion, toVersion), fmt.Errorf("версия %d не найдена: %w", fromVersion, err)
+	}
+	if err := ts.db.Where("recipe_id = ? AND version = ?", recipeID, toVersion).First(&to).Error; err != nil {
+		return newRecipeDiff(recipeID, fromVersion, toVersion), fmt.Errorf("версия %d не найдена: %w", toVersion, err)
+	}
+	return diffRecipeVersions(from, to)
+}
+
+// newRecipeDiff создает пустую разницу версий (списки не nil, чтобы в JSON были [])
+func newRecipeDiff(recipeID string, fromVersion, toVersion int) RecipeDiff {
+	return RecipeDiff{
+		RecipeID:    recipeID,
+		FromVersion: fromVersion,
+		ToVersion:   toVersion,
+		Added:       make([]models.RecipeIngredient, 0),
+		Removed:     make([]models.RecipeIngredient, 0),
+		Changed:     make([]IngredientChange, 0),
+	}
+}
+
+// diffRecipeVersions сравнивает снимки двух загруженных версий
+func diffRecipeVersions(from, to models.RecipeVersion) (RecipeDiff, error) {
+	diff := newRecipeDiff(from.RecipeID, from.Version, to.Version)
+
+	fromIngredients, err := decodeVersionIngredients(from)
+	if err != nil {
+		return diff, err
+	}
+	toIngredients, err := decodeVersionIngredients(to)
+	if err != nil {
+		return diff, err
+	}
+
+	fromByKey := make(map[string]models.RecipeIngredient, len(fromIngredients))
+	for _, ing := range fromIngredients {
+		fromByKey[recipeIngredientKey(ing)] = ing
+	}
+	toKeys := make(map[string]bool, len(toIngredients))
+	for _, ing := range toIngredients {
+		key := recipeIngredientKey(ing)
+		toKeys[key] = true
+		old, ok := fromByKey[key]
+		if !ok {
+			diff.Added = append(diff.Added, ing)
+			continue
+		}
+		if old.Quantity != ing.Quantity || old.Unit != ing.Unit {
+			diff.Changed = append(diff.Changed, IngredientChange{
+				Key:         key,
+				Name:        recipeIngredientName(ing),
+				OldQuantity: old.Quantity,
+				NewQuantity: ing.Quantity,
+				OldUnit:     old.Unit,
+				NewUnit:     ing.Unit,
+			})
+		}
+	}
+	for _, ing := range fromIngredients {
+		if !toKeys[recipeIngredientKey(ing)] {
+			diff.Removed = append(diff.Removed, ing)
+		}
+	}
+
+	diff.OldPortionSize, diff.NewPortionSize = from.PortionSize, to.PortionSize
+	diff.OldUnit, diff.NewUnit = from.Unit, to.Unit
+	diff.PortionSizeChanged = from.PortionSize != to.PortionSize || from.Unit != to.Unit
+	if from.InstructionText != to.InstructionText {
+		diff.InstructionChanged = true
+		diff.OldInstructionText = from.InstructionText
+		diff.NewInstructionText = to.InstructionText
+	}
+
+	return diff, nil
+}
+
+// decodeVersionIngredients разбирает JSON снимок ингредиентов версии
+func decodeVersionIngredients(version models.RecipeVersion) ([]models.RecipeIngredient, error) {
+	ingredients := make([]models.RecipeIngredient, 0)
+	if version.IngredientsJSON == "" {
+		return ingredients, nil
+	}
+	if err := json.Unmarshal([]byte(version.IngredientsJSON), &ingredients); err != nil {
+		return nil, fmt.Errorf("ошибка разбора ингредиентов версии %d: %w", version.Version, err)
+	}
+	return ingredients, nil
+}
+
+// recipeIngredientKey возвращает ключ сопоставления ингредиента между версиями
+func recipeIngredientKey(ing models.RecipeIngredient) string {
+	if ing.NomenclatureID != nil {
+		return *ing.NomenclatureID
+	}
+	if ing.IngredientRecipeID != nil {
+		return "recipe:" + *ing.IngredientRecipeID
+	}
+	return ing.ID
+}
+
+// recipeIngredientName возвращает название ингредиента, если оно есть в снимке
+func recipeIngredientName(ing models.RecipeIngredient) string {
+	if ing.Nomenclature != nil {
+		return ing.Nomenclature.Name
+	}
+	if ing.IngredientRecipe != nil {
+		return ing.IngredientRecipe.Name
+	}
+	return ""
+}
+
 // GetRecipeUsageTree возвращает дерево использования рецепта (какие рецепты используют этот)
 func (ts *TechnologistService) GetRecipeUsageTree(recipeID string) (*models.RecipeUsageTree, error) {
 	var recipe models.Recipe
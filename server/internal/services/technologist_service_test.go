@@ -0,0 +1,106 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+)
+
+// recipeVersion собирает снимок версии рецепта с ингредиентами в JSON
+func recipeVersion(t *testing.T, version int, portionSize float64, instruction string, ingredients ...models.RecipeIngredient) models.RecipeVersion {
+	t.Helper()
+	data, err := json.Marshal(ingredients)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	return models.RecipeVersion{
+		RecipeID:        "recipe-1",
+		Version:         version,
+		IngredientsJSON: string(data),
+		PortionSize:     portionSize,
+		Unit:            "g",
+		InstructionText: instruction,
+	}
+}
+
+func rawIngredient(nomenclatureID, name string, quantity float64, unit string) models.RecipeIngredient {
+	return models.RecipeIngredient{
+		NomenclatureID: &nomenclatureID,
+		Nomenclature:   &models.NomenclatureItem{ID: nomenclatureID, Name: name},
+		Quantity:       quantity,
+		Unit:           unit,
+	}
+}
+
+func TestDiffRecipeVersions(t *testing.T) {
+	doughID := "dough"
+	dough := models.RecipeIngredient{IngredientRecipeID: &doughID, Quantity: 250, Unit: "g"}
+
+	// Версия 3 -> 5: сыра стало больше, томаты убрали, добавили базилик; тесто (полуфабрикат) не менялось
+	from := recipeVersion(t, 3, 450, "Выпекать 7 минут",
+		dough,
+		rawIngredient("cheese", "Моцарелла", 120, "g"),
+		rawIngredient("tomato", "Томаты", 80, "g"),
+	)
+	to := recipeVersion(t, 5, 480, "Выпекать 8 минут",
+		dough,
+		rawIngredient("cheese", "Моцарелла", 150, "g"),
+		rawIngredient("basil", "Базилик", 5, "g"),
+	)
+
+	diff, err := diffRecipeVersions(from, to)
+	if err != nil {
+		t.Fatalf("diffRecipeVersions: %v", err)
+	}
+	if diff.RecipeID != "recipe-1" || diff.FromVersion != 3 || diff.ToVersion != 5 {
+		t.Errorf("рецепт %q, версии %d -> %d; want recipe-1, 3 -> 5", diff.RecipeID, diff.FromVersion, diff.ToVersion)
+	}
+	if len(diff.Changed) != 1 {
+		t.Fatalf("измененные ингредиенты %+v, want только сыр", diff.Changed)
+	}
+	if change := diff.Changed[0]; change.Key != "cheese" || change.Name != "Моцарелла" || change.OldQuantity != 120 || change.NewQuantity != 150 {
+		t.Errorf("изменение %+v, want Моцарелла 120 -> 150", change)
+	}
+	if len(diff.Removed) != 1 || *diff.Removed[0].NomenclatureID != "tomato" {
+		t.Errorf("удаленные ингредиенты %+v, want томаты", diff.Removed)
+	}
+	if len(diff.Added) != 1 || *diff.Added[0].NomenclatureID != "basil" {
+		t.Errorf("добавленные ингредиенты %+v, want базилик", diff.Added)
+	}
+	if !diff.PortionSizeChanged || diff.OldPortionSize != 450 || diff.NewPortionSize != 480 {
+		t.Errorf("порция: изменена %v, %v -> %v; want 450 -> 480", diff.PortionSizeChanged, diff.OldPortionSize, diff.NewPortionSize)
+	}
+	if !diff.InstructionChanged || diff.OldInstructionText != "Выпекать 7 минут" || diff.NewInstructionText != "Выпекать 8 минут" {
+		t.Errorf("инструкция: изменена %v, %q -> %q", diff.InstructionChanged, diff.OldInstructionText, diff.NewInstructionText)
+	}
+}
+
+func TestDiffRecipeVersionsUnchanged(t *testing.T) {
+	version := recipeVersion(t, 1, 450, "Выпекать 7 минут", rawIngredient("cheese", "Моцарелла", 120, "g"))
+	next := version
+	next.Version = 2
+
+	diff, err := diffRecipeVersions(version, next)
+	if err != nil {
+		t.Fatalf("diffRecipeVersions: %v", err)
+	}
+	if len(diff.Added)+len(diff.Removed)+len(diff.Changed) != 0 || diff.PortionSizeChanged || diff.InstructionChanged {
+		t.Errorf("одинаковые версии: разница %+v, want пустую", diff)
+	}
+	// Пустые списки сериализуются как [], а не null
+	if diff.Added == nil || diff.Removed == nil || diff.Changed == nil {
+		t.Error("списки разницы должны быть пустыми, а не nil")
+	}
+
+	// Смена единицы без смены количества - тоже изменение
+	next = recipeVersion(t, 2, 450, "Выпекать 7 минут", rawIngredient("cheese", "Моцарелла", 120, "kg"))
+	if diff, _ := diffRecipeVersions(version, next); len(diff.Changed) != 1 || diff.Changed[0].NewUnit != "kg" {
+		t.Errorf("смена единицы: изменения %+v, want g -> kg", diff.Changed)
+	}
+
+	broken := models.RecipeVersion{Version: 3, IngredientsJSON: "{не json"}
+	if _, err := diffRecipeVersions(version, broken); err == nil {
+		t.Error("поврежденный снимок ингредиентов: want ошибку")
+	}
+}
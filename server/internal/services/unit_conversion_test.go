@@ -0,0 +1,66 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"zephyrvpn/server/internal/models"
+)
+
+func TestConvertToBaseUnit(t *testing.T) {
+	service := NewStockService(nil)
+	cases := []struct {
+		name         string
+		quantity     float64
+		fromUnit     string
+		nomenclature models.NomenclatureItem
+		want         float64
+	}{
+		{"та же единица", 5, "g", models.NomenclatureItem{BaseUnit: "g"}, 5},
+		{"кг в г", 1.5, "kg", models.NomenclatureItem{BaseUnit: "g"}, 1500},
+		{"г в кг", 250, "g", models.NomenclatureItem{BaseUnit: "kg"}, 0.25},
+		{"л в мл", 0.5, "l", models.NomenclatureItem{BaseUnit: "ml"}, 500},
+		{"мл в л", 750, "ml", models.NomenclatureItem{BaseUnit: "l"}, 0.75},
+		{"шт в г по весу единицы", 3, "pcs", models.NomenclatureItem{BaseUnit: "g", UnitWeight: 60}, 180},
+		{"коробки в кг по весу единицы", 2, "box", models.NomenclatureItem{BaseUnit: "kg", UnitWeight: 1500}, 3},
+
+		// Единица производства крупнее базовой: 1 коробка = 12 шт
+		{"коробка в шт", 2, "box", models.NomenclatureItem{BaseUnit: "pcs", ProductionUnit: "box", ConversionFactor: 12}, 24},
+		{"коробка в шт, коэффициент записан обратно", 2, "box",
+			models.NomenclatureItem{BaseUnit: "pcs", ProductionUnit: "box", ConversionFactor: 1.0 / 12}, 24},
+		// Единица производства мельче базовой: склад в коробках, рецепт в штуках
+		{"шт в коробки", 6, "pcs", models.NomenclatureItem{BaseUnit: "box", ProductionUnit: "pcs", ConversionFactor: 12}, 0.5},
+		{"шт в коробки, коэффициент записан обратно", 6, "pcs",
+			models.NomenclatureItem{BaseUnit: "box", ProductionUnit: "pcs", ConversionFactor: 1.0 / 12}, 0.5},
+		// Единица закупки: упаковка соуса 5 л, склад в литрах, рецепт в упаковках
+		{"упаковка закупки в базовую", 0.2, "pack", models.NomenclatureItem{BaseUnit: "l", InboundUnit: "pack", ConversionFactor: 5}, 1},
+	}
+	for _, tc := range cases {
+		got, err := service.convertToBaseUnit(tc.quantity, tc.fromUnit, tc.nomenclature)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%s: %v %s = %v %s, want %v", tc.name, tc.quantity, tc.fromUnit, got, tc.nomenclature.BaseUnit, tc.want)
+		}
+	}
+}
+
+func TestConvertToBaseUnitErrors(t *testing.T) {
+	service := NewStockService(nil)
+	cases := []struct {
+		name         string
+		fromUnit     string
+		nomenclature models.NomenclatureItem
+	}{
+		{"шт в г без веса единицы", "pcs", models.NomenclatureItem{Name: "Яйцо", BaseUnit: "g", ConversionFactor: 1}},
+		{"вес в объем", "kg", models.NomenclatureItem{Name: "Молоко", BaseUnit: "l"}},
+		{"единица не из номенклатуры", "box", models.NomenclatureItem{Name: "Соус", BaseUnit: "pcs", ProductionUnit: "pack", ConversionFactor: 6}},
+	}
+	for _, tc := range cases {
+		if got, err := service.convertToBaseUnit(1, tc.fromUnit, tc.nomenclature); err == nil {
+			t.Errorf("%s: %v, want ошибку", tc.name, got)
+		}
+	}
+}
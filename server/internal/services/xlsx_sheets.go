@@ -0,0 +1,171 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// importHeaderKeywords - слова, по которым узнается строка заголовков каталога
+var importHeaderKeywords = []string{"наименование", "товар", "name", "sku", "артикул", "секция", "категория", "category", "единица", "unit", "цена", "price"}
+
+// FileHeaders - результат первого этапа импорта (определение структуры файла)
+type FileHeaders struct {
+	HeaderRowIndex int        `json:"header_row_index"`
+	Columns        []string   `json:"columns"`
+	SampleRows     [][]string `json:"sample_rows"`
+	Sheet          string     `json:"sheet,omitempty"`        // Выбранный лист или именованный диапазон (XLSX)
+	Sheets         []string   `json:"sheets,omitempty"`       // Все листы книги (XLSX)
+	NamedRanges    []string   `json:"named_ranges,omitempty"` // Именованные диапазоны книги (XLSX)
+}
+
+// xlsxNamedRanges возвращает имена диапазонов книги
+func xlsxNamedRanges(f *excelize.File) []string {
+	names := make([]string, 0)
+	for _, dn := range f.GetDefinedName() {
+		// Служебные имена Excel (_xlnm.Print_Area и т.п.) пользователю не показываем
+		if strings.HasPrefix(dn.Name, "_xlnm.") {
+			continue
+		}
+		names = append(names, dn.Name)
+	}
+	return names
+}
+
+// readXLSXRows читает строки листа или именованного диапазона
+// Пустой sheet - первый лист, похожий на каталог (есть строка заголовков), иначе первый непустой лист
+// Возвращает строки и имя выбранного листа/диапазона
+func readXLSXRows(f *excelize.File, sheet string) ([][]string, string, error) {
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, "", fmt.Errorf("файл не содержит листов")
+	}
+
+	sheet = strings.TrimSpace(sheet)
+	if sheet == "" {
+		return pickXLSXSheet(f, sheets)
+	}
+
+	for _, name := range sheets {
+		if strings.EqualFold(name, sheet) {
+			rows, err := f.GetRows(name)
+			if err != nil {
+				return nil, "", fmt.Errorf("ошибка чтения листа '%s': %w", name, err)
+			}
+			return rows, name, nil
+		}
+	}
+
+	for _, dn := range f.GetDefinedName() {
+		if strings.EqualFold(dn.Name, sheet) {
+			rows, err := readXLSXNamedRange(f, dn.RefersTo)
+			if err != nil {
+				return nil, "", fmt.Errorf("ошибка чтения диапазона '%s': %w", dn.Name, err)
+			}
+			return rows, dn.Name, nil
+		}
+	}
+
+	return nil, "", fmt.Errorf("лист или именованный диапазон '%s' не найден (листы: %s)", sheet, strings.Join(sheets, ", "))
+}
+
+// pickXLSXSheet выбирает лист с каталогом: титульные листы поставщиков обычно без строки заголовков
+func pickXLSXSheet(f *excelize.File, sheets []string) ([][]string, string, error) {
+	var firstRows [][]string
+	firstName := ""
+	for _, name := range sheets {
+		rows, err := f.GetRows(name)
+		if err != nil || !hasNonEmptyRow(rows) {
+			continue
+		}
+		if firstName == "" {
+			firstRows, firstName = rows, name
+		}
+		if _, matches := findHeaderRow(rows); matches >= 2 {
+			return rows, name, nil
+		}
+	}
+	if firstName == "" {
+		return nil, "", fmt.Errorf("файл пуст")
+	}
+	return firstRows, firstName, nil
+}
+
+// readXLSXNamedRange читает прямоугольный диапазон вида Лист!$A$1:$D$20
+func readXLSXNamedRange(f *excelize.File, refersTo string) ([][]string, error) {
+	ref := strings.TrimPrefix(strings.TrimSpace(refersTo), "=")
+	sep := strings.LastIndex(ref, "!")
+	if sep < 0 {
+		return nil, fmt.Errorf("неподдерживаемая ссылка диапазона: %s", refersTo)
+	}
+	sheetName := strings.ReplaceAll(strings.Trim(ref[:sep], "'"), "''", "'")
+	cells := strings.Split(strings.ReplaceAll(ref[sep+1:], "$", ""), ":")
+	if len(cells) == 1 {
+		cells = append(cells, cells[0])
+	}
+
+	fromCol, fromRow, err := excelize.CellNameToCoordinates(cells[0])
+	if err != nil {
+		return nil, err
+	}
+	toCol, toRow, err := excelize.CellNameToCoordinates(cells[1])
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := f.GetRows(sheetName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([][]string, 0, toRow-fromRow+1)
+	for r := fromRow; r <= toRow && r <= len(rows); r++ {
+		row := rows[r-1]
+		values := make([]string, 0, toCol-fromCol+1)
+		for c := fromCol; c <= toCol; c++ {
+			if c <= len(row) {
+				values = append(values, row[c-1])
+			} else {
+				values = append(values, "")
+			}
+		}
+		result = append(result, values)
+	}
+	return result, nil
+}
+
+// findHeaderRow ищет строку заголовков среди первых 10 строк: возвращает индекс и число совпадений
+func findHeaderRow(rows [][]string) (int, int) {
+	headerRowIndex := 0
+	maxMatches := 0
+	for i := 0; i < len(rows) && i < 10; i++ {
+		matches := 0
+		for _, cell := range rows[i] {
+			cellLower := strings.ToLower(strings.TrimSpace(cell))
+			for _, keyword := range importHeaderKeywords {
+				if strings.Contains(cellLower, keyword) {
+					matches++
+					break
+				}
+			}
+		}
+		if matches > maxMatches {
+			maxMatches = matches
+			headerRowIndex = i
+		}
+	}
+	return headerRowIndex, maxMatches
+}
+
+// hasNonEmptyRow проверяет, есть ли на листе хотя бы одна заполненная ячейка
+func hasNonEmptyRow(rows [][]string) bool {
+	for _, row := range rows {
+		for _, cell := range row {
+			if strings.TrimSpace(cell) != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
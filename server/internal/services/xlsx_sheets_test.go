@@ -0,0 +1,160 @@
+package services
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// supplierWorkbook - книга поставщика: титульный лист, каталог на втором листе (индекс 1)
+// и акционный прайс на третьем, доступный через именованный диапазон "Акция"
+func supplierWorkbook(t *testing.T) []byte {
+	t.Helper()
+	book := excelize.NewFile()
+	defer book.Close()
+	if err := book.SetSheetName("Sheet1", "Обложка"); err != nil {
+		t.Fatalf("SetSheetName: %v", err)
+	}
+	for _, name := range []string{"Каталог", "Прочее"} {
+		if _, err := book.NewSheet(name); err != nil {
+			t.Fatalf("NewSheet(%s): %v", name, err)
+		}
+	}
+	rows := map[string][][]interface{}{
+		"Обложка": {{"ООО Поставщик"}, {"Прайс-лист на январь"}, {"Телефон: 8-800-000-00-00"}},
+		"Каталог": {
+			{},
+			{"Артикул", "Наименование", "Единица", "Цена"},
+			{"M-1", "Мука пшеничная", "кг", 45},
+			{"S-2", "Сахар", "кг", 70},
+		},
+		"Прочее": {
+			{"Примечание"},
+			{"Артикул", "Наименование", "Цена"},
+			{"C-3", "Сыр моцарелла", 650},
+			{"B-4", "Базилик", 900},
+		},
+	}
+	for sheet, sheetRows := range rows {
+		for i, row := range sheetRows {
+			cell, _ := excelize.CoordinatesToCellName(1, i+1)
+			if err := book.SetSheetRow(sheet, cell, &row); err != nil {
+				t.Fatalf("SetSheetRow(%s): %v", sheet, err)
+			}
+		}
+	}
+	if err := book.SetDefinedName(&excelize.DefinedName{Name: "Акция", RefersTo: "'Прочее'!$A$2:$C$3"}); err != nil {
+		t.Fatalf("SetDefinedName: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := book.Write(&buf); err != nil {
+		t.Fatalf("не удалось записать книгу: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectFileHeadersPicksCatalogSheet(t *testing.T) {
+	service := NewNomenclatureService(nil)
+	data := supplierWorkbook(t)
+
+	detected, err := service.DetectFileHeaders(bytes.NewReader(data), "price.xlsx", "")
+	if err != nil {
+		t.Fatalf("DetectFileHeaders: %v", err)
+	}
+	if detected.Sheet != "Каталог" || detected.HeaderRowIndex != 1 {
+		t.Errorf("лист %q, строка заголовков %d; want Каталог, 1", detected.Sheet, detected.HeaderRowIndex)
+	}
+	if want := []string{"Артикул", "Наименование", "Единица", "Цена"}; !reflect.DeepEqual(detected.Columns, want) {
+		t.Errorf("колонки %v, want %v", detected.Columns, want)
+	}
+	if want := []string{"Обложка", "Каталог", "Прочее"}; !reflect.DeepEqual(detected.Sheets, want) {
+		t.Errorf("листы %v, want %v", detected.Sheets, want)
+	}
+	if want := []string{"Акция"}; !reflect.DeepEqual(detected.NamedRanges, want) {
+		t.Errorf("именованные диапазоны %v, want %v", detected.NamedRanges, want)
+	}
+
+	// Явный выбор листа (без учета регистра) и именованного диапазона
+	cases := []struct {
+		sheet, wantSheet string
+		wantFirstColumn  string
+	}{
+		{"обложка", "Обложка", "ООО Поставщик"},
+		{"Прочее", "Прочее", "Артикул"},
+		{"акция", "Акция", "Артикул"},
+	}
+	for _, tc := range cases {
+		detected, err := service.DetectFileHeaders(bytes.NewReader(data), "price.xlsx", tc.sheet)
+		if err != nil {
+			t.Fatalf("DetectFileHeaders(%q): %v", tc.sheet, err)
+		}
+		if detected.Sheet != tc.wantSheet || len(detected.Columns) == 0 || detected.Columns[0] != tc.wantFirstColumn {
+			t.Errorf("DetectFileHeaders(%q): лист %q, колонки %v; want %q, первая колонка %q",
+				tc.sheet, detected.Sheet, detected.Columns, tc.wantSheet, tc.wantFirstColumn)
+		}
+	}
+
+	if _, err := service.DetectFileHeaders(bytes.NewReader(data), "price.xlsx", "Склад"); err == nil {
+		t.Error("несуществующий лист: want ошибку")
+	}
+}
+
+func TestParseUploadedFileReadsSecondSheet(t *testing.T) {
+	service := NewNomenclatureService(nil)
+	data := supplierWorkbook(t)
+
+	rows, err := service.ParseUploadedFile(bytes.NewReader(data), "price.xlsx", "")
+	if err != nil {
+		t.Fatalf("ParseUploadedFile: %v", err)
+	}
+	if len(rows) != 2 || rows[0]["Наименование"] != "Мука пшеничная" || rows[1]["Артикул"] != "S-2" {
+		t.Errorf("строки %v, want мука и сахар со второго листа", rows)
+	}
+
+	// Именованный диапазон: без строки примечания и за пределами диапазона ничего не читается
+	rows, err = service.ParseUploadedFile(bytes.NewReader(data), "price.xlsx", "Акция")
+	if err != nil {
+		t.Fatalf("ParseUploadedFile(Акция): %v", err)
+	}
+	if len(rows) != 1 || rows[0]["Наименование"] != "Сыр моцарелла" {
+		t.Errorf("строки диапазона %v, want только сыр", rows)
+	}
+
+	mapped, err := service.ParseFileWithMapping(bytes.NewReader(data), "price.xlsx",
+		map[string]string{"name": "Наименование", "sku": "Артикул"}, nil, -1, "Прочее")
+	if err != nil {
+		t.Fatalf("ParseFileWithMapping(Прочее): %v", err)
+	}
+	if len(mapped) != 2 || mapped[0]["name"] != "Сыр моцарелла" || mapped[1]["sku"] != "B-4" {
+		t.Errorf("строки с маппингом %v, want сыр и базилик с листа Прочее", mapped)
+	}
+}
+
+// Если ни один лист не похож на каталог, берется первый непустой
+func TestReadXLSXRowsFallsBackToFirstNonEmptySheet(t *testing.T) {
+	book := excelize.NewFile()
+	defer book.Close()
+	if _, err := book.NewSheet("Данные"); err != nil {
+		t.Fatalf("NewSheet: %v", err)
+	}
+	if err := book.SetSheetRow("Данные", "A1", &[]interface{}{"Мука", 45}); err != nil {
+		t.Fatalf("SetSheetRow: %v", err)
+	}
+
+	rows, selected, err := readXLSXRows(book, "")
+	if err != nil {
+		t.Fatalf("readXLSXRows: %v", err)
+	}
+	if selected != "Данные" || len(rows) != 1 || rows[0][0] != "Мука" {
+		t.Errorf("лист %q, строки %v; want Данные с одной строкой", selected, rows)
+	}
+
+	empty := excelize.NewFile()
+	defer empty.Close()
+	if _, _, err := readXLSXRows(empty, ""); err == nil {
+		t.Error("книга без данных: want ошибку")
+	}
+}
@@ -0,0 +1,95 @@
+// Package rediskeys - единое место для форматов ключей Redis и их TTL
+// Форматы ключей должны совпадать с уже записанными в Redis данными: менять их можно только вместе с миграцией
+package rediskeys
+
+// Глобальные настройки слотов
+const (
+	SlotConfigMaxCapacityKey = "slot:config:max_capacity"        // Общая емкость слота (руб.)
+	SlotConfigOverbookingKey = "slot:config:overbooking_percent" // Допустимый овербукинг (%)
+)
+
+// Наборы, списки и счетчики заказов ERP
+const (
+	OrdersActiveKey       = "erp:orders:active"        // Множество ID заказов на планшете кухни
+	OrdersPendingSlotsKey = "erp:orders:pending_slots" // Множество ID заказов, ждущих времени показа своего слота
+	OrdersArchiveKey      = "erp:orders:archive"       // Список ID обработанных заказов
+	OrdersPendingKey      = "erp:orders:pending"       // Счетчик необработанных заказов
+	OrdersProcessedKey    = "erp:orders:processed"     // Счетчик обработанных заказов
+	OrdersTotalKey        = "erp:orders:total"         // Счетчик всех принятых заказов
+	OrdersQueueKey        = "erp:orders:list"          // Очередь заказов для кухонных воркеров
+)
+
+// OrderKey - JSON заказа для ERP (erp:order:{id})
+func OrderKey(orderID string) string {
+	return "erp:order:" + orderID
+}
+
+// OrderStationsKey - назначения заказа на станции (erp:order:{id}:stations)
+func OrderStationsKey(orderID string) string {
+	return OrderKey(orderID) + ":stations"
+}
+
+// LegacyOrderKey - JSON заказа в старом формате (order:{id}), читается кухонными воркерами
+func LegacyOrderKey(orderID string) string {
+	return "order:" + orderID
+}
+
+// OrderListKey - отметка заказа в списке заказов (orders:list:{id})
+func OrderListKey(orderID string) string {
+	return "orders:list:" + orderID
+}
+
+// OrderSlotKey - связь заказ -> слот, hash {slot_id, price} (order:slot:{id})
+func OrderSlotKey(orderID string) string {
+	return "order:slot:" + orderID
+}
+
+// OrderSlotStartKey - время начала слота заказа в RFC3339 (order:slot:start:{id})
+func OrderSlotStartKey(orderID string) string {
+	return "order:slot:start:" + orderID
+}
+
+// OrderVisibleAtKey - время появления заказа на кухне в RFC3339 (order:visible_at:{id})
+func OrderVisibleAtKey(orderID string) string {
+	return "order:visible_at:" + orderID
+}
+
+// SlotKey - загрузка слота в рублях
+// slotID уже содержит префикс (slot:{unix}), поэтому ключ имеет вид slot:slot:{unix}
+func SlotKey(slotID string) string {
+	return "slot:" + slotID
+}
+
+// SlotInfoKey - hash с параметрами слота {start_time, end_time, max_capacity}
+func SlotInfoKey(slotID string) string {
+	return SlotKey(slotID) + ":info"
+}
+
+// SlotOrdersKey - множество ID заказов слота
+func SlotOrdersKey(slotID string) string {
+	return SlotKey(slotID) + ":orders"
+}
+
+// SlotDisabledKey - флаг отключенного слота
+func SlotDisabledKey(slotID string) string {
+	return SlotKey(slotID) + ":disabled"
+}
+
+// SlotMaxCapacityKey - индивидуальная емкость слота
+func SlotMaxCapacityKey(slotID string) string {
+	return SlotKey(slotID) + ":max_capacity"
+}
+
+// MenuAvailabilityKey - кэш доступности меню по остаткам филиала (menu:availability:{branch_id})
+func MenuAvailabilityKey(branchID string) string {
+	return "menu:availability:" + branchID
+}
+
+// Перезагрузка меню несколькими инстансами сервера
+const (
+	MenuReloadLockKey = "menu:reload:lock" // Аренда перезагрузки меню из БД (SET NX, значение - токен держателя)
+	MenuSnapshotKey   = "menu:snapshot"    // Меню, прочитанное держателем аренды, для остальных инстансов
+)
+
+// OrderStateRebuildLockKey - аренда пересборки состояния заказов из PostgreSQL (SET NX, значение - токен держателя)
+const OrderStateRebuildLockKey = "erp:state:rebuild:lock"
@@ -0,0 +1,61 @@
+package rediskeys
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyFormats(t *testing.T) {
+	// Форматы совпадают с уже записанными в Redis данными
+	cases := []struct {
+		got, want string
+	}{
+		{OrderKey("x"), "erp:order:x"},
+		{OrderStationsKey("x"), "erp:order:x:stations"},
+		{LegacyOrderKey("x"), "order:x"},
+		{OrderListKey("x"), "orders:list:x"},
+		{OrderSlotKey("x"), "order:slot:x"},
+		{OrderSlotStartKey("x"), "order:slot:start:x"},
+		{OrderVisibleAtKey("x"), "order:visible_at:x"},
+		{SlotKey("slot:1"), "slot:slot:1"},
+		{SlotInfoKey("slot:1"), "slot:slot:1:info"},
+		{SlotOrdersKey("slot:1"), "slot:slot:1:orders"},
+		{SlotDisabledKey("slot:1"), "slot:slot:1:disabled"},
+		{SlotMaxCapacityKey("slot:1"), "slot:slot:1:max_capacity"},
+		{MenuAvailabilityKey("b1"), "menu:availability:b1"},
+		{OrdersActiveKey, "erp:orders:active"},
+		{OrdersPendingSlotsKey, "erp:orders:pending_slots"},
+		{OrdersArchiveKey, "erp:orders:archive"},
+		{OrdersPendingKey, "erp:orders:pending"},
+		{OrdersProcessedKey, "erp:orders:processed"},
+		{OrdersTotalKey, "erp:orders:total"},
+		{OrdersQueueKey, "erp:orders:list"},
+	}
+	for _, tc := range cases {
+		if tc.got != tc.want {
+			t.Errorf("ключ %q, want %q", tc.got, tc.want)
+		}
+	}
+}
+
+func TestSetTTLsZeroFallsBackToDefaults(t *testing.T) {
+	t.Cleanup(func() { SetTTLs(DefaultTTLs()) })
+	defaults := DefaultTTLs()
+
+	SetTTLs(TTLs{})
+	if OrderTTL() != defaults.Order || SlotHistoryTTL() != defaults.SlotHistory || SlotMetaTTL() != defaults.SlotMeta {
+		t.Errorf("нулевые TTL: %v/%v/%v, want значения по умолчанию %+v", OrderTTL(), SlotHistoryTTL(), SlotMetaTTL(), defaults)
+	}
+
+	// Заданные значения применяются, отрицательные и нулевые заменяются по отдельности
+	SetTTLs(TTLs{Order: time.Hour, SlotHistory: -time.Minute, SlotMeta: 30 * time.Minute})
+	if OrderTTL() != time.Hour {
+		t.Errorf("OrderTTL() = %v, want 1h", OrderTTL())
+	}
+	if SlotHistoryTTL() != defaults.SlotHistory {
+		t.Errorf("SlotHistoryTTL() = %v, want %v", SlotHistoryTTL(), defaults.SlotHistory)
+	}
+	if SlotMetaTTL() != 30*time.Minute {
+		t.Errorf("SlotMetaTTL() = %v, want 30m", SlotMetaTTL())
+	}
+}
@@ -0,0 +1,66 @@
+package rediskeys
+
+import (
+	"sync"
+	"time"
+)
+
+// TTLs - время жизни ключей Redis
+type TTLs struct {
+	Order       time.Duration // Заказ и его служебные ключи (erp:order, order:slot:start, order:visible_at)
+	SlotHistory time.Duration // Загрузка слота, его заказы и связь заказ -> слот (история прошедших слотов)
+	SlotMeta    time.Duration // Отключение слота и кэш параметров слота
+}
+
+// DefaultTTLs - значения, которые использовались до выноса TTL в конфиг
+func DefaultTTLs() TTLs {
+	return TTLs{
+		Order:       24 * time.Hour,
+		SlotHistory: 2 * time.Hour,
+		SlotMeta:    24 * time.Hour,
+	}
+}
+
+var (
+	ttlMu sync.RWMutex
+	ttls  = DefaultTTLs()
+)
+
+// SetTTLs задает TTL ключей (вызывается один раз при старте); нулевые значения заменяются значениями по умолчанию
+func SetTTLs(t TTLs) {
+	defaults := DefaultTTLs()
+	if t.Order <= 0 {
+		t.Order = defaults.Order
+	}
+	if t.SlotHistory <= 0 {
+		t.SlotHistory = defaults.SlotHistory
+	}
+	if t.SlotMeta <= 0 {
+		t.SlotMeta = defaults.SlotMeta
+	}
+
+	ttlMu.Lock()
+	defer ttlMu.Unlock()
+	ttls = t
+}
+
+// OrderTTL - время жизни заказа в Redis
+func OrderTTL() time.Duration {
+	ttlMu.RLock()
+	defer ttlMu.RUnlock()
+	return ttls.Order
+}
+
+// SlotHistoryTTL - время жизни загрузки слота и связей заказ -> слот
+func SlotHistoryTTL() time.Duration {
+	ttlMu.RLock()
+	defer ttlMu.RUnlock()
+	return ttls.SlotHistory
+}
+
+// SlotMetaTTL - время жизни флагов и кэша параметров слота
+func SlotMetaTTL() time.Duration {
+	ttlMu.RLock()
+	defer ttlMu.RUnlock()
+	return ttls.SlotMeta
+}
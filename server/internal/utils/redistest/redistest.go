@@ -0,0 +1,39 @@
+// Package redistest - подключение к тестовому Redis для интеграционных тестов пакетов сервера
+package redistest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"zephyrvpn/server/internal/utils"
+)
+
+// New подключается к Redis из TEST_REDIS_URL (например redis://localhost:6379/15)
+// База очищается до и после теста, поэтому указывайте отдельную базу. Без TEST_REDIS_URL тест пропускается
+func New(t testing.TB) *utils.RedisClient {
+	t.Helper()
+	redisURL := os.Getenv("TEST_REDIS_URL")
+	if redisURL == "" {
+		t.Skip("TEST_REDIS_URL не задан: интеграционный тест Redis пропущен")
+	}
+	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		t.Fatalf("некорректный TEST_REDIS_URL: %v", err)
+	}
+	client := redis.NewClient(opt)
+	redisUtil := utils.NewRedisClient(client)
+	if err := client.Ping(redisUtil.Context()).Err(); err != nil {
+		client.Close()
+		t.Skipf("Redis из TEST_REDIS_URL недоступен: %v", err)
+	}
+	if err := client.FlushDB(redisUtil.Context()).Err(); err != nil {
+		client.Close()
+		t.Fatalf("не удалось очистить тестовую базу Redis: %v", err)
+	}
+	t.Cleanup(func() {
+		client.FlushDB(redisUtil.Context())
+		client.Close()
+	})
+	return redisUtil
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader - заголовок для сквозного ID запроса (HTTP, Kafka, gRPC metadata в нижнем регистре)
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// NewRequestID генерирует новый ID запроса
+func NewRequestID() string {
+	return uuid.New().String()
+}
+
+// WithRequestID сохраняет ID запроса в context
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext возвращает ID запроса из context (пустая строка, если не задан)
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
@@ -0,0 +1,83 @@
+// Package timefmt - единый формат времени в API
+//
+// Контракт:
+//   - моменты времени (created_at, start_time, timestamp...) отдаются в RFC3339 в UTC: "2026-01-15T09:30:00Z"
+//   - календарные даты (дата накладной, бизнес-день, границы отчета) отдаются как YYYY-MM-DD
+//   - фильтры по датам принимают и YYYY-MM-DD, и RFC3339 с любым смещением ("2026-01-15T16:30:00+07:00")
+//
+// Дата без времени означает начало суток в UTC (или в часовом поясе, переданном в ParseInLocation).
+// Время с явным смещением приводится к UTC и от часового пояса сервера не зависит
+package timefmt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DateLayout - календарная дата без времени
+const DateLayout = "2006-01-02"
+
+// Accepted - подсказка для сообщений об ошибке формата
+const Accepted = "YYYY-MM-DD или RFC3339 (2006-01-02T15:04:05Z07:00)"
+
+// Format возвращает момент времени в RFC3339 в UTC
+func Format(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// FormatPtr - Format для необязательного времени (nil и нулевое время -> nil)
+func FormatPtr(t *time.Time) *string {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	formatted := Format(*t)
+	return &formatted
+}
+
+// FormatDate возвращает календарную дату (YYYY-MM-DD) без перевода в UTC:
+// дата накладной или бизнес-дня остается той, что ввели
+func FormatDate(t time.Time) string {
+	return t.Format(DateLayout)
+}
+
+// IsDateOnly сообщает, что значение - дата без времени (YYYY-MM-DD)
+// Такую границу "до" нужно включать целиком: до начала следующих суток
+func IsDateOnly(value string) bool {
+	_, err := time.Parse(DateLayout, strings.TrimSpace(value))
+	return err == nil
+}
+
+// Parse разбирает дату (YYYY-MM-DD, начало суток в UTC) или момент времени в RFC3339 (приводится к UTC)
+func Parse(value string) (time.Time, error) {
+	return ParseInLocation(value, time.UTC)
+}
+
+// ParseInLocation - Parse, где дата без времени означает начало суток в loc
+// RFC3339 содержит смещение и от loc не зависит; результат для него - в UTC
+func ParseInLocation(value string, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if loc == nil {
+		loc = time.UTC
+	}
+	if t, err := time.ParseInLocation(DateLayout, value, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("неверный формат времени '%s', ожидается %s", value, Accepted)
+}
+
+// RangeEnd разбирает правую границу периода: для даты без времени возвращает начало следующих суток
+// (граница не включается, весь день попадает в период), для RFC3339 - сам момент
+func RangeEnd(value string, loc *time.Location) (time.Time, error) {
+	t, err := ParseInLocation(value, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if IsDateOnly(value) {
+		return t.AddDate(0, 0, 1), nil
+	}
+	return t, nil
+}
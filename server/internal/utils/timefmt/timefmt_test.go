@@ -0,0 +1,88 @@
+package timefmt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAcceptsDateAndRFC3339(t *testing.T) {
+	cases := []struct {
+		input string
+		want  time.Time
+	}{
+		{"2026-01-15", time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{" 2026-01-15 ", time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{"2026-01-15T09:30:00Z", time.Date(2026, 1, 15, 9, 30, 0, 0, time.UTC)},
+		{"2026-01-15T16:30:00+07:00", time.Date(2026, 1, 15, 9, 30, 0, 0, time.UTC)},
+		{"2026-01-15T09:30:00.123456789Z", time.Date(2026, 1, 15, 9, 30, 0, 123456789, time.UTC)},
+	}
+	for _, tc := range cases {
+		got, err := Parse(tc.input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tc.input, err)
+			continue
+		}
+		if !got.Equal(tc.want) || got.Location() != time.UTC {
+			t.Errorf("Parse(%q) = %v, want %v в UTC", tc.input, got, tc.want)
+		}
+	}
+
+	for _, input := range []string{"", "15.01.2026", "2026-01-15 09:30", "2026-13-01"} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q): ожидалась ошибка формата", input)
+		}
+	}
+}
+
+func TestParseInLocationDateOnly(t *testing.T) {
+	krasnoyarsk := time.FixedZone("KRAT", 7*3600)
+	got, err := ParseInLocation("2026-01-15", krasnoyarsk)
+	if err != nil {
+		t.Fatalf("ParseInLocation: %v", err)
+	}
+	if want := time.Date(2026, 1, 14, 17, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("ParseInLocation = %v, want полночь по Красноярску (%v)", got, want)
+	}
+	// Смещение в RFC3339 важнее loc
+	got, err = ParseInLocation("2026-01-15T09:30:00Z", krasnoyarsk)
+	if err != nil || !got.Equal(time.Date(2026, 1, 15, 9, 30, 0, 0, time.UTC)) {
+		t.Errorf("ParseInLocation(RFC3339) = %v, %v", got, err)
+	}
+}
+
+func TestRangeEnd(t *testing.T) {
+	end, err := RangeEnd("2026-01-15", time.UTC)
+	if err != nil || !end.Equal(time.Date(2026, 1, 16, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("RangeEnd(дата) = %v, %v, want начало 16 января", end, err)
+	}
+	end, err = RangeEnd("2026-01-15T12:00:00Z", time.UTC)
+	if err != nil || !end.Equal(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("RangeEnd(RFC3339) = %v, %v, want сам момент", end, err)
+	}
+}
+
+// Один и тот же момент из разных часовых поясов выводится одинаково
+func TestFormatIsUTCRFC3339(t *testing.T) {
+	moment := time.Date(2026, 1, 15, 9, 30, 0, 0, time.UTC)
+	for _, loc := range []*time.Location{time.UTC, time.FixedZone("KRAT", 7*3600), time.FixedZone("EST", -5*3600)} {
+		if got := Format(moment.In(loc)); got != "2026-01-15T09:30:00Z" {
+			t.Errorf("Format(%s) = %q, want 2026-01-15T09:30:00Z", loc, got)
+		}
+	}
+	if got := Format(time.Unix(0, moment.UnixNano())); got != "2026-01-15T09:30:00Z" {
+		t.Errorf("Format(Unix nanos) = %q, want 2026-01-15T09:30:00Z", got)
+	}
+
+	// Вывод разбирается обратно в тот же момент
+	parsed, err := Parse(Format(moment))
+	if err != nil || !parsed.Equal(moment) {
+		t.Errorf("Parse(Format) = %v, %v, want %v", parsed, err, moment)
+	}
+
+	if FormatPtr(nil) != nil || FormatPtr(&time.Time{}) != nil {
+		t.Error("FormatPtr(nil/нулевое время) должен вернуть nil")
+	}
+	if got := FormatDate(time.Date(2026, 1, 15, 23, 0, 0, 0, time.FixedZone("KRAT", 7*3600))); got != "2026-01-15" {
+		t.Errorf("FormatDate = %q, want дату без перевода в UTC", got)
+	}
+}
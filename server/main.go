@@ -15,14 +15,20 @@ import (
 	"google.golang.org/grpc"
 
 	"zephyrvpn/server/internal/api"
+	"zephyrvpn/server/internal/api/swagger"
 	"zephyrvpn/server/internal/config"
 	"zephyrvpn/server/internal/database"
 	"zephyrvpn/server/internal/models"
 	"zephyrvpn/server/internal/pb"
 	"zephyrvpn/server/internal/services"
 	"zephyrvpn/server/internal/utils"
+	"zephyrvpn/server/internal/utils/rediskeys"
 )
 
+// @title        ERP Server API
+// @version      1.0
+// @description  REST API ERP пиццерии: заказы, слоты, склад, номенклатура, закупки и финансы
+// @BasePath     /api/v1
 func main() {
 	// Загружаем переменные окружения из .env файла (если существует)
 	// Игнорируем ошибку, если файл не найден (для production окружений)
@@ -84,6 +90,15 @@ func main() {
 		cfg.RedisURL,
 		cfg.RedisSentinelAddrs,
 		cfg.RedisMasterName,
+		database.RedisPoolConfig{
+			PoolSize:     cfg.RedisPoolSize,
+			MinIdleConns: cfg.RedisMinIdleConns,
+			MaxRetries:   cfg.RedisMaxRetries,
+			DialTimeout:  time.Duration(cfg.RedisDialTimeoutMs) * time.Millisecond,
+			ReadTimeout:  time.Duration(cfg.RedisReadTimeoutMs) * time.Millisecond,
+			WriteTimeout: time.Duration(cfg.RedisWriteTimeoutMs) * time.Millisecond,
+			PoolTimeout:  time.Duration(cfg.RedisPoolTimeoutMs) * time.Millisecond,
+		},
 	)
 	var redisUtil *utils.RedisClient
 	if err != nil {
@@ -95,6 +110,19 @@ func main() {
 	}
 	defer database.CloseRedis(redisClient)
 
+	// TTL ключей Redis (заказы, слоты) - задаются до запуска сервисов, которые пишут в Redis
+	rediskeys.SetTTLs(rediskeys.TTLs{
+		Order:       time.Duration(cfg.RedisOrderTTLHours) * time.Hour,
+		SlotHistory: time.Duration(cfg.RedisSlotHistoryTTLMinutes) * time.Minute,
+		SlotMeta:    time.Duration(cfg.RedisSlotMetaTTLHours) * time.Hour,
+	})
+
+	// Время приготовления по умолчанию для оценки срока готовности заказа (KDS)
+	models.SetDefaultPrepSeconds(cfg.PrepDefaultSeconds)
+
+	// Скидка больше суммы заказа: уменьшать до суммы (clamp) или отклонять заказ (reject)
+	models.SetDiscountPolicy(cfg.OrderDiscountPolicy)
+
 	// Инициализация сервиса меню и загрузка из БД
 	var menuService *services.MenuService
 	if db != nil {
@@ -119,6 +147,8 @@ func main() {
 	var pluService *services.PLUService
 	if db != nil {
 		nomenclatureService = services.NewNomenclatureService(db)
+		nomenclatureService.SetDuplicateNameThreshold(cfg.ImportDuplicateNameThreshold)
+		nomenclatureService.SetMaxUploadSize(int64(cfg.ImportMaxUploadMB) << 20)
 		
 		// Инициализация сервиса PLU
 		pluService = services.NewPLUService(db)
@@ -158,15 +188,31 @@ func main() {
 	var financeService *services.FinanceService
 	if db != nil {
 		financeService = services.NewFinanceService(db)
+		financeService.SetVATRate(cfg.FinanceVATRate)
 		log.Println("✅ Finance service initialized")
 	} else {
 		log.Println("⚠️ Finance service not started: PostgreSQL not available")
 	}
 
+	// Инициализация сервиса валют (курсы для накладных в иностранной валюте)
+	var currencyService *services.CurrencyService
+	if db != nil {
+		currencyService = services.NewCurrencyService(db)
+		log.Println("✅ Currency service initialized")
+	} else {
+		log.Println("⚠️ Currency service not started: PostgreSQL not available")
+	}
+
 	// Инициализация сервиса филиалов
 	var branchService *services.BranchService
 	if db != nil {
 		branchService = services.NewBranchService(db)
+		branchService.SetDefaultBranchID(cfg.DefaultBranchID)
+		if cfg.DefaultBranchID != "" {
+			if _, err := branchService.ResolveBranchID(cfg.DefaultBranchID); err != nil {
+				log.Printf("⚠️ DEFAULT_BRANCH_ID: %v", err)
+			}
+		}
 		log.Println("✅ Branch service initialized")
 	} else {
 		log.Println("⚠️ Branch service not started: PostgreSQL not available")
@@ -187,8 +233,58 @@ func main() {
 			stockService.SetFinanceService(financeService)
 			log.Println("✅ Stock service linked with Finance service")
 		}
+		if currencyService != nil {
+			stockService.SetCurrencyService(currencyService)
+			log.Println("✅ Stock service linked with Currency service")
+		}
+		
+		stockService.SetMaxRecipeDepth(cfg.RecipeMaxDepth)
+		stockService.SetQuantityDecimals(cfg.StockQuantityDecimals)
+		stockService.SetMarkdownCurve(services.MarkdownCurve{
+			MaxPercent:  cfg.MarkdownMaxPercent,
+			Exponent:    cfg.MarkdownCurveExponent,
+			StepPercent: cfg.MarkdownStepPercent,
+		})
+		if menuService != nil {
+			menuService.SetStockService(stockService)
+		}
 		
-		// Запускаем периодическую проверку сроков годности (каждые 5 минут)
+		// Рост закупочной цены относительно скользящего среднего уходит в ERP WebSocket (price_change_alert)
+		stockService.SetPriceAlert(cfg.PriceAlertThresholdPercent, func(alerts []services.PriceChangeAlert) {
+			api.BroadcastERPUpdate("price_change_alert", map[string]interface{}{
+				"items": alerts,
+				"count": len(alerts),
+			})
+		})
+		
+		// Критические алерты склада дублируются менеджерам во внешние каналы (webhook, Telegram)
+		notificationService := services.NewNotificationService(redisUtil, time.Duration(cfg.NotifyDedupWindowMinutes)*time.Minute)
+		if cfg.NotifyWebhookURL != "" {
+			notificationService.AddSink(services.NewWebhookSink(cfg.NotifyWebhookURL))
+		}
+		if cfg.NotifyTelegramBotToken != "" && cfg.NotifyTelegramChatID != "" {
+			notificationService.AddSink(services.NewTelegramSink(cfg.NotifyTelegramBotToken, cfg.NotifyTelegramChatID))
+		}
+		if notificationService.HasSinks() {
+			stockService.SetNotificationService(notificationService)
+		} else {
+			log.Println("⚠️ Внешние уведомления отключены: NOTIFY_WEBHOOK_URL и NOTIFY_TELEGRAM_* не заданы")
+		}
+		
+		// Уведомления о низких остатках уходят в ERP WebSocket (low_stock_alert) и во внешние каналы
+		lowStockMonitor := services.NewLowStockMonitor(stockService, redisUtil,
+			time.Duration(cfg.LowStockAlertWindowMinutes)*time.Minute,
+			func(alerts []services.LowStockAlert) {
+				api.BroadcastERPUpdate("low_stock_alert", map[string]interface{}{
+					"items": alerts,
+					"count": len(alerts),
+				})
+				for _, alert := range alerts {
+					notificationService.Notify(services.LowStockNotification(alert))
+				}
+			})
+		
+		// Запускаем периодическую проверку сроков годности и низких остатков (каждые 5 минут)
 		go func() {
 			ticker := time.NewTicker(5 * time.Minute)
 			defer ticker.Stop()
@@ -196,9 +292,30 @@ func main() {
 				if err := stockService.CheckAndCreateExpiryAlerts(); err != nil {
 					log.Printf("⚠️ Ошибка проверки сроков годности: %v", err)
 				}
+				if _, err := lowStockMonitor.Check(); err != nil {
+					log.Printf("⚠️ Ошибка проверки низких остатков: %v", err)
+				}
 			}
 		}()
-		log.Println("⏰ Автоматическая проверка сроков годности запущена (каждые 5 минут)")
+		log.Println("⏰ Автоматическая проверка сроков годности и низких остатков запущена (каждые 5 минут)")
+		
+		// Ежедневный снимок стоимости склада в момент закрытия (BUSINESS_CLOSE_HOUR:BUSINESS_CLOSE_MIN UTC)
+		go func() {
+			for {
+				now := time.Now().UTC()
+				next := time.Date(now.Year(), now.Month(), now.Day(), cfg.BusinessCloseHour, cfg.BusinessCloseMin, 0, 0, time.UTC)
+				if !next.After(now) {
+					next = next.AddDate(0, 0, 1)
+				}
+				time.Sleep(time.Until(next))
+				
+				log.Println("📸 Запуск ежедневного снимка стоимости склада...")
+				if err := stockService.TakeValuationSnapshots(); err != nil {
+					log.Printf("⚠️ Ошибка снимка стоимости склада: %v", err)
+				}
+			}
+		}()
+		log.Printf("📸 Ежедневный снимок стоимости склада запланирован на %02d:%02d UTC", cfg.BusinessCloseHour, cfg.BusinessCloseMin)
 	} else {
 		log.Println("⚠️ Stock service not started: PostgreSQL not available")
 	}
@@ -232,6 +349,7 @@ func main() {
 	var purchaseOrderService *services.PurchaseOrderService
 	if db != nil && stockService != nil {
 		purchaseOrderService = services.NewPurchaseOrderService(db, stockService)
+		purchaseOrderService.SetApprovalThreshold(cfg.PurchaseOrderApprovalThreshold)
 		log.Println("✅ Purchase Order service initialized")
 	} else {
 		log.Println("⚠️ Purchase Order service not started: PostgreSQL or Stock service not available")
@@ -279,6 +397,18 @@ func main() {
 		})
 	})
 
+	// Пул соединений Redis: настройки и счетчики PoolStats (подбор размера пула, поиск утечек соединений)
+	r.GET("/api/v1/health/redis-pool", func(c *gin.Context) {
+		if redisClient == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Redis not available"})
+			return
+		}
+		c.JSON(http.StatusOK, database.GetRedisPoolStatus(redisClient))
+	})
+
+	// X-Request-ID: сквозной ID запроса для логов, Kafka и WebSocket
+	r.Use(api.RequestIDMiddleware())
+
 	// Логирование всех запросов
 	r.Use(func(c *gin.Context) {
 		start := time.Now()
@@ -289,30 +419,38 @@ func main() {
 		
 		latency := time.Since(start)
 		status := c.Writer.Status()
-		log.Printf("🌐 %s %s - Status: %d - Latency: %v", method, path, status, latency)
+		log.Printf("🌐 [req=%s] %s %s - Status: %d - Latency: %v", api.GetRequestID(c), method, path, status, latency)
 	})
 
-	// CORS для фронтенда
-	r.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
-			return
-		}
-		
-		c.Next()
-	})
+	// CORS для фронтенда: только origin из CORS_ALLOWED_ORIGINS ("*" - любой, для локальной разработки)
+	if len(cfg.CORSAllowedOrigins) == 0 {
+		log.Println("⚠️ CORS_ALLOWED_ORIGINS не задан: кросс-доменные запросы из браузера будут отклонены")
+	}
+	r.Use(api.CORSMiddleware(cfg.CORSAllowedOrigins))
 
 	// API routes
 	apiGroup := r.Group("/api/v1")
+	// Rate limiting: щедрый лимит на чтение для всех API, строгий - на создание заказов
+	apiGroup.Use(api.RateLimitMiddleware(redisUtil, api.RateLimitRule{
+		Scope:         "read",
+		RatePerSecond: cfg.RateLimitReadRPS,
+		Burst:         cfg.RateLimitReadBurst,
+		ReadOnly:      true,
+	}))
+	createOrderLimiter := api.RateLimitMiddleware(redisUtil, api.RateLimitRule{
+		Scope:         "create_order",
+		RatePerSecond: cfg.RateLimitCreateOrderRPS,
+		Burst:         cfg.RateLimitCreateOrderBurst,
+	})
+
+	// OpenAPI документация: /api/v1/swagger/index.html (UI), /api/v1/swagger/doc.json (спецификация)
+	apiGroup.GET("/swagger/*any", swagger.Handler)
 	
 	// Авторизация (доступна без БД для тестирования, но лучше с БД)
 	var authController *api.AuthController
 	if db != nil {
 		authController = api.NewAuthController(db)
+		authController.SetRedisClient(redisUtil)
 		authGroup := apiGroup.Group("/auth")
 		{
 			authGroup.POST("/super-admin/login", authController.SuperAdminLogin)
@@ -331,7 +469,15 @@ func main() {
 		orderController = api.NewOrderController(redisUtil, nil, db, cfg.BusinessOpenHour, cfg.BusinessOpenMin, cfg.BusinessCloseHour, cfg.BusinessCloseMin)
 		log.Println("⚠️ OrderController создан без StockService: проверка остатков отключена")
 	}
-	erpController := api.NewERPController(redisUtil, cfg.KafkaBrokers, db, cfg.BusinessOpenHour, cfg.BusinessOpenMin, cfg.BusinessCloseHour, cfg.BusinessCloseMin)
+	orderController.SetBranchService(branchService) // Проверка branch_id заказа и филиал по умолчанию
+	erpController := api.NewERPController(redisUtil, cfg.KafkaBrokers, cfg.KafkaOrdersTopic, db, cfg.BusinessOpenHour, cfg.BusinessOpenMin, cfg.BusinessCloseHour, cfg.BusinessCloseMin)
+	if stockService != nil {
+		erpController.SetStockService(stockService) // Списания по заказу в трассировке, списание и снятие резерва ингредиентов
+	}
+	if db != nil && redisUtil != nil {
+		// Итоги прошедших слотов - в slot_history до истечения счетчиков в Redis
+		erpController.SlotService().StartSlotArchiver(time.Duration(cfg.SlotArchiveIntervalMinutes) * time.Minute)
+	}
 	stationsController := api.NewStationsController(db, redisUtil)
 	staffController := api.NewStaffController(db, redisUtil)
 	
@@ -352,7 +498,15 @@ func main() {
 		revenueService.SetWeatherClient(cfg.WeatherLatitude, cfg.WeatherLongitude, cfg.WeatherTimezone)
 		
 		revenuePlanService := services.NewRevenuePlanService(db)
+		revenuePlanService.SetRevenueService(revenueService)
+		// План против факта - в revenue_plan_actuals в момент закрытия (для графика точности плана)
+		revenuePlanService.StartPlanActualReconciler(cfg.BusinessCloseHour, cfg.BusinessCloseMin)
 		analyticsController = api.NewAnalyticsController(revenueService, revenuePlanService)
+		analyticsController.SetDemandForecastService(demandForecastService)
+		if stockService != nil {
+			stockService.SetMenuMarginThreshold(cfg.MenuMarginThresholdPercent)
+			analyticsController.SetStockService(stockService)
+		}
 		log.Println("✅ Analytics Controller инициализирован")
 	} else {
 		log.Println("⚠️ Analytics Controller НЕ инициализирован: Redis или DB недоступны")
@@ -385,7 +539,9 @@ func main() {
 			orderService = nil
 		} else {
 			orderService = services.NewOrderService(sqlDB, redisUtil)
-			log.Println("✅ OrderService инициализирован")
+			orderService.SetArchiveRetentionDays(cfg.ArchiveRetentionDays)
+			erpController.SetOrderService(orderService)
+			log.Printf("✅ OrderService инициализирован (хранение архива: %d дн., 0 = бессрочно)", cfg.ArchiveRetentionDays)
 			
 			// КРИТИЧНО: BootstrapState ПЕРЕД запуском Kafka consumer
 			// Восстанавливаем активные заказы из PostgreSQL в Redis
@@ -427,11 +583,21 @@ func main() {
 		log.Printf("📡 Kafka WS Consumer: используем брокеры: %s", cfg.KafkaBrokers)
 		// startFromLatest = true, так как мы уже восстановили состояние из БД
 		startFromLatest := orderService != nil
-		kafkaConsumer := api.NewKafkaWSConsumer(cfg.KafkaBrokers, "pizza-orders", redisUtil, cfg.KafkaUsername, cfg.KafkaPassword, cfg.KafkaCACert, startFromLatest, orderService)
+		kafkaConsumer := api.NewKafkaWSConsumer(cfg.KafkaBrokers, cfg.KafkaOrdersTopic, cfg.KafkaConsumerGroup, redisUtil, cfg.KafkaUsername, cfg.KafkaPassword, cfg.KafkaCACert, startFromLatest, orderService)
+		kafkaConsumer.SetWorkerCount(cfg.KafkaConsumerWorkers)
 		kafkaConsumer.Start()
-		log.Printf("📡 Kafka WS Consumer запущен: GroupID=order-service-stable-group, StartOffset=%s", 
-			map[bool]string{true: "LastOffset (после bootstrap)", false: "FirstOffset"}[startFromLatest])
+		log.Printf("📡 Kafka WS Consumer запущен: Topic=%s, GroupID=%s, StartOffset=%s, Workers=%d", cfg.KafkaOrdersTopic, cfg.KafkaConsumerGroup,
+			map[bool]string{true: "LastOffset (после bootstrap)", false: "FirstOffset"}[startFromLatest], cfg.KafkaConsumerWorkers)
 		defer kafkaConsumer.Stop()
+
+		// Watchdog отставания: заказы из Kafka должны доходить до KDS без задержки
+		kafkaLagWatchdog := api.NewKafkaLagWatchdog(
+			api.NewKafkaOffsetReader(cfg.KafkaBrokers, cfg.KafkaUsername, cfg.KafkaPassword, cfg.KafkaCACert),
+			cfg.KafkaOrdersTopic, cfg.KafkaConsumerGroup,
+			int64(cfg.KafkaLagAlertThreshold), time.Duration(cfg.KafkaLagCheckIntervalSeconds)*time.Second)
+		kafkaLagWatchdog.Start()
+		defer kafkaLagWatchdog.Stop()
+		erpController.SetKafkaLagWatchdog(kafkaLagWatchdog)
 	} else {
 		if cfg.KafkaBrokers == "" {
 			log.Println("⚠️ Kafka WS Consumer НЕ запущен: KAFKA_BROKERS не установлен")
@@ -441,38 +607,25 @@ func main() {
 	}
 
 	// Магазин "Пицца Тест" - создание заказов
-	apiGroup.POST("/order", orderController.CreateOrder)
+	apiGroup.POST("/order", createOrderLimiter, orderController.CreateOrder)
 	
 	// Staff Management (для Wails)
 	if db != nil && staffController != nil {
 		apiGroup.GET("/staff", staffController.GetStaff) // Получить список сотрудников (для Wails)
 	}
 	
-	apiGroup.GET("/menu", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"pizzas": api.GetAvailablePizzas(),
-			"extras": api.GetAvailableExtras(),
-			"sets":   api.GetAvailableSets(),
-		})
-	})
+	menuController := api.NewMenuController(menuService)
+	apiGroup.GET("/menu", menuController.GetMenu) // Меню (?check_stock=true&branch_id= - с доступностью по остаткам)
 	// Отдельные эндпоинты для меню
 	menuGroup := apiGroup.Group("/menu")
 	{
-		menuGroup.GET("/pizzas", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{
-				"pizzas": api.GetAvailablePizzas(),
-			})
-		})
-		menuGroup.GET("/extras", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{
-				"extras": api.GetAvailableExtras(),
-			})
-		})
-		menuGroup.GET("/sets", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{
-				"sets": api.GetAvailableSets(),
-			})
-		})
+		menuGroup.GET("/availability", menuController.GetMenuAvailability) // Доступность пицц и наборов по остаткам филиала
+		menuGroup.GET("/pizzas", menuController.GetPizzas) // Пиццы (?branch_id= - с настройками филиала)
+		menuGroup.GET("/extras", menuController.GetExtras) // Допы (?branch_id= - с настройками филиала)
+		menuGroup.GET("/sets", menuController.GetSets)     // Наборы (?branch_id= - с настройками филиала)
+		menuGroup.GET("/overrides", menuController.GetMenuOverrides)                                         // Настройки меню филиала (?branch_id=)
+		menuGroup.PUT("/overrides", api.RequireAdminRole(redisUtil), menuController.SetMenuOverride)        // Скрыть позицию в филиале или задать цену филиала (только админ)
+		menuGroup.DELETE("/overrides/:id", api.RequireAdminRole(redisUtil), menuController.DeleteMenuOverride) // Удалить настройку меню филиала (только админ)
 	}
 
 	// ERP "ЕРПИ ТЕСТ" - просмотр заказов
@@ -480,7 +633,7 @@ func main() {
 	{
 		// ВАЖНО: POST должен быть ПЕРЕД GET, чтобы избежать конфликта маршрутов
 		if orderController != nil {
-			erpGroup.POST("/orders", orderController.CreateOrder)             // Создать заказ (для Wails)
+			erpGroup.POST("/orders", createOrderLimiter, orderController.CreateOrder) // Создать заказ (для Wails)
 			log.Println("✅ POST /api/v1/erp/orders зарегистрирован")
 		} else {
 			log.Println("⚠️ POST /api/v1/erp/orders НЕ зарегистрирован: orderController == nil")
@@ -488,30 +641,46 @@ func main() {
 		erpGroup.GET("/orders", erpController.GetOrders)                 // Активные заказы
 		erpGroup.GET("/orders/pending", erpController.GetPendingOrders)  // Отложенные (будущие) заказы
 		erpGroup.GET("/orders/batch", erpController.GetOrdersBatch)      // Новая партия по 50
+		erpGroup.GET("/orders/by-slot", erpController.GetOrdersBySlot)   // Активные и отложенные заказы по слотам (доска диспетчера)
 		erpGroup.POST("/orders/:id/processed", erpController.MarkOrderProcessed) // Отметить конкретный заказ
+		erpGroup.POST("/orders/batch-processed", erpController.MarkOrdersProcessedBatch) // Отметить пачку заказов (или весь слот)
+		erpGroup.POST("/orders/purge", api.RequireAdminRole(redisUtil), erpController.PurgeArchivedOrders) // Удалить архив заказов до даты (только админ, есть dry_run)
+		erpGroup.POST("/rebuild-state", api.RequireAdminRole(redisUtil), erpController.RebuildState)   // Пересобрать заказы и слоты в Redis из PostgreSQL (только админ)
+		erpGroup.PUT("/orders/:id/status", erpController.UpdateOrderStatus)      // Сменить статус заказа (с валидацией State Machine)
+		erpGroup.PUT("/orders/:id/items", erpController.EditOrderItems)         // Изменить позиции заказа (до начала готовки)
+		erpGroup.POST("/orders/:id/cancel", erpController.CancelOrder)          // Отменить заказ: вернуть списания, освободить слот, исключить из выручки
 		erpGroup.GET("/orders/:id", erpController.GetOrder)
+		erpGroup.GET("/orders/:id/trace", erpController.GetOrderTrace)         // Полная трассировка заказа для поддержки (слот, статусы, списания)
 		erpGroup.GET("/stats", erpController.GetStats)
 		erpGroup.GET("/revenue/forecast", erpController.GetRevenueForecast) // Прогноз выручки на конец дня (должен быть ПЕРЕД /revenue)
 		erpGroup.GET("/revenue", erpController.GetRevenue)              // Выручка за день
 		erpGroup.GET("/daily-plan", erpController.GetDailyPlan)        // План на день
 		erpGroup.PUT("/daily-plan", erpController.SetDailyPlan)         // Установить план на день
+		erpGroup.GET("/weekday-plans", erpController.GetWeekdayPlans)   // Планы по умолчанию для дней недели
+		erpGroup.PUT("/weekday-plans", erpController.SetWeekdayPlans)   // Установить планы для дней недели
 		erpGroup.GET("/kitchen-load", erpController.GetKitchenLoad)     // Загрузка кухни (оперативная)
+		erpGroup.GET("/shift-summary", erpController.GetShiftSummary)   // Итоги смены кухни: заказы, среднее время, слот-пик, станции, расход сырья
 		erpGroup.GET("/kafka-orders-count", erpController.GetKafkaOrdersCount)   // Количество заказов в Kafka
 		erpGroup.GET("/kafka-orders-sample", erpController.GetKafkaOrdersSample) // Примеры заказов из Kafka
+		erpGroup.GET("/kafka-lag", erpController.GetKafkaLag)                     // Отставание обработки заказов из Kafka по партициям
 		
 		// Управление слотами
 		erpGroup.GET("/slots", erpController.GetSlots)                    // Получить все слоты
 		erpGroup.GET("/slots/config", erpController.GetSlotConfig)        // Получить конфигурацию слотов
+		erpGroup.GET("/slots/analytics", erpController.GetSlotAnalytics)  // Загрузка слотов и отказы за день
 		erpGroup.PUT("/slots/config", erpController.UpdateSlotConfig)     // Обновить конфигурацию слотов
 		erpGroup.PUT("/slots/:slot_id/toggle", erpController.ToggleSlot)  // Отключить/включить слот
 		erpGroup.PUT("/slots/:slot_id/disabled", erpController.UpdateSlotDisabled) // Обновить статус отключения слота
 		erpGroup.PUT("/slots/:slot_id/plan", erpController.UpdateSlotPlan) // Обновить план слота
 		erpGroup.PUT("/slots/plan/batch", erpController.UpdateSlotsPlanBatch) // Обновить планы для нескольких слотов (батч)
 		erpGroup.PUT("/slots/:slot_id/capacity", erpController.UpdateSlotCapacity) // Обновить лимит слота
+		erpGroup.POST("/slots/:slot_id/reschedule", erpController.RescheduleSlot) // Перенести заказы слота на более поздние слоты
 		
 		// Управление станциями кухни
 		erpGroup.GET("/stations", stationsController.GetStations)                    // Получить все станции
 		erpGroup.GET("/stations/capabilities", stationsController.GetCapabilities)  // Получить capabilities и категории
+		erpGroup.GET("/stations/load", stationsController.GetStationLoad)           // Загрузка станций (очередь, в работе, среднее время)
+		erpGroup.GET("/stations/:id/queue", erpController.GetStationQueue)          // Очередь позиций станции по всем активным заказам
 		erpGroup.POST("/stations", stationsController.CreateStation)                // Создать станцию
 		erpGroup.PUT("/stations/:id", stationsController.UpdateStation)             // Обновить станцию
 		erpGroup.DELETE("/stations/:id", stationsController.DeleteStation)          // Удалить станцию
@@ -565,15 +734,23 @@ func main() {
 				// Товары
 				nomenclatureGroup.GET("", nomenclatureController.GetNomenclatureItems)                    // Список товаров
 				nomenclatureGroup.GET("/suggest-sku", nomenclatureController.SuggestSKU)                 // Предложение SKU на основе PLU
+				nomenclatureGroup.POST("/suggest-sku-batch", nomenclatureController.SuggestSKUBatch)     // Пакетное предложение SKU для импорта
+			nomenclatureGroup.POST("/bulk-price-update", nomenclatureController.BulkUpdatePrices)    // Массовое изменение цен категории (наценка)
 			nomenclatureGroup.GET("/:id", nomenclatureController.GetNomenclatureItem)                // Получить товар
 			nomenclatureGroup.POST("", nomenclatureController.CreateNomenclatureItem)                // Создать товар
 			nomenclatureGroup.PUT("/:id", nomenclatureController.UpdateNomenclatureItem)              // Обновить товар
-			nomenclatureGroup.DELETE("/:id", nomenclatureController.DeleteNomenclatureItem)          // Удалить товар
+			nomenclatureGroup.DELETE("/:id", api.RequireAdminRoleWhen(redisUtil, func(c *gin.Context) bool {
+				return c.Query("force") == "true"
+			}), nomenclatureController.DeleteNomenclatureItem) // Удалить товар (409, если используется; ?force=true - только админ)
+			nomenclatureGroup.GET("/:id/usage", nomenclatureController.GetNomenclatureUsage)           // Где используется товар (рецепты, партии)
+			nomenclatureGroup.POST("/:id/restore", nomenclatureController.RestoreNomenclatureItem)   // Восстановить удаленный товар
+			nomenclatureGroup.GET("/:id/price-history", nomenclatureController.GetPriceHistory)       // История закупочных цен
 			
 			// Импорт
 			nomenclatureGroup.POST("/upload-file", nomenclatureController.UploadNomenclatureFile)        // Определение заголовков файла
 			nomenclatureGroup.POST("/parse-file", nomenclatureController.ParseNomenclatureFile)         // Парсинг файла с маппингом
 			nomenclatureGroup.POST("/validate-import", nomenclatureController.ValidateNomenclatureImport) // Валидация импорта
+			nomenclatureGroup.POST("/validate-import-report", nomenclatureController.ValidateNomenclatureImportReport) // Валидация импорта с отчетом XLSX
 			nomenclatureGroup.POST("/import", nomenclatureController.ImportNomenclature)                  // Массовый импорт
 			
 			// Категории
@@ -581,6 +758,7 @@ func main() {
 			nomenclatureGroup.POST("/categories", nomenclatureController.CreateNomenclatureCategory)       // Создать категорию
 			nomenclatureGroup.PUT("/categories/:id", nomenclatureController.UpdateNomenclatureCategory)    // Обновить категорию
 			nomenclatureGroup.DELETE("/categories/:id", nomenclatureController.DeleteNomenclatureCategory) // Удалить категорию
+			nomenclatureGroup.POST("/categories/:id/restore", nomenclatureController.RestoreNomenclatureCategory) // Восстановить категорию
 		}
 		log.Println("📦 Nomenclature endpoints enabled: /api/v1/inventory/nomenclature")
 	} else {
@@ -590,23 +768,42 @@ func main() {
 	// Управление остатками и сроками годности
 	if db != nil && stockService != nil {
 		stockController := api.NewStockController(stockService)
+		stockController.SetBranchService(branchService) // Проверка branch_id складских операций и филиал по умолчанию
 		stockGroup := apiGroup.Group("/inventory/stock")
 		{
 			stockGroup.GET("", stockController.GetStockItems)                    // Список остатков
+			stockGroup.GET("/by-zone", stockController.GetStockByZone)           // Остатки филиала по зонам хранения (морозильник, холодильник, сухой склад)
 			stockGroup.GET("/at-risk", stockController.GetAtRiskInventory)       // Рискованные товары
+			stockGroup.GET("/markdown-suggestions", stockController.GetMarkdownSuggestions) // Предлагаемые скидки на партии, которые не успеем продать до истечения срока
 			stockGroup.GET("/expiry-alerts", stockController.GetExpiryAlerts)    // Уведомления о сроке годности
+			stockGroup.POST("/expiry-alerts/resolve", stockController.ResolveExpiryAlerts)         // Закрыть несколько уведомлений
+			stockGroup.POST("/expiry-alerts/:id/resolve", stockController.ResolveExpiryAlert)      // Закрыть уведомление (consumed/written_off/ignored)
 			stockGroup.GET("/movements", stockController.GetStockMovements)      // Журнал движений склада (аудит)
 			stockGroup.GET("/batches-history", stockController.GetBatchesHistory) // История батчей по номенклатуре
-			stockGroup.POST("/process-sale", stockController.ProcessSaleDepletion)           // Автоматическое списание при продаже
+			stockGroup.GET("/valuation-history", stockController.GetValuationHistory) // История стоимости склада (ежедневные снимки)
+			stockGroup.GET("/aging", stockController.GetAgingReport)              // Возраст остатков на складе (залежалый товар)
+			stockGroup.POST("/merge-batches", stockController.MergeBatches)      // Объединение одинаковых партий
+			stockGroup.GET("/batches/suspected-cost-errors", stockController.GetSuspectedCostErrors) // Партии с подозрительно низкой ценой (только просмотр)
+			stockGroup.PUT("/batches/:id/cost", api.RequireAdminRole(redisUtil), stockController.CorrectBatchCost) // Исправить цену партии (только админ, с записью в журнал)
+			stockGroup.GET("/orphaned-batches", stockController.GetOrphanedBatches) // Партии удаленной номенклатуры
+			stockGroup.POST("/orphaned-batches/reconcile", api.RequireAdminRole(redisUtil), stockController.ReconcileOrphanedBatches) // Списать или перепривязать партии удаленной номенклатуры (только админ)
+			stockGroup.POST("/process-sale", stockController.ProcessSaleDepletion)           // Автоматическое списание при продаже (is_set - списание набора по рецептам его пицц)
 		stockGroup.POST("/commit-production", stockController.CommitProduction)          // Ручное производство полуфабриката
-		stockGroup.GET("/recipes/:id/prime-cost", stockController.GetRecipePrimeCost)   // Расчет себестоимости рецепта
+		stockGroup.GET("/recipes/:id/prime-cost", stockController.GetRecipePrimeCost)   // Расчет себестоимости рецепта (?source=stock&branch_id= - по ценам остатков филиала)
+		stockGroup.GET("/recipes/:id/prime-cost-breakdown", stockController.GetRecipePrimeCostBreakdown) // Себестоимость по ингредиентам с долями
 		stockGroup.POST("/check-expiry-alerts", stockController.CheckExpiryAlerts) // Ручная проверка сроков
+		stockGroup.POST("/recompute-expiry", api.RequireAdminRole(redisUtil), stockController.RecomputeExpiry) // Пересчет просрочки и недостающих уведомлений по всем филиалам (только админ)
 		stockGroup.POST("/process-inbound-invoice", stockController.ProcessInboundInvoice) // Обработка входящей накладной (оприходование)
 		// CRUD для накладных
 		stockGroup.GET("/invoices", stockController.GetInvoices)                    // Список накладных
 		stockGroup.POST("/invoices", stockController.CreateInvoice)                 // Создать накладную (черновик)
 		stockGroup.PUT("/invoices/:id", stockController.UpdateInvoice)              // Обновить накладную (черновик)
 		stockGroup.DELETE("/invoices/:id", stockController.DeleteInvoice)          // Удалить накладную (черновик)
+		stockGroup.POST("/invoices/:id/void", stockController.VoidInvoice)         // Аннулировать проведенную накладную (откат оприходования)
+		// Замены сырья при нехватке (используются рецептами с allow_substitutions)
+		stockGroup.GET("/substitutions", stockController.GetIngredientSubstitutions)          // Список замен
+		stockGroup.POST("/substitutions", stockController.CreateIngredientSubstitution)       // Создать замену
+		stockGroup.DELETE("/substitutions/:id", stockController.DeleteIngredientSubstitution) // Удалить замену
 		}
 		log.Println("📊 Stock endpoints enabled: /api/v1/inventory/stock")
 	} else {
@@ -617,14 +814,21 @@ func main() {
 	if db != nil && recipeService != nil {
 		log.Println("✅ Условия для регистрации роутов рецептов выполнены: db != nil && recipeService != nil")
 		recipeController := api.NewRecipeController(recipeService)
+		if stockService != nil {
+			recipeController.SetStockService(stockService)
+		}
 		recipeGroup := apiGroup.Group("/recipes")
 		{
 			recipeGroup.GET("", recipeController.GetRecipes)           // Список рецептов
 			recipeGroup.GET("/:id", recipeController.GetRecipe)         // Получить рецепт
+			recipeGroup.GET("/:id/allergens", recipeController.GetRecipeAllergens) // Аллергены рецепта (с полуфабрикатами)
+			recipeGroup.GET("/:id/max-producible", recipeController.GetMaxProducible) // Сколько порций можно приготовить из остатков
 			recipeGroup.POST("", recipeController.CreateRecipe)         // Создать рецепт
 			recipeGroup.POST("/unified-create", recipeController.UnifiedCreateMenuItem) // Unified create: Nomenclature + Recipe + PizzaRecipe
 			recipeGroup.PUT("/:id", recipeController.UpdateRecipe)      // Обновить рецепт
 			recipeGroup.DELETE("/:id", recipeController.DeleteRecipe)   // Удалить рецепт
+			recipeGroup.POST("/:id/restore", recipeController.RestoreRecipe) // Восстановить удаленный рецепт
+			recipeGroup.POST("/:id/clone", recipeController.CloneRecipe)     // Копия рецепта как черновик (вариант блюда)
 			recipeGroup.GET("/orphaned-ingredients", recipeController.FindOrphanedIngredients) // Найти осиротевшие ингредиенты
 			
 			// Иерархическая структура папок
@@ -638,9 +842,12 @@ func main() {
 		log.Println("📋 Recipe endpoints enabled: /api/v1/recipes")
 		log.Println("   - GET    /api/v1/recipes")
 		log.Println("   - GET    /api/v1/recipes/:id")
+		log.Println("   - GET    /api/v1/recipes/:id/allergens")
+		log.Println("   - GET    /api/v1/recipes/:id/max-producible")
 		log.Println("   - POST   /api/v1/recipes")
 		log.Println("   - PUT    /api/v1/recipes/:id")
 		log.Println("   - DELETE /api/v1/recipes/:id")
+		log.Println("   - POST   /api/v1/recipes/:id/restore")
 	} else {
 		if db == nil {
 			log.Println("⚠️ Recipe endpoints NOT enabled: db == nil")
@@ -663,6 +870,7 @@ func main() {
 			
 			// Recipe Versioning
 			technologistGroup.GET("/recipes/:id/versions", technologistController.GetRecipeVersions) // Версии рецепта
+			technologistGroup.GET("/recipes/:id/diff", technologistController.DiffRecipeVersions)   // Разница между версиями
 			technologistGroup.GET("/recipes/:id/usage-tree", technologistController.GetRecipeUsageTree) // Дерево использования
 			
 			// Training Materials
@@ -691,11 +899,13 @@ func main() {
 			technologistGroup.POST("/pizzas/:pizza_name/extras", technologistController.AddPizzaExtra)           // Привязать доп к пицце
 			technologistGroup.PUT("/pizzas/:pizza_name/extras/:extra_id", technologistController.UpdatePizzaExtra) // Обновить связь
 			technologistGroup.DELETE("/pizzas/:pizza_name/extras/:extra_id", technologistController.RemovePizzaExtra) // Отвязать доп от пиццы
+			technologistGroup.PUT("/pizzas/:pizza_name/prep-time", technologistController.SetPizzaPrepTime)          // Время приготовления пиццы (KDS)
 		}
 		log.Println("✅ Technologist Workspace endpoints registered")
 		log.Println("📋 Technologist endpoints enabled: /api/v1/technologist")
 		log.Println("   - GET    /api/v1/technologist/dashboard")
 		log.Println("   - GET    /api/v1/technologist/recipes/:id/versions")
+		log.Println("   - GET    /api/v1/technologist/recipes/:id/diff")
 		log.Println("   - GET    /api/v1/technologist/recipes/:id/usage-tree")
 		log.Println("   - POST   /api/v1/technologist/training-materials")
 		log.Println("   - GET    /api/v1/technologist/recipes/:id/training-materials")
@@ -713,10 +923,16 @@ func main() {
 		{
 			analyticsGroup.POST("/run-forecast", analyticsController.RunForecast)        // Запустить прогнозирование
 			analyticsGroup.GET("/latest-plan", analyticsController.GetLatestPlan)       // Получить последний план
+			analyticsGroup.GET("/forecast-accuracy", analyticsController.GetForecastAccuracy) // Точность прогноза спроса (MAPE/bias)
+			analyticsGroup.GET("/menu-margins", analyticsController.GetMenuMargins)           // Себестоимость и маржа позиций меню
+			analyticsGroup.GET("/plan-vs-actual", analyticsController.GetPlanVsActual)        // План выручки против факта по дням
 		}
 		log.Println("✅ Analytics endpoints enabled: /api/v1/analytics")
 		log.Println("   - POST   /api/v1/analytics/run-forecast")
 		log.Println("   - GET    /api/v1/analytics/latest-plan")
+		log.Println("   - GET    /api/v1/analytics/forecast-accuracy")
+		log.Println("   - GET    /api/v1/analytics/menu-margins")
+		log.Println("   - GET    /api/v1/analytics/plan-vs-actual")
 	} else {
 		log.Println("⚠️ Analytics endpoints NOT enabled: analyticsController == nil")
 	}
@@ -741,6 +957,7 @@ func main() {
 		// Контрагенты
 		if counterpartyService != nil {
 			counterpartyController := api.NewCounterpartyController(counterpartyService)
+			counterpartyController.SetBranchService(branchService) // Проверка branch_id счетов
 			counterpartyGroup := financeGroup.Group("/counterparties")
 			{
 				counterpartyGroup.GET("", counterpartyController.GetCounterparties)           // Список контрагентов
@@ -763,12 +980,24 @@ func main() {
 			transactionGroup := financeGroup.Group("/transactions")
 			{
 				transactionGroup.GET("", financeController.GetTransactions)           // Список транзакций
+				transactionGroup.GET("/export", financeController.ExportTransactions) // Выгрузка за период (?format=1c|csv)
 				transactionGroup.GET("/:id", financeController.GetTransaction)        // Получить транзакцию
 				transactionGroup.POST("", financeController.CreateTransaction)         // Создать транзакцию
 			}
 			financeGroup.GET("/counterparties/with-balances", financeController.GetCounterpartiesWithBalances) // Контрагенты с балансами
+			financeGroup.GET("/cashflow", financeController.GetCashFlow) // Движение денег по дням
+			financeGroup.GET("/bank-operations", financeController.GetBankOperations)                  // Банковские операции (?status=pending - ожидают оплаты)
+			financeGroup.POST("/bank-operations/:id/confirm", financeController.ConfirmBankOperation) // Отметить оплаченной по выписке банка
 			log.Println("💰 Finance transaction endpoints enabled: /api/v1/finance/transactions")
 		}
+		
+		// Курсы валют
+		if currencyService != nil {
+			currencyController := api.NewCurrencyController(currencyService)
+			financeGroup.GET("/exchange-rates", currencyController.GetExchangeRates) // Курсы валют на дату
+			financeGroup.POST("/exchange-rates", currencyController.SetExchangeRate) // Задать курс вручную
+			log.Println("💱 Exchange rate endpoints enabled: /api/v1/finance/exchange-rates")
+		}
 	} else {
 		log.Println("⚠️ Finance endpoints not enabled: PostgreSQL not available")
 	}
@@ -783,8 +1012,10 @@ func main() {
 			purchaseOrderGroup.POST("", purchaseOrderController.CreatePurchaseOrder)                // Создать заказ
 			purchaseOrderGroup.PUT("/:id", purchaseOrderController.UpdatePurchaseOrder)             // Обновить заказ
 			purchaseOrderGroup.DELETE("/:id", purchaseOrderController.DeletePurchaseOrder)          // Отменить заказ
+			purchaseOrderGroup.POST("/:id/approve", api.RequireManagerRole(redisUtil), purchaseOrderController.ApprovePurchaseOrder) // Утвердить заказ выше порога (только менеджер/админ)
 			purchaseOrderGroup.POST("/:id/send", purchaseOrderController.SendPurchaseOrder)           // Отправить заказ
 			purchaseOrderGroup.POST("/:id/receive", purchaseOrderController.ReceivePurchaseOrder)    // Получить заказ
+			purchaseOrderGroup.POST("/:id/receive-partial", purchaseOrderController.ReceivePurchaseOrderPartial) // Принять поставку частично (с оприходованием)
 			purchaseOrderGroup.POST("/:id/cancel", purchaseOrderController.CancelPurchaseOrder)      // Отменить заказ
 		}
 		log.Println("📦 Purchase Order endpoints enabled: /api/v1/purchase-orders")
@@ -799,6 +1030,7 @@ func main() {
 		{
 			procurementGroup.GET("/monthly-plan", planningController.GetMonthlyPlan)           // Получить месячный план
 			procurementGroup.PUT("/plan-cell", planningController.UpdatePlanCell)              // Обновить ячейку плана
+			procurementGroup.POST("/auto-fill-plan", planningController.AutoFillPlan)         // Автозаполнение плана из прогноза спроса
 			procurementGroup.POST("/submit-plan", planningController.SubmitPlan)               // Отправить план (создать заказы)
 		}
 		log.Println("📅 Procurement Planning endpoints enabled: /api/v1/procurement")
@@ -844,11 +1076,15 @@ func main() {
 		kitchenGroup.POST("/workers/start", kitchenController.StartWorkers)      // Запустить воркеров (с указанием количества)
 	}
 	
+	// WebSocket: подключение только по одноразовому тикету (?ticket=), роль соединения берется из тикета
+	wsTicketController := api.NewWSTicketController(redisUtil)
+	apiGroup.POST("/ws-ticket", wsTicketController.IssueTicket) // Выдать WS-тикет (после PIN или входа админа)
+	
 	// WebSocket для планшетов поваров
-	apiGroup.GET("/ws", api.ServeWS)
+	apiGroup.GET("/ws", wsTicketController.RequireTicket(), api.ServeWS)
 	
 	// WebSocket для ERP системы
-	erpGroup.GET("/ws", api.ServeERPWS)
+	erpGroup.GET("/ws", wsTicketController.RequireTicket(), api.ServeERPWS)
 	go func() {
 		lis, err := net.Listen("tcp", ":50051")
 		if err != nil {
@@ -857,7 +1093,7 @@ func main() {
 	
 		grpcServer := grpc.NewServer()
 		// Регистрируем наш сервис с Kafka интеграцией
-		grpcOrderServer := api.NewOrderGRPCServer(redisUtil, cfg.KafkaBrokers, db, cfg.BusinessOpenHour, cfg.BusinessOpenMin, cfg.BusinessCloseHour, cfg.BusinessCloseMin, cfg.KafkaUsername, cfg.KafkaPassword, cfg.KafkaCACert, orderService)
+		grpcOrderServer := api.NewOrderGRPCServer(redisUtil, cfg.KafkaBrokers, cfg.KafkaOrdersTopic, db, cfg.BusinessOpenHour, cfg.BusinessOpenMin, cfg.BusinessCloseHour, cfg.BusinessCloseMin, cfg.KafkaUsername, cfg.KafkaPassword, cfg.KafkaCACert, orderService)
 		pb.RegisterOrderServiceServer(grpcServer, grpcOrderServer)
 	
 		log.Printf("📡 gRPC Server starting on port 50051")
@@ -0,0 +1,33 @@
+-- Миграция 030: Мультивалютные накладные
+-- Курсы валют к рублю на дату + валюта у контрагентов, накладных и финансовых транзакций
+-- Суммы в рублях остаются в прежних колонках (total_amount, amount), исходная валюта хранится отдельно
+
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    id UUID PRIMARY KEY,
+    currency VARCHAR(3) NOT NULL, -- ISO 4217
+    date DATE NOT NULL,
+    rate DECIMAL(15, 6) NOT NULL, -- Сколько рублей стоит 1 единица валюты
+    source VARCHAR(20) DEFAULT 'manual', -- 'manual', 'cbr'
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_exchange_rate_currency_date ON exchange_rates(currency, date);
+
+ALTER TABLE counterparties ADD COLUMN IF NOT EXISTS currency VARCHAR(3) DEFAULT 'RUB';
+
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS currency VARCHAR(3) DEFAULT 'RUB';
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS original_total_amount DECIMAL(15, 2) DEFAULT 0;
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS exchange_rate DECIMAL(15, 6) DEFAULT 1;
+
+ALTER TABLE finance_transactions ADD COLUMN IF NOT EXISTS currency VARCHAR(3) DEFAULT 'RUB';
+ALTER TABLE finance_transactions ADD COLUMN IF NOT EXISTS original_amount DECIMAL(15, 2) DEFAULT 0;
+ALTER TABLE finance_transactions ADD COLUMN IF NOT EXISTS exchange_rate DECIMAL(15, 6) DEFAULT 1;
+
+-- Существующие записи - в рублях
+UPDATE invoices SET original_total_amount = total_amount WHERE original_total_amount = 0;
+UPDATE finance_transactions SET original_amount = amount WHERE original_amount = 0;
+
+COMMENT ON TABLE exchange_rates IS 'Курсы валют к рублю на дату (ручной ввод или API ЦБ РФ)';
+COMMENT ON COLUMN invoices.total_amount IS 'Сумма накладной в рублях по курсу на дату накладной';
+COMMENT ON COLUMN invoices.original_total_amount IS 'Сумма накладной в валюте накладной';
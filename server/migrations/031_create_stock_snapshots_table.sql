@@ -0,0 +1,19 @@
+-- Миграция 031: Ежедневные снимки оценки склада
+-- Стоимость остатков по товарам на конец дня (та же формула, что в GetStockItems)
+
+CREATE TABLE IF NOT EXISTS stock_snapshots (
+    id UUID PRIMARY KEY,
+    snapshot_date DATE NOT NULL,
+    branch_id UUID NOT NULL,
+    nomenclature_id UUID NOT NULL,
+    nomenclature_name VARCHAR(255),
+    quantity DECIMAL(14, 4) DEFAULT 0, -- В BaseUnit
+    base_unit VARCHAR(20),
+    cost_value DECIMAL(14, 2) DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stock_snapshot_date_branch_item ON stock_snapshots(snapshot_date, branch_id, nomenclature_id);
+CREATE INDEX IF NOT EXISTS idx_stock_snapshots_branch_id ON stock_snapshots(branch_id);
+
+COMMENT ON TABLE stock_snapshots IS 'Оценка остатков склада на конец дня (история стоимости склада)';
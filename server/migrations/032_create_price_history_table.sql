@@ -0,0 +1,19 @@
+-- Миграция 032: История закупочных цен
+-- Каждое оприходование записывает цену товара у поставщика, last_price остается последней ценой
+
+CREATE TABLE IF NOT EXISTS price_history (
+    id UUID PRIMARY KEY,
+    nomenclature_id UUID NOT NULL,
+    counterparty_id UUID,
+    invoice_id UUID,
+    branch_id UUID,
+    price DECIMAL(10, 2) NOT NULL, -- За InboundUnit (кг/л/шт), в рублях
+    price_date DATE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_price_history_nomenclature_date ON price_history(nomenclature_id, price_date);
+CREATE INDEX IF NOT EXISTS idx_price_history_counterparty_id ON price_history(counterparty_id);
+CREATE INDEX IF NOT EXISTS idx_price_history_invoice_id ON price_history(invoice_id);
+
+COMMENT ON TABLE price_history IS 'История закупочных цен товаров по поставщикам (из оприходованных накладных)';
@@ -0,0 +1,23 @@
+-- Миграция 033: Замены сырья при нехватке на складе
+-- DebitIngredients списывает заменитель вместо закончившегося товара, если рецепт это разрешает (recipes.allow_substitutions)
+
+CREATE TABLE IF NOT EXISTS ingredient_substitutions (
+    id UUID PRIMARY KEY,
+    original_nomenclature_id UUID NOT NULL,
+    substitute_nomenclature_id UUID NOT NULL,
+    conversion_ratio DECIMAL(10, 4) NOT NULL DEFAULT 1, -- Базовых единиц заменителя на одну базовую единицу основного товара
+    priority INTEGER DEFAULT 0,
+    is_approved BOOLEAN DEFAULT TRUE,
+    notes TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_ingredient_substitutions_original ON ingredient_substitutions(original_nomenclature_id);
+CREATE INDEX IF NOT EXISTS idx_ingredient_substitutions_substitute ON ingredient_substitutions(substitute_nomenclature_id);
+CREATE INDEX IF NOT EXISTS idx_ingredient_substitutions_deleted_at ON ingredient_substitutions(deleted_at);
+
+ALTER TABLE recipes ADD COLUMN IF NOT EXISTS allow_substitutions BOOLEAN DEFAULT FALSE;
+
+COMMENT ON TABLE ingredient_substitutions IS 'Одобренные замены сырья: что списывать, если основной товар закончился';
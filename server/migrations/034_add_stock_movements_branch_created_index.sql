@@ -0,0 +1,4 @@
+-- Миграция 034: Индекс для постраничного журнала движений склада
+-- GET /inventory/stock/movements сортирует по created_at DESC, id DESC с фильтром по филиалу
+
+CREATE INDEX IF NOT EXISTS idx_stock_movements_branch_created ON stock_movements(branch_id, created_at);
@@ -0,0 +1,24 @@
+-- Миграция 035: Журнал бронирования слотов
+-- SlotService.RecordSlotOutcome пишет назначения, переполнения, отказы и освобождения слотов;
+-- GET /api/v1/erp/slots/analytics считает по нему загрузку и долю отказов
+
+CREATE TABLE IF NOT EXISTS slot_outcomes (
+    id UUID PRIMARY KEY,
+    slot_id VARCHAR(50),
+    slot_start TIMESTAMP WITH TIME ZONE,
+    branch_id VARCHAR(36),
+    order_id VARCHAR(36),
+    outcome VARCHAR(20) NOT NULL, -- assigned, overflow, rejected, released
+    order_price INTEGER DEFAULT 0,
+    load INTEGER DEFAULT 0,
+    capacity INTEGER DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_slot_outcomes_slot_id ON slot_outcomes(slot_id);
+CREATE INDEX IF NOT EXISTS idx_slot_outcomes_slot_start ON slot_outcomes(slot_start);
+CREATE INDEX IF NOT EXISTS idx_slot_outcomes_branch_id ON slot_outcomes(branch_id);
+CREATE INDEX IF NOT EXISTS idx_slot_outcomes_order_id ON slot_outcomes(order_id);
+CREATE INDEX IF NOT EXISTS idx_slot_outcomes_created_at ON slot_outcomes(created_at);
+
+COMMENT ON TABLE slot_outcomes IS 'Журнал бронирования слотов: загрузка и отказы для подбора емкости';
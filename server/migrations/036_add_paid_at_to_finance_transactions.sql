@@ -0,0 +1,11 @@
+-- Миграция 036: Дата оплаты банковских операций
+-- Расход по безналичной накладной создается со статусом Pending и переводится в Completed
+-- при подтверждении по выписке банка (POST /finance/bank-operations/:id/confirm)
+
+ALTER TABLE finance_transactions ADD COLUMN IF NOT EXISTS paid_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_finance_transactions_paid_at ON finance_transactions(paid_at);
+
+-- Ожидающие оплаты банковские операции (GET /finance/bank-operations?status=pending)
+CREATE INDEX IF NOT EXISTS idx_finance_transactions_pending_bank ON finance_transactions(status, source)
+    WHERE status = 'Pending' AND deleted_at IS NULL;
@@ -0,0 +1,7 @@
+-- Миграция 037: Канал поступления заказа (website, telegram, walk_in)
+-- Используется для разбивки выручки по каналам (GET /erp/revenue, GET /erp/stats)
+-- У заказов, созданных до миграции, канал NULL - в отчетах они попадают в "unknown"
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS channel VARCHAR(50);
+
+CREATE INDEX IF NOT EXISTS idx_orders_channel_created_at ON orders(channel, created_at);
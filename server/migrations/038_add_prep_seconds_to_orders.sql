@@ -0,0 +1,5 @@
+-- Миграция 038: Оценка времени приготовления заказа (сумма prep_seconds позиций меню)
+-- Срок готовности (due_at) не хранится: он считается как visible_at + prep_seconds и меняется при переносе слота
+-- У заказов, созданных до миграции, оценки нет (NULL)
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS prep_seconds INTEGER;
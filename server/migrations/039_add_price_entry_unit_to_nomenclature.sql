@@ -0,0 +1,55 @@
+-- Миграция 039: Единица цены в накладной (nomenclature_items.price_entry_unit)
+-- inbound - цена за InboundUnit (за 1 кг/л/шт), base - цена за BaseUnit (за 1 г/мл)
+-- При оприходовании цена за BaseUnit умножается на коэффициент конвертации, в партии всегда лежит цена за InboundUnit.
+-- Чтение остатков цену не меняет, поэтому старые партии товаров с ценой "за грамм" нужно один раз пересчитать.
+--
+-- Порядок применения (один раз, до оприходования новых накладных по таким товарам):
+--   1. Выполнить шаг 1 (колонка создается и AutoMigrate при старте сервера - шаг идемпотентен)
+--   2. Проставить price_entry_unit = 'base' товарам, которые поставщик выставляет за грамм/мл (шаг 2, по SKU)
+--      Кандидаты можно посмотреть через GET /api/v1/inventory/stock/batches/suspected-cost-errors
+--   3. Выполнить шаг 3 с датой выката версии с price_entry_unit:
+--        psql -v cutoff="'2026-10-17 00:00:00'" -f 039_add_price_entry_unit_to_nomenclature.sql
+--      Партии, созданные после cutoff, уже нормализованы при оприходовании и не трогаются.
+-- Повторный запуск безопасен: пересчитанная партия помечается записью cost_correction в журнале движений.
+-- cost_per_unit хранится с 2 знаками, поэтому цена "за грамм" у старых партий уже округлена до копеек -
+-- точную цену таких партий при необходимости исправить через PUT /api/v1/inventory/stock/batches/:id/cost.
+
+-- Шаг 1: колонка
+ALTER TABLE nomenclature_items ADD COLUMN IF NOT EXISTS price_entry_unit VARCHAR(20) NOT NULL DEFAULT 'inbound';
+
+-- Шаг 2: товары с ценой за грамм/мл (пример, заполнить перед запуском)
+-- UPDATE nomenclature_items SET price_entry_unit = 'base' WHERE sku IN ('SKU-1', 'SKU-2');
+
+-- Шаг 3: пересчет старых партий товаров с price_entry_unit = 'base' (цена за г/мл -> за кг/л)
+BEGIN;
+
+CREATE TEMP TABLE migration_039_batches ON COMMIT DROP AS
+SELECT b.id, b.nomenclature_id, b.branch_id, b.unit, b.cost_per_unit AS old_cost,
+       ROUND(b.cost_per_unit * 1000, 2) AS new_cost
+FROM stock_batches b
+JOIN nomenclature_items n ON n.id = b.nomenclature_id
+WHERE n.price_entry_unit = 'base'
+  AND ((n.base_unit = 'g' AND n.inbound_unit = 'kg') OR (n.base_unit = 'ml' AND n.inbound_unit = 'l'))
+  AND b.source = 'invoice'
+  AND b.cost_per_unit > 0
+  AND b.created_at < :cutoff
+  AND b.deleted_at IS NULL
+  AND NOT EXISTS (
+      SELECT 1 FROM stock_movements m
+      WHERE m.stock_batch_id = b.id
+        AND m.movement_type = 'cost_correction'
+        AND m.notes LIKE 'Миграция 039:%'
+  );
+
+UPDATE stock_batches b
+SET cost_per_unit = t.new_cost, updated_at = NOW()
+FROM migration_039_batches t
+WHERE b.id = t.id;
+
+INSERT INTO stock_movements (id, stock_batch_id, nomenclature_id, branch_id, quantity, unit, movement_type, performed_by, notes, created_at)
+SELECT gen_random_uuid(), t.id, t.nomenclature_id, t.branch_id, 0, t.unit, 'cost_correction', 'migration_039',
+       'Миграция 039: цена за BaseUnit -> за InboundUnit: ' || t.old_cost || '₽ -> ' || t.new_cost || '₽',
+       NOW()
+FROM migration_039_batches t;
+
+COMMIT;
@@ -0,0 +1,9 @@
+-- Миграция 040: Утверждение заказов на закупку
+-- Заказ с суммой выше PURCHASE_ORDER_APPROVAL_THRESHOLD создается в статусе pending_approval
+-- и отправляется поставщику только после POST /api/v1/purchase-orders/:id/approve (approved_by, approved_at)
+
+ALTER TABLE purchase_orders DROP CONSTRAINT IF EXISTS purchase_orders_status_check;
+ALTER TABLE purchase_orders ADD CONSTRAINT purchase_orders_status_check
+    CHECK (status IN ('draft', 'pending_approval', 'ordered', 'partially_received', 'received', 'cancelled'));
+
+ALTER TABLE purchase_orders ADD COLUMN IF NOT EXISTS approved_at TIMESTAMP;
@@ -0,0 +1,20 @@
+-- Миграция 041: Ключ дедупликации проведенных накладных
+-- ProcessInboundInvoiceBatch считает накладную с тем же номером, поставщиком и филиалом уже проведенной
+-- и не оприходует ее повторно. Индекс закрывает гонку двух параллельных запросов:
+-- второй получает unique violation и возвращает результат первого
+
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM invoices
+        WHERE status = 'completed' AND deleted_at IS NULL
+        GROUP BY number, COALESCE(counterparty_id::text, ''), branch_id
+        HAVING COUNT(*) > 1
+    ) THEN
+        RAISE NOTICE 'Есть дубли проведенных накладных (номер, поставщик, филиал): индекс idx_invoices_posted_dedupe не создан, разберите дубли и повторите миграцию';
+    ELSE
+        CREATE UNIQUE INDEX IF NOT EXISTS idx_invoices_posted_dedupe
+            ON invoices (number, COALESCE(counterparty_id::text, ''), branch_id)
+            WHERE status = 'completed' AND deleted_at IS NULL;
+    END IF;
+END $$;
@@ -0,0 +1,17 @@
+-- Миграция 042: Меню филиала
+-- Позицию общего меню можно скрыть в одном филиале или продавать там по другой цене;
+-- GET /api/v1/menu?branch_id=xxx (и /menu/pizzas, /menu/extras, /menu/sets) применяют эти записи
+
+CREATE TABLE IF NOT EXISTS branch_menu_overrides (
+    id UUID PRIMARY KEY,
+    branch_id VARCHAR(36) NOT NULL,
+    item_name VARCHAR(255) NOT NULL, -- Название пиццы, допа или набора
+    available BOOLEAN NOT NULL DEFAULT TRUE,
+    price_override INTEGER, -- Цена в рублях для филиала, NULL - общая цена
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_branch_menu_overrides_branch_item ON branch_menu_overrides(branch_id, item_name);
+
+COMMENT ON TABLE branch_menu_overrides IS 'Меню филиала: скрытые позиции и цены, отличные от общего меню';
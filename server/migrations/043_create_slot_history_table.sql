@@ -0,0 +1,21 @@
+-- Миграция 043: Архив прошедших слотов
+-- Счетчики слотов живут в Redis REDIS_SLOT_HISTORY_TTL_MINUTES (по умолчанию 2 часа);
+-- фоновая задача переносит итог каждого закончившегося слота сюда до истечения ключей
+
+CREATE TABLE IF NOT EXISTS slot_history (
+    id UUID PRIMARY KEY,
+    slot_id VARCHAR(50) NOT NULL,
+    start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    load INTEGER NOT NULL DEFAULT 0, -- Итоговая загрузка в рублях
+    orders_count INTEGER NOT NULL DEFAULT 0,
+    capacity INTEGER NOT NULL DEFAULT 0, -- Номинальная емкость в рублях
+    effective_capacity INTEGER NOT NULL DEFAULT 0, -- Емкость с учетом овербукинга
+    disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    archived_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_slot_history_slot_id ON slot_history(slot_id);
+CREATE INDEX IF NOT EXISTS idx_slot_history_start_time ON slot_history(start_time);
+
+COMMENT ON TABLE slot_history IS 'Итоги прошедших слотов (загрузка, заказы, емкость) независимо от TTL Redis';
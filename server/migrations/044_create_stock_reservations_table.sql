@@ -0,0 +1,23 @@
+-- Миграция 044: Резерв ингредиентов под заказ
+-- Заказ, попавший в слот, откладывает ингредиенты (reserved): доступный остаток уменьшается, партии не трогаются.
+-- Приготовление списывает резерв со склада (committed), отмена заказа снимает его (released)
+
+CREATE TABLE IF NOT EXISTS stock_reservations (
+    id UUID PRIMARY KEY,
+    order_id VARCHAR(36) NOT NULL,
+    recipe_id UUID NOT NULL,
+    branch_id UUID NOT NULL,
+    nomenclature_id UUID NOT NULL,
+    quantity DECIMAL(12,4) NOT NULL, -- В базовой единице товара
+    unit VARCHAR(20),
+    status VARCHAR(20) NOT NULL DEFAULT 'reserved', -- reserved, committed, released
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_order_id ON stock_reservations(order_id);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_status ON stock_reservations(status);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_nomenclature_branch ON stock_reservations(nomenclature_id, branch_id);
+
+COMMENT ON TABLE stock_reservations IS 'Резерв ингредиентов под заказ до приготовления или отмены';
@@ -0,0 +1,18 @@
+-- Миграция 045: План выручки против факта по дням
+-- В момент закрытия дня сохраняется прогноз из revenue_plans и фактическая выручка, чтобы строить график точности плана
+
+CREATE TABLE IF NOT EXISTS revenue_plan_actuals (
+    id SERIAL PRIMARY KEY,
+    plan_date DATE NOT NULL,
+    branch_id VARCHAR(36) NOT NULL DEFAULT '', -- Пустой - сеть целиком
+    planned DECIMAL(15,2) NOT NULL,
+    actual DECIMAL(15,2) NOT NULL,
+    variance DECIMAL(15,2) NOT NULL, -- actual - planned
+    variance_percent DECIMAL(9,2), -- NULL при нулевом плане
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_revenue_plan_actuals_date_branch ON revenue_plan_actuals(plan_date, branch_id);
+
+COMMENT ON TABLE revenue_plan_actuals IS 'План выручки против фактической по дням (снимок в момент закрытия)';
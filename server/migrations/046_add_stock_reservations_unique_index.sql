@@ -0,0 +1,20 @@
+-- Миграция 046: Уникальность действующего резерва
+-- Повторный резерв того же заказа (ретрай, параллельный запрос) не должен отложить ингредиенты дважды:
+-- действующий (reserved) резерв уникален по заказу, рецепту и товару. Списанные и снятые резервы остаются историей
+
+-- Дубли, созданные до индекса, снимаем (оставляем самый ранний резерв)
+UPDATE stock_reservations r
+SET status = 'released', resolved_at = CURRENT_TIMESTAMP
+WHERE r.status = 'reserved'
+  AND EXISTS (
+    SELECT 1 FROM stock_reservations d
+    WHERE d.status = 'reserved'
+      AND d.order_id = r.order_id
+      AND d.recipe_id = r.recipe_id
+      AND d.nomenclature_id = r.nomenclature_id
+      AND (d.created_at, d.id) < (r.created_at, r.id)
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stock_reservations_active
+    ON stock_reservations(order_id, recipe_id, nomenclature_id)
+    WHERE status = 'reserved';